@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/types"
+	"golang.org/x/time/rate"
 )
 
 // SubscriptionAgent is the interface for the core EListMan business logic.
@@ -26,6 +29,13 @@ import (
 // system. It still performs address validation and will refuse to import
 // addresses that fail.
 //
+// ImportVerified adds many verified subscribers at once via
+// Database.PutBatchIfAbsent.
+// It validates each address using ImportValidator, and returns an error for
+// each subscriber that failed validation or couldn't be written, without
+// aborting the rest of the import. ImportOptions can skip either validation or
+// writing the subscribers.
+//
 // Remove removes a subscriber from the list. It's used by the SNS handler to
 // automatically remove addresses in response to bounces or complaints.
 //
@@ -36,6 +46,23 @@ import (
 // responses. (If that assumption ever proves untrue, it may be replaced by
 // Import.)
 //
+// RecordEngagement updates a verified subscriber's LastEngaged time. It's used
+// by the SNS handler in response to "Open" and "Click" events to enable
+// analysis of subscriber engagement. It does nothing for pending subscribers.
+//
+// RecordDelivery updates a verified subscriber's LastDelivered time. It's used
+// by the SNS handler in response to "Delivery" events when configured to do
+// so. It does nothing for pending subscribers.
+//
+// Revalidate validates one page of verified subscribers, removing those whose
+// addresses are now suppressed and flagging other failures. Addresses valid at
+// signup can go bad over time, e.g., when a domain expires or loses its MX
+// records. Repeatedly passing the NextStartKey from each RevalidateResult
+// sweeps the entire list.
+//
+// Status returns the status of the subscriber for an email address, or
+// StatusUnknown if no such subscriber exists.
+//
 // Send sends a message to the entire list, or to specified subscribers only. If
 // the `addrs` argument is empty, Send will send the message to the entire list.
 // If `addrs` isn't empty, it will send the message only to those addresses that
@@ -54,15 +81,50 @@ type SubscriptionAgent interface {
 	Validate(
 		ctx context.Context, address string,
 	) (failure *email.ValidationFailure, err error)
-	Import(ctx context.Context, address string) (err error)
+	ImportVerified(
+		ctx context.Context, subscribers []*db.Subscriber, opts ImportOptions,
+	) (errs []error, err error)
 	Remove(ctx context.Context, email string, reason ops.RemoveReason) error
 	Restore(ctx context.Context, email string) error
+	RecordEngagement(ctx context.Context, email string) error
+	RecordDelivery(ctx context.Context, email string) error
+	Revalidate(
+		ctx context.Context,
+		startKey db.StartKey,
+		maxSubscribers int,
+		ratePerSecond float64,
+	) (result *RevalidateResult, err error)
+	Status(ctx context.Context, email string) (db.SubscriberStatus, error)
 	Send(
 		ctx context.Context, msg *email.Message, addrs []string,
 	) (numSent int, err error)
+	TestSend(
+		ctx context.Context, msg *email.Message, address string,
+	) (numSent int, err error)
+}
+
+// SendLog records the recipients of each campaign, identified by an
+// email.Message.CampaignKey.
+//
+// db.DynamoDbEventLog implements this interface.
+type SendLog interface {
+	// RecordEvent records id and returns true if it wasn't already recorded.
+	RecordEvent(ctx context.Context, id string) (firstTime bool, err error)
+
+	// ForgetEvent removes id, so that the next RecordEvent call for it
+	// returns true.
+	ForgetEvent(ctx context.Context, id string) error
 }
 
 // ProdAgent is the production implementation of core EListMan business logic.
+//
+// The Lambda runtime reuses a single ProdAgent across invocations, and may
+// handle overlapping events. ProdAgent keeps no state of its own beyond its
+// configuration, so it's safe for concurrent use as long as its dependencies
+// are, and as long as its fields aren't modified after the first method call.
+// The production dependencies, including the email package's caching validator,
+// MX failure policy, lookup limit, mailer, and throttle, are all safe for
+// concurrent use.
 type ProdAgent struct {
 	SenderAddress    string
 	EmailSiteTitle   string
@@ -70,6 +132,9 @@ type ProdAgent struct {
 	UnsubscribeEmail string
 	UnsubscribeUrl   string
 	ApiBaseUrl       string
+	ListHelpUrl      string
+	ListSubscribeUrl string
+	LinkSigningKey   []byte
 	NewUid           func() (uuid.UUID, error)
 	CurrentTime      func() time.Time
 	Db               db.Database
@@ -77,6 +142,44 @@ type ProdAgent struct {
 	Mailer           email.Mailer
 	Suppressor       email.Suppressor
 	Log              *log.Logger
+
+	// CheckSuppressionBeforeSend causes Send to check each recipient against
+	// the account-level suppression list immediately before sending, skipping
+	// suppressed recipients. Addresses may become suppressed during a long
+	// broadcast, e.g., when a recipient complains about an earlier message.
+	CheckSuppressionBeforeSend bool
+
+	// VerifyLinkExpiry, if greater than zero, limits how long a verification
+	// link remains valid, independently of when DynamoDB's Time To Live
+	// feature removes the pending record. Verify returns ops.LinkExpired for
+	// expired links, and Subscribe sends a new link.
+	VerifyLinkExpiry time.Duration
+
+	// Base64MaxQpRatio and Base64MaxQpSize cause message bodies to use base64
+	// instead of quoted-printable encoding when the latter would expand them
+	// too much. Zero disables either check. See email.WithBase64Threshold.
+	Base64MaxQpRatio float64
+	Base64MaxQpSize  int
+
+	// SendLog, if not nil, records each recipient of a message with an
+	// email.Message.CampaignKey, so that Send skips recipients that already
+	// received a message with the same key.
+	//
+	// It only remembers recipients until its records expire, e.g., after
+	// db.DefaultSendLogTtl, so every send with the same key should happen
+	// before then.
+	SendLog SendLog
+
+	// SendDryRun causes Send to neither consult nor update SendLog, so that a
+	// dry run doesn't prevent sending the same campaign for real later. Set it
+	// along with email.SesMailer.DryRun.
+	SendDryRun bool
+
+	// ImportValidator validates addresses for ImportVerified. If nil,
+	// Validator applies instead. Set this to a validator that skips some
+	// checks, e.g., an email.ProdAddressValidator with SkipSuppressionCheck or
+	// SkipMailHostCheck set, to speed up large imports.
+	ImportValidator email.AddressValidator
 }
 
 func (a *ProdAgent) Subscribe(
@@ -89,21 +192,26 @@ func (a *ProdAgent) Subscribe(
 		return
 	} else if failure != nil {
 		a.Log.Printf("validation failed: %s", failure)
+		if failure.Reason == email.FailureReasonSuppressed {
+			err = fmt.Errorf("%w: %s", ops.ErrBlocked, address)
+		}
 		return
 	} else if sub, err = a.Db.Get(ctx, address); err == nil {
-		switch sub.Status {
-		case db.SubscriberPending:
-			result = ops.VerifyLinkSent
-		default:
+		if sub.Status != db.SubscriberPending {
 			result = ops.AlreadySubscribed
+			return
+		} else if !a.verifyLinkExpired(sub) {
+			result = ops.VerifyLinkSent
+			return
 		}
-		return
 	} else if !errors.Is(err, db.ErrSubscriberNotFound) {
 		return
 	}
 
-	sub = &db.Subscriber{Email: address, Status: db.SubscriberPending}
-	if err = a.putSubscriber(ctx, sub); err != nil {
+	if sub, err = a.putPendingSubscriber(ctx, address, sub); err != nil {
+		if errors.Is(err, db.ErrSubscriberExists) {
+			result, err = ops.AlreadySubscribed, nil
+		}
 		return
 	}
 
@@ -119,20 +227,59 @@ func (a *ProdAgent) Subscribe(
 
 // timeToLiveDuration defines how long a pending Subscriber can exist.
 //
-// putSubscriber adds a day to the timestamp for pending subscribers
+// newSubscriberRecord adds a day to the timestamp for pending subscribers
 // so DynamoDB's Time To Live feature can eventually remove them.
 const timeToLiveDuration = time.Hour * 24
 
-func (a *ProdAgent) putSubscriber(
-	ctx context.Context, sub *db.Subscriber,
-) (err error) {
-	sub.Timestamp = a.CurrentTime()
+func (a *ProdAgent) newSubscriberRecord(sub *db.Subscriber) (err error) {
+	now := a.CurrentTime()
+	sub.Timestamp = now
 
 	if sub.Status == db.SubscriberPending {
-		sub.Timestamp = sub.Timestamp.Add(timeToLiveDuration)
+		sub.Timestamp = now.Add(timeToLiveDuration)
+
+		if a.VerifyLinkExpiry > 0 {
+			sub.ConfirmExpiry = now.Add(a.VerifyLinkExpiry)
+		}
 	}
-	if sub.Uid, err = a.NewUid(); err != nil {
-		return err
+	sub.Uid, err = a.NewUid()
+	return
+}
+
+// putPendingSubscriber writes a new pending subscriber record for address.
+//
+// If prev isn't nil, it's a pending subscriber with an expired verification
+// link, which the new record replaces. Otherwise another request may have
+// created the subscriber since Subscribe called Get, in which case
+// putPendingSubscriber returns db.ErrSubscriberExists.
+func (a *ProdAgent) putPendingSubscriber(
+	ctx context.Context, address string, prev *db.Subscriber,
+) (sub *db.Subscriber, err error) {
+	sub = &db.Subscriber{Email: address, Status: db.SubscriberPending}
+
+	if err = a.newSubscriberRecord(sub); err != nil {
+		return
+	} else if prev != nil {
+		sub.Version = prev.Version
+		err = a.Db.Put(ctx, sub)
+	} else {
+		err = a.Db.PutIfAbsent(ctx, sub)
+	}
+	return
+}
+
+// verifyLinkExpired returns true if sub's verification link is past its
+// ConfirmExpiry time.
+func (a *ProdAgent) verifyLinkExpired(sub *db.Subscriber) bool {
+	return !sub.ConfirmExpiry.IsZero() &&
+		a.CurrentTime().After(sub.ConfirmExpiry)
+}
+
+func (a *ProdAgent) putSubscriber(
+	ctx context.Context, sub *db.Subscriber,
+) (err error) {
+	if err = a.newSubscriberRecord(sub); err != nil {
+		return
 	}
 	return a.Db.Put(ctx, sub)
 }
@@ -174,15 +321,19 @@ func verifyHtmlBody(siteTitle, verifyLink string) string {
 	)
 }
 
+func (a *ProdAgent) signature(sub *db.Subscriber) string {
+	return ops.LinkSignature(a.LinkSigningKey, sub.Email, sub.Uid)
+}
+
 func (a *ProdAgent) makeVerificationEmail(sub *db.Subscriber) []byte {
-	verifyLink := ops.VerifyUrl(a.ApiBaseUrl, sub.Email, sub.Uid)
+	verifyLink := ops.SignUrl(sub.VerifyUrl(a.ApiBaseUrl), a.signature(sub))
 	recipient := &email.Recipient{Email: sub.Email, Uid: sub.Uid}
 	mt := email.NewMessageTemplate(&email.Message{
 		From:     a.SenderAddress,
 		Subject:  verifySubjectPrefix + a.EmailSiteTitle,
 		TextBody: verifyTextBody(a.EmailSiteTitle, verifyLink),
 		HtmlBody: verifyHtmlBody(a.EmailSiteTitle, verifyLink),
-	})
+	}, a.messageTemplateOptions()...)
 	return mt.GenerateMessage(recipient)
 }
 
@@ -192,17 +343,19 @@ func (a *ProdAgent) Verify(
 	var sub *db.Subscriber
 
 	if sub, err = a.getSubscriber(ctx, address, uid); err != nil {
-		return
-	} else if sub == nil {
-		result = ops.NotSubscribed
+		result, err = a.unverifiableResult(err)
 		return
 	} else if sub.Status == db.SubscriberVerified {
 		result = ops.AlreadySubscribed
 		return
+	} else if a.verifyLinkExpired(sub) {
+		result = ops.LinkExpired
+		return
 	}
 
 	sub.Status = db.SubscriberVerified
 	sub.Timestamp = a.CurrentTime()
+	sub.ConfirmExpiry = time.Time{}
 
 	if err = a.Db.Put(ctx, sub); err == nil {
 		result = ops.Subscribed
@@ -210,59 +363,199 @@ func (a *ProdAgent) Verify(
 	return
 }
 
+// unverifiableResult converts a getSubscriber error into the result for a
+// verify request that can't proceed.
+//
+// It only distinguishes an address with no subscriber record from one whose
+// uid doesn't match the existing record if links are signed. Otherwise anyone
+// could use different results for unknown and known addresses to learn who's
+// subscribed.
+func (a *ProdAgent) unverifiableResult(
+	err error,
+) (ops.OperationResult, error) {
+	if errors.Is(err, db.ErrSubscriberNotFound) && len(a.LinkSigningKey) != 0 {
+		return ops.UnknownSubscriber, nil
+	} else if isUnknownSubscriber(err) {
+		return ops.NotSubscribed, nil
+	}
+	return ops.Invalid, err
+}
+
 func (a *ProdAgent) Unsubscribe(
 	ctx context.Context, address string, uid uuid.UUID,
 ) (result ops.OperationResult, err error) {
-	var sub *db.Subscriber
-
-	if sub, err = a.getSubscriber(ctx, address, uid); err != nil {
+	if _, err = a.getSubscriber(ctx, address, uid); isUnknownSubscriber(err) {
+		result, err = ops.NotSubscribed, nil
+	} else if err != nil {
 		return
-	} else if sub == nil {
-		result = ops.NotSubscribed
 	} else if err = a.Db.Delete(ctx, address); err == nil {
 		result = ops.Unsubscribed
 	}
 	return
 }
 
+// errUidMismatch indicates that a request's uid doesn't match the subscriber
+// record for its address.
+const errUidMismatch = types.SentinelError("uid doesn't match subscriber")
+
+// getSubscriber returns the subscriber for address if its Uid matches uid.
+//
+// err wraps db.ErrSubscriberNotFound if there's no record for address, and is
+// errUidMismatch if the record's Uid doesn't match uid.
 func (a *ProdAgent) getSubscriber(
 	ctx context.Context, address string, uid uuid.UUID,
 ) (sub *db.Subscriber, err error) {
-	sub, err = a.Db.Get(ctx, address)
-
-	if errors.Is(err, db.ErrSubscriberNotFound) {
-		err = nil
-	} else if err != nil {
-		return
+	if sub, err = a.Db.Get(ctx, address); err != nil {
+		return nil, err
 	} else if sub.Uid != uid {
-		sub = nil
+		return nil, errUidMismatch
 	}
 	return
 }
 
+// isUnknownSubscriber returns true if err is a getSubscriber error indicating
+// that there's no subscriber matching the request.
+func isUnknownSubscriber(err error) bool {
+	return errors.Is(err, db.ErrSubscriberNotFound) ||
+		errors.Is(err, errUidMismatch)
+}
+
 func (a *ProdAgent) Validate(
 	ctx context.Context, address string,
 ) (failure *email.ValidationFailure, err error) {
 	return a.Validator.ValidateAddress(ctx, address)
 }
 
-func (a *ProdAgent) Import(ctx context.Context, address string) (err error) {
-	var failure *email.ValidationFailure
-	var sub *db.Subscriber
+// ImportOptions modifies the behavior of SubscriptionAgent.ImportVerified.
+//
+// DryRun validates every subscriber without writing any of them. SkipValidation
+// writes every subscriber without validating any of them.
+type ImportOptions struct {
+	DryRun         bool
+	SkipValidation bool
+}
 
-	if failure, err = a.Validate(ctx, address); err != nil {
+// ImportValidationError is the error ImportVerified reports for a subscriber
+// whose address failed validation.
+type ImportValidationError struct {
+	Failure *email.ValidationFailure
+}
+
+func (e *ImportValidationError) Error() string {
+	return e.Failure.Reason
+}
+
+// ImportVerified writes every valid subscriber as verified in one batch.
+//
+// errs contains one element per subscriber, which is nil if that subscriber
+// was imported, or would've been if opts.DryRun is true. Each subscriber
+// retains its Uid and Timestamp if already set.
+//
+// Importing an existing verified subscriber is a no-op that preserves its Uid
+// and Timestamp. ImportVerified promotes an existing pending subscriber to
+// verified, preserving its Uid. err is only non-nil if the batch write failed,
+// in which case errs also reports every subscriber not written.
+//
+// ImportVerified only imports the first subscriber for any address, compared
+// case-insensitively, and reports every later one as a duplicate. The batch
+// APIs reject duplicate keys, which would otherwise abort the entire import.
+func (a *ProdAgent) ImportVerified(
+	ctx context.Context, subscribers []*db.Subscriber, opts ImportOptions,
+) (errs []error, err error) {
+	errs = make([]error, len(subscribers))
+	valid := make([]*db.Subscriber, 0, len(subscribers))
+	indexes := make(map[*db.Subscriber]int, len(subscribers))
+	seen := make(map[string]bool, len(subscribers))
+
+	for i, sub := range subscribers {
+		key := strings.ToLower(sub.Email)
+		if seen[key] {
+			errs[i] = errors.New("duplicate of an earlier subscriber")
+			continue
+		}
+		seen[key] = true
+		errs[i] = a.prepareImport(ctx, sub, opts.SkipValidation)
+		if errs[i] == nil {
+			valid = append(valid, sub)
+			indexes[sub] = i
+		}
+	}
+	if len(valid) == 0 || opts.DryRun {
 		return
-	} else if failure != nil {
-		return errors.New(failure.Reason)
-	} else if sub, err = a.Db.Get(ctx, address); err == nil {
-		if sub.Status == db.SubscriberVerified {
-			return errors.New("already a verified subscriber")
+	}
+
+	failed, err := a.Db.PutBatchIfAbsent(ctx, valid)
+	unwritten := make(map[*db.Subscriber]bool, len(failed))
+	for _, sub := range failed {
+		errs[indexes[sub]] = errors.New("failed to write " + sub.Email)
+		unwritten[sub] = true
+	}
+	if err != nil {
+		err = fmt.Errorf("import failed: %w", err)
+		return
+	}
+
+	// PutBatchIfAbsent loads existing records instead of overwriting them, so
+	// any subscriber that's still pending needs a versioned Put to become
+	// verified.
+	for _, sub := range valid {
+		if !unwritten[sub] && sub.Status == db.SubscriberPending {
+			errs[indexes[sub]] = a.promoteSubscriber(ctx, sub)
 		}
-	} else if !errors.Is(err, db.ErrSubscriberNotFound) {
+	}
+	return
+}
+
+// promoteSubscriber marks an existing pending subscriber as verified,
+// preserving its Uid.
+func (a *ProdAgent) promoteSubscriber(
+	ctx context.Context, sub *db.Subscriber,
+) error {
+	sub.Status = db.SubscriberVerified
+	sub.Timestamp = a.CurrentTime()
+	sub.ConfirmExpiry = time.Time{}
+
+	if err := a.Db.Put(ctx, sub); err != nil {
+		return fmt.Errorf("failed to write %s: %w", sub.Email, err)
+	}
+	return nil
+}
+
+// prepareImport validates sub.Email, unless skipValidation is true, and
+// prepares sub to be written as a verified subscriber.
+func (a *ProdAgent) prepareImport(
+	ctx context.Context, sub *db.Subscriber, skipValidation bool,
+) (err error) {
+	if !skipValidation {
+		if err = a.validateImport(ctx, sub.Email); err != nil {
+			return
+		}
+	}
+
+	sub.Status = db.SubscriberVerified
+	if sub.Timestamp.IsZero() {
+		sub.Timestamp = a.CurrentTime()
+	}
+	if sub.Uid == uuid.Nil {
+		sub.Uid, err = a.NewUid()
+	}
+	return
+}
+
+func (a *ProdAgent) validateImport(
+	ctx context.Context, address string,
+) (err error) {
+	validator := a.ImportValidator
+	if validator == nil {
+		validator = a.Validator
+	}
+	var failure *email.ValidationFailure
+
+	if failure, err = validator.ValidateAddress(ctx, address); err != nil {
 		return
+	} else if failure != nil {
+		return &ImportValidationError{Failure: failure}
 	}
-	sub = &db.Subscriber{Email: address, Status: db.SubscriberVerified}
-	err = a.putSubscriber(ctx, sub)
 	return
 }
 
@@ -275,31 +568,299 @@ func (a *ProdAgent) Remove(
 	return
 }
 
+// Restore recreates a verified subscriber for address and removes it from the
+// suppression list.
+//
+// If a record for address still exists, Restore keeps its Uid, and marks it
+// as verified if it's pending.
 func (a *ProdAgent) Restore(ctx context.Context, address string) (err error) {
-	// Since the SnsHandler is calling this to restore a previous subscriber,
-	// presume they're already verified.
-	sub := &db.Subscriber{Email: address, Status: db.SubscriberVerified}
-	if err = a.putSubscriber(ctx, sub); err == nil {
+	restore := func() error { return a.restoreSubscriber(ctx, address) }
+
+	if err = retryOnConflict(restore); err == nil {
 		err = a.Suppressor.Unsuppress(ctx, address)
 	}
 	return
 }
+
+func (a *ProdAgent) restoreSubscriber(
+	ctx context.Context, address string,
+) error {
+	sub, err := a.Db.Get(ctx, address)
+
+	if errors.Is(err, db.ErrSubscriberNotFound) {
+		// Since the SnsHandler is calling this to restore a previous
+		// subscriber, presume they're already verified.
+		sub = &db.Subscriber{Email: address, Status: db.SubscriberVerified}
+		return a.putSubscriber(ctx, sub)
+	} else if err != nil || sub.Status == db.SubscriberVerified {
+		return err
+	}
+	return a.promoteSubscriber(ctx, sub)
+}
+
+// retryOnConflict calls update again if it fails with db.ErrVersionConflict.
+//
+// update must Get the subscriber again each time, since a conflict means
+// another writer updated it after the previous Get.
+func retryOnConflict(update func() error) (err error) {
+	if err = update(); errors.Is(err, db.ErrVersionConflict) {
+		err = update()
+	}
+	return
+}
+
+// RevalidateResult reports the outcome of SubscriptionAgent.Revalidate.
+type RevalidateResult struct {
+	// NumValidated is the number of subscribers validated.
+	NumValidated int
+
+	// Removed contains the address and validation failure reason of each
+	// subscriber removed.
+	Removed []*email.ValidationFailure
+
+	// NextStartKey is the StartKey from which to continue revalidating, or
+	// nil if no verified subscribers remain.
+	NextStartKey db.StartKey
+}
+
+// Revalidate validates up to maxSubscribers verified subscribers, starting
+// after startKey, and removes each one whose address fails validation.
+//
+// A maxSubscribers value less than one validates as many subscribers as a
+// single Database.GetSubscribersPage call returns. If ratePerSecond is greater
+// than zero, Revalidate validates no more than that many subscribers per
+// second.
+//
+// If validating or removing any subscriber fails, or ctx is cancelled,
+// Revalidate returns an error along with a result whose NextStartKey resumes
+// after the last subscriber it revalidated, or is startKey if there was none.
+// This enables a caller to checkpoint the NextStartKey and resume later without
+// losing progress. Revalidating the same subscribers again is safe regardless,
+// since valid subscribers remain unchanged.
+func (a *ProdAgent) Revalidate(
+	ctx context.Context,
+	startKey db.StartKey,
+	maxSubscribers int,
+	ratePerSecond float64,
+) (result *RevalidateResult, err error) {
+	result = &RevalidateResult{
+		Removed:      []*email.ValidationFailure{},
+		NextStartKey: startKey,
+	}
+	var subs []*db.Subscriber
+	var nextStartKey db.StartKey
+	var limiter *rate.Limiter
+
+	subs, nextStartKey, err = a.Db.GetSubscribersPage(
+		ctx, db.SubscriberVerified, startKey, maxSubscribers,
+	)
+	if err != nil {
+		return result, fmt.Errorf("revalidation failed: %w", err)
+	} else if ratePerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(ratePerSecond), 1)
+	}
+
+	for i, sub := range subs {
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("revalidation interrupted: %w", err)
+			return result, a.resumeAfter(result, subs[:i], err)
+		}
+		var failure *email.ValidationFailure
+		if failure, err = a.revalidate(ctx, sub.Email, limiter); err != nil {
+			const errFmt = "revalidation failed: %s: %w"
+			err = fmt.Errorf(errFmt, sub.Email, err)
+			return result, a.resumeAfter(result, subs[:i], err)
+		}
+		result.NumValidated++
+		if failure != nil {
+			result.Removed = append(result.Removed, failure)
+		}
+	}
+	result.NextStartKey = nextStartKey
+	return
+}
+
+// resumeAfter sets result.NextStartKey to resume after the last subscriber in
+// done, if any, and returns err.
+func (a *ProdAgent) resumeAfter(
+	result *RevalidateResult, done []*db.Subscriber, err error,
+) error {
+	if len(done) == 0 {
+		return err
+	}
+	startKey, keyErr := a.Db.StartKeyAfter(done[len(done)-1])
+	if keyErr != nil {
+		return errors.Join(err, keyErr)
+	}
+	result.NextStartKey = startKey
+	return err
+}
+
+// revalidate validates address, removing it if it fails validation.
+//
+// It never suppresses the address itself. The validator already suppressed it
+// if failure.Suppressed is true, and suppressing it again could replace a
+// "COMPLAINT" suppression reason with "BOUNCE". Leaving other addresses, e.g.,
+// those of domains without MX records, off the suppression list allows them to
+// subscribe again if their domains recover.
+//
+// It returns the validation failure only if validation failed and removing the
+// address succeeded. DNS lookup timeouts and other external failures return an
+// error instead, since they don't prove the address is invalid.
+func (a *ProdAgent) revalidate(
+	ctx context.Context, address string, limiter *rate.Limiter,
+) (failure *email.ValidationFailure, err error) {
+	if limiter != nil {
+		if err = limiter.Wait(ctx); err != nil {
+			return
+		}
+	}
+	if failure, err = a.Validate(ctx, address); err != nil || failure == nil {
+		return
+	} else if err = a.Db.Delete(ctx, address); err != nil {
+		failure = nil
+	}
+	return
+}
+
+func (a *ProdAgent) RecordEngagement(
+	ctx context.Context, address string,
+) error {
+	return a.updateVerified(ctx, address, func(sub *db.Subscriber) {
+		sub.LastEngaged = a.CurrentTime()
+	})
+}
+
+func (a *ProdAgent) RecordDelivery(
+	ctx context.Context, address string,
+) error {
+	return a.updateVerified(ctx, address, func(sub *db.Subscriber) {
+		sub.LastDelivered = a.CurrentTime()
+	})
+}
+
+// updateVerified applies update to the subscriber for address and writes it,
+// if the subscriber is verified. It retries once on a version conflict.
+func (a *ProdAgent) updateVerified(
+	ctx context.Context, address string, update func(*db.Subscriber),
+) error {
+	return retryOnConflict(func() error {
+		sub, err := a.Db.Get(ctx, address)
+
+		if err != nil || sub.Status != db.SubscriberVerified {
+			return err
+		}
+		update(sub)
+		return a.Db.Put(ctx, sub)
+	})
+}
+
+// StatusUnknown is the Status of an address that isn't a subscriber.
+const StatusUnknown db.SubscriberStatus = "unknown"
+
+func (a *ProdAgent) Status(
+	ctx context.Context, address string,
+) (status db.SubscriberStatus, err error) {
+	var sub *db.Subscriber
+
+	if sub, err = a.Db.Get(ctx, address); err == nil {
+		status = sub.Status
+	} else if errors.Is(err, db.ErrSubscriberNotFound) {
+		status, err = StatusUnknown, nil
+	}
+	return
+}
+
 func (a *ProdAgent) Send(
 	ctx context.Context, msg *email.Message, addrs []string,
 ) (numSent int, err error) {
-	if err = msg.Validate(email.CheckDomain(a.EmailDomainName)); err != nil {
+	var mt *email.MessageTemplate
+	campaignKey := msg.CampaignKey
+	if a.SendDryRun {
+		campaignKey = ""
+	}
+
+	if campaignKey != "" && a.SendLog == nil {
+		const errFmt = "can't send with CampaignKey %q: no SendLog configured"
+		err = fmt.Errorf(errFmt, campaignKey)
+		return
+	} else if mt, err = a.newMessageTemplate(msg); err != nil {
 		return
 	}
-	mt := email.NewMessageTemplate(msg)
+	s := &sendInfo{subject: msg.Subject, campaignKey: campaignKey, mt: mt}
 
 	if len(addrs) == 0 {
-		return a.sendToEntireList(ctx, msg.Subject, mt)
+		return a.sendToEntireList(ctx, s)
 	}
-	return a.sendToSpecificRecipients(ctx, msg.Subject, mt, addrs)
+	return a.sendToSpecificRecipients(ctx, s, addrs)
+}
+
+// TestSend sends msg to address without consulting the subscriber list.
+//
+// This enables authors to review the exact message subscribers will receive
+// before sending it to the list. The message is addressed to a synthetic
+// subscriber with a newly generated Uid, so its unsubscribe links are valid
+// but won't match any actual subscriber.
+func (a *ProdAgent) TestSend(
+	ctx context.Context, msg *email.Message, address string,
+) (numSent int, err error) {
+	s := &sendInfo{subject: msg.Subject}
+	sub := &db.Subscriber{Email: address, Status: db.SubscriberVerified}
+	subject := msg.Subject
+	var sent bool
+
+	if s.mt, err = a.newMessageTemplate(msg); err != nil {
+		return
+	} else if sub.Uid, err = a.NewUid(); err != nil {
+		err = fmt.Errorf("error creating test send uid: %w", err)
+	} else if sent, err = a.sendOneEmail(ctx, s, sub); err != nil {
+		const errFmt = "error test sending \"%s\" to %s: %w"
+		err = fmt.Errorf(errFmt, subject, address, err)
+	} else if sent {
+		numSent = 1
+	}
+	return
+}
+
+func (a *ProdAgent) newMessageTemplate(
+	msg *email.Message,
+) (*email.MessageTemplate, error) {
+	if err := msg.Validate(email.CheckDomain(a.EmailDomainName)); err != nil {
+		return nil, err
+	}
+	return email.NewMessageTemplate(
+		msg,
+		a.messageTemplateOptions(
+			email.WithListHeaders(a.ListHelpUrl, a.ListSubscribeUrl),
+		)...,
+	), nil
+}
+
+// messageTemplateOptions returns the options common to every message template,
+// followed by opts. See email.ProdMessageOptions.TemplateOptions.
+func (a *ProdAgent) messageTemplateOptions(
+	opts ...email.MessageTemplateOption,
+) []email.MessageTemplateOption {
+	prodOpts := &email.ProdMessageOptions{
+		DomainName:       a.EmailDomainName,
+		Base64MaxQpRatio: a.Base64MaxQpRatio,
+		Base64MaxQpSize:  a.Base64MaxQpSize,
+	}
+	return prodOpts.TemplateOptions(opts...)
+}
+
+// sendInfo contains the parameters common to every message of a single send.
+//
+// campaignKey is empty for test sends and for messages without a
+// CampaignKey, in which case sendOneEmail doesn't consult SendLog.
+type sendInfo struct {
+	subject     string
+	campaignKey string
+	mt          *email.MessageTemplate
 }
 
 func (a *ProdAgent) sendToEntireList(
-	ctx context.Context, subject string, mt *email.MessageTemplate,
+	ctx context.Context, s *sendInfo,
 ) (numSent int, err error) {
 	if err = a.Mailer.BulkCapacityAvailable(ctx); err != nil {
 		err = fmt.Errorf("couldn't send to subscribers: %w", err)
@@ -308,8 +869,9 @@ func (a *ProdAgent) sendToEntireList(
 
 	var sendErr error
 	sender := db.SubscriberFunc(func(sub *db.Subscriber) (ok bool) {
-		sendErr = a.sendOneEmail(ctx, subject, mt, sub)
-		if ok = sendErr == nil; ok {
+		var sent bool
+		sent, sendErr = a.sendOneEmail(ctx, s, sub)
+		if ok = sendErr == nil; ok && sent {
 			numSent++
 		}
 		return
@@ -317,16 +879,13 @@ func (a *ProdAgent) sendToEntireList(
 
 	err = a.Db.ProcessSubscribers(ctx, db.SubscriberVerified, sender)
 	if err = errors.Join(err, sendErr); err != nil {
-		err = fmt.Errorf("error sending \"%s\" to list: %w", subject, err)
+		err = fmt.Errorf("error sending \"%s\" to list: %w", s.subject, err)
 	}
 	return
 }
 
 func (a *ProdAgent) sendToSpecificRecipients(
-	ctx context.Context,
-	subject string,
-	mt *email.MessageTemplate,
-	addrs []string,
+	ctx context.Context, s *sendInfo, addrs []string,
 ) (numSent int, err error) {
 	errs := make([]error, 0, len(addrs))
 	addError := func(addr string, err error) {
@@ -341,40 +900,84 @@ func (a *ProdAgent) sendToSpecificRecipients(
 	// change.
 	for _, addr := range addrs {
 		var sub *db.Subscriber
+		var ok bool
 		if sub, err = a.Db.Get(ctx, addr); err != nil {
 			addError(addr, err)
 		} else if sub.Status != db.SubscriberVerified {
 			addError(addr, errors.New("not verified"))
-		} else if err = a.sendOneEmail(ctx, subject, mt, sub); err != nil {
+		} else if ok, err = a.sendOneEmail(ctx, s, sub); err != nil {
 			addError(addr, err)
-		} else {
+		} else if ok {
 			numSent++
 		}
 	}
 
 	if err = errors.Join(errs...); err != nil {
 		const errFmt = "error sending \"%s\" to targeted recipients: %w"
-		err = fmt.Errorf(errFmt, subject, err)
+		err = fmt.Errorf(errFmt, s.subject, err)
 	}
 	return
 }
 
+// sendOneEmail sends the message to sub, unless CheckSuppressionBeforeSend is
+// set and sub.Email is suppressed. In that case, it logs that it skipped
+// sub.Email and returns with sent set to false.
+//
+// If s.campaignKey is set, sendOneEmail also skips sub.Email if SendLog
+// already recorded it for the same campaign. If sending then fails, it removes
+// sub.Email from SendLog, so that retrying the send will try again.
 func (a *ProdAgent) sendOneEmail(
-	ctx context.Context,
-	subject string,
-	mt *email.MessageTemplate,
-	sub *db.Subscriber,
-) (err error) {
-	recipient := &email.Recipient{Email: sub.Email, Uid: sub.Uid}
+	ctx context.Context, s *sendInfo, sub *db.Subscriber,
+) (sent bool, err error) {
+	subject := s.subject
+
+	if a.CheckSuppressionBeforeSend {
+		var suppressed bool
+		suppressed, err = a.Suppressor.IsSuppressed(ctx, sub.Email)
+		if err != nil {
+			return
+		} else if suppressed {
+			const logFmt = "skipped \"%s\" to suppressed address: %s"
+			a.Log.Printf(logFmt, subject, sub.Email)
+			return
+		}
+	}
+
+	var logId string
+	if s.campaignKey != "" {
+		var firstTime bool
+		logId = "send/" + s.campaignKey + "/" + sub.Email
+		if firstTime, err = a.SendLog.RecordEvent(ctx, logId); err != nil {
+			return
+		} else if !firstTime {
+			const logFmt = "skipped \"%s\" already sent to: %s"
+			a.Log.Printf(logFmt, subject, sub.Email)
+			return
+		}
+	}
+
+	recipient := &email.Recipient{
+		Email: sub.Email, Uid: sub.Uid, Signature: a.signature(sub),
+	}
 	recipient.SetUnsubscribeInfo(
 		a.UnsubscribeEmail, a.UnsubscribeUrl, a.ApiBaseUrl,
 	)
 
-	m := mt.GenerateMessage(recipient)
+	m := s.mt.GenerateMessage(recipient)
 	var msgId string
 
 	if msgId, err = a.Mailer.Send(ctx, sub.Email, m); err == nil {
+		sent = true
 		a.Log.Printf("sent \"%s\" id: %s to: %s", subject, msgId, sub.Email)
+	} else if logId != "" {
+		// Send may have failed because ctx was cancelled, so forget the send
+		// regardless. Otherwise the recipient would never get the message.
+		forgetCtx := context.WithoutCancel(ctx)
+		forgetErr := a.SendLog.ForgetEvent(forgetCtx, logId)
+		if forgetErr != nil {
+			const logFmt = "failed to forget failed send of \"%s\" to %s: %s"
+			a.Log.Printf(logFmt, subject, sub.Email, forgetErr)
+		}
 	}
 	return
 }
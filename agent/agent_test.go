@@ -7,6 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -75,19 +78,19 @@ func newProdAgentTestFixture() *prodAgentTestFixture {
 	sup := testdoubles.NewSuppressor()
 	logs, logger := tu.NewLogs()
 	pa := &ProdAgent{
-		testSender,
-		testSiteTitle,
-		testDomainName,
-		testUnsubEmail,
-		testUnsubUrl,
-		testApiBaseUrl,
-		newUid,
-		currentTime,
-		db,
-		av,
-		m,
-		sup,
-		logger,
+		SenderAddress:    testSender,
+		EmailSiteTitle:   testSiteTitle,
+		EmailDomainName:  testDomainName,
+		UnsubscribeEmail: testUnsubEmail,
+		UnsubscribeUrl:   testUnsubUrl,
+		ApiBaseUrl:       testApiBaseUrl,
+		NewUid:           newUid,
+		CurrentTime:      currentTime,
+		Db:               db,
+		Validator:        av,
+		Mailer:           m,
+		Suppressor:       sup,
+		Log:              logger,
 	}
 	return &prodAgentTestFixture{pa, db, av, m, sup, logs}
 }
@@ -220,6 +223,8 @@ func TestMakeVerificationEmail(t *testing.T) {
 		th.Assert(t, "From", agent.SenderAddress)
 		th.Assert(t, "To", sub.Email)
 		th.Assert(t, "Subject", verifySubjectPrefix+agent.EmailSiteTitle)
+		messageId := msg.Header.Get("Message-ID")
+		assert.Assert(t, is.Contains(messageId, "@"+testDomainName+">"))
 
 		verifyLink := ops.VerifyUrl(agent.ApiBaseUrl, sub.Email, sub.Uid)
 		textPart := tu.GetNextPartContent(t, pr, "text/plain")
@@ -231,6 +236,44 @@ func TestMakeVerificationEmail(t *testing.T) {
 		verifyAnchor := "<a href=\"" + verifyLink + "\">" + verifyLink + "</a>"
 		assert.Assert(t, is.Contains(htmlPart, verifyAnchor))
 	})
+
+	t.Run("AvoidsSoftLineBreaksWithinVerifyLink", func(t *testing.T) {
+		agent := setup()
+		// Make the link too long to follow "- " on the same line, but short
+		// enough to fit on a line of its own.
+		agent.ApiBaseUrl = "https://foo.com/em/"
+
+		rawMsg := agent.makeVerificationEmail(sub)
+
+		verifyLink := ops.VerifyUrl(agent.ApiBaseUrl, sub.Email, sub.Uid)
+		assert.Assert(t, is.Contains(string(rawMsg), verifyLink))
+	})
+
+	t.Run("FoldsLongSubject", func(t *testing.T) {
+		agent := setup()
+		agent.EmailSiteTitle = "The Very Long Title of a Very Popular Blog"
+
+		rawMsg := agent.makeVerificationEmail(sub)
+
+		const expected = "Subject: Verify your email subscription to The " +
+			"Very Long Title of a Very\r\n Popular Blog\r\n"
+		assert.Assert(t, is.Contains(string(rawMsg), expected))
+	})
+
+	t.Run("SignsVerifyLinkIfSigningKeySet", func(t *testing.T) {
+		agent := setup()
+		agent.LinkSigningKey = []byte("signing key")
+
+		rawMsg := agent.makeVerificationEmail(sub)
+
+		_, _, pr := tu.ParseMultipartMessageAndBoundary(t, string(rawMsg))
+		sig := ops.LinkSignature(agent.LinkSigningKey, sub.Email, sub.Uid)
+		verifyLink := ops.SignUrl(
+			ops.VerifyUrl(agent.ApiBaseUrl, sub.Email, sub.Uid), sig,
+		)
+		textPart := tu.GetNextPartContent(t, pr, "text/plain")
+		assert.Assert(t, is.Contains(textPart, verifyLink))
+	})
 }
 
 func TestSubscribe(t *testing.T) {
@@ -283,6 +326,52 @@ func TestSubscribe(t *testing.T) {
 		f.mailer.AssertNoMessageSent(t, testEmail)
 	})
 
+	t.Run("SetsConfirmExpiryIfVerifyLinkExpirySet", func(t *testing.T) {
+		f, ctx := setup()
+		f.agent.VerifyLinkExpiry = time.Hour
+
+		result, err := f.agent.Subscribe(ctx, testEmail)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.VerifyLinkSent, result)
+		expected := td.TestTimestamp.Add(time.Hour)
+		assert.Equal(t, expected, f.db.Index[testEmail].ConfirmExpiry)
+	})
+
+	t.Run("SendsNewLinkIfVerifyLinkExpired", func(t *testing.T) {
+		f, ctx := setup()
+		f.agent.VerifyLinkExpiry = time.Hour
+		expired := *pendingSubscriber
+		expired.Uid = uuid.MustParse("11111111-2222-3333-5555-888888888888")
+		expired.ConfirmExpiry = td.TestTimestamp.Add(-time.Second)
+		assert.NilError(t, f.db.Put(ctx, &expired))
+
+		result, err := f.agent.Subscribe(ctx, testEmail)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.VerifyLinkSent, result)
+		sub := f.db.Index[testEmail]
+		assert.Equal(t, td.TestUid, sub.Uid)
+		assert.Equal(t, td.TestTimestamp.Add(time.Hour), sub.ConfirmExpiry)
+		_, verifyEmail := f.mailer.GetMessageTo(t, testEmail)
+		assert.Assert(t, is.Contains(verifyEmail, verifySubjectPrefix))
+	})
+
+	t.Run("ReturnsAlreadySubscribedIfCreatedConcurrently", func(t *testing.T) {
+		f, ctx := setup()
+		assert.NilError(t, f.db.Put(ctx, verifiedSubscriber))
+		f.db.SimulateGetErr = func(_ string) error {
+			return db.ErrSubscriberNotFound
+		}
+
+		result, err := f.agent.Subscribe(ctx, testEmail)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.AlreadySubscribed, result)
+		assert.DeepEqual(t, verifiedSubscriber, f.db.Index[testEmail])
+		f.mailer.AssertNoMessageSent(t, testEmail)
+	})
+
 	t.Run("ReturnsInvalidIfAddressFailsValidation", func(t *testing.T) {
 		f, ctx := setup()
 		f.validator.Failure = &email.ValidationFailure{
@@ -297,6 +386,20 @@ func TestSubscribe(t *testing.T) {
 		f.logs.AssertContains(t, "validation failed: "+testEmail+": testing")
 	})
 
+	t.Run("ReturnsErrBlockedIfAddressSuppressed", func(t *testing.T) {
+		f, ctx := setup()
+		f.validator.Failure = &email.ValidationFailure{
+			Address: testEmail, Reason: email.FailureReasonSuppressed,
+		}
+
+		result, err := f.agent.Subscribe(ctx, testEmail)
+
+		assert.Equal(t, ops.Invalid, result)
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrBlocked))
+		assert.ErrorContains(t, err, testEmail)
+		f.mailer.AssertNoMessageSent(t, testEmail)
+	})
+
 	t.Run("PassesThroughValidateAddressError", func(t *testing.T) {
 		f, ctx := setup()
 		f.validator.Error = makeServerError("SES error")
@@ -361,23 +464,23 @@ func TestGetSubscriber(t *testing.T) {
 		assert.DeepEqual(t, pendingSubscriber, sub)
 	})
 
-	t.Run("ReturnsNilSubscriberAndNilErrorIfNotFound", func(t *testing.T) {
+	t.Run("ReturnsSubscriberNotFoundError", func(t *testing.T) {
 		agent, _, ctx := setup()
 
 		sub, err := agent.getSubscriber(ctx, testEmail, td.TestUid)
 
-		assert.NilError(t, err)
+		assert.Assert(t, tu.ErrorIs(err, db.ErrSubscriberNotFound))
 		assert.Assert(t, is.Nil(sub))
 	})
 
-	t.Run("ReturnsNilSubscriberAndNilErrorIfWrongUid", func(t *testing.T) {
+	t.Run("ReturnsUidMismatchError", func(t *testing.T) {
 		agent, dbase, ctx := setup()
 		assert.NilError(t, dbase.Put(ctx, pendingSubscriber))
 		wrongUid := uuid.MustParse("11111111-2222-3333-5555-888888888888")
 
 		sub, err := agent.getSubscriber(ctx, testEmail, wrongUid)
 
-		assert.NilError(t, err)
+		assert.Assert(t, tu.ErrorIs(err, errUidMismatch))
 		assert.Assert(t, is.Nil(sub))
 	})
 
@@ -429,13 +532,73 @@ func TestVerify(t *testing.T) {
 		assert.Equal(t, newTimestamp, sub.Timestamp)
 	})
 
+	t.Run("SucceedsBeforeVerifyLinkExpires", func(t *testing.T) {
+		agent, dbase, pendingSub, ctx := setup()
+		pendingSub.ConfirmExpiry = td.TestTimestamp.Add(time.Minute)
+		assert.NilError(t, dbase.Put(ctx, pendingSub))
+
+		result, err := agent.Verify(ctx, pendingSub.Email, pendingSub.Uid)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.Subscribed, result)
+		sub, err := dbase.Get(ctx, pendingSub.Email)
+		assert.NilError(t, err)
+		assert.Equal(t, db.SubscriberVerified, sub.Status)
+		assert.Assert(t, sub.ConfirmExpiry.IsZero())
+	})
+
+	t.Run("ReturnsLinkExpiredAfterVerifyLinkExpires", func(t *testing.T) {
+		agent, dbase, pendingSub, ctx := setup()
+		pendingSub.ConfirmExpiry = td.TestTimestamp.Add(-time.Second)
+		assert.NilError(t, dbase.Put(ctx, pendingSub))
+
+		result, err := agent.Verify(ctx, pendingSub.Email, pendingSub.Uid)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.LinkExpired, result)
+		sub, err := dbase.Get(ctx, pendingSub.Email)
+		assert.NilError(t, err)
+		assert.Equal(t, db.SubscriberPending, sub.Status)
+	})
+
 	t.Run("ReturnsNotSubscribedIfNotFound", func(t *testing.T) {
+		agent, dbase, pendingSub, ctx := setup()
+		getCalls := 0
+		dbase.SimulateGetErr = func(string) error {
+			getCalls++
+			return nil
+		}
+
+		result, err := agent.Verify(ctx, pendingSub.Email, pendingSub.Uid)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.NotSubscribed, result)
+		assert.Equal(t, 1, getCalls)
+	})
+
+	t.Run("ReturnsUnknownSubscriberIfNotFoundAndSigned", func(t *testing.T) {
 		agent, _, pendingSub, ctx := setup()
+		agent.LinkSigningKey = []byte("test key")
 
 		result, err := agent.Verify(ctx, pendingSub.Email, pendingSub.Uid)
 
+		assert.NilError(t, err)
+		assert.Equal(t, ops.UnknownSubscriber, result)
+	})
+
+	t.Run("ReturnsNotSubscribedIfUidDoesNotMatch", func(t *testing.T) {
+		agent, dbase, pendingSub, ctx := setup()
+		assert.NilError(t, dbase.Put(ctx, pendingSub))
+
+		agent.LinkSigningKey = []byte("test key")
+
+		result, err := agent.Verify(ctx, pendingSub.Email, uuid.New())
+
 		assert.NilError(t, err)
 		assert.Equal(t, ops.NotSubscribed, result)
+		sub, err := dbase.Get(ctx, pendingSub.Email)
+		assert.NilError(t, err)
+		assert.Equal(t, db.SubscriberPending, sub.Status)
 	})
 
 	t.Run("ReturnsAlreadySubscribedIfAlreadyVerified", func(t *testing.T) {
@@ -537,109 +700,283 @@ func TestUnsubscribe(t *testing.T) {
 	})
 }
 
-func TestImport(t *testing.T) {
+// TestConcurrentSubscribeVerifyAndUnsubscribe exercises overlapping requests
+// against a shared ProdAgent, as when the Lambda runtime handles events
+// concurrently. Run with "go test -race" to detect unsynchronized access.
+func TestConcurrentSubscribeVerifyAndUnsubscribe(t *testing.T) {
+	f := newProdAgentTestFixture()
+	ctx := context.Background()
+	const numSubscribers = 100
+	errs := make([]error, numSubscribers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+
+	subscribeVerifyAndUnsubscribe := func(address string) error {
+		expected := []ops.OperationResult{
+			ops.VerifyLinkSent, ops.Subscribed, ops.Unsubscribed,
+		}
+		results := make([]ops.OperationResult, 0, len(expected))
+		result, err := f.agent.Subscribe(ctx, address)
+		results = append(results, result)
+
+		if err == nil {
+			result, err = f.agent.Verify(ctx, address, td.TestUid)
+			results = append(results, result)
+		}
+		if err == nil {
+			result, err = f.agent.Unsubscribe(ctx, address, td.TestUid)
+			results = append(results, result)
+		}
+		if err == nil && !slices.Equal(expected, results) {
+			const errFmt = "%s: expected %v, got %v"
+			err = fmt.Errorf(errFmt, address, expected, results)
+		}
+		return err
+	}
+
+	for i := range numSubscribers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			address := fmt.Sprintf("subscriber-%d@foo.com", i)
+			<-start
+			errs[i] = subscribeVerifyAndUnsubscribe(address)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.NilError(t, errors.Join(errs...))
+	assert.Assert(t, is.Len(f.db.Index, 0))
+	assert.Assert(t, is.Len(f.mailer.RecipientMessages, numSubscribers))
+}
+
+func TestImportVerified(t *testing.T) {
+	const invalidEmail = "bad@foo.com"
+	const otherEmail = "other@foo.com"
+	otherUid := verifiedSubscriber.Uid
+	otherTimestamp := td.TestTimestamp.Add(-time.Hour)
+
 	setup := func() (
-		agent *ProdAgent,
-		validator *testdoubles.AddressValidator,
-		dbase *testdoubles.Database,
-		subscriber *db.Subscriber,
+		*ProdAgent,
+		*testdoubles.AddressValidator,
+		*testdoubles.Database,
+		[]*db.Subscriber,
 	) {
 		f := newProdAgentTestFixture()
-		agent = f.agent
-		validator = f.validator
-		dbase = f.db
+		f.validator.Failures = map[string]*email.ValidationFailure{
+			invalidEmail: {Address: invalidEmail, Reason: "test failure"},
+		}
+		subs := []*db.Subscriber{
+			{Email: testEmail},
+			{Email: invalidEmail},
+			{Email: otherEmail, Uid: otherUid, Timestamp: otherTimestamp},
+		}
+		return f.agent, f.validator, f.db, subs
+	}
+
+	ctx := context.Background()
+
+	t.Run("ImportsValidSubscribersAndReportsInvalidOnes", func(t *testing.T) {
+		agent, _, dbase, subs := setup()
+
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(errs, 3))
+		assert.NilError(t, errs[0])
+		assert.Error(t, errs[1], "test failure")
+		assert.NilError(t, errs[2])
+
 		uid, _ := agent.NewUid()
-		subscriber = &db.Subscriber{
+		expected := &db.Subscriber{
 			Email:     testEmail,
 			Uid:       uid,
 			Status:    db.SubscriberVerified,
 			Timestamp: agent.CurrentTime(),
+			Version:   1,
 		}
-		return
-	}
+		assert.DeepEqual(t, expected, dbase.Index[testEmail])
+		assert.Assert(t, is.Nil(dbase.Index[invalidEmail]))
 
-	ctx := context.Background()
+		// Keeps the existing Uid and Timestamp.
+		expected = &db.Subscriber{
+			Email:     otherEmail,
+			Uid:       otherUid,
+			Status:    db.SubscriberVerified,
+			Timestamp: otherTimestamp,
+			Version:   1,
+		}
+		assert.DeepEqual(t, expected, dbase.Index[otherEmail])
+	})
 
-	t.Run("Succeeds", func(t *testing.T) {
-		agent, validator, dbase, expectedSubscriber := setup()
+	t.Run("UsesImportValidatorIfSet", func(t *testing.T) {
+		agent, validator, dbase, subs := setup()
+		importValidator := testdoubles.NewAddressValidator()
+		agent.ImportValidator = importValidator
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
 		assert.NilError(t, err)
-		validator.AssertValidated(t, testEmail)
-		assert.DeepEqual(t, expectedSubscriber, dbase.Index[testEmail])
+		assert.DeepEqual(t, make([]error, 3), errs)
+		assert.Equal(t, "", validator.Email)
+		importValidator.AssertValidated(t, otherEmail)
+		assert.Assert(t, dbase.Index[invalidEmail] != nil)
 	})
 
-	t.Run("OverwritesExistingPendingSubscriber", func(t *testing.T) {
-		agent, validator, dbase, expectedSubscriber := setup()
-		dbase.Put(ctx, pendingSubscriber)
+	t.Run("ReportsValidationFailureDetails", func(t *testing.T) {
+		agent, _, _, subs := setup()
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
 		assert.NilError(t, err)
-		validator.AssertValidated(t, testEmail)
-		assert.DeepEqual(t, expectedSubscriber, dbase.Index[testEmail])
+		var validationErr *ImportValidationError
+		assert.Assert(t, errors.As(errs[1], &validationErr))
+		assert.DeepEqual(
+			t,
+			&email.ValidationFailure{
+				Address: invalidEmail, Reason: "test failure",
+			},
+			validationErr.Failure,
+		)
 	})
 
-	t.Run("ReturnsValidationError", func(t *testing.T) {
-		agent, validator, dbase, _ := setup()
-		validator.Failure = &email.ValidationFailure{
-			Address: testEmail, Reason: "test failure",
-		}
+	t.Run("ValidatesWithoutWritingIfDryRun", func(t *testing.T) {
+		agent, validator, dbase, subs := setup()
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(
+			ctx, subs, ImportOptions{DryRun: true},
+		)
 
-		validator.AssertValidated(t, testEmail)
-		assert.ErrorContains(t, err, validator.Failure.Reason)
-		assert.Assert(t, is.Nil(dbase.Index[testEmail]))
+		assert.NilError(t, err)
+		assert.NilError(t, errs[0])
+		assert.Error(t, errs[1], "test failure")
+		assert.NilError(t, errs[2])
+		validator.AssertValidated(t, otherEmail)
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("WritesWithoutValidatingIfSkipValidation", func(t *testing.T) {
+		agent, validator, dbase, subs := setup()
+
+		errs, err := agent.ImportVerified(
+			ctx, subs, ImportOptions{SkipValidation: true},
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, make([]error, 3), errs)
+		assert.Equal(t, "", validator.Email)
+		assert.Assert(t, dbase.Index[invalidEmail] != nil)
 	})
 
-	t.Run("ReportsValidationFailureAsError", func(t *testing.T) {
-		agent, validator, dbase, _ := setup()
+	t.Run("ReportsValidationErrorWithoutAbortingImport", func(t *testing.T) {
+		agent, validator, dbase, subs := setup()
+		validator.Failures = nil
 		validator.Error = makeServerError("test error")
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
-		validator.AssertValidated(t, testEmail)
-		assertServerErrorContains(t, err, "test error")
-		assert.Assert(t, is.Nil(dbase.Index[testEmail]))
+		assert.NilError(t, err)
+		for _, subErr := range errs {
+			assertServerErrorContains(t, subErr, "test error")
+		}
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
 	})
 
-	t.Run("ReturnsErrorIfVerifiedSubscriberAlreadyExists", func(t *testing.T) {
-		agent, validator, dbase, _ := setup()
-		// verifiedSubscriber.UUID is different from that of a new subscriber.
-		dbase.Put(ctx, verifiedSubscriber)
+	t.Run("PreservesExistingVerifiedSubscriber", func(t *testing.T) {
+		agent, _, dbase, subs := setup()
+		existing := *verifiedSubscriber
+		existing.Version = 2
+		dbase.Put(ctx, &existing)
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
-		assert.ErrorContains(t, err, "already a verified subscriber")
-		validator.AssertValidated(t, testEmail)
-		assert.DeepEqual(t, verifiedSubscriber, dbase.Index[testEmail])
+		assert.NilError(t, err)
+		assert.NilError(t, errs[0])
+		expected := *verifiedSubscriber
+		expected.Version = 2
+		assert.DeepEqual(t, &expected, dbase.Index[testEmail])
+		assert.DeepEqual(t, &expected, subs[0])
 	})
 
-	t.Run("PassesThroughDatabaseGetError", func(t *testing.T) {
-		agent, validator, dbase, _ := setup()
-		dbase.SimulateGetErr = func(_ string) error {
-			return makeServerError("test error")
+	t.Run("PromotesExistingPendingSubscriber", func(t *testing.T) {
+		agent, _, dbase, subs := setup()
+		existing := *pendingSubscriber
+		existing.Uid = verifiedSubscriber.Uid
+		existing.Version = 1
+		dbase.Put(ctx, &existing)
+
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
+
+		assert.NilError(t, err)
+		assert.NilError(t, errs[0])
+		expected := &db.Subscriber{
+			Email:     testEmail,
+			Uid:       verifiedSubscriber.Uid,
+			Status:    db.SubscriberVerified,
+			Timestamp: agent.CurrentTime(),
+			Version:   1,
+		}
+		assert.DeepEqual(t, expected, dbase.Index[testEmail])
+	})
+
+	t.Run("ReportsPendingSubscriberNotPromoted", func(t *testing.T) {
+		agent, _, dbase, subs := setup()
+		existing := *pendingSubscriber
+		dbase.Put(ctx, &existing)
+		dbase.SimulatePutErr = func(address string) error {
+			if address == testEmail {
+				return makeServerError("test error")
+			}
+			return nil
 		}
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
-		validator.AssertValidated(t, testEmail)
-		assertServerErrorContains(t, err, "test error")
+		assert.NilError(t, err)
+		assertServerErrorContains(t, errs[0], "failed to write "+testEmail)
+		assert.NilError(t, errs[2])
 	})
 
-	t.Run("PassesThroughDatabasePutError", func(t *testing.T) {
-		agent, validator, dbase, _ := setup()
-		dbase.SimulatePutErr = func(_ string) error {
-			return makeServerError("test error")
+	t.Run("ReportsLaterDuplicatesWithoutAbortingImport", func(t *testing.T) {
+		agent, validator, dbase, subs := setup()
+		subs = append(
+			subs,
+			&db.Subscriber{Email: testEmail},
+			&db.Subscriber{Email: strings.ToUpper(otherEmail)},
+		)
+
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(errs, 5))
+		assert.NilError(t, errs[0])
+		assert.Error(t, errs[1], "test failure")
+		assert.NilError(t, errs[2])
+		assert.Error(t, errs[3], "duplicate of an earlier subscriber")
+		assert.Error(t, errs[4], "duplicate of an earlier subscriber")
+		validator.AssertValidated(t, otherEmail)
+		assert.Assert(t, is.Len(dbase.Subscribers, 2))
+		assert.Equal(t, otherUid, dbase.Index[otherEmail].Uid)
+	})
+
+	t.Run("ReportsSubscribersNotWritten", func(t *testing.T) {
+		agent, _, dbase, subs := setup()
+		dbase.SimulatePutErr = func(address string) error {
+			if address == otherEmail {
+				return makeServerError("test error")
+			}
+			return nil
 		}
 
-		err := agent.Import(ctx, testEmail)
+		errs, err := agent.ImportVerified(ctx, subs, ImportOptions{})
 
-		validator.AssertValidated(t, testEmail)
-		assertServerErrorContains(t, err, "test error")
-		assert.Assert(t, is.Nil(dbase.Index[testEmail]))
+		assert.NilError(t, err)
+		assert.NilError(t, errs[0])
+		assert.Error(t, errs[1], "test failure")
+		assert.Error(t, errs[2], "failed to write "+otherEmail)
+		assert.Assert(t, dbase.Index[testEmail] != nil)
+		assert.Assert(t, is.Nil(dbase.Index[otherEmail]))
 	})
 }
 
@@ -724,6 +1061,51 @@ func TestRestore(t *testing.T) {
 		)
 	})
 
+	t.Run("KeepsExistingVerifiedSubscriber", func(t *testing.T) {
+		agent, dbase, suppressor, _, ctx := setup()
+		existing := *verifiedSubscriber
+		existing.Version = 3
+		dbase.Index[existing.Email] = &existing
+		suppressor.Addresses[existing.Email] = ops.RemoveReasonBounce
+
+		err := agent.Restore(ctx, existing.Email)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+		assert.Equal(
+			t, ops.RemoveReasonNil, suppressor.Addresses[existing.Email],
+		)
+	})
+
+	t.Run("PromotesExistingPendingSubscriber", func(t *testing.T) {
+		agent, dbase, _, _, ctx := setup()
+		existing := *pendingSubscriber
+		existing.Version = 2
+		dbase.Index[existing.Email] = &existing
+
+		err := agent.Restore(ctx, existing.Email)
+
+		assert.NilError(t, err)
+		expected := &db.Subscriber{
+			Email:     existing.Email,
+			Uid:       pendingSubscriber.Uid,
+			Status:    db.SubscriberVerified,
+			Timestamp: agent.CurrentTime(),
+			Version:   2,
+		}
+		assert.DeepEqual(t, expected, dbase.Index[existing.Email])
+	})
+
+	t.Run("RetriesOnceOnVersionConflict", func(t *testing.T) {
+		agent, dbase, _, expectedSub, ctx := setup()
+		dbase.SimulatePutErr = versionConflictOnce()
+
+		err := agent.Restore(ctx, expectedSub.Email)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, expectedSub, dbase.Index[expectedSub.Email])
+	})
+
 	t.Run("PassesThroughPutError", func(t *testing.T) {
 		agent, dbase, _, expectedSub, ctx := setup()
 		dbase.SimulatePutErr = func(address string) error {
@@ -746,57 +1128,477 @@ func TestRestore(t *testing.T) {
 	})
 }
 
-func assertSentToVerifiedSubscriber(
-	t *testing.T,
-	subject string,
-	sub *db.Subscriber,
-	mailer *testdoubles.Mailer,
-	logs *tu.Logs,
-) {
-	t.Helper()
-
-	msgId, m := mailer.GetMessageTo(t, sub.Email)
-	unsubUrl := ops.UnsubscribeUrl(testApiBaseUrl, sub.Email, sub.Uid)
-	unsubMailto := ops.UnsubscribeMailto(testUnsubEmail, sub.Email, sub.Uid)
-	expectedLogMsg := fmt.Sprintf(
-		"sent \"%s\" id: %s to: %s", subject, msgId, sub.Email,
-	)
-	assert.Assert(t, is.Contains(m, unsubUrl))
-	assert.Assert(t, is.Contains(m, unsubMailto))
-	logs.AssertContains(t, expectedLogMsg)
-}
+func TestRecordEngagement(t *testing.T) {
+	setup := func(
+		sub db.Subscriber,
+	) (*ProdAgent, *testdoubles.Database, *db.Subscriber, context.Context) {
+		f := newProdAgentTestFixture()
+		f.db.Index[sub.Email] = &sub
+		return f.agent, f.db, &sub, context.Background()
+	}
 
-func assertSentToVerifiedSubscribers(
-	t *testing.T, subject string, mailer *testdoubles.Mailer, logs *tu.Logs,
-) {
-	t.Helper()
+	t.Run("UpdatesLastEngagedForVerifiedSubscriber", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
 
-	for _, sub := range db.TestVerifiedSubscribers {
-		assertSentToVerifiedSubscriber(t, subject, sub, mailer, logs)
-	}
-}
+		err := agent.RecordEngagement(ctx, sub.Email)
 
-func assertDidNotSendToPendingSubscribers(
-	t *testing.T, mailer *testdoubles.Mailer,
-) {
-	t.Helper()
+		assert.NilError(t, err)
+		expected := *verifiedSubscriber
+		expected.LastEngaged = td.TestTimestamp
+		assert.DeepEqual(t, &expected, dbase.Index[sub.Email])
+	})
 
-	for _, sub := range db.TestPendingSubscribers {
-		mailer.AssertNoMessageSent(t, sub.Email)
-	}
-}
+	t.Run("DoesNothingForPendingSubscriber", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*pendingSubscriber)
 
-func TestSend(t *testing.T) {
-	setup := func() (
-		*ProdAgent,
-		*testdoubles.Database,
-		*testdoubles.Mailer,
-		*tu.Logs,
-		context.Context) {
-		f := newProdAgentTestFixture()
-		ctx := context.Background()
+		err := agent.RecordEngagement(ctx, sub.Email)
 
-		f.setupTestSubscribers()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pendingSubscriber, dbase.Index[sub.Email])
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("PassesThroughGetError", func(t *testing.T) {
+		agent, _, _, ctx := setup(*verifiedSubscriber)
+
+		err := agent.RecordEngagement(ctx, "nobody@foo.com")
+
+		assert.Assert(t, tu.ErrorIs(err, db.ErrSubscriberNotFound))
+	})
+
+	t.Run("PassesThroughPutError", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
+		dbase.SimulatePutErr = func(address string) error {
+			return makeServerError("failed to put " + address)
+		}
+
+		err := agent.RecordEngagement(ctx, sub.Email)
+
+		assertServerErrorContains(t, err, "failed to put "+sub.Email)
+	})
+
+	t.Run("RetriesOnceOnVersionConflict", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
+		dbase.SimulatePutErr = versionConflictOnce()
+
+		err := agent.RecordEngagement(ctx, sub.Email)
+
+		assert.NilError(t, err)
+		assert.Equal(t, td.TestTimestamp, dbase.Index[sub.Email].LastEngaged)
+	})
+
+	t.Run("FailsAfterSecondVersionConflict", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
+		putCalls := 0
+		dbase.SimulatePutErr = func(string) error {
+			putCalls++
+			return db.ErrVersionConflict
+		}
+
+		err := agent.RecordEngagement(ctx, sub.Email)
+
+		assert.Assert(t, tu.ErrorIs(err, db.ErrVersionConflict))
+		assert.Equal(t, 2, putCalls)
+	})
+}
+
+func TestRecordDelivery(t *testing.T) {
+	setup := func(
+		sub db.Subscriber,
+	) (*ProdAgent, *testdoubles.Database, *db.Subscriber, context.Context) {
+		f := newProdAgentTestFixture()
+		f.db.Index[sub.Email] = &sub
+		return f.agent, f.db, &sub, context.Background()
+	}
+
+	t.Run("UpdatesLastDeliveredForVerifiedSubscriber", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
+
+		err := agent.RecordDelivery(ctx, sub.Email)
+
+		assert.NilError(t, err)
+		expected := *verifiedSubscriber
+		expected.LastDelivered = td.TestTimestamp
+		assert.DeepEqual(t, &expected, dbase.Index[sub.Email])
+	})
+
+	t.Run("DoesNothingForPendingSubscriber", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*pendingSubscriber)
+
+		err := agent.RecordDelivery(ctx, sub.Email)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pendingSubscriber, dbase.Index[sub.Email])
+	})
+
+	t.Run("PassesThroughGetError", func(t *testing.T) {
+		agent, _, _, ctx := setup(*verifiedSubscriber)
+
+		err := agent.RecordDelivery(ctx, "nobody@foo.com")
+
+		assert.Assert(t, tu.ErrorIs(err, db.ErrSubscriberNotFound))
+	})
+
+	t.Run("RetriesOnceOnVersionConflict", func(t *testing.T) {
+		agent, dbase, sub, ctx := setup(*verifiedSubscriber)
+		dbase.SimulatePutErr = versionConflictOnce()
+
+		err := agent.RecordDelivery(ctx, sub.Email)
+
+		assert.NilError(t, err)
+		lastDelivered := dbase.Index[sub.Email].LastDelivered
+		assert.Equal(t, td.TestTimestamp, lastDelivered)
+	})
+}
+
+// versionConflictOnce returns a testdoubles.Database.SimulatePutErr function
+// that fails the first Put with db.ErrVersionConflict.
+func versionConflictOnce() func(string) error {
+	conflicted := false
+	return func(string) error {
+		if conflicted {
+			return nil
+		}
+		conflicted = true
+		return db.ErrVersionConflict
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	const goodEmail = "good@foo.com"
+	const badEmail = "bad@foo.com"
+	const pendingEmail = "pending@foo.com"
+
+	setup := func() (*prodAgentTestFixture, context.Context) {
+		f := newProdAgentTestFixture()
+		ctx := context.Background()
+		for _, sub := range []*db.Subscriber{
+			{Email: badEmail, Status: db.SubscriberVerified},
+			{Email: goodEmail, Status: db.SubscriberVerified},
+			{Email: pendingEmail, Status: db.SubscriberPending},
+		} {
+			assert.NilError(t, f.db.Put(ctx, sub))
+		}
+		f.validator.Failures = map[string]*email.ValidationFailure{
+			badEmail: {
+				Address: badEmail, Reason: "no MX records", Suppressed: true,
+			},
+		}
+		return f, ctx
+	}
+
+	t.Run("RemovesInvalidAndKeepsValidSubscribers", func(t *testing.T) {
+		f, ctx := setup()
+
+		result, err := f.agent.Revalidate(ctx, nil, 0, 0)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2, result.NumValidated)
+		assert.DeepEqual(
+			t,
+			[]*email.ValidationFailure{
+				{
+					Address:    badEmail,
+					Reason:     "no MX records",
+					Suppressed: true,
+				},
+			},
+			result.Removed,
+		)
+		assert.Assert(t, is.Nil(result.NextStartKey))
+		assert.Assert(t, is.Nil(f.db.Index[badEmail]))
+		assert.Assert(t, f.db.Index[goodEmail] != nil)
+		assert.Assert(t, f.db.Index[pendingEmail] != nil)
+
+		// The validator already suppressed badEmail, so Revalidate shouldn't
+		// suppress it again and risk replacing its suppression reason.
+		assert.Assert(t, is.Len(f.suppressor.Addresses, 0))
+	})
+
+	t.Run("RemovesFailuresWithoutSuppressingThem", func(t *testing.T) {
+		f, ctx := setup()
+		const roleEmail = "info@foo.com"
+		const noMxEmail = "expired@expired.com"
+		for _, addr := range []string{roleEmail, noMxEmail} {
+			sub := &db.Subscriber{Email: addr, Status: db.SubscriberVerified}
+			assert.NilError(t, f.db.Put(ctx, sub))
+		}
+		roleFailure := &email.ValidationFailure{
+			Address: roleEmail, Reason: email.FailureReasonRoleBased,
+		}
+		noMxFailure := &email.ValidationFailure{
+			Address: noMxEmail,
+			Reason: "failed DNS validation: " +
+				"failed to retrieve MX records for expired.com: no such host",
+		}
+		f.validator.Failures[roleEmail] = roleFailure
+		f.validator.Failures[noMxEmail] = noMxFailure
+
+		result, err := f.agent.Revalidate(ctx, nil, 0, 0)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 4, result.NumValidated)
+		assert.Equal(t, 3, len(result.Removed))
+		assert.Assert(t, is.Contains(result.Removed, roleFailure))
+		assert.Assert(t, is.Contains(result.Removed, noMxFailure))
+		assert.Assert(t, is.Nil(f.db.Index[roleEmail]))
+		assert.Assert(t, is.Nil(f.db.Index[noMxEmail]))
+		assert.Assert(t, is.Len(f.suppressor.Addresses, 0))
+	})
+
+	t.Run("ResumesFromNextStartKey", func(t *testing.T) {
+		f, ctx := setup()
+
+		first, err := f.agent.Revalidate(ctx, nil, 1, 0)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 1, first.NumValidated)
+		assert.Equal(t, 1, len(first.Removed))
+		assert.Assert(t, first.NextStartKey != nil)
+
+		second, err := f.agent.Revalidate(ctx, first.NextStartKey, 1, 0)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 1, second.NumValidated)
+		assert.Equal(t, 0, len(second.Removed))
+		f.validator.AssertValidated(t, goodEmail)
+		assert.Assert(t, f.db.Index[goodEmail] != nil)
+	})
+
+	t.Run("LimitsValidationRate", func(t *testing.T) {
+		f, ctx := setup()
+		start := time.Now()
+
+		_, err := f.agent.Revalidate(ctx, nil, 0, 20)
+
+		assert.NilError(t, err)
+		assert.Assert(t, time.Since(start) >= 40*time.Millisecond)
+	})
+
+	t.Run("PassesThroughGetSubscribersPageError", func(t *testing.T) {
+		f, ctx := setup()
+		f.db.SimulateProcSubsErr = func(string) error {
+			return makeServerError("test error")
+		}
+
+		result, err := f.agent.Revalidate(ctx, nil, 0, 0)
+
+		assertServerErrorContains(t, err, "revalidation failed: test error")
+		assert.Equal(t, 0, result.NumValidated)
+	})
+
+	t.Run("KeepsStartKeyIfValidationFails", func(t *testing.T) {
+		f, ctx := setup()
+		first, err := f.agent.Revalidate(ctx, nil, 1, 0)
+		assert.NilError(t, err)
+		f.validator.Error = makeServerError("test error")
+
+		result, err := f.agent.Revalidate(ctx, first.NextStartKey, 1, 0)
+
+		assertServerErrorContains(
+			t, err, "revalidation failed: "+goodEmail+": test error",
+		)
+		assert.Equal(t, first.NextStartKey, result.NextStartKey)
+		assert.Assert(t, f.db.Index[goodEmail] != nil)
+	})
+
+	t.Run("ResumesAfterLastRevalidatedIfCancelled", func(t *testing.T) {
+		f, ctx := setup()
+		cancelCtx, cancel := context.WithCancel(ctx)
+		f.db.SimulateDelErr = func(string) error {
+			cancel()
+			return nil
+		}
+
+		result, err := f.agent.Revalidate(cancelCtx, nil, 0, 0)
+
+		assert.ErrorContains(t, err, "revalidation interrupted: ")
+		assert.Assert(t, tu.ErrorIs(err, context.Canceled))
+		assert.Equal(t, 1, result.NumValidated)
+		assert.Equal(t, 1, len(result.Removed))
+		assert.Assert(t, result.NextStartKey != nil)
+
+		next, err := f.agent.Revalidate(ctx, result.NextStartKey, 0, 0)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 1, next.NumValidated)
+		f.validator.AssertValidated(t, goodEmail)
+	})
+
+	t.Run("KeepsStartKeyIfRemoveFails", func(t *testing.T) {
+		f, ctx := setup()
+		f.db.SimulateDelErr = func(address string) error {
+			return makeServerError("failed to delete " + address)
+		}
+
+		result, err := f.agent.Revalidate(ctx, nil, 0, 0)
+
+		assertServerErrorContains(t, err, "failed to delete "+badEmail)
+		assert.Assert(t, is.Nil(result.NextStartKey))
+		assert.Equal(t, 0, len(result.Removed))
+	})
+}
+
+func TestStatus(t *testing.T) {
+	setup := func(
+		sub *db.Subscriber,
+	) (*ProdAgent, *testdoubles.Database, context.Context) {
+		f := newProdAgentTestFixture()
+		f.db.Index[sub.Email] = sub
+		return f.agent, f.db, context.Background()
+	}
+
+	t.Run("ReturnsPending", func(t *testing.T) {
+		agent, _, ctx := setup(pendingSubscriber)
+
+		status, err := agent.Status(ctx, testEmail)
+
+		assert.NilError(t, err)
+		assert.Equal(t, db.SubscriberPending, status)
+	})
+
+	t.Run("ReturnsVerified", func(t *testing.T) {
+		agent, _, ctx := setup(verifiedSubscriber)
+
+		status, err := agent.Status(ctx, testEmail)
+
+		assert.NilError(t, err)
+		assert.Equal(t, db.SubscriberVerified, status)
+	})
+
+	t.Run("ReturnsUnknownIfNotFound", func(t *testing.T) {
+		agent, _, ctx := setup(pendingSubscriber)
+
+		status, err := agent.Status(ctx, "nobody@foo.com")
+
+		assert.NilError(t, err)
+		assert.Equal(t, StatusUnknown, status)
+	})
+
+	t.Run("PassesThroughGetError", func(t *testing.T) {
+		agent, dbase, ctx := setup(pendingSubscriber)
+		dbase.SimulateGetErr = func(address string) error {
+			return makeServerError("failed to get " + address)
+		}
+
+		status, err := agent.Status(ctx, testEmail)
+
+		assert.Equal(t, db.SubscriberStatus(""), status)
+		assertServerErrorContains(t, err, "failed to get ")
+	})
+}
+
+func assertSentToVerifiedSubscriber(
+	t *testing.T,
+	subject string,
+	sub *db.Subscriber,
+	mailer *testdoubles.Mailer,
+	logs *tu.Logs,
+) {
+	t.Helper()
+
+	msgId, m := mailer.GetMessageTo(t, sub.Email)
+	unsubUrl := ops.UnsubscribeUrl(testApiBaseUrl, sub.Email, sub.Uid)
+	unsubMailto := ops.UnsubscribeMailto(testUnsubEmail, sub.Email, sub.Uid)
+	expectedLogMsg := fmt.Sprintf(
+		"sent \"%s\" id: %s to: %s", subject, msgId, sub.Email,
+	)
+	assert.Assert(t, is.Contains(m, unsubUrl))
+	assert.Assert(t, is.Contains(m, unsubMailto))
+	logs.AssertContains(t, expectedLogMsg)
+}
+
+func assertSentToVerifiedSubscribers(
+	t *testing.T, subject string, mailer *testdoubles.Mailer, logs *tu.Logs,
+) {
+	t.Helper()
+
+	for _, sub := range db.TestVerifiedSubscribers {
+		assertSentToVerifiedSubscriber(t, subject, sub, mailer, logs)
+	}
+}
+
+func assertDidNotSendToPendingSubscribers(
+	t *testing.T, mailer *testdoubles.Mailer,
+) {
+	t.Helper()
+
+	for _, sub := range db.TestPendingSubscribers {
+		mailer.AssertNoMessageSent(t, sub.Email)
+	}
+}
+
+// complaintMailer simulates a complaint that suppresses an address after the
+// first message of a broadcast goes out.
+type complaintMailer struct {
+	*testdoubles.Mailer
+	suppressor *testdoubles.Suppressor
+	address    string
+}
+
+func (m *complaintMailer) Send(
+	ctx context.Context, recipient string, msg []byte,
+) (string, error) {
+	err := m.suppressor.Suppress(ctx, m.address, ops.RemoveReasonComplaint)
+	if err != nil {
+		return "", err
+	}
+	return m.Mailer.Send(ctx, recipient, msg)
+}
+
+// cancelingMailer cancels the context and fails with context.Canceled, as
+// SesMailer does when cancelled while waiting to send.
+type cancelingMailer struct {
+	*testdoubles.Mailer
+	cancel context.CancelFunc
+}
+
+func (m *cancelingMailer) Send(
+	ctx context.Context, _ string, _ []byte,
+) (string, error) {
+	m.cancel()
+	return "", ctx.Err()
+}
+
+// testSendLog is a fake SendLog that records IDs in memory.
+//
+// Like DynamoDB requests, ForgetEvent fails if ctx is cancelled.
+type testSendLog struct {
+	ids map[string]bool
+	err error
+}
+
+func (l *testSendLog) RecordEvent(
+	_ context.Context, id string,
+) (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	} else if l.ids[id] {
+		return false, nil
+	}
+	l.ids[id] = true
+	return true, nil
+}
+
+func (l *testSendLog) ForgetEvent(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(l.ids, id)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	setup := func() (
+		*ProdAgent,
+		*testdoubles.Database,
+		*testdoubles.Mailer,
+		*tu.Logs,
+		context.Context) {
+		f := newProdAgentTestFixture()
+		ctx := context.Background()
+
+		f.setupTestSubscribers()
 		return f.agent, f.db, f.mailer, f.logs, ctx
 	}
 
@@ -823,6 +1625,69 @@ func TestSend(t *testing.T) {
 			assert.Equal(t, len(db.TestVerifiedSubscribers), numSent)
 		})
 
+		t.Run("AddsListHeadersIfConfigured", func(t *testing.T) {
+			agent, _, mailer, _, ctx := setup()
+			agent.ListHelpUrl = "https://foo.com/help"
+			agent.ListSubscribeUrl = "https://foo.com/subscribe"
+
+			_, err := agent.Send(ctx, msg, []string{})
+
+			assert.NilError(t, err)
+			sub := db.TestVerifiedSubscribers[0]
+			_, m := mailer.GetMessageTo(t, sub.Email)
+			const helpHeader = "List-Help: <https://foo.com/help>\r\n"
+			const subHeader = "List-Subscribe: <https://foo.com/subscribe>\r\n"
+			assert.Assert(t, is.Contains(m, helpHeader))
+			assert.Assert(t, is.Contains(m, subHeader))
+		})
+
+		t.Run("EmitsHeadersInRecommendedOrder", func(t *testing.T) {
+			agent, _, mailer, _, ctx := setup()
+			replyMsg := *msg
+			replyMsg.InReplyTo = "<original@foo.com>"
+
+			_, err := agent.Send(ctx, &replyMsg, []string{})
+
+			assert.NilError(t, err)
+			sub := db.TestVerifiedSubscribers[0]
+			_, m := mailer.GetMessageTo(t, sub.Email)
+			headers, _, _ := strings.Cut(m, "\r\n\r\n")
+			var names []string
+			for _, line := range strings.Split(headers, "\r\n") {
+				if name, _, found := strings.Cut(line, ":"); found &&
+					!strings.HasPrefix(line, " ") {
+					names = append(names, name)
+				}
+			}
+			expected := []string{
+				"From",
+				"To",
+				"Message-ID",
+				"In-Reply-To",
+				"Subject",
+				"MIME-Version",
+				"List-Unsubscribe",
+				"List-Unsubscribe-Post",
+				"Content-Type",
+			}
+			assert.DeepEqual(t, expected, names)
+		})
+
+		t.Run("UsesBase64ThresholdIfConfigured", func(t *testing.T) {
+			agent, _, mailer, _, ctx := setup()
+			agent.Base64MaxQpRatio = 2.5
+			nonAsciiMsg := *msg
+			nonAsciiMsg.TextBody = strings.Repeat("日本語", 150)
+
+			_, err := agent.Send(ctx, &nonAsciiMsg, []string{})
+
+			assert.NilError(t, err)
+			sub := db.TestVerifiedSubscribers[0]
+			_, m := mailer.GetMessageTo(t, sub.Email)
+			const base64Header = "Content-Transfer-Encoding: base64\r\n"
+			assert.Assert(t, is.Contains(m, base64Header))
+		})
+
 		t.Run("FailsIfNoBulkCapacityAvailable", func(t *testing.T) {
 			agent, _, mailer, _, ctx := setup()
 			mailer.BulkCapError = email.ErrBulkSendCapacityExhausted
@@ -871,6 +1736,81 @@ func TestSend(t *testing.T) {
 		})
 	})
 
+	t.Run("CheckSuppressionBeforeSend", func(t *testing.T) {
+		t.Run("SkipsAddressSuppressedMidRun", func(t *testing.T) {
+			agent, _, mailer, logs, ctx := setup()
+			agent.CheckSuppressionBeforeSend = true
+			suppressed := db.TestVerifiedSubscribers[1]
+			agent.Mailer = &complaintMailer{
+				Mailer:     mailer,
+				suppressor: agent.Suppressor.(*testdoubles.Suppressor),
+				address:    suppressed.Email,
+			}
+
+			numSent, err := agent.Send(ctx, msg, []string{})
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(db.TestVerifiedSubscribers)-1, numSent)
+			mailer.AssertNoMessageSent(t, suppressed.Email)
+			for _, sub := range db.TestVerifiedSubscribers {
+				if sub != suppressed {
+					assertSentToVerifiedSubscriber(
+						t, subject, sub, mailer, logs,
+					)
+				}
+			}
+			logs.AssertContains(
+				t, "skipped \""+subject+"\" to suppressed address: "+
+					suppressed.Email,
+			)
+		})
+
+		t.Run("SkipsSuppressedSpecificRecipient", func(t *testing.T) {
+			agent, _, mailer, logs, ctx := setup()
+			agent.CheckSuppressionBeforeSend = true
+			subs := []*db.Subscriber{
+				db.TestVerifiedSubscribers[0], db.TestVerifiedSubscribers[2],
+			}
+			sup := agent.Suppressor.(*testdoubles.Suppressor)
+			sup.Addresses[subs[0].Email] = ops.RemoveReasonBounce
+
+			numSent, err := agent.Send(ctx, msg, getAddrs(subs...))
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+			mailer.AssertNoMessageSent(t, subs[0].Email)
+			assertSentToVerifiedSubscriber(t, subject, subs[1], mailer, logs)
+		})
+
+		t.Run("SendsToSuppressedAddressIfNotEnabled", func(t *testing.T) {
+			agent, _, mailer, logs, ctx := setup()
+			sub := db.TestVerifiedSubscribers[0]
+			sup := agent.Suppressor.(*testdoubles.Suppressor)
+			sup.Addresses[sub.Email] = ops.RemoveReasonBounce
+
+			numSent, err := agent.Send(ctx, msg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+			assertSentToVerifiedSubscriber(t, subject, sub, mailer, logs)
+		})
+
+		t.Run("FailsIfSuppressionCheckFails", func(t *testing.T) {
+			agent, _, mailer, _, ctx := setup()
+			agent.CheckSuppressionBeforeSend = true
+			sub := db.TestVerifiedSubscribers[0]
+			checkErr := errors.New("IsSuppressed failed")
+			sup := agent.Suppressor.(*testdoubles.Suppressor)
+			sup.Errors[sub.Email] = checkErr
+
+			numSent, err := agent.Send(ctx, msg, []string{})
+
+			assert.Equal(t, 0, numSent)
+			assert.Assert(t, tu.ErrorIs(err, checkErr))
+			mailer.AssertNoMessageSent(t, sub.Email)
+		})
+	})
+
 	t.Run("ToSpecificRecipients", func(t *testing.T) {
 		t.Run("Succeeds", func(t *testing.T) {
 			agent, _, mailer, logs, ctx := setup()
@@ -936,6 +1876,161 @@ func TestSend(t *testing.T) {
 		})
 	})
 
+	t.Run("WithCampaignKey", func(t *testing.T) {
+		campaignMsg := *msg
+		campaignMsg.CampaignKey = "2023-05-newsletter"
+
+		setupCampaign := func() (
+			*ProdAgent,
+			*testdoubles.Mailer,
+			*testSendLog,
+			*tu.Logs,
+			context.Context,
+		) {
+			agent, _, mailer, logs, ctx := setup()
+			sendLog := &testSendLog{ids: map[string]bool{}}
+			agent.SendLog = sendLog
+			return agent, mailer, sendLog, logs, ctx
+		}
+
+		t.Run("SecondSendSkipsPreviousRecipients", func(t *testing.T) {
+			agent, mailer, _, _, ctx := setupCampaign()
+			sub := db.TestVerifiedSubscribers[0]
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+
+			delete(mailer.RecipientMessages, sub.Email)
+			numSent, err = agent.Send(ctx, &campaignMsg, []string{})
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(db.TestVerifiedSubscribers)-1, numSent)
+			mailer.AssertNoMessageSent(t, sub.Email)
+			for _, other := range db.TestVerifiedSubscribers[1:] {
+				mailer.GetMessageTo(t, other.Email)
+			}
+		})
+
+		t.Run("LogsSkippedRecipients", func(t *testing.T) {
+			agent, _, sendLog, logs, ctx := setupCampaign()
+			sub := db.TestVerifiedSubscribers[0]
+			sendLog.ids["send/2023-05-newsletter/"+sub.Email] = true
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 0, numSent)
+			const logFmt = "skipped \"%s\" already sent to: %s"
+			logs.AssertContains(t, fmt.Sprintf(logFmt, subject, sub.Email))
+		})
+
+		t.Run("DifferentKeySendsAgain", func(t *testing.T) {
+			agent, _, _, _, ctx := setupCampaign()
+			addrs := getAddrs(db.TestVerifiedSubscribers...)
+
+			_, err := agent.Send(ctx, &campaignMsg, addrs)
+			assert.NilError(t, err)
+
+			nextMsg := campaignMsg
+			nextMsg.CampaignKey = "2023-06-newsletter"
+			numSent, err := agent.Send(ctx, &nextMsg, addrs)
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(addrs), numSent)
+		})
+
+		t.Run("RetrySendsToRecipientsThatFailed", func(t *testing.T) {
+			agent, mailer, _, _, ctx := setupCampaign()
+			sub := db.TestVerifiedSubscribers[0]
+			sendErr := errors.New("Mailer.Send failed")
+			mailer.RecipientErrors[sub.Email] = sendErr
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{})
+
+			assert.Assert(t, tu.ErrorIs(err, sendErr))
+			assert.Equal(t, 0, numSent)
+
+			delete(mailer.RecipientErrors, sub.Email)
+			numSent, err = agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+			mailer.GetMessageTo(t, sub.Email)
+		})
+
+		t.Run("ForgetsRecipientIfSendCancelled", func(t *testing.T) {
+			agent, mailer, sendLog, logs, ctx := setupCampaign()
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			agent.Mailer = &cancelingMailer{Mailer: mailer, cancel: cancel}
+			sub := db.TestVerifiedSubscribers[0]
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.Assert(t, tu.ErrorIs(err, context.Canceled))
+			assert.Equal(t, 0, numSent)
+			assert.Assert(t, !sendLog.ids["send/2023-05-newsletter/"+sub.Email])
+			assert.Assert(
+				t, !strings.Contains(logs.Logs(), "failed to forget"),
+			)
+		})
+
+		t.Run("FailsIfSendLogFails", func(t *testing.T) {
+			agent, mailer, sendLog, _, ctx := setupCampaign()
+			sub := db.TestVerifiedSubscribers[0]
+			sendLog.err = errors.New("RecordEvent failed")
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.Assert(t, tu.ErrorIs(err, sendLog.err))
+			assert.Equal(t, 0, numSent)
+			mailer.AssertNoMessageSent(t, sub.Email)
+		})
+
+		t.Run("DryRunDoesNotRecordRecipients", func(t *testing.T) {
+			agent, mailer, sendLog, _, ctx := setupCampaign()
+			agent.SendDryRun = true
+			sub := db.TestVerifiedSubscribers[0]
+			sendLog.err = errors.New("SendLog should not be called")
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+			mailer.GetMessageTo(t, sub.Email)
+			assert.Equal(t, 0, len(sendLog.ids))
+		})
+
+		t.Run("DryRunDoesNotRequireSendLog", func(t *testing.T) {
+			agent, mailer, _, _, ctx := setupCampaign()
+			agent.SendLog = nil
+			agent.SendDryRun = true
+			sub := db.TestVerifiedSubscribers[0]
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			assert.NilError(t, err)
+			assert.Equal(t, 1, numSent)
+			mailer.GetMessageTo(t, sub.Email)
+		})
+
+		t.Run("FailsIfSendLogNotConfigured", func(t *testing.T) {
+			agent, mailer, _, _, ctx := setupCampaign()
+			agent.SendLog = nil
+			sub := db.TestVerifiedSubscribers[0]
+
+			numSent, err := agent.Send(ctx, &campaignMsg, []string{sub.Email})
+
+			const expectedErr = "can't send with CampaignKey " +
+				`"2023-05-newsletter": no SendLog configured`
+			assert.Error(t, err, expectedErr)
+			assert.Equal(t, 0, numSent)
+			mailer.AssertNoMessageSent(t, sub.Email)
+		})
+	})
+
 	t.Run("FailsIfMessageFailsValidationDueToFromDomain", func(t *testing.T) {
 		agent, _, _, _, ctx := setup()
 		badMsg := *msg
@@ -948,3 +2043,70 @@ func TestSend(t *testing.T) {
 		assert.Equal(t, 0, numSent)
 	})
 }
+
+func TestTestSend(t *testing.T) {
+	const testAddr = "author@foo.com"
+
+	setup := func() (
+		*ProdAgent, *testdoubles.Mailer, *tu.Logs, context.Context,
+	) {
+		f := newProdAgentTestFixture()
+		f.setupTestSubscribers()
+		f.mailer.MessageIds[testAddr] = "test-send-msg"
+
+		// Any attempt to send to the list will fail.
+		f.mailer.BulkCapError = errors.New("should not send to list")
+		return f.agent, f.mailer, f.logs, context.Background()
+	}
+
+	msg := testMessage()
+
+	t.Run("SendsToArbitraryAddressOnly", func(t *testing.T) {
+		agent, mailer, logs, ctx := setup()
+
+		numSent, err := agent.TestSend(ctx, msg, testAddr)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 1, numSent)
+		assert.Assert(t, is.Len(mailer.RecipientMessages, 1))
+		sub := &db.Subscriber{Email: testAddr, Uid: td.TestUid}
+		assertSentToVerifiedSubscriber(t, msg.Subject, sub, mailer, logs)
+	})
+
+	t.Run("FailsIfMessageFailsValidation", func(t *testing.T) {
+		agent, mailer, _, ctx := setup()
+		badMsg := *msg
+		badMsg.From = "Blog Updates <updates@bar.com>"
+
+		numSent, err := agent.TestSend(ctx, &badMsg, testAddr)
+
+		assert.Equal(t, 0, numSent)
+		assert.ErrorContains(t, err, "domain of From address is not ")
+		mailer.AssertNoMessageSent(t, testAddr)
+	})
+
+	t.Run("FailsIfCannotCreateUid", func(t *testing.T) {
+		agent, mailer, _, ctx := setup()
+		agent.NewUid = func() (uuid.UUID, error) {
+			return uuid.Nil, errors.New("test uid error")
+		}
+
+		numSent, err := agent.TestSend(ctx, msg, testAddr)
+
+		assert.Equal(t, 0, numSent)
+		assert.ErrorContains(t, err, "test send uid: test uid error")
+		mailer.AssertNoMessageSent(t, testAddr)
+	})
+
+	t.Run("FailsIfSendFails", func(t *testing.T) {
+		agent, mailer, _, ctx := setup()
+		sendErr := errors.New("Mailer.Send failed")
+		mailer.RecipientErrors[testAddr] = sendErr
+
+		numSent, err := agent.TestSend(ctx, msg, testAddr)
+
+		assert.Equal(t, 0, numSent)
+		assert.Assert(t, tu.ErrorIs(err, sendErr))
+		assert.ErrorContains(t, err, "error test sending ")
+	})
+}
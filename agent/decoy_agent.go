@@ -64,8 +64,16 @@ func (a *DecoyAgent) Validate(
 	return nil, nil
 }
 
-func (a *DecoyAgent) Import(ctx context.Context, address string) (err error) {
-	return nil
+func (a *DecoyAgent) ImportVerified(
+	ctx context.Context, subscribers []*db.Subscriber, _ ImportOptions,
+) ([]error, error) {
+	return make([]error, len(subscribers)), nil
+}
+
+func (a *DecoyAgent) Revalidate(
+	ctx context.Context, _ db.StartKey, _ int, _ float64,
+) (*RevalidateResult, error) {
+	return &RevalidateResult{Removed: []*email.ValidationFailure{}}, nil
 }
 
 func (a *DecoyAgent) Remove(
@@ -77,8 +85,26 @@ func (a *DecoyAgent) Restore(ctx context.Context, email string) error {
 	return nil
 }
 
+func (a *DecoyAgent) RecordEngagement(
+	ctx context.Context, email string,
+) error {
+	return nil
+}
+
+func (a *DecoyAgent) RecordDelivery(
+	ctx context.Context, email string,
+) error {
+	return nil
+}
+
 func (a *DecoyAgent) Send(
 	ctx context.Context, msg *email.Message, addrs []string,
 ) (numSent int, err error) {
 	return 0, nil
 }
+
+func (a *DecoyAgent) TestSend(
+	ctx context.Context, msg *email.Message, address string,
+) (numSent int, err error) {
+	return 0, nil
+}
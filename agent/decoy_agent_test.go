@@ -32,15 +32,18 @@ func TestDecoyAgent(t *testing.T) {
 	assert.Assert(t, is.Nil(failure))
 	assert.NilError(t, err)
 
-	err = da.Import(ctx, "foo@bar.com")
-	assert.NilError(t, err)
-
 	err = da.Remove(ctx, "foo@bar.com", ops.RemoveReasonBounce)
 	assert.NilError(t, err)
 
 	err = da.Restore(ctx, "foo@bar.com")
 	assert.NilError(t, err)
 
+	err = da.RecordEngagement(ctx, "foo@bar.com")
+	assert.NilError(t, err)
+
+	err = da.RecordDelivery(ctx, "foo@bar.com")
+	assert.NilError(t, err)
+
 	numSent, err := da.Send(ctx, nil, []string{})
 	assert.NilError(t, err)
 	assert.Equal(t, 0, numSent)
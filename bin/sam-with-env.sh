@@ -37,6 +37,155 @@ PARAMETER_OVERRIDES=(
   "UnsubscribedPath=${UNSUBSCRIBED_PATH:?}"
 )
 
+if [[ -n "$BLOCKED_PATH" ]]; then
+  PARAMETER_OVERRIDES+=("BlockedPath=${BLOCKED_PATH}")
+fi
+if [[ -n "$LINK_EXPIRED_PATH" ]]; then
+  PARAMETER_OVERRIDES+=("LinkExpiredPath=${LINK_EXPIRED_PATH}")
+fi
+if [[ -n "$UNKNOWN_SUBSCRIBER_PATH" ]]; then
+  PARAMETER_OVERRIDES+=("UnknownSubscriberPath=${UNKNOWN_SUBSCRIBER_PATH}")
+fi
+if [[ -n "$MAINTENANCE_PATH" ]]; then
+  PARAMETER_OVERRIDES+=("MaintenancePath=${MAINTENANCE_PATH}")
+fi
+if [[ -n "$MAINTENANCE_MODE" ]]; then
+  PARAMETER_OVERRIDES+=("MaintenanceMode=${MAINTENANCE_MODE}")
+fi
+if [[ -n "$RESPONSE_PAGES_DIR" ]]; then
+  PARAMETER_OVERRIDES+=("ResponsePagesDir=${RESPONSE_PAGES_DIR}")
+fi
+if [[ -n "$LIST_HELP_URL" ]]; then
+  PARAMETER_OVERRIDES+=("ListHelpUrl=${LIST_HELP_URL}")
+fi
+if [[ -n "$LIST_SUBSCRIBE_URL" ]]; then
+  PARAMETER_OVERRIDES+=("ListSubscribeUrl=${LIST_SUBSCRIBE_URL}")
+fi
+if [[ -n "$CHECK_SUPPRESSION_BEFORE_SEND" ]]; then
+  PARAMETER_OVERRIDES+=(
+    "CheckSuppressionBeforeSend=${CHECK_SUPPRESSION_BEFORE_SEND}"
+  )
+fi
+if [[ -n "$LOOKUP_SUPPRESSION_REASONS" ]]; then
+  PARAMETER_OVERRIDES+=(
+    "LookupSuppressionReasons=${LOOKUP_SUPPRESSION_REASONS}"
+  )
+fi
+if [[ -n "$BOUNCE_DRY_RUN" ]]; then
+  PARAMETER_OVERRIDES+=("BounceDryRun=${BOUNCE_DRY_RUN}")
+fi
+if [[ -n "$SEND_DRY_RUN" ]]; then
+  PARAMETER_OVERRIDES+=("SendDryRun=${SEND_DRY_RUN}")
+fi
+if [[ -n "$TOLERATE_SES_SCHEMA_DRIFT" ]]; then
+  PARAMETER_OVERRIDES+=("TolerateSesSchemaDrift=${TOLERATE_SES_SCHEMA_DRIFT}")
+fi
+if [[ -n "$SNS_CONCURRENCY" ]]; then
+  PARAMETER_OVERRIDES+=("SnsConcurrency=${SNS_CONCURRENCY}")
+fi
+if [[ -n "$RECORD_DELIVERIES" ]]; then
+  PARAMETER_OVERRIDES+=("RecordDeliveries=${RECORD_DELIVERIES}")
+fi
+if [[ -n "$METRICS_NAMESPACE" ]]; then
+  PARAMETER_OVERRIDES+=("MetricsNamespace=${METRICS_NAMESPACE}")
+fi
+if [[ -n "$SUCCESS_LOG_SAMPLE_RATE" ]]; then
+  PARAMETER_OVERRIDES+=("SuccessLogSampleRate=${SUCCESS_LOG_SAMPLE_RATE}")
+fi
+if [[ -n "$BOUNCE_POLICY" ]]; then
+  PARAMETER_OVERRIDES+=("BouncePolicy=${BOUNCE_POLICY}")
+fi
+if [[ -n "$BOUNCE_RETRIES" ]]; then
+  PARAMETER_OVERRIDES+=("BounceRetries=${BOUNCE_RETRIES}")
+fi
+if [[ -n "$SES_EVENTS_TTL" ]]; then
+  PARAMETER_OVERRIDES+=("SesEventsTtl=${SES_EVENTS_TTL}")
+fi
+if [[ -n "$SEND_LOG_TTL" ]]; then
+  PARAMETER_OVERRIDES+=("SendLogTtl=${SEND_LOG_TTL}")
+fi
+if [[ -n "$REDACT_EMAIL_ADDRESSES" ]]; then
+  PARAMETER_OVERRIDES+=("RedactEmailAddresses=${REDACT_EMAIL_ADDRESSES}")
+fi
+if [[ -n "$LOG_CONSUMED_CAPACITY" ]]; then
+  PARAMETER_OVERRIDES+=("LogConsumedCapacity=${LOG_CONSUMED_CAPACITY}")
+fi
+if [[ -n "$LINK_SIGNING_KEY" ]]; then
+  PARAMETER_OVERRIDES+=("LinkSigningKey=${LINK_SIGNING_KEY}")
+fi
+if [[ -n "$DKIM_SELECTOR" ]]; then
+  PARAMETER_OVERRIDES+=("DkimSelector=${DKIM_SELECTOR}")
+fi
+if [[ -n "$DKIM_PRIVATE_KEY" ]]; then
+  PARAMETER_OVERRIDES+=("DkimPrivateKey=${DKIM_PRIVATE_KEY}")
+fi
+if [[ -n "$ALLOWED_SINGLE_LABEL_DOMAINS" ]]; then
+  PARAMETER_OVERRIDES+=(
+    "AllowedSingleLabelDomains=${ALLOWED_SINGLE_LABEL_DOMAINS}"
+  )
+fi
+if [[ -n "$ALLOWED_IP_LITERAL_RANGES" ]]; then
+  PARAMETER_OVERRIDES+=("AllowedIpLiteralRanges=${ALLOWED_IP_LITERAL_RANGES}")
+fi
+if [[ -n "$INVALID_USER_NAMES" ]]; then
+  PARAMETER_OVERRIDES+=("InvalidUserNames=${INVALID_USER_NAMES}")
+fi
+if [[ -n "$INVALID_DOMAINS" ]]; then
+  PARAMETER_OVERRIDES+=("InvalidDomains=${INVALID_DOMAINS}")
+fi
+if [[ -n "$ROLE_USER_NAMES" ]]; then
+  PARAMETER_OVERRIDES+=("RoleUserNames=${ROLE_USER_NAMES}")
+fi
+if [[ -n "$MX_FAILURE_THRESHOLD" ]]; then
+  PARAMETER_OVERRIDES+=("MxFailureThreshold=${MX_FAILURE_THRESHOLD}")
+fi
+if [[ -n "$MX_FAILURE_WINDOW" ]]; then
+  PARAMETER_OVERRIDES+=("MxFailureWindow=${MX_FAILURE_WINDOW}")
+fi
+if [[ -n "$DNS_LOOKUP_TIMEOUT" ]]; then
+  PARAMETER_OVERRIDES+=("DnsLookupTimeout=${DNS_LOOKUP_TIMEOUT}")
+fi
+if [[ -n "$MAX_CONCURRENT_DNS_LOOKUPS" ]]; then
+  PARAMETER_OVERRIDES+=(
+    "MaxConcurrentDnsLookups=${MAX_CONCURRENT_DNS_LOOKUPS}"
+  )
+fi
+if [[ -n "$MAILTO_MAX_AGE" ]]; then
+  PARAMETER_OVERRIDES+=("MailtoMaxAge=${MAILTO_MAX_AGE}")
+fi
+if [[ -n "$MAILTO_CATCH_ALL_UNSUBSCRIBE" ]]; then
+  PARAMETER_OVERRIDES+=(
+    "MailtoCatchAllUnsubscribe=${MAILTO_CATCH_ALL_UNSUBSCRIBE}"
+  )
+fi
+if [[ -n "$VERIFY_LINK_EXPIRY" ]]; then
+  PARAMETER_OVERRIDES+=("VerifyLinkExpiry=${VERIFY_LINK_EXPIRY}")
+fi
+if [[ -n "$VERIFY_RETRIES" ]]; then
+  PARAMETER_OVERRIDES+=("VerifyRetries=${VERIFY_RETRIES}")
+fi
+if [[ -n "$MAX_SEND_RATE_CAPACITY" ]]; then
+  PARAMETER_OVERRIDES+=("MaxSendRateCapacity=${MAX_SEND_RATE_CAPACITY}")
+fi
+if [[ -n "$SEND_RATE" ]]; then
+  PARAMETER_OVERRIDES+=("SendRate=${SEND_RATE}")
+fi
+if [[ -n "$MAX_SEND_RETRIES" ]]; then
+  PARAMETER_OVERRIDES+=("MaxSendRetries=${MAX_SEND_RETRIES}")
+fi
+if [[ -n "$BASE64_MAX_QP_RATIO" ]]; then
+  PARAMETER_OVERRIDES+=("Base64MaxQpRatio=${BASE64_MAX_QP_RATIO}")
+fi
+if [[ -n "$BASE64_MAX_QP_SIZE" ]]; then
+  PARAMETER_OVERRIDES+=("Base64MaxQpSize=${BASE64_MAX_QP_SIZE}")
+fi
+if [[ -n "$SENDER_IDENTITY_ARNS" ]]; then
+  PARAMETER_OVERRIDES+=("SenderIdentityArns=${SENDER_IDENTITY_ARNS}")
+fi
+if [[ -n "$SES_EVENTS_QUEUE_ARN" ]]; then
+  PARAMETER_OVERRIDES+=("SesEventsQueueArn=${SES_EVENTS_QUEUE_ARN}")
+fi
+
 export SAM_CLI_TELEMETRY=0
 
 FLAGS=()
@@ -11,11 +11,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	ltypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/ops"
 )
 
 const FunctionArnKey = "EListManFunctionArn"
+const ApiRootUrlKey = "ApiRootUrl"
 
 var AwsConfig aws.Config = ops.MustLoadDefaultAwsConfig()
 
@@ -25,6 +27,12 @@ func NewDynamoDb(tableName string) *db.DynamoDb {
 	return db.NewDynamoDb(AwsConfig, tableName)
 }
 
+type DatabaseFactoryFunc func(tableName string) db.Database
+
+func NewDatabase(tableName string) db.Database {
+	return NewDynamoDb(tableName)
+}
+
 type LambdaClient interface {
 	Invoke(
 		context.Context,
@@ -53,6 +61,20 @@ func NewCloudFormationClient() CloudFormationClient {
 	return cloudformation.NewFromConfig(AwsConfig)
 }
 
+type SesIdentityClient interface {
+	GetEmailIdentity(
+		context.Context,
+		*sesv2.GetEmailIdentityInput,
+		...func(*sesv2.Options),
+	) (*sesv2.GetEmailIdentityOutput, error)
+}
+
+type SesIdentityClientFactoryFunc func() SesIdentityClient
+
+func NewSesIdentityClient() SesIdentityClient {
+	return sesv2.NewFromConfig(AwsConfig)
+}
+
 type EListManFunc interface {
 	Invoke(ctx context.Context, request, response any) error
 }
@@ -102,13 +124,28 @@ func NewLambda(
 func GetLambdaArn(
 	ctx context.Context, cfc CloudFormationClient, stackName string,
 ) (arn string, err error) {
+	return getStackOutput(ctx, cfc, stackName, FunctionArnKey, "Lambda ARN")
+}
+
+func GetApiRootUrl(
+	ctx context.Context, cfc CloudFormationClient, stackName string,
+) (url string, err error) {
+	return getStackOutput(ctx, cfc, stackName, ApiRootUrlKey, "API root URL")
+}
+
+func getStackOutput(
+	ctx context.Context,
+	cfc CloudFormationClient,
+	stackName, outputKey, description string,
+) (value string, err error) {
 	input := &cloudformation.DescribeStacksInput{
 		StackName: aws.String(stackName),
 	}
 	var output *cloudformation.DescribeStacksOutput
 
 	if output, err = cfc.DescribeStacks(ctx, input); err != nil {
-		err = ops.AwsError("failed to get Lambda ARN for "+stackName, err)
+		prefix := "failed to get " + description + " for " + stackName
+		err = ops.AwsError(prefix, err)
 		return
 	} else if len(output.Stacks) == 0 {
 		err = errors.New("stack not found: " + stackName)
@@ -119,13 +156,13 @@ func GetLambdaArn(
 	for i := range stack.Outputs {
 		output := &stack.Outputs[i]
 
-		if aws.ToString(output.OutputKey) == FunctionArnKey {
-			arn = aws.ToString(output.OutputValue)
+		if aws.ToString(output.OutputKey) == outputKey {
+			value = aws.ToString(output.OutputValue)
 			return
 		}
 	}
 	const errFmt = `stack "%s" doesn't contain output key "%s"`
-	err = fmt.Errorf(errFmt, stackName, FunctionArnKey)
+	err = fmt.Errorf(errFmt, stackName, outputKey)
 	return
 }
 
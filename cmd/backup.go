@@ -0,0 +1,226 @@
+// Copyright © 2023 Mike Bland <mbland@acm.org>
+// See LICENSE.txt for details.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/db"
+	"github.com/spf13/cobra"
+)
+
+const backupDescription = `` +
+	`Writes every subscriber record in a DynamoDB table to standard output
+
+The command takes one argument, which is the name of the subscribers table.
+
+Writes one JSON object per line for each pending and verified subscriber,
+containing its email address, UID, status, and timestamps. The restore command
+can read this output to recreate the records exactly.
+
+To back up a table to a file:
+  elistman backup TABLE_NAME > subscribers.jsonl`
+
+const restoreDescription = `` +
+	`Writes subscriber records from a backup to a DynamoDB table
+
+The command takes one argument, which is the name of the subscribers table.
+
+Reads the output of the backup command from standard input, then writes every
+record to the table, preserving each subscriber's UID, status, and timestamps.
+Overwrites any existing records for the same email addresses. Validates the
+entire backup before writing any records.
+
+Record versions aren't preserved, since they only guard against concurrent
+updates. Each restored record begins a new version history.
+
+To restore a table from a file:
+  elistman restore TABLE_NAME < subscribers.jsonl`
+
+func init() {
+	rootCmd.AddCommand(newBackupCmd(NewDatabase))
+	rootCmd.AddCommand(newRestoreCmd(NewDatabase))
+}
+
+func newBackupCmd(newDatabase DatabaseFactoryFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup",
+		Short: "Back up all subscribers from a DynamoDB table",
+		Long:  backupDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return backupSubscribers(cmd, newDatabase(args[0]), args[0])
+		},
+	}
+}
+
+func newRestoreCmd(newDatabase DatabaseFactoryFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore",
+		Short: "Restore subscribers from a backup to a DynamoDB table",
+		Long:  restoreDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return restoreSubscribers(cmd, newDatabase(args[0]), args[0])
+		},
+	}
+}
+
+// backupRecord is the representation of a db.Subscriber in a backup.
+//
+// Optional timestamps are omitted when they're zero.
+type backupRecord struct {
+	Email         string              `json:"email"`
+	Uid           uuid.UUID           `json:"uid"`
+	Status        db.SubscriberStatus `json:"status"`
+	Timestamp     time.Time           `json:"timestamp"`
+	LastEngaged   *time.Time          `json:"lastEngaged,omitempty"`
+	LastDelivered *time.Time          `json:"lastDelivered,omitempty"`
+	ConfirmExpiry *time.Time          `json:"confirmExpiry,omitempty"`
+}
+
+func newBackupRecord(sub *db.Subscriber) *backupRecord {
+	return &backupRecord{
+		Email:         sub.Email,
+		Uid:           sub.Uid,
+		Status:        sub.Status,
+		Timestamp:     sub.Timestamp,
+		LastEngaged:   optionalTime(sub.LastEngaged),
+		LastDelivered: optionalTime(sub.LastDelivered),
+		ConfirmExpiry: optionalTime(sub.ConfirmExpiry),
+	}
+}
+
+func (r *backupRecord) subscriber() *db.Subscriber {
+	return &db.Subscriber{
+		Email:         r.Email,
+		Uid:           r.Uid,
+		Status:        r.Status,
+		Timestamp:     r.Timestamp,
+		LastEngaged:   timeOrZero(r.LastEngaged),
+		LastDelivered: timeOrZero(r.LastDelivered),
+		ConfirmExpiry: timeOrZero(r.ConfirmExpiry),
+	}
+}
+
+func (r *backupRecord) validate() error {
+	if r.Email == "" {
+		return errors.New("missing email")
+	} else if r.Uid == uuid.Nil {
+		return errors.New("missing uid")
+	} else if r.Timestamp.IsZero() {
+		return errors.New("missing timestamp")
+	}
+	switch r.Status {
+	case db.SubscriberPending, db.SubscriberVerified:
+		return nil
+	}
+	return fmt.Errorf("invalid status: %q", r.Status)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func backupSubscribers(
+	cmd *cobra.Command, dbase db.Database, tableName string,
+) (err error) {
+	cmd.SilenceUsage = true
+	ctx := context.Background()
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	numBackedUp := 0
+
+	writePage := func(page []*db.Subscriber) (bool, error) {
+		for _, sub := range page {
+			if err := encoder.Encode(newBackupRecord(sub)); err != nil {
+				const errFmt = "failed to write %s: %w"
+				return false, fmt.Errorf(errFmt, sub.Email, err)
+			}
+			numBackedUp++
+		}
+		return true, nil
+	}
+
+	for _, status := range []db.SubscriberStatus{
+		db.SubscriberPending, db.SubscriberVerified,
+	} {
+		err = dbase.ProcessSubscriberPages(ctx, status, writePage)
+		if err != nil {
+			return fmt.Errorf("backup of %s failed: %w", tableName, err)
+		}
+	}
+	cmd.PrintErrf("Backed up %d subscribers from %s.\n", numBackedUp, tableName)
+	return
+}
+
+func restoreSubscribers(
+	cmd *cobra.Command, dbase db.Database, tableName string,
+) (err error) {
+	cmd.SilenceUsage = true
+	var subs []*db.Subscriber
+	var failed []*db.Subscriber
+
+	if subs, err = readBackup(cmd.InOrStdin()); err != nil {
+		return fmt.Errorf("failed to read backup from stdin: %w", err)
+	}
+
+	ctx := context.Background()
+	if failed, err = dbase.PutBatch(ctx, subs); err != nil {
+		return fmt.Errorf("restore to %s failed: %w", tableName, err)
+	} else if len(failed) != 0 {
+		emails := make([]string, len(failed))
+		for i, sub := range failed {
+			emails[i] = sub.Email
+		}
+		const errFmt = "failed to restore the following %d subscribers:\n  %s"
+		return fmt.Errorf(errFmt, len(failed), strings.Join(emails, "\n  "))
+	}
+	cmd.Printf("Restored %d subscribers to %s.\n", len(subs), tableName)
+	return
+}
+
+func readBackup(r io.Reader) (subs []*db.Subscriber, err error) {
+	var lines []string
+
+	if lines, err = readLines(r); err != nil {
+		return
+	}
+
+	var errs []error
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		record := &backupRecord{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+		} else if err := record.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", i+1, err))
+		} else {
+			subs = append(subs, record.subscriber())
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		subs = nil
+	}
+	return
+}
@@ -0,0 +1,212 @@
+//go:build small_tests || all_tests
+
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/db"
+	"github.com/mbland/elistman/testdoubles"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func backupTestSubscribers() []*db.Subscriber {
+	const pendingUid = "00000000-1111-2222-3333-444444444444"
+	const verifiedUid = "55555555-6666-7777-8888-999999999999"
+	timestamp := time.Date(2023, time.May, 21, 12, 34, 56, 0, time.UTC)
+
+	return []*db.Subscriber{
+		{
+			Email:         "pending@example.com",
+			Uid:           uuid.MustParse(pendingUid),
+			Status:        db.SubscriberPending,
+			Timestamp:     timestamp,
+			ConfirmExpiry: timestamp.Add(time.Hour),
+			Version:       1,
+		},
+		{
+			Email:         "verified@example.com",
+			Uid:           uuid.MustParse(verifiedUid),
+			Status:        db.SubscriberVerified,
+			Timestamp:     timestamp.Add(-24 * time.Hour),
+			LastEngaged:   timestamp.Add(2 * time.Hour),
+			LastDelivered: timestamp.Add(time.Hour),
+			Version:       3,
+		},
+	}
+}
+
+func newBackupDatabase(subs []*db.Subscriber) *testdoubles.Database {
+	dbase := testdoubles.NewDatabase()
+	for _, sub := range subs {
+		dbase.Subscribers = append(dbase.Subscribers, sub)
+		dbase.Index[sub.Email] = sub
+	}
+	return dbase
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	const tableName = "elistman-subscribers"
+	originals := backupTestSubscribers()
+	backup := NewCommandTestFixture(newBackupCmd(
+		func(string) db.Database { return newBackupDatabase(originals) },
+	))
+	backup.Cmd.SetArgs([]string{tableName})
+	restored := testdoubles.NewDatabase()
+	restore := NewCommandTestFixture(newRestoreCmd(
+		func(string) db.Database { return restored },
+	))
+	restore.Cmd.SetArgs([]string{tableName})
+
+	assert.NilError(t, backup.Cmd.Execute())
+	restore.Cmd.SetIn(strings.NewReader(backup.Stdout.String()))
+	assert.NilError(t, restore.Cmd.Execute())
+
+	assert.Equal(
+		t,
+		"Backed up 2 subscribers from "+tableName+".\n",
+		backup.Stderr.String(),
+	)
+	assert.Equal(
+		t,
+		"Restored 2 subscribers to "+tableName+".\n",
+		restore.Stdout.String(),
+	)
+	assert.Equal(t, len(originals), len(restored.Subscribers))
+	for i, orig := range originals {
+		sub := restored.Subscribers[i]
+		assert.Equal(t, orig.Email, sub.Email)
+		assert.Equal(t, orig.Uid, sub.Uid)
+		assert.Equal(t, orig.Status, sub.Status)
+		assert.Equal(t, orig.Timestamp, sub.Timestamp)
+		assert.Equal(t, orig.LastEngaged, sub.LastEngaged)
+		assert.Equal(t, orig.LastDelivered, sub.LastDelivered)
+		assert.Equal(t, orig.ConfirmExpiry, sub.ConfirmExpiry)
+		assert.Equal(t, int64(1), sub.Version)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	setup := func() (*CommandTestFixture, *testdoubles.Database) {
+		dbase := newBackupDatabase(backupTestSubscribers())
+		f := NewCommandTestFixture(newBackupCmd(
+			func(string) db.Database { return dbase },
+		))
+		f.Cmd.SetArgs([]string{"elistman-subscribers"})
+		return f, dbase
+	}
+
+	t.Run("WritesOneJsonRecordPerLine", func(t *testing.T) {
+		f, _ := setup()
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		lines := strings.Split(strings.TrimSpace(f.Stdout.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+		assert.Equal(
+			t,
+			`{"email":"pending@example.com",`+
+				`"uid":"00000000-1111-2222-3333-444444444444",`+
+				`"status":"pending","timestamp":"2023-05-21T12:34:56Z",`+
+				`"confirmExpiry":"2023-05-21T13:34:56Z"}`,
+			lines[0],
+		)
+		assert.Assert(t, is.Contains(lines[1], `"status":"verified"`))
+	})
+
+	t.Run("FailsIfProcessingSubscribersFails", func(t *testing.T) {
+		f, dbase := setup()
+		dbase.SimulateProcSubsErr = func(string) error {
+			return errors.New("scan failed")
+		}
+
+		f.ExecuteAndAssertErrorContains(
+			t, "backup of elistman-subscribers failed: scan failed",
+		)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	setup := func(input string) (*CommandTestFixture, *testdoubles.Database) {
+		dbase := testdoubles.NewDatabase()
+		f := NewCommandTestFixture(newRestoreCmd(
+			func(string) db.Database { return dbase },
+		))
+		f.Cmd.SetArgs([]string{"elistman-subscribers"})
+		f.Cmd.SetIn(strings.NewReader(input))
+		return f, dbase
+	}
+	const validRecord = `{"email":"foo@example.com",` +
+		`"uid":"00000000-1111-2222-3333-444444444444",` +
+		`"status":"verified","timestamp":"2023-05-21T12:34:56Z"}`
+
+	t.Run("SkipsBlankLines", func(t *testing.T) {
+		f, dbase := setup("\n" + validRecord + "\n\n")
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Restored 1 subscribers to elistman-subscribers.\n",
+		)
+		assert.Equal(t, 1, len(dbase.Subscribers))
+	})
+
+	t.Run("OverwritesExistingRecords", func(t *testing.T) {
+		f, dbase := setup(validRecord)
+		existing := &db.Subscriber{
+			Email:     "foo@example.com",
+			Uid:       uuid.MustParse("55555555-6666-7777-8888-999999999999"),
+			Status:    db.SubscriberPending,
+			Timestamp: time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC),
+			Version:   4,
+		}
+		dbase.Subscribers = append(dbase.Subscribers, existing)
+		dbase.Index[existing.Email] = existing
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Restored 1 subscribers to elistman-subscribers.\n",
+		)
+		sub := dbase.Index["foo@example.com"]
+		const uid = "00000000-1111-2222-3333-444444444444"
+		assert.Equal(t, uid, sub.Uid.String())
+		assert.Equal(t, db.SubscriberVerified, sub.Status)
+		restoredAt := time.Date(2023, time.May, 21, 12, 34, 56, 0, time.UTC)
+		assert.Equal(t, restoredAt, sub.Timestamp)
+	})
+
+	t.Run("FailsWithoutWritingIfAnyRecordInvalid", func(t *testing.T) {
+		input := strings.Join([]string{
+			validRecord,
+			"not JSON",
+			strings.Replace(validRecord, "verified", "unknown", 1),
+			strings.Replace(validRecord, `"foo@example.com"`, `""`, 1),
+		}, "\n")
+		f, dbase := setup(input)
+
+		err := f.ExecuteAndAssertErrorContains(
+			t, "failed to read backup from stdin: ",
+		)
+
+		assert.ErrorContains(t, err, "line 2: invalid character")
+		assert.ErrorContains(t, err, `line 3: invalid status: "unknown"`)
+		assert.ErrorContains(t, err, "line 4: missing email")
+		assert.Equal(t, 0, len(dbase.Subscribers))
+	})
+
+	t.Run("ReportsSubscribersThatFailedToWrite", func(t *testing.T) {
+		f, dbase := setup(validRecord)
+		dbase.SimulatePutErr = func(string) error {
+			return errors.New("put failed")
+		}
+
+		f.ExecuteAndAssertErrorContains(
+			t,
+			"failed to restore the following 1 subscribers:\n"+
+				"  foo@example.com",
+		)
+	})
+}
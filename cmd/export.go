@@ -0,0 +1,175 @@
+// Copyright © 2023 Mike Bland <mbland@acm.org>
+// See LICENSE.txt for details.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mbland/elistman/db"
+	"github.com/spf13/cobra"
+)
+
+const exportDescription = `` +
+	`Writes subscribers from a DynamoDB table to CSV
+
+The command takes one argument, which is the name of the subscribers table.
+
+Writes a header row followed by one row per subscriber, containing its email
+address, UID, status, and timestamp. Exports both pending and verified
+subscribers unless --status specifies only one of them.
+
+Writes to standard output unless --output specifies a file, which the command
+will create or overwrite. Rows are written as each page of subscribers arrives
+from DynamoDB, so exporting a large list doesn't require much memory.
+
+Unlike the backup command's output, the CSV output omits the optional
+timestamps, so the restore command can't read it. It's intended for importing
+the list into other tools.
+
+To export only verified subscribers to a file:
+  elistman export --status verified --output subscribers.csv TABLE_NAME`
+
+const FlagStatus = "status"
+const FlagOutput = "output"
+
+var exportHeader = []string{"email", "uid", "status", "timestamp"}
+
+func init() {
+	rootCmd.AddCommand(newExportCmd(NewDatabase))
+}
+
+func newExportCmd(newDatabase DatabaseFactoryFunc) (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export subscribers from a DynamoDB table to CSV",
+		Long:  exportDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportSubscribers(
+				cmd,
+				newDatabase(args[0]),
+				args[0],
+				getStringFlag(cmd, FlagStatus),
+				getStringFlag(cmd, FlagOutput),
+			)
+		},
+	}
+	cmd.Flags().String(
+		FlagStatus, "",
+		`export only subscribers with this status, "pending" or "verified"`,
+	)
+	cmd.Flags().StringP(
+		FlagOutput, "o", "", "file to write instead of standard output",
+	)
+	return
+}
+
+func exportStatuses(status string) ([]db.SubscriberStatus, error) {
+	switch db.SubscriberStatus(status) {
+	case "":
+		return []db.SubscriberStatus{
+			db.SubscriberPending, db.SubscriberVerified,
+		}, nil
+	case db.SubscriberPending, db.SubscriberVerified:
+		return []db.SubscriberStatus{db.SubscriberStatus(status)}, nil
+	}
+	const errFmt = `--%s must be "%s" or "%s", got: %q`
+	return nil, fmt.Errorf(
+		errFmt, FlagStatus, db.SubscriberPending, db.SubscriberVerified, status,
+	)
+}
+
+func exportSubscribers(
+	cmd *cobra.Command,
+	dbase db.Database,
+	tableName, status, outputPath string,
+) (err error) {
+	var statuses []db.SubscriberStatus
+
+	if statuses, err = exportStatuses(status); err != nil {
+		return
+	}
+	cmd.SilenceUsage = true
+	out := cmd.OutOrStdout()
+
+	if outputPath != "" {
+		var f *os.File
+		if f, err = os.Create(outputPath); err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				const errFmt = "failed to close export file: %w"
+				err = errors.Join(err, fmt.Errorf(errFmt, closeErr))
+			}
+		}()
+		out = f
+	}
+
+	var numExported int
+	ctx, stop := shutdownContext(cmd)
+	defer stop()
+
+	numExported, err = writeCsv(ctx, out, dbase, statuses)
+	if err != nil {
+		return fmt.Errorf("export of %s failed: %w", tableName, err)
+	}
+	cmd.PrintErrf("Exported %d subscribers from %s.\n", numExported, tableName)
+	return
+}
+
+// writeCsv writes the header row, then writes and flushes the rows for each
+// page of subscribers as it arrives.
+//
+// If ctx is cancelled, e.g., by SIGINT or SIGTERM, the rows from every page
+// already received remain written.
+func writeCsv(
+	ctx context.Context,
+	out io.Writer,
+	dbase db.Database,
+	statuses []db.SubscriberStatus,
+) (numExported int, err error) {
+	w := csv.NewWriter(out)
+
+	if err = w.Write(exportHeader); err != nil {
+		return
+	}
+
+	writePage := func(page []*db.Subscriber) (bool, error) {
+		for _, sub := range page {
+			if err := w.Write(exportRow(sub)); err != nil {
+				const errFmt = "failed to write %s: %w"
+				return false, fmt.Errorf(errFmt, sub.Email, err)
+			}
+			numExported++
+		}
+		w.Flush()
+		return true, w.Error()
+	}
+
+	for _, status := range statuses {
+		err = dbase.ProcessSubscriberPages(ctx, status, writePage)
+		if err != nil {
+			return
+		}
+	}
+	w.Flush()
+	err = w.Error()
+	return
+}
+
+func exportRow(sub *db.Subscriber) []string {
+	return []string{
+		sub.Email,
+		sub.Uid.String(),
+		string(sub.Status),
+		sub.Timestamp.Format(time.RFC3339),
+	}
+}
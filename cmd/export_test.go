@@ -0,0 +1,164 @@
+//go:build small_tests || all_tests
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/db"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestExport(t *testing.T) {
+	const tableName = "elistman-subscribers"
+	const header = "email,uid,status,timestamp"
+	const pendingRow = "pending@example.com," +
+		"00000000-1111-2222-3333-444444444444,pending,2023-05-21T12:34:56Z"
+	const verifiedRow = "verified@example.com," +
+		"55555555-6666-7777-8888-999999999999,verified,2023-05-20T12:34:56Z"
+
+	setup := func(
+		t *testing.T, subs []*db.Subscriber,
+	) (*CommandTestFixture, *db.TestDynamoDbClient) {
+		t.Helper()
+		client := db.NewTestDynamoDbClient()
+		dynamo := &db.DynamoDb{Client: client, TableName: tableName}
+		failed, err := dynamo.PutBatch(context.Background(), subs)
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+
+		f := NewCommandTestFixture(newExportCmd(
+			func(string) db.Database { return dynamo },
+		))
+		f.Cmd.SetArgs([]string{tableName})
+		return f, client
+	}
+
+	t.Run("WritesHeaderAndAllSubscribers", func(t *testing.T) {
+		f, _ := setup(t, backupTestSubscribers())
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		expected := header + "\n" + pendingRow + "\n" + verifiedRow + "\n"
+		assert.Equal(t, expected, f.Stdout.String())
+		assert.Equal(
+			t,
+			"Exported 2 subscribers from "+tableName+".\n",
+			f.Stderr.String(),
+		)
+	})
+
+	t.Run("WritesOnlyHeaderIfNoSubscribers", func(t *testing.T) {
+		f, _ := setup(t, []*db.Subscriber{})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Equal(t, header+"\n", f.Stdout.String())
+	})
+
+	t.Run("QuotesFieldsAsNeeded", func(t *testing.T) {
+		sub := backupTestSubscribers()[1]
+		sub.Email = `"quoted,user"@example.com`
+		f, _ := setup(t, []*db.Subscriber{sub})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		lines := strings.Split(f.Stdout.String(), "\n")
+		expectedPrefix := `"""quoted,user""@example.com",`
+		assert.Assert(t, strings.HasPrefix(lines[1], expectedPrefix))
+	})
+
+	t.Run("RestrictsToStatus", func(t *testing.T) {
+		f, _ := setup(t, backupTestSubscribers())
+		f.Cmd.SetArgs([]string{"--status", "verified", tableName})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Equal(t, header+"\n"+verifiedRow+"\n", f.Stdout.String())
+	})
+
+	t.Run("FailsIfStatusInvalid", func(t *testing.T) {
+		f, _ := setup(t, backupTestSubscribers())
+		f.Cmd.SetArgs([]string{"--status", "unknown", tableName})
+
+		err := f.Cmd.Execute()
+
+		const expectedErr = `--status must be "pending" or "verified", ` +
+			`got: "unknown"`
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, is.Contains(f.Stdout.String(), "Usage:"))
+	})
+
+	t.Run("WritesEveryRowAcrossPages", func(t *testing.T) {
+		timestamp := time.Date(2023, time.May, 21, 12, 34, 56, 0, time.UTC)
+		uid := uuid.MustParse("00000000-1111-2222-3333-444444444444")
+		subs := make([]*db.Subscriber, 10)
+		for i := range subs {
+			subs[i] = &db.Subscriber{
+				Email:     fmt.Sprintf("foo%d@example.com", i),
+				Uid:       uid,
+				Status:    db.SubscriberVerified,
+				Timestamp: timestamp,
+			}
+		}
+		f, client := setup(t, subs)
+		client.ScanSize = 3
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		lines := strings.Split(strings.TrimSpace(f.Stdout.String()), "\n")
+		assert.Equal(t, len(subs)+1, len(lines))
+		for i, sub := range subs {
+			assert.Assert(t, strings.HasPrefix(lines[i+1], sub.Email+","))
+		}
+		// Four pages per status index, including the empty pending index.
+		assert.Equal(t, 5, client.ScanCalls)
+	})
+
+	t.Run("WritesToOutputFile", func(t *testing.T) {
+		f, _ := setup(t, backupTestSubscribers())
+		outputPath := filepath.Join(t.TempDir(), "subscribers.csv")
+		f.Cmd.SetArgs([]string{"--output", outputPath, tableName})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", f.Stdout.String())
+		data, err := os.ReadFile(outputPath)
+		assert.NilError(t, err)
+		expected := header + "\n" + pendingRow + "\n" + verifiedRow + "\n"
+		assert.Equal(t, expected, string(data))
+	})
+
+	t.Run("FailsIfOutputFileCannotBeCreated", func(t *testing.T) {
+		f, _ := setup(t, backupTestSubscribers())
+		outputPath := filepath.Join(t.TempDir(), "nonexistent", "out.csv")
+		f.Cmd.SetArgs([]string{"--output", outputPath, tableName})
+
+		f.ExecuteAndAssertErrorContains(t, "failed to create export file: ")
+	})
+
+	t.Run("FailsIfScanFails", func(t *testing.T) {
+		f, client := setup(t, backupTestSubscribers())
+		client.SetScanError("scan failed")
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "export of "+tableName+" failed: ")
+		assert.ErrorContains(t, err, "scan failed")
+		assert.Equal(t, "", f.Stdout.String())
+	})
+}
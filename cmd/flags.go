@@ -3,6 +3,7 @@ package cmd
 import "github.com/spf13/cobra"
 
 const FlagStackName = "stack-name"
+const FlagTableName = "table-name"
 
 func registerStackName(cmd *cobra.Command) {
 	cmd.Flags().StringP(
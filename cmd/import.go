@@ -6,10 +6,14 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/events"
 	"github.com/spf13/cobra"
 )
@@ -17,82 +21,339 @@ import (
 const importDescription = `` +
 	`Subscribes a list of email addresses directly without verification
 
-Reads the list of addresses from standard input, one address per line.
+Reads CSV rows of the form "email[,status]" from standard input, or from the
+file specified by --input. Skips the first row if it's a header beginning with
+"email". Imports rows without a status, or with the status "verified", as
+verified subscribers, and rejects rows with any other status.
 
 This is useful for importing a list of existing subscribers from a previous
-system. Will not import addresses that fail validation, and will not override
-records for existing verified subscribers.
-`
+system. The EListMan Lambda validates each address and imports only those that
+pass, writing each batch of up to --batch-size addresses at once. Importing an
+address that's already a verified subscriber leaves its existing record
+untouched. Importing an address that's still pending verification marks it as
+verified, keeping its existing unsubscribe ID.
+
+Malformed rows, duplicate addresses (ignoring case), and addresses failing
+validation are reported without stopping the rest of the import. The command
+prints the number of addresses accepted, rejected, and suppressed, i.e.,
+rejected because they're on the account-level suppression list. If --rejects
+specifies a file, the command writes every row not imported to it as CSV, with
+the reason why. The command exits with an error if it didn't import every row.
+
+--dry-run validates every address without importing any of them.
+--skip-validation imports every address without validating any of them, and is
+meant only for lists already known to be valid.`
+
+const FlagInput = "input"
+const FlagRejects = "rejects"
+const FlagDryRun = "dry-run"
+const FlagSkipValidation = "skip-validation"
+
+const defaultImportBatchSize = 100
+
+var importRejectsHeader = []string{"email", "reason"}
 
 func init() {
 	rootCmd.AddCommand(newImportCmd(NewEListManLambda))
 }
 
+// importOptions contains the flag values for the import command.
+type importOptions struct {
+	StackName      string
+	InputPath      string
+	RejectsPath    string
+	BatchSize      int
+	DryRun         bool
+	SkipValidation bool
+}
+
 func newImportCmd(newFunc EListManFactoryFunc) (cmd *cobra.Command) {
 	cmd = &cobra.Command{
 		Use:   "import",
 		Short: "Import existing subscribers from another system",
 		Long:  importDescription,
 		RunE: func(cmd *cobra.Command, _ []string) (err error) {
-			return importAddresses(cmd, newFunc, getStackName(cmd))
+			batchSize, _ := cmd.Flags().GetInt(FlagBatchSize)
+			dryRun, _ := cmd.Flags().GetBool(FlagDryRun)
+			skipValidation, _ := cmd.Flags().GetBool(FlagSkipValidation)
+			return importAddresses(cmd, newFunc, &importOptions{
+				StackName:      getStackName(cmd),
+				InputPath:      getStringFlag(cmd, FlagInput),
+				RejectsPath:    getStringFlag(cmd, FlagRejects),
+				BatchSize:      batchSize,
+				DryRun:         dryRun,
+				SkipValidation: skipValidation,
+			})
 		},
 	}
 	registerStackName(cmd)
 	cmd.MarkFlagRequired(FlagStackName)
+	cmd.Flags().StringP(
+		FlagInput, "i", "", "CSV file to read instead of standard input",
+	)
+	cmd.Flags().StringP(
+		FlagRejects, "r", "", "CSV file to which to write rows not imported",
+	)
+	cmd.Flags().Int(
+		FlagBatchSize, defaultImportBatchSize,
+		"number of addresses to import per Lambda invocation",
+	)
+	cmd.Flags().Bool(
+		FlagDryRun, false, "validate addresses without importing them",
+	)
+	cmd.Flags().Bool(
+		FlagSkipValidation, false, "import addresses without validating them",
+	)
 	return
 }
 
 func importAddresses(
-	cmd *cobra.Command, newFunc EListManFactoryFunc, stackName string,
+	cmd *cobra.Command, newFunc EListManFactoryFunc, opts *importOptions,
 ) (err error) {
 	cmd.SilenceUsage = true
 	var addresses []string
+	var rejects []events.ImportFailure
+	var elistmanFunc EListManFunc
 
-	if addresses, err = readLines(cmd.InOrStdin()); err != nil {
-		err = fmt.Errorf("failed to read email addresses from stdin: %w", err)
+	if opts.BatchSize <= 0 {
+		return fmt.Errorf("--%s must be greater than 0", FlagBatchSize)
+	} else if addresses, rejects, err = readImportInput(cmd, opts); err != nil {
+		return
+	} else if elistmanFunc, err = newFunc(opts.StackName); err != nil {
 		return
 	}
 
-	ctx := context.Background()
-	evt := &events.CommandLineEvent{
-		EListManCommand: events.CommandLineImportEvent,
-		Import:          &events.ImportEvent{Addresses: addresses},
+	ctx, stop := shutdownContext(cmd)
+	defer stop()
+
+	numAccepted, failures, err := importBatches(
+		ctx, elistmanFunc, addresses, opts,
+	)
+	rejects = append(rejects, failures...)
+	printImportSummary(cmd, numAccepted, rejects, opts.DryRun)
+
+	if opts.RejectsPath != "" {
+		err = errors.Join(err, writeRejects(opts.RejectsPath, rejects))
+	}
+	return errors.Join(err, errorIfImportFailures(rejects, opts.RejectsPath))
+}
+
+func readImportInput(
+	cmd *cobra.Command, opts *importOptions,
+) (addresses []string, rejects []events.ImportFailure, err error) {
+	input := cmd.InOrStdin()
+	inputName := "stdin"
+
+	if opts.InputPath != "" {
+		var f *os.File
+		if f, err = os.Open(opts.InputPath); err != nil {
+			err = fmt.Errorf("failed to open import file: %w", err)
+			return
+		}
+		defer f.Close()
+		input = f
+		inputName = opts.InputPath
 	}
-	response := &events.ImportResponse{}
 
-	if err = newFunc.Invoke(ctx, stackName, evt, response); err != nil {
-		return fmt.Errorf("import failed: %w", err)
+	if addresses, rejects, err = readImportRows(input); err != nil {
+		const errFmt = "failed to read email addresses from %s: %w"
+		err = fmt.Errorf(errFmt, inputName, err)
 	}
-	cmd.Print(importSuccessMessage(response.NumImported, len(addresses)))
-	err = errorIfImportFailures(response.Failures)
 	return
 }
 
-func readLines(stdin io.Reader) (lines []string, err error) {
-	lines = make([]string, 0, 100)
-	scanner := bufio.NewScanner(stdin)
+// readImportRows parses "email[,status]" CSV rows from input.
+//
+// It rejects malformed rows and duplicate addresses, rather than failing. err
+// is non-nil only if reading from input failed.
+func readImportRows(
+	input io.Reader,
+) (addresses []string, rejects []events.ImportFailure, err error) {
+	r := csv.NewReader(input)
+	r.FieldsPerRecord = -1
+	addressLines := map[string]int{}
+	addresses = make([]string, 0, 100)
+	rejects = []events.ImportFailure{}
 
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	for {
+		var record []string
+		var parseErr *csv.ParseError
+
+		if record, err = r.Read(); errors.Is(err, io.EOF) {
+			err = nil
+			return
+		} else if errors.As(err, &parseErr) {
+			rejects = append(rejects, events.ImportFailure{Reason: err.Error()})
+			continue
+		} else if err != nil {
+			return
+		}
+
+		line, _ := r.FieldPos(0)
+		address, reason := parseImportRow(record)
+		key := strings.ToLower(address)
+
+		if line == 1 && strings.EqualFold(address, "email") {
+			continue
+		} else if prevLine, ok := addressLines[key]; ok && reason == "" {
+			reason = fmt.Sprintf("duplicate of line %d", prevLine)
+		}
+
+		if reason != "" {
+			reason = fmt.Sprintf("line %d: %s", line, reason)
+			rejects = append(
+				rejects, events.ImportFailure{Address: address, Reason: reason},
+			)
+			continue
+		}
+		addressLines[key] = line
+		addresses = append(addresses, address)
+	}
+}
+
+func parseImportRow(record []string) (address, reason string) {
+	address = strings.TrimSpace(record[0])
+
+	if len(record) > 2 {
+		const reasonFmt = "expected email[,status], got %d fields"
+		return address, fmt.Sprintf(reasonFmt, len(record))
+	} else if address == "" {
+		return address, "missing email address"
+	} else if len(record) == 1 {
+		return
+	}
+
+	status := strings.TrimSpace(record[1])
+	if status != "" && status != string(db.SubscriberVerified) {
+		const reasonFmt = `status %q isn't "%s"`
+		reason = fmt.Sprintf(reasonFmt, status, db.SubscriberVerified)
 	}
-	err = scanner.Err()
 	return
 }
 
-func importSuccessMessage(numImported, total int) string {
-	if numImported == 1 {
-		return "Successfully imported one address.\n"
+// importBatches imports addresses in batches of opts.BatchSize.
+//
+// It stops after the first batch that fails to import, or when ctx is
+// cancelled, in which case failures doesn't include any addresses from the
+// remaining batches.
+func importBatches(
+	ctx context.Context,
+	elistmanFunc EListManFunc,
+	addresses []string,
+	opts *importOptions,
+) (numAccepted int, failures []events.ImportFailure, err error) {
+	failures = []events.ImportFailure{}
+
+	for i := 0; i < len(addresses); i += opts.BatchSize {
+		if ctx.Err() != nil {
+			const errFmt = "import interrupted after %d of %d addresses"
+			return numAccepted, failures, fmt.Errorf(errFmt, i, len(addresses))
+		}
+		end := min(i+opts.BatchSize, len(addresses))
+		evt := &events.CommandLineEvent{
+			EListManCommand: events.CommandLineImportEvent,
+			Import: &events.ImportEvent{
+				Addresses:      addresses[i:end],
+				DryRun:         opts.DryRun,
+				SkipValidation: opts.SkipValidation,
+			},
+		}
+		response := &events.ImportResponse{}
+
+		if err = elistmanFunc.Invoke(ctx, evt, response); err != nil {
+			err = fmt.Errorf("import failed: %w", err)
+			return
+		}
+		numAccepted += response.NumImported
+		failures = append(failures, response.Failures...)
+
+		if response.Details != "" {
+			err = fmt.Errorf("import failed: %s", response.Details)
+			return
+		}
+	}
+	return
+}
+
+func printImportSummary(
+	cmd *cobra.Command,
+	numAccepted int,
+	rejects []events.ImportFailure,
+	dryRun bool,
+) {
+	numSuppressed := 0
+	for _, reject := range rejects {
+		if reject.Suppressed {
+			numSuppressed++
+		}
+	}
+
+	if dryRun {
+		cmd.Println("Dry run: validated addresses without importing them.")
 	}
-	const msgFmt = "Successfully imported %d of %d addresses.\n"
-	return fmt.Sprintf(msgFmt, numImported, total)
+	cmd.Printf("Accepted: %d\n", numAccepted)
+	cmd.Printf("Rejected: %d\n", len(rejects)-numSuppressed)
+	cmd.Printf("Suppressed: %d\n", numSuppressed)
 }
 
-func errorIfImportFailures(failures []string) error {
-	if len(failures) == 0 {
+func writeRejects(
+	rejectsPath string, rejects []events.ImportFailure,
+) (err error) {
+	var f *os.File
+	if f, err = os.Create(rejectsPath); err != nil {
+		return fmt.Errorf("failed to create rejects file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			const errFmt = "failed to close rejects file: %w"
+			err = errors.Join(err, fmt.Errorf(errFmt, closeErr))
+		}
+	}()
+
+	w := csv.NewWriter(f)
+	if err = w.Write(importRejectsHeader); err != nil {
+		return
+	}
+	for _, reject := range rejects {
+		if err = w.Write([]string{reject.Address, reject.Reason}); err != nil {
+			return
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func errorIfImportFailures(
+	rejects []events.ImportFailure, rejectsPath string,
+) error {
+	if len(rejects) == 0 {
 		return nil
-	} else if len(failures) == 1 {
+	} else if rejectsPath != "" {
+		const errFmt = "failed to import %d rows; see %s"
+		return fmt.Errorf(errFmt, len(rejects), rejectsPath)
+	}
+
+	failures := make([]string, len(rejects))
+	for i, reject := range rejects {
+		failures[i] = reject.Reason
+		if reject.Address != "" {
+			failures[i] = reject.Address + ": " + reject.Reason
+		}
+	}
+	if len(failures) == 1 {
 		return fmt.Errorf("failed to import %s", failures[0])
 	}
-	const errFmt = "failed to import the following %d addresses:\n  %s"
+	const errFmt = "failed to import the following %d rows:\n  %s"
 	return fmt.Errorf(errFmt, len(failures), strings.Join(failures, "\n  "))
 }
+
+func readLines(stdin io.Reader) (lines []string, err error) {
+	lines = make([]string, 0, 100)
+	scanner := bufio.NewScanner(stdin)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	err = scanner.Err()
+	return
+}
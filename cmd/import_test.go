@@ -3,12 +3,16 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/mbland/elistman/events"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 type errReader struct {
@@ -34,74 +38,192 @@ func TestReadLines(t *testing.T) {
 	})
 }
 
-func TestImportSuccess(t *testing.T) {
-	t.Run("Singular", func(t *testing.T) {
-		msg := importSuccessMessage(1, 1000)
+func TestReadImportRows(t *testing.T) {
+	t.Run("ReadsAddressesWithOptionalHeaderAndStatus", func(t *testing.T) {
+		input := "Email,Status\n" +
+			"foo@test.com\n" +
+			"\n" +
+			" bar@test.com , verified\n" +
+			"baz@test.com,\n"
 
-		assert.Equal(t, "Successfully imported one address.\n", msg)
+		addrs, rejects, err := readImportRows(strings.NewReader(input))
+
+		assert.NilError(t, err)
+		expected := []string{"foo@test.com", "bar@test.com", "baz@test.com"}
+		assert.DeepEqual(t, expected, addrs)
+		assert.Assert(t, is.Len(rejects, 0))
+	})
+
+	t.Run("RejectsMalformedRowsWithoutAborting", func(t *testing.T) {
+		input := "foo@test.com\n" +
+			"bar@test.com,pending\n" +
+			",verified\n" +
+			"baz@test.com,verified,extra\n" +
+			"quux\"@test.com\n" +
+			"xyzzy@test.com\n"
+
+		addrs, rejects, err := readImportRows(strings.NewReader(input))
+
+		assert.NilError(t, err)
+		expected := []string{"foo@test.com", "xyzzy@test.com"}
+		assert.DeepEqual(t, expected, addrs)
+		assert.DeepEqual(
+			t,
+			[]events.ImportFailure{
+				{
+					Address: "bar@test.com",
+					Reason:  `line 2: status "pending" isn't "verified"`,
+				},
+				{Reason: "line 3: missing email address"},
+				{
+					Address: "baz@test.com",
+					Reason:  "line 4: expected email[,status], got 3 fields",
+				},
+				{
+					Reason: "parse error on line 5, column 5: " +
+						`bare " in non-quoted-field`,
+				},
+			},
+			rejects,
+		)
+	})
+
+	t.Run("RejectsDuplicateAddresses", func(t *testing.T) {
+		input := "foo@test.com\nbar@test.com\nfoo@test.com,verified\n" +
+			"Bar@Test.com\n"
+
+		addrs, rejects, err := readImportRows(strings.NewReader(input))
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []string{"foo@test.com", "bar@test.com"}, addrs)
+		assert.DeepEqual(
+			t,
+			[]events.ImportFailure{
+				{
+					Address: "foo@test.com",
+					Reason:  "line 3: duplicate of line 1",
+				},
+				{
+					Address: "Bar@Test.com",
+					Reason:  "line 4: duplicate of line 2",
+				},
+			},
+			rejects,
+		)
 	})
 
-	t.Run("Plural", func(t *testing.T) {
-		msg := importSuccessMessage(100, 1000)
+	t.Run("ReturnsReadError", func(t *testing.T) {
+		_, _, err := readImportRows(&errReader{})
 
-		assert.Equal(t, "Successfully imported 100 of 1000 addresses.\n", msg)
+		assert.Error(t, err, "test read error")
 	})
 }
 
 func TestErrorIfImportFailures(t *testing.T) {
 	t.Run("NilIfNoFailures", func(t *testing.T) {
-		assert.NilError(t, errorIfImportFailures([]string{}))
+		assert.NilError(t, errorIfImportFailures([]events.ImportFailure{}, ""))
 	})
 
 	t.Run("SingleFailure", func(t *testing.T) {
-		failures := []string{"foo@test.com: failed"}
+		failures := []events.ImportFailure{
+			{Address: "foo@test.com", Reason: "failed"},
+		}
 
-		err := errorIfImportFailures(failures)
+		err := errorIfImportFailures(failures, "")
 
 		assert.Error(t, err, "failed to import foo@test.com: failed")
 	})
 
 	t.Run("MultipleFailures", func(t *testing.T) {
-		failures := []string{
-			"foo@test.com: failed",
-			"bar@test.com: failed",
-			"baz@test.com: failed",
+		failures := []events.ImportFailure{
+			{Address: "foo@test.com", Reason: "failed"},
+			{Reason: "parse error on line 2"},
+			{Address: "baz@test.com", Reason: "suppressed", Suppressed: true},
 		}
 
-		err := errorIfImportFailures(failures)
+		err := errorIfImportFailures(failures, "")
 
-		const expectedErr = "failed to import the following 3 addresses:\n" +
+		const expectedErr = "failed to import the following 3 rows:\n" +
 			"  foo@test.com: failed\n" +
-			"  bar@test.com: failed\n" +
-			"  baz@test.com: failed"
+			"  parse error on line 2\n" +
+			"  baz@test.com: suppressed"
 		assert.Error(t, err, expectedErr)
 	})
+
+	t.Run("RefersToRejectsFile", func(t *testing.T) {
+		failures := []events.ImportFailure{
+			{Address: "foo@test.com", Reason: "failed"},
+			{Address: "bar@test.com", Reason: "failed"},
+		}
+
+		err := errorIfImportFailures(failures, "rejects.csv")
+
+		assert.Error(t, err, "failed to import 2 rows; see rejects.csv")
+	})
+}
+
+// importLambda imports every address in each request, except for those in
+// Failures.
+type importLambda struct {
+	StackName string
+	Requests  []*events.ImportEvent
+	Failures  map[string]events.ImportFailure
+	Details   string
+	Error     error
+}
+
+func (l *importLambda) GetFactoryFunc() EListManFactoryFunc {
+	return func(stackName string) (EListManFunc, error) {
+		l.StackName = stackName
+		return l, nil
+	}
+}
+
+func (l *importLambda) Invoke(_ context.Context, req, res any) error {
+	evt := req.(*events.CommandLineEvent)
+	l.Requests = append(l.Requests, evt.Import)
+
+	if l.Error != nil {
+		return l.Error
+	}
+	response := res.(*events.ImportResponse)
+	for _, addr := range evt.Import.Addresses {
+		if failure, ok := l.Failures[addr]; ok {
+			response.Failures = append(response.Failures, failure)
+		} else {
+			response.NumImported++
+		}
+	}
+	response.Details = l.Details
+	return nil
 }
 
 func TestImport(t *testing.T) {
 	addrs := []string{"foo@test.com", "bar@test.com", "baz@test.com"}
 
-	setup := func() (f *CommandTestFixture, lambda *TestEListManFunc) {
-		lambda = NewTestEListManFunc()
+	setup := func() (f *CommandTestFixture, lambda *importLambda) {
+		lambda = &importLambda{}
 		f = NewCommandTestFixture(newImportCmd(lambda.GetFactoryFunc()))
 		f.Cmd.SetIn(strings.NewReader(strings.Join(addrs, "\n")))
 		f.Cmd.SetArgs([]string{"-s", TestStackName})
 		return
 	}
 
+	summary := func(accepted, rejected, suppressed string) string {
+		return "Accepted: " + accepted + "\n" +
+			"Rejected: " + rejected + "\n" +
+			"Suppressed: " + suppressed + "\n"
+	}
+
 	t.Run("Succeeds", func(t *testing.T) {
 		f, lambda := setup()
-		lambda.SetResponseJson(`{"NumImported": 3}`)
 
-		const expectedOut = "Successfully imported 3 of 3 addresses.\n"
-		f.ExecuteAndAssertStdoutContains(t, expectedOut)
+		f.ExecuteAndAssertStdoutContains(t, summary("3", "0", "0"))
 
 		assert.Assert(t, f.Cmd.SilenceUsage == true)
-		expectedReq := &events.CommandLineEvent{
-			EListManCommand: events.CommandLineImportEvent,
-			Import:          &events.ImportEvent{Addresses: addrs},
-		}
-		lambda.AssertMatches(t, TestStackName, expectedReq)
+		assert.Equal(t, TestStackName, lambda.StackName)
+		expectedReqs := []*events.ImportEvent{{Addresses: addrs}}
+		assert.DeepEqual(t, expectedReqs, lambda.Requests)
 	})
 
 	t.Run("RequiresStackNameFlag", func(t *testing.T) {
@@ -109,6 +231,15 @@ func TestImport(t *testing.T) {
 		f.AssertFailsIfRequiredFlagMissing(t, FlagStackName, []string{})
 	})
 
+	t.Run("FailsIfBatchSizeInvalid", func(t *testing.T) {
+		f, lambda := setup()
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "--batch-size", "0"})
+
+		f.ExecuteAndAssertErrorContains(t, "--batch-size must be greater")
+
+		assert.Equal(t, 0, len(lambda.Requests))
+	})
+
 	t.Run("FailsIfCannotReadAddressesFromStdin", func(t *testing.T) {
 		f, _ := setup()
 		f.Cmd.SetIn(&errReader{})
@@ -118,28 +249,139 @@ func TestImport(t *testing.T) {
 		f.ExecuteAndAssertErrorContains(t, expectedErr)
 	})
 
+	t.Run("ReadsInputFile", func(t *testing.T) {
+		f, lambda := setup()
+		input := filepath.Join(t.TempDir(), "subscribers.csv")
+		data := "email,status\nfoo@test.com,verified\nbar@test.com\n"
+		assert.NilError(t, os.WriteFile(input, []byte(data), 0600))
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "-i", input})
+
+		f.ExecuteAndAssertStdoutContains(t, summary("2", "0", "0"))
+
+		expectedReqs := []*events.ImportEvent{
+			{Addresses: []string{"foo@test.com", "bar@test.com"}},
+		}
+		assert.DeepEqual(t, expectedReqs, lambda.Requests)
+	})
+
+	t.Run("FailsIfInputFileMissing", func(t *testing.T) {
+		f, lambda := setup()
+		input := filepath.Join(t.TempDir(), "nonexistent.csv")
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "-i", input})
+
+		f.ExecuteAndAssertErrorContains(t, "failed to open import file: ")
+
+		assert.Equal(t, 0, len(lambda.Requests))
+	})
+
+	t.Run("ImportsInBatches", func(t *testing.T) {
+		f, lambda := setup()
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "--batch-size", "2"})
+
+		f.ExecuteAndAssertStdoutContains(t, summary("3", "0", "0"))
+
+		expectedReqs := []*events.ImportEvent{
+			{Addresses: addrs[:2]}, {Addresses: addrs[2:]},
+		}
+		assert.DeepEqual(t, expectedReqs, lambda.Requests)
+	})
+
+	t.Run("PassesDryRunAndSkipValidation", func(t *testing.T) {
+		f, lambda := setup()
+		f.Cmd.SetArgs([]string{
+			"-s", TestStackName, "--dry-run", "--skip-validation",
+		})
+
+		f.ExecuteAndAssertStdoutContains(
+			t,
+			"Dry run: validated addresses without importing them.\n"+
+				summary("3", "0", "0"),
+		)
+
+		expectedReqs := []*events.ImportEvent{
+			{Addresses: addrs, DryRun: true, SkipValidation: true},
+		}
+		assert.DeepEqual(t, expectedReqs, lambda.Requests)
+	})
+
+	t.Run("ReportsRejectsWithoutAbortingImport", func(t *testing.T) {
+		f, lambda := setup()
+		input := strings.Join(addrs, "\n") + "\nfoo@test.com\nbad,row,here\n"
+		f.Cmd.SetIn(strings.NewReader(input))
+		rejectsPath := filepath.Join(t.TempDir(), "rejects.csv")
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "-r", rejectsPath})
+		lambda.Failures = map[string]events.ImportFailure{
+			"foo@test.com": {
+				Address: "foo@test.com", Reason: "suppressed", Suppressed: true,
+			},
+			"baz@test.com": {Address: "baz@test.com", Reason: "invalid domain"},
+		}
+
+		err := f.Cmd.Execute()
+
+		assert.Error(t, err, "failed to import 4 rows; see "+rejectsPath)
+		assert.Equal(t, summary("1", "3", "1"), f.Stdout.String())
+		data, err := os.ReadFile(rejectsPath)
+		assert.NilError(t, err)
+		const expectedRejects = "email,reason\n" +
+			"foo@test.com,line 4: duplicate of line 1\n" +
+			"bad,\"line 5: expected email[,status], got 3 fields\"\n" +
+			"foo@test.com,suppressed\n" +
+			"baz@test.com,invalid domain\n"
+		assert.Equal(t, expectedRejects, string(data))
+	})
+
+	t.Run("FailsIfCannotWriteRejectsFile", func(t *testing.T) {
+		f, _ := setup()
+		rejectsPath := filepath.Join(t.TempDir(), "nonexistent", "rejects.csv")
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "-r", rejectsPath})
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "failed to create rejects file: ")
+	})
+
 	t.Run("FailsIfInvokingLambdaFails", func(t *testing.T) {
 		f, lambda := setup()
-		f.AssertReturnsLambdaError(t, lambda, "import failed: ")
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "--batch-size", "2"})
+		lambda.Error = errors.New("invoke failed")
+
+		err := f.Cmd.Execute()
+
+		assert.Error(t, err, "import failed: invoke failed")
+		assert.Equal(t, summary("0", "0", "0"), f.Stdout.String())
+		assert.Equal(t, 1, len(lambda.Requests))
 	})
 
-	t.Run("FailsIfFailedToImportAnyAddresses", func(t *testing.T) {
+	t.Run("StopsIfBatchFailsToImport", func(t *testing.T) {
 		f, lambda := setup()
-		lambda.SetResponseJson(`{
-			"NumImported": 1,
-			"Failures": [
-				"foo@text.com: first error",
-				"baz@text.com: second error"
-			]
-		}`)
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "--batch-size", "2"})
+		lambda.Details = "import failed: test error"
 
 		err := f.Cmd.Execute()
 
-		const expectedStdout = "Successfully imported one address.\n"
-		const expectedErr = "failed to import the following 2 addresses:\n" +
-			"  foo@text.com: first error\n" +
-			"  baz@text.com: second error"
-		assert.Equal(t, expectedStdout, f.Stdout.String())
-		assert.ErrorContains(t, err, expectedErr)
+		assert.Error(t, err, "import failed: import failed: test error")
+		assert.Equal(t, 1, len(lambda.Requests))
+	})
+
+	t.Run("StopsIfInterrupted", func(t *testing.T) {
+		f, lambda := setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := f.Cmd.ExecuteContext(ctx)
+
+		assert.Error(t, err, "import interrupted after 0 of 3 addresses")
+		assert.Equal(t, 0, len(lambda.Requests))
+	})
+
+	t.Run("FailsIfLambdaNotFound", func(t *testing.T) {
+		lambda := NewTestEListManFunc()
+		lambda.CreateFuncError = errors.New("lambda not found")
+		f := NewCommandTestFixture(newImportCmd(lambda.GetFactoryFunc()))
+		f.Cmd.SetIn(strings.NewReader(strings.Join(addrs, "\n")))
+		f.Cmd.SetArgs([]string{"-s", TestStackName})
+
+		f.ExecuteAndAssertErrorContains(t, "lambda not found")
 	})
 }
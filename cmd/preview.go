@@ -4,9 +4,13 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/mbland/elistman/email"
 	"github.com/spf13/cobra"
 )
@@ -17,7 +21,59 @@ const previewDescription = `` +
 ` + email.ExampleMessageJson + `
 
 If the input passes validation, it then emits a raw email message to standard
-output representing what would be sent to each mailing list member.`
+output representing what would be sent to each mailing list member.
+
+Instead of reading standard input, the command builds the message from the
+--from, --subject, --text-body, --text-footer, --html-body, and --html-footer
+flags if any of them are specified.
+
+The --subscriber and --uid flags specify the sample subscriber receiving the
+message. For the headers, encoding, and footer URLs to match those of messages
+actually sent, the remaining flags should match the EListMan stack's
+configuration:
+
+  --unsubscribe-email    UNSUBSCRIBE_USER_NAME@EMAIL_DOMAIN_NAME
+  --unsubscribe-url      https://EMAIL_DOMAIN_NAME/UNSUBSCRIBE_FORM_PATH
+  --api-base-url         https://API_DOMAIN_NAME/API_MAPPING_KEY
+  --email-domain-name    EMAIL_DOMAIN_NAME
+  --list-help-url        LIST_HELP_URL
+  --list-subscribe-url   LIST_SUBSCRIBE_URL
+  --base64-max-qp-ratio  BASE64_MAX_QP_RATIO
+  --base64-max-qp-size   BASE64_MAX_QP_SIZE
+
+The defaults for the first four are placeholder examples. The rest default to
+the stack's defaults. The Message-ID header will differ from that of any
+message actually sent, since every send generates a new one.
+
+To write the preview to a file instead of standard output, use --output.`
+
+const FlagFrom = "from"
+const FlagSubject = "subject"
+const FlagTextBody = "text-body"
+const FlagTextFooter = "text-footer"
+const FlagHtmlBody = "html-body"
+const FlagHtmlFooter = "html-footer"
+const FlagSubscriber = "subscriber"
+const FlagUid = "uid"
+const FlagUnsubscribeEmail = "unsubscribe-email"
+const FlagUnsubscribeUrl = "unsubscribe-url"
+const FlagApiBaseUrl = "api-base-url"
+const FlagEmailDomainName = "email-domain-name"
+const FlagListHelpUrl = "list-help-url"
+const FlagListSubscribeUrl = "list-subscribe-url"
+const FlagBase64MaxQpRatio = "base64-max-qp-ratio"
+const FlagBase64MaxQpSize = "base64-max-qp-size"
+
+// previewMessageFlags are the flags that build the message instead of reading
+// it from standard input.
+var previewMessageFlags = []string{
+	FlagFrom,
+	FlagSubject,
+	FlagTextBody,
+	FlagTextFooter,
+	FlagHtmlBody,
+	FlagHtmlFooter,
+}
 
 func newPreviewCommand() *cobra.Command {
 	var emitExample bool
@@ -26,22 +82,166 @@ func newPreviewCommand() *cobra.Command {
 		Use:   "preview",
 		Short: "Preview a raw email message without sending it",
 		Long:  previewDescription,
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			cmd.SilenceUsage = true
-			var input io.Reader = cmd.InOrStdin()
-			if emitExample {
-				input = strings.NewReader(email.ExampleMessageJson)
+			var msg *email.Message
+			var recipient *email.Recipient
+
+			if msg, err = previewMessage(cmd, emitExample); err != nil {
+				return
+			} else if recipient, err = previewRecipient(cmd); err != nil {
+				return
 			}
-			return email.EmitPreviewMessageFromJson(input, cmd.OutOrStdout())
+			return emitPreview(cmd, msg, recipient)
 		},
 	}
 	previewCmd.Flags().BoolVarP(
 		&emitExample, "example", "x", false,
 		"Use the help example to generate the preview",
 	)
+
+	flags := previewCmd.Flags()
+	flags.String(FlagFrom, "", "message From address")
+	flags.String(FlagSubject, "", "message subject")
+	flags.String(FlagTextBody, "", "plain text message body")
+	flags.String(
+		FlagTextFooter, "",
+		"plain text footer containing "+email.UnsubscribeUrlTemplate,
+	)
+	flags.String(FlagHtmlBody, "", "HTML message body")
+	flags.String(
+		FlagHtmlFooter, "",
+		"HTML footer containing "+email.UnsubscribeUrlTemplate,
+	)
+	flags.String(
+		FlagSubscriber, email.ExampleRecipientEmail,
+		"email address of the sample subscriber",
+	)
+	flags.String(
+		FlagUid, email.ExampleRecipientUid, "UID of the sample subscriber",
+	)
+	flags.String(
+		FlagUnsubscribeEmail, email.ExampleUnsubscribeEmail,
+		"address receiving mailto: unsubscribe requests",
+	)
+	flags.String(
+		FlagUnsubscribeUrl, email.ExampleUnsubscribeUrl,
+		"URL of the unsubscribe form",
+	)
+	flags.String(
+		FlagApiBaseUrl, email.ExampleApiBaseUrl,
+		"base URL of the EListMan API, for one click unsubscribe",
+	)
+	flags.String(
+		FlagEmailDomainName, email.ExampleEmailDomainName,
+		"domain of the Message-ID header",
+	)
+	flags.String(FlagListHelpUrl, "", "URL of the List-Help header")
+	flags.String(FlagListSubscribeUrl, "", "URL of the List-Subscribe header")
+	flags.Float64(
+		FlagBase64MaxQpRatio, 0,
+		"quoted-printable to body size ratio above which to use base64",
+	)
+	flags.Int(
+		FlagBase64MaxQpSize, 0,
+		"quoted-printable body size above which to use base64",
+	)
+	flags.StringP(
+		FlagOutput, "o", "", "file to write instead of standard output",
+	)
 	return previewCmd
 }
 
 func init() {
 	rootCmd.AddCommand(newPreviewCommand())
 }
+
+func previewMessage(
+	cmd *cobra.Command, emitExample bool,
+) (*email.Message, error) {
+	fromFlags := false
+	for _, name := range previewMessageFlags {
+		fromFlags = fromFlags || cmd.Flags().Changed(name)
+	}
+
+	if fromFlags && emitExample {
+		const errFmt = "can't specify --example with any of: --%s"
+		return nil, fmt.Errorf(
+			errFmt, strings.Join(previewMessageFlags, ", --"),
+		)
+	} else if !fromFlags {
+		var input io.Reader = cmd.InOrStdin()
+		if emitExample {
+			input = strings.NewReader(email.ExampleMessageJson)
+		}
+		return email.NewMessageFromJson(input)
+	}
+
+	msg := &email.Message{
+		From:       getStringFlag(cmd, FlagFrom),
+		Subject:    getStringFlag(cmd, FlagSubject),
+		TextBody:   getStringFlag(cmd, FlagTextBody),
+		TextFooter: getStringFlag(cmd, FlagTextFooter),
+		HtmlBody:   getStringFlag(cmd, FlagHtmlBody),
+		HtmlFooter: getStringFlag(cmd, FlagHtmlFooter),
+	}
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func previewRecipient(cmd *cobra.Command) (*email.Recipient, error) {
+	uid, err := uuid.Parse(getStringFlag(cmd, FlagUid))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", FlagUid, err)
+	}
+
+	r := &email.Recipient{Email: getStringFlag(cmd, FlagSubscriber), Uid: uid}
+	r.SetUnsubscribeInfo(
+		getStringFlag(cmd, FlagUnsubscribeEmail),
+		getStringFlag(cmd, FlagUnsubscribeUrl),
+		getStringFlag(cmd, FlagApiBaseUrl),
+	)
+	return r, nil
+}
+
+func emitPreview(
+	cmd *cobra.Command, msg *email.Message, recipient *email.Recipient,
+) (err error) {
+	out := cmd.OutOrStdout()
+
+	if outputPath := getStringFlag(cmd, FlagOutput); outputPath != "" {
+		var f *os.File
+		if f, err = os.Create(outputPath); err != nil {
+			return fmt.Errorf("failed to create preview file: %w", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				const errFmt = "failed to close preview file: %w"
+				err = errors.Join(err, fmt.Errorf(errFmt, closeErr))
+			}
+		}()
+		out = f
+	}
+	return email.EmitPreviewMessage(
+		out, msg, recipient, previewTemplateOptions(cmd)...,
+	)
+}
+
+// previewTemplateOptions returns the same options that ProdAgent uses to send
+// msg to the list.
+func previewTemplateOptions(cmd *cobra.Command) []email.MessageTemplateOption {
+	flags := cmd.Flags()
+	maxQpRatio, _ := flags.GetFloat64(FlagBase64MaxQpRatio)
+	maxQpSize, _ := flags.GetInt(FlagBase64MaxQpSize)
+	prodOpts := &email.ProdMessageOptions{
+		DomainName:       getStringFlag(cmd, FlagEmailDomainName),
+		Base64MaxQpRatio: maxQpRatio,
+		Base64MaxQpSize:  maxQpSize,
+	}
+	return prodOpts.TemplateOptions(email.WithListHeaders(
+		getStringFlag(cmd, FlagListHelpUrl),
+		getStringFlag(cmd, FlagListSubscribeUrl),
+	))
+}
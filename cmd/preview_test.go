@@ -3,13 +3,28 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/mbland/elistman/email"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
+// previewMessageId replaces the random UUID of each preview's Message-ID.
+const previewMessageId = "MESSAGE-ID"
+
+var messageIdUuid = regexp.MustCompile(`(Message-ID: <)[0-9a-f-]{36}@`)
+
+func maskMessageId(preview string) string {
+	return messageIdUuid.ReplaceAllString(
+		preview, "${1}"+previewMessageId+"@",
+	)
+}
+
 func TestPreview(t *testing.T) {
 	setup := func() *CommandTestFixture {
 		return NewCommandTestFixture(newPreviewCommand())
@@ -39,4 +54,127 @@ func TestPreview(t *testing.T) {
 		const expectedMsg = "failed to parse message input from JSON: "
 		f.ExecuteAndAssertErrorContains(t, expectedMsg)
 	})
+	recipientArgs := []string{
+		"--subscriber", "reader@example.com",
+		"--uid", "55555555-6666-7777-8888-999999999999",
+		"--unsubscribe-email", "unsubscribe@example.com",
+		"--unsubscribe-url", "https://example.com/unsubscribe",
+		"--api-base-url", "https://api.example.com/email/",
+		"--email-domain-name", "example.com",
+		"--list-help-url", "https://example.com/help",
+	}
+	messageArgs := []string{
+		"--from", "EListMan <updates@example.com>",
+		"--subject", "Preview test",
+		"--text-body", "Café prices rose by 1 € = 5%.\n" +
+			"This line is long enough that quoted-printable encoding " +
+			"must wrap it with a soft line break.",
+		"--text-footer", "Unsubscribe: " + email.UnsubscribeUrlTemplate,
+	}
+	const expectedPreview = "From: EListMan <updates@example.com>\r\n" +
+		"To: reader@example.com\r\n" +
+		"Message-ID: <" + previewMessageId + "@example.com>\r\n" +
+		"Subject: Preview test\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"List-Unsubscribe: <mailto:unsubscribe@example.com" +
+		"?subject=reader%40example.com%20" +
+		"55555555-6666-7777-8888-999999999999>,\r\n" +
+		" <https://api.example.com/email/unsubscribe/reader@example.com/" +
+		"55555555-6666-7777-8888-999999999999>\r\n" +
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n" +
+		"List-Help: <https://example.com/help>\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 prices rose by 1 =E2=82=AC =3D 5%.\r\n" +
+		"This line is long enough that quoted-printable encoding must " +
+		"wrap it with a=\r\n" +
+		" soft line break.\r\n" +
+		"Unsubscribe: https://example.com/unsubscribe" +
+		"?email=3Dreader%40example.com&u=\r\n" +
+		"id=3D55555555-6666-7777-8888-999999999999"
+
+	t.Run("RendersMessageFromFlagsForSampleSubscriber", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs(append(messageArgs, recipientArgs...))
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Equal(t, expectedPreview, maskMessageId(f.Stdout.String()))
+	})
+
+	t.Run("KeepsUrlsThatFitOnOneLineIntact", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs([]string{
+			"--from", "EListMan <updates@x.co>",
+			"--subject", "Preview test",
+			"--text-body", "Hello, World!",
+			"--text-footer", "Unsubscribe: " + email.UnsubscribeUrlTemplate,
+			"--subscriber", "a@x.co",
+			"--uid", "55555555-6666-7777-8888-999999999999",
+			"--unsubscribe-url", "https://x.co/u",
+		})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Contains(
+			f.Stdout.String(),
+			"Unsubscribe: =\r\nhttps://x.co/u?email=3Da%40x.co&"+
+				"uid=3D55555555-6666-7777-8888-999999999999",
+		))
+	})
+
+	t.Run("WritesPreviewToFile", func(t *testing.T) {
+		f := setup()
+		outputPath := filepath.Join(t.TempDir(), "preview.eml")
+		args := append([]string{"-o", outputPath}, messageArgs...)
+		f.Cmd.SetArgs(append(args, recipientArgs...))
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", f.Stdout.String())
+		data, err := os.ReadFile(outputPath)
+		assert.NilError(t, err)
+		assert.Equal(t, expectedPreview, maskMessageId(string(data)))
+	})
+
+	t.Run("FailsIfFlagMessageFailsValidation", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs([]string{"--subject", "Preview test"})
+
+		err := f.ExecuteAndAssertErrorContains(t, "message failed validation")
+
+		assert.ErrorContains(t, err, "missing From")
+	})
+
+	t.Run("FailsIfExampleAndMessageFlagsBothSpecified", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs([]string{"--example", "--subject", "Preview test"})
+
+		f.ExecuteAndAssertErrorContains(t, "can't specify --example with")
+	})
+
+	t.Run("FailsIfUidInvalid", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs([]string{"--example", "--uid", "not-a-uid"})
+
+		f.ExecuteAndAssertErrorContains(t, "invalid --uid: ")
+	})
+
+	t.Run("UsesExampleRecipientByDefault", func(t *testing.T) {
+		f := setup()
+		f.Cmd.SetArgs([]string{"--example"})
+
+		err := f.Cmd.Execute()
+
+		assert.NilError(t, err)
+		expectedTo := "To: " + email.ExampleRecipientEmail + "\r\n"
+		assert.Assert(t, is.Contains(f.Stdout.String(), expectedTo))
+		assert.Assert(t, is.Contains(
+			f.Stdout.String(), email.ExampleUnsubscribeEmail,
+		))
+	})
 }
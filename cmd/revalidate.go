@@ -0,0 +1,201 @@
+// Copyright © 2023 Mike Bland <mbland@acm.org>
+// See LICENSE.txt for details.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/mbland/elistman/events"
+	"github.com/spf13/cobra"
+)
+
+const revalidateDescription = `` +
+	`Validates every verified subscriber's address again, removing failures
+
+Addresses can become undeliverable long after subscribers verify them, when
+domains expire or lose their mail servers. This command sweeps through all
+verified subscribers in batches, validating each address again and removing
+every subscriber whose address now fails validation. Addresses are only added
+to the account-level suppression list when all of their domain's mail servers
+fail validation, just as they would be at signup.
+
+DNS lookups that time out don't prove an address is invalid, so they stop the
+sweep with an error instead of removing the subscriber.
+
+The --rate flag limits how many addresses the EListMan Lambda validates per
+second, to avoid overwhelming DNS resolvers. The --batch-size flag sets how many
+subscribers each Lambda invocation validates, and should be small enough that
+each batch completes within the Lambda's timeout at the given rate.
+
+After each batch, the command writes its progress to the --checkpoint file. If
+the command fails or is interrupted, running it again with the same checkpoint
+file resumes the sweep from the last completed batch. The command removes the
+checkpoint file once the sweep is complete.
+
+Upon receiving SIGINT or SIGTERM, the command stops after saving the checkpoint
+from the last batch. If the EListMan Lambda stops partway through a batch to
+avoid exceeding its timeout, the command saves a checkpoint after the last
+subscriber the Lambda validated.`
+
+const FlagCheckpoint = "checkpoint"
+const FlagBatchSize = "batch-size"
+const FlagRate = "rate"
+
+const defaultRevalidateCheckpoint = "elistman-revalidate.checkpoint"
+const defaultRevalidateBatchSize = 100
+const defaultRevalidateRate = 5.0
+
+func init() {
+	rootCmd.AddCommand(newRevalidateCmd(NewEListManLambda))
+}
+
+func newRevalidateCmd(newFunc EListManFactoryFunc) (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "revalidate",
+		Short: "Remove verified subscribers whose addresses no longer validate",
+		Long:  revalidateDescription,
+		RunE: func(cmd *cobra.Command, _ []string) (err error) {
+			batchSize, _ := cmd.Flags().GetInt(FlagBatchSize)
+			rate, _ := cmd.Flags().GetFloat64(FlagRate)
+			return revalidateSubscribers(
+				cmd,
+				newFunc,
+				getStackName(cmd),
+				getStringFlag(cmd, FlagCheckpoint),
+				batchSize,
+				rate,
+			)
+		},
+	}
+	registerStackName(cmd)
+	cmd.MarkFlagRequired(FlagStackName)
+	cmd.Flags().StringP(
+		FlagCheckpoint, "c", defaultRevalidateCheckpoint,
+		"file recording progress, used to resume an interrupted sweep",
+	)
+	cmd.Flags().Int(
+		FlagBatchSize, defaultRevalidateBatchSize,
+		"number of subscribers to validate per Lambda invocation",
+	)
+	cmd.Flags().Float64(
+		FlagRate, defaultRevalidateRate,
+		"maximum number of subscribers to validate per second",
+	)
+	return
+}
+
+func revalidateSubscribers(
+	cmd *cobra.Command,
+	newFunc EListManFactoryFunc,
+	stackName string,
+	checkpoint string,
+	batchSize int,
+	rate float64,
+) (err error) {
+	cmd.SilenceUsage = true
+	var startKey string
+	var elistmanFunc EListManFunc
+
+	if batchSize <= 0 {
+		return fmt.Errorf("--%s must be greater than 0", FlagBatchSize)
+	} else if startKey, err = readCheckpoint(checkpoint); err != nil {
+		return
+	} else if elistmanFunc, err = newFunc(stackName); err != nil {
+		return
+	} else if startKey != "" {
+		cmd.Printf("Resuming from checkpoint: %s\n", checkpoint)
+	}
+
+	ctx, stop := shutdownContext(cmd)
+	defer stop()
+	numValidated := 0
+	numRemoved := 0
+
+	for {
+		if ctx.Err() != nil {
+			const errFmt = "revalidation interrupted after validating %d " +
+				"subscribers and removing %d; run again to resume from " +
+				"checkpoint: %s"
+			return fmt.Errorf(errFmt, numValidated, numRemoved, checkpoint)
+		}
+		evt := &events.CommandLineEvent{
+			EListManCommand: events.CommandLineRevalidateEvent,
+			Revalidate: &events.RevalidateEvent{
+				StartKey: startKey, MaxSubscribers: batchSize, Rate: rate,
+			},
+		}
+		response := &events.RevalidateResponse{}
+
+		if err = elistmanFunc.Invoke(ctx, evt, response); err != nil {
+			return fmt.Errorf("revalidation failed: %w", err)
+		}
+		for _, removed := range response.Removed {
+			cmd.Printf("Removed %s\n", removed)
+		}
+		numValidated += response.NumValidated
+		numRemoved += len(response.Removed)
+
+		if !response.Success {
+			return revalidationFailed(checkpoint, startKey, response)
+		} else if startKey = response.NextStartKey; startKey == "" {
+			break
+		} else if err = writeCheckpoint(checkpoint, startKey); err != nil {
+			return
+		}
+	}
+
+	if err = removeCheckpoint(checkpoint); err != nil {
+		return
+	}
+	const msgFmt = "Validated %d subscribers and removed %d.\n"
+	cmd.Printf(msgFmt, numValidated, numRemoved)
+	return
+}
+
+// revalidationFailed saves the response's NextStartKey if it advanced beyond
+// startKey, meaning the batch failed after validating some subscribers.
+func revalidationFailed(
+	checkpoint, startKey string, response *events.RevalidateResponse,
+) error {
+	err := fmt.Errorf("revalidation failed: %s", response.Details)
+	if next := response.NextStartKey; next != "" && next != startKey {
+		err = errors.Join(err, writeCheckpoint(checkpoint, next))
+	}
+	return err
+}
+
+func readCheckpoint(checkpoint string) (startKey string, err error) {
+	var data []byte
+
+	data, err = os.ReadFile(checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("failed to read checkpoint: %w", err)
+	} else {
+		startKey = strings.TrimSpace(string(data))
+	}
+	return
+}
+
+func writeCheckpoint(checkpoint, startKey string) (err error) {
+	if err = os.WriteFile(checkpoint, []byte(startKey+"\n"), 0600); err != nil {
+		err = fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return
+}
+
+func removeCheckpoint(checkpoint string) (err error) {
+	err = os.Remove(checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return
+}
@@ -0,0 +1,206 @@
+//go:build small_tests || all_tests
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbland/elistman/events"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// revalidateLambda returns each of its responses in order, one per Invoke.
+type revalidateLambda struct {
+	StackName string
+	Requests  []*events.RevalidateEvent
+	Responses []*events.RevalidateResponse
+	Error     error
+
+	// AfterInvoke, if not nil, runs after each successful Invoke.
+	AfterInvoke func()
+}
+
+func (l *revalidateLambda) GetFactoryFunc() EListManFactoryFunc {
+	return func(stackName string) (EListManFunc, error) {
+		l.StackName = stackName
+		return l, nil
+	}
+}
+
+func (l *revalidateLambda) Invoke(_ context.Context, req, res any) error {
+	evt := req.(*events.CommandLineEvent)
+	l.Requests = append(l.Requests, evt.Revalidate)
+
+	if l.Error != nil {
+		return l.Error
+	}
+	next := l.Responses[0]
+	l.Responses = l.Responses[1:]
+	resJson, err := json.Marshal(next)
+	if err != nil {
+		return err
+	} else if err = json.Unmarshal(resJson, res); err != nil {
+		return err
+	}
+	if l.AfterInvoke != nil {
+		l.AfterInvoke()
+	}
+	return nil
+}
+
+func TestRevalidate(t *testing.T) {
+	setup := func(
+		t *testing.T, responses ...*events.RevalidateResponse,
+	) (*CommandTestFixture, *revalidateLambda, string) {
+		lambda := &revalidateLambda{Responses: responses}
+		f := NewCommandTestFixture(newRevalidateCmd(lambda.GetFactoryFunc()))
+		checkpoint := filepath.Join(t.TempDir(), "revalidate.checkpoint")
+		f.Cmd.SetArgs([]string{
+			"-s", TestStackName, "-c", checkpoint, "--batch-size", "2",
+		})
+		return f, lambda, checkpoint
+	}
+
+	readCheckpointFile := func(t *testing.T, checkpoint string) string {
+		t.Helper()
+		data, err := os.ReadFile(checkpoint)
+		assert.NilError(t, err)
+		return string(data)
+	}
+
+	firstBatch := &events.RevalidateResponse{
+		Success:      true,
+		NumValidated: 2,
+		Removed:      []string{"foo@bad.example.com: no MX records"},
+		NextStartKey: "batch-2",
+	}
+	lastBatch := &events.RevalidateResponse{
+		Success: true, NumValidated: 1, Removed: []string{},
+	}
+
+	t.Run("FailsIfStackNameMissing", func(t *testing.T) {
+		f, _, _ := setup(t)
+
+		f.AssertFailsIfRequiredFlagMissing(t, FlagStackName, []string{})
+	})
+
+	t.Run("FailsIfBatchSizeInvalid", func(t *testing.T) {
+		f, lambda, _ := setup(t)
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "--batch-size", "0"})
+
+		f.ExecuteAndAssertErrorContains(t, "--batch-size must be greater")
+
+		assert.Equal(t, 0, len(lambda.Requests))
+	})
+
+	t.Run("SweepsAllBatchesAndRemovesCheckpoint", func(t *testing.T) {
+		f, lambda, checkpoint := setup(t, firstBatch, lastBatch)
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Validated 3 subscribers and removed 1.\n",
+		)
+
+		assert.Equal(t, TestStackName, lambda.StackName)
+		assert.DeepEqual(
+			t,
+			[]*events.RevalidateEvent{
+				{StartKey: "", MaxSubscribers: 2, Rate: defaultRevalidateRate},
+				{
+					StartKey:       "batch-2",
+					MaxSubscribers: 2,
+					Rate:           defaultRevalidateRate,
+				},
+			},
+			lambda.Requests,
+		)
+		assert.Assert(t, is.Contains(
+			f.Stdout.String(), "Removed foo@bad.example.com: no MX records\n",
+		))
+		_, err := os.Stat(checkpoint)
+		assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("ResumesFromCheckpoint", func(t *testing.T) {
+		f, lambda, checkpoint := setup(t, lastBatch)
+		assert.NilError(t, os.WriteFile(checkpoint, []byte("batch-2\n"), 0600))
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Resuming from checkpoint: "+checkpoint+"\n",
+		)
+
+		assert.Equal(t, 1, len(lambda.Requests))
+		assert.Equal(t, "batch-2", lambda.Requests[0].StartKey)
+	})
+
+	t.Run("SavesCheckpointIfBatchFails", func(t *testing.T) {
+		failedBatch := &events.RevalidateResponse{
+			Success:      false,
+			Removed:      []string{},
+			NextStartKey: "batch-2",
+			Details:      "revalidation failed: db error",
+		}
+		f, _, checkpoint := setup(t, firstBatch, failedBatch)
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "revalidation failed: db error")
+		assert.Equal(t, "batch-2\n", readCheckpointFile(t, checkpoint))
+	})
+
+	t.Run("SavesPartialProgressIfBatchFails", func(t *testing.T) {
+		partialBatch := &events.RevalidateResponse{
+			Success:      false,
+			NumValidated: 1,
+			Removed:      []string{},
+			NextStartKey: "batch-2-partial",
+			Details:      "revalidation interrupted: context deadline exceeded",
+		}
+		f, _, checkpoint := setup(t, firstBatch, partialBatch)
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "revalidation interrupted: ")
+		assert.Equal(t, "batch-2-partial\n", readCheckpointFile(t, checkpoint))
+	})
+
+	t.Run("StopsAndSavesCheckpointIfInterrupted", func(t *testing.T) {
+		f, lambda, checkpoint := setup(t, firstBatch, lastBatch)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		lambda.AfterInvoke = cancel
+
+		err := f.Cmd.ExecuteContext(ctx)
+
+		const expectedErr = "revalidation interrupted after validating 2 " +
+			"subscribers and removing 1; run again to resume from checkpoint: "
+		assert.ErrorContains(t, err, expectedErr+checkpoint)
+		assert.Equal(t, 1, len(lambda.Requests))
+		assert.Equal(t, "batch-2\n", readCheckpointFile(t, checkpoint))
+	})
+
+	t.Run("SavesCheckpointIfInvokeFails", func(t *testing.T) {
+		f, lambda, checkpoint := setup(t)
+		assert.NilError(t, os.WriteFile(checkpoint, []byte("batch-2\n"), 0600))
+		lambda.Error = errors.New("invoke failed")
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "revalidation failed: invoke failed")
+		assert.Equal(t, "batch-2\n", readCheckpointFile(t, checkpoint))
+	})
+
+	t.Run("FailsIfCheckpointUnreadable", func(t *testing.T) {
+		f, lambda, checkpoint := setup(t)
+		assert.NilError(t, os.Mkdir(checkpoint, 0700))
+
+		f.ExecuteAndAssertErrorContains(t, "failed to read checkpoint: ")
+
+		assert.Equal(t, 0, len(lambda.Requests))
+	})
+}
@@ -4,6 +4,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/spf13/cobra"
 )
 
@@ -36,3 +41,12 @@ var rootCmd = &cobra.Command{
 func Execute() error {
 	return rootCmd.Execute()
 }
+
+// shutdownContext returns a context derived from cmd.Context() that's
+// cancelled upon receiving SIGINT or SIGTERM.
+//
+// Long running commands use it to stop cleanly and save their progress, so
+// that running them again can resume where they left off.
+func shutdownContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+}
@@ -8,9 +8,14 @@ import (
 	"errors"
 	"fmt"
 	"net/mail"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/events"
+	"github.com/mbland/elistman/ops"
 	"github.com/spf13/cobra"
 )
 
@@ -19,8 +24,10 @@ const sendDescription = `` +
 
 ` + email.ExampleMessageJson + `
 
-It first validates the message input and reports any errors. It then sends a
-copy of the message to verified mailing list subscribers, customized with their
+It first validates the message input and reports any errors. It then checks that
+either the From address or its domain is a verified Simple Email Service
+identity, unless --skip-from-check is specified. It then sends a copy of the
+message to verified mailing list subscribers, customized with their
 unsubscribe URIs.
 
 If no subscriber addresses are specified on the command line, it sends the
@@ -32,32 +39,66 @@ addresses parse successfully, it will attempt to send the message to only those
 addresses. The EListMan Lambda will perform further validation, and will only
 send the message to addresses matching verified subscribers. It will send the
 message to every verified subscriber address and report errors for all other
-addresses.`
+addresses.
+
+If --to is specified, it sends the message only to that address, whether or not
+it belongs to a subscriber. This enables authors to review the exact message
+before sending it to the list. Its unsubscribe links won't match any subscriber,
+so following them has no effect.`
+
+const FlagSkipFromCheck = "skip-from-check"
+const FlagTo = "to"
 
 func init() {
-	rootCmd.AddCommand(newSendCmd(NewEListManLambda))
+	rootCmd.AddCommand(newSendCmd(NewEListManLambda, NewSesIdentityClient))
 }
 
-func newSendCmd(newFunc EListManFactoryFunc) (cmd *cobra.Command) {
+func newSendCmd(
+	newFunc EListManFactoryFunc, newSesClient SesIdentityClientFactoryFunc,
+) (cmd *cobra.Command) {
 	cmd = &cobra.Command{
 		Use:   "send [address...]",
 		Short: "Send an email message to the mailing list",
 		Long:  sendDescription,
 		Args:  cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, argv []string) (err error) {
-			return sendMessage(cmd, newFunc, getStackName(cmd), argv)
+			var sesClient SesIdentityClient
+			if skip, _ := cmd.Flags().GetBool(FlagSkipFromCheck); !skip {
+				sesClient = newSesClient()
+			}
+			return sendMessage(
+				cmd,
+				newFunc,
+				sesClient,
+				getStackName(cmd),
+				argv,
+				getStringFlag(cmd, FlagTo),
+			)
 		},
 	}
 	registerStackName(cmd)
 	cmd.MarkFlagRequired(FlagStackName)
+	cmd.Flags().Bool(
+		FlagSkipFromCheck, false,
+		"don't check that the From address is a verified SES identity",
+	)
+	cmd.Flags().String(
+		FlagTo, "", "send only to this address, not to the subscriber list",
+	)
 	return
 }
 
+// sendMessage skips the From identity check if sesClient is nil.
+//
+// If testAddr isn't empty, it sends the message only to testAddr, and addrs
+// must be empty.
 func sendMessage(
 	cmd *cobra.Command,
 	newFunc EListManFactoryFunc,
+	sesClient SesIdentityClient,
 	stackName string,
 	addrs []string,
+	testAddr string,
 ) (err error) {
 	cmd.SilenceUsage = true
 	var msg *email.Message
@@ -68,14 +109,31 @@ func sendMessage(
 
 	if len(addrs) == 0 {
 		addrs = nil
+	} else if testAddr != "" {
+		return fmt.Errorf("can't specify addresses with --%s", FlagTo)
 	} else if err = checkAddresses(addrs); err != nil {
 		return
 	}
 
+	if testAddr != "" {
+		if err = checkAddresses([]string{testAddr}); err != nil {
+			return
+		}
+	}
+
 	ctx := context.Background()
+
+	if sesClient != nil {
+		if err = checkFromIdentity(ctx, sesClient, msg.From); err != nil {
+			return
+		}
+	}
+
 	evt := &events.CommandLineEvent{
 		EListManCommand: events.CommandLineSendEvent,
-		Send:            &events.SendEvent{Addresses: addrs, Message: *msg},
+		Send: &events.SendEvent{
+			Addresses: addrs, TestAddress: testAddr, Message: *msg,
+		},
 	}
 	response := &events.SendResponse{}
 
@@ -91,6 +149,52 @@ func sendMessage(
 	return
 }
 
+// checkFromIdentity ensures the From address can send via SES.
+//
+// Without this check, a From address that isn't a verified identity would cause
+// every individual message to fail.
+func checkFromIdentity(
+	ctx context.Context, client SesIdentityClient, from string,
+) (err error) {
+	var addr *mail.Address
+
+	// Message.Validate ensures that this will succeed, but just in case...
+	if addr, err = mail.ParseAddress(from); err != nil {
+		return fmt.Errorf("failed to parse From address %q: %w", from, err)
+	}
+	domain := addr.Address[strings.LastIndexByte(addr.Address, '@')+1:]
+
+	for _, id := range []string{addr.Address, domain} {
+		var verified bool
+		if verified, err = isVerifiedIdentity(ctx, client, id); err != nil {
+			return
+		} else if verified {
+			return
+		}
+	}
+
+	const errFmt = "neither the From address %s nor its domain %s " +
+		"is a verified SES identity; aborting before sending any messages"
+	return fmt.Errorf(errFmt, addr.Address, domain)
+}
+
+func isVerifiedIdentity(
+	ctx context.Context, client SesIdentityClient, identity string,
+) (verified bool, err error) {
+	input := &sesv2.GetEmailIdentityInput{EmailIdentity: aws.String(identity)}
+	var output *sesv2.GetEmailIdentityOutput
+	var notFound *sestypes.NotFoundException
+
+	if output, err = client.GetEmailIdentity(ctx, input); err == nil {
+		verified = output.VerifiedForSendingStatus
+	} else if errors.As(err, &notFound) {
+		err = nil
+	} else {
+		err = ops.AwsError("failed to get SES identity "+identity, err)
+	}
+	return
+}
+
 func checkAddresses(addrs []string) (err error) {
 	errs := make([]error, 0, len(addrs))
 
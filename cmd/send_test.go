@@ -8,15 +8,26 @@ import (
 
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/events"
+	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/testutils"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 func TestSend(t *testing.T) {
 	stackNameArgs := []string{"-s", TestStackName}
 
+	const fromAddress = "foobar@example.com"
+	const fromDomain = "example.com"
+	var sesClient *TestSesIdentityClient
+
 	setup := func() (f *CommandTestFixture, lambda *TestEListManFunc) {
 		lambda = NewTestEListManFunc()
-		f = NewCommandTestFixture(newSendCmd(lambda.GetFactoryFunc()))
+		sesClient = NewTestSesIdentityClient()
+		sesClient.Verified[fromDomain] = true
+		f = NewCommandTestFixture(
+			newSendCmd(lambda.GetFactoryFunc(), sesClient.GetFactoryFunc()),
+		)
 		f.Cmd.SetIn(strings.NewReader(email.ExampleMessageJson))
 		f.Cmd.SetArgs(stackNameArgs)
 		return
@@ -56,6 +67,40 @@ func TestSend(t *testing.T) {
 		lambda.AssertMatches(t, TestStackName, expectedReq)
 	})
 
+	t.Run("SucceedsSendingTestMessage", func(t *testing.T) {
+		f, lambda := setup()
+		f.Cmd.SetArgs(append(stackNameArgs, "--to", "author@foo.com"))
+		lambda.SetResponseJson(`{"Success": true, "NumSent": 1}`)
+
+		const expectedOut = "Sent the message successfully to 1 recipients.\n"
+		f.ExecuteAndAssertStdoutContains(t, expectedOut)
+
+		expectedReq := &events.CommandLineEvent{
+			EListManCommand: events.CommandLineSendEvent,
+			Send: &events.SendEvent{
+				TestAddress: "author@foo.com", Message: *email.ExampleMessage,
+			},
+		}
+		lambda.AssertMatches(t, TestStackName, expectedReq)
+	})
+
+	t.Run("FailsIfTestAddressIsInvalid", func(t *testing.T) {
+		f, _ := setup()
+		f.Cmd.SetArgs(append(stackNameArgs, "--to", "wat"))
+
+		const expectedErr = "recipient list includes invalid addresses:\n" +
+			"wat: mail: missing '@' or angle-addr"
+		f.ExecuteAndAssertErrorContains(t, expectedErr)
+	})
+
+	t.Run("FailsIfTestAddressAndSubscribersSpecified", func(t *testing.T) {
+		f, _ := setup()
+		args := []string{"--to", "author@foo.com", "test@foo.com"}
+		f.Cmd.SetArgs(append(stackNameArgs, args...))
+
+		f.ExecuteAndAssertErrorContains(t, "can't specify addresses with --to")
+	})
+
 	t.Run("RequiresStackNameFlag", func(t *testing.T) {
 		f, _ := setup()
 		f.AssertFailsIfRequiredFlagMissing(t, FlagStackName, []string{})
@@ -80,6 +125,63 @@ func TestSend(t *testing.T) {
 		f.ExecuteAndAssertErrorContains(t, expectedErr)
 	})
 
+	t.Run("SucceedsIfFromAddressIsVerified", func(t *testing.T) {
+		f, lambda := setup()
+		delete(sesClient.Verified, fromDomain)
+		sesClient.Verified[fromAddress] = true
+		lambda.SetResponseJson(`{"Success": true, "NumSent": 27}`)
+
+		const expectedOut = "Sent the message successfully to 27 recipients.\n"
+		f.ExecuteAndAssertStdoutContains(t, expectedOut)
+
+		assert.DeepEqual(t, []string{fromAddress}, sesClient.Identities)
+	})
+
+	t.Run("SucceedsIfFromDomainIsVerified", func(t *testing.T) {
+		f, lambda := setup()
+		lambda.SetResponseJson(`{"Success": true, "NumSent": 27}`)
+
+		const expectedOut = "Sent the message successfully to 27 recipients.\n"
+		f.ExecuteAndAssertStdoutContains(t, expectedOut)
+
+		expected := []string{fromAddress, fromDomain}
+		assert.DeepEqual(t, expected, sesClient.Identities)
+	})
+
+	t.Run("FailsBeforeSendingIfFromIdentityUnverified", func(t *testing.T) {
+		f, lambda := setup()
+		sesClient.Verified[fromDomain] = false
+
+		const expectedErr = "neither the From address " + fromAddress +
+			" nor its domain " + fromDomain + " is a verified SES identity"
+		f.ExecuteAndAssertErrorContains(t, expectedErr)
+
+		assert.Assert(t, is.Nil(lambda.InvokeReq))
+	})
+
+	t.Run("FailsBeforeSendingIfCheckingFromIdentityFails", func(t *testing.T) {
+		f, lambda := setup()
+		sesClient.Error = testutils.AwsServerError("SES is down")
+
+		const expectedErr = "failed to get SES identity " + fromAddress
+		err := f.ExecuteAndAssertErrorContains(t, expectedErr)
+
+		assert.Assert(t, testutils.ErrorIs(err, ops.ErrExternal))
+		assert.Assert(t, is.Nil(lambda.InvokeReq))
+	})
+
+	t.Run("SkipsFromIdentityCheckIfFlagSet", func(t *testing.T) {
+		f, lambda := setup()
+		sesClient.Verified[fromDomain] = false
+		f.Cmd.SetArgs(append(stackNameArgs, "--"+FlagSkipFromCheck))
+		lambda.SetResponseJson(`{"Success": true, "NumSent": 27}`)
+
+		const expectedOut = "Sent the message successfully to 27 recipients.\n"
+		f.ExecuteAndAssertStdoutContains(t, expectedOut)
+
+		assert.Assert(t, is.Len(sesClient.Identities, 0))
+	})
+
 	t.Run("FailsIfInvokingLambdaFails", func(t *testing.T) {
 		f, lambda := setup()
 		f.AssertReturnsLambdaError(t, lambda, "sending failed: ")
@@ -0,0 +1,232 @@
+// Copyright © 2023 Mike Bland <mbland@acm.org>
+// See LICENSE.txt for details.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/db"
+	"github.com/mbland/elistman/ops"
+	"github.com/spf13/cobra"
+)
+
+const smokeDescription = `` +
+	`Runs the subscribe, verify, and unsubscribe flow against a deployed stack
+
+Subscribes a disposable Amazon SES mailbox simulator address via the public
+API, reads the new pending subscriber record from the subscribers table, then
+follows its verification link. After confirming the subscriber is verified, it
+follows the unsubscribe link and confirms the record was removed.
+
+The command removes the subscriber record even if any step fails.
+
+- https://docs.aws.amazon.com/ses/latest/dg/send-an-email-from-console.html`
+
+const FlagAddress = "address"
+const FlagLinkSigningKey = "link-signing-key"
+
+const smokeAddressFmt = "success+elistman-smoke-%s@simulator.amazonses.com"
+
+type HttpClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+type HttpClientFactoryFunc func() HttpClient
+
+// NewHttpClient returns a client that doesn't follow redirects.
+//
+// The smoke command needs to check the status of each API response directly,
+// not the status of the pages to which the API redirects.
+func NewHttpClient() HttpClient {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(
+		newSmokeCmd(NewCloudFormationClient, NewHttpClient, NewDatabase),
+	)
+}
+
+func newSmokeCmd(
+	newCfClient CloudFormationClientFactoryFunc,
+	newHttpClient HttpClientFactoryFunc,
+	newDatabase DatabaseFactoryFunc,
+) (cmd *cobra.Command) {
+	cmd = &cobra.Command{
+		Use:   "smoke",
+		Short: "Smoke test the subscription flow of a deployed stack",
+		Long:  smokeDescription,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cmd.SilenceUsage = true
+			st := &smokeTest{
+				cmd:     cmd,
+				client:  newHttpClient(),
+				dbase:   newDatabase(getStringFlag(cmd, FlagTableName)),
+				address: getStringFlag(cmd, FlagAddress),
+				signingKey: []byte(
+					getStringFlag(cmd, FlagLinkSigningKey),
+				),
+			}
+			if st.address == "" {
+				st.address = fmt.Sprintf(smokeAddressFmt, uuid.NewString())
+			}
+			return st.run(
+				context.Background(), newCfClient(), getStackName(cmd),
+			)
+		},
+	}
+	registerStackName(cmd)
+	cmd.MarkFlagRequired(FlagStackName)
+	cmd.Flags().StringP(
+		FlagTableName, "t", "", "name of the subscribers DynamoDB table",
+	)
+	cmd.MarkFlagRequired(FlagTableName)
+	cmd.Flags().String(
+		FlagAddress, "",
+		"address to subscribe (default: a unique mailbox simulator address)",
+	)
+	cmd.Flags().String(
+		FlagLinkSigningKey, "",
+		"the stack's LINK_SIGNING_KEY, if any, for signing verify and "+
+			"unsubscribe links",
+	)
+	return
+}
+
+type smokeTest struct {
+	cmd        *cobra.Command
+	client     HttpClient
+	dbase      db.Database
+	apiRootUrl string
+	address    string
+	signingKey []byte
+}
+
+func (st *smokeTest) run(
+	ctx context.Context, cfc CloudFormationClient, stackName string,
+) (err error) {
+	if st.apiRootUrl, err = GetApiRootUrl(ctx, cfc, stackName); err != nil {
+		return fmt.Errorf("smoke test failed: %w", err)
+	}
+	defer func() {
+		if cleanupErr := st.cleanup(ctx); cleanupErr != nil {
+			err = errors.Join(err, cleanupErr)
+		}
+	}()
+
+	if err = st.runSteps(ctx); err != nil {
+		err = fmt.Errorf("smoke test failed for %s: %w", st.address, err)
+	} else {
+		st.cmd.Printf("Smoke test passed for %s\n", st.address)
+	}
+	return
+}
+
+func (st *smokeTest) runSteps(ctx context.Context) (err error) {
+	var sub *db.Subscriber
+	subscribeUrl := strings.TrimSuffix(st.apiRootUrl, "/") +
+		ops.ApiPrefixSubscribe
+	form := url.Values{"email": {st.address}}
+
+	st.cmd.Printf("Subscribing %s\n", st.address)
+	if err = st.post(ctx, subscribeUrl, form); err != nil {
+		return
+	}
+	if sub, err = st.expectStatus(ctx, db.SubscriberPending); err != nil {
+		return
+	}
+
+	sig := ops.LinkSignature(st.signingKey, sub.Email, sub.Uid)
+
+	st.cmd.Printf("Verifying %s\n", st.address)
+	verifyUrl := ops.SignUrl(sub.VerifyUrl(st.apiRootUrl), sig)
+	if err = st.get(ctx, verifyUrl); err != nil {
+		return
+	} else if _, err = st.expectStatus(ctx, db.SubscriberVerified); err != nil {
+		return
+	}
+
+	st.cmd.Printf("Unsubscribing %s\n", st.address)
+	unsubUrl := ops.SignUrl(sub.UnsubscribeUrl(st.apiRootUrl), sig)
+	if err = st.get(ctx, unsubUrl); err != nil {
+		return
+	}
+	return st.expectRemoved(ctx)
+}
+
+func (st *smokeTest) post(
+	ctx context.Context, apiUrl string, form url.Values,
+) error {
+	body := strings.NewReader(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrl, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", apiUrl, err)
+	}
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	return st.send(req)
+}
+
+func (st *smokeTest) get(ctx context.Context, apiUrl string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request for %s: %w", apiUrl, err)
+	}
+	return st.send(req)
+}
+
+func (st *smokeTest) send(req *http.Request) error {
+	desc := req.Method + " " + req.URL.String()
+	res, err := st.client.Do(req)
+
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", desc, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusSeeOther {
+		const errFmt = "%s returned %d, expected %d"
+		return fmt.Errorf(errFmt, desc, res.StatusCode, http.StatusSeeOther)
+	}
+	return nil
+}
+
+func (st *smokeTest) expectStatus(
+	ctx context.Context, status db.SubscriberStatus,
+) (sub *db.Subscriber, err error) {
+	if sub, err = st.dbase.Get(ctx, st.address); err != nil {
+		err = fmt.Errorf("expected %s subscriber: %w", status, err)
+	} else if sub.Status != status {
+		const errFmt = "expected %s subscriber, status is %s"
+		err = fmt.Errorf(errFmt, status, sub.Status)
+	}
+	return
+}
+
+func (st *smokeTest) expectRemoved(ctx context.Context) error {
+	if _, err := st.dbase.Get(ctx, st.address); err == nil {
+		return errors.New("subscriber still exists after unsubscribing")
+	} else if !errors.Is(err, db.ErrSubscriberNotFound) {
+		return fmt.Errorf("failed to confirm removal: %w", err)
+	}
+	return nil
+}
+
+func (st *smokeTest) cleanup(ctx context.Context) error {
+	if err := st.dbase.Delete(ctx, st.address); err != nil {
+		return fmt.Errorf("failed to clean up %s: %w", st.address, err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+//go:build small_tests || all_tests
+
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mbland/elistman/db"
+	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/testdoubles"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// testApiClient emulates the public subscription API using a test Database.
+type testApiClient struct {
+	db       *testdoubles.Database
+	requests []string
+	status   int
+	err      error
+	skip     map[string]bool
+
+	// signingKey emulates the LINK_SIGNING_KEY of the deployed stack.
+	signingKey []byte
+}
+
+func newTestApiClient(dbase *testdoubles.Database) *testApiClient {
+	return &testApiClient{
+		db: dbase, status: http.StatusSeeOther, skip: map[string]bool{},
+	}
+}
+
+func (c *testApiClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req.Method+" "+req.URL.String())
+
+	if c.err != nil {
+		return nil, c.err
+	} else if err := c.emulate(req); err != nil {
+		return nil, err
+	}
+	res := &http.Response{
+		StatusCode: c.status, Body: io.NopCloser(strings.NewReader("")),
+	}
+	return res, nil
+}
+
+func (c *testApiClient) emulate(req *http.Request) error {
+	ctx := req.Context()
+
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			return err
+		} else if c.skip[ops.ApiPrefixSubscribe] {
+			return nil
+		}
+		return c.db.Put(ctx, db.NewSubscriber(req.PostForm.Get("email")))
+	}
+
+	for _, sub := range c.db.Subscribers {
+		sig := ops.LinkSignature(c.signingKey, sub.Email, sub.Uid)
+
+		switch req.URL.String() {
+		case ops.SignUrl(sub.VerifyUrl(TestApiRootUrl), sig):
+			if !c.skip[ops.ApiPrefixVerify] {
+				sub.Status = db.SubscriberVerified
+			}
+			return nil
+		case ops.SignUrl(sub.UnsubscribeUrl(TestApiRootUrl), sig):
+			if !c.skip[ops.ApiPrefixUnsubscribe] {
+				return c.db.Delete(ctx, sub.Email)
+			}
+			return nil
+		}
+	}
+	return errors.New("unexpected request: " + req.URL.String())
+}
+
+func TestSmoke(t *testing.T) {
+	const address = "success+smoke@simulator.amazonses.com"
+
+	setup := func() (
+		*CommandTestFixture,
+		*TestCloudFormationClient,
+		*testApiClient,
+		*testdoubles.Database,
+	) {
+		cfc := NewTestCloudFormationClient()
+		dbase := testdoubles.NewDatabase()
+		client := newTestApiClient(dbase)
+		newCfc := func() CloudFormationClient { return cfc }
+		newClient := func() HttpClient { return client }
+		newDb := func(_ string) db.Database { return dbase }
+		f := NewCommandTestFixture(newSmokeCmd(newCfc, newClient, newDb))
+		f.Cmd.SetArgs([]string{
+			"-s", TestStackName, "-t", "subscribers", "--address", address,
+		})
+		return f, cfc, client, dbase
+	}
+
+	t.Run("Succeeds", func(t *testing.T) {
+		f, _, client, dbase := setup()
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Smoke test passed for "+address+"\n",
+		)
+
+		assert.Assert(t, is.Len(client.requests, 3))
+		expected := "POST " + TestApiRootUrl + ops.ApiPrefixSubscribe
+		assert.Equal(t, expected, client.requests[0])
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("SignsLinksIfSigningKeySet", func(t *testing.T) {
+		f, _, client, dbase := setup()
+		client.signingKey = []byte("signing key")
+		f.Cmd.SetArgs([]string{
+			"-s", TestStackName, "-t", "subscribers", "--address", address,
+			"--link-signing-key", "signing key",
+		})
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Smoke test passed for "+address+"\n",
+		)
+
+		assert.Assert(t, is.Len(client.requests, 3))
+		assert.Assert(t, is.Contains(client.requests[1], "?sig="))
+		assert.Assert(t, is.Contains(client.requests[2], "?sig="))
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("GeneratesSimulatorAddressByDefault", func(t *testing.T) {
+		f, _, _, _ := setup()
+		f.Cmd.SetArgs([]string{"-s", TestStackName, "-t", "subscribers"})
+
+		f.ExecuteAndAssertStdoutContains(t, "@simulator.amazonses.com\n")
+
+		assert.Assert(t, is.Contains(f.Stdout.String(), "elistman-smoke-"))
+	})
+
+	t.Run("FailsIfStackNameMissing", func(t *testing.T) {
+		f, _, _, _ := setup()
+
+		f.AssertFailsIfRequiredFlagMissing(
+			t, FlagStackName, []string{"-t", "subscribers"},
+		)
+	})
+
+	t.Run("FailsIfTableNameMissing", func(t *testing.T) {
+		f, _, _, _ := setup()
+
+		f.AssertFailsIfRequiredFlagMissing(
+			t, FlagTableName, []string{"-s", TestStackName},
+		)
+	})
+
+	t.Run("FailsIfCannotGetApiRootUrl", func(t *testing.T) {
+		f, cfc, client, _ := setup()
+		cfc.DescribeStacksError = errors.New("test error")
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "failed to get API root URL for ")
+		assert.Assert(t, is.Len(client.requests, 0))
+	})
+
+	t.Run("FailsIfRequestFails", func(t *testing.T) {
+		f, _, client, _ := setup()
+		client.err = errors.New("connection refused")
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "POST ")
+		assert.ErrorContains(t, err, "connection refused")
+	})
+
+	t.Run("FailsOnUnexpectedStatus", func(t *testing.T) {
+		f, _, client, _ := setup()
+		client.status = http.StatusBadRequest
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "returned 400, expected 303")
+	})
+
+	t.Run("FailsIfSubscriberNotCreated", func(t *testing.T) {
+		f, _, client, _ := setup()
+		client.skip[ops.ApiPrefixSubscribe] = true
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "expected pending subscriber: ")
+		assert.Assert(t, is.Len(client.requests, 1))
+	})
+
+	t.Run("CleansUpIfNotVerified", func(t *testing.T) {
+		f, _, client, dbase := setup()
+		client.skip[ops.ApiPrefixVerify] = true
+
+		err := f.Cmd.Execute()
+
+		const expectedErr = "expected verified subscriber, status is pending"
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("CleansUpIfNotRemoved", func(t *testing.T) {
+		f, _, client, dbase := setup()
+		client.skip[ops.ApiPrefixUnsubscribe] = true
+
+		err := f.Cmd.Execute()
+
+		const expectedErr = "subscriber still exists after unsubscribing"
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, is.Len(dbase.Subscribers, 0))
+	})
+
+	t.Run("ReportsCleanupFailure", func(t *testing.T) {
+		f, _, client, dbase := setup()
+		client.skip[ops.ApiPrefixVerify] = true
+		dbase.SimulateDelErr = func(_ string) error {
+			return errors.New("test delete error")
+		}
+
+		err := f.Cmd.Execute()
+
+		assert.ErrorContains(t, err, "expected verified subscriber")
+		assert.ErrorContains(t, err, "failed to clean up "+address)
+	})
+}
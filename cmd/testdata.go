@@ -11,6 +11,7 @@ const (
 	TestStackName   = "elistman-test"
 	TestFunctionArn = "arn:aws:lambda:us-east-1:0123456789:function:" +
 		"elistman-dev-Function-0123456789"
+	TestApiRootUrl = "https://api.mike-bland.com/email"
 )
 
 var TestStack cftypes.Stack = cftypes.Stack{
@@ -20,5 +21,9 @@ var TestStack cftypes.Stack = cftypes.Stack{
 			OutputKey:   aws.String(FunctionArnKey),
 			OutputValue: aws.String(TestFunctionArn),
 		},
+		{
+			OutputKey:   aws.String(ApiRootUrlKey),
+			OutputValue: aws.String(TestApiRootUrl),
+		},
 	},
 }
@@ -7,7 +7,10 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"gotest.tools/assert"
 )
 
@@ -28,6 +31,42 @@ func (tlc *TestLambdaClient) Invoke(
 	return tlc.InvokeOutput, tlc.InvokeError
 }
 
+// TestSesIdentityClient reports identities missing from Verified as not found.
+type TestSesIdentityClient struct {
+	Verified   map[string]bool
+	Identities []string
+	Error      error
+}
+
+func NewTestSesIdentityClient() *TestSesIdentityClient {
+	return &TestSesIdentityClient{Verified: map[string]bool{}}
+}
+
+func (c *TestSesIdentityClient) GetFactoryFunc() SesIdentityClientFactoryFunc {
+	return func() SesIdentityClient {
+		return c
+	}
+}
+
+func (c *TestSesIdentityClient) GetEmailIdentity(
+	_ context.Context,
+	input *sesv2.GetEmailIdentityInput,
+	_ ...func(*sesv2.Options),
+) (*sesv2.GetEmailIdentityOutput, error) {
+	identity := aws.ToString(input.EmailIdentity)
+	c.Identities = append(c.Identities, identity)
+
+	if c.Error != nil {
+		return nil, c.Error
+	} else if verified, ok := c.Verified[identity]; !ok {
+		return nil, &sestypes.NotFoundException{Message: aws.String(identity)}
+	} else {
+		output := &sesv2.GetEmailIdentityOutput{}
+		output.VerifiedForSendingStatus = verified
+		return output, nil
+	}
+}
+
 type TestEListManFunc struct {
 	StackName       string
 	CreateFuncError error
@@ -0,0 +1,59 @@
+// Copyright © 2023 Mike Bland <mbland@acm.org>
+// See LICENSE.txt for details.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/mbland/elistman/db"
+	"github.com/spf13/cobra"
+)
+
+const upgradeSubscribersTableDescription = `` +
+	`Upgrades a DynamoDB table created by an earlier version of EListMan.
+
+Adds the index used to query verified subscribers by verification time, if the
+table doesn't already have it. Then updates every verified subscriber record
+written before the index existed, so that the index will include it.
+
+DynamoDB builds the new index in the background, which can take a while for
+large tables. It's safe to run this command more than once, e.g., if it's
+interrupted.
+
+The command takes one argument, which is the name of the table to upgrade.`
+
+func init() {
+	rootCmd.AddCommand(newUpgradeSubscribersTableCmd(NewDynamoDb))
+}
+
+func newUpgradeSubscribersTableCmd(
+	newDynDb DynamoDbFactoryFunc,
+) *cobra.Command {
+	return &cobra.Command{
+		Use:   "upgrade-subscribers-table",
+		Short: "Upgrade a DynamoDB table for mailing list subscribers",
+		Long:  upgradeSubscribersTableDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return upgradeSubscribersTable(cmd, newDynDb(args[0]))
+		},
+	}
+}
+
+func upgradeSubscribersTable(cmd *cobra.Command, dyndb *db.DynamoDb) error {
+	cmd.SilenceUsage = true
+	ctx := context.Background()
+
+	indexCreated, updated, err := dyndb.UpgradeSubscribersTable(ctx)
+	if indexCreated {
+		cmd.Printf(
+			"Created index %s in DynamoDB table: %s\n",
+			db.DynamoDbVerifiedTimeIndexName, dyndb.TableName,
+		)
+	}
+	if err == nil {
+		cmd.Printf("Updated %d verified subscribers\n", updated)
+	}
+	return err
+}
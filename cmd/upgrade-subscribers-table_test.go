@@ -0,0 +1,61 @@
+//go:build small_tests || all_tests
+
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mbland/elistman/db"
+	"gotest.tools/assert"
+)
+
+func TestUpgradeSubscribersTable(t *testing.T) {
+	const TableName = "elistman-subscribers"
+
+	setup := func() (f *CommandTestFixture, client *db.TestDynamoDbClient) {
+		client = db.NewTestDynamoDbClient()
+		f = NewCommandTestFixture(
+			newUpgradeSubscribersTableCmd(func(tableName string) *db.DynamoDb {
+				return &db.DynamoDb{Client: client, TableName: tableName}
+			}),
+		)
+		f.Cmd.SetArgs([]string{TableName})
+		return
+	}
+
+	t.Run("CreatesIndex", func(t *testing.T) {
+		f, _ := setup()
+
+		const outFmt = "Created index %s in DynamoDB table: %s\n" +
+			"Updated 0 verified subscribers\n"
+		f.ExecuteAndAssertStdoutContains(
+			t, fmt.Sprintf(outFmt, db.DynamoDbVerifiedTimeIndexName, TableName),
+		)
+		assert.Assert(t, f.Cmd.SilenceUsage == true)
+	})
+
+	t.Run("SkipsExistingIndex", func(t *testing.T) {
+		f, client := setup()
+		client.DescTableOutput.Table.GlobalSecondaryIndexes = append(
+			client.DescTableOutput.Table.GlobalSecondaryIndexes,
+			types.GlobalSecondaryIndexDescription{
+				IndexName: aws.String(db.DynamoDbVerifiedTimeIndexName),
+			},
+		)
+
+		f.ExecuteAndAssertStdoutContains(
+			t, "Updated 0 verified subscribers\n",
+		)
+		assert.Assert(t, client.UpdateTableInput == nil)
+	})
+
+	t.Run("FailsOnDynamodDbClientError", func(t *testing.T) {
+		f, client := setup()
+		client.UpdateTableErr = fmt.Errorf("update table test error")
+
+		f.ExecuteAndAssertErrorContains(t, "update table test error")
+	})
+}
@@ -6,16 +6,34 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/types"
 )
 
 type Database interface {
 	Get(ctx context.Context, email string) (*Subscriber, error)
 	Put(ctx context.Context, subscriber *Subscriber) error
+	PutIfAbsent(ctx context.Context, subscriber *Subscriber) error
+	PutBatch(
+		ctx context.Context, subscribers []*Subscriber,
+	) (failed []*Subscriber, err error)
+	PutBatchIfAbsent(
+		ctx context.Context, subscribers []*Subscriber,
+	) (failed []*Subscriber, err error)
 	Delete(ctx context.Context, email string) error
 	ProcessSubscribers(
 		context.Context, SubscriberStatus, SubscriberProcessor,
 	) error
+	ProcessSubscriberPages(
+		context.Context, SubscriberStatus, SubscriberPageFunc,
+	) error
+	GetSubscribersPage(
+		ctx context.Context,
+		status SubscriberStatus,
+		startKey StartKey,
+		limit int,
+	) (subs []*Subscriber, nextStartKey StartKey, err error)
+	StartKeyAfter(sub *Subscriber) (StartKey, error)
 }
 
 // ErrSubscriberNotFound indicates that an email address isn't subscribed.
@@ -24,6 +42,27 @@ type Database interface {
 // succeeded, but there was no such Subscriber.
 const ErrSubscriberNotFound = types.SentinelError("is not a subscriber")
 
+// ErrVersionConflict indicates that a Subscriber changed since it was read.
+//
+// Database.Put returns this error when another writer updated or created the
+// record after the caller's copy was retrieved. Callers may Get the latest
+// version of the Subscriber and retry.
+const ErrVersionConflict = types.SentinelError("version conflict")
+
+// ErrSubscriberExists indicates that an email address is already subscribed.
+//
+// Database.PutIfAbsent returns this error when a record for the Subscriber's
+// email address already exists, whatever its status.
+const ErrSubscriberExists = types.SentinelError("already a subscriber")
+
+// StartKey is an opaque cursor for resuming a paginated database request.
+//
+// A nil StartKey begins a request at the first available record. A request
+// returns a nil StartKey when there are no further records to retrieve.
+type StartKey interface {
+	isDbStartKey()
+}
+
 // A SubscriberProcessor performs an operation on a Subscriber.
 //
 // Process should return true if processing should continue with the next
@@ -43,11 +82,40 @@ func (f SubscriberFunc) Process(sub *Subscriber) bool {
 	return f(sub)
 }
 
+// A SubscriberPageFunc performs an operation on a page of Subscribers.
+//
+// This enables batching operations such as writes or buffer flushes. It
+// should return true if processing should continue with the next page, or
+// false if processing should halt. Returning an error also halts processing,
+// and Database.ProcessSubscriberPages will return that error.
+type SubscriberPageFunc func(page []*Subscriber) (bool, error)
+
 type Subscriber struct {
 	Email     string
 	Uid       uuid.UUID
 	Status    SubscriberStatus
 	Timestamp time.Time
+
+	// LastEngaged is the time of the most recent SES "Open" or "Click" event
+	// for a verified Subscriber. It's the zero value if there haven't been any.
+	LastEngaged time.Time
+
+	// LastDelivered is the time of the most recent SES "Delivery" event for a
+	// verified Subscriber, if recording deliveries is enabled. It's the zero
+	// value if there haven't been any.
+	LastDelivered time.Time
+
+	// ConfirmExpiry is the time after which a pending Subscriber's
+	// verification link is no longer valid, even though the record may still
+	// exist. It's the zero value if the link remains valid until the record
+	// expires.
+	ConfirmExpiry time.Time
+
+	// Version is the number of times the Subscriber record has been written.
+	//
+	// It's zero for new Subscribers and for records written before versioning
+	// existed. A successful Database.Put increments it.
+	Version int64
 }
 
 type SubscriberStatus string
@@ -68,6 +136,22 @@ func NewSubscriber(email string) *Subscriber {
 	}
 }
 
+// VerifyUrl returns the API link for verifying the Subscriber's address.
+func (sub *Subscriber) VerifyUrl(apiBaseUrl string) string {
+	return ops.VerifyUrl(apiBaseUrl, sub.Email, sub.Uid)
+}
+
+// UnsubscribeUrl returns the API link for unsubscribing the Subscriber.
+func (sub *Subscriber) UnsubscribeUrl(apiBaseUrl string) string {
+	return ops.UnsubscribeUrl(apiBaseUrl, sub.Email, sub.Uid)
+}
+
+// UnsubscribeFormUrl returns the link to the unsubscribe form at formUrl for
+// the Subscriber.
+func (sub *Subscriber) UnsubscribeFormUrl(formUrl string) string {
+	return ops.UnsubscribeFormUrl(formUrl, sub.Email, sub.Uid)
+}
+
 func (sub *Subscriber) String() string {
 	sb := strings.Builder{}
 	sb.WriteString("Email: ")
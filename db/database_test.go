@@ -28,3 +28,50 @@ func TestSubscriber(t *testing.T) {
 		assert.Equal(t, expected, sub.String())
 	})
 }
+
+func TestSubscriberUrls(t *testing.T) {
+	const apiBaseUrl = "https://foo.com/email/"
+
+	newSub := func(email string) *Subscriber {
+		return &Subscriber{Email: email, Uid: testdata.TestUid}
+	}
+
+	t.Run("VerifyUrl", func(t *testing.T) {
+		sub := newSub("foo@test.com")
+
+		expected := "https://foo.com/email/verify/foo@test.com/" +
+			testdata.TestUidStr
+		assert.Equal(t, expected, sub.VerifyUrl(apiBaseUrl))
+	})
+
+	t.Run("UnsubscribeUrl", func(t *testing.T) {
+		sub := newSub("foo@test.com")
+
+		expected := "https://foo.com/email/unsubscribe/foo@test.com/" +
+			testdata.TestUidStr
+		assert.Equal(t, expected, sub.UnsubscribeUrl(apiBaseUrl))
+	})
+
+	t.Run("UnsubscribeFormUrl", func(t *testing.T) {
+		sub := newSub("foo+bar@test.com")
+
+		expected := "https://foo.com/unsubscribe?email=foo%2Bbar%40test.com" +
+			"&uid=" + testdata.TestUidStr
+		formUrl := "https://foo.com/unsubscribe"
+		assert.Equal(t, expected, sub.UnsubscribeFormUrl(formUrl))
+	})
+
+	t.Run("UrlsEncodeEmailContainingPlusAndSlash", func(t *testing.T) {
+		sub := newSub("foo/bar+baz@test.com")
+
+		const encoded = "foo%2Fbar+baz@test.com/" + testdata.TestUidStr
+		assert.Equal(
+			t, apiBaseUrl+"verify/"+encoded, sub.VerifyUrl(apiBaseUrl),
+		)
+		assert.Equal(
+			t,
+			apiBaseUrl+"unsubscribe/"+encoded,
+			sub.UnsubscribeUrl(apiBaseUrl),
+		)
+	})
+}
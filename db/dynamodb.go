@@ -2,14 +2,19 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 	"github.com/mbland/elistman/ops"
 )
@@ -31,6 +36,10 @@ type DynamoDbClient interface {
 		...func(*dynamodb.Options),
 	) (*dynamodb.UpdateTimeToLiveOutput, error)
 
+	UpdateTable(
+		context.Context, *dynamodb.UpdateTableInput, ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateTableOutput, error)
+
 	DeleteTable(
 		context.Context, *dynamodb.DeleteTableInput, ...func(*dynamodb.Options),
 	) (*dynamodb.DeleteTableOutput, error)
@@ -43,6 +52,22 @@ type DynamoDbClient interface {
 		context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options),
 	) (*dynamodb.PutItemOutput, error)
 
+	UpdateItem(
+		context.Context, *dynamodb.UpdateItemInput, ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+
+	BatchGetItem(
+		context.Context,
+		*dynamodb.BatchGetItemInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.BatchGetItemOutput, error)
+
+	BatchWriteItem(
+		context.Context,
+		*dynamodb.BatchWriteItemInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.BatchWriteItemOutput, error)
+
 	DeleteItem(
 		context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options),
 	) (*dynamodb.DeleteItemOutput, error)
@@ -50,25 +75,103 @@ type DynamoDbClient interface {
 	Scan(
 		context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options),
 	) (*dynamodb.ScanOutput, error)
+
+	Query(
+		context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options),
+	) (*dynamodb.QueryOutput, error)
 }
 
 // https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/WorkingWithItems.html
 type DynamoDb struct {
 	Client    DynamoDbClient
 	TableName string
+
+	// TableWaitMinDelay and TableWaitMaxDelay bound the delay between
+	// DescribeTable calls while CreateSubscribersTable waits for the new table
+	// to become active. If zero, the dynamodb.TableExistsWaiter defaults apply.
+	TableWaitMinDelay time.Duration
+	TableWaitMaxDelay time.Duration
+
+	// BatchBackoff determines the delay before PutBatch or PutBatchIfAbsent
+	// retries unprocessed keys or items. If nil, DefaultBatchBackoff applies.
+	BatchBackoff ops.Backoff
+
+	// Sleep waits between PutBatch or PutBatchIfAbsent attempts, returning an
+	// error if ctx is cancelled while waiting. Defaults to ops.Sleep if nil.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	// ReportConsumedCapacity, if not nil, receives the capacity units consumed
+	// by each Get, Put, Delete, Scan, and Query request. See
+	// WithConsumedCapacity.
+	ReportConsumedCapacity ConsumedCapacityFunc
+}
+
+// ConsumedCapacityFunc receives the total capacity units consumed by a single
+// DynamoDB request, identified by its operation name, e.g., "GetItem".
+type ConsumedCapacityFunc func(operation string, units float64)
+
+// DefaultBatchBackoff is the default DynamoDb.BatchBackoff.
+var DefaultBatchBackoff ops.Backoff = &ops.FullJitterBackoff{
+	Base: 50 * time.Millisecond, Cap: 5 * time.Second,
+}
+
+// batchWriteMaxItems is the maximum number of items BatchWriteItem accepts.
+//
+// - https://docs.aws.amazon.com/amazondynamodb/latest/APIReference/API_BatchWriteItem.html
+const batchWriteMaxItems = 25
+
+// batchWriteMaxAttempts limits how many times PutBatch or PutBatchIfAbsent
+// sends the same chunk to either BatchGetItem or BatchWriteItem.
+const batchWriteMaxAttempts = 5
+
+// DynamoDbOption configures optional DynamoDb behavior at construction time.
+type DynamoDbOption func(db *DynamoDb)
+
+// WithTableWaitDelay sets the DynamoDb.TableWaitMinDelay and
+// DynamoDb.TableWaitMaxDelay values.
+func WithTableWaitDelay(minDelay, maxDelay time.Duration) DynamoDbOption {
+	return func(db *DynamoDb) {
+		db.TableWaitMinDelay = minDelay
+		db.TableWaitMaxDelay = maxDelay
+	}
+}
+
+// WithConsumedCapacity reports the capacity consumed by each request to report.
+//
+// It sets ReturnConsumedCapacity to TOTAL on each Get, Put, Delete, Scan, and
+// Query request. This is off by default, since it adds to the size of every
+// response. It helps operators right-size the table's provisioned capacity.
+//
+// - https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/read-write-operations.html
+func WithConsumedCapacity(report ConsumedCapacityFunc) DynamoDbOption {
+	return func(db *DynamoDb) {
+		db.ReportConsumedCapacity = report
+	}
 }
 
-func NewDynamoDb(cfg aws.Config, tableName string) *DynamoDb {
-	return &DynamoDb{dynamodb.NewFromConfig(cfg), tableName}
+func NewDynamoDb(
+	cfg aws.Config, tableName string, opts ...DynamoDbOption,
+) *DynamoDb {
+	return newDynamoDb(dynamodb.NewFromConfig(cfg), tableName, opts)
 }
 
 func NewDynamoDbWithCustomEndpoint(
-	cfg aws.Config, tableName string, endpoint string,
+	cfg aws.Config, tableName string, endpoint string, opts ...DynamoDbOption,
 ) *DynamoDb {
-	db := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
 		o.BaseEndpoint = aws.String(endpoint)
 	})
-	return &DynamoDb{db, tableName}
+	return newDynamoDb(client, tableName, opts)
+}
+
+func newDynamoDb(
+	client DynamoDbClient, tableName string, opts []DynamoDbOption,
+) *DynamoDb {
+	db := &DynamoDb{Client: client, TableName: tableName}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
 }
 
 const DynamoDbPrimaryKey = "email"
@@ -81,10 +184,30 @@ const DynamoDbPendingIndexPartitionKey = string(SubscriberPending)
 const DynamoDbVerifiedIndexName string = string(SubscriberVerified)
 const DynamoDbVerifiedIndexPartitionKey string = string(SubscriberVerified)
 
+// Sparse Global Secondary Index for querying verified subscribers by timestamp.
+//
+// Only verified records contain the partition key attribute, which always has
+// the same value. The "verified" timestamp attribute serves as the sort key,
+// enabling Query requests over a range of verification times.
+const DynamoDbVerifiedTimeIndexName string = "verified-by-time"
+const DynamoDbVerifiedTimeIndexPartitionKey string = "verifiedCohort"
+const DynamoDbVerifiedTimeIndexSortKey = DynamoDbVerifiedIndexPartitionKey
+
 var DynamoDbIndexProjection *dbtypes.Projection = &dbtypes.Projection{
 	ProjectionType: dbtypes.ProjectionTypeAll,
 }
 
+var dynamoDbVerifiedTimeIndexKeySchema = []dbtypes.KeySchemaElement{
+	{
+		AttributeName: aws.String(DynamoDbVerifiedTimeIndexPartitionKey),
+		KeyType:       dbtypes.KeyTypeHash,
+	},
+	{
+		AttributeName: aws.String(DynamoDbVerifiedTimeIndexSortKey),
+		KeyType:       dbtypes.KeyTypeRange,
+	},
+}
+
 var DynamoDbCreateTableInput = &dynamodb.CreateTableInput{
 	AttributeDefinitions: []dbtypes.AttributeDefinition{
 		{
@@ -99,6 +222,10 @@ var DynamoDbCreateTableInput = &dynamodb.CreateTableInput{
 			AttributeName: aws.String(DynamoDbVerifiedIndexPartitionKey),
 			AttributeType: dbtypes.ScalarAttributeTypeN,
 		},
+		{
+			AttributeName: aws.String(DynamoDbVerifiedTimeIndexPartitionKey),
+			AttributeType: dbtypes.ScalarAttributeTypeS,
+		},
 	},
 	KeySchema: []dbtypes.KeySchemaElement{
 		{
@@ -130,6 +257,11 @@ var DynamoDbCreateTableInput = &dynamodb.CreateTableInput{
 			},
 			Projection: DynamoDbIndexProjection,
 		},
+		{
+			IndexName:  aws.String(DynamoDbVerifiedTimeIndexName),
+			KeySchema:  dynamoDbVerifiedTimeIndexKeySchema,
+			Projection: DynamoDbIndexProjection,
+		},
 	},
 }
 
@@ -147,7 +279,17 @@ func (db *DynamoDb) waitForTable(
 	ctx context.Context, maxWait time.Duration,
 ) (err error) {
 	input := &dynamodb.DescribeTableInput{TableName: aws.String(db.TableName)}
-	waiter := dynamodb.NewTableExistsWaiter(db.Client)
+	waiter := dynamodb.NewTableExistsWaiter(
+		db.Client, func(opts *dynamodb.TableExistsWaiterOptions) {
+			if db.TableWaitMinDelay != 0 {
+				opts.MinDelay = db.TableWaitMinDelay
+			}
+			if db.TableWaitMaxDelay != 0 {
+				opts.MaxDelay = db.TableWaitMaxDelay
+			}
+			opts.Retryable = tableExistsRetryable(opts.Retryable)
+		},
+	)
 
 	if err = waiter.Wait(ctx, input, maxWait); err != nil {
 		const errFmt = "failed waiting for table to become active after %s"
@@ -156,6 +298,53 @@ func (db *DynamoDb) waitForTable(
 	return
 }
 
+type tableExistsRetryableFunc func(
+	context.Context,
+	*dynamodb.DescribeTableInput,
+	*dynamodb.DescribeTableOutput,
+	error,
+) (bool, error)
+
+// tableExistsRetryable determines whether waitForTable should keep polling.
+//
+// The default dynamodb.TableExistsWaiter behavior retries after every
+// DescribeTable error until the maximum wait time elapses. That includes errors
+// that will never resolve themselves, such as authorization failures.
+//
+// This wrapper keeps waiting after a ResourceNotFoundException, since the new
+// table may not be visible yet, or after transient errors such as throttling.
+// It returns all other errors immediately.
+func tableExistsRetryable(
+	defaultRetryable tableExistsRetryableFunc,
+) tableExistsRetryableFunc {
+	return func(
+		ctx context.Context,
+		input *dynamodb.DescribeTableInput,
+		output *dynamodb.DescribeTableOutput,
+		err error,
+	) (bool, error) {
+		var notFound *dbtypes.ResourceNotFoundException
+
+		if err == nil {
+			return defaultRetryable(ctx, input, output, err)
+		} else if errors.As(err, &notFound) || isTransientError(err) {
+			return true, nil
+		}
+		return false, err
+	}
+}
+
+var throttleErrors = retry.IsErrorThrottles(retry.DefaultThrottles)
+var retryableErrors = retry.IsErrorRetryables(retry.DefaultRetryables)
+
+func isTransientError(err error) bool {
+	var apiErr smithy.APIError
+
+	return throttleErrors.IsErrorThrottle(err).Bool() ||
+		retryableErrors.IsErrorRetryable(err).Bool() ||
+		(errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultServer)
+}
+
 func (db *DynamoDb) updateTimeToLive(
 	ctx context.Context,
 ) (ttlSpec *dbtypes.TimeToLiveSpecification, err error) {
@@ -194,6 +383,161 @@ func (db *DynamoDb) CreateSubscribersTable(
 	return
 }
 
+// UpgradeSubscribersTable updates a table created by an earlier version of
+// CreateSubscribersTable to support GetSubscribersVerifiedBetween.
+//
+// It creates the DynamoDbVerifiedTimeIndexName index if it doesn't exist, then
+// adds the DynamoDbVerifiedTimeIndexPartitionKey attribute to every verified
+// subscriber without one. It returns whether it created the index and the
+// number of subscribers it updated.
+//
+// DynamoDB builds the new index in the background, and only indexes records
+// containing its partition key. GetSubscribersVerifiedBetween may not return
+// every verified subscriber until both the index build and the update finish.
+// Running UpgradeSubscribersTable again after it succeeds has no effect.
+func (db *DynamoDb) UpgradeSubscribersTable(
+	ctx context.Context,
+) (indexCreated bool, updated int, err error) {
+	wrapErr := func(err error) error {
+		const errFmt = "failed to upgrade subscribers table \"%s\": %w"
+		return fmt.Errorf(errFmt, db.TableName, err)
+	}
+
+	if indexCreated, err = db.createVerifiedTimeIndex(ctx); err != nil {
+		err = wrapErr(err)
+	} else if updated, err = db.backfillVerifiedCohort(ctx); err != nil {
+		err = wrapErr(err)
+	}
+	return
+}
+
+// createVerifiedTimeIndex creates the DynamoDbVerifiedTimeIndexName index if
+// the table doesn't already have it.
+//
+// Like CreateSubscribersTable, it presumes the table uses on-demand capacity,
+// so the new index doesn't need provisioned throughput.
+func (db *DynamoDb) createVerifiedTimeIndex(
+	ctx context.Context,
+) (created bool, err error) {
+	descInput := &dynamodb.DescribeTableInput{
+		TableName: aws.String(db.TableName),
+	}
+	var desc *dynamodb.DescribeTableOutput
+
+	if desc, err = db.Client.DescribeTable(ctx, descInput); err != nil {
+		return false, ops.AwsError("failed to describe table", err)
+	}
+	for _, index := range desc.Table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == DynamoDbVerifiedTimeIndexName {
+			return false, nil
+		}
+	}
+
+	input := &dynamodb.UpdateTableInput{
+		TableName: aws.String(db.TableName),
+		AttributeDefinitions: []dbtypes.AttributeDefinition{
+			{
+				AttributeName: aws.String(
+					DynamoDbVerifiedTimeIndexPartitionKey,
+				),
+				AttributeType: dbtypes.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String(DynamoDbVerifiedTimeIndexSortKey),
+				AttributeType: dbtypes.ScalarAttributeTypeN,
+			},
+		},
+		GlobalSecondaryIndexUpdates: []dbtypes.GlobalSecondaryIndexUpdate{
+			{
+				Create: &dbtypes.CreateGlobalSecondaryIndexAction{
+					IndexName:  aws.String(DynamoDbVerifiedTimeIndexName),
+					KeySchema:  dynamoDbVerifiedTimeIndexKeySchema,
+					Projection: DynamoDbIndexProjection,
+				},
+			},
+		},
+	}
+
+	if _, err = db.Client.UpdateTable(ctx, input); err != nil {
+		prefix := "failed to create index " + DynamoDbVerifiedTimeIndexName
+		err = ops.AwsError(prefix, err)
+		return
+	}
+	return true, nil
+}
+
+// backfillVerifiedCohort adds the DynamoDbVerifiedTimeIndexPartitionKey
+// attribute to every verified subscriber that doesn't have it.
+//
+// Subscribers written by subscriberItem already have it. Older records don't.
+func (db *DynamoDb) backfillVerifiedCohort(
+	ctx context.Context,
+) (updated int, err error) {
+	input := &dynamodb.ScanInput{
+		TableName:              aws.String(db.TableName),
+		IndexName:              aws.String(DynamoDbVerifiedIndexName),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
+	}
+	paginator := dynamodb.NewScanPaginator(db.Client, input)
+
+	for paginator.HasMorePages() {
+		var output *dynamodb.ScanOutput
+		if output, err = paginator.NextPage(ctx); err != nil {
+			err = ops.AwsError("failed to get verified subscribers", err)
+			return
+		}
+		db.reportConsumedCapacity("Scan", output.ConsumedCapacity)
+
+		for _, item := range output.Items {
+			if _, ok := item[DynamoDbVerifiedTimeIndexPartitionKey]; ok {
+				continue
+			}
+			var ok bool
+			if ok, err = db.setVerifiedCohort(ctx, item); err != nil {
+				return
+			} else if ok {
+				updated++
+			}
+		}
+	}
+	return
+}
+
+// setVerifiedCohort adds the DynamoDbVerifiedTimeIndexPartitionKey attribute
+// to item's record.
+//
+// It returns false without an error if the record no longer exists or is no
+// longer verified.
+func (db *DynamoDb) setVerifiedCohort(
+	ctx context.Context, item dbAttributes,
+) (updated bool, err error) {
+	input := &dynamodb.UpdateItemInput{
+		TableName:           aws.String(db.TableName),
+		Key:                 dbAttributes{"email": item["email"]},
+		UpdateExpression:    aws.String("SET #c = :c"),
+		ConditionExpression: aws.String("attribute_exists(#v)"),
+		ExpressionAttributeNames: map[string]string{
+			"#c": DynamoDbVerifiedTimeIndexPartitionKey,
+			"#v": DynamoDbVerifiedIndexPartitionKey,
+		},
+		ExpressionAttributeValues: dbAttributes{":c": verifiedCohort},
+		ReturnConsumedCapacity:    db.returnConsumedCapacity(),
+	}
+	var output *dynamodb.UpdateItemOutput
+	var condErr *dbtypes.ConditionalCheckFailedException
+
+	if output, err = db.Client.UpdateItem(ctx, input); err == nil {
+		db.reportConsumedCapacity("UpdateItem", output.ConsumedCapacity)
+		updated = true
+	} else if errors.As(err, &condErr) {
+		err = nil
+	} else {
+		email, _ := (&dbParser{item}).GetString("email")
+		err = ops.AwsError("failed to update "+email, err)
+	}
+	return
+}
+
 func (db *DynamoDb) DeleteTable(ctx context.Context) (err error) {
 	input := &dynamodb.DeleteTableInput{TableName: aws.String(db.TableName)}
 	if _, err = db.Client.DeleteTable(ctx, input); err != nil {
@@ -208,10 +552,158 @@ type (
 	dbAttributes = map[string]dbtypes.AttributeValue
 )
 
+// lastEngagedAttr is only present for subscribers with a LastEngaged time.
+const lastEngagedAttr = "lastEngaged"
+
+// lastDeliveredAttr is only present for subscribers with a LastDelivered time.
+const lastDeliveredAttr = "lastDelivered"
+
+// confirmExpiryAttr is only present for subscribers with a ConfirmExpiry time.
+const confirmExpiryAttr = "confirmExpiry"
+
+// versionAttr is absent from records written before versioning existed.
+const versionAttr = "version"
+
 func subscriberKey(email string) dbAttributes {
 	return dbAttributes{"email": &dbString{Value: email}}
 }
 
+// verifiedCohort is the value of every DynamoDbVerifiedTimeIndexPartitionKey
+// attribute.
+var verifiedCohort = &dbString{Value: string(SubscriberVerified)}
+
+func subscriberItem(sub *Subscriber) dbAttributes {
+	item := dbAttributes{
+		"email":            &dbString{Value: sub.Email},
+		"uid":              &dbString{Value: sub.Uid.String()},
+		string(sub.Status): toDynamoDbTimestamp(sub.Timestamp),
+	}
+	if sub.Status == SubscriberVerified {
+		item[DynamoDbVerifiedTimeIndexPartitionKey] = verifiedCohort
+	}
+	if !sub.LastEngaged.IsZero() {
+		item[lastEngagedAttr] = toDynamoDbTimestamp(sub.LastEngaged)
+	}
+	if !sub.LastDelivered.IsZero() {
+		item[lastDeliveredAttr] = toDynamoDbTimestamp(sub.LastDelivered)
+	}
+	if !sub.ConfirmExpiry.IsZero() {
+		item[confirmExpiryAttr] = toDynamoDbTimestamp(sub.ConfirmExpiry)
+	}
+	if sub.Version != 0 {
+		item[versionAttr] = toDynamoDbNumber(sub.Version)
+	}
+	return item
+}
+
+type dynamoDbStartKey struct {
+	attrs dbAttributes
+}
+
+func (*dynamoDbStartKey) isDbStartKey() {}
+
+func toStartKeyAttrs(startKey StartKey) (dbAttributes, error) {
+	if startKey == nil {
+		return nil, nil
+	} else if key, ok := startKey.(*dynamoDbStartKey); !ok {
+		return nil, fmt.Errorf("not a *db.dynamoDbStartKey: %T", startKey)
+	} else {
+		return key.attrs, nil
+	}
+}
+
+func fromLastEvaluatedKey(attrs dbAttributes) StartKey {
+	if len(attrs) == 0 {
+		return nil
+	}
+	return &dynamoDbStartKey{attrs}
+}
+
+// startKeyAttr is the JSON representation of a StartKey attribute value.
+//
+// Key attributes are always strings or numbers, so only S or N will be set.
+type startKeyAttr struct {
+	S *string `json:",omitempty"`
+	N *string `json:",omitempty"`
+}
+
+// EncodeStartKey returns a token from which DecodeStartKey can recreate
+// startKey, e.g., to resume a paginated request in another process, or to pass
+// a "next page" token to and from a web UI.
+//
+// The token is the base64url encoded JSON representation of the key's
+// attributes, without padding, so it's safe to use in URLs. A nil startKey
+// produces the empty string.
+func EncodeStartKey(startKey StartKey) (string, error) {
+	attrs, err := toStartKeyAttrs(startKey)
+	if err != nil || attrs == nil {
+		return "", err
+	}
+
+	encoded := make(map[string]startKeyAttr, len(attrs))
+	for name, value := range attrs {
+		switch v := value.(type) {
+		case *dbString:
+			encoded[name] = startKeyAttr{S: &v.Value}
+		case *dbNumber:
+			encoded[name] = startKeyAttr{N: &v.Value}
+		default:
+			const errFmt = "unexpected start key attribute type: %s: %T"
+			return "", fmt.Errorf(errFmt, name, value)
+		}
+	}
+	result, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(result), nil
+}
+
+// DecodeStartKey recreates a StartKey from the output of EncodeStartKey.
+//
+// The empty string produces a nil StartKey. It also accepts the plain JSON
+// produced by earlier versions of EncodeStartKey, such as those saved in
+// existing revalidation checkpoint files.
+//
+// Since a token may come from an untrusted source, DecodeStartKey returns an
+// error for any token that doesn't contain a string "email" attribute, rather
+// than a key that would restart the request from the beginning or that
+// DynamoDB would reject.
+func DecodeStartKey(encoded string) (StartKey, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	data := []byte(encoded)
+	if !strings.HasPrefix(encoded, "{") {
+		var err error
+		if data, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid start key: %s: %w", encoded, err)
+		}
+	}
+
+	decoded := map[string]startKeyAttr{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid start key: %s: %w", encoded, err)
+	} else if email, ok := decoded["email"]; !ok || email.S == nil {
+		const errFmt = "invalid start key: %s: no email string attribute"
+		return nil, fmt.Errorf(errFmt, encoded)
+	}
+
+	attrs := make(dbAttributes, len(decoded))
+	for name, value := range decoded {
+		if value.S != nil {
+			attrs[name] = &dbString{Value: *value.S}
+		} else if value.N != nil {
+			attrs[name] = &dbNumber{Value: *value.N}
+		} else {
+			const errFmt = "invalid start key: %s: no value for %s"
+			return nil, fmt.Errorf(errFmt, encoded, name)
+		}
+	}
+	return fromLastEvaluatedKey(attrs), nil
+}
+
 type dbParser struct {
 	attrs dbAttributes
 }
@@ -249,6 +741,27 @@ func parseSubscriber(attrs dbAttributes) (subscriber *Subscriber, err error) {
 		addErr(err)
 	}
 
+	if _, engaged := attrs[lastEngagedAttr]; engaged {
+		if s.LastEngaged, err = p.GetTime(lastEngagedAttr); err != nil {
+			addErr(err)
+		}
+	}
+	if _, delivered := attrs[lastDeliveredAttr]; delivered {
+		if s.LastDelivered, err = p.GetTime(lastDeliveredAttr); err != nil {
+			addErr(err)
+		}
+	}
+	if _, expires := attrs[confirmExpiryAttr]; expires {
+		if s.ConfirmExpiry, err = p.GetTime(confirmExpiryAttr); err != nil {
+			addErr(err)
+		}
+	}
+	if _, versioned := attrs[versionAttr]; versioned {
+		if s.Version, err = p.GetInt64(versionAttr); err != nil {
+			addErr(err)
+		}
+	}
+
 	if err = errors.Join(errs...); err != nil {
 		err = errors.New("failed to parse subscriber: " + err.Error())
 	} else {
@@ -270,7 +783,17 @@ func (p *dbParser) GetUid(name string) (value uuid.UUID, err error) {
 }
 
 func toDynamoDbTimestamp(t time.Time) *dbNumber {
-	return &dbNumber{Value: strconv.FormatInt(t.Unix(), 10)}
+	return toDynamoDbNumber(t.Unix())
+}
+
+func toDynamoDbNumber(n int64) *dbNumber {
+	return &dbNumber{Value: strconv.FormatInt(n, 10)}
+}
+
+func (p *dbParser) GetInt64(name string) (value int64, err error) {
+	return getAttribute(name, p.attrs, func(attr *dbNumber) (int64, error) {
+		return strconv.ParseInt(attr.Value, 10, 64)
+	})
 }
 
 func (p *dbParser) GetTime(name string) (value time.Time, err error) {
@@ -304,13 +827,19 @@ func (db *DynamoDb) Get(
 	ctx context.Context, email string,
 ) (subscriber *Subscriber, err error) {
 	input := &dynamodb.GetItemInput{
-		Key: subscriberKey(email), TableName: aws.String(db.TableName),
+		Key:                    subscriberKey(email),
+		TableName:              aws.String(db.TableName),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
 	}
 	var output *dynamodb.GetItemOutput
 
 	if output, err = db.Client.GetItem(ctx, input); err != nil {
 		err = ops.AwsError("failed to get "+email, err)
-	} else if len(output.Item) == 0 {
+		return
+	}
+	db.reportConsumedCapacity("GetItem", output.ConsumedCapacity)
+
+	if len(output.Item) == 0 {
 		err = ErrSubscriberNotFound
 	} else {
 		subscriber, err = parseSubscriber(output.Item)
@@ -318,37 +847,322 @@ func (db *DynamoDb) Get(
 	return
 }
 
+// Put writes sub to the database only if its Version matches the stored record.
+//
+// A zero Version matches a nonexistent record or a record written before
+// versioning existed. On success, Put increments sub.Version. If the stored
+// record has a different version, Put returns ErrVersionConflict.
 func (db *DynamoDb) Put(ctx context.Context, sub *Subscriber) (err error) {
+	item := subscriberItem(sub)
+	item[versionAttr] = toDynamoDbNumber(sub.Version + 1)
 	input := &dynamodb.PutItemInput{
-		Item: dbAttributes{
-			"email":            &dbString{Value: sub.Email},
-			"uid":              &dbString{Value: sub.Uid.String()},
-			string(sub.Status): toDynamoDbTimestamp(sub.Timestamp),
+		Item:                     item,
+		TableName:                aws.String(db.TableName),
+		ConditionExpression:      aws.String("#v = :v"),
+		ExpressionAttributeNames: map[string]string{"#v": versionAttr},
+		ExpressionAttributeValues: dbAttributes{
+			":v": toDynamoDbNumber(sub.Version),
 		},
-		TableName: aws.String(db.TableName),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
 	}
-	if _, err = db.Client.PutItem(ctx, input); err != nil {
+	if sub.Version == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(#v)")
+		input.ExpressionAttributeValues = nil
+	}
+
+	var output *dynamodb.PutItemOutput
+	var condErr *dbtypes.ConditionalCheckFailedException
+
+	if output, err = db.Client.PutItem(ctx, input); err == nil {
+		db.reportConsumedCapacity("PutItem", output.ConsumedCapacity)
+		sub.Version++
+	} else if errors.As(err, &condErr) {
+		const errFmt = "failed to put %s: %w: expected version %d"
+		err = fmt.Errorf(errFmt, sub.Email, ErrVersionConflict, sub.Version)
+	} else {
 		err = ops.AwsError("failed to put "+sub.Email, err)
 	}
 	return
 }
 
+// PutIfAbsent writes sub to the database only if no record for it exists.
+//
+// Unlike Put, PutIfAbsent ignores sub.Version, so it won't overwrite a record
+// written before versioning existed. On success, PutIfAbsent sets sub.Version
+// to one. If a record already exists, PutIfAbsent returns ErrSubscriberExists.
+func (db *DynamoDb) PutIfAbsent(
+	ctx context.Context, sub *Subscriber,
+) (err error) {
+	item := subscriberItem(sub)
+	item[versionAttr] = toDynamoDbNumber(1)
+	input := &dynamodb.PutItemInput{
+		Item:                     item,
+		TableName:                aws.String(db.TableName),
+		ConditionExpression:      aws.String("attribute_not_exists(#e)"),
+		ExpressionAttributeNames: map[string]string{"#e": DynamoDbPrimaryKey},
+		ReturnConsumedCapacity:   db.returnConsumedCapacity(),
+	}
+
+	var output *dynamodb.PutItemOutput
+	var condErr *dbtypes.ConditionalCheckFailedException
+
+	if output, err = db.Client.PutItem(ctx, input); err == nil {
+		db.reportConsumedCapacity("PutItem", output.ConsumedCapacity)
+		sub.Version = 1
+	} else if errors.As(err, &condErr) {
+		err = fmt.Errorf("failed to put %s: %w", sub.Email, ErrSubscriberExists)
+	} else {
+		err = ops.AwsError("failed to put "+sub.Email, err)
+	}
+	return
+}
+
+// PutBatch writes subs to the database via BatchWriteItem, in chunks of 25.
+//
+// Unlike Put, PutBatch doesn't check Versions and will overwrite existing
+// records, since BatchWriteItem doesn't support conditions. It's intended for
+// seeding or restoring the database with many subscribers at once. It
+// increments the Version of each subscriber it writes.
+//
+// PutBatch retries items that DynamoDB leaves unprocessed, pausing according to
+// BatchBackoff, up to a fixed number of attempts per chunk. It returns every
+// subscriber it couldn't write. If BatchWriteItem fails, PutBatch returns the
+// error immediately, and failed will include all subscribers not yet written.
+//
+// The email addresses within subs must be unique, since BatchWriteItem rejects
+// duplicate keys within the same request.
+func (db *DynamoDb) PutBatch(
+	ctx context.Context, subs []*Subscriber,
+) (failed []*Subscriber, err error) {
+	return db.putBatch(ctx, subs, false)
+}
+
+// PutBatchIfAbsent is like PutBatch, but never overwrites an existing record.
+//
+// Since BatchWriteItem doesn't support conditions, PutBatchIfAbsent first reads
+// each chunk via BatchGetItem. For each subscriber that already exists, it
+// skips the write and replaces the subscriber's fields with those of the stored
+// record, preserving its Uid, Status, Timestamp, and Version.
+//
+// It also retries keys that BatchGetItem leaves unprocessed, and returns every
+// subscriber it couldn't check or write. If BatchGetItem fails,
+// PutBatchIfAbsent returns the error immediately, and failed will include all
+// subscribers not yet written.
+//
+// A record written between a chunk's BatchGetItem and BatchWriteItem calls may
+// still be overwritten. Callers needing a strict guarantee should use Put or
+// PutIfAbsent.
+func (db *DynamoDb) PutBatchIfAbsent(
+	ctx context.Context, subs []*Subscriber,
+) (failed []*Subscriber, err error) {
+	return db.putBatch(ctx, subs, true)
+}
+
+func (db *DynamoDb) putBatch(
+	ctx context.Context, subs []*Subscriber, skipExisting bool,
+) (failed []*Subscriber, err error) {
+	for start := 0; start < len(subs); start += batchWriteMaxItems {
+		end := min(start+batchWriteMaxItems, len(subs))
+		var unwritten []*Subscriber
+
+		unwritten, err = db.putChunk(ctx, subs[start:end], skipExisting)
+		failed = append(failed, unwritten...)
+
+		if err != nil {
+			failed = append(failed, subs[end:]...)
+			return
+		}
+	}
+	return
+}
+
+func (db *DynamoDb) putChunk(
+	ctx context.Context, chunk []*Subscriber, skipExisting bool,
+) (unwritten []*Subscriber, err error) {
+	absent := chunk
+
+	if skipExisting {
+		if absent, unwritten, err = db.findAbsent(ctx, chunk); err != nil {
+			return
+		}
+	}
+	if len(absent) == 0 {
+		return
+	}
+	requests := make([]dbtypes.WriteRequest, len(absent))
+
+	for i, sub := range absent {
+		item := subscriberItem(sub)
+		item[versionAttr] = toDynamoDbNumber(sub.Version + 1)
+		requests[i] = dbtypes.WriteRequest{
+			PutRequest: &dbtypes.PutRequest{Item: item},
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		input := &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]dbtypes.WriteRequest{
+				db.TableName: requests,
+			},
+		}
+		var output *dynamodb.BatchWriteItemOutput
+
+		if output, err = db.Client.BatchWriteItem(ctx, input); err != nil {
+			const errFmt = "failed to put batch of %d starting with %s"
+			msg := fmt.Sprintf(errFmt, len(absent), absent[0].Email)
+			err = ops.AwsError(msg, err)
+			break
+		}
+		requests = output.UnprocessedItems[db.TableName]
+
+		if len(requests) == 0 || attempt == batchWriteMaxAttempts {
+			break
+		}
+		delay := db.batchBackoff().NextDelay(attempt)
+		if err = db.sleep(ctx, delay); err != nil {
+			const errFmt = "failed to put batch of %d starting with %s: %w"
+			err = fmt.Errorf(errFmt, len(absent), absent[0].Email, err)
+			break
+		}
+	}
+
+	remaining := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		email, _ := (&dbParser{req.PutRequest.Item}).GetString("email")
+		remaining[email] = true
+	}
+	for _, sub := range absent {
+		if remaining[sub.Email] {
+			unwritten = append(unwritten, sub)
+		} else {
+			sub.Version++
+		}
+	}
+	return
+}
+
+// findAbsent returns the subscribers from chunk that have no stored record.
+//
+// It replaces the fields of every other subscriber in chunk with those of its
+// stored record. unchecked contains the subscribers whose keys remained
+// unprocessed after the final BatchGetItem attempt. If BatchGetItem fails,
+// unchecked contains the entire chunk.
+func (db *DynamoDb) findAbsent(
+	ctx context.Context, chunk []*Subscriber,
+) (absent, unchecked []*Subscriber, err error) {
+	keys := make([]map[string]dbtypes.AttributeValue, len(chunk))
+	for i, sub := range chunk {
+		keys[i] = subscriberKey(sub.Email)
+	}
+	stored := make(map[string]*Subscriber, len(chunk))
+
+	for attempt := 1; ; attempt++ {
+		input := &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]dbtypes.KeysAndAttributes{
+				db.TableName: {Keys: keys, ConsistentRead: aws.Bool(true)},
+			},
+		}
+		var output *dynamodb.BatchGetItemOutput
+
+		if output, err = db.Client.BatchGetItem(ctx, input); err != nil {
+			const errFmt = "failed to get batch of %d starting with %s"
+			msg := fmt.Sprintf(errFmt, len(chunk), chunk[0].Email)
+			return nil, chunk, ops.AwsError(msg, err)
+		}
+		for _, item := range output.Responses[db.TableName] {
+			var sub *Subscriber
+			if sub, err = parseSubscriber(item); err != nil {
+				return nil, chunk, err
+			}
+			stored[sub.Email] = sub
+		}
+		keys = output.UnprocessedKeys[db.TableName].Keys
+
+		if len(keys) == 0 || attempt == batchWriteMaxAttempts {
+			break
+		}
+		delay := db.batchBackoff().NextDelay(attempt)
+		if err = db.sleep(ctx, delay); err != nil {
+			const errFmt = "failed to get batch of %d starting with %s: %w"
+			err = fmt.Errorf(errFmt, len(chunk), chunk[0].Email, err)
+			return nil, chunk, err
+		}
+	}
+
+	remaining := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		email, _ := (&dbParser{key}).GetString("email")
+		remaining[email] = true
+	}
+	for _, sub := range chunk {
+		if remaining[sub.Email] {
+			unchecked = append(unchecked, sub)
+		} else if existing, ok := stored[sub.Email]; ok {
+			*sub = *existing
+		} else {
+			absent = append(absent, sub)
+		}
+	}
+	return
+}
+
+func (db *DynamoDb) batchBackoff() ops.Backoff {
+	if db.BatchBackoff != nil {
+		return db.BatchBackoff
+	}
+	return DefaultBatchBackoff
+}
+
+func (db *DynamoDb) sleep(ctx context.Context, d time.Duration) error {
+	if db.Sleep != nil {
+		return db.Sleep(ctx, d)
+	}
+	return ops.Sleep(ctx, d)
+}
+
 func (db *DynamoDb) Delete(ctx context.Context, email string) (err error) {
 	input := &dynamodb.DeleteItemInput{
-		Key: subscriberKey(email), TableName: aws.String(db.TableName),
+		Key:                    subscriberKey(email),
+		TableName:              aws.String(db.TableName),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
 	}
-	if _, err = db.Client.DeleteItem(ctx, input); err != nil {
+	var output *dynamodb.DeleteItemOutput
+
+	if output, err = db.Client.DeleteItem(ctx, input); err != nil {
 		err = ops.AwsError("failed to delete "+email, err)
+	} else {
+		db.reportConsumedCapacity("DeleteItem", output.ConsumedCapacity)
 	}
 	return
 }
 
 func (db *DynamoDb) ProcessSubscribers(
 	ctx context.Context, status SubscriberStatus, sp SubscriberProcessor,
+) error {
+	processPage := func(page []*Subscriber) (bool, error) {
+		for _, sub := range page {
+			if !sp.Process(sub) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return db.ProcessSubscriberPages(ctx, status, processPage)
+}
+
+// ProcessSubscriberPages calls processPage once for each page of a Scan.
+//
+// If any Subscriber in a page fails to parse, it returns an error without
+// calling processPage for that page.
+func (db *DynamoDb) ProcessSubscriberPages(
+	ctx context.Context,
+	status SubscriberStatus,
+	processPage SubscriberPageFunc,
 ) error {
 	input := &dynamodb.ScanInput{
-		TableName: aws.String(db.TableName),
-		IndexName: aws.String(string(status)),
+		TableName:              aws.String(db.TableName),
+		IndexName:              aws.String(string(status)),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
 	}
 	paginator := dynamodb.NewScanPaginator(db.Client, input)
 
@@ -359,12 +1173,169 @@ func (db *DynamoDb) ProcessSubscribers(
 			prefix := fmt.Sprintf("failed to get %s subscribers", status)
 			return ops.AwsError(prefix, err)
 		}
+		db.reportConsumedCapacity("Scan", output.ConsumedCapacity)
 
-		for _, item := range output.Items {
-			if s, err := parseSubscriber(item); err != nil || !sp.Process(s) {
+		page := make([]*Subscriber, len(output.Items))
+		for i, item := range output.Items {
+			if page[i], err = parseSubscriber(item); err != nil {
 				return err
 			}
 		}
+
+		if ok, err := processPage(page); err != nil || !ok {
+			return err
+		}
 	}
 	return nil
 }
+
+// GetSubscribersPage returns one page of the subscribers in status.
+//
+// It scans the same index as ProcessSubscriberPages, starting after startKey,
+// returning up to limit subscribers. A limit less than one returns as many
+// subscribers as fit in a single Scan response. Pass a nil startKey to
+// retrieve the first page, then pass the returned nextStartKey to retrieve
+// each subsequent page. nextStartKey will be nil once there are no more
+// results.
+func (db *DynamoDb) GetSubscribersPage(
+	ctx context.Context,
+	status SubscriberStatus,
+	startKey StartKey,
+	limit int,
+) (subs []*Subscriber, nextStartKey StartKey, err error) {
+	input := &dynamodb.ScanInput{
+		TableName:              aws.String(db.TableName),
+		IndexName:              aws.String(string(status)),
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(int32(limit))
+	}
+	var output *dynamodb.ScanOutput
+
+	if input.ExclusiveStartKey, err = toStartKeyAttrs(startKey); err != nil {
+		return
+	} else if output, err = db.Client.Scan(ctx, input); err != nil {
+		prefix := fmt.Sprintf("failed to get %s subscribers", status)
+		err = ops.AwsError(prefix, err)
+		return
+	}
+	db.reportConsumedCapacity("Scan", output.ConsumedCapacity)
+
+	subs = make([]*Subscriber, len(output.Items))
+	for i, item := range output.Items {
+		if subs[i], err = parseSubscriber(item); err != nil {
+			return nil, nil, err
+		}
+	}
+	nextStartKey = fromLastEvaluatedKey(output.LastEvaluatedKey)
+	return
+}
+
+// StartKeyAfter returns a StartKey for resuming GetSubscribersPage for
+// sub.Status immediately after sub.
+//
+// This enables an operation interrupted partway through a page to resume
+// without repeating the subscribers it already processed.
+func (db *DynamoDb) StartKeyAfter(sub *Subscriber) (StartKey, error) {
+	// A Scan of a Global Secondary Index returns a LastEvaluatedKey
+	// containing both the table's primary key and the index's key.
+	attrs := subscriberKey(sub.Email)
+	attrs[string(sub.Status)] = toDynamoDbTimestamp(sub.Timestamp)
+	return &dynamoDbStartKey{attrs}, nil
+}
+
+// CountSubscribersInState returns the number of subscribers in status.
+//
+// It scans the same index as ProcessSubscriberPages, but with Select set to
+// COUNT, so DynamoDB returns only the number of items on each page.
+func (db *DynamoDb) CountSubscribersInState(
+	ctx context.Context, status SubscriberStatus,
+) (count int64, err error) {
+	input := &dynamodb.ScanInput{
+		TableName:              aws.String(db.TableName),
+		IndexName:              aws.String(string(status)),
+		Select:                 dbtypes.SelectCount,
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
+	}
+	paginator := dynamodb.NewScanPaginator(db.Client, input)
+
+	for paginator.HasMorePages() {
+		var output *dynamodb.ScanOutput
+
+		if output, err = paginator.NextPage(ctx); err != nil {
+			prefix := fmt.Sprintf("failed to count %s subscribers", status)
+			return 0, ops.AwsError(prefix, err)
+		}
+		db.reportConsumedCapacity("Scan", output.ConsumedCapacity)
+		count += int64(output.Count)
+	}
+	return
+}
+
+// GetSubscribersVerifiedBetween returns verified subscribers whose verification
+// timestamps fall within the range [start, end].
+//
+// It queries the DynamoDbVerifiedTimeIndexName index, retrieving one page of
+// results at a time. Pass a nil startKey to retrieve the first page, then pass
+// the returned nextStartKey to retrieve each subsequent page. nextStartKey will
+// be nil once there are no more results.
+func (db *DynamoDb) GetSubscribersVerifiedBetween(
+	ctx context.Context, start, end time.Time, startKey StartKey,
+) (subs []*Subscriber, nextStartKey StartKey, err error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(db.TableName),
+		IndexName:              aws.String(DynamoDbVerifiedTimeIndexName),
+		KeyConditionExpression: aws.String("#c = :c AND #t BETWEEN :s AND :e"),
+		ExpressionAttributeNames: map[string]string{
+			"#c": DynamoDbVerifiedTimeIndexPartitionKey,
+			"#t": DynamoDbVerifiedTimeIndexSortKey,
+		},
+		ExpressionAttributeValues: dbAttributes{
+			":c": verifiedCohort,
+			":s": toDynamoDbTimestamp(start),
+			":e": toDynamoDbTimestamp(end),
+		},
+		ReturnConsumedCapacity: db.returnConsumedCapacity(),
+	}
+	var output *dynamodb.QueryOutput
+
+	if input.ExclusiveStartKey, err = toStartKeyAttrs(startKey); err != nil {
+		return
+	} else if output, err = db.Client.Query(ctx, input); err != nil {
+		const errFmt = "failed to get subscribers verified between %s and %s"
+		prefix := fmt.Sprintf(
+			errFmt, start.Format(TimestampFormat), end.Format(TimestampFormat),
+		)
+		err = ops.AwsError(prefix, err)
+		return
+	}
+	db.reportConsumedCapacity("Query", output.ConsumedCapacity)
+
+	subs = make([]*Subscriber, 0, len(output.Items))
+	for _, item := range output.Items {
+		var sub *Subscriber
+		if sub, err = parseSubscriber(item); err != nil {
+			return nil, nil, err
+		}
+		subs = append(subs, sub)
+	}
+	nextStartKey = fromLastEvaluatedKey(output.LastEvaluatedKey)
+	return
+}
+
+func (db *DynamoDb) returnConsumedCapacity() dbtypes.ReturnConsumedCapacity {
+	if db.ReportConsumedCapacity == nil {
+		return ""
+	}
+	return dbtypes.ReturnConsumedCapacityTotal
+}
+
+func (db *DynamoDb) reportConsumedCapacity(
+	operation string, capacity *dbtypes.ConsumedCapacity,
+) {
+	if db.ReportConsumedCapacity != nil && capacity != nil {
+		units := aws.ToFloat64(capacity.CapacityUnits)
+		db.ReportConsumedCapacity(operation, units)
+	}
+}
@@ -244,7 +244,126 @@ func TestDynamoDb(t *testing.T) {
 		})
 	})
 
+	t.Run("PutBatchSucceeds", func(t *testing.T) {
+		subs := make([]*Subscriber, 30)
+		for i := range subs {
+			subs[i] = newTestSubscriber()
+			defer testDb.Delete(ctx, subs[i].Email)
+		}
+
+		failed, err := testDb.PutBatch(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		for _, sub := range subs {
+			retrieved, err := testDb.Get(ctx, sub.Email)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, sub, retrieved)
+		}
+	})
+
+	t.Run("PutBatchOverwritesExistingRecords", func(t *testing.T) {
+		existing := newTestSubscriber()
+		defer testDb.Delete(ctx, existing.Email)
+		assert.NilError(t, testDb.Put(ctx, existing))
+
+		restored := NewSubscriber(existing.Email)
+		failed, err := testDb.PutBatch(ctx, []*Subscriber{restored})
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		retrieved, err := testDb.Get(ctx, existing.Email)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, restored, retrieved)
+	})
+
+	t.Run("PutBatchIfAbsentPreservesExistingRecords", func(t *testing.T) {
+		existing := newTestSubscriber()
+		defer testDb.Delete(ctx, existing.Email)
+		assert.NilError(t, testDb.Put(ctx, existing))
+
+		reimported := NewSubscriber(existing.Email)
+		failed, err := testDb.PutBatchIfAbsent(ctx, []*Subscriber{reimported})
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.DeepEqual(t, existing, reimported)
+		retrieved, err := testDb.Get(ctx, existing.Email)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, existing, retrieved)
+	})
+
+	t.Run("PutIncrementsVersion", func(t *testing.T) {
+		subscriber := newTestSubscriber()
+		defer testDb.Delete(ctx, subscriber.Email)
+
+		firstErr := testDb.Put(ctx, subscriber)
+		secondErr := testDb.Put(ctx, subscriber)
+		retrieved, getErr := testDb.Get(ctx, subscriber.Email)
+
+		assert.NilError(t, firstErr)
+		assert.NilError(t, secondErr)
+		assert.NilError(t, getErr)
+		assert.Equal(t, int64(2), retrieved.Version)
+	})
+
+	t.Run("PutIfAbsentCreatesNewRecord", func(t *testing.T) {
+		subscriber := newTestSubscriber()
+		defer testDb.Delete(ctx, subscriber.Email)
+
+		putErr := testDb.PutIfAbsent(ctx, subscriber)
+		retrieved, getErr := testDb.Get(ctx, subscriber.Email)
+
+		assert.NilError(t, putErr)
+		assert.NilError(t, getErr)
+		assert.DeepEqual(t, subscriber, retrieved)
+		assert.Equal(t, int64(1), retrieved.Version)
+	})
+
+	t.Run("PutIfAbsentFailsIfRecordExists", func(t *testing.T) {
+		subscriber := newTestSubscriber()
+		defer testDb.Delete(ctx, subscriber.Email)
+		subscriber.Status = SubscriberVerified
+		assert.NilError(t, testDb.Put(ctx, subscriber))
+		duplicate := newTestSubscriber()
+		duplicate.Email = subscriber.Email
+
+		err := testDb.PutIfAbsent(ctx, duplicate)
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrSubscriberExists))
+		assert.Assert(t, testutils.ErrorIsNot(err, ops.ErrExternal))
+		retrieved, getErr := testDb.Get(ctx, subscriber.Email)
+		assert.NilError(t, getErr)
+		assert.DeepEqual(t, subscriber, retrieved)
+	})
+
 	t.Run("PutFails", func(t *testing.T) {
+		t.Run("IfVersionConflicts", func(t *testing.T) {
+			subscriber := newTestSubscriber()
+			defer testDb.Delete(ctx, subscriber.Email)
+			assert.NilError(t, testDb.Put(ctx, subscriber))
+			stale, err := testDb.Get(ctx, subscriber.Email)
+			assert.NilError(t, err)
+			assert.NilError(t, testDb.Put(ctx, subscriber))
+
+			err = testDb.Put(ctx, stale)
+
+			assert.Assert(t, testutils.ErrorIs(err, ErrVersionConflict))
+			assert.Assert(t, testutils.ErrorIsNot(err, ops.ErrExternal))
+		})
+
+		t.Run("IfNewRecordAlreadyExists", func(t *testing.T) {
+			subscriber := newTestSubscriber()
+			defer testDb.Delete(ctx, subscriber.Email)
+			assert.NilError(t, testDb.Put(ctx, subscriber))
+			duplicate := *subscriber
+			duplicate.Version = 0
+
+			err := testDb.Put(ctx, &duplicate)
+
+			assert.Assert(t, testutils.ErrorIs(err, ErrVersionConflict))
+		})
+
 		t.Run("IfTableDoesNotExist", func(t *testing.T) {
 			subscriber := newTestSubscriber()
 
@@ -301,5 +420,83 @@ func TestDynamoDb(t *testing.T) {
 			assert.NilError(t, err)
 			assert.DeepEqual(t, sorted(TestVerifiedSubscribers), sorted(*subs))
 		})
+
+		t.Run("CountSubscribersInStateSucceeds", func(t *testing.T) {
+			status := SubscriberVerified
+
+			count, err := testDb.CountSubscribersInState(ctx, status)
+
+			assert.NilError(t, err)
+			assert.Equal(t, int64(len(TestVerifiedSubscribers)), count)
+		})
+
+		t.Run("ProcessSubscriberPagesSucceeds", func(t *testing.T) {
+			subs := []*Subscriber{}
+			f := func(page []*Subscriber) (bool, error) {
+				subs = append(subs, page...)
+				return true, nil
+			}
+
+			err := testDb.ProcessSubscriberPages(ctx, SubscriberVerified, f)
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, sorted(TestVerifiedSubscribers), sorted(subs))
+		})
+
+		t.Run("GetSubscribersVerifiedBetween", func(t *testing.T) {
+			getAll := func(start, end time.Time) ([]*Subscriber, error) {
+				subs := []*Subscriber{}
+				var startKey StartKey
+
+				for {
+					page, next, err := testDb.GetSubscribersVerifiedBetween(
+						ctx, start, end, startKey,
+					)
+					if err != nil {
+						return nil, err
+					}
+					subs = append(subs, page...)
+
+					if startKey = next; startKey == nil {
+						return subs, nil
+					}
+				}
+			}
+
+			t.Run("ReturnsOnlySubscribersInRange", func(t *testing.T) {
+				start := TestVerifiedSubscribers[1].Timestamp
+				end := TestVerifiedSubscribers[2].Timestamp
+
+				subs, err := getAll(start, end)
+
+				assert.NilError(t, err)
+				expected := TestVerifiedSubscribers[1:]
+				assert.DeepEqual(t, sorted(expected), sorted(subs))
+			})
+
+			t.Run("ReturnsNothingIfNoneInRange", func(t *testing.T) {
+				start := TestVerifiedSubscribers[0].Timestamp.Add(time.Hour)
+				end := TestVerifiedSubscribers[1].Timestamp.Add(-time.Hour)
+
+				subs, err := getAll(start, end)
+
+				assert.NilError(t, err)
+				assert.Equal(t, 0, len(subs))
+			})
+
+			t.Run("FailsIfTableDoesNotExist", func(t *testing.T) {
+				start := TestVerifiedSubscribers[0].Timestamp
+
+				subs, next, err := badDb.GetSubscribersVerifiedBetween(
+					ctx, start, start, nil,
+				)
+
+				assert.Assert(t, is.Nil(subs))
+				assert.Assert(t, is.Nil(next))
+				expected := "failed to get subscribers verified between "
+				assert.ErrorContains(t, err, expected)
+				assert.Assert(t, testutils.ErrorIsNot(err, ops.ErrExternal))
+			})
+		})
 	})
 }
@@ -4,13 +4,18 @@ package db
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testdata"
 	tu "github.com/mbland/elistman/testutils"
@@ -25,7 +30,7 @@ func checkIsExternalError(t *testing.T, err error) {
 
 func TestDynamodDbMethodsReturnExternalErrorsAsAppropriate(t *testing.T) {
 	client := &TestDynamoDbClient{}
-	dyndb := &DynamoDb{client, "subscribers-table"}
+	dyndb := &DynamoDb{Client: client, TableName: "subscribers-table"}
 	ctx := context.Background()
 
 	// All these methods are tested in dynamodb_contract_test, and none of those
@@ -51,8 +56,242 @@ func TestDynamodDbMethodsReturnExternalErrorsAsAppropriate(t *testing.T) {
 	err = dyndb.Put(ctx, &Subscriber{})
 	checkIsExternalError(t, err)
 
+	_, err = dyndb.PutBatch(ctx, []*Subscriber{{}})
+	checkIsExternalError(t, err)
+
+	_, err = dyndb.PutBatchIfAbsent(ctx, []*Subscriber{{}})
+	checkIsExternalError(t, err)
+
+	_, err = dyndb.CountSubscribersInState(ctx, SubscriberVerified)
+	checkIsExternalError(t, err)
+
 	err = dyndb.Delete(ctx, testdata.TestEmail)
 	checkIsExternalError(t, err)
+
+	now := time.Now()
+	_, _, err = dyndb.GetSubscribersVerifiedBetween(ctx, now, now, nil)
+	checkIsExternalError(t, err)
+
+	_, _, err = dyndb.UpgradeSubscribersTable(ctx)
+	checkIsExternalError(t, err)
+
+	_, _, err = dyndb.GetSubscribersPage(ctx, SubscriberVerified, nil, 0)
+	checkIsExternalError(t, err)
+}
+
+type bogusStartKey struct{}
+
+func (*bogusStartKey) isDbStartKey() {}
+
+func TestStartKeyConversion(t *testing.T) {
+	t.Run("NilStartKeyProducesNilAttributes", func(t *testing.T) {
+		attrs, err := toStartKeyAttrs(nil)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(attrs))
+	})
+
+	t.Run("EmptyAttributesProduceNilStartKey", func(t *testing.T) {
+		assert.Assert(t, is.Nil(fromLastEvaluatedKey(dbAttributes{})))
+	})
+
+	t.Run("RoundTripSucceeds", func(t *testing.T) {
+		key := subscriberKey(testdata.TestEmail)
+
+		attrs, err := toStartKeyAttrs(fromLastEvaluatedKey(key))
+
+		assert.NilError(t, err)
+		email, err := (&dbParser{attrs}).GetString("email")
+		assert.NilError(t, err)
+		assert.Equal(t, testdata.TestEmail, email)
+	})
+
+	t.Run("FailsIfNotADynamoDbStartKey", func(t *testing.T) {
+		attrs, err := toStartKeyAttrs(&bogusStartKey{})
+
+		assert.Assert(t, is.Nil(attrs))
+		assert.ErrorContains(t, err, "not a *db.dynamoDbStartKey: ")
+	})
+}
+
+func TestEncodeStartKey(t *testing.T) {
+	t.Run("NilStartKeyProducesEmptyString", func(t *testing.T) {
+		encoded, err := EncodeStartKey(nil)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", encoded)
+	})
+
+	t.Run("EmptyStringProducesNilStartKey", func(t *testing.T) {
+		startKey, err := DecodeStartKey("")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(startKey))
+	})
+
+	t.Run("RoundTripSucceeds", func(t *testing.T) {
+		key := subscriberKey(testdata.TestEmail)
+		key["verified"] = toDynamoDbTimestamp(testdata.TestTimestamp)
+
+		encoded, err := EncodeStartKey(fromLastEvaluatedKey(key))
+		assert.NilError(t, err)
+		startKey, err := DecodeStartKey(encoded)
+		assert.NilError(t, err)
+
+		attrs, err := toStartKeyAttrs(startKey)
+		assert.NilError(t, err)
+		parser := &dbParser{attrs}
+		email, err := parser.GetString("email")
+		assert.NilError(t, err)
+		assert.Equal(t, testdata.TestEmail, email)
+		verified, err := parser.GetTime("verified")
+		assert.NilError(t, err)
+		assert.Equal(t, testdata.TestTimestamp, verified)
+	})
+
+	t.Run("FailsIfNotADynamoDbStartKey", func(t *testing.T) {
+		encoded, err := EncodeStartKey(&bogusStartKey{})
+
+		assert.Equal(t, "", encoded)
+		assert.ErrorContains(t, err, "not a *db.dynamoDbStartKey: ")
+	})
+
+	t.Run("FailsIfAttributeTypeUnexpected", func(t *testing.T) {
+		attrs := dbAttributes{"foo": &types.AttributeValueMemberBOOL{}}
+		key := fromLastEvaluatedKey(attrs)
+
+		encoded, err := EncodeStartKey(key)
+
+		assert.Equal(t, "", encoded)
+		assert.ErrorContains(t, err, "unexpected start key attribute type: foo")
+	})
+
+	t.Run("ProducesUrlSafeToken", func(t *testing.T) {
+		// Standard base64 would encode this key using both "/" and "+".
+		key := subscriberKey("???~~~@foo.com")
+
+		encoded, err := EncodeStartKey(fromLastEvaluatedKey(key))
+
+		assert.NilError(t, err)
+		assert.Equal(t, url.QueryEscape(encoded), encoded)
+		assert.Assert(t, !strings.ContainsAny(encoded, "{}\"\n="))
+	})
+
+	t.Run("DecodesJsonFromEarlierVersions", func(t *testing.T) {
+		startKey, err := DecodeStartKey(`{"email":{"S":"foo@test.com"}}`)
+
+		assert.NilError(t, err)
+		encoded, err := EncodeStartKey(startKey)
+		assert.NilError(t, err)
+		assert.Equal(t, "eyJlbWFpbCI6eyJTIjoiZm9vQHRlc3QuY29tIn19", encoded)
+	})
+
+	t.Run("FailsIfNotBase64", func(t *testing.T) {
+		startKey, err := DecodeStartKey("not base64!")
+
+		assert.Assert(t, is.Nil(startKey))
+		assert.ErrorContains(t, err, "invalid start key: not base64!: ")
+	})
+
+	t.Run("FailsIfNotJson", func(t *testing.T) {
+		token := base64.RawURLEncoding.EncodeToString([]byte("not JSON"))
+
+		startKey, err := DecodeStartKey(token)
+
+		assert.Assert(t, is.Nil(startKey))
+		assert.ErrorContains(t, err, "invalid start key: "+token+": ")
+	})
+
+	t.Run("FailsIfTruncated", func(t *testing.T) {
+		key := subscriberKey(testdata.TestEmail)
+		encoded, err := EncodeStartKey(fromLastEvaluatedKey(key))
+		assert.NilError(t, err)
+
+		startKey, err := DecodeStartKey(encoded[:len(encoded)-4])
+
+		assert.Assert(t, is.Nil(startKey))
+		assert.ErrorContains(t, err, "invalid start key: ")
+	})
+
+	t.Run("FailsIfMissingEmail", func(t *testing.T) {
+		for _, token := range []string{
+			"{}",
+			`{"verified":{"N":"22509900"}}`,
+			`{"email":{"N":"22509900"}}`,
+			base64.RawURLEncoding.EncodeToString([]byte("null")),
+		} {
+			startKey, err := DecodeStartKey(token)
+
+			assert.Assert(t, is.Nil(startKey), token)
+			assert.ErrorContains(t, err, "no email string attribute")
+		}
+	})
+
+	t.Run("FailsIfAttributeHasNoValue", func(t *testing.T) {
+		startKey, err := DecodeStartKey(
+			`{"email":{"S":"foo@test.com"},"verified":{}}`,
+		)
+
+		assert.Assert(t, is.Nil(startKey))
+		assert.ErrorContains(t, err, "no value for verified")
+	})
+}
+
+func TestNewDynamoDb(t *testing.T) {
+	newDb := func(opts ...DynamoDbOption) (*DynamoDb, *TestDynamoDbClient) {
+		client := NewTestDynamoDbClient()
+		dyndb := NewDynamoDb(aws.Config{}, "subscribers", opts...)
+		dyndb.Client = client
+		return dyndb, client
+	}
+
+	t.Run("UsesTableNameAsIsByDefault", func(t *testing.T) {
+		dyndb, _ := newDb()
+
+		assert.Equal(t, "subscribers", dyndb.TableName)
+	})
+
+	t.Run("SetsTableWaitDelay", func(t *testing.T) {
+		dyndb, _ := newDb(WithTableWaitDelay(time.Second, time.Minute))
+
+		assert.Equal(t, time.Second, dyndb.TableWaitMinDelay)
+		assert.Equal(t, time.Minute, dyndb.TableWaitMaxDelay)
+	})
+
+	t.Run("CustomEndpointAppliesOptions", func(t *testing.T) {
+		dyndb := NewDynamoDbWithCustomEndpoint(
+			aws.Config{},
+			"subscribers",
+			"http://localhost:8000/",
+			WithTableWaitDelay(time.Second, time.Minute),
+		)
+
+		assert.Equal(t, "subscribers", dyndb.TableName)
+		assert.Equal(t, time.Second, dyndb.TableWaitMinDelay)
+	})
+
+	t.Run("RequestsUseTableName", func(t *testing.T) {
+		dyndb, client := newDb()
+		ctx := context.Background()
+		const expected = "subscribers"
+
+		err := dyndb.CreateSubscribersTable(ctx, time.Nanosecond)
+		assert.NilError(t, err)
+		err = dyndb.ProcessSubscribers(
+			ctx,
+			SubscriberVerified,
+			SubscriberFunc(func(*Subscriber) bool { return true }),
+		)
+		assert.NilError(t, err)
+		err = dyndb.DeleteTable(ctx)
+		assert.NilError(t, err)
+
+		tu.AssertAwsStringEqual(t, expected, client.CreateTableInput.TableName)
+		tu.AssertAwsStringEqual(t, expected, client.DescTableInput.TableName)
+		tu.AssertAwsStringEqual(t, expected, client.UpdateTtlInput.TableName)
+		tu.AssertAwsStringEqual(t, expected, client.ScanInput.TableName)
+		tu.AssertAwsStringEqual(t, expected, client.DeleteTableInput.TableName)
+	})
 }
 
 func TestGetAttribute(t *testing.T) {
@@ -120,6 +359,60 @@ func TestParseSubscriber(t *testing.T) {
 		})
 	})
 
+	t.Run("SucceedsWithLastEngaged", func(t *testing.T) {
+		engaged := testdata.TestTimestamp.Add(time.Hour)
+		attrs := dbAttributes{
+			"email":         &dbString{Value: testdata.TestEmail},
+			"uid":           &dbString{Value: testdata.TestUidStr},
+			"verified":      toDynamoDbTimestamp(testdata.TestTimestamp),
+			lastEngagedAttr: toDynamoDbTimestamp(engaged),
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, subscriber.LastEngaged.Equal(engaged))
+		item := subscriberItem(subscriber)
+		expected := toDynamoDbTimestamp(engaged).Value
+		assert.Equal(t, expected, item[lastEngagedAttr].(*dbNumber).Value)
+	})
+
+	t.Run("SucceedsWithLastDelivered", func(t *testing.T) {
+		delivered := testdata.TestTimestamp.Add(time.Hour)
+		attrs := dbAttributes{
+			"email":           &dbString{Value: testdata.TestEmail},
+			"uid":             &dbString{Value: testdata.TestUidStr},
+			"verified":        toDynamoDbTimestamp(testdata.TestTimestamp),
+			lastDeliveredAttr: toDynamoDbTimestamp(delivered),
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, subscriber.LastDelivered.Equal(delivered))
+		item := subscriberItem(subscriber)
+		expected := toDynamoDbTimestamp(delivered).Value
+		assert.Equal(t, expected, item[lastDeliveredAttr].(*dbNumber).Value)
+	})
+
+	t.Run("SucceedsWithConfirmExpiry", func(t *testing.T) {
+		expiry := testdata.TestTimestamp.Add(time.Hour)
+		attrs := dbAttributes{
+			"email":           &dbString{Value: testdata.TestEmail},
+			"uid":             &dbString{Value: testdata.TestUidStr},
+			"pending":         toDynamoDbTimestamp(testdata.TestTimestamp),
+			confirmExpiryAttr: toDynamoDbTimestamp(expiry),
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, subscriber.ConfirmExpiry.Equal(expiry))
+		item := subscriberItem(subscriber)
+		expected := toDynamoDbTimestamp(expiry).Value
+		assert.Equal(t, expected, item[confirmExpiryAttr].(*dbNumber).Value)
+	})
+
 	t.Run("ErrorsIfGettingAttributesFail", func(t *testing.T) {
 		subscriber, err := parseSubscriber(dbAttributes{})
 
@@ -166,6 +459,437 @@ func TestParseSubscriber(t *testing.T) {
 		assert.Check(t, is.Nil(subscriber))
 		assert.ErrorContains(t, err, "failed to parse 'verified' from: ")
 	})
+
+	t.Run("ErrorsIfLastEngagedIsNotAnInteger", func(t *testing.T) {
+		attrs := dbAttributes{
+			"email":         &dbString{Value: testdata.TestEmail},
+			"uid":           &dbString{Value: testdata.TestUidStr},
+			"verified":      toDynamoDbTimestamp(testdata.TestTimestamp),
+			lastEngagedAttr: &dbNumber{Value: "not an int"},
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.Check(t, is.Nil(subscriber))
+		assert.ErrorContains(t, err, "failed to parse 'lastEngaged' from: ")
+	})
+
+	t.Run("ErrorsIfLastDeliveredIsNotAnInteger", func(t *testing.T) {
+		attrs := dbAttributes{
+			"email":           &dbString{Value: testdata.TestEmail},
+			"uid":             &dbString{Value: testdata.TestUidStr},
+			"verified":        toDynamoDbTimestamp(testdata.TestTimestamp),
+			lastDeliveredAttr: &dbNumber{Value: "not an int"},
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.Check(t, is.Nil(subscriber))
+		assert.ErrorContains(t, err, "failed to parse 'lastDelivered' from: ")
+	})
+
+	t.Run("ErrorsIfConfirmExpiryIsNotAnInteger", func(t *testing.T) {
+		attrs := dbAttributes{
+			"email":           &dbString{Value: testdata.TestEmail},
+			"uid":             &dbString{Value: testdata.TestUidStr},
+			"pending":         toDynamoDbTimestamp(testdata.TestTimestamp),
+			confirmExpiryAttr: &dbNumber{Value: "not an int"},
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.Check(t, is.Nil(subscriber))
+		assert.ErrorContains(t, err, "failed to parse 'confirmExpiry' from: ")
+	})
+
+	t.Run("SucceedsWithVersion", func(t *testing.T) {
+		attrs := dbAttributes{
+			"email":     &dbString{Value: testdata.TestEmail},
+			"uid":       &dbString{Value: testdata.TestUidStr},
+			"verified":  toDynamoDbTimestamp(testdata.TestTimestamp),
+			versionAttr: toDynamoDbNumber(27),
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.NilError(t, err)
+		assert.Equal(t, int64(27), subscriber.Version)
+		item := subscriberItem(subscriber)
+		assert.Equal(t, "27", item[versionAttr].(*dbNumber).Value)
+	})
+
+	t.Run("ErrorsIfVersionIsNotAnInteger", func(t *testing.T) {
+		attrs := dbAttributes{
+			"email":     &dbString{Value: testdata.TestEmail},
+			"uid":       &dbString{Value: testdata.TestUidStr},
+			"verified":  toDynamoDbTimestamp(testdata.TestTimestamp),
+			versionAttr: &dbNumber{Value: "not an int"},
+		}
+
+		subscriber, err := parseSubscriber(attrs)
+
+		assert.Check(t, is.Nil(subscriber))
+		assert.ErrorContains(t, err, "failed to parse 'version' from: ")
+	})
+}
+
+func TestPut(t *testing.T) {
+	setup := func() (*DynamoDb, *TestDynamoDbClient, *Subscriber) {
+		client := NewTestDynamoDbClient()
+		dyndb := &DynamoDb{Client: client, TableName: "subscribers-table"}
+		sub := &Subscriber{
+			Email:     testdata.TestEmail,
+			Uid:       testdata.TestUid,
+			Status:    SubscriberVerified,
+			Timestamp: testdata.TestTimestamp,
+		}
+		return dyndb, client, sub
+	}
+	ctx := context.Background()
+
+	t.Run("RequiresNoVersionForNewOrLegacyRecord", func(t *testing.T) {
+		dyndb, client, sub := setup()
+
+		err := dyndb.Put(ctx, sub)
+
+		assert.NilError(t, err)
+		assert.Equal(t, int64(1), sub.Version)
+		input := client.PutItemInput
+		expectedCond := "attribute_not_exists(#v)"
+		assert.Equal(t, expectedCond, aws.ToString(input.ConditionExpression))
+		assert.Equal(t, versionAttr, input.ExpressionAttributeNames["#v"])
+		assert.Assert(t, is.Nil(input.ExpressionAttributeValues))
+		assert.Equal(t, "1", input.Item[versionAttr].(*dbNumber).Value)
+	})
+
+	t.Run("RequiresExpectedVersionAndIncrementsIt", func(t *testing.T) {
+		dyndb, client, sub := setup()
+		sub.Version = 2
+
+		err := dyndb.Put(ctx, sub)
+
+		assert.NilError(t, err)
+		assert.Equal(t, int64(3), sub.Version)
+		input := client.PutItemInput
+		assert.Equal(t, "#v = :v", aws.ToString(input.ConditionExpression))
+		expected := input.ExpressionAttributeValues[":v"].(*dbNumber).Value
+		assert.Equal(t, "2", expected)
+		assert.Equal(t, "3", input.Item[versionAttr].(*dbNumber).Value)
+	})
+
+	t.Run("ReturnsVersionConflictError", func(t *testing.T) {
+		dyndb, client, sub := setup()
+		sub.Version = 2
+		client.PutItemErr = &types.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+
+		err := dyndb.Put(ctx, sub)
+
+		assert.Assert(t, tu.ErrorIs(err, ErrVersionConflict))
+		assert.Assert(t, tu.ErrorIsNot(err, ops.ErrExternal))
+		const expectedErr = "failed to put " + testdata.TestEmail +
+			": version conflict: expected version 2"
+		assert.Error(t, err, expectedErr)
+		assert.Equal(t, int64(2), sub.Version)
+	})
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	setup := func() (*DynamoDb, *TestDynamoDbClient, *Subscriber) {
+		client := NewTestDynamoDbClient()
+		dyndb := &DynamoDb{Client: client, TableName: "subscribers-table"}
+		sub := &Subscriber{
+			Email:     testdata.TestEmail,
+			Uid:       testdata.TestUid,
+			Status:    SubscriberPending,
+			Timestamp: testdata.TestTimestamp,
+			Version:   2,
+		}
+		return dyndb, client, sub
+	}
+	ctx := context.Background()
+
+	t.Run("RequiresNoExistingRecordAndSetsVersion", func(t *testing.T) {
+		dyndb, client, sub := setup()
+
+		err := dyndb.PutIfAbsent(ctx, sub)
+
+		assert.NilError(t, err)
+		assert.Equal(t, int64(1), sub.Version)
+		input := client.PutItemInput
+		expectedCond := "attribute_not_exists(#e)"
+		assert.Equal(t, expectedCond, aws.ToString(input.ConditionExpression))
+		assert.Equal(t, "email", input.ExpressionAttributeNames["#e"])
+		assert.Assert(t, is.Nil(input.ExpressionAttributeValues))
+		assert.Equal(t, "1", input.Item[versionAttr].(*dbNumber).Value)
+	})
+
+	t.Run("ReturnsSubscriberExistsError", func(t *testing.T) {
+		dyndb, client, sub := setup()
+		client.PutItemErr = &types.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+
+		err := dyndb.PutIfAbsent(ctx, sub)
+
+		assert.Assert(t, tu.ErrorIs(err, ErrSubscriberExists))
+		assert.Assert(t, tu.ErrorIsNot(err, ops.ErrExternal))
+		const expectedErr = "failed to put " + testdata.TestEmail +
+			": already a subscriber"
+		assert.Error(t, err, expectedErr)
+		assert.Equal(t, int64(2), sub.Version)
+	})
+
+	t.Run("ReturnsOtherErrorsAsAwsErrors", func(t *testing.T) {
+		dyndb, client, sub := setup()
+		client.PutItemErr = errors.New("test error")
+
+		err := dyndb.PutIfAbsent(ctx, sub)
+
+		assert.ErrorContains(t, err, "failed to put "+testdata.TestEmail+": ")
+		assert.Assert(t, tu.ErrorIsNot(err, ErrSubscriberExists))
+	})
+}
+
+func TestPutBatch(t *testing.T) {
+	setup := func(numSubs int) (
+		*DynamoDb, *TestDynamoDbClient, []*Subscriber, *[]time.Duration,
+	) {
+		client := NewTestDynamoDbClient()
+		sleeps := []time.Duration{}
+		dyndb := &DynamoDb{
+			Client:       client,
+			TableName:    "subscribers-table",
+			BatchBackoff: &ops.FixedBackoff{Delay: time.Second},
+			Sleep: func(_ context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			},
+		}
+		subs := make([]*Subscriber, numSubs)
+		for i := range subs {
+			subs[i] = &Subscriber{
+				Email:     fmt.Sprintf("subscriber-%d@foo.com", i),
+				Uid:       testdata.TestUid,
+				Status:    SubscriberVerified,
+				Timestamp: testdata.TestTimestamp,
+			}
+		}
+		return dyndb, client, subs, &sleeps
+	}
+	ctx := context.Background()
+
+	batchSizes := func(client *TestDynamoDbClient) (sizes []int) {
+		for _, input := range client.BatchWriteInputs {
+			sizes = append(sizes, len(input.RequestItems["subscribers-table"]))
+		}
+		return
+	}
+
+	t.Run("WritesSubscribersInChunks", func(t *testing.T) {
+		dyndb, client, subs, sleeps := setup(60)
+
+		failed, err := dyndb.PutBatch(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.DeepEqual(t, []int{25, 25, 10}, batchSizes(client))
+		assert.Assert(t, is.Len(client.Subscribers, 60))
+		assert.Assert(t, is.Len(*sleeps, 0))
+		assert.Equal(t, int64(1), subs[59].Version)
+		item := client.Subscribers[59]
+		assert.Equal(t, "1", item[versionAttr].(*dbNumber).Value)
+	})
+
+	t.Run("RetriesUnprocessedItemsWithBackoff", func(t *testing.T) {
+		dyndb, client, subs, sleeps := setup(3)
+		client.BatchWriteUnprocessed = map[string]int{subs[1].Email: 2}
+
+		failed, err := dyndb.PutBatch(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.DeepEqual(t, []int{3, 1, 1}, batchSizes(client))
+		assert.DeepEqual(t, []time.Duration{time.Second, time.Second}, *sleeps)
+		assert.Assert(t, is.Len(client.Subscribers, 3))
+		assert.Equal(t, int64(1), subs[1].Version)
+	})
+
+	t.Run("ReturnsUnwrittenSubscribersAfterMaxAttempts", func(t *testing.T) {
+		dyndb, client, subs, sleeps := setup(3)
+		client.BatchWriteUnprocessed = map[string]int{subs[2].Email: 10}
+
+		failed, err := dyndb.PutBatch(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []*Subscriber{subs[2]}, failed)
+		assert.Equal(t, batchWriteMaxAttempts, len(client.BatchWriteInputs))
+		assert.Assert(t, is.Len(*sleeps, batchWriteMaxAttempts-1))
+		assert.Equal(t, int64(1), subs[0].Version)
+		assert.Equal(t, int64(0), subs[2].Version)
+	})
+
+	t.Run("ReturnsRemainingSubscribersIfBatchWriteFails", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(60)
+		client.BatchWriteErrs = []error{nil, tu.AwsServerError("test error")}
+
+		failed, err := dyndb.PutBatch(ctx, subs)
+
+		assert.DeepEqual(t, subs[25:], failed)
+		checkIsExternalError(t, err)
+		expectedErr := "failed to put batch of 25 starting with " +
+			subs[25].Email
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, is.Len(client.Subscribers, 25))
+		assert.Equal(t, int64(1), subs[24].Version)
+		assert.Equal(t, int64(0), subs[25].Version)
+	})
+
+	t.Run("OverwritesExistingSubscribers", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+		existing := *subs[1]
+		existing.Uid = uuid.MustParse("11111111-2222-3333-4444-555555555555")
+		existing.Version = 3
+		client.addSubscribers([]*Subscriber{&existing})
+
+		failed, err := dyndb.PutBatch(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.Assert(t, is.Len(client.BatchGetInputs, 0))
+		assert.DeepEqual(t, []int{3}, batchSizes(client))
+		assert.Equal(t, testdata.TestUid, subs[1].Uid)
+		assert.Equal(t, int64(1), subs[1].Version)
+	})
+
+	t.Run("IfAbsentWritesNewSubscribers", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.Assert(t, is.Len(client.BatchGetInputs, 1))
+		assert.DeepEqual(t, []int{3}, batchSizes(client))
+		assert.Equal(t, int64(1), subs[2].Version)
+	})
+
+	t.Run("IfAbsentSkipsAndLoadsExistingSubscribers", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+		existing := *subs[1]
+		existing.Uid = uuid.MustParse("11111111-2222-3333-4444-555555555555")
+		existing.Timestamp = testdata.TestTimestamp.Add(-time.Hour)
+		existing.Version = 3
+		client.addSubscribers([]*Subscriber{&existing})
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.DeepEqual(t, []int{2}, batchSizes(client))
+		assert.Assert(t, is.Len(client.Subscribers, 3))
+		assert.DeepEqual(t, &existing, subs[1])
+		assert.Equal(t, int64(1), subs[0].Version)
+		assert.Equal(t, int64(1), subs[2].Version)
+	})
+
+	t.Run("IfAbsentSkipsWriteIfAllSubscribersExist", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(2)
+		client.addSubscribers(subs)
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.Assert(t, is.Len(client.BatchWriteInputs, 0))
+		assert.Assert(t, is.Len(client.Subscribers, 2))
+	})
+
+	t.Run("IfAbsentRetriesUnprocessedKeysWithBackoff", func(t *testing.T) {
+		dyndb, client, subs, sleeps := setup(3)
+		client.BatchGetUnprocessed = map[string]int{subs[0].Email: 1}
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.Assert(t, is.Len(client.BatchGetInputs, 2))
+		assert.DeepEqual(t, []time.Duration{time.Second}, *sleeps)
+		assert.Assert(t, is.Len(client.Subscribers, 3))
+	})
+
+	t.Run("IfAbsentReturnsUncheckedAfterMaxAttempts", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+		client.BatchGetUnprocessed = map[string]int{subs[2].Email: 10}
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []*Subscriber{subs[2]}, failed)
+		assert.Equal(t, batchWriteMaxAttempts, len(client.BatchGetInputs))
+		assert.DeepEqual(t, []int{2}, batchSizes(client))
+		assert.Equal(t, int64(0), subs[2].Version)
+	})
+
+	t.Run("IfAbsentReturnsRemainingIfBatchGetFails", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(60)
+		client.BatchGetErrs = []error{nil, tu.AwsServerError("test error")}
+
+		failed, err := dyndb.PutBatchIfAbsent(ctx, subs)
+
+		assert.DeepEqual(t, subs[25:], failed)
+		checkIsExternalError(t, err)
+		expectedErr := "failed to get batch of 25 starting with " +
+			subs[25].Email
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, is.Len(client.Subscribers, 25))
+		assert.Equal(t, int64(0), subs[25].Version)
+	})
+
+	t.Run("StopsRetryingWritesIfContextCancelled", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+		client.BatchWriteUnprocessed = map[string]int{subs[2].Email: 10}
+		dyndb.Sleep = nil
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		failed, err := dyndb.PutBatch(cancelledCtx, subs)
+
+		assert.Assert(t, tu.ErrorIs(err, context.Canceled))
+		expectedErr := "failed to put batch of 3 starting with " + subs[0].Email
+		assert.ErrorContains(t, err, expectedErr)
+		assert.DeepEqual(t, []*Subscriber{subs[2]}, failed)
+		assert.Assert(t, is.Len(client.BatchWriteInputs, 1))
+		assert.Equal(t, int64(1), subs[0].Version)
+	})
+
+	t.Run("IfAbsentStopsRetryingGetsIfContextCancelled", func(t *testing.T) {
+		dyndb, client, subs, _ := setup(3)
+		client.BatchGetUnprocessed = map[string]int{subs[0].Email: 10}
+		dyndb.Sleep = nil
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		failed, err := dyndb.PutBatchIfAbsent(cancelledCtx, subs)
+
+		assert.Assert(t, tu.ErrorIs(err, context.Canceled))
+		expectedErr := "failed to get batch of 3 starting with " + subs[0].Email
+		assert.ErrorContains(t, err, expectedErr)
+		assert.DeepEqual(t, subs, failed)
+		assert.Assert(t, is.Len(client.BatchGetInputs, 1))
+		assert.Assert(t, is.Len(client.BatchWriteInputs, 0))
+	})
+
+	t.Run("DoesNothingIfNoSubscribers", func(t *testing.T) {
+		dyndb, client, _, _ := setup(0)
+
+		failed, err := dyndb.PutBatch(ctx, nil)
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(failed, 0))
+		assert.Assert(t, is.Len(client.BatchWriteInputs, 0))
+	})
 }
 
 func TestCreateSubscribersTable(t *testing.T) {
@@ -238,12 +962,54 @@ func TestCreateSubscribersTable(t *testing.T) {
 
 		err := dyndb.CreateSubscribersTable(ctx, time.Nanosecond)
 
-		// Because WaitForTable uses dynamodb.TableExistsWaiter, it won't pass
-		// through the DescribeTable error or its message. It will just fail.
+		// Server errors are presumed transient, so waitForTable will keep
+		// trying until it times out. It won't pass through the DescribeTable
+		// error or its message.
 		const errFmt = "failed waiting for table to become active after %s"
 		assertErrorContains(t, err, fmt.Sprintf(errFmt, time.Nanosecond), "")
 	})
 
+	t.Run("KeepsWaitingAfterNotFoundAndTransientErrors", func(t *testing.T) {
+		dyndb, client := setup()
+		dyndb.TableWaitMinDelay = time.Millisecond
+		dyndb.TableWaitMaxDelay = time.Millisecond
+		client.DescTableErrs = []error{
+			&types.ResourceNotFoundException{Message: aws.String("not yet")},
+			&smithy.GenericAPIError{
+				Code:    "ThrottlingException",
+				Message: "slow down",
+				Fault:   smithy.FaultClient,
+			},
+		}
+
+		err := dyndb.CreateSubscribersTable(ctx, time.Second)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 3, client.DescTableCalls)
+	})
+
+	t.Run("FailsFastIfWaitForTableErrorIsNotTransient", func(t *testing.T) {
+		dyndb, client := setup()
+		dyndb.TableWaitMinDelay = time.Millisecond
+		dyndb.TableWaitMaxDelay = time.Millisecond
+		client.DescTableErr = &smithy.GenericAPIError{
+			Code:    "AccessDeniedException",
+			Message: "not authorized",
+			Fault:   smithy.FaultClient,
+		}
+
+		err := dyndb.CreateSubscribersTable(ctx, time.Minute)
+
+		const errFmt = "failed waiting for table to become active after %s"
+		assertErrorContains(
+			t,
+			err,
+			fmt.Sprintf(errFmt, time.Minute),
+			"api error AccessDeniedException: not authorized",
+		)
+		assert.Equal(t, 1, client.DescTableCalls)
+	})
+
 	t.Run("FailsIfUpdateTimeToLiveFails", func(t *testing.T) {
 		dyndb, client := setup()
 		client.SetUpdateTimeToLiveError("update TTL failed")
@@ -257,12 +1023,84 @@ func TestCreateSubscribersTable(t *testing.T) {
 
 func setupDbWithSubscribers() (dyndb *DynamoDb, client *TestDynamoDbClient) {
 	client = &TestDynamoDbClient{}
-	dyndb = &DynamoDb{client, "subscribers-table"}
+	dyndb = &DynamoDb{Client: client, TableName: "subscribers-table"}
 
 	client.addSubscribers(TestSubscribers)
 	return
 }
 
+func TestConsumedCapacity(t *testing.T) {
+	type report struct {
+		Operation string
+		Units     float64
+	}
+
+	setup := func(enabled bool) (*DynamoDb, *TestDynamoDbClient, *[]report) {
+		reports := &[]report{}
+		dyndb, client := setupDbWithSubscribers()
+		client.CapacityUnits = 1.5
+
+		if enabled {
+			record := func(operation string, units float64) {
+				*reports = append(*reports, report{operation, units})
+			}
+			WithConsumedCapacity(record)(dyndb)
+		}
+		return dyndb, client, reports
+	}
+	ctx := context.Background()
+	sub := &Subscriber{
+		Email:     testdata.TestEmail,
+		Uid:       testdata.TestUid,
+		Status:    SubscriberVerified,
+		Timestamp: testdata.TestTimestamp,
+	}
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		dyndb, client, _ := setup(false)
+
+		err := dyndb.Put(ctx, sub)
+
+		assert.NilError(t, err)
+		assert.Equal(
+			t,
+			types.ReturnConsumedCapacity(""),
+			client.PutItemInput.ReturnConsumedCapacity,
+		)
+	})
+
+	t.Run("ReportsCapacityOfEachOperationIfEnabled", func(t *testing.T) {
+		dyndb, client, reports := setup(true)
+		client.ScanSize = 2
+		processSub := SubscriberFunc(func(*Subscriber) bool { return true })
+
+		_, getErr := dyndb.Get(ctx, sub.Email)
+		putErr := dyndb.Put(ctx, sub)
+		deleteErr := dyndb.Delete(ctx, sub.Email)
+		processErr := dyndb.ProcessSubscribers(
+			ctx, SubscriberVerified, processSub,
+		)
+
+		assert.Assert(t, tu.ErrorIs(getErr, ErrSubscriberNotFound))
+		assert.NilError(t, putErr)
+		assert.NilError(t, deleteErr)
+		assert.NilError(t, processErr)
+		assert.Equal(
+			t,
+			types.ReturnConsumedCapacityTotal,
+			client.PutItemInput.ReturnConsumedCapacity,
+		)
+		expected := []report{
+			{"GetItem", 1.5}, {"PutItem", 1.5}, {"DeleteItem", 1.5},
+		}
+		for range client.ScanCalls {
+			expected = append(expected, report{"Scan", 1.5})
+		}
+		assert.Assert(t, client.ScanCalls > 1)
+		assert.DeepEqual(t, expected, *reports)
+	})
+}
+
 func TestProcessSubscribers(t *testing.T) {
 	ctx := context.Background()
 
@@ -346,3 +1184,393 @@ func TestProcessSubscribers(t *testing.T) {
 		})
 	})
 }
+
+func TestGetSubscribersPage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReturnsAllSubscribersWithoutLimit", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+
+		subs, next, err := dynDb.GetSubscribersPage(
+			ctx, SubscriberVerified, nil, 0,
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, TestVerifiedSubscribers, subs)
+		assert.Assert(t, is.Nil(next))
+		assert.Assert(t, is.Nil(client.ScanInput.Limit))
+	})
+
+	t.Run("ReturnsPagesUpToLimit", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		var next StartKey
+		subs := []*Subscriber{}
+
+		for {
+			page, nextKey, err := dynDb.GetSubscribersPage(
+				ctx, SubscriberVerified, next, 2,
+			)
+			assert.NilError(t, err)
+			assert.Assert(t, len(page) <= 2)
+			assert.Equal(t, int32(2), *client.ScanInput.Limit)
+			subs = append(subs, page...)
+
+			if next = nextKey; next == nil {
+				break
+			}
+		}
+
+		assert.DeepEqual(t, TestVerifiedSubscribers, subs)
+	})
+
+	t.Run("ReturnsErrorIfScanFails", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		client.SetScanError("scanning error")
+
+		subs, next, err := dynDb.GetSubscribersPage(
+			ctx, SubscriberVerified, nil, 0,
+		)
+
+		assert.Assert(t, is.Nil(subs))
+		assert.Assert(t, is.Nil(next))
+		assert.ErrorContains(t, err, "failed to get verified subscribers")
+		assert.ErrorContains(t, err, "scanning error")
+	})
+
+	t.Run("ReturnsErrorIfParseSubscriberFails", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		client.addSubscriberRecord(dbAttributes{
+			"email":    &dbString{Value: "bad-uid@foo.com"},
+			"uid":      &dbString{Value: "not a uid"},
+			"verified": toDynamoDbTimestamp(testdata.TestTimestamp),
+		})
+
+		subs, _, err := dynDb.GetSubscribersPage(
+			ctx, SubscriberVerified, nil, 0,
+		)
+
+		assert.Assert(t, is.Nil(subs))
+		assert.ErrorContains(t, err, "failed to parse subscriber: ")
+		assert.Assert(t, tu.ErrorIsNot(err, ops.ErrExternal))
+	})
+}
+
+func TestStartKeyAfter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ContainsTableAndIndexKeys", func(t *testing.T) {
+		dynDb, _ := setupDbWithSubscribers()
+		sub := TestVerifiedSubscribers[0]
+
+		startKey, err := dynDb.StartKeyAfter(sub)
+
+		assert.NilError(t, err)
+		encoded, err := EncodeStartKey(startKey)
+		assert.NilError(t, err)
+		decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+		assert.NilError(t, err)
+		expected := fmt.Sprintf(
+			`{"email":{"S":"%s"},"verified":{"N":"%d"}}`,
+			sub.Email, sub.Timestamp.Unix(),
+		)
+		assert.Equal(t, expected, string(decoded))
+	})
+
+	t.Run("ResumesPageAfterSubscriber", func(t *testing.T) {
+		dynDb, _ := setupDbWithSubscribers()
+		startKey, err := dynDb.StartKeyAfter(TestVerifiedSubscribers[0])
+		assert.NilError(t, err)
+
+		subs, _, err := dynDb.GetSubscribersPage(
+			ctx, SubscriberVerified, startKey, 0,
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, TestVerifiedSubscribers[1:], subs)
+	})
+}
+
+func TestCountSubscribersInState(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Succeeds", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+
+		verified, verifiedErr := dynDb.CountSubscribersInState(
+			ctx, SubscriberVerified,
+		)
+		pending, pendingErr := dynDb.CountSubscribersInState(
+			ctx, SubscriberPending,
+		)
+
+		assert.NilError(t, verifiedErr)
+		assert.NilError(t, pendingErr)
+		assert.Equal(t, int64(len(TestVerifiedSubscribers)), verified)
+		assert.Equal(t, int64(len(TestPendingSubscribers)), pending)
+		assert.Equal(t, types.SelectCount, client.ScanInput.Select)
+		assert.Equal(t, client.ScanCalls, 2)
+	})
+
+	t.Run("SumsCountsAcrossPages", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		client.ScanSize = 2
+
+		count, err := dynDb.CountSubscribersInState(ctx, SubscriberVerified)
+
+		assert.NilError(t, err)
+		assert.Equal(t, int64(len(TestVerifiedSubscribers)), count)
+		expectedCalls := (len(TestVerifiedSubscribers) + 1) / 2
+		assert.Equal(t, expectedCalls, client.ScanCalls)
+	})
+
+	t.Run("ReturnsErrorIfScanFails", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		client.SetScanError("scanning error")
+
+		count, err := dynDb.CountSubscribersInState(ctx, SubscriberVerified)
+
+		assert.Equal(t, int64(0), count)
+		assert.ErrorContains(t, err, "failed to count verified subscribers")
+		assert.ErrorContains(t, err, "scanning error")
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+}
+
+func TestProcessSubscriberPages(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func() (
+		dyndb *DynamoDb,
+		client *TestDynamoDbClient,
+		pages *[][]*Subscriber,
+		f SubscriberPageFunc,
+	) {
+		dyndb, client = setupDbWithSubscribers()
+		pages = &[][]*Subscriber{}
+		f = func(page []*Subscriber) (bool, error) {
+			*pages = append(*pages, page)
+			return true, nil
+		}
+		return
+	}
+
+	t.Run("PageSizesMatchScanSize", func(t *testing.T) {
+		dynDb, client, pages, f := setup()
+		client.ScanSize = 2
+
+		err := dynDb.ProcessSubscriberPages(ctx, SubscriberVerified, f)
+
+		assert.NilError(t, err)
+		expected := [][]*Subscriber{
+			TestVerifiedSubscribers[:2], TestVerifiedSubscribers[2:],
+		}
+		assert.DeepEqual(t, expected, *pages)
+	})
+
+	t.Run("StopsIfPageFuncReturnsFalse", func(t *testing.T) {
+		dynDb, client, pages, _ := setup()
+		client.ScanSize = 1
+		f := func(page []*Subscriber) (bool, error) {
+			*pages = append(*pages, page)
+			return false, nil
+		}
+
+		err := dynDb.ProcessSubscriberPages(ctx, SubscriberVerified, f)
+
+		assert.NilError(t, err)
+		expected := [][]*Subscriber{TestVerifiedSubscribers[:1]}
+		assert.DeepEqual(t, expected, *pages)
+		assert.Equal(t, 1, client.ScanCalls)
+	})
+
+	t.Run("ReturnsErrorFromPageFunc", func(t *testing.T) {
+		dynDb, client, pages, _ := setup()
+		client.ScanSize = 1
+		pageErr := errors.New("page processing failed")
+		f := func(page []*Subscriber) (bool, error) {
+			*pages = append(*pages, page)
+			return true, pageErr
+		}
+
+		err := dynDb.ProcessSubscriberPages(ctx, SubscriberVerified, f)
+
+		assert.Assert(t, tu.ErrorIs(err, pageErr))
+		assert.Equal(t, 1, len(*pages))
+		assert.Equal(t, 1, client.ScanCalls)
+	})
+}
+
+func TestGetSubscribersVerifiedBetween(t *testing.T) {
+	ctx := context.Background()
+	start := testdata.TestTimestamp
+	end := start.Add(72 * time.Hour)
+
+	// TestVerifiedSubscribers are verified at TestTimestamp plus 0, 48, and
+	// 96 hours, so the last one falls outside the range.
+	expected := TestVerifiedSubscribers[:2]
+
+	t.Run("ReturnsSubscribersVerifiedWithinRange", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+
+		subs, next, err := dynDb.GetSubscribersVerifiedBetween(
+			ctx, start, end, nil,
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, expected, subs)
+		assert.Assert(t, is.Nil(next))
+		tu.AssertAwsStringEqual(
+			t, DynamoDbVerifiedTimeIndexName, client.QueryInput.IndexName,
+		)
+	})
+
+	t.Run("ReturnsPages", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		client.QuerySize = 1
+		var next StartKey
+		subs := []*Subscriber{}
+
+		for {
+			page, nextKey, err := dynDb.GetSubscribersVerifiedBetween(
+				ctx, start, end, next,
+			)
+			assert.NilError(t, err)
+			assert.Assert(t, len(page) <= 1)
+			subs = append(subs, page...)
+
+			if next = nextKey; next == nil {
+				break
+			}
+		}
+
+		assert.DeepEqual(t, expected, subs)
+	})
+
+	t.Run("ReturnsErrorIfParseSubscriberFails", func(t *testing.T) {
+		dynDb, client := setupDbWithSubscribers()
+		badSub := dbAttributes{
+			"email":    &dbString{Value: "bad-uid@foo.com"},
+			"uid":      &dbString{Value: "not a uid"},
+			"verified": toDynamoDbTimestamp(testdata.TestTimestamp),
+		}
+		badSub[DynamoDbVerifiedTimeIndexPartitionKey] = verifiedCohort
+		client.addSubscriberRecord(badSub)
+
+		subs, next, err := dynDb.GetSubscribersVerifiedBetween(
+			ctx, start, end, nil,
+		)
+
+		assert.Assert(t, is.Nil(subs))
+		assert.Assert(t, is.Nil(next))
+		assert.ErrorContains(t, err, "failed to parse subscriber: ")
+	})
+}
+
+func TestUpgradeSubscribersTable(t *testing.T) {
+	ctx := context.Background()
+
+	// setup returns a database whose verified subscribers were written before
+	// the DynamoDbVerifiedTimeIndexName index existed.
+	setup := func() (*DynamoDb, *TestDynamoDbClient) {
+		dynDb, client := setupDbWithSubscribers()
+		client.DescTableOutput = NewTestDynamoDbClient().DescTableOutput
+		for _, sub := range client.Subscribers {
+			delete(sub, DynamoDbVerifiedTimeIndexPartitionKey)
+		}
+		return dynDb, client
+	}
+	assertAllVerifiedFound := func(t *testing.T, dynDb *DynamoDb) {
+		t.Helper()
+		end := testdata.TestTimestamp.Add(time.Hour * 24 * 365)
+
+		subs, _, err := dynDb.GetSubscribersVerifiedBetween(
+			ctx, testdata.TestTimestamp, end, nil,
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, TestVerifiedSubscribers, subs)
+	}
+
+	t.Run("CreatesIndexAndBackfillsVerifiedSubscribers", func(t *testing.T) {
+		dynDb, client := setup()
+
+		indexCreated, updated, err := dynDb.UpgradeSubscribersTable(ctx)
+
+		assert.NilError(t, err)
+		assert.Assert(t, indexCreated)
+		assert.Equal(t, len(TestVerifiedSubscribers), updated)
+		update := client.UpdateTableInput.GlobalSecondaryIndexUpdates[0]
+		tu.AssertAwsStringEqual(
+			t, DynamoDbVerifiedTimeIndexName, update.Create.IndexName,
+		)
+		assertAllVerifiedFound(t, dynDb)
+	})
+
+	t.Run("SkipsExistingIndexAndSubscribers", func(t *testing.T) {
+		dynDb, client := setup()
+		_, _, err := dynDb.UpgradeSubscribersTable(ctx)
+		assert.NilError(t, err)
+		client.DescTableOutput.Table.GlobalSecondaryIndexes = append(
+			client.DescTableOutput.Table.GlobalSecondaryIndexes,
+			types.GlobalSecondaryIndexDescription{
+				IndexName: aws.String(DynamoDbVerifiedTimeIndexName),
+			},
+		)
+		client.UpdateTableInput = nil
+		client.UpdateItemInputs = nil
+
+		indexCreated, updated, err := dynDb.UpgradeSubscribersTable(ctx)
+
+		assert.NilError(t, err)
+		assert.Assert(t, !indexCreated)
+		assert.Equal(t, 0, updated)
+		assert.Assert(t, is.Nil(client.UpdateTableInput))
+		assert.Assert(t, is.Len(client.UpdateItemInputs, 0))
+		assertAllVerifiedFound(t, dynDb)
+	})
+
+	t.Run("SkipsSubscribersNoLongerVerified", func(t *testing.T) {
+		dynDb, client := setup()
+		// UpdateItem will find this record, which has no "verified"
+		// attribute, instead of the verified record that Scan returns. This
+		// emulates the subscriber unsubscribing after the Scan.
+		unsubscribed := dbAttributes{
+			"email": &dbString{Value: TestVerifiedSubscribers[0].Email},
+		}
+		client.Subscribers = append(
+			[]dbAttributes{unsubscribed}, client.Subscribers...,
+		)
+
+		_, updated, err := dynDb.UpgradeSubscribersTable(ctx)
+
+		assert.NilError(t, err)
+		assert.Equal(t, len(TestVerifiedSubscribers)-1, updated)
+	})
+
+	t.Run("FailsIfUpdateTableFails", func(t *testing.T) {
+		dynDb, client := setup()
+		client.UpdateTableErr = tu.AwsServerError("update table failed")
+
+		_, _, err := dynDb.UpgradeSubscribersTable(ctx)
+
+		const expected = "failed to upgrade subscribers table " +
+			"\"subscribers-table\": failed to create index " +
+			DynamoDbVerifiedTimeIndexName
+		assert.ErrorContains(t, err, expected)
+		assert.ErrorContains(t, err, "update table failed")
+		checkIsExternalError(t, err)
+	})
+
+	t.Run("FailsIfUpdateItemFails", func(t *testing.T) {
+		dynDb, client := setup()
+		client.UpdateItemErr = tu.AwsServerError("update item failed")
+
+		_, updated, err := dynDb.UpgradeSubscribersTable(ctx)
+
+		assert.Equal(t, 0, updated)
+		expected := "failed to update " + TestVerifiedSubscribers[0].Email
+		assert.ErrorContains(t, err, expected)
+		assert.ErrorContains(t, err, "update item failed")
+		checkIsExternalError(t, err)
+	})
+}
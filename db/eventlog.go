@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mbland/elistman/ops"
+)
+
+// DynamoDbEventLog records the IDs of events that have already been handled.
+// It also records MX validation failure counts as an email.MxFailureStore.
+//
+// It stores each ID in a separate DynamoDB table from the subscribers table,
+// since each table supports only one Time To Live attribute, and the
+// subscribers table already uses "pending" for that purpose. The events table
+// must have a string partition key named DynamoDbEventLogPrimaryKey and Time To
+// Live enabled on DynamoDbEventLogTtlAttribute.
+//
+// - https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/TTL.html
+type DynamoDbEventLog struct {
+	Client    DynamoDbClient
+	TableName string
+
+	// Ttl is how long RecordEvent remembers each ID.
+	Ttl time.Duration
+
+	// CurrentTime returns the current time. Defaults to time.Now if nil.
+	CurrentTime func() time.Time
+}
+
+// DefaultEventLogTtl is how long DynamoDbEventLog remembers each event by
+// default.
+const DefaultEventLogTtl = 72 * time.Hour
+
+// DefaultSendLogTtl is how long a DynamoDbEventLog used as an agent.SendLog
+// remembers each campaign recipient by default.
+//
+// It should exceed the lifetime of any campaign, since sending a message again
+// with the same CampaignKey after this long may deliver duplicates.
+const DefaultSendLogTtl = 30 * 24 * time.Hour
+
+const DynamoDbEventLogPrimaryKey = "id"
+const DynamoDbEventLogTtlAttribute = "expires"
+
+func NewDynamoDbEventLog(
+	cfg aws.Config, tableName string, ttl time.Duration,
+) *DynamoDbEventLog {
+	return &DynamoDbEventLog{
+		Client:    dynamodb.NewFromConfig(cfg),
+		TableName: tableName,
+		Ttl:       ttl,
+	}
+}
+
+// RecordEvent records id and returns true if it isn't already recorded.
+//
+// It returns false if id was recorded less than Ttl ago. DynamoDB may take a
+// while to delete expired items, so RecordEvent overwrites an expired item
+// instead of treating it as a duplicate.
+func (l *DynamoDbEventLog) RecordEvent(
+	ctx context.Context, id string,
+) (firstTime bool, err error) {
+	now := l.now()
+	input := &dynamodb.PutItemInput{
+		Item: dbAttributes{
+			DynamoDbEventLogPrimaryKey:   &dbString{Value: id},
+			DynamoDbEventLogTtlAttribute: toDynamoDbTimestamp(now.Add(l.ttl())),
+		},
+		TableName: aws.String(l.TableName),
+		ConditionExpression: aws.String(
+			"attribute_not_exists(#id) OR #expires < :now",
+		),
+		ExpressionAttributeNames: map[string]string{
+			"#id":      DynamoDbEventLogPrimaryKey,
+			"#expires": DynamoDbEventLogTtlAttribute,
+		},
+		ExpressionAttributeValues: dbAttributes{
+			":now": toDynamoDbTimestamp(now),
+		},
+	}
+	var condErr *dbtypes.ConditionalCheckFailedException
+
+	if _, err = l.Client.PutItem(ctx, input); err == nil {
+		firstTime = true
+	} else if errors.As(err, &condErr) {
+		err = nil
+	} else {
+		err = ops.AwsError("failed to record event "+id, err)
+	}
+	return
+}
+
+// ForgetEvent removes id, so that the next RecordEvent call for it returns
+// true.
+//
+// This enables an event that failed to be handled again when redelivered.
+func (l *DynamoDbEventLog) ForgetEvent(
+	ctx context.Context, id string,
+) (err error) {
+	input := &dynamodb.DeleteItemInput{
+		Key: dbAttributes{
+			DynamoDbEventLogPrimaryKey: &dbString{Value: id},
+		},
+		TableName: aws.String(l.TableName),
+	}
+
+	if _, err = l.Client.DeleteItem(ctx, input); err != nil {
+		err = ops.AwsError("failed to forget event "+id, err)
+	}
+	return
+}
+
+const mxFailureIdPrefix = "mx-failure/"
+const mxFailureCountAttr = "count"
+const mxFailureFirstAttr = "first"
+
+func mxFailureId(email string) string {
+	return mxFailureIdPrefix + email
+}
+
+// RecordMxFailure increments and returns the number of MX lookup failures for
+// email.
+//
+// It starts a new count of 1 if there's no count for email yet or if its first
+// failure happened more than window before now. Each count expires window
+// after its first failure. This implements email.MxFailureStore.
+//
+// Two concurrent calls starting a new count may both store a count of 1. Such
+// an undercount only delays suppression, which is the safer failure mode.
+func (l *DynamoDbEventLog) RecordMxFailure(
+	ctx context.Context, email string, now time.Time, window time.Duration,
+) (count int, err error) {
+	id := mxFailureId(email)
+	input := &dynamodb.UpdateItemInput{
+		Key: dbAttributes{
+			DynamoDbEventLogPrimaryKey: &dbString{Value: id},
+		},
+		TableName:           aws.String(l.TableName),
+		UpdateExpression:    aws.String("ADD #count :one"),
+		ConditionExpression: aws.String("#first >= :start"),
+		ExpressionAttributeNames: map[string]string{
+			"#count": mxFailureCountAttr,
+			"#first": mxFailureFirstAttr,
+		},
+		ExpressionAttributeValues: dbAttributes{
+			":one":   toDynamoDbNumber(1),
+			":start": toDynamoDbTimestamp(now.Add(-window)),
+		},
+		ReturnValues: dbtypes.ReturnValueUpdatedNew,
+	}
+	var output *dynamodb.UpdateItemOutput
+	var condErr *dbtypes.ConditionalCheckFailedException
+
+	if output, err = l.Client.UpdateItem(ctx, input); err == nil {
+		var n int64
+		p := &dbParser{output.Attributes}
+		if n, err = p.GetInt64(mxFailureCountAttr); err == nil {
+			count = int(n)
+		} else {
+			const errFmt = "failed to parse MX failure count for %s: %w"
+			err = fmt.Errorf(errFmt, email, err)
+		}
+		return
+	} else if !errors.As(err, &condErr) {
+		err = ops.AwsError("failed to record MX failure for "+email, err)
+		return
+	}
+	return l.startMxFailureCount(ctx, email, now, window)
+}
+
+func (l *DynamoDbEventLog) startMxFailureCount(
+	ctx context.Context, email string, now time.Time, window time.Duration,
+) (count int, err error) {
+	input := &dynamodb.PutItemInput{
+		Item: dbAttributes{
+			DynamoDbEventLogPrimaryKey: &dbString{Value: mxFailureId(email)},
+			mxFailureCountAttr:         toDynamoDbNumber(1),
+			mxFailureFirstAttr:         toDynamoDbTimestamp(now),
+			DynamoDbEventLogTtlAttribute: toDynamoDbTimestamp(
+				now.Add(window),
+			),
+		},
+		TableName: aws.String(l.TableName),
+	}
+
+	if _, err = l.Client.PutItem(ctx, input); err != nil {
+		err = ops.AwsError("failed to record MX failure for "+email, err)
+	} else {
+		count = 1
+	}
+	return
+}
+
+// ForgetMxFailures removes the MX lookup failure count for email.
+//
+// This implements email.MxFailureStore.
+func (l *DynamoDbEventLog) ForgetMxFailures(
+	ctx context.Context, email string,
+) error {
+	return l.ForgetEvent(ctx, mxFailureId(email))
+}
+
+func (l *DynamoDbEventLog) now() time.Time {
+	if l.CurrentTime == nil {
+		return time.Now()
+	}
+	return l.CurrentTime()
+}
+
+func (l *DynamoDbEventLog) ttl() time.Duration {
+	if l.Ttl <= 0 {
+		return DefaultEventLogTtl
+	}
+	return l.Ttl
+}
@@ -0,0 +1,228 @@
+//go:build small_tests || all_tests
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/testdata"
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+func TestDynamoDbEventLogRecordEvent(t *testing.T) {
+	const eventId = "Bounce/EXAMPLE7c191be45"
+	setup := func() (*DynamoDbEventLog, *TestDynamoDbClient) {
+		client := NewTestDynamoDbClient()
+		eventLog := &DynamoDbEventLog{
+			Client:      client,
+			TableName:   "events-table",
+			Ttl:         time.Hour,
+			CurrentTime: func() time.Time { return testdata.TestTimestamp },
+		}
+		return eventLog, client
+	}
+	ctx := context.Background()
+
+	t.Run("RecordsNewEventWithExpiration", func(t *testing.T) {
+		eventLog, client := setup()
+
+		firstTime, err := eventLog.RecordEvent(ctx, eventId)
+
+		assert.NilError(t, err)
+		assert.Assert(t, firstTime)
+		input := client.PutItemInput
+		assert.Equal(t, "events-table", aws.ToString(input.TableName))
+		assert.Equal(t, eventId, input.Item["id"].(*dbString).Value)
+		expires := toDynamoDbTimestamp(testdata.TestTimestamp.Add(time.Hour))
+		assert.Equal(t, expires.Value, input.Item["expires"].(*dbNumber).Value)
+		now := toDynamoDbTimestamp(testdata.TestTimestamp)
+		nowAttr := input.ExpressionAttributeValues[":now"].(*dbNumber)
+		assert.Equal(t, now.Value, nowAttr.Value)
+		const expectedCond = "attribute_not_exists(#id) OR #expires < :now"
+		assert.Equal(t, expectedCond, aws.ToString(input.ConditionExpression))
+	})
+
+	t.Run("UsesDefaultTtlIfNotSet", func(t *testing.T) {
+		eventLog, client := setup()
+		eventLog.Ttl = 0
+
+		_, err := eventLog.RecordEvent(ctx, eventId)
+
+		assert.NilError(t, err)
+		expires := toDynamoDbTimestamp(
+			testdata.TestTimestamp.Add(DefaultEventLogTtl),
+		)
+		expiresAttr := client.PutItemInput.Item["expires"].(*dbNumber)
+		assert.Equal(t, expires.Value, expiresAttr.Value)
+	})
+
+	t.Run("ReturnsFalseIfAlreadyRecorded", func(t *testing.T) {
+		eventLog, client := setup()
+		client.PutItemErr = &types.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+
+		firstTime, err := eventLog.RecordEvent(ctx, eventId)
+
+		assert.NilError(t, err)
+		assert.Assert(t, !firstTime)
+	})
+
+	t.Run("ReturnsOtherErrorsAsAwsErrors", func(t *testing.T) {
+		eventLog, client := setup()
+		client.PutItemErr = tu.AwsServerError("test error")
+
+		firstTime, err := eventLog.RecordEvent(ctx, eventId)
+
+		assert.Assert(t, !firstTime)
+		assert.ErrorContains(t, err, "failed to record event "+eventId+": ")
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+}
+
+func TestDynamoDbEventLogForgetEvent(t *testing.T) {
+	const eventId = "Bounce/EXAMPLE7c191be45"
+	setup := func() (*DynamoDbEventLog, *TestDynamoDbClient) {
+		client := NewTestDynamoDbClient()
+		eventLog := &DynamoDbEventLog{Client: client, TableName: "events-table"}
+		return eventLog, client
+	}
+	ctx := context.Background()
+
+	t.Run("DeletesEvent", func(t *testing.T) {
+		eventLog, client := setup()
+
+		err := eventLog.ForgetEvent(ctx, eventId)
+
+		assert.NilError(t, err)
+		input := client.DeleteItemInput
+		assert.Equal(t, "events-table", aws.ToString(input.TableName))
+		assert.Equal(t, eventId, input.Key["id"].(*dbString).Value)
+	})
+
+	t.Run("ReturnsErrorsAsAwsErrors", func(t *testing.T) {
+		eventLog, client := setup()
+		client.ServerErr = tu.AwsServerError("test error")
+
+		err := eventLog.ForgetEvent(ctx, eventId)
+
+		assert.ErrorContains(t, err, "failed to forget event "+eventId+": ")
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+}
+
+func TestDynamoDbEventLogRecordMxFailure(t *testing.T) {
+	const email = "foo@bar.com"
+	const window = 24 * time.Hour
+	now := testdata.TestTimestamp
+	setup := func() (*DynamoDbEventLog, *TestDynamoDbClient) {
+		client := NewTestDynamoDbClient()
+		eventLog := &DynamoDbEventLog{Client: client, TableName: "events-table"}
+		return eventLog, client
+	}
+	conditionFailed := func() error {
+		return &types.ConditionalCheckFailedException{
+			Message: aws.String("The conditional request failed"),
+		}
+	}
+	ctx := context.Background()
+
+	t.Run("IncrementsCountWithinWindow", func(t *testing.T) {
+		eventLog, client := setup()
+		client.UpdateItemOutput = &dynamodb.UpdateItemOutput{
+			Attributes: dbAttributes{"count": toDynamoDbNumber(2)},
+		}
+
+		count, err := eventLog.RecordMxFailure(ctx, email, now, window)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2, count)
+		assert.Assert(t, client.PutItemInput == nil)
+		input := client.UpdateItemInputs[0]
+		assert.Equal(t, "events-table", aws.ToString(input.TableName))
+		assert.Equal(
+			t, "mx-failure/"+email, input.Key["id"].(*dbString).Value,
+		)
+		assert.Equal(
+			t, "ADD #count :one", aws.ToString(input.UpdateExpression),
+		)
+		assert.Equal(
+			t, "#first >= :start", aws.ToString(input.ConditionExpression),
+		)
+		start := toDynamoDbTimestamp(now.Add(-window))
+		startAttr := input.ExpressionAttributeValues[":start"].(*dbNumber)
+		assert.Equal(t, start.Value, startAttr.Value)
+	})
+
+	t.Run("StartsNewCountIfNoneWithinWindow", func(t *testing.T) {
+		eventLog, client := setup()
+		client.UpdateItemErr = conditionFailed()
+
+		count, err := eventLog.RecordMxFailure(ctx, email, now, window)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 1, count)
+		item := client.PutItemInput.Item
+		assert.Equal(t, "mx-failure/"+email, item["id"].(*dbString).Value)
+		assert.Equal(t, "1", item["count"].(*dbNumber).Value)
+		first := toDynamoDbTimestamp(now)
+		assert.Equal(t, first.Value, item["first"].(*dbNumber).Value)
+		expires := toDynamoDbTimestamp(now.Add(window))
+		assert.Equal(t, expires.Value, item["expires"].(*dbNumber).Value)
+	})
+
+	t.Run("ReturnsUpdateErrorsAsAwsErrors", func(t *testing.T) {
+		eventLog, client := setup()
+		client.UpdateItemErr = tu.AwsServerError("test error")
+
+		count, err := eventLog.RecordMxFailure(ctx, email, now, window)
+
+		assert.Equal(t, 0, count)
+		assert.ErrorContains(t, err, "failed to record MX failure for "+email)
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+
+	t.Run("ReturnsPutErrorsAsAwsErrors", func(t *testing.T) {
+		eventLog, client := setup()
+		client.UpdateItemErr = conditionFailed()
+		client.PutItemErr = tu.AwsServerError("test error")
+
+		count, err := eventLog.RecordMxFailure(ctx, email, now, window)
+
+		assert.Equal(t, 0, count)
+		assert.ErrorContains(t, err, "failed to record MX failure for "+email)
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+
+	t.Run("ReturnsErrorIfCountIsInvalid", func(t *testing.T) {
+		eventLog, client := setup()
+		client.UpdateItemOutput = &dynamodb.UpdateItemOutput{
+			Attributes: dbAttributes{"count": &dbString{Value: "2"}},
+		}
+
+		count, err := eventLog.RecordMxFailure(ctx, email, now, window)
+
+		assert.Equal(t, 0, count)
+		assert.ErrorContains(
+			t, err, "failed to parse MX failure count for "+email,
+		)
+	})
+}
+
+func TestDynamoDbEventLogForgetMxFailures(t *testing.T) {
+	client := NewTestDynamoDbClient()
+	eventLog := &DynamoDbEventLog{Client: client, TableName: "events-table"}
+
+	err := eventLog.ForgetMxFailures(context.Background(), "foo@bar.com")
+
+	assert.NilError(t, err)
+	input := client.DeleteItemInput
+	assert.Equal(t, "mx-failure/foo@bar.com", input.Key["id"].(*dbString).Value)
+}
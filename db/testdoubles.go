@@ -4,6 +4,7 @@ package db
 
 import (
 	"context"
+	"slices"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -23,6 +24,9 @@ import (
 // dynamodb_contract_test tests and validates these individual operations. Given
 // that, CreateSubscribersTable can then be tested more quickly and reliably
 // using this test double.
+//
+// UpdateTable, UpdateItem, and Query implement only what
+// UpgradeSubscribersTable and GetSubscribersVerifiedBetween need.
 type TestDynamoDbClient struct {
 	ServerErr         error
 	CreateTableInput  *dynamodb.CreateTableInput
@@ -31,13 +35,43 @@ type TestDynamoDbClient struct {
 	DescTableInput    *dynamodb.DescribeTableInput
 	DescTableOutput   *dynamodb.DescribeTableOutput
 	DescTableErr      error
+	DescTableErrs     []error
+	DescTableCalls    int
 	UpdateTtlInput    *dynamodb.UpdateTimeToLiveInput
 	UpdateTtlOutput   *dynamodb.UpdateTimeToLiveOutput
 	UpdateTtlErr      error
+	UpdateTableInput  *dynamodb.UpdateTableInput
+	UpdateTableErr    error
+	UpdateItemInputs  []*dynamodb.UpdateItemInput
+	UpdateItemErr     error
+	UpdateItemOutput  *dynamodb.UpdateItemOutput
+	QueryInput        *dynamodb.QueryInput
+	QuerySize         int
+	DeleteTableInput  *dynamodb.DeleteTableInput
+	PutItemInput      *dynamodb.PutItemInput
+	PutItemErr        error
+	DeleteItemInput   *dynamodb.DeleteItemInput
+	BatchGetInputs    []*dynamodb.BatchGetItemInput
+	BatchGetErrs      []error
+	BatchWriteInputs  []*dynamodb.BatchWriteItemInput
+	BatchWriteErrs    []error
 	Subscribers       []dbAttributes
+	ScanInput         *dynamodb.ScanInput
 	ScanSize          int
 	ScanCalls         int
 	ScanErr           error
+
+	// BatchGetUnprocessed maps an email address to the number of
+	// BatchGetItem calls that should leave its key unprocessed.
+	BatchGetUnprocessed map[string]int
+
+	// BatchWriteUnprocessed maps an email address to the number of
+	// BatchWriteItem calls that should leave its item unprocessed.
+	BatchWriteUnprocessed map[string]int
+
+	// CapacityUnits is the consumed capacity returned by GetItem, PutItem,
+	// DeleteItem, and Scan if their inputs set ReturnConsumedCapacity.
+	CapacityUnits float64
 }
 
 // NewTestDynamoDbClient returns an initialized TestDynamoDbClient.
@@ -68,6 +102,8 @@ func (client *TestDynamoDbClient) SetAllErrors(msg string) {
 	client.CreateTableErr = err
 	client.DescTableErr = err
 	client.UpdateTtlErr = err
+	client.UpdateTableErr = err
+	client.UpdateItemErr = err
 	client.ScanErr = err
 }
 
@@ -102,6 +138,14 @@ func (client *TestDynamoDbClient) DescribeTable(
 	_ ...func(*dynamodb.Options),
 ) (*dynamodb.DescribeTableOutput, error) {
 	client.DescTableInput = input
+	client.DescTableCalls++
+
+	// DescTableErrs enables simulating errors before the table becomes active.
+	if len(client.DescTableErrs) != 0 {
+		err := client.DescTableErrs[0]
+		client.DescTableErrs = client.DescTableErrs[1:]
+		return nil, err
+	}
 	return client.DescTableOutput, client.DescTableErr
 }
 
@@ -114,34 +158,264 @@ func (client *TestDynamoDbClient) UpdateTimeToLive(
 	return client.UpdateTtlOutput, client.UpdateTtlErr
 }
 
+func (client *TestDynamoDbClient) UpdateTable(
+	_ context.Context,
+	input *dynamodb.UpdateTableInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateTableOutput, error) {
+	client.UpdateTableInput = input
+	return &dynamodb.UpdateTableOutput{}, client.UpdateTableErr
+}
+
 func (client *TestDynamoDbClient) DeleteTable(
-	context.Context, *dynamodb.DeleteTableInput, ...func(*dynamodb.Options),
+	_ context.Context,
+	input *dynamodb.DeleteTableInput,
+	_ ...func(*dynamodb.Options),
 ) (*dynamodb.DeleteTableOutput, error) {
+	client.DeleteTableInput = input
 	return nil, client.ServerErr
 }
 
 func (client *TestDynamoDbClient) GetItem(
-	context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options),
+	_ context.Context,
+	input *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
 ) (*dynamodb.GetItemOutput, error) {
-	return nil, client.ServerErr
+	output := &dynamodb.GetItemOutput{
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	return output, client.ServerErr
 }
 
 func (client *TestDynamoDbClient) PutItem(
-	context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options),
+	_ context.Context,
+	input *dynamodb.PutItemInput,
+	_ ...func(*dynamodb.Options),
 ) (*dynamodb.PutItemOutput, error) {
-	return nil, client.ServerErr
+	client.PutItemInput = input
+
+	if client.PutItemErr != nil {
+		return nil, client.PutItemErr
+	}
+	output := &dynamodb.PutItemOutput{
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	return output, client.ServerErr
+}
+
+// BatchGetItem returns each processed key's item from Subscribers, if present.
+//
+// BatchGetErrs enables simulating errors on specific calls; a nil element
+// allows the corresponding call to succeed.
+func (client *TestDynamoDbClient) BatchGetItem(
+	_ context.Context,
+	input *dynamodb.BatchGetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.BatchGetItemOutput, error) {
+	client.BatchGetInputs = append(client.BatchGetInputs, input)
+
+	if len(client.BatchGetErrs) != 0 {
+		err := client.BatchGetErrs[0]
+		client.BatchGetErrs = client.BatchGetErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if client.ServerErr != nil {
+		return nil, client.ServerErr
+	}
+
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	for table, keysAndAttrs := range input.RequestItems {
+		for _, key := range keysAndAttrs.Keys {
+			email, _ := (&dbParser{key}).GetString("email")
+
+			if client.BatchGetUnprocessed[email] > 0 {
+				client.BatchGetUnprocessed[email]--
+				unprocessed := output.UnprocessedKeys[table]
+				unprocessed.Keys = append(unprocessed.Keys, key)
+				output.UnprocessedKeys[table] = unprocessed
+			} else if item := client.findSubscriberRecord(email); item != nil {
+				output.Responses[table] = append(output.Responses[table], item)
+			}
+		}
+	}
+	return output, nil
+}
+
+// BatchWriteItem adds each processed item to Subscribers.
+//
+// BatchWriteErrs enables simulating errors on specific calls; a nil element
+// allows the corresponding call to succeed.
+func (client *TestDynamoDbClient) BatchWriteItem(
+	_ context.Context,
+	input *dynamodb.BatchWriteItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.BatchWriteItemOutput, error) {
+	client.BatchWriteInputs = append(client.BatchWriteInputs, input)
+
+	if len(client.BatchWriteErrs) != 0 {
+		err := client.BatchWriteErrs[0]
+		client.BatchWriteErrs = client.BatchWriteErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	if client.ServerErr != nil {
+		return nil, client.ServerErr
+	}
+
+	unprocessed := map[string][]types.WriteRequest{}
+	for table, requests := range input.RequestItems {
+		for _, req := range requests {
+			email, _ := (&dbParser{req.PutRequest.Item}).GetString("email")
+
+			if client.BatchWriteUnprocessed[email] > 0 {
+				client.BatchWriteUnprocessed[email]--
+				unprocessed[table] = append(unprocessed[table], req)
+			} else {
+				client.addSubscriberRecord(req.PutRequest.Item)
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}, nil
 }
 
 func (client *TestDynamoDbClient) DeleteItem(
-	context.Context, *dynamodb.DeleteItemInput, ...func(*dynamodb.Options),
+	_ context.Context,
+	input *dynamodb.DeleteItemInput,
+	_ ...func(*dynamodb.Options),
 ) (*dynamodb.DeleteItemOutput, error) {
-	return nil, client.ServerErr
+	client.DeleteItemInput = input
+	output := &dynamodb.DeleteItemOutput{
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	return output, client.ServerErr
+}
+
+// UpdateItem sets the DynamoDbVerifiedTimeIndexPartitionKey attribute of a
+// verified subscriber to the ":c" expression attribute value.
+//
+// If UpdateItemOutput is set, it returns that instead of updating anything.
+//
+// It fails with a ConditionalCheckFailedException if the subscriber doesn't
+// exist or isn't verified.
+func (client *TestDynamoDbClient) UpdateItem(
+	_ context.Context,
+	input *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	client.UpdateItemInputs = append(client.UpdateItemInputs, input)
+
+	if client.UpdateItemErr != nil {
+		return nil, client.UpdateItemErr
+	} else if client.UpdateItemOutput != nil {
+		return client.UpdateItemOutput, nil
+	}
+	email, _ := (&dbParser{input.Key}).GetString("email")
+	sub := client.findSubscriberRecord(email)
+
+	if _, ok := sub[DynamoDbVerifiedIndexPartitionKey]; !ok {
+		msg := "subscriber not verified: " + email
+		return nil, &types.ConditionalCheckFailedException{Message: &msg}
+	}
+	sub[DynamoDbVerifiedTimeIndexPartitionKey] =
+		input.ExpressionAttributeValues[":c"]
+	output := &dynamodb.UpdateItemOutput{
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	return output, nil
+}
+
+// Query returns verified subscribers from the DynamoDbVerifiedTimeIndexName
+// index whose timestamps fall between the ":s" and ":e" expression attribute
+// values, ordered by timestamp.
+//
+// Like the real index, it only returns subscribers with a
+// DynamoDbVerifiedTimeIndexPartitionKey attribute equal to the ":c" value. If
+// QuerySize isn't zero, it returns at most QuerySize subscribers per page.
+func (client *TestDynamoDbClient) Query(
+	_ context.Context,
+	input *dynamodb.QueryInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.QueryOutput, error) {
+	client.QueryInput = input
+
+	if client.ServerErr != nil {
+		return nil, client.ServerErr
+	}
+	values := &dbParser{input.ExpressionAttributeValues}
+	cohort, _ := values.GetString(":c")
+	start, _ := values.GetInt64(":s")
+	end, _ := values.GetInt64(":e")
+	verifiedAt := func(sub dbAttributes) (ts int64) {
+		ts, _ = (&dbParser{sub}).GetInt64(DynamoDbVerifiedTimeIndexSortKey)
+		return
+	}
+
+	items := []dbAttributes{}
+	for _, sub := range client.Subscribers {
+		p := &dbParser{sub}
+		c, _ := p.GetString(DynamoDbVerifiedTimeIndexPartitionKey)
+		if ts := verifiedAt(sub); c == cohort && start <= ts && ts <= end {
+			items = append(items, sub)
+		}
+	}
+	slices.SortStableFunc(items, func(lhs, rhs dbAttributes) int {
+		return int(verifiedAt(lhs) - verifiedAt(rhs))
+	})
+
+	// Skip past the start key, then return up to QuerySize items.
+	if startKey := input.ExclusiveStartKey; startKey != nil {
+		startEmail, _ := (&dbParser{startKey}).GetString("email")
+		for i, sub := range items {
+			email, _ := (&dbParser{sub}).GetString("email")
+			if email == startEmail {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	var lastKey dbAttributes
+	if client.QuerySize != 0 && len(items) > client.QuerySize {
+		items = items[:client.QuerySize]
+		last := items[len(items)-1]
+		lastKey = dbAttributes{}
+		for _, key := range []string{
+			"email",
+			DynamoDbVerifiedTimeIndexPartitionKey,
+			DynamoDbVerifiedTimeIndexSortKey,
+		} {
+			lastKey[key] = last[key]
+		}
+	}
+	output := &dynamodb.QueryOutput{
+		Count:            int32(len(items)),
+		Items:            items,
+		LastEvaluatedKey: lastKey,
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	return output, nil
 }
 
 func (client *TestDynamoDbClient) addSubscriberRecord(sub dbAttributes) {
 	client.Subscribers = append(client.Subscribers, sub)
 }
 
+func (client *TestDynamoDbClient) findSubscriberRecord(
+	email string,
+) dbAttributes {
+	for _, sub := range client.Subscribers {
+		if addr, _ := (&dbParser{sub}).GetString("email"); addr == email {
+			return sub
+		}
+	}
+	return nil
+}
+
 func (client *TestDynamoDbClient) addSubscribers(subs []*Subscriber) {
 	for _, sub := range subs {
 		subRec := newSubscriberRecord(sub)
@@ -153,6 +427,7 @@ func (client *TestDynamoDbClient) Scan(
 	_ context.Context, input *dynamodb.ScanInput, _ ...func(*dynamodb.Options),
 ) (output *dynamodb.ScanOutput, err error) {
 	client.ScanCalls++
+	client.ScanInput = input
 
 	err = client.ScanErr
 	if err != nil {
@@ -178,8 +453,13 @@ func (client *TestDynamoDbClient) Scan(
 	}
 	startKey := getEmail(input.ExclusiveStartKey)
 	started := len(startKey) == 0
+	scanSize := client.ScanSize
+	if limit := int(aws.ToInt32(input.Limit)); limit != 0 &&
+		(scanSize == 0 || limit < scanSize) {
+		scanSize = limit
+	}
 	atScanLimit := func() bool {
-		return client.ScanSize != 0 && len(items) == client.ScanSize
+		return scanSize != 0 && len(items) == scanSize
 	}
 	var lastKey dbAttributes
 
@@ -197,14 +477,28 @@ func (client *TestDynamoDbClient) Scan(
 			break
 		}
 	}
-	output = &dynamodb.ScanOutput{Items: items, LastEvaluatedKey: lastKey}
+	output = &dynamodb.ScanOutput{
+		Count:            int32(len(items)),
+		LastEvaluatedKey: lastKey,
+		ConsumedCapacity: client.consumedCapacity(input.ReturnConsumedCapacity),
+	}
+	if input.Select != types.SelectCount {
+		output.Items = items
+	}
 	return
 }
 
-func newSubscriberRecord(sub *Subscriber) dbAttributes {
-	return dbAttributes{
-		"email":            &dbString{Value: sub.Email},
-		"uid":              &dbString{Value: sub.Uid.String()},
-		string(sub.Status): toDynamoDbTimestamp(sub.Timestamp),
+func (client *TestDynamoDbClient) consumedCapacity(
+	rcc types.ReturnConsumedCapacity,
+) *types.ConsumedCapacity {
+	if rcc != types.ReturnConsumedCapacityTotal {
+		return nil
+	}
+	return &types.ConsumedCapacity{
+		CapacityUnits: aws.Float64(client.CapacityUnits),
 	}
 }
+
+func newSubscriberRecord(sub *Subscriber) dbAttributes {
+	return subscriberItem(sub)
+}
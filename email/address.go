@@ -6,10 +6,17 @@ import (
 	"fmt"
 	"net"
 	"net/mail"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/types"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
 )
 
 // AddressValidator wraps the ValidateAddress method.
@@ -26,12 +33,36 @@ type AddressValidator interface {
 	) (failure *ValidationFailure, err error)
 }
 
+// FailureReasonSuppressed is the ValidationFailure.Reason for an address on the
+// account-level suppression list.
+const FailureReasonSuppressed = "suppressed"
+
+// FailureReasonRoleBased is the ValidationFailure.Reason for an address with a
+// username from ProdAddressValidator.RoleUsers.
+const FailureReasonRoleBased = "role-based address"
+
 type ValidationFailure struct {
 	Address string
 	Reason  string
+
+	// SuppressionReason, if not empty, is the reason SES gave for adding the
+	// address to the account-level suppression list, e.g., "BOUNCE" or
+	// "COMPLAINT". See ProdAddressValidator.SuppressionReasons.
+	SuppressionReason string
+
+	// Suppressed is true if the address is on the account-level suppression
+	// list, either already or because ValidateAddress added it after all of
+	// its domain's mail hosts failed validation. Sending to such an address
+	// is equivalent to a hard bounce, unlike other failures, such as an MX
+	// failure below MxFailurePolicy.Threshold or a role-based address.
+	Suppressed bool
 }
 
 func (vf *ValidationFailure) String() string {
+	if vf.SuppressionReason != "" {
+		const fmtStr = "%s: %s (reason: %s)"
+		return fmt.Sprintf(fmtStr, vf.Address, vf.Reason, vf.SuppressionReason)
+	}
 	return fmt.Sprintf("%s: %s", vf.Address, vf.Reason)
 }
 
@@ -51,8 +82,75 @@ type Resolver interface {
 type ProdAddressValidator struct {
 	Suppressor Suppressor
 	Resolver   Resolver
+
+	// AllowedSingleLabelDomains lists domains without any dots, such as
+	// "intranet", that ValidateAddress should accept. This is for intranet
+	// deployments; all other single-label domains are rejected, since they
+	// can't receive email from the public internet.
+	AllowedSingleLabelDomains []string
+
+	// AllowedIpLiteralRanges lists IP address ranges from which ValidateAddress
+	// should accept addresses with IP literal domains, such as
+	// "user@[10.0.0.5]" or "user@[IPv6:fd00::5]". This is for internal
+	// deployments; all other IP literal domains are rejected. Accepted IP
+	// literal domains skip the mail host check, since they have no MX records.
+	AllowedIpLiteralRanges []netip.Prefix
+
+	// MxFailures, if not nil, determines when to suppress an address after
+	// all of its domain's MX hosts fail validation. If nil, the address is
+	// suppressed after the first such failure.
+	MxFailures *MxFailurePolicy
+
+	// InvalidUsers and InvalidDomains contain usernames and domains to reject
+	// in addition to the built-in defaults, which always apply. Entries
+	// augment the defaults; they can't remove any. Either may be nil.
+	//
+	// Usernames must be lowercase and must not contain a "+subaddress". They
+	// match addresses regardless of case.
+	// Domains must be lowercase ASCII (punycode), and also match every
+	// subdomain up to the primary (registrable) domain. For example, an entry
+	// for "spam.co.uk" matches "mail.spam.co.uk", but not "foo.co.uk".
+	InvalidUsers   map[string]bool
+	InvalidDomains map[string]bool
+
+	// RoleUsers contains usernames of role-based addresses, such as "info" or
+	// "sales", that typically reach a group or shared mailbox rather than one
+	// person. Such addresses fail validation with FailureReasonRoleBased
+	// instead of being rejected as invalid, so the caller can decide whether
+	// to accept them. There are no defaults; RoleUsers may be nil.
+	//
+	// Usernames must be lowercase and must not contain a "+subaddress". They
+	// match addresses regardless of case.
+	RoleUsers map[string]bool
+
+	// LookupTimeout, if greater than zero, limits the duration of each DNS
+	// lookup. An expired lookup produces an ErrLookupTimeout error wrapped
+	// with ops.ErrExternal, and never causes the address to be suppressed.
+	LookupTimeout time.Duration
+
+	// SkipSuppressionCheck and SkipMailHostCheck disable checking the
+	// account-level suppression list and validating the domain's mail hosts,
+	// respectively. They're intended for importing subscribers already known
+	// to be valid, for whom these checks would add little beyond latency.
+	SkipSuppressionCheck bool
+	SkipMailHostCheck    bool
+
+	// SuppressionReasons, if not nil, checks the suppression list in place of
+	// Suppressor.IsSuppressed, setting ValidationFailure.SuppressionReason for
+	// an address that fails validation with FailureReasonSuppressed. It uses
+	// the same SES API call as IsSuppressed, so it adds no extra calls.
+	SuppressionReasons SuppressionReasonLookup
+
+	// LookupLimit, if not nil, caps the number of DNS lookups in progress at
+	// once across all validations. Lookups over the limit wait their turn;
+	// LookupTimeout only applies once a lookup begins.
+	LookupLimit *LookupLimit
 }
 
+// ErrLookupTimeout indicates a DNS lookup exceeded its deadline, either from
+// ProdAddressValidator.LookupTimeout or from the incoming context.
+const ErrLookupTimeout = types.SentinelError("DNS lookup timed out")
+
 // ValidateAddress parses and validates email addresses.
 //
 // If the address passes validation, the returned ValidationFailure and error
@@ -64,11 +162,24 @@ type ProdAddressValidator struct {
 // This method:
 //
 //   - Parses the username and domain with the help of [mail.ParseAddress]
-//   - Rejects known invalid usernames and domains
+//   - Rejects usernames containing non-ASCII characters, since Simple Email
+//     Service doesn't support SMTPUTF8
+//   - Converts internationalized domain names to their ASCII (punycode) form
+//   - Rejects known invalid usernames and domains, including those from
+//     InvalidUsers and InvalidDomains
+//   - Flags role-based usernames from RoleUsers with FailureReasonRoleBased
+//   - Rejects IP literal domains, such as "[10.0.0.5]", unless the address
+//     falls within AllowedIpLiteralRanges
+//   - Rejects single-label domains (without any dots), unless present in
+//     AllowedSingleLabelDomains
 //   - Rejects addresses on the Simple Email Service account-level suppression
-//     list
+//     list, unless SkipSuppressionCheck is set
 //   - Looks up the DNS MX records (mail hosts) for the domain
 //   - Confirms that at least one mail host is valid by examining DNS records
+//   - Suppresses the address if no mail host is valid, subject to MxFailures
+//
+// The last three steps only happen if SkipMailHostCheck isn't set and the
+// domain isn't an IP literal.
 //
 // The mail host validation happens by iterating over each MX record until one
 // satisfies the following series of checks:
@@ -132,46 +243,112 @@ type ProdAddressValidator struct {
 func (av *ProdAddressValidator) ValidateAddress(
 	ctx context.Context, address string,
 ) (failure *ValidationFailure, err error) {
-	var result bool
+	var result, suppressed bool
+	var supReason string
 	email, user, domain, err := parseAddress(address)
+	fail := func(reason string) (*ValidationFailure, error) {
+		return &ValidationFailure{Address: address, Reason: reason}, nil
+	}
 
 	if err != nil {
-		return &ValidationFailure{address, "failed to parse"}, nil
-	} else if isKnownInvalidAddress(user, domain) {
-		return &ValidationFailure{address, "invalid"}, nil
+		return fail("failed to parse")
+	} else if !isAscii(user) {
+		return fail("non-ASCII username")
+	} else if av.isKnownInvalidAddress(user, domain) {
+		return fail("invalid")
+	} else if av.isRoleAddress(user) {
+		return fail(FailureReasonRoleBased)
+	} else if av.isDisallowedSingleLabelDomain(domain) {
+		return fail("single-label domain")
 	} else if isSuspiciousAddress(user, domain) {
-		return &ValidationFailure{address, "suspicious"}, nil
-	} else if result, err = av.Suppressor.IsSuppressed(ctx, email); err != nil {
+		return fail("suspicious")
+	} else if result, supReason, err = av.isSuppressed(ctx, email); err != nil {
 		return
 	} else if result {
-		return &ValidationFailure{address, "suppressed"}, nil
-	} else if isProblematicYetValidDomain(domain) {
+		return suppressedFailure(address, supReason), nil
+	} else if av.SkipMailHostCheck || isIpLiteral(domain) ||
+		isProblematicYetValidDomain(domain) {
 		return
-	} else if err = av.checkMailHosts(ctx, email, domain); err == nil {
+	}
+
+	if suppressed, err = av.checkMailHosts(ctx, email, domain); err == nil {
 		return
 	} else if errors.Is(err, ops.ErrExternal) {
 		return
 	}
 
 	const dnsFailFmt = "failed DNS validation: %s"
-	return &ValidationFailure{address, fmt.Sprintf(dnsFailFmt, err)}, nil
+	failure, err = fail(fmt.Sprintf(dnsFailFmt, err))
+	failure.Suppressed = suppressed
+	return
+}
+
+func (av *ProdAddressValidator) isSuppressed(
+	ctx context.Context, email string,
+) (suppressed bool, reason string, err error) {
+	if av.SkipSuppressionCheck {
+		return
+	} else if av.SuppressionReasons != nil {
+		return av.SuppressionReasons.SuppressionReason(ctx, email)
+	}
+	suppressed, err = av.Suppressor.IsSuppressed(ctx, email)
+	return
+}
+
+func suppressedFailure(address, reason string) *ValidationFailure {
+	return &ValidationFailure{
+		Address:           address,
+		Reason:            FailureReasonSuppressed,
+		SuppressionReason: reason,
+		Suppressed:        true,
+	}
 }
 
+// parseAddress converts internationalized domain names to ASCII.
+//
+// Domains that are already ASCII are returned unchanged, preserving their case,
+// though they must still be valid according to the IDNA lookup profile.
+//
+// IP literal domains, such as "[10.0.0.5]", are returned unchanged.
+//
+// The email return value will contain the converted domain as well.
 func parseAddress(address string) (email, user, domain string, err error) {
 	addr, err := mail.ParseAddress(address)
 
 	if err != nil {
 		return
-	} else {
-		email = addr.Address
-		// mail.ParseAddress guarantees an "@domain" part is present.
-		i := strings.LastIndexByte(email, '@')
-		user = email[0:i]
-		domain = email[i+1:]
 	}
+
+	// mail.ParseAddress guarantees an "@domain" part is present.
+	i := strings.LastIndexByte(addr.Address, '@')
+	domain = addr.Address[i+1:]
+	asciiDomain := domain
+
+	if !isIpLiteral(domain) {
+		asciiDomain, err = idna.Lookup.ToASCII(domain)
+	}
+
+	if err != nil {
+		domain = ""
+		err = fmt.Errorf("invalid domain in %s: %w", address, err)
+		return
+	} else if !isAscii(domain) {
+		domain = asciiDomain
+	}
+	user = addr.Address[0:i]
+	email = user + "@" + domain
 	return
 }
 
+func isAscii(s string) bool {
+	for _, c := range s {
+		if c > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
 var invalidUserNames = map[string]bool{
 	"postmaster": true,
 	"abuse":      true,
@@ -186,24 +363,121 @@ var invalidDomains = map[string]bool{
 	"txt.bell.ca": true,
 }
 
-func isKnownInvalidAddress(user, domain string) bool {
-	return invalidUserNames[strings.Split(user, "+")[0]] ||
-		strings.HasPrefix(domain, "[") ||
-		net.ParseIP(domain) != nil ||
-		invalidDomains[domain] ||
-		invalidDomains[getPrimaryDomain(domain)]
+func (av *ProdAddressValidator) isKnownInvalidAddress(
+	user, domain string,
+) bool {
+	name := strings.ToLower(strings.Split(user, "+")[0])
+	if invalidUserNames[name] || av.InvalidUsers[name] {
+		return true
+	} else if strings.HasPrefix(domain, "[") {
+		return !av.isAllowedIpLiteral(domain)
+	}
+	return net.ParseIP(domain) != nil || av.isKnownInvalidDomain(domain)
+}
+
+// isIpLiteral returns true if domain is enclosed in brackets, such as
+// "[10.0.0.5]".
+//
+// Such domains can't be internationalized domain names, and per RFC 5321
+// should contain an IP address. isAllowedIpLiteral validates the address.
+//
+// - https://datatracker.ietf.org/doc/html/rfc5321#section-4.1.3
+func isIpLiteral(domain string) bool {
+	return strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]")
+}
+
+// isAllowedIpLiteral returns true if domain contains a valid IP literal within
+// AllowedIpLiteralRanges.
+//
+// Per RFC 5321, an IPv6 literal must begin with the "IPv6:" tag, and an IPv4
+// literal must not have any tag.
+//
+// - https://datatracker.ietf.org/doc/html/rfc5321#section-4.1.3
+func (av *ProdAddressValidator) isAllowedIpLiteral(domain string) bool {
+	if !isIpLiteral(domain) {
+		return false
+	}
+	literal := domain[1 : len(domain)-1]
+	const ipv6Tag = "IPv6:"
+	isIpv6 := len(literal) > len(ipv6Tag) &&
+		strings.EqualFold(literal[:len(ipv6Tag)], ipv6Tag)
+
+	if isIpv6 {
+		literal = literal[len(ipv6Tag):]
+	}
+
+	addr, err := netip.ParseAddr(literal)
+	if err != nil || addr.Zone() != "" || addr.Is6() != isIpv6 {
+		return false
+	}
+	return slices.ContainsFunc(
+		av.AllowedIpLiteralRanges,
+		func(allowed netip.Prefix) bool { return allowed.Contains(addr) },
+	)
 }
 
+func (av *ProdAddressValidator) isRoleAddress(user string) bool {
+	name := strings.Split(user, "+")[0]
+	return av.RoleUsers[strings.ToLower(name)]
+}
+
+// isKnownInvalidDomain checks domain and each of its parent domains up to and
+// including its primary domain against invalidDomains and InvalidDomains.
+//
+// This matches subdomains of invalid domains without matching unrelated domains
+// that happen to end with the same labels, e.g., "example.com.evil.co".
+func (av *ProdAddressValidator) isKnownInvalidDomain(domain string) bool {
+	domain = strings.ToLower(domain)
+	primary := getPrimaryDomain(domain)
+
+	for {
+		if invalidDomains[domain] || av.InvalidDomains[domain] {
+			return true
+		} else if domain == primary {
+			return false
+		}
+
+		var found bool
+		if _, domain, found = strings.Cut(domain, "."); !found {
+			return false
+		}
+	}
+}
+
+// getPrimaryDomain returns the registrable domain for domainName.
+//
+// This is the public suffix plus one label, e.g., "mike-bland.com" for
+// "foobar.mail.mike-bland.com" and "foo.co.uk" for "bar.foo.co.uk". If
+// domainName has no registrable domain, such as "localhost" or "co.uk",
+// getPrimaryDomain returns domainName unchanged.
+//
+// - https://publicsuffix.org/
 func getPrimaryDomain(domainName string) string {
-	parts := strings.Split(domainName, ".")
-	return strings.Join(parts[len(parts)-2:], ".")
+	primary, err := publicsuffix.EffectiveTLDPlusOne(domainName)
+	if err != nil {
+		return domainName
+	}
+	return primary
+}
+
+func (av *ProdAddressValidator) isDisallowedSingleLabelDomain(
+	domain string,
+) bool {
+	if strings.Contains(domain, ".") || isIpLiteral(domain) {
+		return false
+	}
+	return !slices.ContainsFunc(
+		av.AllowedSingleLabelDomains,
+		func(allowed string) bool { return strings.EqualFold(allowed, domain) },
+	)
 }
 
 func isSuspiciousAddress(user, domain string) bool {
 	if _, err := strconv.Atoi(user); err == nil {
 		return true
 	}
-	return strings.ToUpper(user) == user || strings.ToUpper(domain) == domain
+	return strings.ToUpper(user) == user ||
+		(strings.ToUpper(domain) == domain && !isIpLiteral(domain))
 }
 
 var problematicYetValidDomains = map[string]bool{
@@ -243,19 +517,22 @@ var problematicYetValidDomains = map[string]bool{
 // However, the point is that we shouldn't have to. Inclusion in the
 // knownGoodDomains set is a workaround, not an optimization.
 func isProblematicYetValidDomain(domain string) bool {
-	return problematicYetValidDomains[domain]
+	return problematicYetValidDomains[strings.ToLower(domain)]
 }
 
 func (av *ProdAddressValidator) checkMailHosts(
 	ctx context.Context, email, domain string,
-) error {
-	mxRecords, err := lookup(av.Resolver.LookupMX, ctx, domain)
+) (suppressed bool, err error) {
+	var mxRecords []*net.MX
+	mxRecords, err = limitedLookup(
+		av.LookupLimit, av.Resolver.LookupMX, ctx, av.LookupTimeout, domain,
+	)
 
 	// If LookupMX failed to resolve any hosts, it could be due to a typo. In
 	// this case, don't add the address to the suppression list.
 	if len(mxRecords) == 0 {
 		const errFmt = "failed to retrieve MX records for %s: %w"
-		return fmt.Errorf(errFmt, domain, err)
+		return false, fmt.Errorf(errFmt, domain, err)
 	}
 
 	errs := make([]error, len(mxRecords))
@@ -264,13 +541,19 @@ func (av *ProdAddressValidator) checkMailHosts(
 		errs[i] = av.checkMailHost(ctx, record.Host)
 		if errs[i] == nil {
 			// Found a good MX host.
-			return nil
+			return false, nil
 		}
 	}
 
 	const errFmt = "no valid MX hosts for %s: %w"
 	err = fmt.Errorf(errFmt, domain, errors.Join(errs...))
 
+	// A timeout doesn't prove the MX hosts are invalid, so neither suppress
+	// the address nor count the failure towards MxFailures.
+	if errors.Is(err, ErrLookupTimeout) {
+		return
+	}
+
 	// If LookupMX succeeded, but validating all the MX records fail, sending a
 	// message to the address would bounce, so suppress the address. This will
 	// short circuit ValidateAddress before it calls this method for the same
@@ -282,15 +565,30 @@ func (av *ProdAddressValidator) checkMailHosts(
 	// some point.
 	//
 	// If it is a network issue, suppression will probably fail as well, so we
-	// likely won't accidentally suppress anyone.
+	// likely won't accidentally suppress anyone. MxFailures further guards
+	// against transient issues by delaying suppression until repeated
+	// failures occur.
+	if av.MxFailures != nil {
+		count, suppress, recordErr := av.MxFailures.RecordFailure(ctx, email)
+		if recordErr != nil {
+			return false, errors.Join(err, recordErr)
+		} else if !suppress {
+			const notSuppressedFmt = "%w (not suppressed: failure %d of %d)"
+			return false, fmt.Errorf(
+				notSuppressedFmt, err, count, av.MxFailures.Threshold,
+			)
+		}
+	}
 	suppressionErr := av.Suppressor.Suppress(ctx, email, ops.RemoveReasonBounce)
-	return errors.Join(err, suppressionErr)
+	return suppressionErr == nil, errors.Join(err, suppressionErr)
 }
 
 func (av *ProdAddressValidator) checkMailHost(
 	ctx context.Context, mailHost string,
 ) error {
-	mailHostIps, err := lookup(av.Resolver.LookupHost, ctx, mailHost)
+	mailHostIps, err := limitedLookup(
+		av.LookupLimit, av.Resolver.LookupHost, ctx, av.LookupTimeout, mailHost,
+	)
 
 	if err != nil {
 		return err
@@ -312,7 +610,9 @@ func (av *ProdAddressValidator) checkMailHost(
 func (av *ProdAddressValidator) checkReverseLookupHostResolvesToOriginalIp(
 	ctx context.Context, addr string,
 ) error {
-	hosts, err := lookup(av.Resolver.LookupAddr, ctx, addr)
+	hosts, err := limitedLookup(
+		av.LookupLimit, av.Resolver.LookupAddr, ctx, av.LookupTimeout, addr,
+	)
 
 	if err != nil {
 		return err
@@ -333,7 +633,9 @@ func (av *ProdAddressValidator) checkReverseLookupHostResolvesToOriginalIp(
 func (av *ProdAddressValidator) checkHostResolvesToAddress(
 	ctx context.Context, host, addr string,
 ) error {
-	addrs, err := lookup(av.Resolver.LookupHost, ctx, host)
+	addrs, err := limitedLookup(
+		av.LookupLimit, av.Resolver.LookupHost, ctx, av.LookupTimeout, host,
+	)
 
 	if err != nil {
 		return err
@@ -347,6 +649,28 @@ func (av *ProdAddressValidator) checkHostResolvesToAddress(
 	return fmt.Errorf("%s resolves to %s", host, strings.Join(addrs, ", "))
 }
 
+// limitedLookup calls lookup once limit permits another lookup to begin.
+//
+// If ctx is done before then, it returns an error wrapping ops.ErrExternal and
+// ErrLookupTimeout, since the failure says nothing about the target's records.
+func limitedLookup[
+	T []string | []*net.MX, F func(context.Context, string) (T, error),
+](
+	limit *LookupLimit,
+	lookupFunc F,
+	ctx context.Context,
+	timeout time.Duration,
+	target string,
+) (values T, err error) {
+	if err = limit.acquire(ctx); err != nil {
+		const errFmt = "%w: %w waiting to look up %s: %w"
+		err = fmt.Errorf(errFmt, ops.ErrExternal, ErrLookupTimeout, target, err)
+		return
+	}
+	defer limit.release()
+	return lookup(lookupFunc, ctx, timeout, target)
+}
+
 // lookup calls a net.Resolver method and processes its errors.
 //
 // Specifically, it differentiates successful DNS responses that return no
@@ -354,6 +678,8 @@ func (av *ProdAddressValidator) checkHostResolvesToAddress(
 // errors:
 //
 //   - It returns nil if the error is a DNSError and IsNotFound is true.
+//   - It wraps the error with ops.ErrExternal and ErrLookupTimeout if the
+//     lookup's context deadline expired.
 //   - Otherwise it presumes the error is a network or other external failure
 //     and wraps it with ops.ErrExternal.
 //
@@ -377,14 +703,25 @@ func (av *ProdAddressValidator) checkHostResolvesToAddress(
 // [net.Resolver.LookupHost] doesn't explicitly state that it could return both
 // valid records and a non nil error. However, wrapping it with [lookup] will do
 // the right thing regardless.
+//
+// If timeout is greater than zero, the lookup will use a context derived from
+// ctx that expires after timeout.
 func lookup[T []string | []*net.MX, F func(context.Context, string) (T, error)](
-	lookup F, ctx context.Context, target string,
+	lookup F, ctx context.Context, timeout time.Duration, target string,
 ) (values T, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	values, err = lookup(ctx, target)
 	var dnsErr *net.DNSError
 
 	if len(values) != 0 {
 		err = nil
+	} else if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		const errFmt = "%w: %w for %s: %w"
+		err = fmt.Errorf(errFmt, ops.ErrExternal, ErrLookupTimeout, target, err)
 	} else if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
 		err = fmt.Errorf("no records for %s", target)
 	} else {
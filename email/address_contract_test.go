@@ -30,7 +30,9 @@ func TestValidateAddressSucceedsUsingLiveDnsService(t *testing.T) {
 	assert.NilError(t, err)
 
 	suppressor := &SesSuppressor{sesv2.NewFromConfig(cfg)}
-	v := ProdAddressValidator{suppressor, net.DefaultResolver}
+	v := ProdAddressValidator{
+		Suppressor: suppressor, Resolver: net.DefaultResolver,
+	}
 	ctx := context.Background()
 
 	failure, err := v.ValidateAddress(ctx, goodEmailAddress)
@@ -6,8 +6,10 @@ import (
 	"context"
 	"errors"
 	"net"
+	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
@@ -22,11 +24,36 @@ type TestResolver struct {
 	hostErrs  map[string]error
 	addrs     map[string][]string
 	addrErrs  map[string]error
+
+	// blocked contains names for which lookups hang until their context is
+	// done, simulating an unresponsive DNS server.
+	blocked map[string]bool
+}
+
+// block waits for ctx to be done if name is blocked.
+//
+// If ctx is never done, block gives up after a few seconds so the test fails
+// instead of hanging.
+func (tr *TestResolver) block(ctx context.Context, name string) error {
+	if !tr.blocked[name] {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return &net.DNSError{
+			Err: ctx.Err().Error(), Name: name, IsTimeout: true,
+		}
+	case <-time.After(5 * time.Second):
+		return errors.New("lookup of " + name + " never timed out")
+	}
 }
 
 func (tr *TestResolver) LookupMX(
-	_ context.Context, domain string,
+	ctx context.Context, domain string,
 ) ([]*net.MX, error) {
+	if err := tr.block(ctx, domain); err != nil {
+		return nil, err
+	}
 	return tr.mailHosts[domain], tr.mxErrs[domain]
 }
 
@@ -36,8 +63,11 @@ func (tr *TestResolver) setMxFailure(domain string, err error) {
 }
 
 func (tr *TestResolver) LookupHost(
-	_ context.Context, host string,
+	ctx context.Context, host string,
 ) (addrs []string, err error) {
+	if err = tr.block(ctx, host); err != nil {
+		return
+	}
 	return tr.hosts[host], tr.hostErrs[host]
 }
 
@@ -47,8 +77,11 @@ func (tr *TestResolver) setHostFailure(host string, err error) {
 }
 
 func (tr *TestResolver) LookupAddr(
-	_ context.Context, addr string,
+	ctx context.Context, addr string,
 ) (names []string, err error) {
+	if err = tr.block(ctx, addr); err != nil {
+		return
+	}
 	return tr.addrs[addr], tr.addrErrs[addr]
 }
 
@@ -79,6 +112,49 @@ func TestParseAddress(t *testing.T) {
 		assert.Equal(t, "acm.org", host)
 	})
 
+	t.Run("ConvertsInternationalizedDomainToAscii", func(t *testing.T) {
+		email, user, host, err := parseAddress("mbland@例え.jp")
+
+		assert.NilError(t, err)
+		assert.Equal(t, "mbland@xn--r8jz45g.jp", email)
+		assert.Equal(t, "mbland", user)
+		assert.Equal(t, "xn--r8jz45g.jp", host)
+	})
+
+	t.Run("FoldsCaseOfInternationalizedDomain", func(t *testing.T) {
+		email, _, host, err := parseAddress("mbland@MÜLLER.de")
+
+		assert.NilError(t, err)
+		assert.Equal(t, "mbland@xn--mller-kva.de", email)
+		assert.Equal(t, "xn--mller-kva.de", host)
+	})
+
+	t.Run("LeavesAsciiDomainUnchanged", func(t *testing.T) {
+		email, _, host, err := parseAddress("mbland@ACM.org")
+
+		assert.NilError(t, err)
+		assert.Equal(t, "mbland@ACM.org", email)
+		assert.Equal(t, "ACM.org", host)
+	})
+
+	t.Run("LeavesNonAsciiUsernameUnchanged", func(t *testing.T) {
+		email, user, host, err := parseAddress("用户@example.com")
+
+		assert.NilError(t, err)
+		assert.Equal(t, "用户@example.com", email)
+		assert.Equal(t, "用户", user)
+		assert.Equal(t, "example.com", host)
+	})
+
+	t.Run("FailsIfDomainCannotBeConvertedToAscii", func(t *testing.T) {
+		email, user, host, err := parseAddress("mbland@foo_bar.com")
+
+		assert.Equal(t, "", email)
+		assert.Equal(t, "", user)
+		assert.Equal(t, "", host)
+		assert.ErrorContains(t, err, "invalid domain in mbland@foo_bar.com: ")
+	})
+
 	t.Run("Fails", func(t *testing.T) {
 		email, user, host, err := parseAddress("mblandATacm.org")
 
@@ -98,18 +174,77 @@ func TestGetPrimaryDomain(t *testing.T) {
 	assert.Equal(
 		t, "mike-bland.com", getPrimaryDomain("foobar.mail.mike-bland.com"),
 	)
+	assert.Equal(t, "foo.co.uk", getPrimaryDomain("bar.foo.co.uk"))
+	assert.Equal(t, "foo.com.au", getPrimaryDomain("mail.foo.com.au"))
+	assert.Equal(
+		t, "foo.blogspot.com", getPrimaryDomain("bar.foo.blogspot.com"),
+	)
+	assert.Equal(
+		t, "co.uk", getPrimaryDomain("co.uk"),
+		"public suffix should remain unchanged",
+	)
+	assert.Equal(t, "localhost", getPrimaryDomain("localhost"))
+}
+
+func TestIsKnownInvalidDomain(t *testing.T) {
+	av := &ProdAddressValidator{}
+
+	t.Run("TrueIfInvalidDomain", func(t *testing.T) {
+		assert.Assert(t, av.isKnownInvalidDomain("example.com"))
+		assert.Assert(t, av.isKnownInvalidDomain("txt.att.net"))
+	})
+
+	t.Run("TrueIfSubdomainOfInvalidDomain", func(t *testing.T) {
+		assert.Assert(t, av.isKnownInvalidDomain("foo.example.com"))
+		assert.Assert(t, av.isKnownInvalidDomain("foo.txt.att.net"))
+	})
+
+	t.Run("FalseIfInvalidDomainIsOnlyAPrefix", func(t *testing.T) {
+		assert.Assert(t, !av.isKnownInvalidDomain("example.com.evil.co"))
+	})
+
+	t.Run("FalseForSiblingOfInvalidDomain", func(t *testing.T) {
+		assert.Assert(t, !av.isKnownInvalidDomain("mms.att.net"))
+	})
+
+	t.Run("IgnoresCase", func(t *testing.T) {
+		assert.Assert(t, av.isKnownInvalidDomain("Foo.Example.com"))
+	})
+
+	t.Run("HandlesMultiPartPublicSuffix", func(t *testing.T) {
+		av := &ProdAddressValidator{
+			InvalidDomains: map[string]bool{"spam.co.uk": true},
+		}
+
+		assert.Assert(t, av.isKnownInvalidDomain("mail.spam.co.uk"))
+		assert.Assert(t, !av.isKnownInvalidDomain("foo.co.uk"))
+		assert.Assert(t, !av.isKnownInvalidDomain("spam.co.uk.evil.co"))
+	})
+
+	t.Run("ChecksCustomDomainsAndDefaults", func(t *testing.T) {
+		av := &ProdAddressValidator{
+			InvalidDomains: map[string]bool{"spammy.com": true},
+		}
+
+		assert.Assert(t, av.isKnownInvalidDomain("spammy.com"))
+		assert.Assert(t, av.isKnownInvalidDomain("mail.spammy.com"))
+		assert.Assert(t, av.isKnownInvalidDomain("example.com"))
+		assert.Assert(t, !av.isKnownInvalidDomain("acm.org"))
+	})
 }
 
 func TestIsKnownInvalidAddress(t *testing.T) {
+	av := &ProdAddressValidator{}
+
 	t.Run("False", func(t *testing.T) {
-		assert.Assert(t, !isKnownInvalidAddress("mbland", "acm.org"))
+		assert.Assert(t, !av.isKnownInvalidAddress("mbland", "acm.org"))
 	})
 
 	t.Run("TrueIfInvalidUserName", func(t *testing.T) {
-		assert.Assert(t, isKnownInvalidAddress("postmaster", "acm.org"))
+		assert.Assert(t, av.isKnownInvalidAddress("postmaster", "acm.org"))
 		assert.Assert(
 			t,
-			isKnownInvalidAddress("postmaster+ignore-subaddress", "acm.org"),
+			av.isKnownInvalidAddress("postmaster+ignore-subaddress", "acm.org"),
 			"should ignore +subaddresses",
 		)
 	})
@@ -117,7 +252,7 @@ func TestIsKnownInvalidAddress(t *testing.T) {
 	t.Run("TrueIfInvalidDomain", func(t *testing.T) {
 		assert.Assert(
 			t,
-			isKnownInvalidAddress("mbland", "[192.168.0.1]"),
+			av.isKnownInvalidAddress("mbland", "[192.168.0.1]"),
 			"should not allow IP address as a domain",
 		)
 
@@ -125,17 +260,92 @@ func TestIsKnownInvalidAddress(t *testing.T) {
 		// but it pays to be paranoid on the internet.
 		assert.Assert(
 			t,
-			isKnownInvalidAddress("mbland", "192.168.0.1"),
+			av.isKnownInvalidAddress("mbland", "192.168.0.1"),
 			"should detect IP addresses even without surrounding brackets",
 		)
 
-		assert.Assert(t, isKnownInvalidAddress("mbland", "example.com"))
+		assert.Assert(t, av.isKnownInvalidAddress("mbland", "example.com"))
 		assert.Assert(
 			t,
-			isKnownInvalidAddress("mbland", "foobar.example.com"),
+			av.isKnownInvalidAddress("mbland", "foobar.example.com"),
 			"should detect subdomains of primary invalid domains",
 		)
 	})
+
+	t.Run("FalseIfIpLiteralInAllowedRange", func(t *testing.T) {
+		av := &ProdAddressValidator{
+			AllowedIpLiteralRanges: []netip.Prefix{
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("fd00::/8"),
+			},
+		}
+
+		assert.Assert(t, !av.isKnownInvalidAddress("mbland", "[10.0.0.5]"))
+		assert.Assert(
+			t, !av.isKnownInvalidAddress("mbland", "[IPv6:fd00::5]"),
+		)
+		assert.Assert(
+			t, !av.isKnownInvalidAddress("mbland", "[ipv6:fd00::5]"),
+			"IPv6 tag should be case insensitive",
+		)
+
+		assert.Assert(t, av.isKnownInvalidAddress("mbland", "[192.168.0.1]"))
+		assert.Assert(
+			t,
+			av.isKnownInvalidAddress("mbland", "[fd00::5]"),
+			"IPv6 literal should require IPv6 tag",
+		)
+		assert.Assert(
+			t,
+			av.isKnownInvalidAddress("mbland", "[IPv6:10.0.0.5]"),
+			"IPv4 literal should not have IPv6 tag",
+		)
+		assert.Assert(t, av.isKnownInvalidAddress("mbland", "[intranet]"))
+		assert.Assert(t, av.isKnownInvalidAddress("mbland", "[10.0.0.5"))
+		assert.Assert(
+			t,
+			av.isKnownInvalidAddress("postmaster", "[10.0.0.5]"),
+			"should still reject invalid usernames",
+		)
+		assert.Assert(
+			t,
+			av.isKnownInvalidAddress("mbland", "10.0.0.5"),
+			"should still reject IP addresses without surrounding brackets",
+		)
+	})
+
+	t.Run("ChecksCustomUserNamesAndDefaults", func(t *testing.T) {
+		av := &ProdAddressValidator{
+			InvalidUsers: map[string]bool{"noreply": true, "root": true},
+		}
+
+		assert.Assert(t, av.isKnownInvalidAddress("noreply", "acm.org"))
+		assert.Assert(t, av.isKnownInvalidAddress("root+foo", "acm.org"))
+		assert.Assert(t, av.isKnownInvalidAddress("NoReply", "acm.org"))
+		assert.Assert(t, av.isKnownInvalidAddress("PostMaster", "acm.org"))
+		assert.Assert(t, av.isKnownInvalidAddress("postmaster", "acm.org"))
+		assert.Assert(t, !av.isKnownInvalidAddress("mbland", "acm.org"))
+	})
+
+	t.Run("UsesOnlyDefaultsIfCustomListsNil", func(t *testing.T) {
+		assert.Assert(t, is.Nil(av.InvalidUsers))
+		assert.Assert(t, is.Nil(av.InvalidDomains))
+
+		assert.Assert(t, av.isKnownInvalidAddress("abuse", "acm.org"))
+		assert.Assert(t, !av.isKnownInvalidAddress("noreply", "acm.org"))
+		assert.Assert(t, !av.isKnownInvalidAddress("mbland", "spammy.com"))
+	})
+}
+
+func TestIsRoleAddress(t *testing.T) {
+	av := &ProdAddressValidator{
+		RoleUsers: map[string]bool{"info": true, "sales": true},
+	}
+
+	assert.Assert(t, av.isRoleAddress("info"))
+	assert.Assert(t, av.isRoleAddress("Sales+news"))
+	assert.Assert(t, !av.isRoleAddress("mbland"))
+	assert.Assert(t, !(&ProdAddressValidator{}).isRoleAddress("info"))
 }
 
 func TestIsSuspiciousAddress(t *testing.T) {
@@ -181,10 +391,11 @@ func newAddressValidatorFixture() *addressValidatorFixture {
 		hostErrs:  map[string]error{},
 		addrs:     map[string][]string{},
 		addrErrs:  map[string]error{},
+		blocked:   map[string]bool{},
 	}
 	suppressor := &TestSuppressor{}
 	return &addressValidatorFixture{
-		&ProdAddressValidator{suppressor, resolver},
+		&ProdAddressValidator{Suppressor: suppressor, Resolver: resolver},
 		suppressor,
 		resolver,
 		context.Background(),
@@ -209,7 +420,7 @@ func TestLookup(t *testing.T) {
 		testHosts := []string{"foo.com", "bar.com", "baz.com"}
 		tr.addrs["127.0.0.1"] = testHosts
 
-		hosts, err := lookup(lookupAddr, ctx, "127.0.0.1")
+		hosts, err := lookup(lookupAddr, ctx, 0, "127.0.0.1")
 
 		assert.NilError(t, err)
 		assert.DeepEqual(t, testHosts, hosts)
@@ -221,7 +432,7 @@ func TestLookup(t *testing.T) {
 		tr.addrs["127.0.0.1"] = testHosts
 		tr.addrErrs["127.0.0.1"] = errors.New("some bad DNS records")
 
-		hosts, err := lookup(lookupAddr, ctx, "127.0.0.1")
+		hosts, err := lookup(lookupAddr, ctx, 0, "127.0.0.1")
 
 		assert.NilError(t, err)
 		assert.DeepEqual(t, testHosts, hosts)
@@ -233,7 +444,7 @@ func TestLookup(t *testing.T) {
 			Err: "no such host", IsNotFound: true,
 		}
 
-		hosts, err := lookup(lookupAddr, ctx, "127.0.0.1")
+		hosts, err := lookup(lookupAddr, ctx, 0, "127.0.0.1")
 
 		assert.Equal(t, len(hosts), 0)
 		assert.Error(t, err, "no records for 127.0.0.1")
@@ -246,7 +457,7 @@ func TestLookup(t *testing.T) {
 			Err: "test error", IsNotFound: false,
 		}
 
-		hosts, err := lookup(lookupAddr, ctx, "127.0.0.1")
+		hosts, err := lookup(lookupAddr, ctx, 0, "127.0.0.1")
 
 		assert.Equal(t, len(hosts), 0)
 		expectedErrMsg := ops.ErrExternal.Error() +
@@ -254,6 +465,32 @@ func TestLookup(t *testing.T) {
 		assert.ErrorContains(t, err, expectedErrMsg)
 		assertExternalError(t, err)
 	})
+
+	t.Run("FailsWithTimeoutErrorIfDeadlineExpires", func(t *testing.T) {
+		tr, _, ctx := setup()
+		tr.blocked["127.0.0.1"] = true
+
+		hosts, err := lookup(tr.LookupAddr, ctx, time.Millisecond, "127.0.0.1")
+
+		assert.Equal(t, len(hosts), 0)
+		expectedErrMsg := ops.ErrExternal.Error() +
+			": DNS lookup timed out for 127.0.0.1: "
+		assert.ErrorContains(t, err, expectedErrMsg)
+		assert.Assert(t, testutils.ErrorIs(err, ErrLookupTimeout))
+		assertExternalError(t, err)
+	})
+
+	t.Run("FailsWithTimeoutErrorIfParentDeadlineExpires", func(t *testing.T) {
+		tr, _, ctx := setup()
+		tr.blocked["127.0.0.1"] = true
+		ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		defer cancel()
+
+		_, err := lookup(tr.LookupAddr, ctx, time.Hour, "127.0.0.1")
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrLookupTimeout))
+		assertExternalError(t, err)
+	})
 }
 
 func TestCheckHostResolvesToAddress(t *testing.T) {
@@ -468,7 +705,7 @@ func TestCheckMailHosts(t *testing.T) {
 		tr.addrs["127.0.0.1"] = []string{"mail.bar.com"}
 		tr.hosts["mail.bar.com"] = []string{"127.0.0.1"}
 
-		err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+		_, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
 
 		assert.NilError(t, err)
 		assert.Equal(t, ts.suppressedEmail, "")
@@ -478,7 +715,7 @@ func TestCheckMailHosts(t *testing.T) {
 		av, ts, tr, ctx := setup()
 		tr.setMxFailure("bar.com", errors.New("MX lookup failure"))
 
-		err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+		_, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
 
 		expected := "failed to retrieve MX records for bar.com: " +
 			"external error: failed to resolve bar.com: MX lookup failure"
@@ -496,8 +733,9 @@ func TestCheckMailHosts(t *testing.T) {
 		// Make sure external errors are passed through.
 		tr.setHostFailure("mail.bar.com", errors.New("host lookup failed"))
 
-		err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+		suppressed, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
 
+		assert.Assert(t, suppressed)
 		expected := "no valid MX hosts for bar.com: " +
 			"reverse lookup of addresses for mx1.mail.bar.com failed: " +
 			"no host resolves to 127.0.0.1: " +
@@ -507,6 +745,78 @@ func TestCheckMailHosts(t *testing.T) {
 		assert.Equal(t, ts.suppressedEmail, "foo@bar.com")
 	})
 
+	t.Run("DefersSuppressionUntilRepeatedFailures", func(t *testing.T) {
+		av, ts, tr, ctx := setup()
+		av.MxFailures = &MxFailurePolicy{Threshold: 2, Window: time.Hour}
+		tr.mailHosts["bar.com"] = []*net.MX{{Host: "mx1.mail.bar.com"}}
+		tr.setHostFailure("mx1.mail.bar.com", &net.DNSError{IsNotFound: true})
+
+		suppressed, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+
+		assert.Assert(t, !suppressed)
+		expected := "no valid MX hosts for bar.com: " +
+			"no records for mx1.mail.bar.com " +
+			"(not suppressed: failure 1 of 2)"
+		assert.Error(t, err, expected)
+		assert.Equal(t, ts.suppressedEmail, "")
+
+		suppressed, err = av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+
+		assert.Assert(t, suppressed)
+		expected = "no valid MX hosts for bar.com: " +
+			"no records for mx1.mail.bar.com"
+		assert.Error(t, err, expected)
+		assert.Equal(t, ts.suppressedEmail, "foo@bar.com")
+	})
+
+	t.Run("DoesNotSuppressIfRecordingFailureFails", func(t *testing.T) {
+		av, ts, tr, ctx := setup()
+		store := newTestMxFailureStore()
+		store.recordErr = errors.New("store unavailable")
+		av.MxFailures = &MxFailurePolicy{
+			Threshold: 2, Window: time.Hour, Store: store,
+		}
+		tr.mailHosts["bar.com"] = []*net.MX{{Host: "mx1.mail.bar.com"}}
+		tr.setHostFailure("mx1.mail.bar.com", &net.DNSError{IsNotFound: true})
+
+		suppressed, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+
+		assert.Assert(t, !suppressed)
+		assert.ErrorContains(t, err, "no valid MX hosts for bar.com: ")
+		assert.Assert(t, testutils.ErrorIs(err, store.recordErr))
+		assert.Equal(t, ts.suppressedEmail, "")
+	})
+
+	t.Run("DoesNotSuppressIfMxLookupTimesOut", func(t *testing.T) {
+		av, ts, tr, ctx := setup()
+		av.LookupTimeout = time.Millisecond
+		tr.blocked["bar.com"] = true
+
+		_, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrLookupTimeout))
+		assertExternalError(t, err)
+		assert.Equal(t, ts.suppressedEmail, "")
+	})
+
+	t.Run("DoesNotSuppressOrCountIfHostLookupTimesOut", func(t *testing.T) {
+		av, ts, tr, ctx := setup()
+		av.LookupTimeout = time.Millisecond
+		av.MxFailures = &MxFailurePolicy{Threshold: 2, Window: time.Hour}
+		tr.mailHosts["bar.com"] = []*net.MX{{Host: "mx1.mail.bar.com"}}
+		tr.blocked["mx1.mail.bar.com"] = true
+
+		_, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+
+		expected := "no valid MX hosts for bar.com: " +
+			"external error: DNS lookup timed out for mx1.mail.bar.com: "
+		assert.ErrorContains(t, err, expected)
+		assertExternalError(t, err)
+		assert.Equal(t, ts.suppressedEmail, "")
+		count, _, _ := av.MxFailures.RecordFailure(ctx, "foo@bar.com")
+		assert.Equal(t, 1, count)
+	})
+
 	t.Run("ReportsValidationAndSuppressionErrors", func(t *testing.T) {
 		av, ts, tr, ctx := setup()
 		tr.mailHosts["bar.com"] = []*net.MX{{Host: "mx1.mail.bar.com"}}
@@ -520,8 +830,9 @@ func TestCheckMailHosts(t *testing.T) {
 			"suppression failed", testutils.AwsServerError("server error"),
 		)
 
-		err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
+		suppressed, err := av.checkMailHosts(ctx, "foo@bar.com", "bar.com")
 
+		assert.Assert(t, !suppressed)
 		expected := []string{
 			"no valid MX hosts for bar.com: no records for mx1.mail.bar.com",
 			"suppression failed: external error: api error : server error",
@@ -548,6 +859,63 @@ func TestValidateAddress(t *testing.T) {
 		assert.Equal(t, "", f.ts.suppressedEmail)
 	})
 
+	t.Run("ReturnsExternalErrorIfLookupTimesOut", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.LookupTimeout = time.Millisecond
+		f.tr.mailHosts["acm.org"] = []*net.MX{{Host: "mail.mailroute.net"}}
+		f.tr.hosts["mail.mailroute.net"] = []string{"199.89.3.120"}
+		f.tr.blocked["199.89.3.120"] = true
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.Assert(t, is.Nil(failure))
+		assert.Assert(t, testutils.ErrorIs(err, ErrLookupTimeout))
+		assertExternalError(t, err)
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
+	t.Run("SucceedsForInternationalizedDomain", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		const domain = "xn--r8jz45g.jp"
+		f.tr.mailHosts[domain] = []*net.MX{{Host: "mail." + domain}}
+		f.tr.hosts["mail."+domain] = []string{"192.0.2.1"}
+		f.tr.addrs["192.0.2.1"] = []string{"mail." + domain}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@例え.jp")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "mbland@"+domain, f.ts.checkedEmail)
+	})
+
+	t.Run("FailsIfDomainCannotBeConvertedToAscii", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		const address = "mbland@例え_.jp"
+
+		failure, err := f.av.ValidateAddress(f.ctx, address)
+
+		assert.NilError(t, err)
+		expected := &ValidationFailure{
+			Address: address, Reason: "failed to parse",
+		}
+		assert.DeepEqual(t, expected, failure)
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
+	t.Run("FailsForNonAsciiUsername", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		const address = "用户@example.org"
+
+		failure, err := f.av.ValidateAddress(f.ctx, address)
+
+		assert.NilError(t, err)
+		expected := &ValidationFailure{
+			Address: address, Reason: "non-ASCII username",
+		}
+		assert.DeepEqual(t, expected, failure)
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
 	t.Run("SucceedsForProblematicYetValidDomain", func(t *testing.T) {
 		f := newAddressValidatorFixture()
 		const address = "probably-spam-but-cannot-tell-for-sure@hotmail.com"
@@ -583,6 +951,116 @@ func TestValidateAddress(t *testing.T) {
 		assert.Equal(t, "", f.ts.suppressedEmail)
 	})
 
+	t.Run("FailsIfRoleBasedAddress", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.RoleUsers = map[string]bool{"info": true, "support": true}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "info@acm.org")
+
+		assert.NilError(t, err)
+		expected := &ValidationFailure{
+			Address: "info@acm.org", Reason: FailureReasonRoleBased,
+		}
+		assert.DeepEqual(t, expected, failure)
+		assert.Equal(t, "", f.ts.checkedEmail)
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
+	t.Run("PassesPersonalAddressIfRoleUsersSet", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.RoleUsers = map[string]bool{"info": true, "support": true}
+		f.tr.mailHosts["acm.org"] = []*net.MX{{Host: "mail.mailroute.net"}}
+		f.tr.hosts["mail.mailroute.net"] = []string{"199.89.3.120"}
+		f.tr.addrs["199.89.3.120"] = []string{"mail.mia.mailroute.net"}
+		f.tr.hosts["mail.mia.mailroute.net"] = []string{"199.89.3.120"}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+	})
+
+	t.Run("FailsIfSingleLabelDomain", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@intranet")
+
+		assert.NilError(t, err)
+		const expectedReason = "mbland@intranet: single-label domain"
+		assert.Equal(t, expectedReason, failure.String())
+		assert.Equal(t, "", f.ts.checkedEmail)
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
+	t.Run("SucceedsIfSingleLabelDomainAllowed", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.AllowedSingleLabelDomains = []string{"Intranet"}
+		f.tr.mailHosts["intranet"] = []*net.MX{{Host: "mail.intranet"}}
+		f.tr.hosts["mail.intranet"] = []string{"192.168.0.1"}
+		f.tr.addrs["192.168.0.1"] = []string{"mail.intranet"}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@intranet")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "mbland@intranet", f.ts.checkedEmail)
+	})
+
+	t.Run("FailsIfIpLiteralDomain", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@[10.0.0.5]")
+
+		assert.NilError(t, err)
+		const expectedReason = "mbland@[10.0.0.5]: invalid"
+		assert.Equal(t, expectedReason, failure.String())
+		assert.Equal(t, "", f.ts.checkedEmail)
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
+	t.Run("SucceedsIfIpLiteralDomainAllowed", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.AllowedIpLiteralRanges = []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/24"),
+		}
+
+		// There are no MX records for the address, so it would fail if
+		// ValidateAddress checked its mail hosts.
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@[10.0.0.5]")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "mbland@[10.0.0.5]", f.ts.checkedEmail)
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
+	t.Run("SucceedsIfIpv6LiteralDomainAllowed", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.AllowedIpLiteralRanges = []netip.Prefix{
+			netip.MustParsePrefix("fd00::/8"),
+		}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@[IPv6:fd00::5]")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "mbland@[IPv6:fd00::5]", f.ts.checkedEmail)
+	})
+
+	t.Run("FailsIfIpLiteralDomainOutsideAllowedRanges", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.AllowedIpLiteralRanges = []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/24"),
+		}
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@[10.0.1.5]")
+
+		assert.NilError(t, err)
+		const expectedReason = "mbland@[10.0.1.5]: invalid"
+		assert.Equal(t, expectedReason, failure.String())
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
 	t.Run("FailsIfSuspiciousAddress", func(t *testing.T) {
 		f := newAddressValidatorFixture()
 
@@ -608,6 +1086,79 @@ func TestValidateAddress(t *testing.T) {
 		assert.Equal(t, "", f.ts.suppressedEmail)
 	})
 
+	t.Run("IncludesSuppressionReasonIfConfigured", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.SuppressionReasons = f.ts
+		f.ts.isSuppressedResult = true
+		f.ts.reason = "BOUNCE"
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		expected := &ValidationFailure{
+			Address:           "mbland@acm.org",
+			Reason:            FailureReasonSuppressed,
+			SuppressionReason: "BOUNCE",
+			Suppressed:        true,
+		}
+		assert.DeepEqual(t, expected, failure)
+		const expectedStr = "mbland@acm.org: suppressed (reason: BOUNCE)"
+		assert.Equal(t, expectedStr, failure.String())
+		assert.Equal(t, "mbland@acm.org", f.ts.reasonEmail)
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
+	t.Run("OmitsSuppressionReasonIfNotConfigured", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.ts.isSuppressedResult = true
+		f.ts.reason = "BOUNCE"
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", failure.SuppressionReason)
+		assert.Assert(t, failure.Suppressed)
+		assert.Equal(t, "mbland@acm.org: suppressed", failure.String())
+		assert.Equal(t, "", f.ts.reasonEmail)
+	})
+
+	t.Run("ReturnsErrorIfSuppressionReasonLookupFails", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.SuppressionReasons = f.ts
+		f.ts.reasonErr = errors.New("unexpected SES error")
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.Assert(t, is.Nil(failure))
+		assert.Error(t, err, "unexpected SES error")
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
+	t.Run("SkipsSuppressionCheckIfConfigured", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.SkipSuppressionCheck = true
+		f.av.SkipMailHostCheck = true
+		f.ts.isSuppressedResult = true
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "", f.ts.checkedEmail)
+	})
+
+	t.Run("SkipsMailHostCheckIfConfigured", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.SkipMailHostCheck = true
+		f.tr.setMxFailure("acm.org", errors.New("MX lookup failure"))
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Nil(failure))
+		assert.Equal(t, "mbland@acm.org", f.ts.checkedEmail)
+	})
+
 	t.Run("ReturnsErrorIfIsSuppressedFails", func(t *testing.T) {
 		f := newAddressValidatorFixture()
 		f.ts.isSuppressedErr = errors.New("unexpected SES error")
@@ -633,10 +1184,28 @@ func TestValidateAddress(t *testing.T) {
 		const expectedReason = "mbland@acm.org: failed DNS validation: " +
 			"no valid MX hosts for acm.org: no records for mail.mailroute.net"
 		assert.Equal(t, expectedReason, failure.String())
+		assert.Assert(t, failure.Suppressed)
 		assert.Equal(t, "mbland@acm.org", f.ts.checkedEmail)
 		assert.Equal(t, "mbland@acm.org", f.ts.suppressedEmail)
 	})
 
+	t.Run("ReportsDnsFailureNotSuppressedYet", func(t *testing.T) {
+		f := newAddressValidatorFixture()
+		f.av.MxFailures = &MxFailurePolicy{Threshold: 2, Window: time.Hour}
+		f.tr.mailHosts["acm.org"] = []*net.MX{{Host: "mail.mailroute.net"}}
+		f.tr.setHostFailure(
+			"mail.mailroute.net", &net.DNSError{IsNotFound: true},
+		)
+
+		failure, err := f.av.ValidateAddress(f.ctx, "mbland@acm.org")
+
+		assert.NilError(t, err)
+		assert.Assert(t, !failure.Suppressed)
+		const notSuppressed = "(not suppressed: failure 1 of 2)"
+		assert.Assert(t, is.Contains(failure.Reason, notSuppressed))
+		assert.Equal(t, "", f.ts.suppressedEmail)
+	})
+
 	t.Run("ReturnsExternalDnsValidationError", func(t *testing.T) {
 		f := newAddressValidatorFixture()
 		f.tr.mailHosts["acm.org"] = []*net.MX{{Host: "mail.mailroute.net"}}
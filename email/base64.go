@@ -0,0 +1,35 @@
+package email
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// base64LineLen is the maximum encoded line length per RFC 2045 §6.8.
+//
+// - https://www.rfc-editor.org/rfc/rfc2045#section-6.8
+const base64LineLen = 76
+
+// writeBase64 writes data to w as base64 encoded lines ending in CRLF.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+
+	for len(encoded) != 0 {
+		n := min(base64LineLen, len(encoded))
+		if _, err := w.Write(encoded[:n]); err != nil {
+			return err
+		} else if _, err = w.Write(crlf); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// base64EncodedLen returns the number of bytes writeBase64 emits for n bytes.
+func base64EncodedLen(n int) int {
+	encodedLen := base64.StdEncoding.EncodedLen(n)
+	numLines := (encodedLen + base64LineLen - 1) / base64LineLen
+	return encodedLen + numLines*len(crlf)
+}
@@ -0,0 +1,65 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+func TestWriteBase64(t *testing.T) {
+	setup := func() (*strings.Builder, *tu.ErrWriter) {
+		sb := &strings.Builder{}
+		return sb, &tu.ErrWriter{Buf: sb}
+	}
+
+	t.Run("WritesNothingForEmptyInput", func(t *testing.T) {
+		sb, _ := setup()
+
+		assert.NilError(t, writeBase64(sb, []byte{}))
+		assert.Equal(t, "", sb.String())
+		assert.Equal(t, 0, base64EncodedLen(0))
+	})
+
+	t.Run("WrapsLinesAtMaximumLength", func(t *testing.T) {
+		sb, _ := setup()
+		data := []byte(strings.Repeat("日本語のテキスト。", 10))
+
+		err := writeBase64(sb, data)
+
+		assert.NilError(t, err)
+		lines := strings.Split(sb.String(), "\r\n")
+		assert.Equal(t, "", lines[len(lines)-1], "should end with CRLF")
+		for _, line := range lines[:len(lines)-2] {
+			assert.Equal(t, base64LineLen, len(line))
+		}
+		assert.Equal(t, base64EncodedLen(len(data)), sb.Len())
+
+		decoded, err := base64.StdEncoding.DecodeString(
+			strings.ReplaceAll(sb.String(), "\r\n", ""),
+		)
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), string(decoded))
+	})
+
+	t.Run("ReturnsWriteError", func(t *testing.T) {
+		_, ew := setup()
+		ew.ErrorOn = base64.StdEncoding.EncodeToString([]byte("foobar"))
+		ew.Err = errors.New("Write error")
+
+		assert.Error(t, writeBase64(ew, []byte("foobar")), "Write error")
+	})
+
+	t.Run("ReturnsLineBreakWriteError", func(t *testing.T) {
+		_, ew := setup()
+		ew.ErrorOn = "\r\n"
+		ew.Err = errors.New("Write error")
+
+		assert.Error(t, writeBase64(ew, []byte("foobar")), "Write error")
+	})
+}
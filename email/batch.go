@@ -0,0 +1,80 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ValidationResult contains the outcome of validating a single address.
+//
+// Failure and Error have the same meaning as the return values from
+// [AddressValidator.ValidateAddress].
+type ValidationResult struct {
+	Address string
+	Failure *ValidationFailure
+	Error   error
+}
+
+// BatchValidator validates multiple addresses in parallel.
+//
+// DNS lookup latency dominates the time required to validate each address, so
+// validating addresses in parallel can dramatically speed up processing of
+// large address lists.
+type BatchValidator struct {
+	Validator AddressValidator
+
+	// Timeout limits the time spent validating each individual address.
+	//
+	// If zero, only the context passed to ValidateBatch limits validation time.
+	Timeout time.Duration
+}
+
+// ValidateBatch validates addresses using at most concurrency workers.
+//
+// The returned slice contains one result per address in the same order as the
+// addresses argument. If concurrency is less than one, a single worker will
+// validate every address.
+//
+// Errors, including per-address timeouts, appear in the corresponding
+// ValidationResult. They do not stop the validation of other addresses.
+func (bv *BatchValidator) ValidateBatch(
+	ctx context.Context, addresses []string, concurrency int,
+) []ValidationResult {
+	results := make([]ValidationResult, len(addresses))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for range min(concurrency, len(addresses)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = bv.validate(ctx, addresses[i])
+			}
+		}()
+	}
+
+	for i := range addresses {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func (bv *BatchValidator) validate(
+	ctx context.Context, address string,
+) ValidationResult {
+	if bv.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bv.Timeout)
+		defer cancel()
+	}
+
+	failure, err := bv.Validator.ValidateAddress(ctx, address)
+	return ValidationResult{address, failure, err}
+}
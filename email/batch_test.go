@@ -0,0 +1,145 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type batchTestValidator struct {
+	lock          sync.Mutex
+	active        int
+	maxActive     int
+	release       chan struct{}
+	slowAddresses map[string]bool
+}
+
+func newBatchTestValidator() *batchTestValidator {
+	return &batchTestValidator{slowAddresses: map[string]bool{}}
+}
+
+func (v *batchTestValidator) ValidateAddress(
+	ctx context.Context, address string,
+) (*ValidationFailure, error) {
+	v.lock.Lock()
+	v.active++
+	v.maxActive = max(v.maxActive, v.active)
+	v.lock.Unlock()
+
+	defer func() {
+		v.lock.Lock()
+		defer v.lock.Unlock()
+		v.active--
+	}()
+
+	if v.slowAddresses[address] {
+		<-ctx.Done()
+		return nil, fmt.Errorf("timed out: %w", ctx.Err())
+	} else if v.release != nil {
+		<-v.release
+	}
+
+	if address == "bad" {
+		return &ValidationFailure{Address: address, Reason: "invalid"}, nil
+	}
+	return nil, nil
+}
+
+func (v *batchTestValidator) activeCount() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.active
+}
+
+func TestValidateBatch(t *testing.T) {
+	addresses := func(n int) []string {
+		result := make([]string, n)
+		for i := range result {
+			result[i] = fmt.Sprintf("foo%d@bar.com", i)
+		}
+		return result
+	}
+
+	t.Run("ReturnsEmptyResultsForEmptyInput", func(t *testing.T) {
+		bv := &BatchValidator{Validator: newBatchTestValidator()}
+
+		results := bv.ValidateBatch(context.Background(), []string{}, 3)
+
+		assert.Assert(t, is.Len(results, 0))
+	})
+
+	t.Run("PreservesInputOrder", func(t *testing.T) {
+		bv := &BatchValidator{Validator: newBatchTestValidator()}
+		addrs := append(addresses(10), "bad")
+
+		results := bv.ValidateBatch(context.Background(), addrs, 4)
+
+		assert.Assert(t, is.Len(results, len(addrs)))
+		for i, addr := range addrs[:10] {
+			assert.DeepEqual(t, ValidationResult{Address: addr}, results[i])
+		}
+		expectedFailure := &ValidationFailure{
+			Address: "bad", Reason: "invalid",
+		}
+		assert.DeepEqual(t, expectedFailure, results[10].Failure)
+	})
+
+	t.Run("BoundsConcurrency", func(t *testing.T) {
+		v := newBatchTestValidator()
+		v.release = make(chan struct{})
+		bv := &BatchValidator{Validator: v}
+		addrs := addresses(12)
+		done := make(chan []ValidationResult)
+
+		go func() {
+			done <- bv.ValidateBatch(context.Background(), addrs, 3)
+		}()
+		for v.activeCount() != 3 {
+			time.Sleep(time.Millisecond)
+		}
+		for range addrs {
+			v.release <- struct{}{}
+		}
+		results := <-done
+
+		assert.Assert(t, is.Len(results, len(addrs)))
+		assert.Equal(t, 3, v.maxActive)
+	})
+
+	t.Run("UsesOneWorkerIfConcurrencyLessThanOne", func(t *testing.T) {
+		v := newBatchTestValidator()
+		bv := &BatchValidator{Validator: v}
+
+		results := bv.ValidateBatch(context.Background(), addresses(5), 0)
+
+		assert.Assert(t, is.Len(results, 5))
+		assert.Equal(t, 1, v.maxActive)
+	})
+
+	t.Run("TimeoutDoesNotFailBatch", func(t *testing.T) {
+		v := newBatchTestValidator()
+		addrs := addresses(5)
+		v.slowAddresses[addrs[2]] = true
+		bv := &BatchValidator{Validator: v, Timeout: 10 * time.Millisecond}
+
+		results := bv.ValidateBatch(context.Background(), addrs, 2)
+
+		assert.Assert(t, is.Len(results, len(addrs)))
+		for i, result := range results {
+			assert.Equal(t, addrs[i], result.Address)
+			if i != 2 {
+				assert.NilError(t, result.Error)
+			}
+		}
+		err := results[2].Error
+		assert.Assert(t, errors.Is(err, context.DeadlineExceeded), "%s", err)
+	})
+}
@@ -2,11 +2,15 @@ package email
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	sestypes "github.com/aws/aws-sdk-go-v2/service/ses/types"
+	"github.com/google/uuid"
 	"github.com/mbland/elistman/ops"
 )
 
@@ -22,6 +26,15 @@ type Bouncer interface {
 
 type SesBouncer struct {
 	Client SesApi
+
+	// DryRun causes Bounce to log each bounce instead of sending it.
+	//
+	// This enables testing DMARC bounce handling in a staging environment
+	// without emitting real delivery status notifications.
+	DryRun bool
+
+	// Log records dry run bounces. Defaults to log.Default() if nil.
+	Log *log.Logger
 }
 
 // https://docs.aws.amazon.com/ses/latest/dg/receiving-email-action-lambda-example-functions.html
@@ -43,8 +56,9 @@ func (mailer *SesBouncer) Bounce(
 		BounceSender:      aws.String("mailer-daemon@" + emailDomain),
 		OriginalMessageId: aws.String(messageId),
 		MessageDsn: &sestypes.MessageDsn{
-			ReportingMta: aws.String("dns; " + emailDomain),
-			ArrivalDate:  aws.Time(timestamp.Truncate(time.Second)),
+			ReportingMta:    aws.String("dns; " + emailDomain),
+			ArrivalDate:     aws.Time(timestamp.Truncate(time.Second)),
+			ExtensionFields: autoResponseSuppressionFields(),
 		},
 		Explanation: aws.String(
 			"Unauthenticated email is not accepted due to " +
@@ -54,10 +68,60 @@ func (mailer *SesBouncer) Bounce(
 	}
 	var output *ses.SendBounceOutput
 
-	if output, err = mailer.Client.SendBounce(ctx, input); err != nil {
+	if mailer.DryRun {
+		bounceMessageId = mailer.logDryRun(input, recipients)
+	} else if output, err = mailer.Client.SendBounce(ctx, input); err != nil {
 		err = ops.AwsError("sending bounce failed", err)
 	} else {
 		bounceMessageId = aws.ToString(output.MessageId)
 	}
 	return
 }
+
+// autoResponseSuppressionFields mark bounces as automatically generated, so
+// they don't trigger further automatic responses.
+//
+// SendBounce doesn't accept arbitrary message headers, so these appear as
+// per-message DSN fields instead. "Auto-Submitted: auto-replied" is the
+// RFC 3834 marker telling responders not to reply. Microsoft Exchange and
+// Outlook honor "X-Auto-Response-Suppress: All" for the same purpose.
+//
+// - https://www.rfc-editor.org/rfc/rfc3834#section-5
+func autoResponseSuppressionFields() []sestypes.ExtensionField {
+	return []sestypes.ExtensionField{
+		{
+			Name:  aws.String("Auto-Submitted"),
+			Value: aws.String("auto-replied"),
+		},
+		{
+			Name:  aws.String("X-Auto-Response-Suppress"),
+			Value: aws.String("All"),
+		},
+	}
+}
+
+func (mailer *SesBouncer) logDryRun(
+	input *ses.SendBounceInput, recipients []string,
+) (bounceMessageId string) {
+	bounceMessageId = dryRunMessageId(time.Now())
+	logger := mailer.Log
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(
+		"dry run: not sending bounce %s from %s for message %s to: %s",
+		bounceMessageId,
+		aws.ToString(input.BounceSender),
+		aws.ToString(input.OriginalMessageId),
+		strings.Join(recipients, ", "),
+	)
+	return
+}
+
+// dryRunMessageId returns an ID resembling those generated by SES.
+//
+// SES message IDs contain a hex timestamp, a UUID, and a numeric suffix, e.g.:
+// 0100018ab1f2c3d4-0f9e8d7c-6b5a-4938-2716-05f4e3d2c1b0-000000
+func dryRunMessageId(now time.Time) string {
+	return fmt.Sprintf("%016x-%s-000000", now.UnixMilli(), uuid.New())
+}
@@ -4,6 +4,10 @@ package email
 
 import (
 	"context"
+	"log"
+	"os"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 func TestBounce(t *testing.T) {
@@ -52,6 +57,66 @@ func TestBounce(t *testing.T) {
 		)
 	})
 
+	t.Run("MarksBounceAsAutoSubmitted", func(t *testing.T) {
+		testSes, bounce, ctx := setup()
+
+		_, err := bounce.Bounce(
+			ctx, emailDomain, messageId, recipients, timestamp,
+		)
+
+		assert.NilError(t, err)
+		fields := map[string]string{}
+		for _, f := range testSes.bounceInput.MessageDsn.ExtensionFields {
+			fields[aws.ToString(f.Name)] = aws.ToString(f.Value)
+		}
+		assert.DeepEqual(t, map[string]string{
+			"Auto-Submitted":           "auto-replied",
+			"X-Auto-Response-Suppress": "All",
+		}, fields)
+	})
+
+	t.Run("DryRunLogsBounceWithoutSending", func(t *testing.T) {
+		testSes, bouncer, ctx := setup()
+		testSes.bounceInput = nil
+		testSes.bounceErr = testutils.AwsServerError("should not be called")
+		logs, logger := testutils.NewLogs()
+		bouncer.DryRun = true
+		bouncer.Log = logger
+
+		bouncedId, err := bouncer.Bounce(
+			ctx, emailDomain, messageId, recipients, timestamp,
+		)
+
+		assert.NilError(t, err)
+		assert.Assert(t, testSes.bounceInput == nil, "SendBounce called")
+		sesIdPattern := regexp.MustCompile(
+			`^[0-9a-f]{16}-[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}-000000$`,
+		)
+		assert.Assert(t, sesIdPattern.MatchString(bouncedId), bouncedId)
+		logs.AssertContains(
+			t,
+			"dry run: not sending bounce "+bouncedId+
+				" from mailer-daemon@foo.com for message deadbeef "+
+				"to: plugh@foo.com",
+		)
+	})
+
+	t.Run("DryRunUsesDefaultLoggerIfLogNil", func(t *testing.T) {
+		_, bouncer, ctx := setup()
+		bouncer.DryRun = true
+		buf := &strings.Builder{}
+		log.SetOutput(buf)
+		defer log.SetOutput(os.Stderr)
+
+		bouncedId, err := bouncer.Bounce(
+			ctx, emailDomain, messageId, recipients, timestamp,
+		)
+
+		assert.NilError(t, err)
+		expected := "dry run: not sending bounce " + bouncedId
+		assert.Assert(t, is.Contains(buf.String(), expected))
+	})
+
 	t.Run("ReturnsErrorIfSendBounceFails", func(t *testing.T) {
 		testSes, bouncer, ctx := setup()
 		testSes.bounceErr = testutils.AwsServerError("SendBounce error")
@@ -0,0 +1,111 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CachingAddressValidator is an AddressValidator that caches the results of
+// another AddressValidator.
+//
+// Results are cached per address, so repeat validations of the same address
+// within a burst of requests don't repeat the wrapped validator's DNS lookups
+// and suppression list checks. Successes and failures have separate time to
+// live values, since a failing address may be fixed sooner than a passing
+// address starts failing, or vice versa. A TTL of zero or less disables
+// caching for that kind of result.
+//
+// Results accompanied by an error aren't cached, so external failures are
+// always retried.
+type CachingAddressValidator struct {
+	Validator  AddressValidator
+	SuccessTtl time.Duration
+	FailureTtl time.Duration
+
+	// Now returns the current time. Defaults to time.Now if nil.
+	Now func() time.Time
+
+	mutex   sync.Mutex
+	results map[string]cachedValidation
+}
+
+type cachedValidation struct {
+	failure *ValidationFailure
+	expires time.Time
+}
+
+func (cv *CachingAddressValidator) ValidateAddress(
+	ctx context.Context, address string,
+) (failure *ValidationFailure, err error) {
+	if failure, ok := cv.cached(address); ok {
+		return failure, nil
+	}
+	if failure, err = cv.Validator.ValidateAddress(ctx, address); err == nil {
+		cv.store(address, failure)
+	}
+	return
+}
+
+// cached returns a copy of the cached failure, if any, so callers can't modify
+// the cached value.
+func (cv *CachingAddressValidator) cached(
+	address string,
+) (failure *ValidationFailure, ok bool) {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	result, ok := cv.results[address]
+	if !ok {
+		return
+	} else if !cv.now().Before(result.expires) {
+		delete(cv.results, address)
+		return nil, false
+	} else if result.failure != nil {
+		failureCopy := *result.failure
+		failure = &failureCopy
+	}
+	return
+}
+
+func (cv *CachingAddressValidator) store(
+	address string, failure *ValidationFailure,
+) {
+	ttl := cv.SuccessTtl
+	if failure != nil {
+		ttl = cv.FailureTtl
+	}
+	if ttl <= 0 {
+		return
+	}
+	now := cv.now()
+
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	if cv.results == nil {
+		cv.results = map[string]cachedValidation{}
+	}
+	cv.forgetExpiredResults(now)
+
+	if failure != nil {
+		failureCopy := *failure
+		failure = &failureCopy
+	}
+	cv.results[address] = cachedValidation{failure, now.Add(ttl)}
+}
+
+func (cv *CachingAddressValidator) now() time.Time {
+	if cv.Now == nil {
+		return time.Now()
+	}
+	return cv.Now()
+}
+
+func (cv *CachingAddressValidator) forgetExpiredResults(now time.Time) {
+	for address, result := range cv.results {
+		if !now.Before(result.expires) {
+			delete(cv.results, address)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type countingValidator struct {
+	calls   int
+	failure *ValidationFailure
+	err     error
+}
+
+func (v *countingValidator) ValidateAddress(
+	_ context.Context, address string,
+) (*ValidationFailure, error) {
+	v.calls++
+	if v.failure != nil {
+		failure := &ValidationFailure{
+			Address: address, Reason: v.failure.Reason,
+		}
+		return failure, v.err
+	}
+	return nil, v.err
+}
+
+func TestCachingAddressValidator(t *testing.T) {
+	const address = "foo@bar.com"
+
+	setup := func() (
+		*CachingAddressValidator, *countingValidator, *time.Time,
+	) {
+		now := time.Date(1970, time.September, 18, 12, 0, 0, 0, time.UTC)
+		wrapped := &countingValidator{}
+		cv := &CachingAddressValidator{
+			Validator:  wrapped,
+			SuccessTtl: time.Hour,
+			FailureTtl: time.Minute,
+			Now:        func() time.Time { return now },
+		}
+		return cv, wrapped, &now
+	}
+
+	validate := func(
+		t *testing.T, cv *CachingAddressValidator,
+	) *ValidationFailure {
+		t.Helper()
+		failure, err := cv.ValidateAddress(context.Background(), address)
+		assert.NilError(t, err)
+		return failure
+	}
+
+	t.Run("CachesSuccess", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+
+		assert.Assert(t, is.Nil(validate(t, cv)))
+		assert.Assert(t, is.Nil(validate(t, cv)))
+
+		assert.Equal(t, 1, wrapped.calls)
+	})
+
+	t.Run("CachesFailure", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+		wrapped.failure = &ValidationFailure{Reason: "invalid"}
+		expected := &ValidationFailure{Address: address, Reason: "invalid"}
+
+		assert.DeepEqual(t, expected, validate(t, cv))
+		assert.DeepEqual(t, expected, validate(t, cv))
+
+		assert.Equal(t, 1, wrapped.calls)
+	})
+
+	t.Run("ReturnsCopyOfCachedFailure", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+		wrapped.failure = &ValidationFailure{Reason: "invalid"}
+
+		validate(t, cv).Reason = "modified"
+
+		assert.Equal(t, "invalid", validate(t, cv).Reason)
+	})
+
+	t.Run("SuccessExpiresAfterTtl", func(t *testing.T) {
+		cv, wrapped, now := setup()
+
+		validate(t, cv)
+		*now = now.Add(time.Hour - time.Second)
+		validate(t, cv)
+		assert.Equal(t, 1, wrapped.calls)
+
+		*now = now.Add(time.Second)
+		validate(t, cv)
+		assert.Equal(t, 2, wrapped.calls)
+	})
+
+	t.Run("FailureExpiresAfterSeparateTtl", func(t *testing.T) {
+		cv, wrapped, now := setup()
+		wrapped.failure = &ValidationFailure{Reason: "invalid"}
+
+		validate(t, cv)
+		*now = now.Add(time.Minute)
+		wrapped.failure = nil
+
+		assert.Assert(t, is.Nil(validate(t, cv)))
+		assert.Equal(t, 2, wrapped.calls)
+	})
+
+	t.Run("DoesNotCacheIfTtlIsZero", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+		cv.SuccessTtl = 0
+
+		validate(t, cv)
+		validate(t, cv)
+
+		assert.Equal(t, 2, wrapped.calls)
+	})
+
+	t.Run("CachesEachAddressSeparately", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+		ctx := context.Background()
+
+		validate(t, cv)
+		_, err := cv.ValidateAddress(ctx, "quux@bar.com")
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2, wrapped.calls)
+	})
+
+	t.Run("DoesNotCacheErrors", func(t *testing.T) {
+		cv, wrapped, _ := setup()
+		wrapped.err = errors.New("external error")
+		ctx := context.Background()
+
+		_, err := cv.ValidateAddress(ctx, address)
+		assert.ErrorContains(t, err, "external error")
+		wrapped.err = nil
+
+		assert.Assert(t, is.Nil(validate(t, cv)))
+		assert.Equal(t, 2, wrapped.calls)
+	})
+}
@@ -0,0 +1,247 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DkimSigner wraps the Sign method.
+//
+// Sign computes a DKIM signature over a raw message's header block and body,
+// and returns a complete "DKIM-Signature:" header field, including the
+// trailing CRLF, for prepending to the message. headers contains every header
+// field of the message, each terminated by CRLF; body excludes the empty line
+// separating it from the headers.
+//
+// - https://www.rfc-editor.org/rfc/rfc6376
+type DkimSigner interface {
+	Sign(headers, body []byte) (signatureHeader string, err error)
+}
+
+// DefaultDkimSignedHeaders lists the header fields that RsaDkimSigner signs if
+// its SignedHeaders field is empty. Only fields present in the message are
+// signed.
+var DefaultDkimSignedHeaders = []string{
+	"From",
+	"To",
+	"Subject",
+	"Date",
+	"Message-ID",
+	"MIME-Version",
+	"Content-Type",
+	"List-Unsubscribe",
+	"List-Unsubscribe-Post",
+}
+
+// RsaDkimSigner is a DkimSigner producing rsa-sha256 signatures using relaxed
+// header and body canonicalization.
+//
+// Domain and Selector identify the DNS TXT record publishing the public key,
+// i.e., "<Selector>._domainkey.<Domain>".
+type RsaDkimSigner struct {
+	Domain        string
+	Selector      string
+	Key           *rsa.PrivateKey
+	SignedHeaders []string
+}
+
+// NewRsaDkimSigner creates an RsaDkimSigner from a PEM encoded RSA private key.
+//
+// The key may be in either PKCS #1 ("RSA PRIVATE KEY") or PKCS #8 ("PRIVATE
+// KEY") form. It may also be only the base64 encoded body of the PEM block,
+// without the BEGIN and END lines or any line breaks, which is easier to store
+// in an environment variable.
+func NewRsaDkimSigner(
+	domain, selector string, pemKey []byte,
+) (*RsaDkimSigner, error) {
+	key, err := parseRsaPrivateKey(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DKIM private key: %w", err)
+	}
+	return &RsaDkimSigner{Domain: domain, Selector: selector, Key: key}, nil
+}
+
+func parseRsaPrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+
+	if block == nil {
+		return parseBareRsaPrivateKey(pemKey)
+	} else if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return parsePkcs8RsaPrivateKey(block.Bytes)
+}
+
+// parseBareRsaPrivateKey parses a base64 encoded key without PEM armor.
+func parseBareRsaPrivateKey(encoded []byte) (*rsa.PrivateKey, error) {
+	der, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(encoded)),
+	)
+	if err != nil || len(der) == 0 {
+		return nil, errors.New("no PEM or base64 data found")
+	} else if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return parsePkcs8RsaPrivateKey(der)
+}
+
+func parsePkcs8RsaPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	} else if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("expected RSA key, got %T", key)
+}
+
+func (s *RsaDkimSigner) Sign(headers, body []byte) (string, error) {
+	bodyHash := sha256.Sum256(relaxedDkimBody(body))
+	fields := splitHeaderFields(headers)
+	names, signed := s.selectSignedHeaders(fields)
+
+	// Each tag appears on its own line to keep the header field readable.
+	// Relaxed canonicalization unfolds these lines before hashing.
+	sigHeader := "DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+		" d=" + s.Domain + "; s=" + s.Selector + ";\r\n" +
+		" h=" + strings.Join(names, ":") + ";\r\n" +
+		" bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+		" b="
+
+	h := sha256.New()
+	for _, field := range signed {
+		h.Write(relaxedDkimHeader(field))
+	}
+	// Per RFC 6376 section 3.7, the signature header itself is hashed with an
+	// empty "b=" tag value and without a trailing CRLF.
+	h.Write(bytes.TrimSuffix(relaxedDkimHeader([]byte(sigHeader)), crlf))
+
+	sig, err := rsa.SignPKCS1v15(nil, s.Key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to compute DKIM signature: %w", err)
+	}
+	return sigHeader + base64.StdEncoding.EncodeToString(sig) + "\r\n", nil
+}
+
+// selectSignedHeaders returns the names and fields to sign, in signing order.
+//
+// If a field appears more than once, the last instance is signed, per RFC 6376
+// section 5.4.2. Fields absent from the message are omitted.
+func (s *RsaDkimSigner) selectSignedHeaders(
+	fields [][]byte,
+) (names []string, signed [][]byte) {
+	toSign := s.SignedHeaders
+	if len(toSign) == 0 {
+		toSign = DefaultDkimSignedHeaders
+	}
+
+	for _, name := range toSign {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(headerFieldName(fields[i]), name) {
+				names = append(names, name)
+				signed = append(signed, fields[i])
+				break
+			}
+		}
+	}
+	return
+}
+
+// splitHeaderFields splits a header block into fields, keeping continuation
+// lines with the field they continue.
+func splitHeaderFields(headers []byte) (fields [][]byte) {
+	for len(headers) != 0 {
+		end := 0
+		for {
+			i := bytes.Index(headers[end:], crlf)
+			if i == -1 {
+				end = len(headers)
+				break
+			}
+			end += i + len(crlf)
+			if end == len(headers) || !isWsp(headers[end]) {
+				break
+			}
+		}
+		fields = append(fields, headers[:end])
+		headers = headers[end:]
+	}
+	return
+}
+
+func headerFieldName(field []byte) string {
+	name, _, _ := bytes.Cut(field, []byte(":"))
+	return string(bytes.TrimRight(name, " \t"))
+}
+
+func isWsp(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// relaxedDkimHeader implements the "relaxed" header canonicalization algorithm.
+//
+// - https://www.rfc-editor.org/rfc/rfc6376#section-3.4.2
+func relaxedDkimHeader(field []byte) []byte {
+	name, value, _ := bytes.Cut(field, []byte(":"))
+	name = bytes.ToLower(bytes.TrimRight(name, " \t"))
+	value = bytes.ReplaceAll(value, crlf, nil)
+	value = collapseWsp(value)
+	value = bytes.Trim(value, " ")
+
+	result := make([]byte, 0, len(name)+len(value)+3)
+	result = append(result, name...)
+	result = append(result, ':')
+	result = append(result, value...)
+	return append(result, crlf...)
+}
+
+// relaxedDkimBody implements the "relaxed" body canonicalization algorithm.
+//
+// - https://www.rfc-editor.org/rfc/rfc6376#section-3.4.4
+func relaxedDkimBody(body []byte) []byte {
+	lines := bytes.Split(body, crlf)
+	result := make([]byte, 0, len(body))
+
+	for i, line := range lines {
+		line = bytes.TrimRight(collapseWsp(line), " ")
+
+		// bytes.Split produces an empty final element if body ends with CRLF.
+		if i != len(lines)-1 || len(line) != 0 {
+			result = append(append(result, line...), crlf...)
+		}
+	}
+
+	for bytes.HasSuffix(result, []byte("\r\n\r\n")) {
+		result = result[:len(result)-len(crlf)]
+	}
+	if bytes.Equal(result, crlf) {
+		return nil
+	}
+	return result
+}
+
+func collapseWsp(s []byte) []byte {
+	result := make([]byte, 0, len(s))
+	inWsp := false
+
+	for _, c := range s {
+		if isWsp(c) {
+			if !inWsp {
+				result = append(result, ' ')
+			}
+			inWsp = true
+			continue
+		}
+		inWsp = false
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,273 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// parseDkimTags parses the tag=value list from a DKIM-Signature header.
+func parseDkimTags(t *testing.T, sigHeader string) map[string]string {
+	t.Helper()
+
+	name, value, found := strings.Cut(sigHeader, ":")
+	assert.Assert(t, found)
+	assert.Equal(t, "DKIM-Signature", name)
+	value = strings.ReplaceAll(value, "\r\n", "")
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(tag), "=")
+		tags[k] = v
+	}
+	return tags
+}
+
+func TestRelaxedDkimCanonicalization(t *testing.T) {
+	// These are the examples from RFC 6376, section 3.4.5.
+	t.Run("Header", func(t *testing.T) {
+		assert.Equal(
+			t, "a:X\r\n", string(relaxedDkimHeader([]byte("A: X\r\n"))),
+		)
+		assert.Equal(
+			t,
+			"b:Y Z\r\n",
+			string(relaxedDkimHeader([]byte("B : Y\t\r\n\tZ  \r\n"))),
+		)
+	})
+
+	t.Run("Body", func(t *testing.T) {
+		body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+
+		assert.Equal(t, " C\r\nD E\r\n", string(relaxedDkimBody(body)))
+	})
+
+	t.Run("EmptyBody", func(t *testing.T) {
+		assert.Equal(t, "", string(relaxedDkimBody([]byte{})))
+		assert.Equal(t, "", string(relaxedDkimBody([]byte("\r\n \r\n"))))
+	})
+
+	t.Run("AddsFinalCrlfIfMissing", func(t *testing.T) {
+		assert.Equal(t, "foo\r\n", string(relaxedDkimBody([]byte("foo"))))
+	})
+}
+
+func TestSplitHeaderFields(t *testing.T) {
+	headers := []byte("From: foo@bar.com\r\n" +
+		"Subject: folded\r\n subject\r\n" +
+		"To: baz@quux.com\r\n")
+
+	fields := splitHeaderFields(headers)
+
+	assert.Assert(t, is.Len(fields, 3))
+	assert.Equal(t, "Subject: folded\r\n subject\r\n", string(fields[1]))
+	assert.Equal(t, "To", headerFieldName(fields[2]))
+}
+
+func TestNewRsaDkimSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	t.Run("ParsesPkcs1Key", func(t *testing.T) {
+		pemKey := pem.EncodeToMemory(&pem.Block{
+			Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+
+		signer, err := NewRsaDkimSigner("foo.com", "sel", pemKey)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "foo.com", signer.Domain)
+		assert.Equal(t, "sel", signer.Selector)
+		assert.Assert(t, key.Equal(signer.Key))
+	})
+
+	t.Run("ParsesPkcs8Key", func(t *testing.T) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NilError(t, err)
+		pemKey := pem.EncodeToMemory(
+			&pem.Block{Type: "PRIVATE KEY", Bytes: der},
+		)
+
+		signer, err := NewRsaDkimSigner("foo.com", "sel", pemKey)
+
+		assert.NilError(t, err)
+		assert.Assert(t, key.Equal(signer.Key))
+	})
+
+	t.Run("ParsesBareBase64Key", func(t *testing.T) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NilError(t, err)
+		encoded := base64.StdEncoding.EncodeToString(der)
+
+		signer, err := NewRsaDkimSigner("foo.com", "sel", []byte(encoded))
+
+		assert.NilError(t, err)
+		assert.Assert(t, key.Equal(signer.Key))
+	})
+
+	t.Run("ParsesBareBase64Pkcs1Key", func(t *testing.T) {
+		der := x509.MarshalPKCS1PrivateKey(key)
+		encoded := base64.StdEncoding.EncodeToString(der)
+
+		signer, err := NewRsaDkimSigner("foo.com", "sel", []byte(encoded))
+
+		assert.NilError(t, err)
+		assert.Assert(t, key.Equal(signer.Key))
+	})
+
+	t.Run("FailsIfNotPemOrBase64", func(t *testing.T) {
+		signer, err := NewRsaDkimSigner("foo.com", "sel", []byte("bogus!"))
+
+		assert.Assert(t, is.Nil(signer))
+		const expected = "failed to parse DKIM private key: " +
+			"no PEM or base64 data found"
+		assert.Error(t, err, expected)
+	})
+}
+
+func TestRsaDkimSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NilError(t, err)
+
+	setup := func() *RsaDkimSigner {
+		return &RsaDkimSigner{Domain: "foo.com", Selector: "sel", Key: key}
+	}
+
+	headers := []byte("From: EListMan@foo.com\r\n" +
+		"To: subscriber@foo.com\r\n" +
+		"Subject: This is\r\n a test\r\n" +
+		"X-Unsigned: not signed\r\n" +
+		"MIME-Version: 1.0\r\n")
+	body := []byte("Hello,  world! \r\n\r\n")
+
+	t.Run("ProducesValidSignature", func(t *testing.T) {
+		signer := setup()
+
+		sigHeader, err := signer.Sign(headers, body)
+
+		assert.NilError(t, err)
+		assert.Assert(t, strings.HasSuffix(sigHeader, "\r\n"))
+		tags := parseDkimTags(t, strings.TrimSuffix(sigHeader, "\r\n"))
+		assert.Equal(t, "1", tags["v"])
+		assert.Equal(t, "rsa-sha256", tags["a"])
+		assert.Equal(t, "relaxed/relaxed", tags["c"])
+		assert.Equal(t, "foo.com", tags["d"])
+		assert.Equal(t, "sel", tags["s"])
+		assert.Equal(t, "From:To:Subject:MIME-Version", tags["h"])
+
+		bodyHash := sha256.Sum256([]byte("Hello, world!\r\n"))
+		expectedBh := base64.StdEncoding.EncodeToString(bodyHash[:])
+		assert.Equal(t, expectedBh, tags["bh"])
+
+		sig, err := base64.StdEncoding.DecodeString(tags["b"])
+		assert.NilError(t, err)
+		unsigned, _, _ := strings.Cut(sigHeader, tags["b"])
+		h := sha256.New()
+		h.Write([]byte("from:EListMan@foo.com\r\n" +
+			"to:subscriber@foo.com\r\n" +
+			"subject:This is a test\r\n" +
+			"mime-version:1.0\r\n"))
+		h.Write([]byte(strings.TrimSuffix(
+			string(relaxedDkimHeader([]byte(unsigned))), "\r\n",
+		)))
+		digest := h.Sum(nil)
+		err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest, sig)
+		assert.NilError(t, err)
+	})
+
+	t.Run("SignsLastInstanceOfRepeatedHeader", func(t *testing.T) {
+		signer := setup()
+		signer.SignedHeaders = []string{"X-Repeated"}
+		fields := splitHeaderFields([]byte(
+			"X-Repeated: first\r\nX-Repeated: second\r\n",
+		))
+
+		names, signed := signer.selectSignedHeaders(fields)
+
+		assert.DeepEqual(t, []string{"X-Repeated"}, names)
+		assert.Equal(t, "X-Repeated: second\r\n", string(signed[0]))
+	})
+
+	t.Run("ProducesDifferentSignatureIfBodyChanges", func(t *testing.T) {
+		signer := setup()
+
+		original, err := signer.Sign(headers, body)
+		assert.NilError(t, err)
+		changed, err := signer.Sign(headers, []byte("Goodbye, world!\r\n"))
+		assert.NilError(t, err)
+
+		assert.Assert(t, parseDkimTags(t, original)["bh"] !=
+			parseDkimTags(t, changed)["bh"])
+	})
+}
+
+type testDkimSigner struct {
+	headers []byte
+	body    []byte
+	err     error
+}
+
+func (s *testDkimSigner) Sign(headers, body []byte) (string, error) {
+	s.headers = headers
+	s.body = body
+	return "DKIM-Signature: test\r\n", s.err
+}
+
+func TestSesMailerSign(t *testing.T) {
+	msg := []byte("From: foo@bar.com\r\nTo: baz@quux.com\r\n\r\nbody\r\n")
+
+	t.Run("LeavesMessageUnchangedIfSignerNil", func(t *testing.T) {
+		mailer := &SesMailer{}
+
+		signed, err := mailer.sign(msg)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, msg, signed)
+	})
+
+	t.Run("PrependsSignatureHeader", func(t *testing.T) {
+		signer := &testDkimSigner{}
+		mailer := &SesMailer{Signer: signer}
+
+		signed, err := mailer.sign(msg)
+
+		assert.NilError(t, err)
+		expectedHeaders := "From: foo@bar.com\r\nTo: baz@quux.com\r\n"
+		assert.Equal(t, expectedHeaders, string(signer.headers))
+		assert.Equal(t, "body\r\n", string(signer.body))
+		assert.Equal(t, "DKIM-Signature: test\r\n"+string(msg), string(signed))
+	})
+
+	t.Run("FailsIfNoHeaderBodySeparator", func(t *testing.T) {
+		mailer := &SesMailer{Signer: &testDkimSigner{}}
+
+		signed, err := mailer.sign([]byte("From: foo@bar.com\r\n"))
+
+		assert.Assert(t, is.Nil(signed))
+		assert.Error(t, err, "DKIM signing failed: message has no body")
+	})
+
+	t.Run("FailsIfSignerFails", func(t *testing.T) {
+		signerErr := errors.New("test error")
+		mailer := &SesMailer{Signer: &testDkimSigner{err: signerErr}}
+
+		signed, err := mailer.sign(msg)
+
+		assert.Assert(t, is.Nil(signed))
+		assert.Assert(t, tu.ErrorIs(err, signerErr))
+		assert.Error(t, err, "DKIM signing failed: test error")
+	})
+}
@@ -22,23 +22,49 @@ var ExampleMessage *Message = MustParseMessageFromJson(
 	strings.NewReader(ExampleMessageJson),
 )
 
+// ExampleRecipient* are the values used to generate ExampleRecipient.
+const ExampleRecipientEmail = "subscriber@foo.com"
+const ExampleRecipientUid = "00000000-1111-2222-3333-444444444444"
+const ExampleUnsubscribeEmail = "unsubscribe@bar.com"
+const ExampleUnsubscribeUrl = "https://bar.com/unsubscribe"
+const ExampleApiBaseUrl = "https://bar.com/email/"
+const ExampleEmailDomainName = "bar.com"
+
 var ExampleRecipient *Recipient = func() (r *Recipient) {
 	r = &Recipient{
-		Email: "subscriber@foo.com",
-		Uid:   uuid.MustParse("00000000-1111-2222-3333-444444444444"),
+		Email: ExampleRecipientEmail,
+		Uid:   uuid.MustParse(ExampleRecipientUid),
 	}
 	r.SetUnsubscribeInfo(
-		"unsubscribe@bar.com",
-		"https://bar.com/unsubscribe",
-		"https://bar.com/email/",
+		ExampleUnsubscribeEmail, ExampleUnsubscribeUrl, ExampleApiBaseUrl,
 	)
 	return
 }()
 
 func EmitPreviewMessageFromJson(input io.Reader, output io.Writer) error {
-	if mt, err := NewMessageTemplateFromJson(input); err != nil {
+	msg, err := NewMessageFromJson(input)
+	if err != nil {
 		return err
-	} else if err = mt.EmitMessage(output, ExampleRecipient); err != nil {
+	}
+	prodOpts := &ProdMessageOptions{DomainName: ExampleEmailDomainName}
+	return EmitPreviewMessage(
+		output, msg, ExampleRecipient, prodOpts.TemplateOptions()...,
+	)
+}
+
+// EmitPreviewMessage writes the raw message that sending msg to r would send,
+// using the same opts as the send.
+//
+// opts should come from ProdMessageOptions.TemplateOptions, followed by
+// WithListHeaders for messages sent to the list. r should already have its
+// unsubscribe info set, so that the output contains the same unsubscribe
+// headers and footer URLs that a send would produce. Each Message-ID will
+// differ, since every send generates a new one.
+func EmitPreviewMessage(
+	output io.Writer, msg *Message, r *Recipient, opts ...MessageTemplateOption,
+) error {
+	mt := NewMessageTemplate(msg, opts...)
+	if err := mt.EmitMessage(output, r); err != nil {
 		return fmt.Errorf("failed to emit preview message: %w", err)
 	}
 	return nil
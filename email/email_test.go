@@ -57,9 +57,17 @@ type TestSesV2 struct {
 	getAccountInput     *sesv2.GetAccountInput
 	getAccountOutput    *sesv2.GetAccountOutput
 	getAccountError     error
+	getIdentityInputs   []*sesv2.GetEmailIdentityInput
+	getIdentityOutputs  map[string]*sesv2.GetEmailIdentityOutput
+	getIdentityError    error
 	sendEmailInput      *sesv2.SendEmailInput
 	sendEmailOutput     *sesv2.SendEmailOutput
 	sendEmailError      error
+	sendEmailCalls      int
+
+	// sendEmailErrs, if not empty, supplies the error for each SendEmail call
+	// in order, taking precedence over sendEmailError.
+	sendEmailErrs []error
 }
 
 func (ses *TestSesV2) GetSuppressedDestination(
@@ -96,10 +104,29 @@ func (ses *TestSesV2) GetAccount(
 	return ses.getAccountOutput, ses.getAccountError
 }
 
+func (ses *TestSesV2) GetEmailIdentity(
+	_ context.Context,
+	input *sesv2.GetEmailIdentityInput,
+	_ ...func(*sesv2.Options),
+) (*sesv2.GetEmailIdentityOutput, error) {
+	ses.getIdentityInputs = append(ses.getIdentityInputs, input)
+	if ses.getIdentityError != nil {
+		return nil, ses.getIdentityError
+	}
+	return ses.getIdentityOutputs[*input.EmailIdentity], nil
+}
+
 func (ses *TestSesV2) SendEmail(
 	_ context.Context, input *sesv2.SendEmailInput, _ ...func(*sesv2.Options),
 ) (*sesv2.SendEmailOutput, error) {
 	ses.sendEmailInput = input
+	ses.sendEmailCalls++
+
+	if len(ses.sendEmailErrs) != 0 {
+		err := ses.sendEmailErrs[0]
+		ses.sendEmailErrs = ses.sendEmailErrs[1:]
+		return ses.sendEmailOutput, err
+	}
 	return ses.sendEmailOutput, ses.sendEmailError
 }
 
@@ -112,6 +139,16 @@ type TestSuppressor struct {
 	suppressErr        error
 	unsuppressedEmail  string
 	unsuppressErr      error
+	reasonEmail        string
+	reason             string
+	reasonErr          error
+}
+
+func (ts *TestSuppressor) SuppressionReason(
+	ctx context.Context, email string,
+) (bool, string, error) {
+	ts.reasonEmail = email
+	return ts.isSuppressedResult, ts.reason, ts.reasonErr
 }
 
 func (ts *TestSuppressor) IsSuppressed(
@@ -144,6 +181,9 @@ func TestEmitPreviewMessageFromJson(t *testing.T) {
 		assert.NilError(t, err)
 		msg, _, pr := tu.ParseMultipartMessageAndBoundary(t, output.String())
 		assert.Assert(t, msg != nil)
+		messageId := msg.Header.Get("Message-ID")
+		expectedSuffix := "@" + ExampleEmailDomainName + ">"
+		assert.Assert(t, strings.HasSuffix(messageId, expectedSuffix))
 		textPart := tu.GetNextPartContent(t, pr, "text/plain")
 		assert.Assert(t, textPart != "")
 		htmlPart := tu.GetNextPartContent(t, pr, "text/html")
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer is a Mailer that writes messages to a local maildir.
+//
+// It's useful for inspecting messages produced by EmitMessage in a real email
+// client without actually sending them, e.g., during local development and
+// continuous integration.
+//
+// Send writes each message to a uniquely named ".eml" file in the "new"
+// subdirectory of Dir, creating the "tmp", "new", and "cur" subdirectories as
+// needed. Following the maildir convention, it first writes the file to "tmp",
+// then moves it to "new", so readers never see a partially written message.
+//
+// The "message ID" returned by Send is the path to the new file.
+//
+// - https://cr.yp.to/proto/maildir.html
+type FileMailer struct {
+	Dir   string
+	count atomic.Uint64
+}
+
+// BulkCapacityAvailable always returns nil, since FileMailer has no quota.
+func (mailer *FileMailer) BulkCapacityAvailable(_ context.Context) error {
+	return nil
+}
+
+func (mailer *FileMailer) Send(
+	_ context.Context, recipient string, msg []byte,
+) (messageId string, err error) {
+	filename := mailer.uniqueFilename()
+	tmpPath := filepath.Join(mailer.Dir, "tmp", filename)
+	newPath := filepath.Join(mailer.Dir, "new", filename)
+
+	if err = mailer.makeMaildir(); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+	} else if err = os.WriteFile(tmpPath, msg, 0600); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+	} else if err = os.Rename(tmpPath, newPath); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+	} else {
+		messageId = newPath
+	}
+	return
+}
+
+func (mailer *FileMailer) uniqueFilename() string {
+	return fmt.Sprintf(
+		"%d.%d_%d.eml",
+		time.Now().UnixNano(),
+		os.Getpid(),
+		mailer.count.Add(1),
+	)
+}
+
+func (mailer *FileMailer) makeMaildir() error {
+	for _, subdir := range []string{"tmp", "new", "cur"} {
+		dir := filepath.Join(mailer.Dir, subdir)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestFileMailer(t *testing.T) {
+	setup := func() (*FileMailer, context.Context) {
+		return &FileMailer{Dir: t.TempDir()}, context.Background()
+	}
+
+	t.Run("BulkCapacityAlwaysAvailable", func(t *testing.T) {
+		mailer, ctx := setup()
+
+		assert.NilError(t, mailer.BulkCapacityAvailable(ctx))
+	})
+
+	t.Run("WritesValidMessagesWithUniqueNames", func(t *testing.T) {
+		mailer, ctx := setup()
+		r := newTestRecipient()
+		msg := testTemplate.GenerateMessage(r)
+
+		firstId, err := mailer.Send(ctx, r.Email, msg)
+		assert.NilError(t, err)
+		secondId, err := mailer.Send(ctx, r.Email, msg)
+		assert.NilError(t, err)
+
+		assert.Assert(t, firstId != secondId)
+		newDir := filepath.Join(mailer.Dir, "new")
+		assert.Equal(t, newDir, filepath.Dir(firstId))
+		assert.Assert(t, strings.HasSuffix(firstId, ".eml"))
+
+		entries, err := os.ReadDir(newDir)
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(entries, 2))
+		tmpEntries, err := os.ReadDir(filepath.Join(mailer.Dir, "tmp"))
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(tmpEntries, 0))
+
+		content, err := os.ReadFile(firstId)
+		assert.NilError(t, err)
+		parsed, _, pr := tu.ParseMultipartMessageAndBoundary(
+			t, string(content),
+		)
+		assertMessageHeaders(t, parsed, string(content))
+		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
+		tu.AssertNextPart(t, pr, "text/html", decodedHtmlContent)
+	})
+
+	t.Run("FailsIfCannotCreateMaildir", func(t *testing.T) {
+		mailer, ctx := setup()
+		mailer.Dir = filepath.Join(mailer.Dir, "not-a-dir")
+		assert.NilError(t, os.WriteFile(mailer.Dir, []byte{}, 0600))
+
+		msgId, err := mailer.Send(ctx, "foo@bar.com", []byte("msg"))
+
+		assert.Equal(t, "", msgId)
+		assert.ErrorContains(t, err, "send to foo@bar.com failed: ")
+	})
+}
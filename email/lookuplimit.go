@@ -0,0 +1,50 @@
+package email
+
+import (
+	"context"
+	"sync"
+)
+
+// LookupLimit caps the number of DNS lookups ProdAddressValidator performs
+// concurrently, across all calls to ValidateAddress.
+//
+// Each address validation may perform several lookups. During a spike in
+// signups, running all of them at once could overwhelm the resolver or exhaust
+// file descriptors. Lookups beyond Max wait for another to finish, or until
+// their context is done.
+//
+// When running in AWS Lambda, each function instance applies its own limit.
+type LookupLimit struct {
+	// Max is the maximum number of concurrent lookups. Values less than one
+	// impose no limit.
+	Max int
+
+	once  sync.Once
+	slots chan struct{}
+}
+
+// acquire waits until fewer than Max lookups are in progress, or until ctx is
+// done, whichever comes first.
+//
+// If acquire returns nil, the caller must call release when its lookup
+// finishes.
+func (l *LookupLimit) acquire(ctx context.Context) error {
+	if l == nil || l.Max < 1 {
+		return nil
+	}
+	l.once.Do(func() { l.slots = make(chan struct{}, l.Max) })
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *LookupLimit) release() {
+	if l == nil || l.Max < 1 {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,171 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// countingResolver records the maximum number of concurrent lookups.
+type countingResolver struct {
+	resolver    Resolver
+	delay       time.Duration
+	mutex       sync.Mutex
+	inFlight    int
+	maxInFlight int
+	lookups     int
+}
+
+func (cr *countingResolver) begin() {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.inFlight++
+	cr.lookups++
+	cr.maxInFlight = max(cr.maxInFlight, cr.inFlight)
+}
+
+func (cr *countingResolver) end() {
+	time.Sleep(cr.delay)
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.inFlight--
+}
+
+func (cr *countingResolver) LookupMX(
+	ctx context.Context, name string,
+) ([]*net.MX, error) {
+	cr.begin()
+	defer cr.end()
+	return cr.resolver.LookupMX(ctx, name)
+}
+
+func (cr *countingResolver) LookupHost(
+	ctx context.Context, host string,
+) ([]string, error) {
+	cr.begin()
+	defer cr.end()
+	return cr.resolver.LookupHost(ctx, host)
+}
+
+func (cr *countingResolver) LookupAddr(
+	ctx context.Context, addr string,
+) ([]string, error) {
+	cr.begin()
+	defer cr.end()
+	return cr.resolver.LookupAddr(ctx, addr)
+}
+
+// nopSuppressor is safe for concurrent use, unlike TestSuppressor.
+type nopSuppressor struct{}
+
+func (nopSuppressor) IsSuppressed(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func (nopSuppressor) Suppress(
+	context.Context, string, ops.RemoveReason,
+) error {
+	return nil
+}
+
+func (nopSuppressor) Unsuppress(context.Context, string) error {
+	return nil
+}
+
+func TestLookupLimit(t *testing.T) {
+	setup := func(max int) (*ProdAddressValidator, *countingResolver) {
+		f := newAddressValidatorFixture()
+		f.tr.mailHosts["acm.org"] = []*net.MX{{Host: "mail.mailroute.net"}}
+		f.tr.hosts["mail.mailroute.net"] = []string{"199.89.3.120"}
+		f.tr.addrs["199.89.3.120"] = []string{"mail.mia.mailroute.net"}
+		f.tr.hosts["mail.mia.mailroute.net"] = []string{"199.89.3.120"}
+		cr := &countingResolver{resolver: f.tr, delay: time.Millisecond}
+		av := &ProdAddressValidator{
+			Suppressor:  nopSuppressor{},
+			Resolver:    cr,
+			LookupLimit: &LookupLimit{Max: max},
+		}
+		return av, cr
+	}
+
+	validateConcurrently := func(
+		av *ProdAddressValidator, numAddrs int,
+	) []error {
+		errs := make([]error, numAddrs)
+		var wg sync.WaitGroup
+		for i := range numAddrs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				email := fmt.Sprintf("user%d@acm.org", i)
+				_, errs[i] = av.ValidateAddress(context.Background(), email)
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("NeverExceedsMaxConcurrentLookups", func(t *testing.T) {
+		const numAddrs = 25
+		av, cr := setup(3)
+
+		errs := validateConcurrently(av, numAddrs)
+
+		for _, err := range errs {
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, 4*numAddrs, cr.lookups)
+		assert.Assert(t, cr.maxInFlight <= 3, cr.maxInFlight)
+		assert.Equal(t, 0, len(av.LookupLimit.slots))
+	})
+
+	t.Run("DoesNotLimitLookupsIfMaxLessThanOne", func(t *testing.T) {
+		av, cr := setup(0)
+
+		errs := validateConcurrently(av, 10)
+
+		for _, err := range errs {
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, 40, cr.lookups)
+		assert.Assert(t, is.Nil(av.LookupLimit.slots))
+	})
+
+	t.Run("DoesNotLimitLookupsIfNil", func(t *testing.T) {
+		var limit *LookupLimit
+
+		assert.NilError(t, limit.acquire(context.Background()))
+		limit.release()
+	})
+
+	t.Run("FailsIfContextDoneWhileWaiting", func(t *testing.T) {
+		av, cr := setup(1)
+		assert.NilError(t, av.LookupLimit.acquire(context.Background()))
+		defer av.LookupLimit.release()
+		ctx, cancel := context.WithTimeout(
+			context.Background(), time.Millisecond,
+		)
+		defer cancel()
+
+		failure, err := av.ValidateAddress(ctx, "mbland@acm.org")
+
+		assert.Assert(t, is.Nil(failure))
+		const expected = "failed to retrieve MX records for acm.org: " +
+			"external error: DNS lookup timed out waiting to look up " +
+			"acm.org: context deadline exceeded"
+		assert.Error(t, err, expected)
+		assert.Assert(t, testutils.ErrorIs(err, ErrLookupTimeout))
+		assertExternalError(t, err)
+		assert.Equal(t, 0, cr.lookups)
+	})
+}
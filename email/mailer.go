@@ -1,13 +1,21 @@
 package email
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
 	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/types"
+	"golang.org/x/time/rate"
 )
 
 type Mailer interface {
@@ -22,6 +30,77 @@ type SesMailer struct {
 	Client    SesV2Api
 	ConfigSet string
 	Throttle  Throttle
+
+	// Signer, if not nil, adds a DKIM-Signature header to every message
+	// before sending it, in addition to any signature SES applies itself.
+	// Use RsaDkimSigner to configure the signing domain, selector, and key.
+	Signer DkimSigner
+
+	// MaxSendRetries is the number of times to retry a send that fails due
+	// to SES throttling or temporary unavailability, waiting between
+	// attempts according to SendBackoff. Other errors are never retried.
+	MaxSendRetries int
+
+	// SendBackoff defaults to DefaultSendBackoff if nil.
+	SendBackoff ops.Backoff
+
+	// Sleep waits between send attempts, returning an error if ctx is
+	// cancelled while waiting. Defaults to ops.Sleep if nil.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	// Limiter, if not nil, caps the client side send rate independently of
+	// Throttle. Send waits on it before each message, returning early if ctx
+	// is cancelled while waiting.
+	Limiter *rate.Limiter
+
+	// FromIdentityArn, if not empty, is the ARN of the SES identity used to
+	// send every message. Use SelectMailFromIdentity to choose an identity
+	// whose custom MAIL FROM domain aligns with the From header's domain.
+	FromIdentityArn string
+
+	// MaxMessageBytes is the maximum size of a fully encoded message,
+	// including any DKIM-Signature header. Send returns ErrMessageTooLarge
+	// for larger messages without sending them. Defaults to
+	// DefaultMaxMessageBytes if zero.
+	MaxMessageBytes int
+
+	// DryRun, if true, causes Send to skip sending each message. Send still
+	// signs the message and checks its size, but doesn't wait for Limiter or
+	// Throttle, and never calls SES. It returns a synthetic message ID
+	// resembling those from SES.
+	DryRun bool
+
+	// DryRunWriter, if not nil, receives each message skipped while DryRun is
+	// set, exactly as Send would've sent it to SES. Nothing retains the
+	// messages after writing them.
+	DryRunWriter io.Writer
+
+	// Metrics, if not nil, counts each message SES accepts as
+	// MessagesSentMetric, and each failed send as SendErrorsMetric. Messages
+	// skipped while DryRun is set aren't counted.
+	Metrics ops.Metrics
+
+	dryRunMutex sync.Mutex
+}
+
+// Names of the metrics emitted by SesMailer.Send when SesMailer.Metrics is set.
+const (
+	MessagesSentMetric = "MessagesSent"
+	SendErrorsMetric   = "SendErrors"
+)
+
+// DefaultMaxMessageBytes matches the maximum raw message size SES accepts.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/quotas.html
+const DefaultMaxMessageBytes = 10 * 1024 * 1024
+
+// ErrMessageTooLarge indicates a message exceeds SesMailer.MaxMessageBytes.
+const ErrMessageTooLarge = types.SentinelError("message too large")
+
+// DefaultSendBackoff starts at roughly the interval between sends at typical
+// SES maximum send rates, and caps retries well within a Lambda timeout.
+var DefaultSendBackoff ops.Backoff = &ops.FullJitterBackoff{
+	Base: 100 * time.Millisecond, Cap: 5 * time.Second,
 }
 
 func (mailer *SesMailer) BulkCapacityAvailable(ctx context.Context) error {
@@ -31,6 +110,17 @@ func (mailer *SesMailer) BulkCapacityAvailable(ctx context.Context) error {
 func (mailer *SesMailer) Send(
 	ctx context.Context, recipient string, msg []byte,
 ) (messageId string, err error) {
+	defer func() { mailer.countSend(err) }()
+
+	if msg, err = mailer.sign(msg); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+		return
+	} else if err = mailer.checkSize(msg); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+		return
+	} else if mailer.DryRun {
+		return mailer.skipDryRunMessage(msg), nil
+	}
 	sesMsg := &sesv2.SendEmailInput{
 		ConfigurationSetName: aws.String(mailer.ConfigSet),
 		Content: &sestypes.EmailContent{
@@ -40,14 +130,142 @@ func (mailer *SesMailer) Send(
 			ToAddresses: []string{recipient},
 		},
 	}
-	var output *sesv2.SendEmailOutput
+	if mailer.FromIdentityArn != "" {
+		sesMsg.FromEmailAddressIdentityArn = aws.String(mailer.FromIdentityArn)
+	}
+	var out *sesv2.SendEmailOutput
+	var attempts int
 
-	if err = mailer.Throttle.PauseBeforeNextSend(ctx); err != nil {
+	if err = mailer.waitForLimiter(ctx); err != nil {
 		err = fmt.Errorf("send to %s failed: %w", recipient, err)
-	} else if output, err = mailer.Client.SendEmail(ctx, sesMsg); err != nil {
+	} else if err = mailer.Throttle.PauseBeforeNextSend(ctx); err != nil {
+		err = fmt.Errorf("send to %s failed: %w", recipient, err)
+	} else if out, attempts, err = mailer.sendEmail(ctx, sesMsg); err == nil {
+		messageId = aws.ToString(out.MessageId)
+	} else if errors.Is(err, ctx.Err()) {
+		const errFmt = "send to %s cancelled after %d attempts: %w"
+		err = fmt.Errorf(errFmt, recipient, attempts, err)
+	} else if attempts == 1 {
 		err = ops.AwsError("send to "+recipient+" failed", err)
 	} else {
-		messageId = aws.ToString(output.MessageId)
+		const errFmt = "send to %s failed after %d attempts"
+		err = ops.AwsError(fmt.Sprintf(errFmt, recipient, attempts), err)
 	}
 	return
 }
+
+func (mailer *SesMailer) countSend(err error) {
+	if mailer.DryRun {
+		return
+	} else if err != nil {
+		ops.CountMetric(mailer.Metrics, SendErrorsMetric, 1, nil)
+	} else {
+		ops.CountMetric(mailer.Metrics, MessagesSentMetric, 1, nil)
+	}
+}
+
+// skipDryRunMessage writes msg to DryRunWriter, if set, with a single call, so
+// that messages skipped by concurrent Send calls don't interleave.
+func (mailer *SesMailer) skipDryRunMessage(msg []byte) (messageId string) {
+	if w := mailer.DryRunWriter; w != nil {
+		mailer.dryRunMutex.Lock()
+		defer mailer.dryRunMutex.Unlock()
+		// There's nothing useful to do if writing a skipped message fails.
+		w.Write(msg)
+	}
+	return dryRunMessageId(time.Now())
+}
+
+func (mailer *SesMailer) checkSize(msg []byte) error {
+	maxBytes := mailer.MaxMessageBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxMessageBytes
+	}
+	if len(msg) > maxBytes {
+		const errFmt = "%w: %d bytes exceeds maximum of %d"
+		return fmt.Errorf(errFmt, ErrMessageTooLarge, len(msg), maxBytes)
+	}
+	return nil
+}
+
+func (mailer *SesMailer) waitForLimiter(ctx context.Context) error {
+	if mailer.Limiter == nil {
+		return nil
+	}
+	return mailer.Limiter.Wait(ctx)
+}
+
+// sendEmail calls SendEmail, retrying up to MaxSendRetries times after errors
+// for which isRetryableSendError returns true.
+//
+// It returns ctx.Err() if ctx is cancelled while waiting to retry.
+func (mailer *SesMailer) sendEmail(
+	ctx context.Context, input *sesv2.SendEmailInput,
+) (output *sesv2.SendEmailOutput, attempts int, err error) {
+	backoff := mailer.SendBackoff
+	if backoff == nil {
+		backoff = DefaultSendBackoff
+	}
+	sleep := ops.Sleep
+	if mailer.Sleep != nil {
+		sleep = mailer.Sleep
+	}
+
+	for attempts = 1; ; attempts++ {
+		output, err = mailer.Client.SendEmail(ctx, input)
+		if !isRetryableSendError(err) || attempts > mailer.MaxSendRetries {
+			return
+		}
+		if err = sleep(ctx, backoff.NextDelay(attempts)); err != nil {
+			return
+		}
+	}
+}
+
+// retryableSendErrorCodes are error codes SES returns for throttling or
+// temporary unavailability that aren't modeled as distinct SDK error types.
+var retryableSendErrorCodes = map[string]bool{
+	"Throttling":          true,
+	"ThrottlingException": true,
+	"ServiceUnavailable":  true,
+}
+
+// isRetryableSendError returns true if err indicates SES throttled the request
+// or was temporarily unavailable.
+//
+// Permanent failures, such as sestypes.MessageRejected, and exhausted quotas,
+// such as sestypes.LimitExceededException, return false.
+func isRetryableSendError(err error) bool {
+	var tooMany *sestypes.TooManyRequestsException
+	var apiErr smithy.APIError
+
+	if err == nil {
+		return false
+	} else if errors.As(err, &tooMany) {
+		return true
+	}
+	return errors.As(err, &apiErr) &&
+		retryableSendErrorCodes[apiErr.ErrorCode()]
+}
+
+var headerBodySeparator = []byte("\r\n\r\n")
+
+// sign prepends a DKIM-Signature header to msg if mailer.Signer is set.
+func (mailer *SesMailer) sign(msg []byte) ([]byte, error) {
+	if mailer.Signer == nil {
+		return msg, nil
+	}
+
+	i := bytes.Index(msg, headerBodySeparator)
+	if i == -1 {
+		return nil, errors.New("DKIM signing failed: message has no body")
+	}
+	headers := msg[:i+len(crlf)]
+	body := msg[i+len(headerBodySeparator):]
+	sigHeader, err := mailer.Signer.Sign(headers, body)
+
+	if err != nil {
+		return nil, fmt.Errorf("DKIM signing failed: %w", err)
+	}
+	return append([]byte(sigHeader), msg...), nil
+}
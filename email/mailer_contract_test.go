@@ -51,7 +51,14 @@ func TestSendWithLiveSes(t *testing.T) {
 		client := sesv2.NewFromConfig(cfg)
 		maxCap, _ := types.NewCapacity(0.8)
 		throttle, err := NewSesThrottle(
-			ctx, client, maxCap, time.Sleep, time.Now, time.Minute,
+			ctx,
+			client,
+			maxCap,
+			types.Capacity{},
+			0.0,
+			time.Sleep,
+			time.Now,
+			time.Minute,
 		)
 
 		if err != nil {
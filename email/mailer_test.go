@@ -3,14 +3,23 @@
 package email
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
+	"golang.org/x/time/rate"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 type TestThrottle struct {
@@ -78,6 +87,301 @@ func TestSend(t *testing.T) {
 			t, mailer.ConfigSet, aws.ToString(input.ConfigurationSetName),
 		)
 		assert.DeepEqual(t, testMsg, input.Content.Raw.Data)
+		assert.Assert(t, input.FromEmailAddressIdentityArn == nil)
+	})
+
+	t.Run("SendsFromIdentityIfSet", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		const identityArn = "arn:aws:ses:us-east-1:0123456789:identity/foo.com"
+		mailer.FromIdentityArn = identityArn
+
+		_, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.NilError(t, err)
+		input := testSes.sendEmailInput
+		assert.Equal(
+			t, identityArn, aws.ToString(input.FromEmailAddressIdentityArn),
+		)
+	})
+
+	t.Run("SignsMessageIfSignerSet", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		mailer.Signer = &testDkimSigner{}
+		msg := []byte("Subject: test\r\n\r\nbody\r\n")
+
+		_, err := mailer.Send(ctx, recipient, msg)
+
+		assert.NilError(t, err)
+		expected := "DKIM-Signature: test\r\n" + string(msg)
+		sent := testSes.sendEmailInput.Content.Raw.Data
+		assert.Equal(t, expected, string(sent))
+	})
+
+	t.Run("ReturnsErrorIfSigningFails", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		mailer.Signer = &testDkimSigner{}
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.Equal(t, "", msgId)
+		expected := "send to " + recipient + " failed: " +
+			"DKIM signing failed: message has no body"
+		assert.Error(t, err, expected)
+		assert.Equal(t, 0, throttle.pauseBeforeSendCalls)
+		assert.Assert(t, testSes.sendEmailInput.Content == nil)
+	})
+
+	// Encoding a message with non-ASCII text makes it larger than its input.
+	largeMsg := func() []byte {
+		const text = "Café au lait, s'il vous plaît. "
+		const html = "<p>Café au lait, s'il vous plaît.</p>"
+		mt := NewMessageTemplate(&Message{
+			From:       testMessage.From,
+			Subject:    testMessage.Subject,
+			TextBody:   strings.Repeat(text, 1000),
+			TextFooter: testMessage.TextFooter,
+			HtmlBody:   strings.Repeat(html, 1000),
+			HtmlFooter: testMessage.HtmlFooter,
+		})
+		return mt.GenerateMessage(newTestRecipient())
+	}()
+
+	t.Run("ReturnsErrorIfMessageTooLarge", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		mailer.MaxMessageBytes = len(largeMsg) - 1
+
+		msgId, err := mailer.Send(ctx, recipient, largeMsg)
+
+		assert.Equal(t, "", msgId)
+		assert.Assert(t, testutils.ErrorIs(err, ErrMessageTooLarge))
+		expected := fmt.Sprintf(
+			"send to %s failed: message too large: "+
+				"%d bytes exceeds maximum of %d",
+			recipient, len(largeMsg), len(largeMsg)-1,
+		)
+		assert.Error(t, err, expected)
+		assert.Equal(t, 0, throttle.pauseBeforeSendCalls)
+		assert.Assert(t, testSes.sendEmailInput.Content == nil)
+	})
+
+	t.Run("SucceedsIfMessageSizeAtLimit", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		mailer.MaxMessageBytes = len(largeMsg)
+
+		_, err := mailer.Send(ctx, recipient, largeMsg)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, largeMsg, testSes.sendEmailInput.Content.Raw.Data)
+	})
+
+	t.Run("DefaultsToDefaultMaxMessageBytes", func(t *testing.T) {
+		_, _, mailer, ctx := setup()
+		msg := make([]byte, DefaultMaxMessageBytes+1)
+
+		_, err := mailer.Send(ctx, recipient, msg)
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrMessageTooLarge))
+	})
+
+	t.Run("CountsDkimSignatureTowardsSizeLimit", func(t *testing.T) {
+		_, _, mailer, ctx := setup()
+		mailer.Signer = &testDkimSigner{}
+		msg := []byte("Subject: test\r\n\r\nbody\r\n")
+		mailer.MaxMessageBytes = len(msg)
+
+		_, err := mailer.Send(ctx, recipient, msg)
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrMessageTooLarge))
+	})
+
+	t.Run("SkipsSendingIfDryRun", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		mailer.DryRun = true
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.NilError(t, err)
+		sesIdPattern := regexp.MustCompile(
+			`^[0-9a-f]{16}-[0-9a-f]{8}(-[0-9a-f]{4}){3}-[0-9a-f]{12}-000000$`,
+		)
+		assert.Assert(t, sesIdPattern.MatchString(msgId), msgId)
+		assert.Assert(t, testSes.sendEmailInput.Content == nil)
+		assert.Equal(t, 0, throttle.pauseBeforeSendCalls)
+	})
+
+	t.Run("WritesDryRunMessagesToDryRunWriter", func(t *testing.T) {
+		_, _, mailer, ctx := setup()
+		buf := &bytes.Buffer{}
+		mailer.DryRun = true
+		mailer.DryRunWriter = buf
+		r := newTestRecipient()
+		msg := testTemplate.GenerateMessage(r)
+
+		_, err := mailer.Send(ctx, r.Email, msg)
+		assert.NilError(t, err)
+		_, err = mailer.Send(ctx, "other@foo.com", testMsg)
+		assert.NilError(t, err)
+
+		assert.Equal(t, string(msg)+string(testMsg), buf.String())
+	})
+
+	t.Run("SignsAndChecksSizeOfDryRunMessages", func(t *testing.T) {
+		_, _, mailer, ctx := setup()
+		buf := &bytes.Buffer{}
+		mailer.DryRun = true
+		mailer.DryRunWriter = buf
+		mailer.Signer = &testDkimSigner{}
+		msg := []byte("Subject: test\r\n\r\nbody\r\n")
+		signed := append([]byte("DKIM-Signature: test\r\n"), msg...)
+		mailer.MaxMessageBytes = len(signed)
+
+		_, err := mailer.Send(ctx, recipient, msg)
+		assert.NilError(t, err)
+		mailer.MaxMessageBytes = len(signed) - 1
+		_, err = mailer.Send(ctx, recipient, msg)
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrMessageTooLarge))
+		assert.Equal(t, string(signed), buf.String())
+	})
+
+	t.Run("CountsSendsAndErrorsIfMetricsSet", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		buf := &strings.Builder{}
+		mailer.Metrics = &ops.EmfMetrics{Namespace: "EListMan", Writer: buf}
+
+		_, err := mailer.Send(ctx, recipient, testMsg)
+		assert.NilError(t, err)
+		testSes.sendEmailError = testutils.AwsServerError("SendRawEmail error")
+		_, err = mailer.Send(ctx, recipient, testMsg)
+		assert.ErrorContains(t, err, "SendRawEmail error")
+		mailer.DryRun = true
+		_, err = mailer.Send(ctx, recipient, testMsg)
+		assert.NilError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Equal(t, 2, len(lines))
+		assert.Assert(t, is.Contains(lines[0], `"MessagesSent":1`))
+		assert.Assert(t, is.Contains(lines[0], `"Namespace":"EListMan"`))
+		assert.Assert(t, is.Contains(lines[1], `"SendErrors":1`))
+	})
+
+	t.Run("RetriesAfterThrottlingUntilSuccess", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		testSes.sendEmailOutput.MessageId = aws.String(testMsgId)
+		testSes.sendEmailErrs = []error{
+			&sestypes.TooManyRequestsException{Message: aws.String("slow")},
+			&smithy.GenericAPIError{Code: "Throttling"},
+			&smithy.GenericAPIError{Code: "ServiceUnavailable"},
+		}
+		mailer.MaxSendRetries = 3
+		mailer.SendBackoff = &ops.FixedBackoff{Delay: time.Second}
+		var delays []time.Duration
+		mailer.Sleep = func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.NilError(t, err)
+		assert.Equal(t, testMsgId, msgId)
+		assert.Equal(t, 4, testSes.sendEmailCalls)
+		assert.Equal(t, 1, throttle.pauseBeforeSendCalls)
+		expected := []time.Duration{time.Second, time.Second, time.Second}
+		assert.DeepEqual(t, expected, delays)
+	})
+
+	t.Run("ReturnsLastErrorIfRetriesExhausted", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		testSes.sendEmailError = &sestypes.TooManyRequestsException{
+			Message: aws.String("too many requests"),
+		}
+		mailer.MaxSendRetries = 2
+		mailer.Sleep = func(context.Context, time.Duration) error {
+			return nil
+		}
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.Equal(t, "", msgId)
+		assert.Equal(t, 3, testSes.sendEmailCalls)
+		expected := "send to " + recipient + " failed after 3 attempts: "
+		assert.ErrorContains(t, err, expected)
+		assert.ErrorContains(t, err, "too many requests")
+	})
+
+	t.Run("DoesNotRetryPermanentFailures", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		testSes.sendEmailError = &sestypes.MessageRejected{
+			Message: aws.String("rejected"),
+		}
+		mailer.MaxSendRetries = 2
+		mailer.Sleep = func(context.Context, time.Duration) error {
+			t.Fatal("should not sleep")
+			return nil
+		}
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.Equal(t, "", msgId)
+		assert.Equal(t, 1, testSes.sendEmailCalls)
+		assert.ErrorContains(t, err, "send to "+recipient+" failed: ")
+		assert.ErrorContains(t, err, "rejected")
+	})
+
+	t.Run("StopsRetryingIfContextCancelled", func(t *testing.T) {
+		testSes, _, mailer, ctx := setup()
+		testSes.sendEmailError = &sestypes.TooManyRequestsException{
+			Message: aws.String("too many requests"),
+		}
+		mailer.MaxSendRetries = 2
+		mailer.SendBackoff = &ops.FixedBackoff{Delay: time.Minute}
+		ctx, cancel := context.WithCancel(ctx)
+		mailer.Sleep = func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return ops.Sleep(ctx, d)
+		}
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.Equal(t, "", msgId)
+		assert.Equal(t, 1, testSes.sendEmailCalls)
+		assert.Assert(t, testutils.ErrorIs(err, context.Canceled))
+		expected := "send to " + recipient + " cancelled after 1 attempts: "
+		assert.ErrorContains(t, err, expected)
+	})
+
+	t.Run("WaitsForLimiterBeforeSending", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		const interval = 50 * time.Millisecond
+		mailer.Limiter = rate.NewLimiter(rate.Every(interval), 1)
+
+		start := time.Now()
+		_, err := mailer.Send(ctx, recipient, testMsg)
+		assert.NilError(t, err)
+		_, err = mailer.Send(ctx, recipient, testMsg)
+		assert.NilError(t, err)
+
+		elapsed := time.Since(start)
+		assert.Assert(t, elapsed >= interval-5*time.Millisecond, elapsed)
+		assert.Equal(t, 2, testSes.sendEmailCalls)
+		assert.Equal(t, 2, throttle.pauseBeforeSendCalls)
+	})
+
+	t.Run("ReturnsErrorIfCancelledWhileWaitingForLimiter", func(t *testing.T) {
+		testSes, throttle, mailer, ctx := setup()
+		mailer.Limiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+		assert.Assert(t, mailer.Limiter.Allow())
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		msgId, err := mailer.Send(ctx, recipient, testMsg)
+
+		assert.Equal(t, "", msgId)
+		assert.Assert(t, testutils.ErrorIs(err, context.Canceled))
+		assert.ErrorContains(t, err, "send to "+recipient+" failed")
+		assert.Equal(t, 0, testSes.sendEmailCalls)
+		assert.Equal(t, 0, throttle.pauseBeforeSendCalls)
 	})
 
 	t.Run("ReturnsErrorThrottleFails", func(t *testing.T) {
@@ -104,3 +408,14 @@ func TestSend(t *testing.T) {
 		assert.Equal(t, 1, throttle.pauseBeforeSendCalls)
 	})
 }
+
+func TestIsRetryableSendError(t *testing.T) {
+	assert.Assert(t, !isRetryableSendError(nil))
+	assert.Assert(t, isRetryableSendError(&sestypes.TooManyRequestsException{}))
+	assert.Assert(
+		t, isRetryableSendError(&smithy.GenericAPIError{Code: "Throttling"}),
+	)
+	assert.Assert(t, !isRetryableSendError(&sestypes.MessageRejected{}))
+	assert.Assert(t, !isRetryableSendError(&sestypes.LimitExceededException{}))
+	assert.Assert(t, !isRetryableSendError(testutils.AwsServerError("oops")))
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/mbland/elistman/ops"
+)
+
+// SelectMailFromIdentity returns the first of identityArns whose custom MAIL
+// FROM domain aligns with fromDomain, the domain of the From header.
+//
+// SPF alignment for DMARC requires the MAIL FROM (envelope sender) domain to
+// share the From header's domain. A MAIL FROM domain aligns if it equals
+// fromDomain or is one of its subdomains, e.g., "mail.example.com" aligns with
+// "example.com". Identities without a successfully verified custom MAIL FROM
+// domain never align, since SES sends their messages from "amazonses.com".
+//
+// Returns an error if any ARN isn't an SES identity ARN, if retrieving any
+// identity fails, or if no identity aligns with fromDomain.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/mail-from.html
+// - https://docs.aws.amazon.com/ses/latest/dg/send-email-authentication-dmarc.html#send-email-authentication-dmarc-spf
+func SelectMailFromIdentity(
+	ctx context.Context,
+	client SesV2Api,
+	identityArns []string,
+	fromDomain string,
+) (string, error) {
+	misaligned := make([]string, 0, len(identityArns))
+
+	for _, arn := range identityArns {
+		mailFrom, err := getMailFromDomain(ctx, client, arn)
+		if err != nil {
+			return "", err
+		} else if mailFromAligns(mailFrom, fromDomain) {
+			return arn, nil
+		} else if mailFrom == "" {
+			mailFrom = "no custom MAIL FROM domain"
+		}
+		misaligned = append(misaligned, arn+" ("+mailFrom+")")
+	}
+	const errFmt = "no identity's MAIL FROM domain aligns with %s: %s"
+	return "", fmt.Errorf(errFmt, fromDomain, strings.Join(misaligned, ", "))
+}
+
+// getMailFromDomain returns the identity's custom MAIL FROM domain, or the
+// empty string if it's not yet successfully verified.
+func getMailFromDomain(
+	ctx context.Context, client SesV2Api, identityArn string,
+) (string, error) {
+	const identityPrefix = ":identity/"
+	i := strings.Index(identityArn, identityPrefix)
+
+	if !strings.HasPrefix(identityArn, "arn:") || i == -1 {
+		return "", fmt.Errorf("not an SES identity ARN: %s", identityArn)
+	}
+	input := &sesv2.GetEmailIdentityInput{
+		EmailIdentity: aws.String(identityArn[i+len(identityPrefix):]),
+	}
+	output, err := client.GetEmailIdentity(ctx, input)
+
+	if err != nil {
+		return "", ops.AwsError("failed to get identity "+identityArn, err)
+	}
+	attrs := output.MailFromAttributes
+	if attrs == nil ||
+		attrs.MailFromDomainStatus != sestypes.MailFromDomainStatusSuccess {
+		return "", nil
+	}
+	return aws.ToString(attrs.MailFromDomain), nil
+}
+
+func mailFromAligns(mailFromDomain, fromDomain string) bool {
+	mailFromDomain = strings.ToLower(mailFromDomain)
+	fromDomain = strings.ToLower(fromDomain)
+	return mailFromDomain != "" && (mailFromDomain == fromDomain ||
+		strings.HasSuffix(mailFromDomain, "."+fromDomain))
+}
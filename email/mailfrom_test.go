@@ -0,0 +1,118 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/mbland/elistman/ops"
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+func TestSelectMailFromIdentity(t *testing.T) {
+	const arnPrefix = "arn:aws:ses:us-east-1:0123456789:identity/"
+	const fooArn = arnPrefix + "foo.com"
+	const barArn = arnPrefix + "bar.com"
+	identityOutput := func(
+		mailFrom string, status sestypes.MailFromDomainStatus,
+	) *sesv2.GetEmailIdentityOutput {
+		return &sesv2.GetEmailIdentityOutput{
+			MailFromAttributes: &sestypes.MailFromAttributes{
+				MailFromDomain:       aws.String(mailFrom),
+				MailFromDomainStatus: status,
+			},
+		}
+	}
+	setup := func() *TestSesV2 {
+		return &TestSesV2{
+			getIdentityOutputs: map[string]*sesv2.GetEmailIdentityOutput{
+				"bar.com": identityOutput(
+					"mail.bar.com", sestypes.MailFromDomainStatusSuccess,
+				),
+				"foo.com": identityOutput(
+					"mail.foo.com", sestypes.MailFromDomainStatusSuccess,
+				),
+			},
+		}
+	}
+	ctx := context.Background()
+	arns := []string{barArn, fooArn}
+
+	t.Run("SelectsAlignedIdentity", func(t *testing.T) {
+		testSes := setup()
+
+		arn, err := SelectMailFromIdentity(ctx, testSes, arns, "foo.com")
+
+		assert.NilError(t, err)
+		assert.Equal(t, fooArn, arn)
+		assert.Equal(t, 2, len(testSes.getIdentityInputs))
+		firstInput := testSes.getIdentityInputs[0]
+		assert.Equal(t, "bar.com", aws.ToString(firstInput.EmailIdentity))
+	})
+
+	t.Run("SelectsIdentityWithSameDomainIgnoringCase", func(t *testing.T) {
+		testSes := setup()
+		testSes.getIdentityOutputs["foo.com"] = identityOutput(
+			"Foo.com", sestypes.MailFromDomainStatusSuccess,
+		)
+
+		arn, err := SelectMailFromIdentity(ctx, testSes, arns, "foo.com")
+
+		assert.NilError(t, err)
+		assert.Equal(t, fooArn, arn)
+	})
+
+	t.Run("ReportsMisalignment", func(t *testing.T) {
+		testSes := setup()
+		testSes.getIdentityOutputs["foo.com"] = identityOutput(
+			"mail.foo.com", sestypes.MailFromDomainStatusPending,
+		)
+
+		arn, err := SelectMailFromIdentity(ctx, testSes, arns, "foo.com")
+
+		assert.Equal(t, "", arn)
+		assert.Error(
+			t,
+			err,
+			"no identity's MAIL FROM domain aligns with foo.com: "+
+				barArn+" (mail.bar.com), "+
+				fooArn+" (no custom MAIL FROM domain)",
+		)
+	})
+
+	t.Run("DoesNotAlignWithDomainSharingSuffix", func(t *testing.T) {
+		testSes := setup()
+		testSes.getIdentityOutputs["foo.com"] = identityOutput(
+			"mailfoo.com", sestypes.MailFromDomainStatusSuccess,
+		)
+
+		_, err := SelectMailFromIdentity(ctx, testSes, arns, "foo.com")
+
+		assert.ErrorContains(t, err, fooArn+" (mailfoo.com)")
+	})
+
+	t.Run("FailsIfNotAnIdentityArn", func(t *testing.T) {
+		testSes := setup()
+
+		_, err := SelectMailFromIdentity(
+			ctx, testSes, []string{"foo.com"}, "foo.com",
+		)
+
+		assert.Error(t, err, "not an SES identity ARN: foo.com")
+	})
+
+	t.Run("FailsIfGettingIdentityFails", func(t *testing.T) {
+		testSes := setup()
+		testSes.getIdentityError = tu.AwsServerError("test error")
+
+		_, err := SelectMailFromIdentity(ctx, testSes, arns, "foo.com")
+
+		assert.ErrorContains(t, err, "failed to get identity "+barArn+": ")
+		assert.Assert(t, tu.ErrorIs(err, ops.ErrExternal))
+	})
+}
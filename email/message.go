@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"mime"
 	"mime/multipart"
-	"mime/quotedprintable"
 	"net/mail"
 	"net/textproto"
+	"regexp"
 	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/types"
 )
 
 type Message struct {
@@ -21,6 +25,137 @@ type Message struct {
 	TextFooter string
 	HtmlBody   string
 	HtmlFooter string
+
+	// Preheader is optional text that many email clients display after the
+	// subject in the inbox, instead of the first text in the message.
+	//
+	// It requires HtmlBody. NewMessageTemplate inserts it as a hidden element
+	// at the beginning of the HTML body, followed by zero-width whitespace
+	// that keeps the body text out of the preview.
+	Preheader string
+
+	// FromName is an optional display name for the From address.
+	//
+	// If present, it replaces any display name within From. It may contain
+	// non-ASCII characters, which will be encoded per RFC 2047.
+	//
+	// - https://www.rfc-editor.org/rfc/rfc2047
+	FromName string
+
+	// ReplyTo is an optional address to which recipients' replies should go
+	// instead of the From address.
+	//
+	// - https://www.rfc-editor.org/rfc/rfc5322#section-3.6.2
+	ReplyTo string
+
+	// InReplyTo and References are optional message IDs of earlier messages.
+	//
+	// Setting these causes email clients that support threading to display
+	// each message in a series under the first. Each message ID must take the
+	// form "<id-left@id-right>".
+	//
+	// - https://www.rfc-editor.org/rfc/rfc5322#section-3.6.4
+	InReplyTo  string
+	References []string
+
+	// CampaignKey optionally identifies a send of this message to the list,
+	// e.g., "2023-05-newsletter".
+	//
+	// If set, the EListMan Lambda records the key for each recipient before
+	// sending, and skips recipients already recorded. This prevents duplicate
+	// messages if the same send is run again. It doesn't affect the message
+	// content.
+	CampaignKey string
+
+	// Headers are optional custom header fields, e.g., "X-Campaign-Id", added
+	// to every message in the order given.
+	//
+	// Names must not contain whitespace, control characters, or colons, and
+	// must not appear more than once or match any header EListMan manages
+	// itself, such as "From" or "Content-Type". Values must not contain CR
+	// or LF; values containing non-ASCII characters will be encoded per
+	// RFC 2047.
+	Headers []Header
+
+	// Calendar is an optional iCalendar object, e.g., an event announcement,
+	// that email clients may offer to add to the recipient's calendar.
+	//
+	// It must begin with "BEGIN:VCALENDAR" and end with "END:VCALENDAR". If it
+	// specifies a METHOD property, its value must be "PUBLISH", since
+	// EListMan doesn't collect replies from attendees.
+	//
+	// - https://www.rfc-editor.org/rfc/rfc5545
+	// - https://www.rfc-editor.org/rfc/rfc6047
+	Calendar string
+}
+
+// Header is a custom header field to add to a Message.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// managedHeaders are the headers that MessageTemplate, Recipient, and
+// SesMailer emit themselves, which Message.Headers must not contain.
+var managedHeaders = map[string]bool{
+	"Content-Transfer-Encoding": true,
+	"Content-Type":              true,
+	"Dkim-Signature":            true,
+	"From":                      true,
+	"In-Reply-To":               true,
+	"List-Help":                 true,
+	"List-Subscribe":            true,
+	"List-Unsubscribe":          true,
+	"List-Unsubscribe-Post":     true,
+	"Message-Id":                true,
+	"Mime-Version":              true,
+	"References":                true,
+	"Reply-To":                  true,
+	"Subject":                   true,
+	"To":                        true,
+}
+
+// validateHeaders returns an error for each invalid Message.Headers entry.
+//
+// Rejecting CR and LF in names and values prevents header injection, whereby
+// a value could otherwise end its own header and begin another.
+func validateHeaders(headers []Header) (errs []error) {
+	seen := make(map[string]bool, len(headers))
+	addErr := func(i int, format string, args ...any) {
+		prefix := fmt.Sprintf("Headers[%d]: ", i)
+		errs = append(errs, errors.New(prefix+fmt.Sprintf(format, args...)))
+	}
+
+	for i, h := range headers {
+		name := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if !isHeaderName(h.Name) {
+			addErr(i, "invalid header name: %q", h.Name)
+		} else if managedHeaders[name] {
+			addErr(i, "%s header is managed by EListMan", h.Name)
+		} else if seen[name] {
+			addErr(i, "duplicate %s header", h.Name)
+		}
+		if strings.ContainsAny(h.Value, "\r\n") {
+			addErr(i, "%s header value contains CR or LF", h.Name)
+		}
+		seen[name] = true
+	}
+	return
+}
+
+// isHeaderName reports whether name is a valid header field name.
+//
+// - https://www.rfc-editor.org/rfc/rfc5322#section-2.2
+func isHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c < '!' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
 }
 
 func NewMessageFromJson(
@@ -73,6 +208,12 @@ func (msg *Message) Validate(validators ...MessageValidatorFunc) error {
 		fromName = addr.Name
 		fromAddress = addr.Address
 	}
+	if msg.ReplyTo != "" {
+		if _, err := mail.ParseAddress(msg.ReplyTo); err != nil {
+			addErr("failed to parse ReplyTo address \"" + msg.ReplyTo +
+				"\": " + err.Error())
+		}
+	}
 	if len(msg.Subject) == 0 {
 		addErr("missing Subject")
 	}
@@ -93,6 +234,26 @@ func (msg *Message) Validate(validators ...MessageValidatorFunc) error {
 	} else if len(msg.HtmlFooter) != 0 {
 		addErr("HtmlFooter present, but HtmlBody missing")
 	}
+	if len(msg.Preheader) != 0 && len(msg.HtmlBody) == 0 {
+		addErr("Preheader present, but HtmlBody missing")
+	}
+
+	if msg.InReplyTo != "" && !isMessageId(msg.InReplyTo) {
+		addErr("InReplyTo is not a valid message ID: " + msg.InReplyTo)
+	}
+	for _, ref := range msg.References {
+		if !isMessageId(ref) {
+			addErr("References contains invalid message ID: " + ref)
+		}
+	}
+
+	errs = append(errs, validateHeaders(msg.Headers)...)
+
+	if msg.Calendar != "" {
+		if err := validateCalendar(msg.Calendar); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
 	for _, vf := range validators {
 		errs = append(errs, vf(msg, fromName, fromAddress))
@@ -104,6 +265,42 @@ func (msg *Message) Validate(validators ...MessageValidatorFunc) error {
 	return nil
 }
 
+var messageIdPattern = regexp.MustCompile(`^<[^<>@\s]+@[^<>@\s]+>$`)
+
+func isMessageId(id string) bool {
+	return messageIdPattern.MatchString(id)
+}
+
+// calendarMethod is the iTIP method of every Message.Calendar object.
+//
+// - https://www.rfc-editor.org/rfc/rfc5546#section-3.2
+const calendarMethod = "PUBLISH"
+
+func validateCalendar(calendar string) error {
+	lines := strings.Split(strings.TrimSpace(calendar), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+
+	if !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") ||
+		!strings.EqualFold(lines[len(lines)-1], "END:VCALENDAR") {
+		return errors.New(
+			"Calendar must begin with BEGIN:VCALENDAR " +
+				"and end with END:VCALENDAR",
+		)
+	}
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(name, "METHOD") &&
+			!strings.EqualFold(value, calendarMethod) {
+			return errors.New(
+				"Calendar METHOD must be " + calendarMethod + ", not " + value,
+			)
+		}
+	}
+	return nil
+}
+
 // CheckDomain ensures Message.From is from the expected domain.
 func CheckDomain(domain string) MessageValidatorFunc {
 	return func(_ *Message, _, addr string) (err error) {
@@ -119,11 +316,234 @@ func CheckDomain(domain string) MessageValidatorFunc {
 
 type MessageTemplate struct {
 	from       []byte
+	replyTo    []byte
 	subject    []byte
+	threading  []byte
+	headers    []byte
 	textBody   []byte
 	textFooter []byte
 	htmlBody   []byte
 	htmlFooter []byte
+	calendar   []byte
+	encode     QuotedPrintableEncoder
+
+	// subjectTemplate is the original Message.Subject if it contains templates
+	// to fill in for each Recipient. Otherwise it's empty, and EmitMessage
+	// emits the static subject header instead.
+	subjectTemplate string
+
+	// listHeaders contains the optional List-Help and List-Subscribe headers.
+	listHeaders []byte
+
+	// messageIdDomain and newMessageId produce the optional Message-ID
+	// header. See WithMessageIds.
+	messageIdDomain string
+	newMessageId    MessageIdFunc
+
+	// maxQpRatio and maxQpSize determine when to use base64 instead of
+	// quoted-printable encoding. See WithBase64Threshold.
+	maxQpRatio float64
+	maxQpSize  int
+
+	// textBase64 and htmlBase64 indicate that textBody and htmlBody aren't
+	// encoded yet. EmitMessage will base64 encode them along with their
+	// footers.
+	textBase64     bool
+	htmlBase64     bool
+	calendarBase64 bool
+
+	// foldHeaders indicates that EmitMessage should fold long header lines.
+	// See WithHeaderFolding.
+	foldHeaders bool
+
+	// headerOrder lists the names of headers EmitMessage should emit first.
+	// See WithHeaderOrder.
+	headerOrder []string
+
+	// contentHeader and the *PartHeader fields contain the MIME headers and
+	// multipart boundaries for the message content, which are the same for
+	// every Recipient. See precomputeContentHeaders.
+	contentHeader      []byte
+	textPartHeader     []byte
+	htmlPartHeader     []byte
+	calendarPartHeader []byte
+	multipartEnd       []byte
+}
+
+// MessageTemplateOption configures optional MessageTemplate behavior.
+type MessageTemplateOption func(mt *MessageTemplate)
+
+// WithQuotedPrintableEncoder replaces the default quoted-printable encoder.
+//
+// The default encoder is based on [quotedprintable.Writer]. Pass
+// WriteUrlSafeQuotedPrintable to avoid soft line breaks within URLs.
+func WithQuotedPrintableEncoder(
+	enc QuotedPrintableEncoder,
+) MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		mt.encode = enc
+	}
+}
+
+// WithListHeaders adds the List-Help and List-Subscribe headers from RFC 2369.
+//
+// Each header is emitted only if its URL is not empty. Some spam filters treat
+// messages with a complete set of list headers more favorably.
+//
+// - https://www.rfc-editor.org/rfc/rfc2369
+func WithListHeaders(helpUrl, subscribeUrl string) MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		b := &bytes.Buffer{}
+		writeHeader := func(name, url string) {
+			if url != "" {
+				b.WriteString(name + ": <" + url + ">")
+				b.Write(crlf)
+			}
+		}
+		writeHeader("List-Help", helpUrl)
+		writeHeader("List-Subscribe", subscribeUrl)
+		mt.listHeaders = b.Bytes()
+	}
+}
+
+// MessageIdFunc returns the UUID for the Message-ID of the message to r.
+type MessageIdFunc func(r *Recipient) uuid.UUID
+
+// RandomMessageId returns a new random UUID for every message.
+func RandomMessageId(_ *Recipient) uuid.UUID {
+	return uuid.New()
+}
+
+// DerivedMessageId returns a MessageIdFunc that derives each UUID from sendId
+// and the Recipient's Uid.
+//
+// Every message for the same sendId and Recipient will have the same
+// Message-ID, so the same logical send is reproducible, e.g., when retrying.
+func DerivedMessageId(sendId uuid.UUID) MessageIdFunc {
+	return func(r *Recipient) uuid.UUID {
+		return uuid.NewSHA1(sendId, r.Uid[:])
+	}
+}
+
+// WithMessageIds adds a "Message-ID: <uuid@domain>" header to each message.
+//
+// newId generates the UUID for each Recipient. A unique Message-ID helps
+// deliverability, and helps correlate bounces and complaints with the
+// original message.
+//
+// - https://www.rfc-editor.org/rfc/rfc5322#section-3.6.4
+func WithMessageIds(domain string, newId MessageIdFunc) MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		mt.messageIdDomain = domain
+		mt.newMessageId = newId
+	}
+}
+
+// WithBase64Threshold switches large or non-ASCII heavy bodies to base64.
+//
+// By default, every body is quoted-printable encoded, which can nearly triple
+// the size of text containing mostly non-ASCII characters. Base64 encoding
+// increases the size of any text by about 37%, regardless of its content.
+// This option helps keep large messages, e.g., HTML newsletters with embedded
+// data, under the SES message size limit.
+//
+// A body will use base64 encoding if its quoted-printable encoding would be
+// larger than its base64 encoding, and either:
+//
+//   - the quoted-printable encoding is more than maxQpRatio times the size of
+//     the original body, or
+//   - the quoted-printable encoding is larger than maxQpSize bytes.
+//
+// A value of zero for either maxQpRatio or maxQpSize disables that check.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/quotas.html
+func WithBase64Threshold(
+	maxQpRatio float64, maxQpSize int,
+) MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		mt.maxQpRatio = maxQpRatio
+		mt.maxQpSize = maxQpSize
+	}
+}
+
+// WithHeaderFolding folds header lines longer than 78 characters.
+//
+// EmitMessage will break each long header line at whitespace, starting each
+// continuation line with a single space, per RFC 5322 §2.2.3. Unfolding the
+// header restores its original value. Headers without whitespace in the right
+// places, e.g., a single long URL, may remain longer than 78 characters.
+//
+// - https://www.rfc-editor.org/rfc/rfc5322#section-2.1.1
+// - https://www.rfc-editor.org/rfc/rfc5322#section-2.2.3
+func WithHeaderFolding() MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		mt.foldHeaders = true
+	}
+}
+
+// RecommendedHeaderOrder follows the order of the header fields described in
+// RFC 5322 §3.6, followed by MIME-Version.
+//
+// - https://www.rfc-editor.org/rfc/rfc5322#section-3.6
+var RecommendedHeaderOrder = []string{
+	"Date",
+	"From",
+	"Sender",
+	"Reply-To",
+	"To",
+	"Cc",
+	"Bcc",
+	"Message-ID",
+	"In-Reply-To",
+	"References",
+	"Subject",
+	"MIME-Version",
+}
+
+// WithHeaderOrder emits the headers named by order first, in that order.
+//
+// Some strict receivers expect headers in a particular order, though RFC 5322
+// doesn't require one. Header names are case insensitive. Names of headers a
+// message doesn't contain are ignored. Headers not named by order follow in
+// their original order. Pass RecommendedHeaderOrder to use the RFC 5322 order.
+//
+// The MIME content headers, e.g., Content-Type, always follow all the others.
+func WithHeaderOrder(order ...string) MessageTemplateOption {
+	return func(mt *MessageTemplate) {
+		mt.headerOrder = order
+	}
+}
+
+// ProdMessageOptions contains the settings common to every message EListMan
+// sends.
+type ProdMessageOptions struct {
+	// DomainName is the domain of each Message-ID. See WithMessageIds.
+	DomainName string
+
+	// Base64MaxQpRatio and Base64MaxQpSize determine when a message body uses
+	// base64 instead of quoted-printable encoding. See WithBase64Threshold.
+	Base64MaxQpRatio float64
+	Base64MaxQpSize  int
+}
+
+// TemplateOptions returns the options common to every message template,
+// followed by opts.
+//
+// The URL safe quoted-printable encoder keeps the verification and unsubscribe
+// URLs intact for plain text email clients that don't reassemble soft line
+// breaks within links. Header folding keeps long subjects and other headers
+// within the line length recommended by RFC 5322, and the RFC 5322 header order
+// satisfies strict receivers that expect it.
+func (o *ProdMessageOptions) TemplateOptions(
+	opts ...MessageTemplateOption,
+) []MessageTemplateOption {
+	return append([]MessageTemplateOption{
+		WithQuotedPrintableEncoder(WriteUrlSafeQuotedPrintable),
+		WithHeaderFolding(),
+		WithHeaderOrder(RecommendedHeaderOrder...),
+		WithBase64Threshold(o.Base64MaxQpRatio, o.Base64MaxQpSize),
+		WithMessageIds(o.DomainName, RandomMessageId),
+	}, opts...)
 }
 
 func NewMessageTemplateFromJson(
@@ -136,7 +556,9 @@ func NewMessageTemplateFromJson(
 	return
 }
 
-func NewMessageTemplate(m *Message) *MessageTemplate {
+func NewMessageTemplate(
+	m *Message, opts ...MessageTemplateOption,
+) *MessageTemplate {
 	makeHeader := func(name, value string) []byte {
 		b := &bytes.Buffer{}
 		b.WriteString(name)
@@ -146,31 +568,136 @@ func NewMessageTemplate(m *Message) *MessageTemplate {
 		return b.Bytes()
 	}
 
+	var replyTo []byte
+	if m.ReplyTo != "" {
+		replyTo = makeHeader("Reply-To", m.ReplyTo)
+	}
+
+	threading := &bytes.Buffer{}
+	if m.InReplyTo != "" {
+		threading.Write(makeHeader("In-Reply-To", m.InReplyTo))
+	}
+	if len(m.References) != 0 {
+		// Fold the header to keep lines short, per RFC 5322 §2.2.3.
+		refs := strings.Join(m.References, "\r\n ")
+		threading.Write(makeHeader("References", refs))
+	}
+
+	htmlBody := htmlBodyWithPreheader(m)
+
+	headers := &bytes.Buffer{}
+	for _, h := range m.Headers {
+		value := mime.QEncoding.Encode("utf-8", h.Value)
+		headers.Write(makeHeader(h.Name, value))
+	}
+
 	mt := &MessageTemplate{
-		from:       makeHeader("From", m.From),
+		from:       makeHeader("From", fromHeaderValue(m)),
+		replyTo:    replyTo,
 		subject:    makeHeader("Subject", m.Subject),
+		threading:  threading.Bytes(),
+		headers:    headers.Bytes(),
 		textBody:   convertToCrlf(appendNewlineIfNeeded(m.TextBody)),
 		textFooter: convertToCrlf(m.TextFooter),
-		htmlBody:   convertToCrlf(appendNewlineIfNeeded(m.HtmlBody)),
+		htmlBody:   convertToCrlf(appendNewlineIfNeeded(htmlBody)),
 		htmlFooter: convertToCrlf(m.HtmlFooter),
+		encode:     writeQuotedPrintable,
+	}
+
+	if m.Calendar != "" {
+		mt.calendar = convertToCrlf(appendNewlineIfNeeded(m.Calendar))
 	}
 
-	tb := &bytes.Buffer{}
-	hb := &bytes.Buffer{}
+	if hasSubjectTemplate(m.Subject) {
+		mt.subjectTemplate = m.Subject
+	}
 
-	// bytest.Buffer never errors, so neither will the quotedprintable writer.
-	writeQuotedPrintable(tb, mt.textBody)
-	mt.textBody = tb.Bytes()
-	writeQuotedPrintable(hb, mt.htmlBody)
-	mt.htmlBody = hb.Bytes()
+	for _, opt := range opts {
+		opt(mt)
+	}
+
+	mt.textBody, mt.textBase64 = mt.encodeBody(mt.textBody)
+	mt.htmlBody, mt.htmlBase64 = mt.encodeBody(mt.htmlBody)
+	if len(mt.calendar) != 0 {
+		mt.calendar, mt.calendarBase64 = mt.encodeBody(mt.calendar)
+	}
+	mt.precomputeContentHeaders()
 	return mt
 }
 
+// preheaderPadding follows the Preheader text to fill out the preview, so
+// that email clients don't append the beginning of the HTML body to it.
+var preheaderPadding = strings.Repeat("&zwnj;&nbsp;", 90)
+
+const preheaderStyle = "display:none;max-height:0;overflow:hidden"
+
+var htmlBodyTag = regexp.MustCompile(`(?i)<body[^>]*>`)
+
+// htmlBodyWithPreheader returns m.HtmlBody with a hidden m.Preheader element
+// inserted just after the <body> tag, or at the beginning if there isn't one.
+//
+// It returns m.HtmlBody unchanged if either it or m.Preheader is empty.
+func htmlBodyWithPreheader(m *Message) string {
+	if m.Preheader == "" || m.HtmlBody == "" {
+		return m.HtmlBody
+	}
+
+	preheader := `<span style="` + preheaderStyle + `">` +
+		html.EscapeString(m.Preheader) + preheaderPadding + "</span>\n"
+	insertAt := 0
+	if loc := htmlBodyTag.FindStringIndex(m.HtmlBody); loc != nil {
+		insertAt = loc[1]
+	}
+	return m.HtmlBody[:insertAt] + preheader + m.HtmlBody[insertAt:]
+}
+
+// fromHeaderValue returns m.From, with its display name replaced by
+// m.FromName if present.
+//
+// mail.Address.String encodes a non-ASCII FromName per RFC 2047. If m.From
+// fails to parse, which Message.Validate would've reported, it returns m.From
+// unchanged.
+func fromHeaderValue(m *Message) string {
+	if m.FromName == "" {
+		return m.From
+	} else if addr, err := mail.ParseAddress(m.From); err != nil {
+		return m.From
+	} else {
+		return (&mail.Address{Name: m.FromName, Address: addr.Address}).String()
+	}
+}
+
+// encodeBody returns the quoted-printable encoding of body, unless it should
+// be base64 encoded instead. In that case, it returns body unchanged, and
+// useBase64 will be true.
+func (mt *MessageTemplate) encodeBody(body []byte) ([]byte, bool) {
+	qp := &bytes.Buffer{}
+
+	// bytes.Buffer never errors, so neither will the quotedprintable writer.
+	mt.encode(qp, body)
+
+	if mt.preferBase64(len(body), qp.Len()) {
+		return body, true
+	}
+	return qp.Bytes(), false
+}
+
+func (mt *MessageTemplate) preferBase64(rawLen, qpLen int) bool {
+	if rawLen == 0 || base64EncodedLen(rawLen) >= qpLen {
+		return false
+	}
+	ratio := float64(qpLen) / float64(rawLen)
+	return (mt.maxQpRatio != 0 && ratio > mt.maxQpRatio) ||
+		(mt.maxQpSize != 0 && qpLen > mt.maxQpSize)
+}
+
 var toHeaderPrefix = []byte("To: ")
 var mimeVersion = []byte("MIME-Version: 1.0\r\n")
 
+// appendNewlineIfNeeded leaves an empty s empty, so that a Message without an
+// HtmlBody produces a text only message, not one with an empty HTML part.
 func appendNewlineIfNeeded(s string) string {
-	if strings.HasSuffix(s, "\n") {
+	if s == "" || strings.HasSuffix(s, "\n") {
 		return s
 	}
 	return s + "\n"
@@ -187,116 +714,388 @@ func (mt *MessageTemplate) GenerateMessage(r *Recipient) []byte {
 func (mt *MessageTemplate) EmitMessage(b io.Writer, r *Recipient) error {
 	w := &writer{buf: b}
 
-	w.Write(mt.from)
-	w.Write(toHeaderPrefix)
-	w.WriteLine(r.Email)
-	w.Write(mt.subject)
-	r.EmitUnsubscribeHeaders(w)
-	w.Write(mimeVersion)
+	if mt.foldHeaders || len(mt.headerOrder) != 0 {
+		// bytes.Buffer never errors, so neither will emitHeaders.
+		headers := &bytes.Buffer{}
+		mt.emitHeaders(&writer{buf: headers}, r)
+		w.Write(mt.formatHeaders(headers.Bytes()))
+	} else {
+		mt.emitHeaders(w, r)
+	}
 
-	if len(mt.htmlBody) == 0 {
+	if len(mt.htmlBody) == 0 && len(mt.calendar) == 0 {
 		mt.emitTextOnly(w, r)
 	} else {
 		mt.emitMultipart(w, r)
 	}
 
-	if w.err != nil {
+	if w.Close() != nil {
 		w.err = fmt.Errorf("error emitting message to %s: %w", r.Email, w.err)
 	}
 	return w.err
 }
 
+func (mt *MessageTemplate) emitHeaders(w *writer, r *Recipient) {
+	w.Write(mt.from)
+	w.Write(mt.replyTo)
+	w.Write(toHeaderPrefix)
+	w.WriteLine(r.Email)
+	if mt.newMessageId != nil {
+		id := mt.newMessageId(r).String() + "@" + mt.messageIdDomain
+		w.WriteLine("Message-ID: <" + id + ">")
+	}
+	mt.emitSubject(w, r)
+	w.Write(mt.threading)
+	w.Write(mt.headers)
+	r.EmitUnsubscribeHeaders(w)
+	w.Write(mt.listHeaders)
+	w.Write(mimeVersion)
+}
+
+// formatHeaders applies the WithHeaderOrder and WithHeaderFolding options.
+func (mt *MessageTemplate) formatHeaders(headers []byte) []byte {
+	if len(mt.headerOrder) != 0 {
+		headers = orderHeaders(headers, mt.headerOrder)
+	}
+	if mt.foldHeaders {
+		headers = foldHeaderLines(headers)
+	}
+	return headers
+}
+
+// orderHeaders moves the headers named by order to the front of headers.
+//
+// Each header includes any of its continuation lines. All other headers retain
+// their original relative order.
+func orderHeaders(headers []byte, order []string) []byte {
+	fields := make([][]byte, 0, 16)
+
+	for _, line := range bytes.SplitAfter(headers, crlf) {
+		if len(line) == 0 {
+			continue
+		} else if n := len(fields); n != 0 && isContinuationLine(line) {
+			fields[n-1] = append(fields[n-1], line...)
+		} else {
+			fields = append(fields, line)
+		}
+	}
+
+	result := make([]byte, 0, len(headers))
+	emitted := make([]bool, len(fields))
+
+	for _, name := range order {
+		for i, field := range fields {
+			fieldName, _, _ := bytes.Cut(field, []byte(":"))
+			if !emitted[i] && strings.EqualFold(string(fieldName), name) {
+				result = append(result, field...)
+				emitted[i] = true
+			}
+		}
+	}
+	for i, field := range fields {
+		if !emitted[i] {
+			result = append(result, field...)
+		}
+	}
+	return result
+}
+
+func isContinuationLine(line []byte) bool {
+	return line[0] == ' ' || line[0] == '\t'
+}
+
+// maxHeaderLineLen is the recommended maximum header line length, excluding
+// the CRLF, from RFC 5322 §2.1.1.
+const maxHeaderLineLen = 78
+
+// foldHeaderLines folds every CRLF terminated line in headers that's longer
+// than maxHeaderLineLen.
+func foldHeaderLines(headers []byte) []byte {
+	lines := bytes.SplitAfter(headers, crlf)
+	result := make([]byte, 0, len(headers)+len(lines))
+
+	for _, line := range lines {
+		result = append(result, foldHeaderLine(line)...)
+	}
+	return result
+}
+
+// foldHeaderLine replaces the spaces in line with CRLF plus a space where
+// necessary to keep each resulting line within maxHeaderLineLen.
+//
+// It never folds before an empty word, which could produce a line containing
+// only whitespace. It also never folds directly after the header field name,
+// since a line containing only the field name is legal but unusual.
+func foldHeaderLine(line []byte) []byte {
+	content, hasCrlf := bytes.CutSuffix(line, crlf)
+	if len(content) <= maxHeaderLineLen {
+		return line
+	}
+
+	words := bytes.Split(content, []byte(" "))
+	result := make([]byte, 0, len(line)+2*len(words))
+	result = append(result, words[0]...)
+	lineLen := len(words[0])
+
+	for i, word := range words[1:] {
+		tooLong := lineLen+1+len(word) > maxHeaderLineLen
+		if tooLong && i != 0 && len(word) != 0 {
+			result = append(result, crlf...)
+			lineLen = 0
+		}
+		result = append(result, ' ')
+		result = append(result, word...)
+		lineLen += 1 + len(word)
+	}
+	if hasCrlf {
+		result = append(result, crlf...)
+	}
+	return result
+}
+
+var subjectHeaderPrefix = []byte("Subject: ")
+
+func (mt *MessageTemplate) emitSubject(w *writer, r *Recipient) {
+	if mt.subjectTemplate == "" {
+		w.Write(mt.subject)
+		return
+	}
+	w.Write(subjectHeaderPrefix)
+	w.WriteLine(r.FillInSubject(mt.subjectTemplate))
+}
+
+// ErrBareLineFeed indicates that EmitMessage would've emitted an LF not
+// preceded by a CR.
+//
+// RFC 5322 requires every line to end with CRLF, and SES may reject messages
+// that don't comply. convertToCrlf takes care of message content, so this
+// indicates a bug in header assembly or a header value that bypassed
+// Message.Validate.
+//
+// - https://www.rfc-editor.org/rfc/rfc5322#section-2.1
+const ErrBareLineFeed = types.SentinelError("bare LF in message")
+
+// writer records the first error from writing to buf, after which it discards
+// all further writes.
+//
+// It also refuses to write any bare LF, returning an error wrapping
+// ErrBareLineFeed. prev is the last byte written, and n is the number of bytes
+// written, so that it can check for, and report the position of, a bare LF
+// spanning separate writes.
 type writer struct {
-	buf io.Writer
-	err error
+	buf  io.Writer
+	err  error
+	prev byte
+	n    int
+}
+
+// flusher is implemented by buffered writers such as [bufio.Writer].
+type flusher interface {
+	Flush() error
+}
+
+// Close flushes the underlying io.Writer if it's buffered and returns the
+// first error from any Write or from the flush.
+//
+// Buffered writers may not report a failure to write the end of a message
+// until flushed, so checking only the errors from Write could miss a
+// truncated message. Close doesn't close the underlying io.Writer, which
+// remains the caller's responsibility.
+func (w *writer) Close() error {
+	if f, ok := w.buf.(flusher); ok && w.err == nil {
+		w.err = f.Flush()
+	}
+	return w.err
 }
 
 var crlf = []byte("\r\n")
 
 func (w *writer) WriteLine(s string) {
-	w.Write([]byte(s))
+	// io.WriteString avoids converting s to a []byte if w.buf implements
+	// io.StringWriter, as bytes.Buffer and bufio.Writer do.
+	if w.err == nil {
+		bareLf, last := scanLineFeeds(s, w.prev, strings.IndexByte)
+		if bareLf != -1 {
+			w.setBareLineFeedError(bareLf)
+		} else {
+			_, w.err = io.WriteString(w.buf, s)
+			w.prev, w.n = last, w.n+len(s)
+		}
+	}
 	w.Write(crlf)
 }
 
 func (w *writer) Write(b []byte) (n int, err error) {
+	n = len(b)
+
 	if w.err == nil {
-		n, err = w.buf.Write(b)
-		w.err = err
-	} else {
-		n = len(b)
+		bareLf, last := scanLineFeeds(b, w.prev, bytes.IndexByte)
+		if bareLf != -1 {
+			w.setBareLineFeedError(bareLf)
+		} else {
+			n, err = w.buf.Write(b)
+			w.err = err
+			w.prev, w.n = last, w.n+n
+		}
 	}
 	return
 }
 
-var contentTypeHeader = []byte("Content-Type: ")
+func (w *writer) setBareLineFeedError(offset int) {
+	w.err = fmt.Errorf("%w at byte %d", ErrBareLineFeed, w.n+offset)
+}
+
+// scanLineFeeds returns the index of the first LF in s not preceded by a CR,
+// or -1 if there isn't one, and the last byte of s.
+//
+// prev is the byte preceding s, which is returned as last if s is empty.
+// indexByte is strings.IndexByte or bytes.IndexByte, which are much faster
+// than checking every byte of s.
+func scanLineFeeds[S ~string | ~[]byte](
+	s S, prev byte, indexByte func(S, byte) int,
+) (bareLf int, last byte) {
+	if len(s) == 0 {
+		return -1, prev
+	}
+	for i := 0; i < len(s); i++ {
+		lf := indexByte(s[i:], '\n')
+		if lf == -1 {
+			break
+		} else if i += lf; i != 0 {
+			prev = s[i-1]
+		}
+		if prev != '\r' {
+			return i, prev
+		}
+	}
+	return -1, s[len(s)-1]
+}
+
 var charsetUtf8 = map[string]string{"charset": "utf-8"}
 var textContentType = mime.FormatMediaType("text/plain", charsetUtf8)
 var htmlContentType = mime.FormatMediaType("text/html", charsetUtf8)
+var calendarContentType = mime.FormatMediaType(
+	"text/calendar", map[string]string{
+		"charset": "utf-8", "method": calendarMethod,
+	},
+)
 var contentEncodingQuotedPrintable = []byte(
 	"Content-Transfer-Encoding: quoted-printable\r\n\r\n",
 )
+var contentEncodingBase64 = []byte(
+	"Content-Transfer-Encoding: base64\r\n\r\n",
+)
 
-func (mt *MessageTemplate) emitTextOnly(w *writer, sub *Recipient) {
-	w.Write(contentTypeHeader)
-	w.WriteLine(textContentType)
-	w.Write(contentEncodingQuotedPrintable)
-	w.Write(mt.textBody)
-	err := writeQuotedPrintable(w, sub.FillInUnsubscribeUrl(mt.textFooter))
-
-	if w.err == nil {
-		w.err = err
+// precomputeContentHeaders generates the MIME headers and multipart boundaries
+// of the message content once, so that EmitMessage only has to fill in the
+// unsubscribe URLs for each Recipient.
+//
+// Every message from the same MessageTemplate shares the same multipart
+// boundary. The output is otherwise identical to that of [multipart.Writer].
+// Generating the part headers for each message with multipart.Writer
+// accounted for most of the allocations of EmitMessage.
+func (mt *MessageTemplate) precomputeContentHeaders() {
+	if len(mt.htmlBody) == 0 && len(mt.calendar) == 0 {
+		mt.contentHeader = append(
+			[]byte("Content-Type: "+textContentType+"\r\n"),
+			contentEncoding(mt.textBase64)...,
+		)
+		return
 	}
-}
 
-func (mt *MessageTemplate) emitMultipart(w *writer, sub *Recipient) {
-	mpw := multipart.NewWriter(w)
+	boundary := multipart.NewWriter(io.Discard).Boundary()
 	contentType := mime.FormatMediaType(
-		"multipart/alternative",
-		map[string]string{"boundary": mpw.Boundary()},
+		"multipart/alternative", map[string]string{"boundary": boundary},
 	)
-	w.Write(contentTypeHeader)
-	w.WriteLine(contentType)
-	w.Write(crlf)
+	mt.contentHeader = []byte("Content-Type: " + contentType + "\r\n\r\n")
 
-	h := textproto.MIMEHeader{}
-	h.Add("Content-Transfer-Encoding", "quoted-printable")
+	partHeader := func(contentType string, useBase64 bool) []byte {
+		b := &bytes.Buffer{}
+		b.WriteString("\r\n--" + boundary + "\r\n")
 
-	tb := mt.textBody
-	tf := sub.FillInUnsubscribeUrl(mt.textFooter)
-	hb := mt.htmlBody
-	hf := sub.FillInUnsubscribeUrl(mt.htmlFooter)
+		// multipart.Writer sorts part headers by name.
+		b.Write(bytes.TrimSuffix(contentEncoding(useBase64), crlf))
+		b.WriteString("Content-Type: " + contentType + "\r\n\r\n")
+		return b.Bytes()
+	}
 
-	if err := emitPart(mpw, h, textContentType, tb, tf); err != nil {
-		w.err = err
-	} else if err = emitPart(mpw, h, htmlContentType, hb, hf); err != nil {
-		w.err = err
-	} else if err = mpw.Close(); err != nil {
+	// The first part has no leading CRLF.
+	mt.textPartHeader = partHeader(textContentType, mt.textBase64)[2:]
+	if len(mt.htmlBody) != 0 {
+		mt.htmlPartHeader = partHeader(htmlContentType, mt.htmlBase64)
+	}
+	if len(mt.calendar) != 0 {
+		mt.calendarPartHeader = partHeader(
+			calendarContentType, mt.calendarBase64,
+		)
+	}
+	mt.multipartEnd = []byte("\r\n--" + boundary + "--\r\n")
+}
+
+func contentEncoding(useBase64 bool) []byte {
+	if useBase64 {
+		return contentEncodingBase64
+	}
+	return contentEncodingQuotedPrintable
+}
+
+func (mt *MessageTemplate) emitTextOnly(w *writer, sub *Recipient) {
+	w.Write(mt.contentHeader)
+	footer := sub.FillInUnsubscribeUrl(mt.textFooter)
+	err := mt.writeBody(w, mt.textBody, footer, mt.textBase64)
+
+	if w.err == nil {
 		w.err = err
 	}
 }
 
-func emitPart(
-	w *multipart.Writer,
-	h textproto.MIMEHeader,
-	contentType string,
-	body, footer []byte,
+// writeBody writes the encoded body and footer of a message or message part.
+//
+// If useBase64 is false, body must already be quoted-printable encoded.
+func (mt *MessageTemplate) writeBody(
+	w io.Writer, body, footer []byte, useBase64 bool,
 ) error {
-	h.Set("Content-Type", contentType)
-	if pw, err := w.CreatePart(h); err != nil {
-		return err
-	} else if _, err = pw.Write(body); err != nil {
+	if useBase64 {
+		content := make([]byte, 0, len(body)+len(footer))
+		return writeBase64(w, append(append(content, body...), footer...))
+	} else if _, err := w.Write(body); err != nil {
 		return err
-	} else {
-		return writeQuotedPrintable(pw, footer)
 	}
+	return mt.encode(w, footer)
 }
 
-func writeQuotedPrintable(w io.Writer, msg []byte) error {
-	qpw := quotedprintable.NewWriter(w)
-	if _, err := qpw.Write(msg); err != nil {
-		return err
+func (mt *MessageTemplate) emitMultipart(w *writer, sub *Recipient) {
+	w.Write(mt.contentHeader)
+
+	tf := sub.FillInUnsubscribeUrl(mt.textFooter)
+	hf := sub.FillInUnsubscribeUrl(mt.htmlFooter)
+
+	// Per RFC 2046 §5.1.4, the last part is the one recipients most prefer,
+	// so the calendar part, if present, follows the text and HTML parts. This
+	// also matches the structure of invitations from popular calendar apps.
+	//
+	// - https://www.rfc-editor.org/rfc/rfc2046#section-5.1.4
+	mt.emitPart(w, mt.textPartHeader, mt.textBody, tf, mt.textBase64)
+	mt.emitPart(w, mt.htmlPartHeader, mt.htmlBody, hf, mt.htmlBase64)
+	mt.emitPart(
+		w, mt.calendarPartHeader, mt.calendar, nil, mt.calendarBase64,
+	)
+	w.Write(mt.multipartEnd)
+}
+
+// emitPart writes a part of a multipart message, unless body is empty.
+//
+// header contains the part's boundary delimiter and MIME headers.
+func (mt *MessageTemplate) emitPart(
+	w *writer, header, body, footer []byte, useBase64 bool,
+) {
+	if len(body) == 0 {
+		return
+	}
+	w.Write(header)
+	if err := mt.writeBody(w, body, footer, useBase64); w.err == nil {
+		w.err = err
 	}
-	return qpw.Close()
 }
 
 // Per 'man ascii': 0x0d == "\r", 0x0a == "\n"
@@ -309,7 +1108,9 @@ func convertToCrlf(s string) []byte {
 	n := 0
 	emitCr := true
 
-	for i := range s {
+	// Iterate over bytes, not runes, to copy every byte of multibyte UTF-8
+	// characters.
+	for i := 0; i < len(s); i++ {
 		c := s[i]
 
 		switch c {
@@ -3,10 +3,14 @@
 package email
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/mail"
 	"net/textproto"
@@ -80,6 +84,94 @@ func TestWriter(t *testing.T) {
 		assert.Equal(t, sb.String(), msg+"\r\n")
 	})
 
+	t.Run("CloseSucceedsForUnbufferedWriter", func(t *testing.T) {
+		sb, w := setup()
+
+		w.WriteLine("Hello, World!")
+
+		assert.NilError(t, w.Close())
+		assert.Equal(t, "Hello, World!\r\n", sb.String())
+	})
+
+	t.Run("CloseFlushesBufferedWriter", func(t *testing.T) {
+		sb, w := setup()
+		w.buf = bufio.NewWriter(sb)
+
+		w.WriteLine("Hello, World!")
+		assert.Equal(t, "", sb.String())
+
+		assert.NilError(t, w.Close())
+		assert.Equal(t, "Hello, World!\r\n", sb.String())
+	})
+
+	t.Run("CloseReturnsFlushError", func(t *testing.T) {
+		sb, w := setup()
+		ew := &tu.ErrWriter{
+			Buf: sb, ErrorOn: "World", Err: errors.New("flush error"),
+		}
+		w.buf = bufio.NewWriter(ew)
+
+		w.WriteLine("Hello, World!")
+		assert.NilError(t, w.err)
+
+		assert.Error(t, w.Close(), "flush error")
+	})
+
+	t.Run("CloseReturnsEarlierWriteErrorWithoutFlushing", func(t *testing.T) {
+		sb, w := setup()
+		w.err = errors.New("earlier write error")
+		bw := bufio.NewWriter(sb)
+		bw.WriteString("unflushed")
+		w.buf = bw
+
+		assert.Error(t, w.Close(), "earlier write error")
+		assert.Equal(t, "", sb.String())
+	})
+
+	t.Run("WriteRefusesBareLineFeed", func(t *testing.T) {
+		sb, w := setup()
+
+		w.Write([]byte("foo\r\n"))
+		n, err := w.Write([]byte("bar\nbaz"))
+
+		assert.NilError(t, err)
+		assert.Equal(t, len("bar\nbaz"), n)
+		assert.Equal(t, "foo\r\n", sb.String())
+		assert.Assert(t, tu.ErrorIs(w.err, ErrBareLineFeed))
+		assert.ErrorContains(t, w.err, "bare LF in message at byte 8")
+	})
+
+	t.Run("WriteLineRefusesBareLineFeed", func(t *testing.T) {
+		sb, w := setup()
+
+		w.WriteLine("Subject: foo\nBcc: bar@example.com")
+
+		assert.Equal(t, "", sb.String())
+		assert.Assert(t, tu.ErrorIs(w.err, ErrBareLineFeed))
+		assert.ErrorContains(t, w.err, "bare LF in message at byte 12")
+	})
+
+	t.Run("RefusesLeadingLineFeedAfterPreviousWrite", func(t *testing.T) {
+		sb, w := setup()
+
+		w.Write([]byte("foo"))
+		w.Write([]byte("\nbar"))
+
+		assert.Equal(t, "foo", sb.String())
+		assert.ErrorContains(t, w.err, "bare LF in message at byte 3")
+	})
+
+	t.Run("AllowsCrlfSpanningWrites", func(t *testing.T) {
+		sb, w := setup()
+
+		w.Write([]byte("foo\r"))
+		w.Write([]byte{})
+		w.Write([]byte("\nbar\r\n"))
+
+		assert.NilError(t, w.err)
+		assert.Equal(t, "foo\r\nbar\r\n", sb.String())
+	})
+
 	t.Run("ReturnsInputLenAfterErrToAvoidIoErrShortWrite", func(t *testing.T) {
 		// From: https://pkg.go.dev/io#pkg-variables
 		//
@@ -126,6 +218,10 @@ func TestConvertToCrlf(t *testing.T) {
 		checkCrlfOutput(t, "foo\rbar\nbaz", "foo\rbar\r\nbaz")
 	})
 
+	t.Run("PreservesMultibyteCharacters", func(t *testing.T) {
+		checkCrlfOutput(t, "Café\n€5\n", "Café\r\n€5\r\n")
+	})
+
 	t.Run("TrimsResultToExactCapacity", func(t *testing.T) {
 		result := convertToCrlf("foo\nbar\nbaz")
 
@@ -133,54 +229,6 @@ func TestConvertToCrlf(t *testing.T) {
 	})
 }
 
-func TestWriteQuotedPrintable(t *testing.T) {
-	setup := func() (*strings.Builder, *tu.ErrWriter) {
-		sb := &strings.Builder{}
-		return sb, &tu.ErrWriter{Buf: sb}
-	}
-
-	t.Run("Succeeds", func(t *testing.T) {
-		sb, _ := setup()
-		msg := "This message is longer than 76 chars so we can see " +
-			"the quoted-printable encoding kick in.\r\n" +
-			"\r\n" +
-			"It also contains <a href=\"https://foo.com/\">a hyperlink</a>, " +
-			"in which the equals sign will be encoded."
-
-		err := writeQuotedPrintable(sb, []byte(msg))
-
-		assert.NilError(t, err)
-		expected := "This message is longer than 76 chars so we can see " +
-			"the quoted-printable enc=\r\n" +
-			"oding kick in.\r\n" +
-			"\r\n" +
-			`It also contains <a href=3D"https://foo.com/">a hyperlink</a>, ` +
-			"in which the=\r\n" +
-			" equals sign will be encoded."
-		actual := sb.String()
-		assert.Equal(t, expected, actual)
-	})
-
-	t.Run("ReturnsWriteError", func(t *testing.T) {
-		_, ew := setup()
-		msg := "This message will trigger an artificial Write error " +
-			"when the first 76 characters are flushed."
-		ew.ErrorOn = "trigger an artificial Write error"
-		ew.Err = errors.New("Write error")
-
-		assert.Error(t, writeQuotedPrintable(ew, []byte(msg)), "Write error")
-	})
-
-	t.Run("ReturnsCloseError", func(t *testing.T) {
-		_, ew := setup()
-		msg := "Close will fail when it calls flush on this short message."
-		ew.ErrorOn = "Close will fail"
-		ew.Err = errors.New("Close error")
-
-		assert.Error(t, writeQuotedPrintable(ew, []byte(msg)), "Close error")
-	})
-}
-
 var testMessage *Message = &Message{
 	From:    "EListMan@foo.com",
 	Subject: "This is a test",
@@ -206,7 +254,7 @@ var testMessage *Message = &Message{
 		"</body></html>",
 }
 
-var testTemplate *MessageTemplate = &MessageTemplate{
+var testTemplate *MessageTemplate = newTestTemplate(&MessageTemplate{
 	from:    []byte("From: EListMan@foo.com\r\n"),
 	subject: []byte("Subject: This is a test\r\n"),
 
@@ -233,8 +281,33 @@ var testTemplate *MessageTemplate = &MessageTemplate{
 		"<p>This footer is over 76 characters wide, " +
 		"but will be quoted-printable encoded by EmitMessage.</p>\r\n" +
 		"</body></html>"),
+	encode: writeQuotedPrintable,
+})
+
+func newTestTemplate(mt *MessageTemplate) *MessageTemplate {
+	mt.precomputeContentHeaders()
+	return mt
 }
 
+// newTextOnlyTemplate returns a copy of mt without its HTML part.
+func newTextOnlyTemplate(mt *MessageTemplate) *MessageTemplate {
+	textOnly := *mt
+	textOnly.htmlBody = []byte{}
+	return newTestTemplate(&textOnly)
+}
+
+const testCalendar = "BEGIN:VCALENDAR\n" +
+	"VERSION:2.0\n" +
+	"PRODID:-//EListMan//Test//EN\n" +
+	"METHOD:PUBLISH\n" +
+	"BEGIN:VEVENT\n" +
+	"UID:20230918T124500Z-elistman@foo.com\n" +
+	"DTSTAMP:20230918T124500Z\n" +
+	"DTSTART:20231018T170000Z\n" +
+	"SUMMARY:EListMan launch party\n" +
+	"END:VEVENT\n" +
+	"END:VCALENDAR\n"
+
 func TestMessageValidate(t *testing.T) {
 	newTestMessage := func() *Message {
 		return &Message{
@@ -275,6 +348,62 @@ func TestMessageValidate(t *testing.T) {
 		assert.Error(t, msg.Validate(), expectedErrMsg)
 	})
 
+	t.Run("SucceedsWithFromNameAndReplyTo", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.FromName = "Foo Bar"
+		msg.ReplyTo = "Foo Bar <replies@foo.com>"
+
+		assert.NilError(t, msg.Validate())
+	})
+
+	t.Run("FailsIfReplyToAddressFailsToParse", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.ReplyTo = "not an address"
+
+		const expectedErrMsg = "message failed validation: " +
+			"failed to parse ReplyTo address \"not an address\": " +
+			"mail: no angle-addr"
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
+
+	t.Run("SucceedsWithCustomHeaders", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.Headers = []Header{
+			{Name: "X-Campaign-Id", Value: "2023-05-spring"},
+			{Name: "X-List-Id", Value: ""},
+		}
+
+		assert.NilError(t, msg.Validate())
+	})
+
+	t.Run("FailsIfCustomHeadersInvalid", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.Headers = []Header{
+			{Name: "X-Campaign-Id", Value: "spring\r\nBcc: victim@foo.com"},
+			{Name: "X-List-Id", Value: "list\nBcc: victim@foo.com"},
+			{Name: "X Campaign", Value: "spring"},
+			{Name: "X-Campaign:Id", Value: "spring"},
+			{Name: "", Value: "spring"},
+			{Name: "content-type", Value: "text/html"},
+			{Name: "x-campaign-id", Value: "summer"},
+		}
+
+		expectedErrMsg := strings.Join(
+			[]string{
+				"message failed validation: " +
+					"Headers[0]: X-Campaign-Id header value contains CR or LF",
+				"Headers[1]: X-List-Id header value contains CR or LF",
+				`Headers[2]: invalid header name: "X Campaign"`,
+				`Headers[3]: invalid header name: "X-Campaign:Id"`,
+				`Headers[4]: invalid header name: ""`,
+				"Headers[5]: content-type header is managed by EListMan",
+				"Headers[6]: duplicate x-campaign-id header",
+			},
+			"\n",
+		)
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
+
 	t.Run("FailsIfHtmlBodyWithoutHtmlFooter", func(t *testing.T) {
 		msg := newTestMessage()
 		msg.HtmlFooter = ""
@@ -300,6 +429,17 @@ func TestMessageValidate(t *testing.T) {
 		assert.Error(t, msg.Validate(), expectedErrMsg)
 	})
 
+	t.Run("FailsIfPreheaderWithoutHtmlBody", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.HtmlBody = ""
+		msg.HtmlFooter = ""
+		msg.Preheader = "Preview text"
+		expectedErrMsg := "message failed validation: " +
+			"Preheader present, but HtmlBody missing"
+
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
+
 	t.Run("FailsIfHtmlFooterWithoutHtmlBody", func(t *testing.T) {
 		msg := newTestMessage()
 		msg.HtmlBody = ""
@@ -325,6 +465,62 @@ func TestMessageValidate(t *testing.T) {
 
 		assert.Error(t, msg.Validate(okFunc, errFunc), expectedErrorMsg)
 	})
+
+	t.Run("SucceedsWithThreadingMessageIds", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.InReplyTo = "<0123456789@email.amazonses.com>"
+		msg.References = []string{
+			"<0123456789@email.amazonses.com>", "<foo.bar@[127.0.0.1]>",
+		}
+
+		assert.NilError(t, msg.Validate())
+	})
+
+	t.Run("SucceedsWithCalendar", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.Calendar = testCalendar
+
+		assert.NilError(t, msg.Validate())
+	})
+
+	t.Run("FailsIfCalendarMissingVcalendarWrapper", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.Calendar = strings.TrimPrefix(testCalendar, "BEGIN:VCALENDAR\n")
+
+		const expectedErrMsg = "message failed validation: " +
+			"Calendar must begin with BEGIN:VCALENDAR " +
+			"and end with END:VCALENDAR"
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
+
+	t.Run("FailsIfCalendarMethodIsNotPublish", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.Calendar = strings.Replace(
+			testCalendar, "METHOD:PUBLISH", "METHOD:REQUEST", 1,
+		)
+
+		const expectedErrMsg = "message failed validation: " +
+			"Calendar METHOD must be PUBLISH, not REQUEST"
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
+
+	t.Run("FailsIfThreadingHeadersAreNotMessageIds", func(t *testing.T) {
+		msg := newTestMessage()
+		msg.InReplyTo = "0123456789@email.amazonses.com"
+		msg.References = []string{"<foo bar@baz>", "<foo@bar@baz>", "<>"}
+
+		expectedErrMsg := strings.Join(
+			[]string{
+				"message failed validation: InReplyTo is not a valid " +
+					"message ID: 0123456789@email.amazonses.com",
+				"References contains invalid message ID: <foo bar@baz>",
+				"References contains invalid message ID: <foo@bar@baz>",
+				"References contains invalid message ID: <>",
+			},
+			"\n",
+		)
+		assert.Error(t, msg.Validate(), expectedErrMsg)
+	})
 }
 
 func TestCheckDomain(t *testing.T) {
@@ -350,6 +546,9 @@ func byteStringsEqual(t *testing.T, expected, actual []byte) {
 	assert.Check(t, is.Equal(string(expected), string(actual)))
 }
 
+// nonAsciiLine nearly triples in size when quoted-printable encoded.
+const nonAsciiLine = "日本語のテキスト。\n"
+
 func TestNewMessageTemplate(t *testing.T) {
 	assertMessageTemplatesEqual := func(
 		t *testing.T, expected, actual *MessageTemplate,
@@ -357,7 +556,10 @@ func TestNewMessageTemplate(t *testing.T) {
 		t.Helper()
 
 		byteStringsEqual(t, expected.from, actual.from)
+		byteStringsEqual(t, expected.replyTo, actual.replyTo)
 		byteStringsEqual(t, expected.subject, actual.subject)
+		byteStringsEqual(t, expected.threading, actual.threading)
+		byteStringsEqual(t, expected.headers, actual.headers)
 		byteStringsEqual(t, expected.textBody, actual.textBody)
 		byteStringsEqual(t, expected.textFooter, actual.textFooter)
 		byteStringsEqual(t, expected.htmlBody, actual.htmlBody)
@@ -382,6 +584,294 @@ func TestNewMessageTemplate(t *testing.T) {
 
 		assertMessageTemplatesEqual(t, testTemplate, mt)
 	})
+
+	t.Run("LeavesHtmlBodyEmptyIfMissing", func(t *testing.T) {
+		msg := *testMessage
+		msg.HtmlBody = ""
+		msg.HtmlFooter = ""
+
+		mt := NewMessageTemplate(&msg)
+
+		assert.Equal(t, 0, len(mt.htmlBody))
+		assert.Assert(t, is.Contains(
+			string(mt.GenerateMessage(ExampleRecipient)),
+			"Content-Type: text/plain; charset=utf-8\r\n",
+		))
+		assert.Assert(t, mt.htmlPartHeader == nil)
+	})
+
+	t.Run("AddsFromNameIfPresent", func(t *testing.T) {
+		msg := *testMessage
+		msg.From = "Old Name <EListMan@foo.com>"
+		msg.FromName = "Foo Mailing List"
+
+		mt := NewMessageTemplate(&msg)
+
+		const expected = "From: \"Foo Mailing List\" <EListMan@foo.com>\r\n"
+		assert.Equal(t, expected, string(mt.from))
+	})
+
+	t.Run("EncodesNonAsciiFromName", func(t *testing.T) {
+		msg := *testMessage
+		msg.FromName = "Liste de diffusion de François"
+
+		mt := NewMessageTemplate(&msg)
+
+		const encodedName = "=?utf-8?q?Liste_de_diffusion_de_Fran=C3=A7ois?="
+		const expected = "From: " + encodedName + " <EListMan@foo.com>\r\n"
+		assert.Equal(t, expected, string(mt.from))
+		addr, err := mail.ParseAddress(encodedName + " <EListMan@foo.com>")
+		assert.NilError(t, err)
+		assert.Equal(t, msg.FromName, addr.Name)
+	})
+
+	t.Run("AddsReplyToOnlyIfPresent", func(t *testing.T) {
+		msg := *testMessage
+		msg.ReplyTo = "replies@foo.com"
+		r := newTestRecipient()
+
+		withReplyTo := string(NewMessageTemplate(&msg).GenerateMessage(r))
+		without := string(NewMessageTemplate(testMessage).GenerateMessage(r))
+
+		const expected = "From: EListMan@foo.com\r\n" +
+			"Reply-To: replies@foo.com\r\n" +
+			"To: subscriber@foo.com\r\n"
+		assert.Assert(t, is.Contains(withReplyTo, expected))
+		assert.Assert(t, !strings.Contains(without, "Reply-To:"))
+	})
+
+	t.Run("AddsThreadingHeadersIfPresent", func(t *testing.T) {
+		msg := *testMessage
+		msg.InReplyTo = "<bar@foo.com>"
+		msg.References = []string{"<foo@foo.com>", "<bar@foo.com>"}
+
+		mt := NewMessageTemplate(&msg)
+
+		const expected = "In-Reply-To: <bar@foo.com>\r\n" +
+			"References: <foo@foo.com>\r\n <bar@foo.com>\r\n"
+		assert.Equal(t, expected, string(mt.threading))
+	})
+
+	t.Run("AddsCustomHeadersInOrder", func(t *testing.T) {
+		msg := *testMessage
+		msg.Headers = []Header{
+			{Name: "X-List-Id", Value: "foo-news"},
+			{Name: "X-Campaign-Id", Value: "Frühling"},
+		}
+
+		mt := NewMessageTemplate(&msg)
+
+		const expected = "X-List-Id: foo-news\r\n" +
+			"X-Campaign-Id: =?utf-8?q?Fr=C3=BChling?=\r\n"
+		assert.Equal(t, expected, string(mt.headers))
+	})
+
+	t.Run("CustomHeadersSurviveReadMessage", func(t *testing.T) {
+		msg := *testMessage
+		msg.Headers = []Header{
+			{Name: "X-Campaign-Id", Value: "2023-05-spring"},
+			{Name: "X-List-Id", Value: "Frühling <news.foo.com>"},
+		}
+		assert.NilError(t, msg.Validate())
+		mt := NewMessageTemplate(&msg)
+
+		generated := mt.GenerateMessage(newTestRecipient())
+		parsed, err := mail.ReadMessage(bytes.NewReader(generated))
+
+		assert.NilError(t, err)
+		assert.Equal(t, "2023-05-spring", parsed.Header.Get("X-Campaign-Id"))
+		listId, err := (&mime.WordDecoder{}).DecodeHeader(
+			parsed.Header.Get("X-List-Id"),
+		)
+		assert.NilError(t, err)
+		assert.Equal(t, "Frühling <news.foo.com>", listId)
+		assert.Equal(t, "EListMan@foo.com", parsed.Header.Get("From"))
+	})
+
+	t.Run("AddsListHeadersIfConfigured", func(t *testing.T) {
+		opt := WithListHeaders(
+			"https://foo.com/help", "https://foo.com/subscribe",
+		)
+
+		mt := NewMessageTemplate(testMessage, opt)
+
+		const expected = "List-Help: <https://foo.com/help>\r\n" +
+			"List-Subscribe: <https://foo.com/subscribe>\r\n"
+		assert.Equal(t, expected, string(mt.listHeaders))
+	})
+
+	t.Run("AddsOnlyListHeadersWithUrls", func(t *testing.T) {
+		opt := WithListHeaders("", "https://foo.com/subscribe")
+
+		mt := NewMessageTemplate(testMessage, opt)
+
+		const expected = "List-Subscribe: <https://foo.com/subscribe>\r\n"
+		assert.Equal(t, expected, string(mt.listHeaders))
+	})
+
+	t.Run("SetsSubjectTemplateOnlyIfNeeded", func(t *testing.T) {
+		msg := *testMessage
+		msg.Subject = EmailUsernameTemplate + ", your weekly digest"
+
+		assert.Equal(t, "", NewMessageTemplate(testMessage).subjectTemplate)
+		assert.Equal(t, msg.Subject, NewMessageTemplate(&msg).subjectTemplate)
+	})
+
+	t.Run("Base64Threshold", func(t *testing.T) {
+		nonAsciiMsg := *testMessage
+		nonAsciiMsg.TextBody = strings.Repeat(nonAsciiLine, 200)
+
+		t.Run("SwitchesLargeNonAsciiBodyToBase64", func(t *testing.T) {
+			mt := NewMessageTemplate(&nonAsciiMsg, WithBase64Threshold(1.5, 0))
+
+			assert.Assert(t, mt.textBase64)
+			expected := convertToCrlf(nonAsciiMsg.TextBody)
+			byteStringsEqual(t, expected, mt.textBody)
+			assert.Assert(t, !mt.htmlBase64)
+			byteStringsEqual(t, testTemplate.htmlBody, mt.htmlBody)
+		})
+
+		t.Run("SwitchesToBase64IfQpSizeExceeded", func(t *testing.T) {
+			mt := NewMessageTemplate(&nonAsciiMsg, WithBase64Threshold(0, 1000))
+
+			assert.Assert(t, mt.textBase64)
+		})
+
+		t.Run("KeepsSmallAsciiBodyQuotedPrintable", func(t *testing.T) {
+			mt := NewMessageTemplate(testMessage, WithBase64Threshold(1.5, 100))
+
+			assert.Assert(t, !mt.textBase64)
+			assert.Assert(t, !mt.htmlBase64)
+			assertMessageTemplatesEqual(t, testTemplate, mt)
+		})
+
+		t.Run("KeepsQuotedPrintableByDefault", func(t *testing.T) {
+			mt := NewMessageTemplate(&nonAsciiMsg)
+
+			assert.Assert(t, !mt.textBase64)
+		})
+	})
+
+	t.Run("UsesQuotedPrintableEncoderOption", func(t *testing.T) {
+		encoded := []string{}
+		encode := func(w io.Writer, msg []byte) error {
+			encoded = append(encoded, string(msg))
+			return WriteUrlSafeQuotedPrintable(w, msg)
+		}
+
+		opt := WithQuotedPrintableEncoder(encode)
+		mt := NewMessageTemplate(testMessage, opt)
+		err := mt.EmitMessage(&strings.Builder{}, newTestRecipient())
+
+		assert.NilError(t, err)
+		assert.Equal(t, 4, len(encoded), "bodies and footers encoded")
+		assert.Assert(t, is.Contains(encoded[0], "This is only a test."))
+		assert.Assert(t, is.Contains(encoded[2], "Unsubscribe: https://"))
+	})
+}
+
+func TestHtmlBodyWithPreheader(t *testing.T) {
+	const htmlBody = "<!DOCTYPE html><html><head><title>Hi</title></head>" +
+		"<BODY class=\"main\"><p>First real content</p></BODY></html>"
+
+	t.Run("ReturnsHtmlBodyUnchangedIfPreheaderEmpty", func(t *testing.T) {
+		msg := &Message{HtmlBody: htmlBody}
+
+		assert.Equal(t, htmlBody, htmlBodyWithPreheader(msg))
+		byteStringsEqual(
+			t,
+			NewMessageTemplate(testMessage).htmlBody,
+			testTemplate.htmlBody,
+		)
+	})
+
+	t.Run("InsertsEscapedHiddenPreheaderAfterBodyTag", func(t *testing.T) {
+		msg := &Message{
+			HtmlBody: htmlBody, Preheader: `Tom & Jerry's <"big"> news`,
+		}
+
+		result := htmlBodyWithPreheader(msg)
+
+		const prefix = "<!DOCTYPE html><html><head><title>Hi</title></head>" +
+			"<BODY class=\"main\"><span style=\"" +
+			"display:none;max-height:0;overflow:hidden\">" +
+			"Tom &amp; Jerry&#39;s &lt;&#34;big&#34;&gt; news&zwnj;&nbsp;"
+		assert.Assert(t, strings.HasPrefix(result, prefix), result)
+		spanEnd := strings.Index(result, "</span>")
+		contentStart := strings.Index(result, "<p>First real content</p>")
+		assert.Assert(t, spanEnd != -1 && spanEnd < contentStart)
+		assert.Equal(
+			t, 90, strings.Count(result[:spanEnd], "&zwnj;&nbsp;"),
+		)
+	})
+
+	t.Run("PrependsPreheaderIfNoBodyTag", func(t *testing.T) {
+		msg := &Message{HtmlBody: "<p>Hello</p>", Preheader: "Preview"}
+
+		result := htmlBodyWithPreheader(msg)
+
+		assert.Assert(t, strings.HasPrefix(result, "<span style="), result)
+		assert.Assert(t, strings.HasSuffix(result, "</span>\n<p>Hello</p>"))
+	})
+
+	t.Run("NewMessageTemplateAddsPreheader", func(t *testing.T) {
+		msg := *testMessage
+		msg.Preheader = "Preview & more"
+
+		mt := NewMessageTemplate(&msg)
+
+		// htmlBody is quoted-printable encoded, hence "=3D" instead of "=".
+		const expected = "<body><span style=3D\"display:none;"
+		assert.Assert(t, is.Contains(string(mt.htmlBody), expected))
+	})
+}
+
+func TestWithMessageIds(t *testing.T) {
+	const testId = "01234567-89ab-cdef-0123-456789abcdef"
+	fixedId := func(*Recipient) uuid.UUID { return uuid.MustParse(testId) }
+
+	parseHeaders := func(t *testing.T, mt *MessageTemplate) mail.Header {
+		t.Helper()
+		generated := mt.GenerateMessage(newTestRecipient())
+		msg, err := mail.ReadMessage(bytes.NewReader(generated))
+		assert.NilError(t, err)
+		return msg.Header
+	}
+
+	t.Run("EmitsMessageIdWithConfiguredDomain", func(t *testing.T) {
+		mt := NewMessageTemplate(
+			testMessage, WithMessageIds("mail.foo.com", fixedId),
+		)
+
+		messageId := parseHeaders(t, mt).Get("Message-ID")
+
+		assert.Equal(t, "<"+testId+"@mail.foo.com>", messageId)
+		assert.Assert(t, isMessageId(messageId), "RFC 5322 msg-id form")
+	})
+
+	t.Run("OmitsMessageIdByDefault", func(t *testing.T) {
+		mt := NewMessageTemplate(testMessage)
+
+		assert.Equal(t, "", parseHeaders(t, mt).Get("Message-ID"))
+	})
+
+	t.Run("RandomMessageIdDiffersForEachMessage", func(t *testing.T) {
+		r := newTestRecipient()
+
+		assert.Assert(t, RandomMessageId(r) != RandomMessageId(r))
+	})
+
+	t.Run("DerivedMessageIdIsReproducible", func(t *testing.T) {
+		sendId := uuid.MustParse(testId)
+		newId := DerivedMessageId(sendId)
+		r := newTestRecipient()
+		other := newTestRecipient()
+		other.Uid = uuid.MustParse("55555555-6666-7777-8888-999999999999")
+
+		assert.Equal(t, newId(r), DerivedMessageId(sendId)(r))
+		assert.Assert(t, newId(r) != newId(other))
+		assert.Assert(t, newId(r) != DerivedMessageId(uuid.New())(r))
+	})
 }
 
 var testRecipient *Recipient = &Recipient{
@@ -427,7 +917,7 @@ func TestEmitTextOnly(t *testing.T) {
 	t.Run("Succeeds", func(t *testing.T) {
 		sb, w, _, sub := setup()
 
-		testTemplate.emitTextOnly(w, sub)
+		newTextOnlyTemplate(testTemplate).emitTextOnly(w, sub)
 
 		assert.NilError(t, w.err)
 		assert.Equal(t, textOnlyContent, sb.String())
@@ -441,7 +931,7 @@ func TestEmitTextOnly(t *testing.T) {
 		ew.ErrorOn = "Unsubscribe: "
 		ew.Err = errors.New("writeQuotedPrintable error")
 
-		testTemplate.emitTextOnly(w, sub)
+		newTextOnlyTemplate(testTemplate).emitTextOnly(w, sub)
 
 		assert.Error(t, w.err, "writeQuotedPrintable error")
 	})
@@ -454,70 +944,66 @@ var textPart string = "Content-Transfer-Encoding: quoted-printable\r\n" +
 	string(encodedTextFooter)
 
 func TestEmitPart(t *testing.T) {
-	setup := func() (
-		*strings.Builder,
-		textproto.MIMEHeader,
-		*multipart.Writer,
-	) {
+	setup := func() (*strings.Builder, *writer) {
 		sb := &strings.Builder{}
-		w := &writer{buf: sb}
-		h := textproto.MIMEHeader{}
-		h.Add("Content-Transfer-Encoding", "quoted-printable")
-		return sb, h, multipart.NewWriter(w)
+		return sb, &writer{buf: sb}
 	}
 
-	setupErrWriter := func(errorMsg string) (
-		*tu.ErrWriter, textproto.MIMEHeader, *multipart.Writer,
-	) {
-		sb, h, _ := setup()
+	setupErrWriter := func(errorMsg string) (*tu.ErrWriter, *writer) {
+		sb, w := setup()
 		ew := &tu.ErrWriter{Buf: sb, Err: errors.New(errorMsg)}
-		return ew, h, multipart.NewWriter(ew)
+		w.buf = ew
+		return ew, w
 	}
 
-	contentType := textContentType
+	header := testTemplate.textPartHeader
 	body := testTemplate.textBody
 	footer := instantiatedTextFooter
 
 	t.Run("Succeeds", func(t *testing.T) {
-		sb, h, mpw := setup()
+		sb, w := setup()
 
-		err := emitPart(mpw, h, contentType, body, footer)
+		testTemplate.emitPart(w, header, body, footer, false)
 
-		assert.NilError(t, err)
-		boundaryMarker := "--" + mpw.Boundary() + "\r\n"
-		assert.Equal(t, boundaryMarker+string(textPart), sb.String())
+		assert.NilError(t, w.err)
+		assert.Equal(t, string(header)+string(body)+string(encodedTextFooter),
+			sb.String())
+	})
 
-		assert.NilError(t, mpw.Close()) // ensure end boundary written
-		contentReader := strings.NewReader(sb.String())
-		partReader := multipart.NewReader(contentReader, mpw.Boundary())
-		tu.AssertNextPart(t, partReader, "text/plain", decodedTextContent)
+	t.Run("EmitsNothingIfBodyEmpty", func(t *testing.T) {
+		sb, w := setup()
+
+		testTemplate.emitPart(w, header, nil, footer, false)
+
+		assert.NilError(t, w.err)
+		assert.Equal(t, "", sb.String())
 	})
 
-	t.Run("ReturnsCreatePartError", func(t *testing.T) {
-		ew, h, mpw := setupErrWriter("CreatePart error")
-		ew.ErrorOn = "--" + mpw.Boundary()
+	t.Run("ReturnsHeaderWriteError", func(t *testing.T) {
+		ew, w := setupErrWriter("header write error")
+		ew.ErrorOn = "Content-Type: text/plain"
 
-		err := emitPart(mpw, h, contentType, body, footer)
+		testTemplate.emitPart(w, header, body, footer, false)
 
-		assert.Error(t, err, "CreatePart error")
+		assert.Error(t, w.err, "header write error")
 	})
 
 	t.Run("ReturnsWriteError", func(t *testing.T) {
-		ew, h, mpw := setupErrWriter("Write error")
+		ew, w := setupErrWriter("Write error")
 		ew.ErrorOn = "This is only a test." // appears in body
 
-		err := emitPart(mpw, h, contentType, body, footer)
+		testTemplate.emitPart(w, header, body, footer, false)
 
-		assert.Error(t, err, "Write error")
+		assert.Error(t, w.err, "Write error")
 	})
 
 	t.Run("ReturnsWriteQuotedPrintableError", func(t *testing.T) {
-		ew, h, mpw := setupErrWriter("writeQuotedPrintable error")
+		ew, w := setupErrWriter("writeQuotedPrintable error")
 		ew.ErrorOn = "Unsubscribe: " // appears in footer
 
-		err := emitPart(mpw, h, contentType, body, footer)
+		testTemplate.emitPart(w, header, body, footer, false)
 
-		assert.Error(t, err, "writeQuotedPrintable error")
+		assert.Error(t, w.err, "writeQuotedPrintable error")
 	})
 }
 
@@ -656,12 +1142,160 @@ func TestEmitMessageReturnsWriteErrors(t *testing.T) {
 	assert.Assert(t, tu.ErrorIs(err, ew.Err))
 }
 
+func TestEmitMessageRefusesBareLineFeed(t *testing.T) {
+	msg := *testMessage
+	msg.Subject = "Hello\nBcc: bar@example.com"
+	mt := NewMessageTemplate(&msg)
+	sb := &strings.Builder{}
+	r := newTestRecipient()
+
+	err := mt.EmitMessage(sb, r)
+
+	assert.ErrorContains(t, err, "error emitting message to "+r.Email+": ")
+	assert.Assert(t, tu.ErrorIs(err, ErrBareLineFeed))
+	assert.Assert(t, !strings.Contains(sb.String(), "Bcc:"))
+}
+
+func TestEmitMessageReturnsFlushError(t *testing.T) {
+	ew := &tu.ErrWriter{
+		Buf:     &strings.Builder{},
+		Err:     errors.New("flush error"),
+		ErrorOn: "Unsubscribe",
+	}
+	bw := bufio.NewWriterSize(ew, 64*1024)
+	r := newTestRecipient()
+
+	err := testTemplate.EmitMessage(bw, r)
+
+	expected := "error emitting message to " + r.Email + ": flush error"
+	assert.Error(t, err, expected)
+	assert.Assert(t, tu.ErrorIs(err, ew.Err))
+}
+
+// emitWithMultipartWriter emits the content of a multipart message from mt
+// using multipart.Writer, which EmitMessage did before precomputing the part
+// headers.
+func emitWithMultipartWriter(
+	t *testing.T, mt *MessageTemplate, r *Recipient, boundary string,
+) string {
+	t.Helper()
+
+	sb := &strings.Builder{}
+	mpw := multipart.NewWriter(sb)
+	assert.NilError(t, mpw.SetBoundary(boundary))
+	contentType := mime.FormatMediaType(
+		"multipart/alternative", map[string]string{"boundary": boundary},
+	)
+	sb.WriteString("Content-Type: " + contentType + "\r\n\r\n")
+
+	parts := []struct {
+		contentType  string
+		body, footer []byte
+		useBase64    bool
+	}{
+		{
+			textContentType,
+			mt.textBody,
+			r.FillInUnsubscribeUrl(mt.textFooter),
+			mt.textBase64,
+		},
+		{
+			htmlContentType,
+			mt.htmlBody,
+			r.FillInUnsubscribeUrl(mt.htmlFooter),
+			mt.htmlBase64,
+		},
+		{calendarContentType, mt.calendar, nil, mt.calendarBase64},
+	}
+
+	for _, part := range parts {
+		if len(part.body) == 0 {
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", part.contentType)
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		if part.useBase64 {
+			h.Set("Content-Transfer-Encoding", "base64")
+		}
+		pw, err := mpw.CreatePart(h)
+		assert.NilError(t, err)
+		assert.NilError(
+			t, mt.writeBody(pw, part.body, part.footer, part.useBase64),
+		)
+	}
+	assert.NilError(t, mpw.Close())
+	return sb.String()
+}
+
+func TestEmitMessageMatchesMultipartWriterOutput(t *testing.T) {
+	r := newTestRecipient()
+
+	assertMatches := func(t *testing.T, mt *MessageTemplate) {
+		t.Helper()
+
+		content := string(mt.GenerateMessage(r))
+
+		_, boundary, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		i := strings.Index(content, "Content-Type: multipart/alternative")
+		assert.Assert(t, i != -1)
+		expected := emitWithMultipartWriter(t, mt, r, boundary)
+		assert.Equal(t, expected, content[i:])
+	}
+
+	t.Run("QuotedPrintable", func(t *testing.T) {
+		assertMatches(t, NewMessageTemplate(testMessage))
+	})
+
+	t.Run("Base64", func(t *testing.T) {
+		msg := *testMessage
+		msg.TextBody = strings.Repeat(nonAsciiLine, 50)
+		msg.HtmlBody = "<p>" + strings.Repeat(nonAsciiLine, 50) + "</p>\n"
+
+		assertMatches(t, NewMessageTemplate(&msg, WithBase64Threshold(1.5, 0)))
+	})
+
+	t.Run("Calendar", func(t *testing.T) {
+		msg := *testMessage
+		msg.Calendar = testCalendar
+
+		assertMatches(t, NewMessageTemplate(&msg))
+	})
+
+	t.Run("CalendarWithoutHtml", func(t *testing.T) {
+		msg := *testMessage
+		msg.Calendar = testCalendar
+		mt := NewMessageTemplate(&msg)
+		mt.htmlBody = []byte{}
+		mt.precomputeContentHeaders()
+
+		assertMatches(t, mt)
+	})
+}
+
+// BenchmarkEmitMessage reports the allocations required to emit each message
+// of a send, which should be limited to filling in the Recipient's
+// information.
+func BenchmarkEmitMessage(b *testing.B) {
+	r := newTestRecipient()
+	mt := NewMessageTemplate(
+		testMessage, WithMessageIds("foo.com", DerivedMessageId(uuid.Nil)),
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := mt.EmitMessage(io.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestGenerateMessage(t *testing.T) {
 	r := newTestRecipient()
 
 	t.Run("GeneratesPlaintextMessage", func(t *testing.T) {
-		textTemplate := *testTemplate
-		textTemplate.htmlBody = []byte{}
+		textTemplate := newTextOnlyTemplate(testTemplate)
 
 		content := string(textTemplate.GenerateMessage(r))
 
@@ -680,6 +1314,328 @@ func TestGenerateMessage(t *testing.T) {
 		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
 		tu.AssertNextPart(t, pr, "text/html", decodedHtmlContent)
 	})
+
+	t.Run("GeneratesThreadingHeaders", func(t *testing.T) {
+		msg := *testMessage
+		msg.InReplyTo = "<bar@foo.com>"
+		msg.References = []string{"<foo@foo.com>", "<bar@foo.com>"}
+		mt := NewMessageTemplate(&msg)
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		th := tu.TestHeader{Header: parsed.Header}
+		th.Assert(t, "In-Reply-To", "<bar@foo.com>")
+		th.Assert(t, "References", "<foo@foo.com> <bar@foo.com>")
+	})
+
+	t.Run("GeneratesBase64Parts", func(t *testing.T) {
+		msg := *testMessage
+		msg.TextBody = strings.Repeat(nonAsciiLine, 50)
+		msg.HtmlBody = "<p>" + strings.Repeat(nonAsciiLine, 50) + "</p>\n"
+		mt := NewMessageTemplate(&msg, WithBase64Threshold(1.5, 0))
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed, _, pr := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		textContent := convertToCrlf(msg.TextBody)
+		htmlContent := convertToCrlf(msg.HtmlBody)
+		for _, expected := range []string{
+			string(textContent) + string(instantiatedTextFooter),
+			string(htmlContent) + string(instantiatedHtmlFooter),
+		} {
+			part, err := pr.NextPart()
+			assert.NilError(t, err)
+			assertBase64Content(t, part.Header, part, expected)
+		}
+	})
+
+	t.Run("GeneratesBase64TextOnlyMessage", func(t *testing.T) {
+		msg := *testMessage
+		msg.TextBody = strings.Repeat(nonAsciiLine, 50)
+		mt := newTextOnlyTemplate(
+			NewMessageTemplate(&msg, WithBase64Threshold(1.5, 0)),
+		)
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed := tu.ParseMessage(t, content)
+		assertMessageHeaders(t, parsed, content)
+		assertBase64Content(
+			t,
+			textproto.MIMEHeader(parsed.Header),
+			parsed.Body,
+			string(convertToCrlf(msg.TextBody))+string(instantiatedTextFooter),
+		)
+	})
+
+	t.Run("GeneratesPersonalizedSubject", func(t *testing.T) {
+		msg := *testMessage
+		msg.Subject = EmailUsernameTemplate + ", your weekly digest"
+		mt := NewMessageTemplate(&msg)
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		const expected = "subscriber, your weekly digest"
+		assert.Equal(t, expected, parsed.Header.Get("Subject"))
+	})
+
+	t.Run("GeneratesEncodedPersonalizedSubject", func(t *testing.T) {
+		msg := *testMessage
+		msg.Subject = EmailUsernameTemplate + ", your weekly digest"
+		mt := NewMessageTemplate(&msg)
+		nonAscii := *r
+		nonAscii.Email = "jürgen@foo.com"
+
+		content := string(mt.GenerateMessage(&nonAscii))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		subject := parsed.Header.Get("Subject")
+		assert.Assert(t, is.Contains(subject, "=?utf-8?q?j=C3=BCrgen,"))
+		decoded, err := (&mime.WordDecoder{}).DecodeHeader(subject)
+		assert.NilError(t, err)
+		assert.Equal(t, "jürgen, your weekly digest", decoded)
+	})
+
+	t.Run("GeneratesListHeaders", func(t *testing.T) {
+		mt := NewMessageTemplate(
+			testMessage,
+			WithListHeaders("https://foo.com/help", "mailto:sub@foo.com"),
+		)
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		th := tu.TestHeader{Header: parsed.Header}
+		th.Assert(t, "List-Help", "<https://foo.com/help>")
+		th.Assert(t, "List-Subscribe", "<mailto:sub@foo.com>")
+	})
+
+	t.Run("FoldsLongHeadersIfConfigured", func(t *testing.T) {
+		mt := NewMessageTemplate(testMessage, WithHeaderFolding())
+
+		content := string(mt.GenerateMessage(r))
+
+		expected := "List-Unsubscribe: " +
+			strings.Replace(testUnsubHeaderValue, ", ", ",\r\n ", 1) + "\r\n"
+		assert.Assert(t, is.Contains(content, expected))
+		parsed, _, pr := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
+		tu.AssertNextPart(t, pr, "text/html", decodedHtmlContent)
+	})
+
+	t.Run("OrdersHeadersIfConfigured", func(t *testing.T) {
+		mt := NewMessageTemplate(
+			testMessage,
+			WithListHeaders("https://foo.com/help", ""),
+			WithHeaderOrder("Date", "From", "To", "Subject", "MIME-Version"),
+		)
+
+		content := string(mt.GenerateMessage(r))
+
+		expected := []string{
+			"From",
+			"To",
+			"Subject",
+			"MIME-Version",
+			"List-Unsubscribe",
+			"List-Unsubscribe-Post",
+			"List-Help",
+			"Content-Type",
+		}
+		assert.DeepEqual(t, expected, headerNames(content))
+		parsed, _, pr := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
+		tu.AssertNextPart(t, pr, "text/html", decodedHtmlContent)
+	})
+
+	t.Run("OrdersAndFoldsHeadersIfConfigured", func(t *testing.T) {
+		msg := *testMessage
+		msg.References = []string{"<foo@bar.com>", "<baz@quux.com>"}
+		mt := NewMessageTemplate(
+			&msg,
+			WithHeaderOrder(RecommendedHeaderOrder...),
+			WithHeaderFolding(),
+		)
+
+		content := string(mt.GenerateMessage(r))
+
+		expected := []string{
+			"From",
+			"To",
+			"References",
+			"Subject",
+			"MIME-Version",
+			"List-Unsubscribe",
+			"List-Unsubscribe-Post",
+			"Content-Type",
+		}
+		assert.DeepEqual(t, expected, headerNames(content))
+		const refs = "References: <foo@bar.com>\r\n <baz@quux.com>\r\n"
+		assert.Assert(t, is.Contains(content, refs))
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+	})
+
+	assertCalendarPart := func(t *testing.T, pr *multipart.Reader) {
+		t.Helper()
+
+		part, err := pr.NextPart()
+		assert.NilError(t, err)
+		header := textproto.MIMEHeader(part.Header)
+		params := tu.AssertContentTypeAndGetParams(t, header, "text/calendar")
+		expectedParams := map[string]string{
+			"charset": "utf-8", "method": "PUBLISH",
+		}
+		assert.DeepEqual(t, expectedParams, params)
+		tu.AssertDecodedContent(
+			t, part, string(convertToCrlf(testCalendar)),
+		)
+		_, err = pr.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	t.Run("GeneratesCalendarPartAfterHtml", func(t *testing.T) {
+		msg := *testMessage
+		msg.Calendar = testCalendar
+		mt := NewMessageTemplate(&msg)
+
+		content := string(mt.GenerateMessage(r))
+
+		parsed, _, pr := tu.ParseMultipartMessageAndBoundary(t, content)
+		assertMessageHeaders(t, parsed, content)
+		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
+		tu.AssertNextPart(t, pr, "text/html", decodedHtmlContent)
+		assertCalendarPart(t, pr)
+	})
+
+	t.Run("GeneratesMultipartMessageIfCalendarWithoutHtml", func(t *testing.T) {
+		msg := *testMessage
+		msg.Calendar = testCalendar
+		mt := NewMessageTemplate(&msg)
+		mt.htmlBody = []byte{}
+		mt.precomputeContentHeaders()
+
+		content := string(mt.GenerateMessage(r))
+
+		_, _, pr := tu.ParseMultipartMessageAndBoundary(t, content)
+		tu.AssertNextPart(t, pr, "text/plain", decodedTextContent)
+		assertCalendarPart(t, pr)
+	})
+
+	t.Run("OmitsListHeadersIfNotConfigured", func(t *testing.T) {
+		content := string(testTemplate.GenerateMessage(r))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		assert.Equal(t, "", parsed.Header.Get("List-Help"))
+		assert.Equal(t, "", parsed.Header.Get("List-Subscribe"))
+	})
+
+	t.Run("OmitsThreadingHeadersIfEmpty", func(t *testing.T) {
+		content := string(testTemplate.GenerateMessage(r))
+
+		parsed, _, _ := tu.ParseMultipartMessageAndBoundary(t, content)
+		assert.Equal(t, "", parsed.Header.Get("In-Reply-To"))
+		assert.Equal(t, "", parsed.Header.Get("References"))
+	})
+}
+
+// headerNames returns the names of the top level headers of content in order.
+func headerNames(content string) (names []string) {
+	headers, _, _ := strings.Cut(content, "\r\n\r\n")
+
+	for _, line := range strings.Split(headers, "\r\n") {
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			name, _, _ := strings.Cut(line, ":")
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+func TestOrderHeaders(t *testing.T) {
+	headers := "X-Foo: foo\r\n" +
+		"subject: Hello\r\n" +
+		"References: <foo@bar.com>\r\n <baz@quux.com>\r\n" +
+		"X-Bar: bar\r\n" +
+		"From: sender@foo.com\r\n"
+
+	t.Run("MovesNamedHeadersToFrontIgnoringCase", func(t *testing.T) {
+		order := []string{"Date", "From", "References", "Subject"}
+
+		result := orderHeaders([]byte(headers), order)
+
+		expected := "From: sender@foo.com\r\n" +
+			"References: <foo@bar.com>\r\n <baz@quux.com>\r\n" +
+			"subject: Hello\r\n" +
+			"X-Foo: foo\r\n" +
+			"X-Bar: bar\r\n"
+		assert.Equal(t, expected, string(result))
+	})
+
+	t.Run("LeavesHeadersUnchangedIfNoneNamed", func(t *testing.T) {
+		result := orderHeaders([]byte(headers), []string{"Date"})
+
+		assert.Equal(t, headers, string(result))
+	})
+}
+
+func TestFoldHeaderLine(t *testing.T) {
+	t.Run("LeavesShortLinesUnchanged", func(t *testing.T) {
+		line := "Subject: " + strings.Repeat("x", 69) + "\r\n"
+
+		assert.Equal(t, line, string(foldHeaderLine([]byte(line))))
+	})
+
+	t.Run("FoldsAtLastSpaceBeforeLimit", func(t *testing.T) {
+		first := "Subject: " + strings.Repeat("x", 60)
+		second := strings.Repeat("y", 20)
+		line := first + " " + second + "\r\n"
+
+		result := string(foldHeaderLine([]byte(line)))
+
+		assert.Equal(t, first+"\r\n "+second+"\r\n", result)
+	})
+
+	t.Run("FoldsMultipleTimes", func(t *testing.T) {
+		word := strings.Repeat("x", 50)
+		line := "Subject: " + word + " " + word + " " + word + "\r\n"
+
+		result := string(foldHeaderLine([]byte(line)))
+
+		expected := "Subject: " + word + "\r\n " + word + "\r\n " + word +
+			"\r\n"
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("LeavesLongWordsIntact", func(t *testing.T) {
+		line := "List-Help: <https://foo.com/" + strings.Repeat("x", 80) + ">"
+
+		assert.Equal(t, line, string(foldHeaderLine([]byte(line))))
+	})
+
+	t.Run("DoesNotFoldBeforeEmptyWords", func(t *testing.T) {
+		line := "Subject: " + strings.Repeat("x", 69) + "  "
+
+		assert.Equal(t, line, string(foldHeaderLine([]byte(line))))
+	})
+}
+
+func assertBase64Content(
+	t *testing.T, header textproto.MIMEHeader, body io.Reader, expected string,
+) {
+	t.Helper()
+
+	assert.Equal(t, "base64", header.Get("Content-Transfer-Encoding"))
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+	assert.NilError(t, err)
+	assert.Equal(t, expected, string(decoded))
 }
 
 func TestNewMessageFromJson(t *testing.T) {
@@ -0,0 +1,131 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MxFailurePolicy determines when ProdAddressValidator suppresses an address
+// after every MX host for its domain fails validation.
+//
+// Transient DNS issues can make a valid domain's MX hosts temporarily fail
+// validation. Rather than suppressing an address on the first such failure,
+// MxFailurePolicy records each failure and only allows suppression once
+// Threshold failures occur within Window of the first one. Failures older than
+// Window are forgotten.
+//
+// If Store is nil, failures are recorded in memory. When running in AWS Lambda,
+// each function instance then keeps its own records, and loses them when it
+// shuts down, so reaching the Threshold may take longer than expected. Set
+// Store to share the records across instances.
+type MxFailurePolicy struct {
+	// Threshold is the number of failures within Window after which to
+	// suppress an address. Values less than two suppress on the first failure.
+	Threshold int
+
+	// Window is the period, starting from the first recorded failure, during
+	// which failures count towards the Threshold.
+	Window time.Duration
+
+	// Now returns the current time. Defaults to time.Now if nil.
+	Now func() time.Time
+
+	// Store, if not nil, persists the failures instead of recording them in
+	// memory.
+	Store MxFailureStore
+
+	mutex    sync.Mutex
+	failures map[string]mxFailures
+}
+
+// MxFailureStore persists the count and time of the first MX validation
+// failure for each address.
+//
+// db.DynamoDbEventLog implements this interface.
+type MxFailureStore interface {
+	// RecordMxFailure increments the failure count for email and returns it.
+	//
+	// It starts a new count at now if none exists, or if the first failure
+	// of the existing count happened more than window before now.
+	RecordMxFailure(
+		ctx context.Context, email string, now time.Time, window time.Duration,
+	) (count int, err error)
+
+	// ForgetMxFailures removes the failure count for email.
+	ForgetMxFailures(ctx context.Context, email string) error
+}
+
+type mxFailures struct {
+	count int
+	first time.Time
+}
+
+// RecordFailure records an MX validation failure for email.
+//
+// Returns the number of failures recorded within the current window, and
+// whether email should now be suppressed. Once suppression is warranted,
+// RecordFailure forgets the failures for email.
+//
+// If Store returns an error, suppress is false.
+func (p *MxFailurePolicy) RecordFailure(ctx context.Context, email string) (
+	count int, suppress bool, err error,
+) {
+	if p.Threshold < 2 {
+		return 1, true, nil
+	}
+	now := p.now()
+
+	if p.Store != nil {
+		return p.recordStoredFailure(ctx, email, now)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.failures == nil {
+		p.failures = map[string]mxFailures{}
+	}
+	p.forgetExpiredFailures(now)
+
+	record := p.failures[email]
+	if record.count == 0 {
+		record.first = now
+	}
+	record.count++
+
+	if record.count < p.Threshold {
+		p.failures[email] = record
+		return record.count, false, nil
+	}
+	delete(p.failures, email)
+	return record.count, true, nil
+}
+
+func (p *MxFailurePolicy) recordStoredFailure(
+	ctx context.Context, email string, now time.Time,
+) (count int, suppress bool, err error) {
+	if count, err = p.Store.RecordMxFailure(
+		ctx, email, now, p.Window,
+	); err != nil || count < p.Threshold {
+		return
+	} else if err = p.Store.ForgetMxFailures(ctx, email); err != nil {
+		return
+	}
+	return count, true, nil
+}
+
+func (p *MxFailurePolicy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+func (p *MxFailurePolicy) forgetExpiredFailures(now time.Time) {
+	for email, record := range p.failures {
+		if now.Sub(record.first) > p.Window {
+			delete(p.failures, email)
+		}
+	}
+}
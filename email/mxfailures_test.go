@@ -0,0 +1,157 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+type testMxFailureStore struct {
+	counts    map[string]int
+	window    time.Duration
+	recordErr error
+	forgetErr error
+}
+
+func newTestMxFailureStore() *testMxFailureStore {
+	return &testMxFailureStore{counts: map[string]int{}}
+}
+
+func (s *testMxFailureStore) RecordMxFailure(
+	_ context.Context, email string, _ time.Time, window time.Duration,
+) (int, error) {
+	if s.recordErr != nil {
+		return 0, s.recordErr
+	}
+	s.window = window
+	s.counts[email]++
+	return s.counts[email], nil
+}
+
+func (s *testMxFailureStore) ForgetMxFailures(
+	_ context.Context, email string,
+) error {
+	if s.forgetErr != nil {
+		return s.forgetErr
+	}
+	delete(s.counts, email)
+	return nil
+}
+
+func TestMxFailurePolicy(t *testing.T) {
+	setup := func(threshold int) (*MxFailurePolicy, *time.Time) {
+		now := time.Date(1970, time.September, 18, 12, 0, 0, 0, time.UTC)
+		policy := &MxFailurePolicy{
+			Threshold: threshold,
+			Window:    24 * time.Hour,
+			Now:       func() time.Time { return now },
+		}
+		return policy, &now
+	}
+
+	assertRecorded := func(
+		t *testing.T, p *MxFailurePolicy, count int, suppress bool,
+	) {
+		t.Helper()
+		actualCount, actualSuppress, err := p.RecordFailure(
+			context.Background(), "foo@bar.com",
+		)
+		assert.NilError(t, err)
+		assert.Equal(t, count, actualCount)
+		assert.Equal(t, suppress, actualSuppress)
+	}
+
+	t.Run("SuppressesOnFirstFailureByDefault", func(t *testing.T) {
+		assertRecorded(t, &MxFailurePolicy{}, 1, true)
+	})
+
+	t.Run("SingleFailureDoesNotSuppress", func(t *testing.T) {
+		policy, _ := setup(3)
+
+		assertRecorded(t, policy, 1, false)
+	})
+
+	t.Run("SuppressesAfterRepeatedFailuresWithinWindow", func(t *testing.T) {
+		policy, now := setup(3)
+
+		assertRecorded(t, policy, 1, false)
+		*now = now.Add(time.Hour)
+		assertRecorded(t, policy, 2, false)
+		*now = now.Add(time.Hour)
+		assertRecorded(t, policy, 3, true)
+
+		// The count starts over after suppression.
+		assertRecorded(t, policy, 1, false)
+	})
+
+	t.Run("CountsFailuresSeparatelyPerAddress", func(t *testing.T) {
+		policy, _ := setup(2)
+
+		assertRecorded(t, policy, 1, false)
+		count, suppress, err := policy.RecordFailure(
+			context.Background(), "quux@bar.com",
+		)
+		assert.NilError(t, err)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, false, suppress)
+		assertRecorded(t, policy, 2, true)
+	})
+
+	t.Run("ForgetsFailuresOutsideWindow", func(t *testing.T) {
+		policy, now := setup(2)
+
+		assertRecorded(t, policy, 1, false)
+		*now = now.Add(24*time.Hour + time.Second)
+		assertRecorded(t, policy, 1, false)
+		*now = now.Add(time.Hour)
+		assertRecorded(t, policy, 2, true)
+	})
+
+	t.Run("RecordsFailuresInStoreIfSet", func(t *testing.T) {
+		policy, _ := setup(2)
+		store := newTestMxFailureStore()
+		policy.Store = store
+
+		assertRecorded(t, policy, 1, false)
+		assert.Equal(t, 24*time.Hour, store.window)
+		assertRecorded(t, policy, 2, true)
+		assert.Equal(t, 0, len(store.counts))
+		assert.Equal(t, 0, len(policy.failures))
+	})
+
+	t.Run("DoesNotSuppressIfStoreFails", func(t *testing.T) {
+		policy, _ := setup(2)
+		store := newTestMxFailureStore()
+		store.recordErr = errors.New("record failed")
+		policy.Store = store
+
+		_, suppress, err := policy.RecordFailure(
+			context.Background(), "foo@bar.com",
+		)
+
+		assert.Assert(t, testutils.ErrorIs(err, store.recordErr))
+		assert.Assert(t, !suppress)
+	})
+
+	t.Run("DoesNotSuppressIfStoreFailsToForget", func(t *testing.T) {
+		policy, _ := setup(2)
+		store := newTestMxFailureStore()
+		store.forgetErr = errors.New("forget failed")
+		policy.Store = store
+		assertRecorded(t, policy, 1, false)
+
+		count, suppress, err := policy.RecordFailure(
+			context.Background(), "foo@bar.com",
+		)
+
+		assert.Assert(t, testutils.ErrorIs(err, store.forgetErr))
+		assert.Equal(t, 2, count)
+		assert.Assert(t, !suppress)
+	})
+}
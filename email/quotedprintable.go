@@ -0,0 +1,130 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime/quotedprintable"
+	"regexp"
+)
+
+// A QuotedPrintableEncoder writes msg to w using quoted-printable encoding.
+type QuotedPrintableEncoder func(w io.Writer, msg []byte) error
+
+func writeQuotedPrintable(w io.Writer, msg []byte) error {
+	qpw := quotedprintable.NewWriter(w)
+	if _, err := qpw.Write(msg); err != nil {
+		return err
+	}
+	return qpw.Close()
+}
+
+// qpMaxLineLen is the maximum encoded line length per RFC 2045 §6.7, item 5.
+//
+// The encoders reserve the final column for the "=" of a soft line break.
+//
+// - https://www.rfc-editor.org/rfc/rfc2045#section-6.7
+const qpMaxLineLen = 76
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// WriteUrlSafeQuotedPrintable avoids soft line breaks inside of URLs.
+//
+// The standard [quotedprintable.Writer] inserts a soft line break wherever a
+// line reaches the maximum length. When that happens in the middle of a URL,
+// some plain text email clients fail to reassemble the link correctly.
+//
+// This encoder will instead insert the soft line break before the URL, so the
+// entire URL appears on its own line. If an encoded URL is too long to fit on
+// any single line, it has no choice but to break the URL as usual.
+//
+// Otherwise it produces the same output as [quotedprintable.Writer].
+func WriteUrlSafeQuotedPrintable(w io.Writer, msg []byte) error {
+	enc := &qpEncoder{}
+	lines := bytes.Split(msg, []byte{newline})
+
+	for i, line := range lines {
+		if i != 0 {
+			enc.hardLineBreak()
+		}
+		enc.encodeLine(bytes.TrimSuffix(line, []byte{carriageReturn}))
+	}
+	_, err := w.Write(enc.buf.Bytes())
+	return err
+}
+
+type qpEncoder struct {
+	buf bytes.Buffer
+	col int
+}
+
+func (enc *qpEncoder) encodeLine(line []byte) {
+	start := 0
+
+	for _, loc := range urlPattern.FindAllIndex(line, -1) {
+		enc.encodeText(line[start:loc[0]], false)
+		url := line[loc[0]:loc[1]]
+		atEnd := loc[1] == len(line)
+		encodedLen := qpEncodedLen(url, atEnd)
+
+		if enc.col != 0 && !enc.fits(encodedLen) && encodedLen < qpMaxLineLen {
+			enc.softLineBreak()
+		}
+		enc.encodeText(url, atEnd)
+		start = loc[1]
+	}
+	enc.encodeText(line[start:], true)
+}
+
+func (enc *qpEncoder) encodeText(text []byte, atEndOfLine bool) {
+	for i, b := range text {
+		isLast := atEndOfLine && i == len(text)-1
+
+		if qpMustEncode(b, isLast) {
+			enc.write([]byte{'=', upperHex[b>>4], upperHex[b&0x0f]})
+		} else {
+			enc.write([]byte{b})
+		}
+	}
+}
+
+func (enc *qpEncoder) fits(n int) bool {
+	return enc.col+n < qpMaxLineLen
+}
+
+func (enc *qpEncoder) write(token []byte) {
+	if !enc.fits(len(token)) {
+		enc.softLineBreak()
+	}
+	enc.buf.Write(token)
+	enc.col += len(token)
+}
+
+func (enc *qpEncoder) softLineBreak() {
+	enc.buf.WriteByte('=')
+	enc.hardLineBreak()
+}
+
+func (enc *qpEncoder) hardLineBreak() {
+	enc.buf.Write(crlf)
+	enc.col = 0
+}
+
+const upperHex = "0123456789ABCDEF"
+
+func qpMustEncode(b byte, isLastInLine bool) bool {
+	if b == ' ' || b == '\t' {
+		return isLastInLine
+	}
+	return b == '=' || b < '!' || b > '~'
+}
+
+func qpEncodedLen(text []byte, atEndOfLine bool) (n int) {
+	for i, b := range text {
+		if qpMustEncode(b, atEndOfLine && i == len(text)-1) {
+			n += 3
+		} else {
+			n++
+		}
+	}
+	return
+}
@@ -0,0 +1,159 @@
+//go:build small_tests || all_tests
+
+package email
+
+import (
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+
+	tu "github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestWriteQuotedPrintable(t *testing.T) {
+	setup := func() (*strings.Builder, *tu.ErrWriter) {
+		sb := &strings.Builder{}
+		return sb, &tu.ErrWriter{Buf: sb}
+	}
+
+	t.Run("Succeeds", func(t *testing.T) {
+		sb, _ := setup()
+		msg := "This message is longer than 76 chars so we can see " +
+			"the quoted-printable encoding kick in.\r\n" +
+			"\r\n" +
+			"It also contains <a href=\"https://foo.com/\">a hyperlink</a>, " +
+			"in which the equals sign will be encoded."
+
+		err := writeQuotedPrintable(sb, []byte(msg))
+
+		assert.NilError(t, err)
+		expected := "This message is longer than 76 chars so we can see " +
+			"the quoted-printable enc=\r\n" +
+			"oding kick in.\r\n" +
+			"\r\n" +
+			`It also contains <a href=3D"https://foo.com/">a hyperlink</a>, ` +
+			"in which the=\r\n" +
+			" equals sign will be encoded."
+		actual := sb.String()
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("ReturnsWriteError", func(t *testing.T) {
+		_, ew := setup()
+		msg := "This message will trigger an artificial Write error " +
+			"when the first 76 characters are flushed."
+		ew.ErrorOn = "trigger an artificial Write error"
+		ew.Err = errors.New("Write error")
+
+		assert.Error(t, writeQuotedPrintable(ew, []byte(msg)), "Write error")
+	})
+
+	t.Run("ReturnsCloseError", func(t *testing.T) {
+		_, ew := setup()
+		msg := "Close will fail when it calls flush on this short message."
+		ew.ErrorOn = "Close will fail"
+		ew.Err = errors.New("Close error")
+
+		assert.Error(t, writeQuotedPrintable(ew, []byte(msg)), "Close error")
+	})
+}
+
+func TestWriteUrlSafeQuotedPrintable(t *testing.T) {
+	encode := func(t *testing.T, msg string) string {
+		t.Helper()
+		sb := &strings.Builder{}
+
+		assert.NilError(t, WriteUrlSafeQuotedPrintable(sb, []byte(msg)))
+		return sb.String()
+	}
+
+	decode := func(t *testing.T, encoded string) string {
+		t.Helper()
+		qpr := quotedprintable.NewReader(strings.NewReader(encoded))
+
+		decoded, err := io.ReadAll(qpr)
+		assert.NilError(t, err)
+		return string(decoded)
+	}
+
+	assertLinesWithinMaxLength := func(t *testing.T, encoded string) {
+		t.Helper()
+
+		for _, line := range strings.Split(encoded, "\r\n") {
+			assert.Assert(t, len(line) <= qpMaxLineLen, line)
+		}
+	}
+
+	t.Run("MatchesStandardEncoderWithoutUrls", func(t *testing.T) {
+		msg := "This message is longer than 76 chars so we can see " +
+			"the quoted-printable encoding kick in.\r\n" +
+			"\r\n" +
+			"It ends with trailing whitespace, which must be encoded. \r\n" +
+			"It also contains a tab\tand an equals sign (=) and ümlauts.\r\n"
+		sb := &strings.Builder{}
+		assert.NilError(t, writeQuotedPrintable(sb, []byte(msg)))
+
+		assert.Equal(t, sb.String(), encode(t, msg))
+	})
+
+	t.Run("WrapsBeforeUrlInsteadOfWithinIt", func(t *testing.T) {
+		const url = "https://foo.com/unsubscribe?email=subscriber%40foo.com"
+		msg := "This line is long enough that the URL won't fit: " + url
+
+		encoded := encode(t, msg)
+
+		expected := "This line is long enough that the URL won't fit: =\r\n" +
+			strings.Replace(url, "=", "=3D", 1)
+		assert.Equal(t, expected, encoded)
+		assert.Equal(t, msg, decode(t, encoded))
+	})
+
+	t.Run("DoesNotWrapIfUrlFitsOnCurrentLine", func(t *testing.T) {
+		msg := "Click: https://foo.com/ to continue."
+
+		assert.Equal(t, msg, encode(t, msg))
+	})
+
+	t.Run("BreaksUrlTooLongForAnySingleLine", func(t *testing.T) {
+		msg := "Unsubscribe: " +
+			"https://foo.com/unsubscribe?email=subscriber%40foo.com" +
+			"&uid=00000000-1111-2222-3333-444444444444"
+
+		encoded := encode(t, msg)
+
+		assert.Assert(t, is.Contains(encoded, "=\r\n"))
+		assertLinesWithinMaxLength(t, encoded)
+		assert.Equal(t, msg, decode(t, encoded))
+	})
+
+	t.Run("HandlesMultipleUrlsAndLines", func(t *testing.T) {
+		msg := "First link, which should fit: https://foo.com/first\r\n" +
+			"The second link won't fit on the same line as this text: " +
+			"https://bar.com/second?query=value\r\n"
+
+		encoded := encode(t, msg)
+
+		assert.Assert(t, is.Contains(encoded, "https://foo.com/first\r\n"))
+		assert.Assert(t, is.Contains(
+			encoded, "=\r\nhttps://bar.com/second?query=3Dvalue\r\n",
+		))
+		assertLinesWithinMaxLength(t, encoded)
+		assert.Equal(t, msg, decode(t, encoded))
+	})
+
+	t.Run("ReturnsWriteError", func(t *testing.T) {
+		ew := &tu.ErrWriter{
+			Buf:     &strings.Builder{},
+			ErrorOn: "Write error",
+			Err:     errors.New("Write error"),
+		}
+
+		err := WriteUrlSafeQuotedPrintable(ew, []byte("Write error"))
+
+		assert.Error(t, err, "Write error")
+	})
+}
@@ -3,10 +3,11 @@ package email
 import (
 	"bytes"
 	"io"
-	"net/url"
+	"mime"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/ops"
 )
 
@@ -14,17 +15,37 @@ const UnsubscribeUrlTemplate = "{{UnsubscribeUrl}}"
 
 var unsubscribeUrlTemplate = []byte(UnsubscribeUrlTemplate)
 
+// EmailTemplate and EmailUsernameTemplate may appear in a Message.Subject.
+//
+// FillInSubject replaces them with the Recipient's email address and the part
+// of the address before the "@", respectively.
+const EmailTemplate = "{{Email}}"
+const EmailUsernameTemplate = "{{EmailUsername}}"
+
+func hasSubjectTemplate(subject string) bool {
+	return strings.Contains(subject, EmailTemplate) ||
+		strings.Contains(subject, EmailUsernameTemplate)
+}
+
 type Recipient struct {
-	Email        string
-	Uid          uuid.UUID
+	Email string
+	Uid   uuid.UUID
+
+	// Signature, if set, is the ops.LinkSignature that SetUnsubscribeInfo
+	// adds to the unsubscribe URLs.
+	Signature string
+
 	unsubFormUrl []byte
 	unsubApiUrl  []byte
 	unsubHeader  []byte
 }
 
 func (sub *Recipient) SetUnsubscribeInfo(email, formUrl, apiBaseUrl string) {
-	sub.unsubFormUrl = unsubscribeFormUrl(formUrl, sub.Email, sub.Uid)
-	sub.unsubApiUrl = []byte(ops.UnsubscribeUrl(apiBaseUrl, sub.Email, sub.Uid))
+	dbSub := &db.Subscriber{Email: sub.Email, Uid: sub.Uid}
+	unsubFormUrl := dbSub.UnsubscribeFormUrl(formUrl)
+	unsubApiUrl := dbSub.UnsubscribeUrl(apiBaseUrl)
+	sub.unsubFormUrl = []byte(ops.SignUrl(unsubFormUrl, sub.Signature))
+	sub.unsubApiUrl = []byte(ops.SignUrl(unsubApiUrl, sub.Signature))
 
 	sb := &strings.Builder{}
 	sb.WriteString("List-Unsubscribe: <")
@@ -35,16 +56,6 @@ func (sub *Recipient) SetUnsubscribeInfo(email, formUrl, apiBaseUrl string) {
 	sub.unsubHeader = []byte(sb.String())
 }
 
-func unsubscribeFormUrl(baseFormUrl, email string, uid uuid.UUID) []byte {
-	sb := &strings.Builder{}
-	sb.WriteString(baseFormUrl)
-	sb.WriteString("?email=")
-	sb.WriteString(url.QueryEscape(email))
-	sb.WriteString("&uid=")
-	sb.WriteString(uid.String())
-	return []byte(sb.String())
-}
-
 var listUnsubscribePost = []byte(
 	"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n",
 )
@@ -64,3 +75,17 @@ func (sub *Recipient) EmitUnsubscribeHeaders(w io.Writer) (err error) {
 func (sub *Recipient) FillInUnsubscribeUrl(msg []byte) []byte {
 	return bytes.Replace(msg, unsubscribeUrlTemplate, sub.unsubFormUrl, 1)
 }
+
+// FillInSubject replaces templates in subject and encodes it if necessary.
+//
+// If the result contains non-ASCII characters, it will be encoded as one or
+// more RFC 2047 "encoded-words". Otherwise it's returned as is.
+//
+// - https://www.rfc-editor.org/rfc/rfc2047
+func (sub *Recipient) FillInSubject(subject string) string {
+	username, _, _ := strings.Cut(sub.Email, "@")
+	subject = strings.NewReplacer(
+		EmailTemplate, sub.Email, EmailUsernameTemplate, username,
+	).Replace(subject)
+	return mime.QEncoding.Encode("utf-8", subject)
+}
@@ -5,6 +5,7 @@ package email
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/url"
 	"strings"
 	"testing"
@@ -49,6 +50,22 @@ func TestSubscriber(t *testing.T) {
 		assert.Equal(t, header, string(sub.unsubHeader))
 	})
 
+	t.Run("SetUnsubscribeInfoSignsUrlsIfSignatureSet", func(t *testing.T) {
+		sub := setup()
+		sub.Signature = "0123456789"
+
+		sub.SetUnsubscribeInfo(testUnsubEmail, testUnsubUrl, testApiBaseUrl)
+
+		unsubApiUrl, unsubFormUrl, _ := expectedUrlsAndHeader(sub)
+		assert.Equal(t, unsubApiUrl+"?sig=0123456789", string(sub.unsubApiUrl))
+		assert.Equal(
+			t, unsubFormUrl+"&sig=0123456789", string(sub.unsubFormUrl),
+		)
+		assert.Assert(t, strings.Contains(
+			string(sub.unsubHeader), unsubApiUrl+"?sig=0123456789>",
+		))
+	})
+
 	t.Run("FillInUnsubscribeUrlReplacesTemplate", func(t *testing.T) {
 		sub := setup()
 		orig := "Unsubscribe at " + UnsubscribeUrlTemplate + " at any time"
@@ -59,6 +76,34 @@ func TestSubscriber(t *testing.T) {
 		assert.Equal(t, expected, string(result))
 	})
 
+	t.Run("FillInSubjectLeavesStaticSubjectUnchanged", func(t *testing.T) {
+		sub := setup()
+
+		assert.Equal(t, "Weekly digest", sub.FillInSubject("Weekly digest"))
+	})
+
+	t.Run("FillInSubjectReplacesTemplates", func(t *testing.T) {
+		sub := setup()
+		subject := EmailUsernameTemplate + ", your digest for " + EmailTemplate
+
+		result := sub.FillInSubject(subject)
+
+		expected := "subscriber, your digest for subscriber@foo.com"
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("FillInSubjectEncodesNonAsciiResult", func(t *testing.T) {
+		sub := setup()
+		sub.Email = "jürgen@foo.com"
+
+		result := sub.FillInSubject(EmailUsernameTemplate + ", hello")
+
+		assert.Equal(t, "=?utf-8?q?j=C3=BCrgen,_hello?=", result)
+		decoded, err := (&mime.WordDecoder{}).DecodeHeader(result)
+		assert.NilError(t, err)
+		assert.Equal(t, "jürgen, hello", decoded)
+	})
+
 	t.Run("EmitUnsubscribeHeaders", func(t *testing.T) {
 		emitHeadersSetup := func() (
 			*Recipient, *strings.Builder, *tu.ErrWriter,
@@ -36,6 +36,12 @@ type SesV2Api interface {
 		context.Context, *sesv2.GetAccountInput, ...func(*sesv2.Options),
 	) (*sesv2.GetAccountOutput, error)
 
+	GetEmailIdentity(
+		context.Context,
+		*sesv2.GetEmailIdentityInput,
+		...func(*sesv2.Options),
+	) (*sesv2.GetEmailIdentityOutput, error)
+
 	SendEmail(
 		context.Context, *sesv2.SendEmailInput, ...func(*sesv2.Options),
 	) (*sesv2.SendEmailOutput, error)
@@ -27,6 +27,19 @@ type Suppressor interface {
 	Unsuppress(ctx context.Context, email string) error
 }
 
+// SuppressionReasonLookup wraps the SuppressionReason method.
+//
+// SuppressionReason checks whether an email address is on the SES account-level
+// suppression list, like Suppressor.IsSuppressed, and returns the reason it's
+// there, e.g., "BOUNCE" or "COMPLAINT". It uses the same single SES API call,
+// so callers needing the reason should call it in place of IsSuppressed. The
+// reason is the empty string if the address isn't suppressed.
+type SuppressionReasonLookup interface {
+	SuppressionReason(
+		ctx context.Context, email string,
+	) (suppressed bool, reason string, err error)
+}
+
 type SesSuppressor struct {
 	Client SesV2Api
 }
@@ -34,16 +47,44 @@ type SesSuppressor struct {
 func (mailer *SesSuppressor) IsSuppressed(
 	ctx context.Context, email string,
 ) (verdict bool, err error) {
+	verdict, _, err = mailer.getSuppressedDestination(ctx, email)
+	if err != nil {
+		const errFmt = "unexpected error while checking if %s suppressed"
+		err = ops.AwsError(fmt.Sprintf(errFmt, email), err)
+	}
+	return
+}
+
+func (mailer *SesSuppressor) SuppressionReason(
+	ctx context.Context, email string,
+) (suppressed bool, reason string, err error) {
+	suppressed, reason, err = mailer.getSuppressedDestination(ctx, email)
+	if err != nil {
+		const errFmt = "unexpected error while getting suppression reason " +
+			"for %s"
+		err = ops.AwsError(fmt.Sprintf(errFmt, email), err)
+	}
+	return
+}
+
+// getSuppressedDestination returns the unwrapped error from SES, if any, other
+// than the NotFoundException signifying that email isn't suppressed.
+func (mailer *SesSuppressor) getSuppressedDestination(
+	ctx context.Context, email string,
+) (suppressed bool, reason string, err error) {
 	input := &sesv2.GetSuppressedDestinationInput{EmailAddress: &email}
+	var output *sesv2.GetSuppressedDestinationOutput
 	var notFoundErr *sesv2types.NotFoundException
 
-	if _, err = mailer.Client.GetSuppressedDestination(ctx, input); err == nil {
-		verdict = true
+	output, err = mailer.Client.GetSuppressedDestination(ctx, input)
+
+	if err == nil {
+		suppressed = true
+		if output != nil && output.SuppressedDestination != nil {
+			reason = string(output.SuppressedDestination.Reason)
+		}
 	} else if errors.As(err, &notFoundErr) {
 		err = nil
-	} else {
-		const errFmt = "unexpected error while checking if %s suppressed"
-		err = ops.AwsError(fmt.Sprintf(errFmt, email), err)
 	}
 	return
 }
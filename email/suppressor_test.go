@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
@@ -61,6 +62,62 @@ func TestIsSuppressed(t *testing.T) {
 	})
 }
 
+func TestSuppressionReason(t *testing.T) {
+	setup := func() (*TestSesV2, *SesSuppressor, context.Context) {
+		testSesV2 := &TestSesV2{}
+		suppressor := &SesSuppressor{Client: testSesV2}
+		return testSesV2, suppressor, context.Background()
+	}
+
+	t.Run("ReturnsReasonIfSuppressed", func(t *testing.T) {
+		testSesV2, suppressor, ctx := setup()
+		testSesV2.getSupDestOutput = &sesv2.GetSuppressedDestinationOutput{
+			SuppressedDestination: &types.SuppressedDestination{
+				Reason: types.SuppressionListReasonComplaint,
+			},
+		}
+
+		suppressed, reason, err := suppressor.SuppressionReason(
+			ctx, "foo@bar.com",
+		)
+
+		assert.NilError(t, err)
+		assert.Assert(t, suppressed == true)
+		assert.Equal(t, "COMPLAINT", reason)
+		emailAddress := aws.ToString(testSesV2.getSupDestInput.EmailAddress)
+		assert.Equal(t, "foo@bar.com", emailAddress)
+	})
+
+	t.Run("ReturnsEmptyStringIfNotSuppressed", func(t *testing.T) {
+		testSesV2, suppressor, ctx := setup()
+		testSesV2.getSupDestError = notFoundException()
+
+		suppressed, reason, err := suppressor.SuppressionReason(
+			ctx, "foo@bar.com",
+		)
+
+		assert.NilError(t, err)
+		assert.Assert(t, suppressed == false)
+		assert.Equal(t, "", reason)
+	})
+
+	t.Run("ReturnsErrorIfUnexpectedFailure", func(t *testing.T) {
+		testSesV2, suppressor, ctx := setup()
+		testSesV2.getSupDestError = testutils.AwsServerError("not a 404")
+
+		suppressed, reason, err := suppressor.SuppressionReason(
+			ctx, "foo@bar.com",
+		)
+
+		assert.Assert(t, suppressed == false)
+		assert.Equal(t, "", reason)
+		const expectedErr = "unexpected error while getting suppression " +
+			"reason for foo@bar.com: external error: api error : not a 404"
+		assert.ErrorContains(t, err, expectedErr)
+		assert.Assert(t, testutils.ErrorIs(err, ops.ErrExternal))
+	})
+}
+
 func TestSuppress(t *testing.T) {
 	setup := func() (*TestSesV2, *SesSuppressor, context.Context) {
 		testSesV2 := &TestSesV2{}
@@ -3,9 +3,11 @@ package email
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sesv2types "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/types"
 )
@@ -18,11 +20,23 @@ const ErrBulkSendCapacityExhausted = types.SentinelError(
 	"Bulk capacity for 24 hour max send quota already consumed",
 )
 
+// DefaultMaxSendRateCapacity is the portion of the SES maximum send rate used
+// when SesThrottle.MaxSendRateCapacity is zero.
+//
+// Sending slightly below the maximum rate leaves headroom for other messages,
+// such as subscription verifications, sent while a bulk send is in progress.
+const DefaultMaxSendRateCapacity = 0.9
+
 type Throttle interface {
 	BulkCapacityAvailable(ctx context.Context) error
 	PauseBeforeNextSend(context.Context) error
 }
 
+// SesThrottle paces sends to stay within the account's SES sending quota.
+//
+// It's safe for concurrent use, so multiple goroutines, such as those handling
+// overlapping Lambda events, may share it. Its exported fields shouldn't be
+// modified after the first call to one of its methods.
 type SesThrottle struct {
 	Client          SesV2Api
 	Updated         time.Time
@@ -35,22 +49,36 @@ type SesThrottle struct {
 	SentLast24Hours int64
 	MaxBulkCapacity types.Capacity
 	MaxBulkSendable int64
+
+	// MaxSendRateCapacity is the portion of the account's maximum send rate
+	// to use. If zero, DefaultMaxSendRateCapacity applies instead.
+	MaxSendRateCapacity types.Capacity
+
+	// SendRate, if greater than zero, overrides the rate computed from
+	// MaxSendRateCapacity. It never exceeds the account's maximum send rate.
+	SendRate float64
+
+	mutex sync.Mutex
 }
 
 func NewSesThrottle(
 	ctx context.Context,
 	client SesV2Api,
 	maxCap types.Capacity,
+	maxRateCap types.Capacity,
+	sendRate float64,
 	sleep func(time.Duration),
 	now func() time.Time,
 	refreshInterval time.Duration,
 ) (t *SesThrottle, err error) {
 	throttle := &SesThrottle{
-		Client:          client,
-		Sleep:           sleep,
-		Now:             now,
-		RefreshInterval: refreshInterval,
-		MaxBulkCapacity: maxCap,
+		Client:              client,
+		Sleep:               sleep,
+		Now:                 now,
+		RefreshInterval:     refreshInterval,
+		MaxBulkCapacity:     maxCap,
+		MaxSendRateCapacity: maxRateCap,
+		SendRate:            sendRate,
 	}
 	if err = throttle.refresh(ctx); err == nil {
 		t = throttle
@@ -59,6 +87,9 @@ func NewSesThrottle(
 }
 
 func (t *SesThrottle) BulkCapacityAvailable(ctx context.Context) (err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	if err = t.refresh(ctx); err != nil || t.unlimited() {
 		return
 	} else if t.MaxBulkSendable < t.SentLast24Hours {
@@ -76,7 +107,24 @@ func (t *SesThrottle) BulkCapacityAvailable(ctx context.Context) (err error) {
 	return
 }
 
+// PauseBeforeNextSend sleeps until the next send is permitted.
+//
+// Concurrent callers each reserve the next available send time before sleeping,
+// so their sends are spaced PauseInterval apart.
 func (t *SesThrottle) PauseBeforeNextSend(ctx context.Context) (err error) {
+	var pause time.Duration
+	if pause, err = t.reserveNextSend(ctx); err == nil && pause > 0 {
+		t.Sleep(pause)
+	}
+	return
+}
+
+func (t *SesThrottle) reserveNextSend(
+	ctx context.Context,
+) (pause time.Duration, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
 	if err = t.refresh(ctx); err != nil {
 		return
 	} else if !t.unlimited() && t.SentLast24Hours >= t.Max24HourSend {
@@ -94,7 +142,7 @@ func (t *SesThrottle) PauseBeforeNextSend(ctx context.Context) (err error) {
 	if t.LastSend.Before(now) {
 		t.LastSend = now
 	} else {
-		t.Sleep(t.LastSend.Sub(now))
+		pause = t.LastSend.Sub(now)
 	}
 	t.SentLast24Hours++
 	return
@@ -126,10 +174,19 @@ func (t *SesThrottle) refresh(ctx context.Context) (err error) {
 	}
 	quota := output.SendQuota
 
-	t.PauseInterval = time.Duration(float64(time.Second) / quota.MaxSendRate)
+	t.PauseInterval = time.Duration(float64(time.Second) / t.rate(quota))
 	t.Max24HourSend = int64(quota.Max24HourSend)
 	t.SentLast24Hours = int64(quota.SentLast24Hours)
 	t.MaxBulkSendable = t.MaxBulkCapacity.MaxAvailable(t.Max24HourSend)
 	t.Updated = now
 	return
 }
+
+func (t *SesThrottle) rate(quota *sesv2types.SendQuota) float64 {
+	if t.SendRate > 0 {
+		return min(t.SendRate, quota.MaxSendRate)
+	} else if capacity := t.MaxSendRateCapacity.Value(); capacity != 0 {
+		return quota.MaxSendRate * capacity
+	}
+	return quota.MaxSendRate * DefaultMaxSendRateCapacity
+}
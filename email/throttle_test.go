@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,6 +25,8 @@ type sesThrottleFixture struct {
 	client        *TestSesV2
 	quota         *sesv2types.SendQuota
 	capacity      types.Capacity
+	rateCapacity  types.Capacity
+	sendRate      float64
 	sleepDuration time.Duration
 	sleep         func(time.Duration)
 	now           time.Time
@@ -32,6 +35,7 @@ type sesThrottleFixture struct {
 
 func newSesThrottleFixture() *sesThrottleFixture {
 	capacity, _ := types.NewCapacity(0.75)
+	rateCapacity, _ := types.NewCapacity(0.8)
 	f := &sesThrottleFixture{
 		ctx:    context.Background(),
 		client: &TestSesV2{},
@@ -40,9 +44,10 @@ func newSesThrottleFixture() *sesThrottleFixture {
 			Max24HourSend:   50000.0,
 			SentLast24Hours: 25000.0,
 		},
-		capacity: capacity,
-		now:      testdata.TestTimestamp,
-		refresh:  time.Minute,
+		capacity:     capacity,
+		rateCapacity: rateCapacity,
+		now:          testdata.TestTimestamp,
+		refresh:      time.Minute,
 	}
 	f.client.getAccountOutput = &sesv2.GetAccountOutput{SendQuota: f.quota}
 	f.sleep = func(sleepFor time.Duration) {
@@ -53,7 +58,16 @@ func newSesThrottleFixture() *sesThrottleFixture {
 
 func (f *sesThrottleFixture) NewSesThrottle() (*SesThrottle, error) {
 	now := func() time.Time { return f.now }
-	return NewSesThrottle(f.ctx, f.client, f.capacity, f.sleep, now, f.refresh)
+	return NewSesThrottle(
+		f.ctx,
+		f.client,
+		f.capacity,
+		f.rateCapacity,
+		f.sendRate,
+		f.sleep,
+		now,
+		f.refresh,
+	)
 }
 
 func (f *sesThrottleFixture) NewSesThrottleFailOnErr(
@@ -80,7 +94,7 @@ func TestNewSesThrottleIncludingRefresh(t *testing.T) {
 		assert.Assert(t, f.client.getAccountInput != nil)
 		assert.Equal(t, f.client, throttle.Client)
 		assert.Equal(t, f.now, throttle.Updated)
-		assert.Equal(t, time.Duration(time.Second/25), throttle.PauseInterval)
+		assert.Equal(t, time.Duration(time.Second/20), throttle.PauseInterval)
 		assert.Assert(t, testutils.TimesEqual(time.Time{}, throttle.LastSend))
 		assert.Equal(t, time.Second, f.sleepDuration)
 		assert.Equal(t, f.refresh, throttle.RefreshInterval)
@@ -102,6 +116,38 @@ func TestNewSesThrottleIncludingRefresh(t *testing.T) {
 		assert.Assert(t, throttle.unlimited() == true)
 	})
 
+	t.Run("DefaultsToSafeFractionOfMaxSendRate", func(t *testing.T) {
+		f := newSesThrottleFixture()
+		f.rateCapacity = types.Capacity{}
+
+		throttle, err := f.NewSesThrottle()
+
+		assert.NilError(t, err)
+		rate := f.quota.MaxSendRate * DefaultMaxSendRateCapacity
+		expected := time.Duration(float64(time.Second) / rate)
+		assert.Equal(t, expected, throttle.PauseInterval)
+	})
+
+	t.Run("UsesExplicitSendRate", func(t *testing.T) {
+		f := newSesThrottleFixture()
+		f.sendRate = 10.0
+
+		throttle, err := f.NewSesThrottle()
+
+		assert.NilError(t, err)
+		assert.Equal(t, time.Duration(time.Second/10), throttle.PauseInterval)
+	})
+
+	t.Run("LimitsExplicitSendRateToMaxSendRate", func(t *testing.T) {
+		f := newSesThrottleFixture()
+		f.sendRate = 100.0
+
+		throttle, err := f.NewSesThrottle()
+
+		assert.NilError(t, err)
+		assert.Equal(t, time.Duration(time.Second/25), throttle.PauseInterval)
+	})
+
 	t.Run("FailsIfRefreshFails", func(t *testing.T) {
 		f := newSesThrottleFixture()
 		f.client.getAccountError = errors.New("test error")
@@ -272,4 +318,38 @@ func TestPauseBeforeNextSend(t *testing.T) {
 		assert.Assert(t, testutils.TimesEqual(time.Time{}, throttle.LastSend))
 		assert.Equal(t, throttle.Max24HourSend, throttle.SentLast24Hours)
 	})
+
+	t.Run("SpacesConcurrentSends", func(t *testing.T) {
+		f, throttle := setup(t)
+		const numSends = 10
+		throttle.SentLast24Hours = 0
+		var mutex sync.Mutex
+		var totalPause time.Duration
+		throttle.Sleep = func(pause time.Duration) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			totalPause += pause
+		}
+		errs := make([]error, numSends)
+		var wg sync.WaitGroup
+
+		for i := range numSends {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = throttle.PauseBeforeNextSend(f.ctx)
+			}()
+		}
+		wg.Wait()
+
+		assert.NilError(t, errors.Join(errs...))
+		assert.Equal(t, int64(numSends), throttle.SentLast24Hours)
+		// The first send doesn't pause, the second pauses for one interval,
+		// the third for two intervals, etc.
+		assert.Equal(t, 45*throttle.PauseInterval, totalPause)
+		expectedLastSend := f.now.Add((numSends - 1) * throttle.PauseInterval)
+		assert.Assert(
+			t, testutils.TimesEqual(expectedLastSend, throttle.LastSend),
+		)
+	})
 }
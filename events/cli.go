@@ -9,16 +9,24 @@ type CommandLineEventType string
 const (
 	CommandLineSendEvent   = CommandLineEventType("Send")
 	CommandLineImportEvent = CommandLineEventType("Import")
+
+	CommandLineRevalidateEvent = CommandLineEventType("Revalidate")
 )
 
 type CommandLineEvent struct {
 	EListManCommand CommandLineEventType `json:"elistmanCommand"`
 	Send            *SendEvent           `json:"send"`
 	Import          *ImportEvent         `json:"import"`
+	Revalidate      *RevalidateEvent     `json:"revalidate"`
 }
 
+// SendEvent describes a message to send to the list.
+//
+// If TestAddress is set, the message is sent only to that address, whether or
+// not it belongs to a subscriber, and Addresses is ignored.
 type SendEvent struct {
-	Addresses []string
+	Addresses   []string
+	TestAddress string
 	email.Message
 }
 
@@ -28,11 +36,58 @@ type SendResponse struct {
 	Details string
 }
 
+// ImportEvent requests importing Addresses as verified subscribers.
+//
+// DryRun validates the addresses without importing any of them. SkipValidation
+// imports the addresses without validating any of them.
 type ImportEvent struct {
-	Addresses []string
+	Addresses      []string
+	DryRun         bool
+	SkipValidation bool
+}
+
+// ImportFailure describes an address that wasn't imported.
+//
+// Suppressed is true if the address is on the account-level suppression list.
+type ImportFailure struct {
+	Address    string
+	Reason     string
+	Suppressed bool
 }
 
+// ImportResponse reports the outcome of an ImportEvent.
+//
+// NumImported is the number of addresses that would've been imported if the
+// ImportEvent was a DryRun. Details describes the error if writing the
+// subscribers failed, in which case Failures contains every address not
+// written.
 type ImportResponse struct {
 	NumImported int
-	Failures    []string
+	Failures    []ImportFailure
+	Details     string
+}
+
+// RevalidateEvent requests validation of up to MaxSubscribers verified
+// subscribers, removing those that fail.
+//
+// StartKey is the NextStartKey from a previous RevalidateResponse, or empty to
+// begin with the first verified subscriber. Rate, if greater than zero, is the
+// maximum number of subscribers to validate per second.
+type RevalidateEvent struct {
+	StartKey       string
+	MaxSubscribers int
+	Rate           float64
+}
+
+// RevalidateResponse reports the outcome of a RevalidateEvent.
+//
+// Removed contains the address and validation failure reason of each
+// subscriber removed. NextStartKey is empty once every verified subscriber has
+// been validated.
+type RevalidateResponse struct {
+	Success      bool
+	NumValidated int
+	Removed      []string
+	NextStartKey string
+	Details      string
 }
@@ -1,8 +1,11 @@
 // These types aren't defined in the AWS SDK. Note that not all event types are
 // defined here; only the ones needed by this application, namely:
 // - bounce
+// - click
 // - complaint
 // - delivery
+// - deliveryDelay
+// - open
 // - send
 // - reject
 //
@@ -13,6 +16,8 @@
 package events
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -26,6 +31,69 @@ type SesEventRecord struct {
 	Delivery  *SesDeliveryEvent  `json:"delivery"`
 	Send      *SesSendEvent      `json:"send"`
 	Reject    *SesRejectEvent    `json:"reject"`
+	Open      *SesOpenEvent      `json:"open"`
+	Click     *SesClickEvent     `json:"click"`
+
+	DeliveryDelay *SesDeliveryDelayEvent `json:"deliveryDelay"`
+}
+
+// SchemaDriftError indicates that an SES event is valid JSON, but at least one
+// field doesn't match the type expected by SesEventRecord.
+//
+// This can happen if SES changes its event schema. ParseSesEventRecord returns
+// this error along with a partial SesEventRecord.
+type SchemaDriftError struct {
+	Err error
+}
+
+func (e *SchemaDriftError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SchemaDriftError) Unwrap() error {
+	return e.Err
+}
+
+// ParseSesEventRecord parses the JSON of an SES event, such as the Message of
+// an SNS notification published by SES.
+//
+// If message is valid JSON containing an eventType, but other fields don't
+// match their expected types, err will be a *SchemaDriftError. In this case,
+// record will also be non-nil, containing the EventType and as much of the
+// Mail field as could be decoded. The caller may then decide whether to use
+// the partial record or to discard it.
+//
+// For any other error, record will be nil.
+func ParseSesEventRecord(message string) (record *SesEventRecord, err error) {
+	record = &SesEventRecord{}
+
+	if err = json.Unmarshal([]byte(message), record); err == nil {
+		return
+	} else if record = parseSesEventRecordLoosely(message); record != nil {
+		err = &SchemaDriftError{err}
+	}
+	return
+}
+
+// parseSesEventRecordLoosely extracts only the event type and mail fields.
+//
+// It relies on the fact that, after a type mismatch, json.Unmarshal continues
+// decoding the rest of its input as best it can. As a result, the returned
+// SesEventMessage may be incomplete.
+//
+// Returns nil if the message isn't valid JSON or doesn't contain an eventType.
+func parseSesEventRecordLoosely(message string) *SesEventRecord {
+	loose := &struct {
+		EventType string          `json:"eventType"`
+		Mail      SesEventMessage `json:"mail"`
+	}{}
+	var typeErr *json.UnmarshalTypeError
+
+	err := json.Unmarshal([]byte(message), loose)
+	if (err != nil && !errors.As(err, &typeErr)) || loose.EventType == "" {
+		return nil
+	}
+	return &SesEventRecord{EventType: loose.EventType, Mail: loose.Mail}
 }
 
 type SesEventMessage struct {
@@ -73,6 +141,24 @@ type SesDeliveryEvent struct {
 	ReportingMTA         string    `json:"reportingMTA"`
 }
 
+// SesDeliveryDelayEvent reports that SES couldn't deliver a message yet, but
+// will keep trying until ExpirationTime.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-contents.html#event-publishing-retrieving-sns-contents-delivery-delay-object
+type SesDeliveryDelayEvent struct {
+	DelayType         string                `json:"delayType"`
+	DelayedRecipients []SesDelayedRecipient `json:"delayedRecipients"`
+	ExpirationTime    time.Time             `json:"expirationTime"`
+	ReportingMTA      string                `json:"reportingMTA"`
+	Timestamp         time.Time             `json:"timestamp"`
+}
+
+type SesDelayedRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
 // According to the documentation, "The JSON object that contains information
 // about a `send` event is always empty."
 type SesSendEvent struct {
@@ -81,3 +167,17 @@ type SesSendEvent struct {
 type SesRejectEvent struct {
 	Reason string `json:"reason"`
 }
+
+type SesOpenEvent struct {
+	IpAddress string    `json:"ipAddress"`
+	Timestamp time.Time `json:"timestamp"`
+	UserAgent string    `json:"userAgent"`
+}
+
+type SesClickEvent struct {
+	IpAddress string              `json:"ipAddress"`
+	Link      string              `json:"link"`
+	LinkTags  map[string][]string `json:"linkTags"`
+	Timestamp time.Time           `json:"timestamp"`
+	UserAgent string              `json:"userAgent"`
+}
@@ -0,0 +1,243 @@
+//go:build small_tests || all_tests
+
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// Adapted from:
+// https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-examples.html
+const testMailJson = `"mail": {
+    "timestamp": "1970-09-18T12:45:00.000Z",
+    "source": "no-reply@mike-bland.com",
+    "messageId": "EXAMPLE7c191be45",
+    "destination": [ "recipient@example.com" ],
+    "commonHeaders": {
+      "from": [ "no-reply@mike-bland.com" ],
+      "to": [ "recipient@example.com" ],
+      "messageId": "EXAMPLE7c191be45",
+      "subject": "Test message"
+    },
+    "tags": { "ses:configuration-set": [ "ConfigSet" ] }
+  }`
+
+func sesEventJson(eventType, field, details string) string {
+	return `{
+  "eventType": "` + eventType + `",
+  "` + field + `": ` + details + `,
+  ` + testMailJson + `
+}`
+}
+
+var testTimestamp = time.Date(1970, time.September, 18, 12, 45, 0, 0, time.UTC)
+
+func parseSesEventRecord(t *testing.T, message string) *SesEventRecord {
+	t.Helper()
+	record, err := ParseSesEventRecord(message)
+
+	assert.NilError(t, err)
+	assert.Equal(t, "EXAMPLE7c191be45", record.Mail.MessageID)
+	assert.Equal(t, "Test message", record.Mail.CommonHeaders.Subject)
+	to := record.Mail.CommonHeaders.To
+	assert.DeepEqual(t, []string{"recipient@example.com"}, to)
+	tags := map[string][]string{"ses:configuration-set": {"ConfigSet"}}
+	assert.DeepEqual(t, tags, record.Mail.Tags)
+	return record
+}
+
+func TestParseSesEventRecord(t *testing.T) {
+	t.Run("Bounce", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson("Bounce", "bounce", `{
+			"bounceType": "Permanent",
+			"bounceSubType": "General",
+			"bouncedRecipients": [{
+				"emailAddress": "recipient@example.com",
+				"action": "failed",
+				"status": "5.1.1",
+				"diagnosticCode": "smtp; 550 5.1.1 user unknown"
+			}],
+			"timestamp": "1970-09-18T12:45:00.000Z",
+			"feedbackId": "feedback",
+			"reportingMTA": "dsn; mta.example.com"
+		}`))
+
+		assert.Equal(t, "Bounce", record.EventType)
+		assert.DeepEqual(t, &SesBounceEvent{
+			BounceType:    "Permanent",
+			BounceSubType: "General",
+			BouncedRecipients: []SesBouncedRecipient{{
+				EmailAddress:   "recipient@example.com",
+				Action:         "failed",
+				Status:         "5.1.1",
+				DiagnosticCode: "smtp; 550 5.1.1 user unknown",
+			}},
+			Timestamp:    testTimestamp,
+			FeedbackId:   "feedback",
+			ReportingMTA: "dsn; mta.example.com",
+		}, record.Bounce)
+	})
+
+	t.Run("Complaint", func(t *testing.T) {
+		msg := sesEventJson("Complaint", "complaint", `{
+			"complainedRecipients": [{"emailAddress": "recipient@example.com"}],
+			"timestamp": "1970-09-18T12:45:00.000Z",
+			"feedbackId": "feedback",
+			"userAgent": "Mozilla/5.0",
+			"complaintFeedbackType": "abuse",
+			"arrivalDate": "1970-09-18T12:45:00.000Z"
+		}`)
+
+		record := parseSesEventRecord(t, msg)
+
+		assert.Equal(t, "Complaint", record.EventType)
+		assert.DeepEqual(t, &SesComplaintEvent{
+			ComplainedRecipients: []SesComplainedRecipient{
+				{EmailAddress: "recipient@example.com"},
+			},
+			Timestamp:             testTimestamp,
+			FeedbackId:            "feedback",
+			UserAgent:             "Mozilla/5.0",
+			ComplaintFeedbackType: "abuse",
+			ArrivalDate:           testTimestamp,
+		}, record.Complaint)
+	})
+
+	t.Run("Delivery", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson("Delivery", "delivery", `{
+			"timestamp": "1970-09-18T12:45:00.000Z",
+			"processingTimeMillis": 27,
+			"recipients": [ "recipient@example.com" ],
+			"smtpResponse": "250 2.6.0 Message received",
+			"reportingMTA": "mta.example.com"
+		}`))
+
+		assert.Equal(t, "Delivery", record.EventType)
+		assert.DeepEqual(t, &SesDeliveryEvent{
+			Timestamp:            testTimestamp,
+			ProcessingTimeMillis: 27,
+			Recipients:           []string{"recipient@example.com"},
+			SmtpResponse:         "250 2.6.0 Message received",
+			ReportingMTA:         "mta.example.com",
+		}, record.Delivery)
+	})
+
+	t.Run("DeliveryDelay", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson(
+			"DeliveryDelay", "deliveryDelay", `{
+			"delayType": "TransientCommunicationFailure",
+			"delayedRecipients": [{
+				"emailAddress": "recipient@example.com",
+				"status": "4.4.1",
+				"diagnosticCode": "smtp; 421 4.4.1 Unable to connect"
+			}],
+			"expirationTime": "1970-09-19T12:45:00.000Z",
+			"reportingMTA": "mta.example.com",
+			"timestamp": "1970-09-18T12:45:00.000Z"
+		}`))
+
+		assert.Equal(t, "DeliveryDelay", record.EventType)
+		assert.DeepEqual(t, &SesDeliveryDelayEvent{
+			DelayType: "TransientCommunicationFailure",
+			DelayedRecipients: []SesDelayedRecipient{{
+				EmailAddress:   "recipient@example.com",
+				Status:         "4.4.1",
+				DiagnosticCode: "smtp; 421 4.4.1 Unable to connect",
+			}},
+			ExpirationTime: testTimestamp.Add(24 * time.Hour),
+			ReportingMTA:   "mta.example.com",
+			Timestamp:      testTimestamp,
+		}, record.DeliveryDelay)
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson("Send", "send", `{}`))
+
+		assert.Equal(t, "Send", record.EventType)
+		assert.DeepEqual(t, &SesSendEvent{}, record.Send)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		record := parseSesEventRecord(
+			t, sesEventJson("Reject", "reject", `{"reason": "Bad content"}`),
+		)
+
+		assert.Equal(t, "Reject", record.EventType)
+		expected := &SesRejectEvent{Reason: "Bad content"}
+		assert.DeepEqual(t, expected, record.Reject)
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson("Open", "open", `{
+			"ipAddress": "127.0.0.1",
+			"timestamp": "1970-09-18T12:45:00.000Z",
+			"userAgent": "Mozilla/5.0"
+		}`))
+
+		assert.Equal(t, "Open", record.EventType)
+		assert.DeepEqual(t, &SesOpenEvent{
+			IpAddress: "127.0.0.1",
+			Timestamp: testTimestamp,
+			UserAgent: "Mozilla/5.0",
+		}, record.Open)
+	})
+
+	t.Run("Click", func(t *testing.T) {
+		record := parseSesEventRecord(t, sesEventJson("Click", "click", `{
+			"ipAddress": "127.0.0.1",
+			"link": "https://mike-bland.com/",
+			"linkTags": { "samplekey0": [ "samplevalue0" ] },
+			"timestamp": "1970-09-18T12:45:00.000Z",
+			"userAgent": "Mozilla/5.0"
+		}`))
+
+		assert.Equal(t, "Click", record.EventType)
+		assert.DeepEqual(t, &SesClickEvent{
+			IpAddress: "127.0.0.1",
+			Link:      "https://mike-bland.com/",
+			LinkTags:  map[string][]string{"samplekey0": {"samplevalue0"}},
+			Timestamp: testTimestamp,
+			UserAgent: "Mozilla/5.0",
+		}, record.Click)
+	})
+
+	t.Run("FailsOnSyntaxError", func(t *testing.T) {
+		record, err := ParseSesEventRecord("")
+
+		assert.Assert(t, is.Nil(record))
+		assert.ErrorContains(t, err, "unexpected end of JSON input")
+	})
+
+	t.Run("ReturnsPartialRecordOnSchemaDrift", func(t *testing.T) {
+		drifted := sesEventJson("Bounce", "bounce", `{"bounceType": 5}`)
+
+		record, err := ParseSesEventRecord(drifted)
+
+		var driftErr *SchemaDriftError
+		assert.Assert(t, errors.As(err, &driftErr))
+		var typeErr *json.UnmarshalTypeError
+		assert.Assert(t, errors.As(err, &typeErr))
+		expected := "json: cannot unmarshal number into " +
+			"Go struct field SesEventRecord.bounce.bounceType of type string"
+		assert.Error(t, err, expected)
+		assert.Equal(t, "Bounce", record.EventType)
+		assert.Assert(t, is.Nil(record.Bounce))
+		to := record.Mail.CommonHeaders.To
+		assert.DeepEqual(t, []string{"recipient@example.com"}, to)
+	})
+
+	t.Run("FailsWithoutPartialRecordIfEventTypeMissing", func(t *testing.T) {
+		record, err := ParseSesEventRecord(`{"eventType": 5}`)
+
+		var driftErr *SchemaDriftError
+		assert.Assert(t, is.Nil(record))
+		assert.Assert(t, !errors.As(err, &driftErr))
+		assert.ErrorContains(t, err, "cannot unmarshal number")
+	})
+}
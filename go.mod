@@ -15,6 +15,8 @@ require (
 	github.com/aws/smithy-go v1.22.1
 	github.com/google/uuid v1.6.0
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/net v0.33.0
+	golang.org/x/time v0.10.0
 	golang.org/x/tools v0.28.0
 	gotest.tools v2.2.0+incompatible
 	honnef.co/go/tools v0.5.1
@@ -42,5 +44,6 @@ require (
 	golang.org/x/exp/typeparams v0.0.0-20241217172543-b2144cdd0a67 // indirect
 	golang.org/x/mod v0.22.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
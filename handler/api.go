@@ -3,26 +3,83 @@ package handler
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
 	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/ops"
+	"golang.org/x/time/rate"
 )
 
 type RedirectMap map[ops.OperationResult]string
 
+// Limits on the rate of Status requests per Lambda instance.
+//
+// These help prevent enumeration of subscriber addresses. The API Gateway
+// throttling settings in template.yml limit the rate of requests across all
+// instances.
+const (
+	statusRateLimit  = 1.0
+	statusBurstLimit = 10
+)
+
 type apiHandler struct {
 	SiteTitle        string
 	Agent            agent.SubscriptionAgent
 	Redirects        RedirectMap
 	responseTemplate *template.Template
-	log              *log.Logger
+	log              Logger
+
+	// responsePages, if not nil, contains the pages to serve instead of
+	// redirecting for the results in ResponsePageFiles.
+	responsePages map[ops.OperationResult]*template.Template
+
+	// MaintenanceMode causes subscribe and verify requests to fail with HTTP
+	// 503 Service Unavailable, linking to MaintenanceUrl if it's defined.
+	MaintenanceMode bool
+	MaintenanceUrl  string
+
+	// StatusOrigin is the only web origin allowed to read Status responses.
+	StatusOrigin  string
+	StatusLimiter *rate.Limiter
+
+	// LinkSigningKey, if not empty, causes the handler to reject verify,
+	// unsubscribe, and status requests with a uid, without a valid
+	// ops.LinkSignature. See checkSignature.
+	//
+	// Status requests always fail with HTTP 404 Not Found if it's empty, so
+	// that only deployments that sign links expose the status endpoint.
+	LinkSigningKey []byte
+
+	// VerifyRetries is the number of times to retry a verify request that
+	// fails with an ops.ErrExternal error, waiting between attempts according
+	// to VerifyBackoff. Other errors and results are never retried.
+	VerifyRetries int
+
+	// VerifyBackoff defaults to DefaultVerifyBackoff if nil.
+	VerifyBackoff ops.Backoff
+
+	// Sleep waits between verify attempts, returning an error if ctx is
+	// cancelled while waiting. Defaults to ops.Sleep if nil.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	// NewCorrelationId generates the ID that HandleEvent logs and shows to
+	// the user with an error response when a request lacks a request ID.
+	NewCorrelationId func() string
+}
+
+// DefaultVerifyBackoff keeps verify retries short, since the subscriber is
+// waiting for the response.
+var DefaultVerifyBackoff ops.Backoff = &ops.FullJitterBackoff{
+	Base: 100 * time.Millisecond, Cap: time.Second,
 }
 
 func newApiHandler(
@@ -31,7 +88,7 @@ func newApiHandler(
 	agent agent.SubscriptionAgent,
 	paths RedirectPaths,
 	responseTemplate string,
-	logger *log.Logger,
+	logger Logger,
 ) (handler *apiHandler, err error) {
 	var resTmpl *template.Template
 	if resTmpl, err = initResponseBodyTemplate(responseTemplate); err != nil {
@@ -41,20 +98,45 @@ func newApiHandler(
 	fullUrl := func(path string) string {
 		return "https://" + emailDomain + "/" + path
 	}
+	blockedPath := paths.Blocked
+	if blockedPath == "" {
+		blockedPath = paths.Invalid
+	}
+	linkExpiredPath := paths.LinkExpired
+	if linkExpiredPath == "" {
+		linkExpiredPath = paths.NotSubscribed
+	}
+	unknownSubscriberPath := paths.UnknownSubscriber
+	if unknownSubscriberPath == "" {
+		unknownSubscriberPath = paths.NotSubscribed
+	}
+	maintenanceUrl := ""
+	if paths.Maintenance != "" {
+		maintenanceUrl = fullUrl(paths.Maintenance)
+	}
 
 	return &apiHandler{
-		siteTitle,
-		agent,
-		RedirectMap{
+		SiteTitle: siteTitle,
+		Agent:     agent,
+		Redirects: RedirectMap{
 			ops.Invalid:           fullUrl(paths.Invalid),
 			ops.AlreadySubscribed: fullUrl(paths.AlreadySubscribed),
 			ops.VerifyLinkSent:    fullUrl(paths.VerifyLinkSent),
 			ops.Subscribed:        fullUrl(paths.Subscribed),
 			ops.NotSubscribed:     fullUrl(paths.NotSubscribed),
 			ops.Unsubscribed:      fullUrl(paths.Unsubscribed),
+			ops.Blocked:           fullUrl(blockedPath),
+			ops.LinkExpired:       fullUrl(linkExpiredPath),
+			ops.UnknownSubscriber: fullUrl(unknownSubscriberPath),
 		},
-		resTmpl,
-		logger,
+		responseTemplate: resTmpl,
+		log:              logger,
+		MaintenanceUrl:   maintenanceUrl,
+		StatusOrigin:     "https://" + emailDomain,
+		StatusLimiter: rate.NewLimiter(
+			rate.Limit(statusRateLimit), statusBurstLimit,
+		),
+		NewCorrelationId: uuid.NewString,
 	}, nil
 }
 
@@ -97,10 +179,14 @@ func (h *apiHandler) HandleEvent(
 		res, err = h.handleApiRequest(ctx, req)
 	}
 
+	correlationId := origReq.RequestContext.RequestID
+	if correlationId == "" {
+		correlationId = h.NewCorrelationId()
+	}
 	if err != nil {
-		res = h.errorResponse(err)
+		res = h.errorResponse(err, correlationId)
 	}
-	logApiResponse(h.log, origReq, res, err)
+	logApiResponse(h.log, correlationId, origReq, res, err)
 	return
 }
 
@@ -114,7 +200,7 @@ func (h *apiHandler) addResponseBody(
 
 	if err := h.responseTemplate.Execute(builder, params); err != nil {
 		// This should never happen, but if it does, fall back to plain text.
-		h.log.Printf("ERROR adding HTML response body: %s: %+v", err, params)
+		h.log.Errorf("adding HTML response body: %s: %+v", err, params)
 		res.Headers["content-type"] = "text/plain; charset=utf-8"
 		res.Body = fmt.Sprintf("%s - %s\n\n%s\n", title, h.SiteTitle, body)
 	} else {
@@ -123,7 +209,12 @@ func (h *apiHandler) addResponseBody(
 	}
 }
 
-func (h *apiHandler) errorResponse(err error) *events.APIGatewayProxyResponse {
+// errorResponse returns an error page showing correlationId, which the user
+// can include when reporting the problem. HandleEvent logs the same ID along
+// with the error.
+func (h *apiHandler) errorResponse(
+	err error, correlationId string,
+) *events.APIGatewayProxyResponse {
 	res := &events.APIGatewayProxyResponse{
 		StatusCode: http.StatusInternalServerError,
 		Headers:    map[string]string{},
@@ -135,18 +226,21 @@ func (h *apiHandler) errorResponse(err error) *events.APIGatewayProxyResponse {
 	}
 
 	body := "<p>There was a problem on our end; " +
-		"please try again in a few minutes.</p>\n"
+		"please try again in a few minutes.</p>\n" +
+		"<p>If the problem persists, please include this reference " +
+		"when reporting it: <code>" +
+		template.HTMLEscapeString(correlationId) + "</code></p>\n"
 	h.addResponseBody(res, body)
 	return res
 }
 
 func logApiResponse(
-	log *log.Logger,
+	log Logger,
+	reqId string,
 	req *events.APIGatewayProxyRequest,
 	res *events.APIGatewayProxyResponse,
 	err error,
 ) {
-	reqId := req.RequestContext.RequestID
 	desc := req.RequestContext
 	errMsg := ""
 
@@ -210,6 +304,7 @@ func newApiRequest(req *events.APIGatewayProxyRequest) (*apiRequest, error) {
 		contentType,
 		req.PathParameters,
 		body,
+		req.QueryStringParameters,
 	}, nil
 }
 
@@ -221,10 +316,22 @@ func (h *apiHandler) handleApiRequest(
 
 	if op, err := parseApiRequest(req); err != nil {
 		return h.respondToParseError(res, err)
+	} else if h.closedForMaintenance(op) {
+		h.log.Printf("%s: maintenance mode: %s", req.Id, op)
+		return h.respondWithMaintenance(res), nil
+	} else if op.Type == Status && len(h.LinkSigningKey) == 0 {
+		h.log.Printf("%s: no link signing key: %s", req.Id, op)
+		return h.respondWithStatusDisabled(res), nil
+	} else if err := h.checkSignature(op); err != nil {
+		return h.respondToParseError(res, err)
+	} else if op.Type == Status {
+		return h.respondWithStatus(ctx, req.Id, res, op)
 	} else if result, err := h.performOperation(ctx, req.Id, op); err != nil {
 		return nil, err
 	} else if op.OneClick {
 		res.StatusCode = http.StatusOK
+	} else if page, ok := h.responsePages[result]; ok {
+		return h.respondWithPage(res, page, result)
 	} else if redirect, ok := h.Redirects[result]; !ok {
 		return nil, fmt.Errorf("no redirect for op result: %s", result)
 	} else {
@@ -234,6 +341,58 @@ func (h *apiHandler) handleApiRequest(
 	return res, nil
 }
 
+func (h *apiHandler) closedForMaintenance(op *eventOperation) bool {
+	return h.MaintenanceMode && (op.Type == Subscribe || op.Type == Verify)
+}
+
+// maintenanceRetryAfter is the Retry-After header value, in seconds, of
+// responses to requests received in maintenance mode.
+const maintenanceRetryAfter = "3600"
+
+// respondWithMaintenance responds with 503 Service Unavailable and Retry-After.
+//
+// It doesn't set a Location header, which is only meaningful for redirects.
+// Instead, the body links to MaintenanceUrl if it's defined.
+func (h *apiHandler) respondWithMaintenance(
+	res *events.APIGatewayProxyResponse,
+) *events.APIGatewayProxyResponse {
+	res.StatusCode = http.StatusServiceUnavailable
+	res.Headers["retry-after"] = maintenanceRetryAfter
+	body := "<p>Signups are temporarily closed for maintenance. " +
+		"Please try again later.</p>"
+
+	if h.MaintenanceUrl != "" {
+		body += "\n<p><a href=\"" + h.MaintenanceUrl + "\">" +
+			"More information</a></p>"
+	}
+	h.addResponseBody(res, body)
+	return res
+}
+
+// checkSignature validates the signature of verify, unsubscribe, and status
+// requests.
+//
+// Status requests without a uid parameter don't require a signature. Nothing
+// issues such signatures, and a browser widget checking the status of a newly
+// submitted address can't compute one without exposing the key. Such requests
+// reveal no more than a subscribe request for the same address, and are still
+// subject to StatusLimiter. Status requests with a uid must be signed like any
+// verify or unsubscribe link.
+//
+// It returns a *ParseError so the handler responds with HTTP 400 Bad Request
+// before performing any operation.
+func (h *apiHandler) checkSignature(op *eventOperation) error {
+	if op.Type == Subscribe || (op.Type == Status && op.Uid == uuid.Nil) {
+		return nil
+	}
+	key := h.LinkSigningKey
+	err := ops.CheckLinkSignature(key, op.Email, op.Uid, op.Signature)
+	if err != nil {
+		return &ParseError{op.Type, err.Error()}
+	}
+	return nil
+}
+
 func (h *apiHandler) respondToParseError(
 	response *events.APIGatewayProxyResponse, err error,
 ) (*events.APIGatewayProxyResponse, error) {
@@ -252,6 +411,60 @@ func (h *apiHandler) respondToParseError(
 	return response, nil
 }
 
+// respondWithStatusDisabled responds to a status request with HTTP 404 Not
+// Found when no LinkSigningKey is defined.
+func (h *apiHandler) respondWithStatusDisabled(
+	res *events.APIGatewayProxyResponse,
+) *events.APIGatewayProxyResponse {
+	res.Headers["content-type"] = "application/json"
+	res.StatusCode = http.StatusNotFound
+	res.Body = `{"error":"not found"}`
+	return res
+}
+
+type statusResponse struct {
+	Email  string              `json:"email"`
+	Status db.SubscriberStatus `json:"status"`
+}
+
+// respondWithStatus returns the status of the subscriber as JSON.
+//
+// The status is "pending", "verified", or "unknown" if no subscriber exists
+// for the address.
+func (h *apiHandler) respondWithStatus(
+	ctx context.Context,
+	requestId string,
+	res *events.APIGatewayProxyResponse,
+	op *eventOperation,
+) (*events.APIGatewayProxyResponse, error) {
+	res.Headers["content-type"] = "application/json"
+	res.Headers["access-control-allow-origin"] = h.StatusOrigin
+
+	if !h.StatusLimiter.Allow() {
+		h.log.Printf("%s: rate limited: %s", requestId, op)
+		res.StatusCode = http.StatusTooManyRequests
+		res.Headers["retry-after"] = "1"
+		res.Body = `{"error":"too many requests"}`
+		return res, nil
+	}
+
+	status, err := h.Agent.Status(ctx, op.Email)
+	if err != nil {
+		h.log.Printf("%s: ERROR: %s: %s", requestId, op, err)
+		if errors.Is(err, ops.ErrExternal) {
+			err = &errorWithStatus{http.StatusBadGateway, err.Error()}
+		}
+		return nil, err
+	}
+	h.log.Printf("%s: result: %s: %s", requestId, op, status)
+
+	// Marshaling two strings can't fail.
+	body, _ := json.Marshal(&statusResponse{op.Email, status})
+	res.StatusCode = http.StatusOK
+	res.Body = string(body)
+	return res, nil
+}
+
 func (h *apiHandler) performOperation(
 	ctx context.Context, requestId string, op *eventOperation,
 ) (result ops.OperationResult, err error) {
@@ -259,12 +472,17 @@ func (h *apiHandler) performOperation(
 	case Subscribe:
 		result, err = h.Agent.Subscribe(ctx, op.Email)
 	case Verify:
-		result, err = h.Agent.Verify(ctx, op.Email, op.Uid)
+		result, err = h.verify(ctx, requestId, op)
 	case Unsubscribe:
 		result, err = h.Agent.Unsubscribe(ctx, op.Email, op.Uid)
 	default:
 		err = fmt.Errorf("can't handle operation type: %s", op.Type)
 	}
+
+	if errors.Is(err, ops.ErrBlocked) {
+		h.log.Printf("%s: %s", requestId, err)
+		result, err = ops.Blocked, nil
+	}
 	logOperationResult(h.log, requestId, op, result, err)
 
 	if errors.Is(err, ops.ErrExternal) {
@@ -273,8 +491,38 @@ func (h *apiHandler) performOperation(
 	return
 }
 
+// verify calls Agent.Verify, retrying up to VerifyRetries times after errors
+// from upstream services, which are likely transient.
+//
+// It returns ctx.Err() if ctx is cancelled while waiting to retry.
+func (h *apiHandler) verify(
+	ctx context.Context, requestId string, op *eventOperation,
+) (result ops.OperationResult, err error) {
+	backoff := h.VerifyBackoff
+	if backoff == nil {
+		backoff = DefaultVerifyBackoff
+	}
+	sleep := ops.Sleep
+	if h.Sleep != nil {
+		sleep = h.Sleep
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err = h.Agent.Verify(ctx, op.Email, op.Uid)
+		if !errors.Is(err, ops.ErrExternal) || attempt > h.VerifyRetries {
+			return
+		}
+		delay := backoff.NextDelay(attempt)
+		const logFmt = "%s: retrying in %s after attempt %d: %s: %s"
+		h.log.Printf(logFmt, requestId, delay, attempt, op, err)
+		if err = sleep(ctx, delay); err != nil {
+			return ops.Invalid, err
+		}
+	}
+}
+
 func logOperationResult(
-	log *log.Logger,
+	log Logger,
 	requestId string,
 	op *eventOperation,
 	result ops.OperationResult,
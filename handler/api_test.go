@@ -12,10 +12,15 @@ import (
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
+	"golang.org/x/time/rate"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 )
@@ -63,7 +68,7 @@ func newApiHandlerFixture() *apiHandlerFixture {
 		agent,
 		testRedirects,
 		ResponseTemplate,
-		logs.NewLogger(),
+		NewStdLogger(logs.NewLogger()),
 	)
 
 	if err != nil {
@@ -91,11 +96,87 @@ func TestNewApiHandler(t *testing.T) {
 			ops.Subscribed:        fullUrl(testRedirects.Subscribed),
 			ops.NotSubscribed:     fullUrl(testRedirects.NotSubscribed),
 			ops.Unsubscribed:      fullUrl(testRedirects.Unsubscribed),
+			ops.Blocked:           fullUrl(testRedirects.Blocked),
+			ops.LinkExpired:       fullUrl(testRedirects.LinkExpired),
+			ops.UnknownSubscriber: fullUrl(testRedirects.UnknownSubscriber),
 		}
 
 		assert.DeepEqual(t, expected, f.handler.Redirects)
 	})
 
+	t.Run("RedirectsBlockedToInvalidIfBlockedPathEmpty", func(t *testing.T) {
+		paths := testRedirects
+		paths.Blocked = ""
+
+		handler, err := newApiHandler(
+			testEmailDomain,
+			testSiteTitle,
+			&testAgent{},
+			paths,
+			ResponseTemplate,
+			NewStdLogger(&log.Logger{}),
+		)
+
+		assert.NilError(t, err)
+		invalidUrl := handler.Redirects[ops.Invalid]
+		assert.Equal(t, invalidUrl, handler.Redirects[ops.Blocked])
+	})
+
+	t.Run("RedirectsLinkExpiredToNotSubscribedIfPathEmpty", func(t *testing.T) {
+		paths := testRedirects
+		paths.LinkExpired = ""
+
+		handler, err := newApiHandler(
+			testEmailDomain,
+			testSiteTitle,
+			&testAgent{},
+			paths,
+			ResponseTemplate,
+			NewStdLogger(&log.Logger{}),
+		)
+
+		assert.NilError(t, err)
+		notSubscribedUrl := handler.Redirects[ops.NotSubscribed]
+		assert.Equal(t, notSubscribedUrl, handler.Redirects[ops.LinkExpired])
+	})
+
+	t.Run("RedirectsUnknownToNotSubscribedIfPathEmpty", func(t *testing.T) {
+		paths := testRedirects
+		paths.UnknownSubscriber = ""
+
+		handler, err := newApiHandler(
+			testEmailDomain,
+			testSiteTitle,
+			&testAgent{},
+			paths,
+			ResponseTemplate,
+			NewStdLogger(&log.Logger{}),
+		)
+
+		assert.NilError(t, err)
+		notSubscribedUrl := handler.Redirects[ops.NotSubscribed]
+		unknownUrl := handler.Redirects[ops.UnknownSubscriber]
+		assert.Equal(t, notSubscribedUrl, unknownUrl)
+	})
+
+	t.Run("SetsMaintenanceUrlIfMaintenancePathDefined", func(t *testing.T) {
+		paths := testRedirects
+		paths.Maintenance = "maintenance"
+
+		handler, err := newApiHandler(
+			testEmailDomain,
+			testSiteTitle,
+			&testAgent{},
+			paths,
+			ResponseTemplate,
+			NewStdLogger(&log.Logger{}),
+		)
+
+		assert.NilError(t, err)
+		expected := "https://" + testEmailDomain + "/maintenance"
+		assert.Equal(t, expected, handler.MaintenanceUrl)
+	})
+
 	t.Run("ReturnsErrorIfTemplateFailsToParse", func(t *testing.T) {
 		tmpl := "{{.Bogus}}"
 
@@ -105,7 +186,7 @@ func TestNewApiHandler(t *testing.T) {
 			&testAgent{},
 			testRedirects,
 			tmpl,
-			&log.Logger{},
+			NewStdLogger(&log.Logger{}),
 		)
 
 		assert.Assert(t, is.Nil(handler))
@@ -139,7 +220,7 @@ func TestAddResponseBody(t *testing.T) {
 		assert.Equal(t, res.Headers["content-type"], "text/plain; charset=utf-8")
 		assert.Assert(t, is.Contains(res.Body, "This is only a test"))
 		assert.Assert(t, is.Contains(res.Body, "200 OK - "+testSiteTitle))
-		f.logs.AssertContains(t, "ERROR adding HTML response body:")
+		f.logs.AssertContains(t, "ERROR: adding HTML response body:")
 	})
 }
 
@@ -167,10 +248,11 @@ func TestErrorResponse(t *testing.T) {
 	f := newApiHandlerFixture()
 
 	t.Run("ReturnInternalServerErrorByDefault", func(t *testing.T) {
-		res := f.handler.errorResponse(fmt.Errorf("bad news..."))
+		res := f.handler.errorResponse(fmt.Errorf("bad news..."), "deadbeef")
 
 		assert.Equal(t, res.StatusCode, http.StatusInternalServerError)
 		assert.Assert(t, is.Contains(res.Body, "There was a problem on our end"))
+		assert.Assert(t, is.Contains(res.Body, "<code>deadbeef</code>"))
 	})
 
 	t.Run("ReturnStatusFromError", func(t *testing.T) {
@@ -179,7 +261,7 @@ func TestErrorResponse(t *testing.T) {
 			newBadGatewayError("not our fault..."),
 		)
 
-		res := f.handler.errorResponse(err)
+		res := f.handler.errorResponse(err, "deadbeef")
 
 		assert.Equal(t, res.StatusCode, http.StatusBadGateway)
 		assert.Assert(t, is.Contains(res.Body, "There was a problem on our end"))
@@ -195,20 +277,23 @@ func TestLogApiResponse(t *testing.T) {
 		logs := testutils.Logs{}
 		res := apiGatewayResponse(http.StatusOK)
 
-		logApiResponse(logs.NewLogger(), req, res, nil)
+		logger := NewStdLogger(logs.NewLogger())
+		logApiResponse(logger, "deadbeef", req, res, nil)
 
-		expectedMsg := `192.168.0.1 "GET ` + ops.ApiPrefixVerify +
+		expectedMsg := `deadbeef: 192.168.0.1 "GET ` + ops.ApiPrefixVerify +
 			`mbland@acm.org/0123-456-789 HTTP/2" 200`
 		logs.AssertContains(t, expectedMsg)
 	})
 
 	t.Run("WithError", func(t *testing.T) {
-		logs, logger := testutils.NewLogs()
+		logs, logger := newTestLogs()
 		res := apiGatewayResponse(http.StatusInternalServerError)
 
-		logApiResponse(logger, req, res, errors.New("unexpected problem"))
+		err := errors.New("unexpected problem")
+
+		logApiResponse(logger, "deadbeef", req, res, err)
 
-		expectedMsg := `192.168.0.1 "GET ` + ops.ApiPrefixVerify +
+		expectedMsg := `deadbeef: 192.168.0.1 "GET ` + ops.ApiPrefixVerify +
 			`mbland@acm.org/0123-456-789 HTTP/2" 500: unexpected problem`
 		logs.AssertContains(t, expectedMsg)
 	})
@@ -238,7 +323,7 @@ func TestNewApiRequest(t *testing.T) {
 	}
 
 	expectedReq := &apiRequest{
-		requestId, rawPath, http.MethodPost, contentType, pathParams, body,
+		requestId, rawPath, http.MethodPost, contentType, pathParams, body, nil,
 	}
 
 	t.Run("Succeeds", func(t *testing.T) {
@@ -339,7 +424,7 @@ func TestLogOperationResult(t *testing.T) {
 	}
 
 	t.Run("SuccessfulResult", func(t *testing.T) {
-		logs, logger := testutils.NewLogs()
+		logs, logger := newTestLogs()
 
 		logOperationResult(logger, "deadbeef", op, ops.Subscribed, nil)
 
@@ -349,7 +434,7 @@ func TestLogOperationResult(t *testing.T) {
 	})
 
 	t.Run("SuccessfulResult", func(t *testing.T) {
-		logs, logger := testutils.NewLogs()
+		logs, logger := newTestLogs()
 
 		logOperationResult(
 			logger, "deadbeef", op, ops.Subscribed, errors.New("whoops..."),
@@ -440,6 +525,143 @@ func TestPerformOperation(t *testing.T) {
 		f.logs.AssertContains(t, expectedLog)
 		f.logs.AssertContains(t, "not our fault...")
 	})
+
+	t.Run("ReturnsBlockedResultIfAddressBlocked", func(t *testing.T) {
+		f := newApiHandlerFixture()
+		f.agent.Error = fmt.Errorf("%w: mbland@acm.org", ops.ErrBlocked)
+
+		result, err := f.handler.performOperation(
+			f.ctx,
+			"deadbeef",
+			&eventOperation{Type: Subscribe, Email: "mbland@acm.org"},
+		)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.Blocked, result)
+		f.logs.AssertContains(t, "deadbeef: address is blocked: mbland@acm.org")
+		expectedLog := "deadbeef: result: Subscribe: mbland@acm.org: Blocked"
+		f.logs.AssertContains(t, expectedLog)
+	})
+}
+
+// flakyVerifyAgent returns each of Errors in turn from Verify before
+// returning the testAgent's result.
+type flakyVerifyAgent struct {
+	*testAgent
+	Errors []error
+}
+
+func (a *flakyVerifyAgent) Verify(
+	ctx context.Context, email string, uid uuid.UUID,
+) (ops.OperationResult, error) {
+	result, err := a.testAgent.Verify(ctx, email, uid)
+	if len(a.Errors) != 0 {
+		result, err = ops.Invalid, a.Errors[0]
+		a.Errors = a.Errors[1:]
+	}
+	return result, err
+}
+
+func TestVerifyRetries(t *testing.T) {
+	op := &eventOperation{
+		Type: Verify, Email: "mbland@acm.org", Uid: testValidUid,
+	}
+
+	setup := func(errs ...error) (*apiHandlerFixture, *[]time.Duration) {
+		f := newApiHandlerFixture()
+		f.agent.OpResult = ops.Subscribed
+		f.handler.Agent = &flakyVerifyAgent{f.agent, errs}
+		f.handler.VerifyRetries = 2
+		f.handler.VerifyBackoff = &ops.FixedBackoff{Delay: time.Millisecond}
+		delays := []time.Duration{}
+		f.handler.Sleep = func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+		return f, &delays
+	}
+
+	t.Run("SucceedsAfterTransientError", func(t *testing.T) {
+		f, delays := setup(newOpsErrExternal("throttled"))
+
+		result, err := f.handler.performOperation(f.ctx, "deadbeef", op)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.Subscribed, result)
+		assert.Assert(t, is.Len(f.agent.Calls, 2))
+		assert.DeepEqual(t, []time.Duration{time.Millisecond}, *delays)
+		f.logs.AssertContains(
+			t, "deadbeef: retrying in 1ms after attempt 1: Verify: ",
+		)
+		f.logs.AssertContains(t, "deadbeef: result: Verify")
+	})
+
+	t.Run("FailsAfterRetriesExhausted", func(t *testing.T) {
+		f, delays := setup(
+			newOpsErrExternal("throttled"),
+			newOpsErrExternal("throttled"),
+			newOpsErrExternal("still throttled"),
+		)
+
+		result, err := f.handler.performOperation(f.ctx, "deadbeef", op)
+
+		assert.Equal(t, ops.Invalid, result)
+		assert.DeepEqual(t, newBadGatewayError("still throttled"), err)
+		assert.Assert(t, is.Len(f.agent.Calls, 3))
+		assert.Assert(t, is.Len(*delays, 2))
+	})
+
+	t.Run("DoesNotRetryNonTransientError", func(t *testing.T) {
+		conditionErr := errors.New("ConditionalCheckFailedException")
+		f, delays := setup(conditionErr)
+
+		result, err := f.handler.performOperation(f.ctx, "deadbeef", op)
+
+		assert.Equal(t, ops.Invalid, result)
+		assert.Assert(t, testutils.ErrorIs(err, conditionErr))
+		assert.Assert(t, is.Len(f.agent.Calls, 1))
+		assert.Assert(t, is.Len(*delays, 0))
+	})
+
+	t.Run("DoesNotRetryUnsuccessfulResult", func(t *testing.T) {
+		f, delays := setup()
+		f.agent.OpResult = ops.AlreadySubscribed
+
+		result, err := f.handler.performOperation(f.ctx, "deadbeef", op)
+
+		assert.NilError(t, err)
+		assert.Equal(t, ops.AlreadySubscribed, result)
+		assert.Assert(t, is.Len(f.agent.Calls, 1))
+		assert.Assert(t, is.Len(*delays, 0))
+	})
+
+	t.Run("StopsRetryingIfContextCancelled", func(t *testing.T) {
+		f, _ := setup(newOpsErrExternal("throttled"))
+		f.handler.VerifyBackoff = &ops.FixedBackoff{Delay: time.Minute}
+		ctx, cancel := context.WithCancel(f.ctx)
+		f.handler.Sleep = func(ctx context.Context, d time.Duration) error {
+			cancel()
+			return ops.Sleep(ctx, d)
+		}
+
+		result, err := f.handler.performOperation(ctx, "deadbeef", op)
+
+		assert.Equal(t, ops.Invalid, result)
+		assert.Assert(t, testutils.ErrorIs(err, context.Canceled))
+		assert.Assert(t, is.Len(f.agent.Calls, 1))
+		f.logs.AssertContains(t, "deadbeef: ERROR: Verify: ")
+	})
+
+	t.Run("DoesNotRetryByDefault", func(t *testing.T) {
+		f, delays := setup(newOpsErrExternal("throttled"))
+		f.handler.VerifyRetries = 0
+
+		_, err := f.handler.performOperation(f.ctx, "deadbeef", op)
+
+		assert.DeepEqual(t, newBadGatewayError("throttled"), err)
+		assert.Assert(t, is.Len(f.agent.Calls, 1))
+		assert.Assert(t, is.Len(*delays, 0))
+	})
 }
 
 func TestHandleApiRequest(t *testing.T) {
@@ -473,6 +695,34 @@ func TestHandleApiRequest(t *testing.T) {
 		assert.Equal(t, expected, response.Headers["location"])
 	})
 
+	t.Run("VerifyRedirectsEachResultToItsPath", func(t *testing.T) {
+		expected := map[ops.OperationResult]string{
+			ops.Subscribed:        testRedirects.Subscribed,
+			ops.AlreadySubscribed: testRedirects.AlreadySubscribed,
+			ops.LinkExpired:       testRedirects.LinkExpired,
+			ops.UnknownSubscriber: testRedirects.UnknownSubscriber,
+			ops.NotSubscribed:     testRedirects.NotSubscribed,
+		}
+
+		for result, path := range expected {
+			t.Run(result.String(), func(t *testing.T) {
+				f := newApiHandlerFixture()
+				f.agent.OpResult = result
+				req := newUnsubscribeRequest()
+				req.RawPath = ops.ApiPrefixVerify + "mbland@acm.org/" +
+					testValidUidStr
+				req.Method = http.MethodGet
+
+				response, err := f.handler.handleApiRequest(f.ctx, req)
+
+				assert.NilError(t, err)
+				assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+				expectedUrl := "https://" + testEmailDomain + "/" + path
+				assert.Equal(t, expectedUrl, response.Headers["location"])
+			})
+		}
+	})
+
 	t.Run("ReturnsBadRequestIfParsingFails", func(t *testing.T) {
 		f := newApiHandlerFixture()
 		req := newUnsubscribeRequest()
@@ -485,6 +735,321 @@ func TestHandleApiRequest(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
 	})
 
+	t.Run("SignatureChecks", func(t *testing.T) {
+		const signingKey = "link signing key"
+		setup := func() (*apiHandlerFixture, *apiRequest) {
+			f := newApiHandlerFixture()
+			f.agent.OpResult = ops.Unsubscribed
+			f.handler.LinkSigningKey = []byte(signingKey)
+			return f, newUnsubscribeRequest()
+		}
+		validSig := ops.LinkSignature(
+			[]byte(signingKey), "mbland@acm.org", testValidUid,
+		)
+
+		t.Run("SucceedsWithValidSignature", func(t *testing.T) {
+			f, req := setup()
+			req.Query = map[string]string{ops.ApiParamSignature: validSig}
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "mbland@acm.org", f.agent.Email)
+			assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+		})
+
+		t.Run("ReturnsBadRequestIfSignatureTampered", func(t *testing.T) {
+			f, req := setup()
+			req.Params["email"] = "foo@bar.com"
+			req.Query = map[string]string{ops.ApiParamSignature: validSig}
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "", f.agent.Email)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			assert.Assert(
+				t, is.Contains(response.Body, ops.ErrInvalidSignature.Error()),
+			)
+		})
+
+		t.Run("ReturnsBadRequestIfSignatureMissing", func(t *testing.T) {
+			f, req := setup()
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "", f.agent.Email)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			expected := "missing " + ops.ApiParamSignature
+			assert.Assert(t, is.Contains(response.Body, expected))
+		})
+
+		t.Run("IgnoresSignatureWithoutSigningKey", func(t *testing.T) {
+			f, req := setup()
+			f.handler.LinkSigningKey = nil
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "mbland@acm.org", f.agent.Email)
+			assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+		})
+	})
+
+	t.Run("MaintenanceMode", func(t *testing.T) {
+		newSubscribeRequest := func() *apiRequest {
+			return &apiRequest{
+				Id:          "deadbeef",
+				RawPath:     ops.ApiPrefixSubscribe,
+				Method:      http.MethodPost,
+				ContentType: "application/x-www-form-urlencoded",
+				Params:      map[string]string{},
+				Body:        "email=mbland%40acm.org",
+			}
+		}
+		setup := func() *apiHandlerFixture {
+			f := newApiHandlerFixture()
+			f.agent.OpResult = ops.VerifyLinkSent
+			f.handler.MaintenanceMode = true
+			return f
+		}
+
+		t.Run("SubscribeWorksNormallyWhenDisabled", func(t *testing.T) {
+			f := setup()
+			f.handler.MaintenanceMode = false
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newSubscribeRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "mbland@acm.org", f.agent.Email)
+			assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+			expected := f.handler.Redirects[ops.VerifyLinkSent]
+			assert.Equal(t, expected, response.Headers["location"])
+		})
+
+		t.Run("SubscribeUnavailableWhenEnabled", func(t *testing.T) {
+			f := setup()
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newSubscribeRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "", f.agent.Email)
+			assert.Equal(
+				t, http.StatusServiceUnavailable, response.StatusCode,
+			)
+			assert.Equal(t, "", response.Headers["location"])
+			assert.Equal(
+				t, maintenanceRetryAfter, response.Headers["retry-after"],
+			)
+			const expected = "Signups are temporarily closed for maintenance"
+			assert.Assert(t, is.Contains(response.Body, expected))
+			f.logs.AssertContains(
+				t, "deadbeef: maintenance mode: Subscribe: mbland@acm.org",
+			)
+		})
+
+		t.Run("LinksToMaintenanceUrlIfDefined", func(t *testing.T) {
+			f := setup()
+			f.handler.MaintenanceUrl = "https://mike-bland.com/maintenance"
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newSubscribeRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(
+				t, http.StatusServiceUnavailable, response.StatusCode,
+			)
+			assert.Equal(t, "", response.Headers["location"])
+			expectedLink := "<a href=\"" + f.handler.MaintenanceUrl + "\">"
+			assert.Assert(t, is.Contains(response.Body, expectedLink))
+		})
+
+		t.Run("VerifyUnavailableWhenEnabled", func(t *testing.T) {
+			f := setup()
+			req := newUnsubscribeRequest()
+			req.RawPath = ops.ApiPrefixVerify + "mbland@acm.org/" +
+				testValidUidStr
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "", f.agent.Email)
+			assert.Equal(
+				t, http.StatusServiceUnavailable, response.StatusCode,
+			)
+		})
+
+		t.Run("UnsubscribeWorksWhenEnabled", func(t *testing.T) {
+			f := setup()
+			f.agent.OpResult = ops.Unsubscribed
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newUnsubscribeRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "mbland@acm.org", f.agent.Email)
+			assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+		})
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		const signingKey = "signing key"
+		newStatusFixture := func() *apiHandlerFixture {
+			f := newApiHandlerFixture()
+			f.handler.LinkSigningKey = []byte(signingKey)
+			return f
+		}
+		newStatusRequest := func() *apiRequest {
+			return &apiRequest{
+				Id:      "deadbeef",
+				RawPath: ops.ApiPrefixStatus,
+				Method:  http.MethodGet,
+				Query:   map[string]string{"email": "mbland@acm.org"},
+			}
+		}
+		newSignedStatusRequest := func() *apiRequest {
+			req := newStatusRequest()
+			req.Query["uid"] = testValidUid.String()
+			req.Query[ops.ApiParamSignature] = ops.LinkSignature(
+				[]byte(signingKey), "mbland@acm.org", testValidUid,
+			)
+			return req
+		}
+
+		assertStatus := func(
+			t *testing.T, status db.SubscriberStatus, expectedBody string,
+		) {
+			t.Helper()
+			f := newStatusFixture()
+			f.agent.StatusResult = status
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newStatusRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, "mbland@acm.org", f.agent.Email)
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			contentType := response.Headers["content-type"]
+			assert.Equal(t, "application/json", contentType)
+			assert.Equal(
+				t,
+				"https://"+testEmailDomain,
+				response.Headers["access-control-allow-origin"],
+			)
+			assert.Equal(t, expectedBody, response.Body)
+			f.logs.AssertContains(
+				t, "deadbeef: result: Status: mbland@acm.org ",
+			)
+		}
+
+		t.Run("Unknown", func(t *testing.T) {
+			assertStatus(
+				t,
+				agent.StatusUnknown,
+				`{"email":"mbland@acm.org","status":"unknown"}`,
+			)
+		})
+
+		t.Run("Pending", func(t *testing.T) {
+			assertStatus(
+				t,
+				db.SubscriberPending,
+				`{"email":"mbland@acm.org","status":"pending"}`,
+			)
+		})
+
+		t.Run("Verified", func(t *testing.T) {
+			assertStatus(
+				t,
+				db.SubscriberVerified,
+				`{"email":"mbland@acm.org","status":"verified"}`,
+			)
+		})
+
+		t.Run("ReturnsTooManyRequestsIfRateLimited", func(t *testing.T) {
+			f := newStatusFixture()
+			f.agent.StatusResult = db.SubscriberVerified
+			f.handler.StatusLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+
+			first, firstErr := f.handler.handleApiRequest(
+				f.ctx, newStatusRequest(),
+			)
+			second, secondErr := f.handler.handleApiRequest(
+				f.ctx, newStatusRequest(),
+			)
+
+			assert.NilError(t, firstErr)
+			assert.Equal(t, http.StatusOK, first.StatusCode)
+			assert.NilError(t, secondErr)
+			assert.Equal(t, http.StatusTooManyRequests, second.StatusCode)
+			assert.Equal(t, "1", second.Headers["retry-after"])
+			assert.Equal(t, `{"error":"too many requests"}`, second.Body)
+			assert.Equal(t, 1, len(f.agent.Calls))
+			f.logs.AssertContains(t, "deadbeef: rate limited: Status: ")
+		})
+
+		t.Run("AcceptsSignedRequestWithUid", func(t *testing.T) {
+			f := newStatusFixture()
+			f.agent.StatusResult = db.SubscriberVerified
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newSignedStatusRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, 1, len(f.agent.Calls))
+		})
+
+		t.Run("ReturnsBadRequestIfUidButNoSignature", func(t *testing.T) {
+			f := newStatusFixture()
+			req := newSignedStatusRequest()
+			delete(req.Query, ops.ApiParamSignature)
+
+			response, err := f.handler.handleApiRequest(f.ctx, req)
+
+			assert.NilError(t, err)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			assert.Equal(t, 0, len(f.agent.Calls))
+		})
+
+		t.Run("ReturnsNotFoundWithoutSigningKey", func(t *testing.T) {
+			f := newStatusFixture()
+			f.handler.LinkSigningKey = nil
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newStatusRequest(),
+			)
+
+			assert.NilError(t, err)
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+			assert.Equal(t, `{"error":"not found"}`, response.Body)
+			assert.Equal(t, 0, len(f.agent.Calls))
+			f.logs.AssertContains(t, "deadbeef: no link signing key: Status: ")
+		})
+
+		t.Run("ReturnsErrorIfStatusFails", func(t *testing.T) {
+			f := newStatusFixture()
+			f.agent.Error = newOpsErrExternal("not our fault...")
+
+			response, err := f.handler.handleApiRequest(
+				f.ctx, newStatusRequest(),
+			)
+
+			assert.DeepEqual(t, newBadGatewayError("not our fault..."), err)
+			assert.Assert(t, is.Nil(response))
+			f.logs.AssertContains(t, "deadbeef: ERROR: Status: ")
+		})
+	})
+
 	t.Run("ReturnsErrorIfOperationFails", func(t *testing.T) {
 		f := newApiHandlerFixture()
 		f.agent.Error = newOpsErrExternal("not our fault...")
@@ -558,6 +1123,33 @@ func TestApiHandleEvent(t *testing.T) {
 		f.logs.AssertContains(t, "502: "+newBadGatewayError(errMsg).Error())
 	})
 
+	t.Run("ShowsAndLogsRequestIdAsCorrelationIdOnError", func(t *testing.T) {
+		f := newApiHandlerFixture()
+		f.agent.Error = errors.New("unexpected failure")
+
+		res := f.handler.HandleEvent(f.ctx, req)
+
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		assert.Assert(t, is.Contains(res.Body, "<code>deadbeef</code>"))
+		f.logs.AssertContains(t, "deadbeef: 192.168.0.1 ")
+		f.logs.AssertContains(t, "500: unexpected failure")
+	})
+
+	t.Run("GeneratesCorrelationIdIfRequestIdMissing", func(t *testing.T) {
+		f := newApiHandlerFixture()
+		f.agent.Error = errors.New("unexpected failure")
+		f.handler.NewCorrelationId = func() string { return "c0ffee" }
+		noIdReq := *req
+		noIdReq.RequestContext.RequestID = ""
+
+		res := f.handler.HandleEvent(f.ctx, &noIdReq)
+
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		assert.Assert(t, is.Contains(res.Body, "<code>c0ffee</code>"))
+		f.logs.AssertContains(t, "c0ffee: 192.168.0.1 ")
+		f.logs.AssertContains(t, "500: unexpected failure")
+	})
+
 	t.Run("Succeeds", func(t *testing.T) {
 		f := newApiHandlerFixture()
 		f.agent.OpResult = ops.VerifyLinkSent
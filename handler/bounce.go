@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// BounceAction determines how sesEventHandler responds to a bounce.
+type BounceAction string
+
+const (
+	// BounceRemove removes and suppresses the recipients.
+	BounceRemove BounceAction = "Remove"
+
+	// BounceIgnore logs the bounce and leaves the recipients in place.
+	BounceIgnore BounceAction = "Ignore"
+
+	// BounceRetry leaves the recipients in place and reports the event as
+	// failed, so that SQS or SNS will deliver it again later.
+	//
+	// An SQS queue redelivers the event up to SnsOptions.BounceRetries times,
+	// after which it's handled like BounceIgnore instead of going to a
+	// dead-letter queue. Lambda will eventually move events received directly
+	// from SNS to a dead-letter queue, if so configured, since their delivery
+	// count is unknown.
+	BounceRetry BounceAction = "Retry"
+)
+
+// BouncePolicy maps SES bounce types to BounceActions.
+//
+// Keys are either "BounceType/BounceSubType" or "BounceType" alone. A
+// "BounceType/BounceSubType" rule takes precedence over a "BounceType" rule.
+// Bounces matching neither use BounceRemove.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/notification-contents.html#bounce-types
+type BouncePolicy map[string]BounceAction
+
+// DefaultBouncePolicy ignores transient bounces and removes recipients for
+// all others.
+var DefaultBouncePolicy = BouncePolicy{"Transient": BounceIgnore}
+
+// defaultBounceRule is the rule Action reports for unmapped bounce types.
+const defaultBounceRule = "default"
+
+// Action returns the BounceAction for a bounce and the rule that selected it.
+//
+// A nil policy behaves like DefaultBouncePolicy.
+func (p BouncePolicy) Action(
+	bounceType, bounceSubType string,
+) (action BounceAction, rule string) {
+	if p == nil {
+		p = DefaultBouncePolicy
+	}
+	subTypeRule := bounceType + "/" + bounceSubType
+
+	for _, rule = range []string{subTypeRule, bounceType} {
+		var ok bool
+		if action, ok = p[rule]; ok {
+			return
+		}
+	}
+	return BounceRemove, defaultBounceRule
+}
+
+// ParseBouncePolicy adds the rules from a comma separated list of
+// "BounceType[/BounceSubType]=Action" pairs to DefaultBouncePolicy.
+//
+// Actions are "Remove", "Ignore", or "Retry". For example:
+//
+//	Permanent/Suppressed=Ignore,Transient/MailboxFull=Retry
+func ParseBouncePolicy(rules string) (policy BouncePolicy, err error) {
+	policy = maps.Clone(DefaultBouncePolicy)
+
+	for _, rule := range strings.Split(rules, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		key, action, ok := strings.Cut(rule, "=")
+		key = strings.TrimSpace(key)
+		bounceAction := BounceAction(strings.TrimSpace(action))
+
+		if !ok || key == "" {
+			return nil, fmt.Errorf("bounce rule missing type: %s", rule)
+		}
+		switch bounceAction {
+		case BounceRemove, BounceIgnore, BounceRetry:
+			policy[key] = bounceAction
+		default:
+			const errFmt = "bounce rule has unknown action: %s"
+			return nil, fmt.Errorf(errFmt, rule)
+		}
+	}
+	return
+}
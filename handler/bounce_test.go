@@ -0,0 +1,87 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestBouncePolicyAction(t *testing.T) {
+	policy := BouncePolicy{
+		"Permanent":             BounceRemove,
+		"Permanent/Suppressed":  BounceIgnore,
+		"Transient/MailboxFull": BounceRetry,
+	}
+
+	t.Run("PrefersSubTypeRule", func(t *testing.T) {
+		action, rule := policy.Action("Permanent", "Suppressed")
+
+		assert.Equal(t, BounceIgnore, action)
+		assert.Equal(t, "Permanent/Suppressed", rule)
+	})
+
+	t.Run("FallsBackToTypeRule", func(t *testing.T) {
+		action, rule := policy.Action("Permanent", "General")
+
+		assert.Equal(t, BounceRemove, action)
+		assert.Equal(t, "Permanent", rule)
+	})
+
+	t.Run("RemovesIfUnmapped", func(t *testing.T) {
+		action, rule := policy.Action("Transient", "General")
+
+		assert.Equal(t, BounceRemove, action)
+		assert.Equal(t, defaultBounceRule, rule)
+	})
+
+	t.Run("UsesDefaultPolicyIfNil", func(t *testing.T) {
+		var nilPolicy BouncePolicy
+
+		action, rule := nilPolicy.Action("Transient", "General")
+
+		assert.Equal(t, BounceIgnore, action)
+		assert.Equal(t, "Transient", rule)
+	})
+}
+
+func TestParseBouncePolicy(t *testing.T) {
+	t.Run("AddsRulesToDefaultPolicy", func(t *testing.T) {
+		policy, err := ParseBouncePolicy(
+			"Permanent/Suppressed = Ignore, ,Transient/MailboxFull=Retry",
+		)
+
+		assert.NilError(t, err)
+		expected := BouncePolicy{
+			"Transient":             BounceIgnore,
+			"Permanent/Suppressed":  BounceIgnore,
+			"Transient/MailboxFull": BounceRetry,
+		}
+		assert.DeepEqual(t, expected, policy)
+		assert.Equal(t, 1, len(DefaultBouncePolicy))
+	})
+
+	t.Run("OverridesDefaultPolicy", func(t *testing.T) {
+		policy, err := ParseBouncePolicy("Transient=Remove")
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, BouncePolicy{"Transient": BounceRemove}, policy)
+	})
+
+	t.Run("FailsIfTypeMissing", func(t *testing.T) {
+		policy, err := ParseBouncePolicy("Retry")
+
+		assert.Assert(t, is.Nil(policy))
+		assert.Error(t, err, "bounce rule missing type: Retry")
+	})
+
+	t.Run("FailsIfActionUnknown", func(t *testing.T) {
+		policy, err := ParseBouncePolicy("Transient=Requeue")
+
+		assert.Assert(t, is.Nil(policy))
+		const expected = "bounce rule has unknown action: Transient=Requeue"
+		assert.Error(t, err, expected)
+	})
+}
@@ -2,17 +2,20 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
+	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/events"
 )
 
 type cliHandler struct {
 	Agent agent.SubscriptionAgent
-	Log   *log.Logger
+	Log   Logger
 }
 
 func (h *cliHandler) HandleEvent(
@@ -23,6 +26,8 @@ func (h *cliHandler) HandleEvent(
 		res = h.HandleSendEvent(ctx, e.Send)
 	case events.CommandLineImportEvent:
 		res = h.HandleImportEvent(ctx, e.Import)
+	case events.CommandLineRevalidateEvent:
+		res = h.HandleRevalidateEvent(ctx, e.Revalidate)
 	default:
 		err = fmt.Errorf("unknown EListMan command: %s", e.EListManCommand)
 	}
@@ -35,7 +40,11 @@ func (h *cliHandler) HandleSendEvent(
 	res = &events.SendResponse{}
 	var err error
 
-	res.NumSent, err = h.Agent.Send(ctx, &e.Message, e.Addresses)
+	if e.TestAddress != "" {
+		res.NumSent, err = h.Agent.TestSend(ctx, &e.Message, e.TestAddress)
+	} else {
+		res.NumSent, err = h.Agent.Send(ctx, &e.Message, e.Addresses)
+	}
 
 	if res.Success = err == nil; !res.Success {
 		res.Details = err.Error()
@@ -49,27 +58,117 @@ func (h *cliHandler) HandleSendEvent(
 func (h *cliHandler) HandleImportEvent(
 	ctx context.Context, e *events.ImportEvent,
 ) (response *events.ImportResponse) {
+	subs := make([]*db.Subscriber, len(e.Addresses))
+	for i, addr := range e.Addresses {
+		subs[i] = &db.Subscriber{Email: addr}
+	}
+	opts := agent.ImportOptions{
+		DryRun: e.DryRun, SkipValidation: e.SkipValidation,
+	}
+	errs, err := h.Agent.ImportVerified(ctx, subs, opts)
+
 	failures := make([]string, 0, len(e.Addresses))
 	imported := make([]string, 0, len(e.Addresses))
+	response = &events.ImportResponse{}
 
-	for _, addr := range e.Addresses {
-		if err := h.Agent.Import(ctx, addr); err != nil {
-			failures = append(failures, fmt.Sprintf("%s: %s", addr, err))
-		} else {
+	for i, addr := range e.Addresses {
+		if errs[i] == nil {
 			imported = append(imported, addr)
+			continue
 		}
+		failure := importFailure(addr, errs[i])
+		response.Failures = append(response.Failures, failure)
+		failures = append(failures, fmt.Sprintf("%s: %s", addr, errs[i]))
 	}
+	response.NumImported = len(imported)
 
-	response = &events.ImportResponse{NumImported: len(imported)}
-
+	action := "imported"
+	if e.DryRun {
+		action = "dry run: validated"
+	}
 	if len(imported) != 0 {
 		importedList := strings.Join(imported, ", ")
-		h.Log.Printf("imported %d: %s", len(imported), importedList)
+		h.Log.Printf("%s %d: %s", action, len(imported), importedList)
 	}
 	if len(failures) != 0 {
 		failureList := strings.Join(failures, "\n  ")
 		h.Log.Printf("failed to import %d:\n  %s", len(failures), failureList)
-		response.Failures = failures
+	}
+	if err != nil {
+		response.Details = err.Error()
+		h.Log.Printf("import failed: %s", err)
+	}
+	return
+}
+
+func importFailure(address string, err error) events.ImportFailure {
+	var validationErr *agent.ImportValidationError
+	suppressed := errors.As(err, &validationErr) &&
+		validationErr.Failure.Reason == email.FailureReasonSuppressed
+	return events.ImportFailure{
+		Address: address, Reason: err.Error(), Suppressed: suppressed,
+	}
+}
+
+// shutdownMargin is how long before the Lambda function's deadline
+// HandleRevalidateEvent stops revalidating subscribers, leaving time to return
+// its progress before the Lambda runtime terminates the function.
+const shutdownMargin = 5 * time.Second
+
+// withShutdownMargin returns a context cancelled margin before ctx's deadline,
+// or ctx itself if it has no deadline.
+func withShutdownMargin(
+	ctx context.Context, margin time.Duration,
+) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline.Add(-margin))
+	}
+	return context.WithCancel(ctx)
+}
+
+// HandleRevalidateEvent passes the event to SubscriptionAgent.Revalidate.
+//
+// If Revalidate fails, NextStartKey is the StartKey from which to try again.
+// This includes stopping shutdownMargin before the Lambda function's deadline,
+// in which case NextStartKey resumes after the last subscriber revalidated.
+func (h *cliHandler) HandleRevalidateEvent(
+	ctx context.Context, e *events.RevalidateEvent,
+) (res *events.RevalidateResponse) {
+	res = &events.RevalidateResponse{
+		Removed: []string{}, NextStartKey: e.StartKey,
+	}
+	ctx, cancel := withShutdownMargin(ctx, shutdownMargin)
+	defer cancel()
+
+	var startKey db.StartKey
+	var result *agent.RevalidateResult
+	var err error
+
+	if startKey, err = db.DecodeStartKey(e.StartKey); err == nil {
+		result, err = h.Agent.Revalidate(
+			ctx, startKey, e.MaxSubscribers, e.Rate,
+		)
+	}
+	if result != nil {
+		res.NumValidated = result.NumValidated
+		for _, failure := range result.Removed {
+			res.Removed = append(res.Removed, failure.String())
+		}
+		nextStartKey, encodeErr := db.EncodeStartKey(result.NextStartKey)
+		if encodeErr == nil {
+			res.NextStartKey = nextStartKey
+		}
+		err = errors.Join(err, encodeErr)
+	}
+
+	if res.Success = err == nil; !res.Success {
+		res.Details = err.Error()
+	}
+
+	const logFmt = "revalidate: success: %t; num validated: %d; removed %d"
+	h.Log.Printf(logFmt, res.Success, res.NumValidated, len(res.Removed))
+	if len(res.Removed) != 0 {
+		h.Log.Printf("removed:\n  %s", strings.Join(res.Removed, "\n  "))
 	}
 	return
 }
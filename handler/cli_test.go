@@ -8,9 +8,14 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/events"
+	"github.com/mbland/elistman/testdoubles"
 	"github.com/mbland/elistman/testutils"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
@@ -23,7 +28,7 @@ func setupTestCliHandler() (
 		ImportedAddresses: make([]string, 0, 10),
 		ImportResponse:    func(string) error { return nil },
 	}
-	logs, logger := testutils.NewLogs()
+	logs, logger := newTestLogs()
 	return &cliHandler{ta, logger}, ta, logs, context.Background()
 }
 
@@ -78,6 +83,25 @@ func TestCliHandlerHandleSendEvent(t *testing.T) {
 		assert.DeepEqual(t, expectedCalls, agent.Calls)
 	})
 
+	t.Run("SucceedsSendingTestMessage", func(t *testing.T) {
+		handler, agent, logs, ctx := setupTestCliHandler()
+		testEvent := *event
+		testEvent.TestAddress = "author@foo.com"
+		agent.SendResponse = func(_ *email.Message, _ []string) (int, error) {
+			return 1, nil
+		}
+
+		res := handler.HandleSendEvent(ctx, &testEvent)
+
+		expectedResult := &events.SendResponse{Success: true, NumSent: 1}
+		assert.DeepEqual(t, expectedResult, res)
+		logs.AssertContains(t, expectedLogMsg(&event.Message, expectedResult))
+		expectedCalls := []testAgentCalls{
+			{Method: "TestSend", Email: "author@foo.com", Msg: &event.Message},
+		}
+		assert.DeepEqual(t, expectedCalls, agent.Calls)
+	})
+
 	t.Run("FailsIfSendRaisesError", func(t *testing.T) {
 		handler, agent, logs, ctx := setupTestCliHandler()
 		sendTargetedErr := errors.New("simulated SendTargeted error")
@@ -140,18 +164,211 @@ func TestCliHandlerHandleImportEvent(t *testing.T) {
 
 		expectedResponse := &events.ImportResponse{
 			NumImported: 1,
-			Failures: []string{
-				"foo@test.com: test error",
-				"baz@test.com: test error",
+			Failures: []events.ImportFailure{
+				{Address: "foo@test.com", Reason: "test error"},
+				{Address: "baz@test.com", Reason: "test error"},
 			},
 		}
 		assert.DeepEqual(t, expectedResponse, res)
 		logs.AssertContains(t, "imported 1: bar@test.com")
-		logs.AssertContains(t, fmt.Sprintf(
-			"failed to import %d:\n  %s",
-			len(expectedResponse.Failures),
-			strings.Join(expectedResponse.Failures, "\n  "),
-		))
+		logs.AssertContains(
+			t,
+			"failed to import 2:\n"+
+				"  foo@test.com: test error\n"+
+				"  baz@test.com: test error",
+		)
+	})
+
+	t.Run("ReportsSuppressedAddresses", func(t *testing.T) {
+		handler, ta, _, ctx := setupTestCliHandler()
+		validationErr := func(address, reason string) error {
+			return &agent.ImportValidationError{
+				Failure: &email.ValidationFailure{
+					Address: address, Reason: reason,
+				},
+			}
+		}
+		ta.ImportResponse = func(address string) (err error) {
+			if address == "foo@test.com" {
+				err = validationErr(address, email.FailureReasonSuppressed)
+			} else if address == "baz@test.com" {
+				err = validationErr(address, "invalid domain")
+			}
+			return
+		}
+
+		res := handler.HandleImportEvent(ctx, event)
+
+		expectedResponse := &events.ImportResponse{
+			NumImported: 1,
+			Failures: []events.ImportFailure{
+				{
+					Address:    "foo@test.com",
+					Reason:     email.FailureReasonSuppressed,
+					Suppressed: true,
+				},
+				{Address: "baz@test.com", Reason: "invalid domain"},
+			},
+		}
+		assert.DeepEqual(t, expectedResponse, res)
+	})
+
+	t.Run("PassesOptionsAndLogsDryRun", func(t *testing.T) {
+		handler, ta, logs, ctx := setupTestCliHandler()
+		dryRunEvent := *event
+		dryRunEvent.DryRun = true
+		dryRunEvent.SkipValidation = true
+
+		res := handler.HandleImportEvent(ctx, &dryRunEvent)
+
+		assert.Equal(t, len(event.Addresses), res.NumImported)
+		expectedOpts := agent.ImportOptions{DryRun: true, SkipValidation: true}
+		assert.Equal(t, expectedOpts, ta.ImportOptions)
+		logs.AssertContains(t, "dry run: validated 3: ")
+	})
+
+	t.Run("PreservesUidOfExistingVerifiedSubscriber", func(t *testing.T) {
+		_, stdLogger := testutils.NewLogs()
+		_, logger := newTestLogs()
+		dbase := testdoubles.NewDatabase()
+		existing := &db.Subscriber{
+			Email:     "bar@test.com",
+			Uid:       uuid.MustParse("55555555-6666-7777-8888-999999999999"),
+			Status:    db.SubscriberVerified,
+			Timestamp: time.Date(2023, time.May, 20, 12, 34, 56, 0, time.UTC),
+			Version:   1,
+		}
+		dbase.Put(context.Background(), existing)
+		prodAgent := &agent.ProdAgent{
+			NewUid:      uuid.NewRandom,
+			CurrentTime: time.Now,
+			Db:          dbase,
+			Log:         stdLogger,
+		}
+		handler := &cliHandler{prodAgent, logger}
+		importEvent := &events.ImportEvent{
+			Addresses: []string{"bar@test.com"}, SkipValidation: true,
+		}
+
+		res := handler.HandleImportEvent(context.Background(), importEvent)
+
+		assert.DeepEqual(t, &events.ImportResponse{NumImported: 1}, res)
+		stored, err := dbase.Get(context.Background(), "bar@test.com")
+		assert.NilError(t, err)
+		assert.Equal(t, existing.Uid, stored.Uid)
+		assert.Equal(t, existing.Timestamp, stored.Timestamp)
+	})
+
+	t.Run("ReportsBatchWriteFailure", func(t *testing.T) {
+		handler, ta, logs, ctx := setupTestCliHandler()
+		ta.ImportError = errors.New("import failed: test error")
+
+		res := handler.HandleImportEvent(ctx, event)
+
+		assert.Equal(t, "import failed: test error", res.Details)
+		logs.AssertContains(t, "import failed: test error")
+	})
+}
+
+func TestCliHandlerHandleRevalidateEvent(t *testing.T) {
+	// Encoded from {"email":{"S":"bar@test.com"}} and
+	// {"email":{"S":"foo@test.com"}}.
+	const startKey = "eyJlbWFpbCI6eyJTIjoiYmFyQHRlc3QuY29tIn19"
+	const nextStartKey = "eyJlbWFpbCI6eyJTIjoiZm9vQHRlc3QuY29tIn19"
+	event := &events.RevalidateEvent{
+		StartKey: startKey, MaxSubscribers: 2, Rate: 1.5,
+	}
+
+	setup := func(t *testing.T) (
+		*cliHandler, *testAgent, *testutils.Logs, context.Context,
+	) {
+		t.Helper()
+		handler, ta, logs, ctx := setupTestCliHandler()
+		next, err := db.DecodeStartKey(nextStartKey)
+		assert.NilError(t, err)
+		ta.RevalidateResult = &agent.RevalidateResult{
+			NumValidated: 2,
+			Removed: []*email.ValidationFailure{
+				{Address: "bad@test.com", Reason: "no MX records"},
+			},
+			NextStartKey: next,
+		}
+		return handler, ta, logs, ctx
+	}
+
+	t.Run("Succeeds", func(t *testing.T) {
+		handler, agent, logs, ctx := setup(t)
+
+		res := handler.HandleRevalidateEvent(ctx, event)
+
+		expectedResponse := &events.RevalidateResponse{
+			Success:      true,
+			NumValidated: 2,
+			Removed:      []string{"bad@test.com: no MX records"},
+			NextStartKey: nextStartKey,
+		}
+		assert.DeepEqual(t, expectedResponse, res)
+		encoded, err := db.EncodeStartKey(agent.StartKey)
+		assert.NilError(t, err)
+		assert.Equal(t, startKey, encoded)
+		logs.AssertContains(
+			t, "revalidate: success: true; num validated: 2; removed 1",
+		)
+		logs.AssertContains(t, "removed:\n  bad@test.com: no MX records")
+	})
+
+	t.Run("ReportsDetailsAndStartKeyIfRevalidateFails", func(t *testing.T) {
+		handler, agent, logs, ctx := setup(t)
+		agent.RevalidateResult.NumValidated = 0
+		agent.RevalidateResult.Removed = []*email.ValidationFailure{}
+		agent.RevalidateResult.NextStartKey, _ = db.DecodeStartKey(startKey)
+		agent.Error = errors.New("revalidation failed: test error")
+
+		res := handler.HandleRevalidateEvent(ctx, event)
+
+		expectedResponse := &events.RevalidateResponse{
+			Success:      false,
+			Removed:      []string{},
+			NextStartKey: startKey,
+			Details:      "revalidation failed: test error",
+		}
+		assert.DeepEqual(t, expectedResponse, res)
+		logs.AssertContains(
+			t, "revalidate: success: false; num validated: 0; removed 0",
+		)
+	})
+
+	t.Run("StopsBeforeLambdaDeadline", func(t *testing.T) {
+		handler, agent, _, ctx := setup(t)
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		res := handler.HandleRevalidateEvent(ctx, event)
+
+		assert.Assert(t, res.Success)
+		expected := deadline.Add(-shutdownMargin)
+		assert.Equal(t, expected, agent.RevalidateDeadline)
+	})
+
+	t.Run("HasNoDeadlineIfLambdaHasNone", func(t *testing.T) {
+		handler, agent, _, ctx := setup(t)
+
+		handler.HandleRevalidateEvent(ctx, event)
+
+		assert.Assert(t, agent.RevalidateDeadline.IsZero())
+	})
+
+	t.Run("FailsIfStartKeyInvalid", func(t *testing.T) {
+		handler, agent, _, ctx := setup(t)
+		badEvent := &events.RevalidateEvent{StartKey: "not JSON"}
+
+		res := handler.HandleRevalidateEvent(ctx, badEvent)
+
+		assert.Assert(t, !res.Success)
+		assert.Equal(t, "not JSON", res.NextStartKey)
+		assert.Assert(t, is.Contains(res.Details, "invalid start key: "))
+		assert.Equal(t, 0, len(agent.Calls))
 	})
 }
 
@@ -194,6 +411,25 @@ func TestCliHandlerHandleEvent(t *testing.T) {
 		assert.DeepEqual(t, expectedResponse, res)
 	})
 
+	t.Run("SuccessfullyHandlesRevalidateEvent", func(t *testing.T) {
+		handler, ta, _, ctx := setupTestCliHandler()
+		ta.RevalidateResult = &agent.RevalidateResult{NumValidated: 3}
+		event := &events.CommandLineEvent{
+			EListManCommand: events.CommandLineRevalidateEvent,
+			Revalidate:      &events.RevalidateEvent{MaxSubscribers: 3},
+		}
+
+		res, err := handler.HandleEvent(ctx, event)
+
+		assert.NilError(t, err)
+		expectedResponse := &events.RevalidateResponse{
+			Success:      true,
+			NumValidated: 3,
+			Removed:      []string{},
+		}
+		assert.DeepEqual(t, expectedResponse, res)
+	})
+
 	t.Run("FailsOnUnknownEvent", func(t *testing.T) {
 		handler, _, _, ctx := setupTestCliHandler()
 		event := &events.CommandLineEvent{
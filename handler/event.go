@@ -17,6 +17,7 @@ const (
 	MailtoEvent
 	SnsEvent
 	CommandLineEvent
+	SqsEvent
 )
 
 type Event struct {
@@ -25,6 +26,7 @@ type Event struct {
 	MailtoEvent      *awsevents.SimpleEmailEvent
 	SnsEvent         *awsevents.SNSEvent
 	CommandLineEvent *events.CommandLineEvent
+	SqsEvent         *awsevents.SQSEvent
 	Unknown          []byte
 }
 
@@ -39,6 +41,12 @@ func (event *Event) UnmarshalJSON(data []byte) error {
 		event.Type = ApiRequest
 		event.ApiRequest = &awsevents.APIGatewayProxyRequest{}
 		return json.Unmarshal(data, event.ApiRequest)
+	} else if bytes.Contains(data, []byte(`"aws:sqs"`)) {
+		// Check for SQS events before the others, since the body of each SQS
+		// record may contain an SNS notification or SES event.
+		event.Type = SqsEvent
+		event.SqsEvent = &awsevents.SQSEvent{}
+		return json.Unmarshal(data, event.SqsEvent)
 	} else if bytes.Contains(data, []byte(`"ses":`)) {
 		event.Type = MailtoEvent
 		event.MailtoEvent = &awsevents.SimpleEmailEvent{}
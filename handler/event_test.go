@@ -140,6 +140,37 @@ func TestSnsEvent(t *testing.T) {
 	})
 }
 
+const sqsEventJson string = `{
+	"Records": [
+		{
+			"messageId": "deadbeef",
+			"eventSource": "aws:sqs",
+			"body": "SNS notification or SES event, unmarshalled later"
+		}
+	]
+}`
+
+func TestSqsEvent(t *testing.T) {
+	e := Event{}
+
+	err := e.UnmarshalJSON([]byte(sqsEventJson))
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, e, Event{
+		Type: SqsEvent,
+		SqsEvent: &awsevents.SQSEvent{
+			Records: []awsevents.SQSMessage{
+				{
+					MessageId:   "deadbeef",
+					EventSource: "aws:sqs",
+					Body: "SNS notification or SES event, " +
+						"unmarshalled later",
+				},
+			},
+		},
+	})
+}
+
 func TestCommandLineEvent(t *testing.T) {
 	const sendEventJson = `{
 		"elistmanCommand": "` + events.CommandLineSendEvent + `",
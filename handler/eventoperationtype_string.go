@@ -12,11 +12,12 @@ func _() {
 	_ = x[Subscribe-1]
 	_ = x[Verify-2]
 	_ = x[Unsubscribe-3]
+	_ = x[Status-4]
 }
 
-const _eventOperationType_name = "UndefinedSubscribeVerifyUnsubscribe"
+const _eventOperationType_name = "UndefinedSubscribeVerifyUnsubscribeStatus"
 
-var _eventOperationType_index = [...]uint8{0, 9, 18, 24, 35}
+var _eventOperationType_index = [...]uint8{0, 9, 18, 24, 35, 41}
 
 func (i eventOperationType) String() string {
 	if i < 0 || i >= eventOperationType(len(_eventOperationType_index)-1) {
@@ -3,10 +3,11 @@ package handler
 import (
 	"context"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/mbland/elistman/agent"
 	"github.com/mbland/elistman/email"
+	"github.com/mbland/elistman/ops"
 )
 
 type Handler struct {
@@ -14,6 +15,112 @@ type Handler struct {
 	mailto *mailtoHandler
 	sns    *snsHandler
 	cli    *cliHandler
+	sqs    *sqsHandler
+
+	// responsePages holds the templates from WithResponsePages until
+	// NewHandler parses them.
+	responsePages ResponsePages
+}
+
+// HandlerOption configures optional Handler behavior.
+type HandlerOption func(h *Handler)
+
+// WithSnsOptions configures the handling of SES events received via SNS.
+func WithSnsOptions(opts SnsOptions) HandlerOption {
+	return func(h *Handler) {
+		h.sns.Options = opts
+	}
+}
+
+// WithSesEventLog causes SES events received via SNS to be recorded in
+// eventLog, so that events delivered more than once are handled only once.
+//
+// This doesn't apply to SES events received via SQS, which relies upon
+// redelivering failed events.
+func WithSesEventLog(eventLog SesEventLog) HandlerOption {
+	return func(h *Handler) {
+		h.sns.EventLog = eventLog
+	}
+}
+
+// WithMetrics causes SES events received via SNS or SQS to emit counts of
+// bounces, complaints, rejects, sends, and deliveries to metrics.
+func WithMetrics(metrics ops.Metrics) HandlerOption {
+	return func(h *Handler) {
+		h.sns.Metrics = metrics
+	}
+}
+
+// WithRedactedAddresses masks the username of email addresses in the logs.
+//
+// This applies to the outcomes of SES events and unsubscribe emails. Domains
+// remain visible, e.g., "mbland@acm.org" becomes "m****@acm.org".
+func WithRedactedAddresses() HandlerOption {
+	return func(h *Handler) {
+		h.mailto.RedactAddresses = true
+		h.sns.RedactAddresses = true
+	}
+}
+
+// WithLinkSigningKey requires verify, unsubscribe, and status requests with a
+// uid to contain a valid ops.LinkSignature computed using key.
+//
+// An empty key disables signature checking, as well as status requests.
+func WithLinkSigningKey(key string) HandlerOption {
+	return func(h *Handler) {
+		h.api.LinkSigningKey = []byte(key)
+	}
+}
+
+// WithMaintenanceMode causes subscribe and verify requests to fail with HTTP
+// 503 Service Unavailable, linking to RedirectPaths.Maintenance if defined.
+func WithMaintenanceMode() HandlerOption {
+	return func(h *Handler) {
+		h.api.MaintenanceMode = true
+	}
+}
+
+// WithMailtoMaxAge causes unsubscribe emails received more than maxAge ago to
+// be logged and ignored, instead of triggering an unsubscribe or a bounce.
+func WithMailtoMaxAge(maxAge time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.mailto.MaxAge = maxAge
+	}
+}
+
+// WithMailtoCatchAllUnsubscribe causes unsubscribe emails from a subscriber's
+// own address to remove and suppress that address, even if the UID in the
+// subject is missing, invalid, or doesn't match.
+//
+// This honors unsubscribe requests the UID check would otherwise drop, as
+// required by laws such as CAN-SPAM and the GDPR, at the expense of strictness.
+// The outcome of every such request is logged.
+func WithMailtoCatchAllUnsubscribe() HandlerOption {
+	return func(h *Handler) {
+		h.mailto.CatchAllUnsubscribe = true
+	}
+}
+
+// WithVerifyRetries causes verify requests that fail due to errors from
+// upstream services, e.g., transient DynamoDB errors, to be retried up to
+// maxRetries times using DefaultVerifyBackoff.
+//
+// Results such as "already subscribed" or "not subscribed" are never retried.
+func WithVerifyRetries(maxRetries int) HandlerOption {
+	return func(h *Handler) {
+		h.api.VerifyRetries = maxRetries
+	}
+}
+
+// WithResponsePages causes the handler to serve HTML pages instead of
+// redirecting after successful subscribe, verify, and unsubscribe requests.
+//
+// Results without a template in pages use the handler's response template. An
+// empty pages value serves the response template for every result.
+func WithResponsePages(pages ResponsePages) HandlerOption {
+	return func(h *Handler) {
+		h.responsePages = pages
+	}
 }
 
 func NewHandler(
@@ -24,7 +131,8 @@ func NewHandler(
 	responseTemplate string,
 	unsubscribeUserName string,
 	bouncer email.Bouncer,
-	logger *log.Logger,
+	logger Logger,
+	opts ...HandlerOption,
 ) (*Handler, error) {
 	api, err := newApiHandler(
 		emailDomain, siteTitle, agent, paths, responseTemplate, logger,
@@ -35,12 +143,30 @@ func NewHandler(
 	}
 
 	unsubAddr := unsubscribeUserName + "@" + emailDomain
-	return &Handler{
-		api,
-		&mailtoHandler{emailDomain, unsubAddr, agent, bouncer, logger},
-		&snsHandler{agent, logger},
-		&cliHandler{agent, logger},
-	}, nil
+	sns := &snsHandler{Agent: agent, Log: logger}
+	h := &Handler{
+		api: api,
+		mailto: &mailtoHandler{
+			EmailDomain:     emailDomain,
+			UnsubscribeAddr: unsubAddr,
+			Agent:           agent,
+			Bouncer:         bouncer,
+			Log:             logger,
+		},
+		sns: sns,
+		cli: &cliHandler{agent, logger},
+		sqs: &sqsHandler{sns},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.responsePages != nil {
+		if err = h.api.initResponsePages(h.responsePages); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
 }
 
 const ResponseTemplate = `<!DOCTYPE html>
@@ -65,9 +191,11 @@ func (h *Handler) HandleEvent(
 	case MailtoEvent:
 		result = h.mailto.HandleEvent(ctx, event.MailtoEvent)
 	case SnsEvent:
-		h.sns.HandleEvent(ctx, event.SnsEvent)
+		err = h.sns.HandleEvent(ctx, event.SnsEvent)
 	case CommandLineEvent:
 		result, err = h.cli.HandleEvent(ctx, event.CommandLineEvent)
+	case SqsEvent:
+		result = h.sqs.HandleEvent(ctx, event.SqsEvent)
 	case UnknownEvent:
 		// An unknown event is one that Event.UnmarshalJSON knows nothing about.
 		err = fmt.Errorf("unknown event: %s", string(event.Unknown))
@@ -13,6 +13,8 @@ import (
 
 	awsevents "github.com/aws/aws-lambda-go/events"
 	"github.com/google/uuid"
+	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/events"
 	"github.com/mbland/elistman/ops"
@@ -25,12 +27,23 @@ type testAgent struct {
 	Email             string
 	Uid               uuid.UUID
 	OpResult          ops.OperationResult
+	StatusResult      db.SubscriberStatus
 	NumSent           int
 	ImportedAddresses []string
 	ImportResponse    func(address string) error
 	SendResponse      func(msg *email.Message, addrs []string) (int, error)
+	RevalidateResult  *agent.RevalidateResult
+	StartKey          db.StartKey
 	Error             error
 	Calls             []testAgentCalls
+
+	// RevalidateDeadline is the deadline of the context passed to Revalidate.
+	RevalidateDeadline time.Time
+
+	// ImportOptions records the options passed to ImportVerified, which
+	// returns ImportError after importing each address via Import.
+	ImportOptions agent.ImportOptions
+	ImportError   error
 }
 
 type testAgentCalls struct {
@@ -80,9 +93,16 @@ func (a *testAgent) Validate(
 	return nil, nil
 }
 
-func (a *testAgent) Import(_ context.Context, address string) (err error) {
-	a.ImportedAddresses = append(a.ImportedAddresses, address)
-	return a.ImportResponse(address)
+func (a *testAgent) ImportVerified(
+	ctx context.Context, subscribers []*db.Subscriber, opts agent.ImportOptions,
+) (errs []error, err error) {
+	a.ImportOptions = opts
+	errs = make([]error, len(subscribers))
+	for i, sub := range subscribers {
+		a.ImportedAddresses = append(a.ImportedAddresses, sub.Email)
+		errs[i] = a.ImportResponse(sub.Email)
+	}
+	return errs, a.ImportError
 }
 
 func (a *testAgent) Remove(
@@ -100,6 +120,37 @@ func (a *testAgent) Restore(ctx context.Context, email string) error {
 	return a.Error
 }
 
+func (a *testAgent) RecordDelivery(ctx context.Context, email string) error {
+	call := testAgentCalls{Method: "RecordDelivery", Email: email}
+	a.Calls = append(a.Calls, call)
+	a.Email = email
+	return a.Error
+}
+
+func (a *testAgent) RecordEngagement(ctx context.Context, email string) error {
+	call := testAgentCalls{Method: "RecordEngagement", Email: email}
+	a.Calls = append(a.Calls, call)
+	a.Email = email
+	return a.Error
+}
+
+func (a *testAgent) Revalidate(
+	ctx context.Context, startKey db.StartKey, _ int, _ float64,
+) (*agent.RevalidateResult, error) {
+	a.Calls = append(a.Calls, testAgentCalls{Method: "Revalidate"})
+	a.StartKey = startKey
+	a.RevalidateDeadline, _ = ctx.Deadline()
+	return a.RevalidateResult, a.Error
+}
+
+func (a *testAgent) Status(
+	ctx context.Context, email string,
+) (db.SubscriberStatus, error) {
+	a.Calls = append(a.Calls, testAgentCalls{Method: "Status", Email: email})
+	a.Email = email
+	return a.StatusResult, a.Error
+}
+
 func (a *testAgent) Send(
 	ctx context.Context, msg *email.Message, addrs []string,
 ) (numSent int, err error) {
@@ -108,6 +159,14 @@ func (a *testAgent) Send(
 	return a.SendResponse(msg, addrs)
 }
 
+func (a *testAgent) TestSend(
+	ctx context.Context, msg *email.Message, address string,
+) (numSent int, err error) {
+	call := testAgentCalls{Method: "TestSend", Email: address, Msg: msg}
+	a.Calls = append(a.Calls, call)
+	return a.SendResponse(msg, []string{address})
+}
+
 const testEmailDomain = "mike-bland.com"
 const testSiteTitle = "Mike Bland's blog"
 const testUnsubscribeUser = "unsubscribe"
@@ -116,6 +175,12 @@ const testValidUidStr = "00000000-1111-2222-3333-444444444444"
 
 var testValidUid uuid.UUID = uuid.MustParse(testValidUidStr)
 
+// newTestLogs returns a testutils.Logs and a Logger that writes to it.
+func newTestLogs() (*testutils.Logs, Logger) {
+	logs, logger := testutils.NewLogs()
+	return logs, NewStdLogger(logger)
+}
+
 var testRedirects = RedirectPaths{
 	Invalid:           "invalid",
 	AlreadySubscribed: "already-subscribed",
@@ -123,6 +188,9 @@ var testRedirects = RedirectPaths{
 	Subscribed:        "subscribed",
 	NotSubscribed:     "not-subscribed",
 	Unsubscribed:      "unsubscribed",
+	Blocked:           "blocked",
+	LinkExpired:       "link-expired",
+	UnknownSubscriber: "unknown-subscriber",
 }
 
 type testBouncer struct {
@@ -161,7 +229,7 @@ type handlerFixture struct {
 }
 
 func newHandlerFixture() *handlerFixture {
-	logs, logger := testutils.NewLogs()
+	logs, logger := newTestLogs()
 	agent := &testAgent{}
 	bouncer := &testBouncer{}
 	ctx := context.Background()
@@ -291,7 +359,9 @@ func sesEventRecord() *events.SesEventRecord {
 }
 
 func TestNewHandler(t *testing.T) {
-	newHandler := func(responseTemplate string) (*Handler, error) {
+	newHandler := func(
+		responseTemplate string, opts ...HandlerOption,
+	) (*Handler, error) {
 		return NewHandler(
 			testEmailDomain,
 			testSiteTitle,
@@ -300,7 +370,8 @@ func TestNewHandler(t *testing.T) {
 			responseTemplate,
 			testUnsubscribeUser,
 			&testBouncer{},
-			&log.Logger{},
+			NewStdLogger(&log.Logger{}),
+			opts...,
 		)
 	}
 
@@ -311,6 +382,92 @@ func TestNewHandler(t *testing.T) {
 		assert.Equal(t, testSiteTitle, handler.api.SiteTitle)
 		assert.Equal(t, testUnsubscribeAddress, handler.mailto.UnsubscribeAddr)
 		assert.Assert(t, handler.sns != nil)
+		assert.DeepEqual(t, SnsOptions{}, handler.sns.Options)
+	})
+
+	t.Run("AppliesSnsOptions", func(t *testing.T) {
+		snsOpts := SnsOptions{IgnoreSuppressionListComplaints: true}
+
+		handler, err := newHandler(ResponseTemplate, WithSnsOptions(snsOpts))
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, snsOpts, handler.sns.Options)
+	})
+
+	t.Run("AppliesSesEventLog", func(t *testing.T) {
+		eventLog := &testEventLog{}
+
+		handler, err := newHandler(ResponseTemplate, WithSesEventLog(eventLog))
+
+		assert.NilError(t, err)
+		assert.Equal(t, SesEventLog(eventLog), handler.sns.EventLog)
+	})
+
+	t.Run("AppliesRedactedAddresses", func(t *testing.T) {
+		handler, err := newHandler(ResponseTemplate, WithRedactedAddresses())
+
+		assert.NilError(t, err)
+		assert.Assert(t, handler.mailto.RedactAddresses)
+		assert.Assert(t, handler.sns.RedactAddresses)
+	})
+
+	t.Run("AppliesMaintenanceMode", func(t *testing.T) {
+		handler, err := newHandler(ResponseTemplate, WithMaintenanceMode())
+
+		assert.NilError(t, err)
+		assert.Assert(t, handler.api.MaintenanceMode)
+	})
+
+	t.Run("AppliesVerifyRetries", func(t *testing.T) {
+		handler, err := newHandler(ResponseTemplate, WithVerifyRetries(2))
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2, handler.api.VerifyRetries)
+	})
+
+	t.Run("AppliesLinkSigningKey", func(t *testing.T) {
+		handler, err := newHandler(
+			ResponseTemplate, WithLinkSigningKey("signing key"),
+		)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []byte("signing key"), handler.api.LinkSigningKey)
+	})
+
+	t.Run("AppliesMailtoMaxAge", func(t *testing.T) {
+		handler, err := newHandler(
+			ResponseTemplate, WithMailtoMaxAge(72*time.Hour),
+		)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 72*time.Hour, handler.mailto.MaxAge)
+	})
+
+	t.Run("AppliesMailtoCatchAllUnsubscribe", func(t *testing.T) {
+		handler, err := newHandler(
+			ResponseTemplate, WithMailtoCatchAllUnsubscribe(),
+		)
+
+		assert.NilError(t, err)
+		assert.Assert(t, handler.mailto.CatchAllUnsubscribe)
+	})
+
+	t.Run("AppliesResponsePages", func(t *testing.T) {
+		pages := ResponsePages{ops.Subscribed: "<h1>{{.SiteTitle}}</h1>"}
+
+		handler, err := newHandler(ResponseTemplate, WithResponsePages(pages))
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(handler.api.responsePages, 3))
+	})
+
+	t.Run("ReturnsErrorIfBadResponsePage", func(t *testing.T) {
+		pages := ResponsePages{ops.Subscribed: "{{.Bogus}}"}
+
+		handler, err := newHandler(ResponseTemplate, WithResponsePages(pages))
+
+		assert.Assert(t, is.Nil(handler))
+		assert.ErrorContains(t, err, "response page for Subscribed: ")
 	})
 
 	t.Run("ReturnsErrorIfBadResponseTemplate", func(t *testing.T) {
@@ -345,6 +502,28 @@ func TestHandleEvent(t *testing.T) {
 		assert.Equal(t, expectedRedirect, apiResponse.Headers["location"])
 	})
 
+	t.Run("RedirectsToBlockedPageIfAddressBlocked", func(t *testing.T) {
+		f := newHandlerFixture()
+		f.event.Type = ApiRequest
+		f.agent.Error = fmt.Errorf("%w: mbland@acm.org", ops.ErrBlocked)
+
+		req := apiGatewayRequest(http.MethodPost, ops.ApiPrefixSubscribe)
+		req.Headers = map[string]string{
+			"content-type": "application/x-www-form-urlencoded",
+		}
+		req.Body = "email=mbland%40acm.org"
+		f.event.ApiRequest = req
+
+		response, err := f.handler.HandleEvent(f.ctx, f.event)
+
+		assert.NilError(t, err)
+		apiResponse, ok := response.(*awsevents.APIGatewayProxyResponse)
+		assert.Assert(t, ok)
+		assert.Equal(t, http.StatusSeeOther, apiResponse.StatusCode)
+		expectedRedirect := "https://" + testEmailDomain + "/blocked"
+		assert.Equal(t, expectedRedirect, apiResponse.Headers["location"])
+	})
+
 	t.Run("HandlesSuccessfulMailtoEvent", func(t *testing.T) {
 		f := newHandlerFixture()
 		f.event.Type = MailtoEvent
@@ -377,6 +556,41 @@ func TestHandleEvent(t *testing.T) {
 		f.logs.AssertContains(t, "success")
 	})
 
+	t.Run("ReturnsErrorIfSnsEventFails", func(t *testing.T) {
+		f := newHandlerFixture()
+		f.event.Type = SnsEvent
+		f.event.SnsEvent = simpleNotificationServiceEvent()
+		f.event.SnsEvent.Records[0].SNS.Message = "not JSON"
+
+		response, err := f.handler.HandleEvent(f.ctx, f.event)
+
+		assert.ErrorContains(t, err, "SNS message deadbeef: ")
+		assert.Assert(t, is.Nil(response))
+	})
+
+	t.Run("HandleSqsEventWithBatchItemFailures", func(t *testing.T) {
+		f := newHandlerFixture()
+		sesEvent := simpleNotificationServiceEvent().Records[0].SNS.Message
+		f.event.Type = SqsEvent
+		f.event.SqsEvent = &awsevents.SQSEvent{
+			Records: []awsevents.SQSMessage{
+				{MessageId: "good", Body: sesEvent},
+				{MessageId: "bad", Body: "not JSON"},
+			},
+		}
+
+		response, err := f.handler.HandleEvent(f.ctx, f.event)
+
+		assert.NilError(t, err)
+		expected := &awsevents.SQSEventResponse{
+			BatchItemFailures: []awsevents.SQSBatchItemFailure{
+				{ItemIdentifier: "bad"},
+			},
+		}
+		assert.DeepEqual(t, expected, response)
+		f.logs.AssertContains(t, `Subject:"This is an email sent to the list"`)
+	})
+
 	t.Run("HandleSuccessfulCommandLineEvent", func(t *testing.T) {
 		f := newHandlerFixture()
 		f.event.Type = CommandLineEvent
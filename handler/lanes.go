@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// recipientLanes runs work for different recipients concurrently, while
+// running work for the same recipient in the order it was dispatched.
+//
+// Dispatch assigns work to one of a fixed number of lanes by hashing the
+// recipient's address. Run executes each lane's work sequentially in its own
+// goroutine, returning after every lane has finished.
+//
+// With only one lane, Dispatch runs work immediately instead.
+type recipientLanes struct {
+	lanes [][]func()
+}
+
+func newRecipientLanes(numLanes int) *recipientLanes {
+	return &recipientLanes{lanes: make([][]func(), max(numLanes, 1))}
+}
+
+func (rl *recipientLanes) Dispatch(recipient string, work func()) {
+	if len(rl.lanes) == 1 {
+		work()
+		return
+	}
+	i := laneIndex(recipient, len(rl.lanes))
+	rl.lanes[i] = append(rl.lanes[i], work)
+}
+
+func (rl *recipientLanes) Run() {
+	var wg sync.WaitGroup
+
+	for i, lane := range rl.lanes {
+		if len(lane) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, work := range lane {
+				work()
+			}
+		}()
+		rl.lanes[i] = nil
+	}
+	wg.Wait()
+}
+
+// laneIndex hashes recipient case insensitively, since the domain part of an
+// address is case insensitive, and SES may report it in a different case.
+func laneIndex(recipient string, numLanes int) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(recipient)))
+	return int(h.Sum32() % uint32(numLanes))
+}
@@ -0,0 +1,56 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestRecipientLanes(t *testing.T) {
+	t.Run("RunsWorkImmediatelyWithOneLane", func(t *testing.T) {
+		lanes := newRecipientLanes(0)
+		ran := false
+
+		lanes.Dispatch("mbland@acm.org", func() { ran = true })
+
+		assert.Assert(t, ran)
+		assert.Assert(t, is.Len(lanes.lanes, 1))
+		assert.Assert(t, is.Len(lanes.lanes[0], 0))
+	})
+
+	t.Run("RunsWorkForSameRecipientInOrder", func(t *testing.T) {
+		lanes := newRecipientLanes(4)
+		order := []int{}
+
+		for i := range 5 {
+			work := func() { order = append(order, i) }
+			lanes.Dispatch("mbland@acm.org", work)
+		}
+		assert.Assert(t, is.Len(order, 0))
+		lanes.Run()
+
+		assert.DeepEqual(t, []int{0, 1, 2, 3, 4}, order)
+	})
+
+	t.Run("RunClearsLanes", func(t *testing.T) {
+		lanes := newRecipientLanes(4)
+		count := 0
+		lanes.Dispatch("mbland@acm.org", func() { count++ })
+
+		lanes.Run()
+		lanes.Run()
+
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("LaneIndexIgnoresCase", func(t *testing.T) {
+		assert.Equal(
+			t,
+			laneIndex("mbland@acm.org", 8),
+			laneIndex("MBland@ACM.org", 8),
+		)
+	})
+}
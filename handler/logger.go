@@ -0,0 +1,45 @@
+package handler
+
+import "log"
+
+// Logger is the interface through which the handlers emit log messages.
+//
+// NewStdLogger adapts a *log.Logger to this interface. Other implementations
+// may wrap structured logging packages, such as log/slog or go.uber.org/zap.
+type Logger interface {
+	// Printf logs a message without a level, as the standard log package does.
+	Printf(format string, v ...any)
+
+	// Infof logs a routine message.
+	Infof(format string, v ...any)
+
+	// Warnf logs a problem that doesn't prevent handling the current event.
+	Warnf(format string, v ...any)
+
+	// Errorf logs a failure to handle the current event.
+	Errorf(format string, v ...any)
+}
+
+// StdLogger adapts a *log.Logger to the Logger interface.
+//
+// Infof messages appear exactly as Printf messages do. Warnf and Errorf
+// messages begin with "WARNING: " and "ERROR: ", respectively.
+type StdLogger struct {
+	*log.Logger
+}
+
+func NewStdLogger(logger *log.Logger) *StdLogger {
+	return &StdLogger{logger}
+}
+
+func (l *StdLogger) Infof(format string, v ...any) {
+	l.Printf(format, v...)
+}
+
+func (l *StdLogger) Warnf(format string, v ...any) {
+	l.Printf("WARNING: "+format, v...)
+}
+
+func (l *StdLogger) Errorf(format string, v ...any) {
+	l.Printf("ERROR: "+format, v...)
+}
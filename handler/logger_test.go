@@ -0,0 +1,121 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/mbland/elistman/ops"
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+// recordingLogger records each message along with the method that logged it.
+type recordingLogger struct {
+	entries []string
+}
+
+func (l *recordingLogger) record(method, format string, v ...any) {
+	l.entries = append(l.entries, method+": "+fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Printf(format string, v ...any) {
+	l.record("Printf", format, v...)
+}
+
+func (l *recordingLogger) Infof(format string, v ...any) {
+	l.record("Infof", format, v...)
+}
+
+func (l *recordingLogger) Warnf(format string, v ...any) {
+	l.record("Warnf", format, v...)
+}
+
+func (l *recordingLogger) Errorf(format string, v ...any) {
+	l.record("Errorf", format, v...)
+}
+
+func (l *recordingLogger) assertLogged(t *testing.T, method, msg string) {
+	t.Helper()
+	for _, entry := range l.entries {
+		if strings.HasPrefix(entry, method+": "+msg) {
+			return
+		}
+	}
+	t.Errorf("no %s entry beginning with %q in: %+v", method, msg, l.entries)
+}
+
+func TestStdLogger(t *testing.T) {
+	setup := func() (*testutils.Logs, *StdLogger) {
+		logs := &testutils.Logs{}
+		return logs, NewStdLogger(log.New(&logs.Builder, "", 0))
+	}
+
+	t.Run("PrintfAndInfofHaveNoPrefix", func(t *testing.T) {
+		logs, logger := setup()
+
+		logger.Printf("printed %d", 1)
+		logger.Infof("informed %d", 2)
+
+		assert.Equal(t, "printed 1\ninformed 2\n", logs.Logs())
+	})
+
+	t.Run("WarnfAndErrorfAddPrefixes", func(t *testing.T) {
+		logs, logger := setup()
+
+		logger.Warnf("warned %d", 3)
+		logger.Errorf("failed %d", 4)
+
+		assert.Equal(t, "WARNING: warned 3\nERROR: failed 4\n", logs.Logs())
+	})
+}
+
+func TestHandlersLogThroughLogger(t *testing.T) {
+	setup := func() (*Handler, *testAgent, *recordingLogger) {
+		logger := &recordingLogger{}
+		agent := &testAgent{}
+		handler, err := NewHandler(
+			testEmailDomain,
+			testSiteTitle,
+			agent,
+			testRedirects,
+			ResponseTemplate,
+			testUnsubscribeUser,
+			&testBouncer{},
+			logger,
+		)
+
+		assert.NilError(t, err)
+		return handler, agent, logger
+	}
+	ctx := context.Background()
+
+	t.Run("Mailto", func(t *testing.T) {
+		handler, agent, logger := setup()
+		agent.OpResult = ops.Unsubscribed
+		event := &Event{Type: MailtoEvent, MailtoEvent: simpleEmailEvent()}
+
+		_, err := handler.HandleEvent(ctx, event)
+
+		assert.NilError(t, err)
+		logger.assertLogged(t, "Printf", `unsubscribe [Id:"deadbeef"`)
+	})
+
+	t.Run("Sns", func(t *testing.T) {
+		handler, _, logger := setup()
+		snsEvent := simpleNotificationServiceEvent()
+		snsEvent.Records[0].SNS.Message = unimplementedEventJson
+		event := &Event{Type: SnsEvent, SnsEvent: snsEvent}
+
+		_, err := handler.HandleEvent(ctx, event)
+
+		assert.NilError(t, err)
+		logger.assertLogged(
+			t, "Warnf", "unimplemented event type: Subscription",
+		)
+	})
+}
@@ -2,11 +2,13 @@ package handler
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/email"
 	"github.com/mbland/elistman/ops"
 )
@@ -16,7 +18,21 @@ type mailtoHandler struct {
 	UnsubscribeAddr string
 	Agent           agent.SubscriptionAgent
 	Bouncer         email.Bouncer
-	Log             *log.Logger
+	Log             Logger
+	RedactAddresses bool
+
+	// MaxAge, if greater than zero, causes the handler to ignore events
+	// received longer than MaxAge ago, e.g., events replayed or delayed long
+	// after the fact.
+	MaxAge time.Duration
+
+	// CatchAllUnsubscribe, if true, removes and suppresses the sender of an
+	// unsubscribe email whose subject doesn't contain a valid subscriber UID,
+	// as long as the sender is a subscriber. See catchAllUnsubscribe.
+	CatchAllUnsubscribe bool
+
+	// Now returns the current time. Defaults to time.Now if nil.
+	Now func() time.Time
 }
 
 func (h *mailtoHandler) HandleEvent(
@@ -69,6 +85,12 @@ func newMailtoEvent(ses *events.SimpleEmailService) *mailtoEvent {
 func (h *mailtoHandler) handleMailtoEvent(
 	ctx context.Context, ev *mailtoEvent,
 ) {
+	if age, stale := h.isStale(ev); stale {
+		const staleFmt = "received %s ago, exceeding max age %s, ignored"
+		h.logOutcome(ev, fmt.Sprintf(staleFmt, age, h.MaxAge))
+		return
+	}
+
 	outcome := "success"
 	unsubscribe := h.Agent.Unsubscribe
 
@@ -80,21 +102,96 @@ func (h *mailtoHandler) handleMailtoEvent(
 		outcome = "marked as spam, ignored"
 	} else if op, err := parseMailtoEvent(ev, h.UnsubscribeAddr); err != nil {
 		outcome = "failed to parse, ignoring: " + err.Error()
+		if h.CatchAllUnsubscribe {
+			failure := "failed to parse: " + err.Error()
+			outcome = h.catchAllUnsubscribe(ctx, ev, failure)
+		}
 	} else if result, err := unsubscribe(ctx, op.Email, op.Uid); err != nil {
 		outcome = "error: " + err.Error()
 	} else if result != ops.Unsubscribed {
 		outcome = "failed: " + result.String()
+		if h.CatchAllUnsubscribe && result == ops.NotSubscribed {
+			outcome = h.catchAllUnsubscribe(ctx, ev, outcome)
+		}
 	}
 	h.logOutcome(ev, outcome)
 }
 
+// catchAllUnsubscribe removes the sender of ev from the list and adds them to
+// the account-level suppression list, after ev failed to unsubscribe anyone.
+//
+// Laws such as CAN-SPAM and the GDPR require honoring unsubscribe requests,
+// even if the subscriber mangled the UID in the subject, or sent the request
+// from a mail client that dropped it. This trades the UID check for compliance:
+// Any subscriber can unsubscribe by emailing the unsubscribe address from their
+// own address. SPF, DKIM, and DMARC checks still apply, so the sender's address
+// is reasonably trustworthy. It never removes an address other than the
+// sender's, even if one appears in the subject.
+//
+// Suppression prevents the sender from subscribing again until someone removes
+// the address from the suppression list. The sender may not realize the
+// request succeeded, since the UID didn't match, and suppression ensures that
+// a later subscribe request can't lead to more unwanted messages.
+//
+// failure describes why the regular unsubscribe failed. The result describes
+// whether the catch-all applied, and why or why not, for logOutcome.
+func (h *mailtoHandler) catchAllUnsubscribe(
+	ctx context.Context, ev *mailtoEvent, failure string,
+) string {
+	const prefix = "; catch-all unsubscribe"
+	var sender string
+	var status db.SubscriberStatus
+	var err error
+
+	if sender, err = parseMailtoSender(ev, h.UnsubscribeAddr); err != nil {
+		return failure + prefix + " not applied: " + err.Error()
+	} else if status, err = h.Agent.Status(ctx, sender); err != nil {
+		return failure + prefix + " error: " + err.Error()
+	} else if status == agent.StatusUnknown {
+		return failure + prefix + " not applied: not a subscriber: " + sender
+	}
+
+	// The SES suppression list only supports the BOUNCE and COMPLAINT
+	// reasons. An unsolicited unsubscribe request is closer to a complaint.
+	err = h.Agent.Remove(ctx, sender, ops.RemoveReasonComplaint)
+	if err != nil {
+		return failure + prefix + " error: " + err.Error()
+	}
+	return failure + prefix + " removed and suppressed " + sender
+}
+
+// isStale returns the age of ev and whether it exceeds MaxAge.
+func (h *mailtoHandler) isStale(ev *mailtoEvent) (
+	age time.Duration, stale bool,
+) {
+	if h.MaxAge <= 0 {
+		return
+	}
+	now := time.Now
+	if h.Now != nil {
+		now = h.Now
+	}
+	age = now().Sub(ev.Timestamp)
+	return age, age > h.MaxAge
+}
+
+// logOutcome logs the outcome of handling ev, including the SPF, DKIM, and
+// DMARC verdicts and the DMARC policy. These explain why the handler bounced,
+// ignored, or processed the message.
 func (h *mailtoHandler) logOutcome(ev *mailtoEvent, outcome string) {
-	h.Log.Printf(
-		`unsubscribe [Id:"%s" From:"%s" To:"%s" Subject:"%s"]: %s`,
+	logRedacted(
+		h.Log,
+		h.RedactAddresses,
+		`unsubscribe [Id:"%s" From:"%s" To:"%s" Subject:"%s" `+
+			`Spf:"%s" Dkim:"%s" Dmarc:"%s" DmarcPolicy:"%s"]: %s`,
 		ev.MessageId,
 		strings.Join(ev.From, ","),
 		strings.Join(ev.To, ","),
 		ev.Subject,
+		ev.SpfVerdict,
+		ev.DkimVerdict,
+		ev.DmarcVerdict,
+		ev.DmarcPolicy,
 		outcome,
 	)
 }
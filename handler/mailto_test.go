@@ -5,13 +5,17 @@ package handler
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/mbland/elistman/agent"
+	"github.com/mbland/elistman/db"
 	"github.com/mbland/elistman/ops"
 	"github.com/mbland/elistman/testutils"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 type mailtoHandlerFixture struct {
@@ -24,7 +28,7 @@ type mailtoHandlerFixture struct {
 }
 
 func newMailtoHandlerFixture() *mailtoHandlerFixture {
-	logs, logger := testutils.NewLogs()
+	logs, logger := newTestLogs()
 	agent := &testAgent{}
 	bouncer := &testBouncer{}
 	bouncer.ReturnMessageId = "0x123456789"
@@ -39,7 +43,11 @@ func newMailtoHandlerFixture() *mailtoHandlerFixture {
 		bouncer,
 		logs,
 		&mailtoHandler{
-			testEmailDomain, testUnsubscribeAddress, agent, bouncer, logger,
+			EmailDomain:     testEmailDomain,
+			UnsubscribeAddr: testUnsubscribeAddress,
+			Agent:           agent,
+			Bouncer:         bouncer,
+			Log:             logger,
 		},
 		context.Background(),
 		&mailtoEvent{
@@ -65,6 +73,9 @@ func TestNewMailtoEvent(t *testing.T) {
 	assert.DeepEqual(t, f.event, newMailtoEvent(simpleEmailService()))
 }
 
+const passingVerdicts = `Spf:"PASS" Dkim:"PASS" Dmarc:"PASS" ` +
+	`DmarcPolicy:"REJECT"`
+
 func TestLogOutcome(t *testing.T) {
 	// Though normally we only expect one From: and one To: address, we include
 	// multiple of each to ensure joining is happening.
@@ -77,7 +88,22 @@ func TestLogOutcome(t *testing.T) {
 	f.logs.AssertContains(t, `unsubscribe [Id:"deadbeef" `+
 		`From:"mbland@acm.org,foo@bar.com" `+
 		`To:"`+testUnsubscribeAddress+`,baz@quux.com" `+
-		`Subject:"mbland@acm.org `+testValidUidStr+`"]: success`)
+		`Subject:"mbland@acm.org `+testValidUidStr+`" `+
+		passingVerdicts+`]: success`)
+}
+
+func TestLogOutcomeRedactsAddresses(t *testing.T) {
+	f := newMailtoHandlerFixture()
+	f.handler.RedactAddresses = true
+
+	f.handler.logOutcome(f.event, "success")
+
+	f.logs.AssertContains(t, `unsubscribe [Id:"deadbeef" `+
+		`From:"m****@acm.org" `+
+		`To:"u****@`+testEmailDomain+`" `+
+		`Subject:"m****@acm.org `+testValidUidStr+`" `+
+		passingVerdicts+`]: success`)
+	assert.Assert(t, !strings.Contains(f.logs.Logs(), "mbland@"))
 }
 
 func TestBounceIfDmarcFails(t *testing.T) {
@@ -152,7 +178,39 @@ func TestHandleMailtoEvent(t *testing.T) {
 		f.logs.AssertContains(t, `unsubscribe [Id:"deadbeef" `+
 			`From:"mbland@acm.org" `+
 			`To:"`+testUnsubscribeAddress+`" `+
-			`Subject:"mbland@acm.org `+testValidUidStr+`"]: success`)
+			`Subject:"mbland@acm.org `+testValidUidStr+`" `+
+			passingVerdicts+`]: success`)
+	})
+
+	t.Run("ProceedsIfWithinMaxAge", func(t *testing.T) {
+		f := newMailtoHandlerFixture()
+		f.agent.OpResult = ops.Unsubscribed
+		f.handler.MaxAge = time.Hour
+		f.handler.Now = func() time.Time {
+			return f.event.Timestamp.Add(time.Hour)
+		}
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		f.logs.AssertContains(t, "]: success")
+		assert.Equal(t, "Unsubscribe", f.agent.Calls[0].Method)
+	})
+
+	t.Run("IgnoresIfOlderThanMaxAge", func(t *testing.T) {
+		f := newMailtoHandlerFixture()
+		f.event.DmarcVerdict = "FAIL"
+		f.handler.MaxAge = time.Hour
+		f.handler.Now = func() time.Time {
+			return f.event.Timestamp.Add(time.Hour + time.Minute)
+		}
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		f.logs.AssertContains(
+			t, "]: received 1h1m0s ago, exceeding max age 1h0m0s, ignored",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		assert.Equal(t, "", f.bouncer.MessageId)
 	})
 
 	t.Run("LogsIfFailsToBounceOnDmarcFail", func(t *testing.T) {
@@ -177,6 +235,23 @@ func TestHandleMailtoEvent(t *testing.T) {
 		f.logs.AssertContains(t, "DMARC bounced with message ID: 0x123456789")
 	})
 
+	t.Run("LogsFailingVerdicts", func(t *testing.T) {
+		f := newMailtoHandlerFixture()
+		f.event.SpfVerdict = "FAIL"
+		f.event.DkimVerdict = "GRAY"
+		f.event.DmarcVerdict = "FAIL"
+		f.event.DmarcPolicy = "REJECT"
+		f.bouncer.ReturnMessageId = "0x123456789"
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		f.logs.AssertContains(
+			t,
+			`Spf:"FAIL" Dkim:"GRAY" Dmarc:"FAIL" DmarcPolicy:"REJECT"]: `+
+				"DMARC bounced with message ID: 0x123456789",
+		)
+	})
+
 	t.Run("IgnoresIfSpam", func(t *testing.T) {
 		f := newMailtoHandlerFixture()
 		f.event.VirusVerdict = "FAIL"
@@ -214,6 +289,152 @@ func TestHandleMailtoEvent(t *testing.T) {
 	})
 }
 
+func TestCatchAllUnsubscribe(t *testing.T) {
+	setup := func() *mailtoHandlerFixture {
+		f := newMailtoHandlerFixture()
+		f.handler.CatchAllUnsubscribe = true
+		f.agent.OpResult = ops.NotSubscribed
+		f.agent.StatusResult = db.SubscriberVerified
+		return f
+	}
+
+	assertCalls := func(
+		t *testing.T, f *mailtoHandlerFixture, methods ...string,
+	) {
+		t.Helper()
+		calls := []string{}
+		for _, call := range f.agent.Calls {
+			calls = append(calls, call.Method)
+		}
+		assert.DeepEqual(t, append([]string{}, methods...), calls)
+	}
+
+	t.Run("SuppressesSenderIfUidDoesNotMatch", func(t *testing.T) {
+		f := setup()
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Unsubscribe", "Status", "Remove")
+		remove := f.agent.Calls[2]
+		assert.Equal(t, "mbland@acm.org", remove.Email)
+		assert.Equal(t, ops.RemoveReasonComplaint, remove.Reason)
+		f.logs.AssertContains(
+			t,
+			"]: failed: NotSubscribed; catch-all unsubscribe "+
+				"removed and suppressed mbland@acm.org",
+		)
+	})
+
+	t.Run("SuppressesSenderIfUidIsInvalid", func(t *testing.T) {
+		f := setup()
+		f.event.From = []string{"Mike Bland <mbland@acm.org>"}
+		f.event.Subject = "mbland@acm.org UID"
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Status", "Remove")
+		assert.Equal(t, "mbland@acm.org", f.agent.Calls[1].Email)
+		f.logs.AssertContains(
+			t,
+			"]: failed to parse: invalid uid: UID: invalid UUID length: 3; "+
+				"catch-all unsubscribe removed and suppressed mbland@acm.org",
+		)
+	})
+
+	t.Run("SuppressesSenderNotAddressInSubject", func(t *testing.T) {
+		f := setup()
+		f.event.Subject = "foo@bar.com " + testValidUidStr
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Unsubscribe", "Status", "Remove")
+		assert.Equal(t, "foo@bar.com", f.agent.Calls[0].Email)
+		assert.Equal(t, "mbland@acm.org", f.agent.Calls[2].Email)
+	})
+
+	t.Run("RejectsIfDisabled", func(t *testing.T) {
+		f := setup()
+		f.handler.CatchAllUnsubscribe = false
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Unsubscribe")
+		f.logs.AssertContains(t, "]: failed: NotSubscribed\n")
+	})
+
+	t.Run("RejectsInvalidUidIfDisabled", func(t *testing.T) {
+		f := setup()
+		f.handler.CatchAllUnsubscribe = false
+		f.event.Subject = "mbland@acm.org UID"
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f)
+		f.logs.AssertContains(t, "]: failed to parse, ignoring: invalid uid: ")
+	})
+
+	t.Run("RejectsIfSenderIsNotASubscriber", func(t *testing.T) {
+		f := setup()
+		f.agent.StatusResult = agent.StatusUnknown
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Unsubscribe", "Status")
+		f.logs.AssertContains(
+			t,
+			"; catch-all unsubscribe not applied: "+
+				"not a subscriber: mbland@acm.org",
+		)
+	})
+
+	t.Run("RejectsIfNotAddressedToUnsubscribeAddress", func(t *testing.T) {
+		f := setup()
+		f.event.To = []string{"foo@bar.com"}
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f)
+		f.logs.AssertContains(
+			t,
+			"; catch-all unsubscribe not applied: not addressed to "+
+				testUnsubscribeAddress+": foo@bar.com",
+		)
+	})
+
+	t.Run("RejectsIfSpam", func(t *testing.T) {
+		f := setup()
+		f.event.DkimVerdict = "FAIL"
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f)
+		f.logs.AssertContains(t, "]: marked as spam, ignored")
+	})
+
+	t.Run("IgnoresOtherUnsubscribeFailures", func(t *testing.T) {
+		f := setup()
+		f.agent.OpResult = ops.Invalid
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Unsubscribe")
+		f.logs.AssertContains(t, "]: failed: Invalid")
+	})
+
+	t.Run("LogsIfStatusFails", func(t *testing.T) {
+		f := setup()
+		f.event.Subject = "mbland@acm.org UID"
+		f.agent.Error = errors.New("status failed")
+
+		f.handler.handleMailtoEvent(f.ctx, f.event)
+
+		assertCalls(t, f, "Status")
+		f.logs.AssertContains(
+			t, "; catch-all unsubscribe error: status failed",
+		)
+	})
+}
+
 func TestMailtoHandlerHandleEvent(t *testing.T) {
 	f := newMailtoHandlerFixture()
 	f.agent.OpResult = ops.Unsubscribed
@@ -3,8 +3,10 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mbland/elistman/types"
 )
@@ -16,6 +18,22 @@ type RedirectPaths struct {
 	Subscribed        string
 	NotSubscribed     string
 	Unsubscribed      string
+
+	// Blocked is optional. If empty, blocked addresses redirect to Invalid.
+	Blocked string
+
+	// LinkExpired is optional. If empty, verify requests with expired links
+	// redirect to NotSubscribed.
+	LinkExpired string
+
+	// UnknownSubscriber is optional. If empty, or if LinkSigningKey is empty,
+	// verify requests for addresses with no subscriber record redirect to
+	// NotSubscribed.
+	UnknownSubscriber string
+
+	// Maintenance is optional. If defined, responses to subscribe and verify
+	// requests link to it while in maintenance mode.
+	Maintenance string
 }
 
 type Options struct {
@@ -31,7 +49,157 @@ type Options struct {
 	ConfigurationSet     string
 	MaxBulkSendCapacity  types.Capacity
 
+	// MaxSendRateCapacity is the portion of the SES maximum send rate used to
+	// pace outgoing messages. SendRate, if greater than zero, overrides it.
+	// Both are optional; see email.SesThrottle for defaults. Leave
+	// MAX_SEND_RATE_CAPACITY empty to use the default; "0" is an error.
+	MaxSendRateCapacity types.Capacity
+	SendRate            float64
+
+	// MaxSendRetries is the number of times to retry sending a message after
+	// SES throttles the request or is temporarily unavailable.
+	MaxSendRetries int
+
+	// Base64MaxQpRatio and Base64MaxQpSize determine when a message body uses
+	// base64 instead of quoted-printable encoding. Zero disables either check.
+	// See email.WithBase64Threshold.
+	Base64MaxQpRatio float64
+	Base64MaxQpSize  int
+
+	// SenderIdentityArns lists the ARNs of SES identities from which to send
+	// messages. If defined, messages are sent from the first identity whose
+	// custom MAIL FROM domain aligns with EmailDomainName, and startup fails
+	// if none aligns. See email.SelectMailFromIdentity. Defined as a comma
+	// separated list.
+	SenderIdentityArns []string
+
+	// ListHelpUrl and ListSubscribeUrl are optional. If defined, they populate
+	// the List-Help and List-Subscribe headers of messages sent to the list.
+	ListHelpUrl      string
+	ListSubscribeUrl string
+
+	// CheckSuppressionBeforeSend causes list sends to skip recipients on the
+	// account-level suppression list.
+	CheckSuppressionBeforeSend bool
+
+	// LookupSuppressionReasons causes addresses failing validation due to
+	// the account-level suppression list to report the suppression reason.
+	LookupSuppressionReasons bool
+
+	// BounceDryRun causes DMARC bounces to be logged instead of sent.
+	BounceDryRun bool
+
+	// SendDryRun causes the mailer to skip sending messages and the agent to
+	// skip the send log, e.g. to exercise a campaign in staging.
+	SendDryRun bool
+
+	// RedactEmailAddresses masks the username of email addresses in the logs.
+	RedactEmailAddresses bool
+
+	// LogConsumedCapacity logs the capacity units consumed by each DynamoDB
+	// request.
+	LogConsumedCapacity bool
+
+	// LinkSigningKey, if defined, is the secret used to sign and validate
+	// verify and unsubscribe links. Status requests are disabled without it.
+	LinkSigningKey string
+
+	// DkimSelector and DkimPrivateKey, if defined, cause every message to
+	// carry a DKIM-Signature header for EmailDomainName, in addition to any
+	// signature SES applies itself. The public key must be published in the
+	// "<DkimSelector>._domainkey.<EmailDomainName>" DNS TXT record. Both or
+	// neither must be defined.
+	//
+	// DkimPrivateKey is a PEM encoded RSA private key, or just the base64
+	// encoded body of its PEM block. See email.NewRsaDkimSigner.
+	DkimSelector   string
+	DkimPrivateKey string
+
+	// AllowedSingleLabelDomains lists domains without dots, e.g., "intranet",
+	// from which to accept subscriptions. Defined as a comma separated list.
+	AllowedSingleLabelDomains []string
+
+	// AllowedIpLiteralRanges lists IP address ranges in CIDR notation, e.g.,
+	// "10.0.0.0/8", from which to accept addresses with IP literal domains,
+	// e.g., "user@[10.0.0.5]". Defined as a comma separated list.
+	AllowedIpLiteralRanges []netip.Prefix
+
+	// InvalidUserNames and InvalidDomains list usernames and domains to reject
+	// in addition to the email package's built-in defaults. Defined as comma
+	// separated lists.
+	InvalidUserNames []string
+	InvalidDomains   []string
+
+	// RoleUserNames lists role-based usernames, such as "info" or "sales", for
+	// which address validation fails with a "role-based address" reason.
+	// Defined as a comma separated list.
+	RoleUserNames []string
+
+	// MaintenanceMode causes subscribe and verify requests to fail with HTTP
+	// 503 Service Unavailable while other requests work as usual.
+	MaintenanceMode bool
+
+	// MxFailureThreshold is the number of times all of an address's MX hosts
+	// must fail validation within MxFailureWindow before suppressing it.
+	// Values less than two suppress the address on the first failure. The
+	// failures are recorded in SesEventsTableName if defined.
+	MxFailureThreshold int
+	MxFailureWindow    time.Duration
+
+	// DnsLookupTimeout, if greater than zero, limits the duration of each DNS
+	// lookup performed during address validation.
+	DnsLookupTimeout time.Duration
+
+	// MaxConcurrentDnsLookups, if greater than zero, limits the number of DNS
+	// lookups in progress at once across all address validations.
+	MaxConcurrentDnsLookups int
+
+	// MailtoMaxAge, if greater than zero, is the maximum age of an unsubscribe
+	// email to act upon. Older emails, e.g., delayed or replayed SES receipt
+	// events, are ignored.
+	MailtoMaxAge time.Duration
+
+	// MailtoCatchAllUnsubscribe causes an unsubscribe email from a
+	// subscriber's own address to remove and suppress that address, even if
+	// the UID in the subject is missing, invalid, or doesn't match.
+	MailtoCatchAllUnsubscribe bool
+
+	// VerifyLinkExpiry, if greater than zero, limits how long a verification
+	// link remains valid, independently of the pending record's lifetime.
+	VerifyLinkExpiry time.Duration
+
+	// VerifyRetries is the number of times to retry a verify request after a
+	// transient error from an upstream service.
+	VerifyRetries int
+
+	// ResponsePagesDir, if defined, is the directory containing the templates
+	// named in ResponsePageFiles. Setting it causes successful subscribe,
+	// verify, and unsubscribe requests to receive HTML pages instead of
+	// redirects. See WithResponsePages.
+	ResponsePagesDir string
+
+	// SesEventsTableName, if defined, is the DynamoDB table recording the SES
+	// events received via SNS, so that duplicate deliveries are ignored. It
+	// also records MX validation failures for email.MxFailurePolicy. See
+	// WithSesEventLog and db.DynamoDbEventLog.
+	SesEventsTableName string
+
+	// SesEventsTtl, if greater than zero, is how long SesEventsTableName
+	// remembers each event. Defaults to db.DefaultEventLogTtl.
+	SesEventsTtl time.Duration
+
+	// SendLogTtl, if greater than zero, is how long SesEventsTableName
+	// remembers each recipient of a message with a CampaignKey. Defaults to
+	// db.DefaultSendLogTtl. See agent.ProdAgent.SendLog.
+	SendLogTtl time.Duration
+
+	// MetricsNamespace, if defined, is the CloudWatch namespace for counts of
+	// SES events and sends, emitted via the embedded metric format in the
+	// function's logs. See WithMetrics and email.SesMailer.Metrics.
+	MetricsNamespace string
+
 	RedirectPaths RedirectPaths
+	SnsOptions    SnsOptions
 }
 
 type UndefinedEnvVarsError struct {
@@ -67,6 +235,60 @@ func (env *environment) options() (*Options, error) {
 	env.assign(&opts.SubscribersTableName, "SUBSCRIBERS_TABLE_NAME")
 	env.assign(&opts.ConfigurationSet, "CONFIGURATION_SET")
 	env.assignCapacity(&opts.MaxBulkSendCapacity, "MAX_BULK_SEND_CAPACITY")
+	env.assignOptionalPositiveCapacity(
+		&opts.MaxSendRateCapacity, "MAX_SEND_RATE_CAPACITY",
+	)
+	env.assignOptionalFloat(&opts.SendRate, "SEND_RATE")
+	env.assignOptionalInt(&opts.MaxSendRetries, "MAX_SEND_RETRIES")
+	env.assignOptionalFloat(&opts.Base64MaxQpRatio, "BASE64_MAX_QP_RATIO")
+	env.assignOptionalInt(&opts.Base64MaxQpSize, "BASE64_MAX_QP_SIZE")
+	env.assignOptionalList(&opts.SenderIdentityArns, "SENDER_IDENTITY_ARNS")
+	env.assignOptional(&opts.ListHelpUrl, "LIST_HELP_URL")
+	env.assignOptional(&opts.ListSubscribeUrl, "LIST_SUBSCRIBE_URL")
+	env.assignOptionalBool(
+		&opts.CheckSuppressionBeforeSend, "CHECK_SUPPRESSION_BEFORE_SEND",
+	)
+	env.assignOptionalBool(
+		&opts.LookupSuppressionReasons, "LOOKUP_SUPPRESSION_REASONS",
+	)
+	env.assignOptionalBool(&opts.BounceDryRun, "BOUNCE_DRY_RUN")
+	env.assignOptionalBool(&opts.SendDryRun, "SEND_DRY_RUN")
+	env.assignOptionalBool(
+		&opts.RedactEmailAddresses, "REDACT_EMAIL_ADDRESSES",
+	)
+	env.assignOptionalBool(&opts.LogConsumedCapacity, "LOG_CONSUMED_CAPACITY")
+	env.assignOptional(&opts.LinkSigningKey, "LINK_SIGNING_KEY")
+	env.assignOptional(&opts.DkimSelector, "DKIM_SELECTOR")
+	env.assignOptional(&opts.DkimPrivateKey, "DKIM_PRIVATE_KEY")
+	if (opts.DkimSelector == "") != (opts.DkimPrivateKey == "") {
+		env.errors = append(env.errors, errors.New(
+			"DKIM_SELECTOR and DKIM_PRIVATE_KEY must both be defined, "+
+				"or neither",
+		))
+	}
+	env.assignOptionalList(
+		&opts.AllowedSingleLabelDomains, "ALLOWED_SINGLE_LABEL_DOMAINS",
+	)
+	env.assignOptionalPrefixList(
+		&opts.AllowedIpLiteralRanges, "ALLOWED_IP_LITERAL_RANGES",
+	)
+	env.assignOptionalList(&opts.InvalidUserNames, "INVALID_USER_NAMES")
+	env.assignOptionalList(&opts.InvalidDomains, "INVALID_DOMAINS")
+	env.assignOptionalList(&opts.RoleUserNames, "ROLE_USER_NAMES")
+	env.assignOptionalBool(&opts.MaintenanceMode, "MAINTENANCE_MODE")
+	env.assignOptionalInt(&opts.MxFailureThreshold, "MX_FAILURE_THRESHOLD")
+	env.assignOptionalDuration(&opts.MxFailureWindow, "MX_FAILURE_WINDOW")
+	env.assignOptionalDuration(&opts.DnsLookupTimeout, "DNS_LOOKUP_TIMEOUT")
+	env.assignOptionalInt(
+		&opts.MaxConcurrentDnsLookups, "MAX_CONCURRENT_DNS_LOOKUPS",
+	)
+	env.assignOptionalDuration(&opts.MailtoMaxAge, "MAILTO_MAX_AGE")
+	env.assignOptionalBool(
+		&opts.MailtoCatchAllUnsubscribe, "MAILTO_CATCH_ALL_UNSUBSCRIBE",
+	)
+	env.assignOptionalDuration(&opts.VerifyLinkExpiry, "VERIFY_LINK_EXPIRY")
+	env.assignOptionalInt(&opts.VerifyRetries, "VERIFY_RETRIES")
+	env.assignOptional(&opts.ResponsePagesDir, "RESPONSE_PAGES_DIR")
 
 	redirects := &opts.RedirectPaths
 	env.assignPath(&redirects.Invalid, "INVALID_REQUEST_PATH")
@@ -75,6 +297,34 @@ func (env *environment) options() (*Options, error) {
 	env.assignPath(&redirects.Subscribed, "SUBSCRIBED_PATH")
 	env.assignPath(&redirects.NotSubscribed, "NOT_SUBSCRIBED_PATH")
 	env.assignPath(&redirects.Unsubscribed, "UNSUBSCRIBED_PATH")
+	env.assignOptionalPath(&redirects.Blocked, "BLOCKED_PATH")
+	env.assignOptionalPath(&redirects.LinkExpired, "LINK_EXPIRED_PATH")
+	env.assignOptionalPath(
+		&redirects.UnknownSubscriber, "UNKNOWN_SUBSCRIBER_PATH",
+	)
+	env.assignOptionalPath(&redirects.Maintenance, "MAINTENANCE_PATH")
+
+	sns := &opts.SnsOptions
+	env.assignOptionalBool(
+		&sns.IgnoreSuppressionListComplaints,
+		"IGNORE_SUPPRESSION_LIST_COMPLAINTS",
+	)
+	env.assignOptionalBool(
+		&sns.TolerateSchemaDrift, "TOLERATE_SES_SCHEMA_DRIFT",
+	)
+	env.assignOptionalInt(&sns.Concurrency, "SNS_CONCURRENCY")
+	env.assignOptionalBool(&sns.RecordDeliveries, "RECORD_DELIVERIES")
+	env.assignOptionalBouncePolicy(&sns.BouncePolicy, "BOUNCE_POLICY")
+	env.assignOptionalInt(&sns.BounceRetries, "BOUNCE_RETRIES")
+	env.assignOptionalSampleRate(
+		&sns.SampleSuccessLogs,
+		&sns.SuccessLogSampleRate,
+		"SUCCESS_LOG_SAMPLE_RATE",
+	)
+	env.assignOptional(&opts.SesEventsTableName, "SES_EVENTS_TABLE_NAME")
+	env.assignOptionalDuration(&opts.SesEventsTtl, "SES_EVENTS_TTL")
+	env.assignOptionalDuration(&opts.SendLogTtl, "SEND_LOG_TTL")
+	env.assignOptional(&opts.MetricsNamespace, "METRICS_NAMESPACE")
 
 	if len(env.undefinedVars) != 0 {
 		undefErr := &UndefinedEnvVarsError{UndefinedVars: env.undefinedVars}
@@ -94,12 +344,40 @@ func (env *environment) assign(opt *string, varname string) {
 	}
 }
 
+func (env *environment) assignOptional(opt *string, varname string) {
+	*opt = env.getenv(varname)
+}
+
 func (env *environment) assignCapacity(opt *types.Capacity, varname string) {
 	var capStr string
+
+	env.assign(&capStr, varname)
+	env.parseCapacity(opt, varname, capStr)
+}
+
+// assignOptionalPositiveCapacity leaves opt unchanged if varname is undefined
+// or empty. It rejects zero, which consumers treat the same as unset, so that
+// an explicit zero doesn't silently select the consumer's default.
+func (env *environment) assignOptionalPositiveCapacity(
+	opt *types.Capacity, varname string,
+) {
+	capStr := env.getenv(varname)
+	numErrs := len(env.errors)
+
+	env.parseCapacity(opt, varname, capStr)
+	if capStr != "" && len(env.errors) == numErrs && opt.Value() == 0 {
+		const errFmt = "invalid %s: %w: must be greater than zero"
+		err := fmt.Errorf(errFmt, varname, types.ErrInvalidCapacity)
+		env.errors = append(env.errors, err)
+	}
+}
+
+func (env *environment) parseCapacity(
+	opt *types.Capacity, varname, capStr string,
+) {
 	var capRaw float64
 	var err error
 
-	env.assign(&capStr, varname)
 	addErr := func(err error) {
 		const errFmt = "invalid %s: %w"
 		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
@@ -114,7 +392,144 @@ func (env *environment) assignCapacity(opt *types.Capacity, varname string) {
 	}
 }
 
+// assignOptionalBool leaves opt unchanged if varname is undefined or empty.
+func (env *environment) assignOptionalBool(opt *bool, varname string) {
+	value := env.getenv(varname)
+
+	if value == "" {
+		return
+	} else if b, err := strconv.ParseBool(value); err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*opt = b
+	}
+}
+
+// assignOptionalList splits a comma separated value into opt, dropping empty
+// elements and surrounding whitespace.
+func (env *environment) assignOptionalList(opt *[]string, varname string) {
+	for _, value := range strings.Split(env.getenv(varname), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			*opt = append(*opt, value)
+		}
+	}
+}
+
+// assignOptionalPrefixList splits a comma separated list of IP address ranges
+// in CIDR notation into opt, dropping empty elements and surrounding
+// whitespace.
+func (env *environment) assignOptionalPrefixList(
+	opt *[]netip.Prefix, varname string,
+) {
+	var values []string
+	env.assignOptionalList(&values, varname)
+
+	for _, value := range values {
+		if p, err := netip.ParsePrefix(value); err != nil {
+			const errFmt = "invalid %s: %w"
+			env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+		} else {
+			*opt = append(*opt, p.Masked())
+		}
+	}
+}
+
+// assignOptionalInt leaves opt unchanged if varname is undefined or empty.
+func (env *environment) assignOptionalInt(opt *int, varname string) {
+	value := env.getenv(varname)
+
+	if value == "" {
+		return
+	} else if i, err := strconv.Atoi(value); err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*opt = i
+	}
+}
+
+// assignOptionalFloat leaves opt unchanged if varname is undefined or empty.
+func (env *environment) assignOptionalFloat(opt *float64, varname string) {
+	value := env.getenv(varname)
+
+	if value == "" {
+		return
+	} else if f, err := strconv.ParseFloat(value, 64); err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*opt = f
+	}
+}
+
+// assignOptionalSampleRate leaves sample and rate unchanged if varname is
+// undefined or empty. Otherwise it sets sample to true and assigns the value,
+// which must be between 0 and 1 inclusive, to rate.
+func (env *environment) assignOptionalSampleRate(
+	sample *bool, rate *float64, varname string,
+) {
+	value := env.getenv(varname)
+	f, err := strconv.ParseFloat(value, 64)
+
+	if value == "" {
+		return
+	} else if err == nil && (f < 0 || f > 1) {
+		err = fmt.Errorf("%s is not between 0 and 1", value)
+	}
+
+	if err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*sample = true
+		*rate = f
+	}
+}
+
+// assignOptionalDuration leaves opt unchanged if varname is undefined or empty.
+//
+// The value must be valid input for [time.ParseDuration], e.g., "24h".
+func (env *environment) assignOptionalDuration(
+	opt *time.Duration, varname string,
+) {
+	value := env.getenv(varname)
+
+	if value == "" {
+		return
+	} else if d, err := time.ParseDuration(value); err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*opt = d
+	}
+}
+
+// assignOptionalBouncePolicy leaves opt unchanged if varname is undefined or
+// empty.
+//
+// The value must be valid input for ParseBouncePolicy.
+func (env *environment) assignOptionalBouncePolicy(
+	opt *BouncePolicy, varname string,
+) {
+	value := env.getenv(varname)
+
+	if value == "" {
+		return
+	} else if p, err := ParseBouncePolicy(value); err != nil {
+		const errFmt = "invalid %s: %w"
+		env.errors = append(env.errors, fmt.Errorf(errFmt, varname, err))
+	} else {
+		*opt = p
+	}
+}
+
 func (env *environment) assignPath(opt *string, varname string) {
 	env.assign(opt, varname)
 	*opt, _ = strings.CutPrefix(*opt, "/")
 }
+
+func (env *environment) assignOptionalPath(opt *string, varname string) {
+	env.assignOptional(opt, varname)
+	*opt, _ = strings.CutPrefix(*opt, "/")
+}
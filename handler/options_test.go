@@ -4,7 +4,9 @@ package handler
 
 import (
 	"errors"
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/mbland/elistman/testutils"
 	"github.com/mbland/elistman/types"
@@ -114,6 +116,552 @@ func TestAllRequiredEnvironmentVariablesDefined(t *testing.T) {
 	)
 }
 
+func TestOptionsAssignListHeaderUrls(t *testing.T) {
+	t.Run("LeavesUrlsEmptyIfUndefined", func(t *testing.T) {
+		_, getenv := testEnv()
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", opts.ListHelpUrl)
+		assert.Equal(t, "", opts.ListSubscribeUrl)
+	})
+
+	t.Run("SetsUrlsIfDefined", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["LIST_HELP_URL"] = "https://mike-bland.com/help"
+		env["LIST_SUBSCRIBE_URL"] = "https://mike-bland.com/subscribe"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, env["LIST_HELP_URL"], opts.ListHelpUrl)
+		assert.Equal(t, env["LIST_SUBSCRIBE_URL"], opts.ListSubscribeUrl)
+	})
+}
+
+func TestOptionsAssignCheckSuppressionBeforeSend(t *testing.T) {
+	env, getenv := testEnv()
+	env["CHECK_SUPPRESSION_BEFORE_SEND"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.CheckSuppressionBeforeSend)
+}
+
+func TestOptionsAssignLookupSuppressionReasons(t *testing.T) {
+	env, getenv := testEnv()
+	env["LOOKUP_SUPPRESSION_REASONS"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.LookupSuppressionReasons)
+}
+
+func TestOptionsAssignTolerateSesSchemaDrift(t *testing.T) {
+	env, getenv := testEnv()
+	env["TOLERATE_SES_SCHEMA_DRIFT"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.SnsOptions.TolerateSchemaDrift)
+}
+
+func TestOptionsAssignBounceDryRun(t *testing.T) {
+	env, getenv := testEnv()
+	env["BOUNCE_DRY_RUN"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.BounceDryRun)
+}
+
+func TestOptionsAssignSendDryRun(t *testing.T) {
+	env, getenv := testEnv()
+	env["SEND_DRY_RUN"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.SendDryRun)
+}
+
+func TestOptionsAssignRedactEmailAddresses(t *testing.T) {
+	env, getenv := testEnv()
+	env["REDACT_EMAIL_ADDRESSES"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.RedactEmailAddresses)
+}
+
+func TestOptionsAssignLogConsumedCapacity(t *testing.T) {
+	env, getenv := testEnv()
+	env["LOG_CONSUMED_CAPACITY"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.LogConsumedCapacity)
+}
+
+func TestOptionsAssignLinkSigningKey(t *testing.T) {
+	env, getenv := testEnv()
+	env["LINK_SIGNING_KEY"] = "signing key"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, "signing key", opts.LinkSigningKey)
+}
+
+func TestOptionsAssignDkimOptions(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["DKIM_SELECTOR"] = "elistman"
+		env["DKIM_PRIVATE_KEY"] = "private key"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "elistman", opts.DkimSelector)
+		assert.Equal(t, "private key", opts.DkimPrivateKey)
+	})
+
+	t.Run("FailsIfOnlyOneDefined", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["DKIM_SELECTOR"] = "elistman"
+
+		_, err := GetOptions(getenv)
+
+		const expected = "DKIM_SELECTOR and DKIM_PRIVATE_KEY must both be " +
+			"defined, or neither"
+		assert.ErrorContains(t, err, expected)
+	})
+}
+
+func TestOptionsAssignSnsConcurrency(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["SNS_CONCURRENCY"] = "4"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 4, opts.SnsOptions.Concurrency)
+	})
+
+	t.Run("FailsIfNotAnInteger", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["SNS_CONCURRENCY"] = "lots"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid SNS_CONCURRENCY: ")
+	})
+}
+
+func TestOptionsAssignMxFailurePolicy(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["MX_FAILURE_THRESHOLD"] = "3"
+		env["MX_FAILURE_WINDOW"] = "36h"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 3, opts.MxFailureThreshold)
+		assert.Equal(t, 36*time.Hour, opts.MxFailureWindow)
+	})
+
+	t.Run("FailsIfWindowIsNotADuration", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["MX_FAILURE_WINDOW"] = "a while"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid MX_FAILURE_WINDOW: ")
+	})
+}
+
+func TestOptionsAssignDnsLookupTimeout(t *testing.T) {
+	env, getenv := testEnv()
+	env["DNS_LOOKUP_TIMEOUT"] = "2s"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, 2*time.Second, opts.DnsLookupTimeout)
+}
+
+func TestOptionsAssignMaxConcurrentDnsLookups(t *testing.T) {
+	env, getenv := testEnv()
+	env["MAX_CONCURRENT_DNS_LOOKUPS"] = "16"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, 16, opts.MaxConcurrentDnsLookups)
+}
+
+func TestOptionsAssignMailtoMaxAge(t *testing.T) {
+	env, getenv := testEnv()
+	env["MAILTO_MAX_AGE"] = "72h"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, 72*time.Hour, opts.MailtoMaxAge)
+}
+
+func TestOptionsAssignMailtoCatchAllUnsubscribe(t *testing.T) {
+	env, getenv := testEnv()
+	env["MAILTO_CATCH_ALL_UNSUBSCRIBE"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.MailtoCatchAllUnsubscribe)
+}
+
+func TestOptionsAssignVerifyLinkExpiry(t *testing.T) {
+	env, getenv := testEnv()
+	env["VERIFY_LINK_EXPIRY"] = "1h"
+	env["LINK_EXPIRED_PATH"] = "/link-expired"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, time.Hour, opts.VerifyLinkExpiry)
+	assert.Equal(t, "link-expired", opts.RedirectPaths.LinkExpired)
+}
+
+func TestOptionsAssignUnknownSubscriberPath(t *testing.T) {
+	env, getenv := testEnv()
+	env["UNKNOWN_SUBSCRIBER_PATH"] = "/unknown-subscriber"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(
+		t, "unknown-subscriber", opts.RedirectPaths.UnknownSubscriber,
+	)
+}
+
+func TestOptionsAssignVerifyRetries(t *testing.T) {
+	env, getenv := testEnv()
+	env["VERIFY_RETRIES"] = "2"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, 2, opts.VerifyRetries)
+}
+
+func TestOptionsAssignSendRateOptions(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["MAX_SEND_RATE_CAPACITY"] = "0.5"
+		env["SEND_RATE"] = "12.5"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 0.5, opts.MaxSendRateCapacity.Value())
+		assert.Equal(t, 12.5, opts.SendRate)
+	})
+
+	t.Run("AddsErrorsIfInvalid", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["MAX_SEND_RATE_CAPACITY"] = "1.5"
+		env["SEND_RATE"] = "fast"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.Assert(t, testutils.ErrorIs(err, types.ErrInvalidCapacity))
+		assert.ErrorContains(t, err, "invalid MAX_SEND_RATE_CAPACITY: ")
+		assert.ErrorContains(t, err, "invalid SEND_RATE: ")
+	})
+
+	t.Run("AddsErrorIfMaxSendRateCapacityIsZero", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["MAX_SEND_RATE_CAPACITY"] = "0"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.Assert(t, testutils.ErrorIs(err, types.ErrInvalidCapacity))
+		assert.ErrorContains(t, err, "invalid MAX_SEND_RATE_CAPACITY: ")
+		assert.ErrorContains(t, err, "must be greater than zero")
+	})
+}
+
+func TestOptionsAssignMaxSendRetries(t *testing.T) {
+	env, getenv := testEnv()
+	env["MAX_SEND_RETRIES"] = "3"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, 3, opts.MaxSendRetries)
+}
+
+func TestOptionsAssignBase64Threshold(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["BASE64_MAX_QP_RATIO"] = "2.5"
+		env["BASE64_MAX_QP_SIZE"] = "100000"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2.5, opts.Base64MaxQpRatio)
+		assert.Equal(t, 100000, opts.Base64MaxQpSize)
+	})
+
+	t.Run("AddsErrorsIfInvalid", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["BASE64_MAX_QP_RATIO"] = "big"
+		env["BASE64_MAX_QP_SIZE"] = "huge"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid BASE64_MAX_QP_RATIO: ")
+		assert.ErrorContains(t, err, "invalid BASE64_MAX_QP_SIZE: ")
+	})
+}
+
+func TestOptionsAssignDeliveryOptions(t *testing.T) {
+	env, getenv := testEnv()
+	env["RECORD_DELIVERIES"] = "true"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.SnsOptions.RecordDeliveries)
+}
+
+func TestOptionsAssignMetricsNamespace(t *testing.T) {
+	env, getenv := testEnv()
+	env["METRICS_NAMESPACE"] = "EListMan"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, "EListMan", opts.MetricsNamespace)
+}
+
+func TestOptionsAssignSuccessLogSampleRate(t *testing.T) {
+	t.Run("LogsAllSuccessesByDefault", func(t *testing.T) {
+		_, getenv := testEnv()
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, false, opts.SnsOptions.SampleSuccessLogs)
+	})
+
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["SUCCESS_LOG_SAMPLE_RATE"] = "0.01"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, true, opts.SnsOptions.SampleSuccessLogs)
+		assert.Equal(t, 0.01, opts.SnsOptions.SuccessLogSampleRate)
+	})
+
+	t.Run("FailsIfOutOfRange", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["SUCCESS_LOG_SAMPLE_RATE"] = "1.5"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		const expectedErr = "invalid SUCCESS_LOG_SAMPLE_RATE: " +
+			"1.5 is not between 0 and 1"
+		assert.ErrorContains(t, err, expectedErr)
+	})
+
+	t.Run("FailsIfNotANumber", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["SUCCESS_LOG_SAMPLE_RATE"] = "often"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid SUCCESS_LOG_SAMPLE_RATE: ")
+	})
+}
+
+func TestOptionsAssignBouncePolicy(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["BOUNCE_POLICY"] = "Transient/MailboxFull=Retry"
+		env["BOUNCE_RETRIES"] = "5"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		expected := BouncePolicy{
+			"Transient":             BounceIgnore,
+			"Transient/MailboxFull": BounceRetry,
+		}
+		assert.DeepEqual(t, expected, opts.SnsOptions.BouncePolicy)
+		assert.Equal(t, 5, opts.SnsOptions.BounceRetries)
+	})
+
+	t.Run("FailsIfInvalid", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["BOUNCE_POLICY"] = "Transient/MailboxFull=Requeue"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid BOUNCE_POLICY: ")
+	})
+}
+
+func TestOptionsAssignSesEventsTable(t *testing.T) {
+	env, getenv := testEnv()
+	env["SES_EVENTS_TABLE_NAME"] = "ses-events"
+	env["SES_EVENTS_TTL"] = "48h"
+	env["SEND_LOG_TTL"] = "2160h"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, "ses-events", opts.SesEventsTableName)
+	assert.Equal(t, 48*time.Hour, opts.SesEventsTtl)
+	assert.Equal(t, 2160*time.Hour, opts.SendLogTtl)
+}
+
+func TestOptionsAssignResponsePagesDir(t *testing.T) {
+	env, getenv := testEnv()
+	env["RESPONSE_PAGES_DIR"] = "response-pages"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, "response-pages", opts.ResponsePagesDir)
+}
+
+func TestOptionsAssignMaintenanceMode(t *testing.T) {
+	env, getenv := testEnv()
+	env["MAINTENANCE_MODE"] = "true"
+	env["MAINTENANCE_PATH"] = "/maintenance"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.Equal(t, true, opts.MaintenanceMode)
+	assert.Equal(t, "maintenance", opts.RedirectPaths.Maintenance)
+}
+
+func TestOptionsAssignAllowedIpLiteralRanges(t *testing.T) {
+	t.Run("Succeeds", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["ALLOWED_IP_LITERAL_RANGES"] = "10.0.0.5/8, fd00::/8,,"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		expected := []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("fd00::/8"),
+		}
+		assert.Equal(t, len(expected), len(opts.AllowedIpLiteralRanges))
+		for i, prefix := range expected {
+			assert.Equal(t, prefix, opts.AllowedIpLiteralRanges[i])
+		}
+	})
+
+	t.Run("FailsIfRangeInvalid", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["ALLOWED_IP_LITERAL_RANGES"] = "10.0.0.0/8,10.0.0.5"
+
+		_, err := GetOptions(getenv)
+
+		assert.ErrorContains(t, err, "invalid ALLOWED_IP_LITERAL_RANGES: ")
+	})
+}
+
+func TestOptionsAssignAllowedSingleLabelDomains(t *testing.T) {
+	env, getenv := testEnv()
+	env["ALLOWED_SINGLE_LABEL_DOMAINS"] = "intranet, corp,,"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	expected := []string{"intranet", "corp"}
+	assert.DeepEqual(t, expected, opts.AllowedSingleLabelDomains)
+}
+
+func TestOptionsAssignInvalidUserNamesAndDomains(t *testing.T) {
+	env, getenv := testEnv()
+	env["INVALID_USER_NAMES"] = "noreply, root"
+	env["INVALID_DOMAINS"] = "spammy.com"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"noreply", "root"}, opts.InvalidUserNames)
+	assert.DeepEqual(t, []string{"spammy.com"}, opts.InvalidDomains)
+}
+
+func TestOptionsAssignRoleUserNames(t *testing.T) {
+	env, getenv := testEnv()
+	env["ROLE_USER_NAMES"] = "info, sales"
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"info", "sales"}, opts.RoleUserNames)
+}
+
+func TestOptionsAssignSenderIdentityArns(t *testing.T) {
+	env, getenv := testEnv()
+	const fooArn = "arn:aws:ses:us-east-1:0123456789:identity/foo.com"
+	const barArn = "arn:aws:ses:us-east-1:0123456789:identity/bar.com"
+	env["SENDER_IDENTITY_ARNS"] = fooArn + "," + barArn
+
+	opts, err := GetOptions(getenv)
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{fooArn, barArn}, opts.SenderIdentityArns)
+}
+
+func TestOptionsAssignOptionalPath(t *testing.T) {
+	t.Run("LeavesPathEmptyIfUndefined", func(t *testing.T) {
+		_, getenv := testEnv()
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "", opts.RedirectPaths.Blocked)
+	})
+
+	t.Run("RemovesLeadingSlashIfDefined", func(t *testing.T) {
+		env, getenv := testEnv()
+		env["BLOCKED_PATH"] = "/blocked"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "blocked", opts.RedirectPaths.Blocked)
+	})
+}
+
 func TestOptionsAssignCapacityAddsError(t *testing.T) {
 	// Note that the success and undefined cases are covered by the tests above.
 
@@ -141,6 +689,40 @@ func TestOptionsAssignCapacityAddsError(t *testing.T) {
 	})
 }
 
+func TestOptionsAssignOptionalBool(t *testing.T) {
+	const varname = "IGNORE_SUPPRESSION_LIST_COMPLAINTS"
+
+	t.Run("DefaultsToFalseIfUndefined", func(t *testing.T) {
+		_, getenv := testEnv()
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, false, opts.SnsOptions.IgnoreSuppressionListComplaints)
+	})
+
+	t.Run("SetsValueIfDefined", func(t *testing.T) {
+		env, getenv := testEnv()
+		env[varname] = "true"
+
+		opts, err := GetOptions(getenv)
+
+		assert.NilError(t, err)
+		assert.Equal(t, true, opts.SnsOptions.IgnoreSuppressionListComplaints)
+	})
+
+	t.Run("AddsErrorIfInvalid", func(t *testing.T) {
+		env, getenv := testEnv()
+		env[varname] = "foobar"
+
+		opts, err := GetOptions(getenv)
+
+		assert.Assert(t, is.Nil(opts))
+		assert.ErrorContains(t, err, "invalid "+varname+": ")
+		assert.ErrorContains(t, err, "strconv.ParseBool")
+	})
+}
+
 func TestOptionsReturnsMultipleWrappedErrors(t *testing.T) {
 	env, getenv := testEnv()
 	delete(env, "SENDER_NAME")
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/mbland/elistman/ops"
+)
+
+// ResponsePages maps operation results to templates for the HTML pages served
+// in response to successful subscribe, verify, and unsubscribe requests.
+//
+// Only the results in ResponsePageFiles may appear as keys. Each template
+// receives the same parameters as ResponseTemplate: a Title, the SiteTitle,
+// and a default Body describing the outcome.
+type ResponsePages map[ops.OperationResult]string
+
+// ResponsePageFiles maps each result supported by ResponsePages to the name of
+// the file from which LoadResponsePages reads its template.
+var ResponsePageFiles = map[ops.OperationResult]string{
+	ops.VerifyLinkSent: "verify-link-sent.html",
+	ops.Subscribed:     "subscribed.html",
+	ops.Unsubscribed:   "unsubscribed.html",
+}
+
+type responsePageContent struct {
+	Title string
+	Body  string
+}
+
+var defaultResponsePageContent = map[ops.OperationResult]responsePageContent{
+	ops.VerifyLinkSent: {
+		"Confirmation sent",
+		"<p>Please check your email for a link to verify your " +
+			"subscription.</p>",
+	},
+	ops.Subscribed: {
+		"Subscribed",
+		"<p>Your subscription is verified. Thanks for subscribing!</p>",
+	},
+	ops.Unsubscribed: {
+		"Unsubscribed",
+		"<p>You've been unsubscribed and won't receive further " +
+			"messages.</p>",
+	},
+}
+
+// LoadResponsePages reads the templates named in ResponsePageFiles from dir.
+//
+// Missing files are skipped, causing their pages to fall back to the handler's
+// response template.
+func LoadResponsePages(dir string) (ResponsePages, error) {
+	pages := ResponsePages{}
+
+	for result, filename := range ResponsePageFiles {
+		content, err := os.ReadFile(filepath.Join(dir, filename))
+
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("loading response pages failed: %w", err)
+		}
+		pages[result] = string(content)
+	}
+	return pages, nil
+}
+
+// initResponsePages parses the templates for every result in
+// ResponsePageFiles, falling back to the response template for those not
+// defined in pages.
+func (h *apiHandler) initResponsePages(pages ResponsePages) (err error) {
+	tmpls := make(map[ops.OperationResult]*template.Template, len(pages))
+
+	for result, page := range pages {
+		var tmpl *template.Template
+
+		if _, ok := ResponsePageFiles[result]; !ok {
+			return fmt.Errorf("response pages not supported for %s", result)
+		} else if tmpl, err = initResponseBodyTemplate(page); err != nil {
+			return fmt.Errorf("response page for %s: %w", result, err)
+		}
+		tmpls[result] = tmpl
+	}
+	for result := range ResponsePageFiles {
+		if _, ok := tmpls[result]; !ok {
+			tmpls[result] = h.responseTemplate
+		}
+	}
+	h.responsePages = tmpls
+	return
+}
+
+func (h *apiHandler) respondWithPage(
+	res *events.APIGatewayProxyResponse,
+	page *template.Template,
+	result ops.OperationResult,
+) (*events.APIGatewayProxyResponse, error) {
+	content := defaultResponsePageContent[result]
+	params := &responseTemplateParams{content.Title, h.SiteTitle, content.Body}
+	builder := &strings.Builder{}
+
+	if err := page.Execute(builder, params); err != nil {
+		return nil, fmt.Errorf("rendering %s page failed: %w", result, err)
+	}
+	res.StatusCode = http.StatusOK
+	res.Headers["content-type"] = "text/html; charset=utf-8"
+	res.Body = builder.String()
+	return res, nil
+}
@@ -0,0 +1,163 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbland/elistman/ops"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestLoadResponsePages(t *testing.T) {
+	t.Run("LoadsExistingPagesOnly", func(t *testing.T) {
+		dir := t.TempDir()
+		page := []byte("<h1>{{.SiteTitle}}</h1>")
+		path := filepath.Join(dir, ResponsePageFiles[ops.Subscribed])
+		assert.NilError(t, os.WriteFile(path, page, 0600))
+
+		pages, err := LoadResponsePages(dir)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, ResponsePages{ops.Subscribed: string(page)}, pages)
+	})
+
+	t.Run("FailsIfPageUnreadable", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, ResponsePageFiles[ops.Subscribed])
+		assert.NilError(t, os.Mkdir(path, 0700))
+
+		pages, err := LoadResponsePages(dir)
+
+		assert.Assert(t, is.Nil(pages))
+		assert.ErrorContains(t, err, "loading response pages failed: ")
+	})
+}
+
+func TestInitResponsePages(t *testing.T) {
+	t.Run("FallsBackToResponseTemplate", func(t *testing.T) {
+		f := newApiHandlerFixture()
+
+		err := f.handler.initResponsePages(ResponsePages{})
+
+		assert.NilError(t, err)
+		assert.Assert(t, is.Len(f.handler.responsePages, 3))
+		for result := range ResponsePageFiles {
+			page := f.handler.responsePages[result]
+			assert.Equal(t, f.handler.responseTemplate, page, result)
+		}
+	})
+
+	t.Run("FailsIfResultNotSupported", func(t *testing.T) {
+		f := newApiHandlerFixture()
+
+		err := f.handler.initResponsePages(ResponsePages{ops.Invalid: "foo"})
+
+		assert.Error(t, err, "response pages not supported for Invalid")
+		assert.Assert(t, is.Nil(f.handler.responsePages))
+	})
+
+	t.Run("FailsIfTemplateInvalid", func(t *testing.T) {
+		f := newApiHandlerFixture()
+
+		err := f.handler.initResponsePages(
+			ResponsePages{ops.Subscribed: "{{.Bogus}}"},
+		)
+
+		assert.ErrorContains(t, err, "response page for Subscribed: ")
+	})
+}
+
+func TestResponsePages(t *testing.T) {
+	pages := ResponsePages{
+		ops.VerifyLinkSent: "<h1>Check your inbox, {{.SiteTitle}}!</h1>",
+		ops.Subscribed:     "<h1>Welcome to {{.SiteTitle}}!</h1>",
+		ops.Unsubscribed:   "<h1>Goodbye from {{.SiteTitle}}!</h1>",
+	}
+
+	setup := func(pages ResponsePages) *apiHandlerFixture {
+		f := newApiHandlerFixture()
+		assert.NilError(t, f.handler.initResponsePages(pages))
+		return f
+	}
+
+	requests := map[ops.OperationResult]*apiRequest{
+		ops.VerifyLinkSent: {
+			Id:          "deadbeef",
+			RawPath:     ops.ApiPrefixSubscribe,
+			Method:      http.MethodPost,
+			ContentType: "application/x-www-form-urlencoded",
+			Params:      map[string]string{"email": "mbland@acm.org"},
+		},
+		ops.Subscribed: {
+			Id:      "deadbeef",
+			RawPath: ops.ApiPrefixVerify + "mbland@acm.org/" + testValidUidStr,
+			Method:  http.MethodGet,
+			Params: map[string]string{
+				"email": "mbland@acm.org", "uid": testValidUidStr,
+			},
+		},
+		ops.Unsubscribed: {
+			Id: "deadbeef",
+			RawPath: ops.ApiPrefixUnsubscribe + "mbland@acm.org/" +
+				testValidUidStr,
+			Method: http.MethodGet,
+			Params: map[string]string{
+				"email": "mbland@acm.org", "uid": testValidUidStr,
+			},
+		},
+	}
+
+	for result, expected := range map[ops.OperationResult]string{
+		ops.VerifyLinkSent: "<h1>Check your inbox, " + testSiteTitle + "!</h1>",
+		ops.Subscribed:     "<h1>Welcome to " + testSiteTitle + "!</h1>",
+		ops.Unsubscribed:   "<h1>Goodbye from " + testSiteTitle + "!</h1>",
+	} {
+		t.Run("Renders"+result.String(), func(t *testing.T) {
+			f := setup(pages)
+			f.agent.OpResult = result
+
+			res, err := f.handler.handleApiRequest(f.ctx, requests[result])
+
+			assert.NilError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, "", res.Headers["location"])
+			contentType := res.Headers["content-type"]
+			assert.Equal(t, "text/html; charset=utf-8", contentType)
+			assert.Equal(t, expected, res.Body)
+		})
+	}
+
+	t.Run("RendersDefaultContentWithResponseTemplate", func(t *testing.T) {
+		f := setup(ResponsePages{})
+		f.agent.OpResult = ops.Subscribed
+
+		res, err := f.handler.handleApiRequest(
+			f.ctx, requests[ops.Subscribed],
+		)
+
+		assert.NilError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		title := "<title>Subscribed - " + testSiteTitle + "</title>"
+		assert.Assert(t, is.Contains(res.Body, title))
+		assert.Assert(t, is.Contains(res.Body, "Thanks for subscribing!"))
+	})
+
+	t.Run("StillRedirectsOtherResults", func(t *testing.T) {
+		f := setup(pages)
+		f.agent.OpResult = ops.AlreadySubscribed
+
+		res, err := f.handler.handleApiRequest(
+			f.ctx, requests[ops.VerifyLinkSent],
+		)
+
+		assert.NilError(t, err)
+		assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+		expected := f.handler.Redirects[ops.AlreadySubscribed]
+		assert.Equal(t, expected, res.Headers["location"])
+	})
+}
@@ -24,6 +24,7 @@ const (
 	Subscribe
 	Verify
 	Unsubscribe
+	Status
 )
 
 type eventOperation struct {
@@ -31,6 +32,9 @@ type eventOperation struct {
 	Email    string
 	Uid      uuid.UUID
 	OneClick bool
+
+	// Signature is the ops.ApiParamSignature parameter, if present.
+	Signature string
 }
 
 func (op *eventOperation) String() string {
@@ -71,6 +75,7 @@ type apiRequest struct {
 	ContentType string
 	Params      map[string]string
 	Body        string
+	Query       map[string]string
 }
 
 func parseApiRequest(req *apiRequest) (op *eventOperation, err error) {
@@ -88,6 +93,7 @@ func parseApiRequest(req *apiRequest) (op *eventOperation, err error) {
 			email,
 			uid,
 			isOneClickUnsubscribeRequest(optype, req, params),
+			params[ops.ApiParamSignature],
 		}, nil
 	}
 }
@@ -115,6 +121,8 @@ func parseOperationType(endpoint string) (eventOperationType, error) {
 		return Verify, nil
 	} else if strings.HasPrefix(endpoint, ops.ApiPrefixUnsubscribe) {
 		return Unsubscribe, nil
+	} else if strings.HasPrefix(endpoint, ops.ApiPrefixStatus) {
+		return Status, nil
 	}
 	return Undefined, fmt.Errorf("unknown endpoint: %s", endpoint)
 }
@@ -150,6 +158,14 @@ func parseParams(req *apiRequest) (map[string]string, error) {
 			return nil, err
 		}
 	}
+
+	for k, v := range req.Query {
+		if prevV, ok := result[k]; ok {
+			errFormat := "query and other parameters defined for %q: %s, %s"
+			return nil, fmt.Errorf(errFormat, k, v, prevV)
+		}
+		result[k] = v
+	}
 	return result, nil
 }
 
@@ -197,6 +213,9 @@ func parseUid(
 ) (uuid.UUID, error) {
 	if optype == Subscribe {
 		return uuid.Nil, nil
+	} else if _, ok := params["uid"]; !ok && optype == Status {
+		// The uid is only necessary to check the signature of a Status request.
+		return uuid.Nil, nil
 	}
 	return parseParam(params, "uid", uuid.Nil, uuid.Parse)
 }
@@ -264,11 +283,25 @@ func parseMailtoEvent(
 		return nil, err
 	} else {
 		return &eventOperation{
-			Unsubscribe, subject.Email, subject.Uid, true,
+			Unsubscribe, subject.Email, subject.Uid, true, "",
 		}, nil
 	}
 }
 
+// parseMailtoSender returns the sender's address, if ev has exactly one From
+// address and is addressed only to unsubscribeAddr.
+func parseMailtoSender(
+	ev *mailtoEvent, unsubscribeAddr string,
+) (string, error) {
+	if err := checkMailAddresses(ev.From, ev.To, unsubscribeAddr); err != nil {
+		return "", err
+	} else if sender, err := parseEmailAddress(ev.From[0]); err != nil {
+		return "", fmt.Errorf("invalid From address: %s: %s", ev.From[0], err)
+	} else {
+		return sender, nil
+	}
+}
+
 func checkMailAddresses(froms, tos []string, unsubscribeAddr string) error {
 	if err := checkForOnlyOneAddress("From", froms); err != nil {
 		return err
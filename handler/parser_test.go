@@ -238,6 +238,32 @@ func TestParseParams(t *testing.T) {
 		assert.DeepEqual(t, parsedParams, result)
 	})
 
+	t.Run("SuccessWithQueryParams", func(t *testing.T) {
+		req := newRequest()
+		req.Query = map[string]string{"sig": "0123456789"}
+
+		result, err := parseParams(req)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, map[string]string{
+			"email": "mbland@acm.org",
+			"uid":   "0123-456-789",
+			"sig":   "0123456789",
+		}, result)
+	})
+
+	t.Run("ErrorIfQueryParamDuplicatesOtherParam", func(t *testing.T) {
+		req := newRequest()
+		req.Query = map[string]string{"email": "foo@bar.com"}
+
+		result, err := parseParams(req)
+
+		expected := `query and other parameters defined for "email": ` +
+			"foo@bar.com, mbland@acm.org"
+		assert.ErrorContains(t, err, expected)
+		assert.Assert(t, is.Nil(result))
+	})
+
 	t.Run("ErrorIfBodyPresentForNonPostRequest", func(t *testing.T) {
 		req := newRequest()
 		req.Method = http.MethodGet
@@ -322,6 +348,13 @@ func TestParseOperationType(t *testing.T) {
 		assert.Equal(t, "Unsubscribe", result.String())
 	})
 
+	t.Run("Status", func(t *testing.T) {
+		result, err := parseOperationType(ops.ApiPrefixStatus)
+
+		assert.NilError(t, err)
+		assert.Equal(t, "Status", result.String())
+	})
+
 	t.Run("Undefined", func(t *testing.T) {
 		result, err := parseOperationType("/foobar/baz")
 
@@ -376,6 +409,20 @@ func TestParseUid(t *testing.T) {
 		assert.NilError(t, err)
 		assert.Equal(t, expected, result)
 	})
+
+	t.Run("OptionalForStatusOp", func(t *testing.T) {
+		result, err := parseUid(Status, map[string]string{})
+
+		assert.NilError(t, err)
+		assert.Equal(t, uuid.Nil, result)
+	})
+
+	t.Run("ValidatedForStatusOpIfPresent", func(t *testing.T) {
+		result, err := parseUid(Status, map[string]string{"uid": "bogus"})
+
+		assert.ErrorContains(t, err, "invalid uid parameter: bogus")
+		assert.Equal(t, uuid.Nil, result)
+	})
 }
 
 func TestIsOneClickSubscribeRequest(t *testing.T) {
@@ -491,11 +538,26 @@ func TestParseApiRequest(t *testing.T) {
 		assert.NilError(t, err)
 		assert.DeepEqual(
 			t, result, &eventOperation{
-				Subscribe, "mbland@acm.org", uuid.Nil, false,
+				Subscribe, "mbland@acm.org", uuid.Nil, false, "",
 			},
 		)
 	})
 
+	t.Run("SuccessfulStatus", func(t *testing.T) {
+		req := &apiRequest{
+			RawPath: ops.ApiPrefixStatus,
+			Method:  http.MethodGet,
+			Query:   map[string]string{"email": "mbland@acm.org"},
+		}
+
+		result, err := parseApiRequest(req)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, &eventOperation{
+			Status, "mbland@acm.org", uuid.Nil, false, "",
+		})
+	})
+
 	t.Run("SuccessfulOneClickUnsubscribe", func(t *testing.T) {
 		// The "email" and "uid" are path parameters. "List-Unsubscribe" is
 		// parsed from the body.
@@ -515,7 +577,7 @@ func TestParseApiRequest(t *testing.T) {
 
 		assert.NilError(t, err)
 		assert.DeepEqual(t, result, &eventOperation{
-			Unsubscribe, "mbland@acm.org", uuid.MustParse(uidStr), true,
+			Unsubscribe, "mbland@acm.org", uuid.MustParse(uidStr), true, "",
 		})
 	})
 }
@@ -664,7 +726,7 @@ func TestParseMailtoEvent(t *testing.T) {
 
 		assert.NilError(t, err)
 		assert.DeepEqual(
-			t, &eventOperation{Unsubscribe, email, uid, true}, result,
+			t, &eventOperation{Unsubscribe, email, uid, true, ""}, result,
 		)
 	})
 }
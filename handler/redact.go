@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var emailAddressPattern = regexp.MustCompile(
+	`[^\s"'<>(),:;@\[\]\\]+@[[:alnum:]-]+(\.[[:alnum:]-]+)+`,
+)
+
+// redactEmailAddresses masks the username of every email address in s.
+//
+// Only the first character of each username remains, e.g., "mbland@acm.org"
+// becomes "m****@acm.org". The domain remains to aid in diagnosing delivery
+// problems.
+func redactEmailAddresses(s string) string {
+	return emailAddressPattern.ReplaceAllStringFunc(s, redactEmailAddress)
+}
+
+func redactEmailAddress(address string) string {
+	at := strings.LastIndexByte(address, '@')
+	_, size := utf8.DecodeRuneInString(address)
+	return address[:size] + "****" + address[at:]
+}
+
+// logRedacted logs the formatted message, redacting email addresses if redact
+// is true.
+func logRedacted(logger Logger, redact bool, format string, v ...any) {
+	msg := fmt.Sprintf(format, v...)
+
+	if redact {
+		msg = redactEmailAddresses(msg)
+	}
+	logger.Printf("%s", msg)
+}
@@ -0,0 +1,55 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestRedactEmailAddresses(t *testing.T) {
+	t.Run("LeavesTextWithoutAddressesUnchanged", func(t *testing.T) {
+		const msg = "no addresses here @ all: user@ and @domain.com"
+
+		assert.Equal(t, msg, redactEmailAddresses(msg))
+	})
+
+	t.Run("MasksUsernamesButNotDomains", func(t *testing.T) {
+		msg := `From:"mbland@acm.org,foo.bar+baz@mail.example.co.uk"`
+
+		const expected = `From:"m****@acm.org,f****@mail.example.co.uk"`
+		assert.Equal(t, expected, redactEmailAddresses(msg))
+	})
+
+	t.Run("MasksAddressesInAngleBracketsAndJson", func(t *testing.T) {
+		msg := `Mike Bland <mbland@acm.org> {"to":["foo@bar.com"]}`
+
+		const expected = `Mike Bland <m****@acm.org> {"to":["f****@bar.com"]}`
+		assert.Equal(t, expected, redactEmailAddresses(msg))
+	})
+
+	t.Run("KeepsFirstCharacterIntactIfNonAscii", func(t *testing.T) {
+		msg := "émile@acm.org"
+
+		assert.Equal(t, "é****@acm.org", redactEmailAddresses(msg))
+	})
+}
+
+func TestLogRedacted(t *testing.T) {
+	t.Run("LogsFullAddressesIfNotRedacting", func(t *testing.T) {
+		logs, logger := newTestLogs()
+
+		logRedacted(logger, false, "removed %s", "mbland@acm.org")
+
+		logs.AssertContains(t, "removed mbland@acm.org")
+	})
+
+	t.Run("MasksAddressesIfRedacting", func(t *testing.T) {
+		logs, logger := newTestLogs()
+
+		logRedacted(logger, true, "removed %s", "mbland@acm.org")
+
+		logs.AssertContains(t, "removed m****@acm.org")
+	})
+}
@@ -2,9 +2,12 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	awsevents "github.com/aws/aws-lambda-go/events"
 	"github.com/mbland/elistman/agent"
@@ -12,32 +15,242 @@ import (
 	"github.com/mbland/elistman/ops"
 )
 
+// SnsOptions configures optional handling of SES events received via SNS.
+type SnsOptions struct {
+	// IgnoreSuppressionListComplaints causes complaints with the
+	// "OnAccountSuppressionList" subtype to leave recipients in place.
+	//
+	// SES reports this subtype when it didn't send a message because the
+	// recipient was already on the account-level suppression list. That
+	// recipient was already removed and suppressed in response to the original
+	// bounce or complaint, so there's nothing more to do.
+	IgnoreSuppressionListComplaints bool
+
+	// TolerateSchemaDrift preserves some information from events that fail
+	// to parse.
+	//
+	// If SES renames a field or changes its type, parsing the entire event
+	// fails. With this option set, parseSesEvent will decode as much of the
+	// top level "eventType" and "mail" fields as it can. The resulting
+	// sesEventHandler will log the event type and recipients without updating
+	// any subscribers.
+	TolerateSchemaDrift bool
+
+	// Concurrency is the maximum number of recipients to update in parallel
+	// when an SNS event contains multiple records. Updates for the same
+	// recipient always happen in the order received, e.g., a bounce followed
+	// by a restore. Values less than two update recipients sequentially.
+	Concurrency int
+
+	// RecordDeliveries causes "Delivery" events to update each recipient's
+	// LastDelivered time, in addition to logging the event.
+	RecordDeliveries bool
+
+	// BouncePolicy determines whether "Bounce" events remove recipients. If
+	// nil, DefaultBouncePolicy applies.
+	BouncePolicy BouncePolicy
+
+	// BounceRetries is the number of times an SQS queue may redeliver a
+	// "Bounce" event matching a BounceRetry rule before it's handled without
+	// retrying again. Defaults to DefaultBounceRetries if less than one.
+	//
+	// It should be less than the maxReceiveCount of the queue's redrive
+	// policy, so that retried bounces never reach its dead-letter queue.
+	BounceRetries int
+
+	// SampleSuccessLogs causes only the fraction SuccessLogSampleRate of
+	// successful "Send" and "Delivery" events to be logged.
+	//
+	// High volume lists generate one of each per recipient, which can drown
+	// out other logs and increase CloudWatch costs. A SuccessLogSampleRate of
+	// zero suppresses these logs entirely. Bounces, complaints, rejections,
+	// and failures to update recipients are always logged.
+	SampleSuccessLogs    bool
+	SuccessLogSampleRate float64
+
+	// SuccessLogRand returns a random number in [0.0, 1.0) to decide whether
+	// to log a success when SampleSuccessLogs is set. Defaults to
+	// rand.Float64.
+	SuccessLogRand func() float64
+}
+
+// DefaultBounceRetries is the default value of SnsOptions.BounceRetries.
+const DefaultBounceRetries = 3
+
+func (opts *SnsOptions) bounceRetries() int {
+	if opts.BounceRetries < 1 {
+		return DefaultBounceRetries
+	}
+	return opts.BounceRetries
+}
+
+// logSuccess returns true if a successful "Send" or "Delivery" event should
+// be logged.
+func (opts *SnsOptions) logSuccess() bool {
+	if !opts.SampleSuccessLogs {
+		return true
+	}
+	random := opts.SuccessLogRand
+	if random == nil {
+		random = rand.Float64
+	}
+	return random() < opts.SuccessLogSampleRate
+}
+
+// SesEventLog records SES events that snsHandler has already handled.
+//
+// db.DynamoDbEventLog implements this interface.
+type SesEventLog interface {
+	// RecordEvent records id and returns true if it wasn't already recorded.
+	RecordEvent(ctx context.Context, id string) (firstTime bool, err error)
+
+	// ForgetEvent removes id, so that the next RecordEvent call for it
+	// returns true.
+	ForgetEvent(ctx context.Context, id string) error
+}
+
 type snsHandler struct {
-	Agent agent.SubscriptionAgent
-	Log   *log.Logger
+	Agent           agent.SubscriptionAgent
+	Log             Logger
+	Options         SnsOptions
+	RedactAddresses bool
+
+	// EventLog, if not nil, causes HandleEvent to ignore SES events that SNS
+	// delivers more than once.
+	EventLog SesEventLog
+
+	// Metrics, if not nil, counts Bounce, Complaint, Reject, Send, and
+	// Delivery events.
+	Metrics ops.Metrics
 }
 
-// https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-contents.html
-// https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-examples.html
-func (h *snsHandler) HandleEvent(ctx context.Context, e *awsevents.SNSEvent) {
-	for _, snsRecord := range e.Records {
+// HandleEvent returns an error if any record fails to parse, or if updating
+// any recipient fails due to an external error.
+//
+// The error joins the errors for every such record. It causes Lambda to retry
+// the entire SNS event, and eventually send it to a dead-letter queue if so
+// configured. When EventLog is set, HandleEvent forgets each failed SES event,
+// so a retry handles only those events and ignores the ones already handled.
+//
+// - https://docs.aws.amazon.com/lambda/latest/dg/invocation-async-error-handling.html
+// - https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-contents.html
+// - https://docs.aws.amazon.com/ses/latest/dg/event-publishing-retrieving-sns-examples.html
+func (h *snsHandler) HandleEvent(
+	ctx context.Context, e *awsevents.SNSEvent,
+) error {
+	lanes := newRecipientLanes(h.Options.Concurrency)
+	handlers := make([]*sesEventHandler, len(e.Records))
+	errs := []error{}
+
+	for i, snsRecord := range e.Records {
 		msg := snsRecord.SNS.Message
 		if handler, err := h.parseSesEvent(msg); err != nil {
-			h.Log.Printf("parsing SES event from SNS failed: %s: %s", err, msg)
+			const errFmt = "parsing SES event from SNS failed: %s: %s"
+			logRedacted(h.Log, h.RedactAddresses, errFmt, err, msg)
+			errs = append(errs, fmt.Errorf(
+				"SNS message %s: parsing SES event failed: %w",
+				snsRecord.SNS.MessageID, err,
+			))
+		} else if h.isDuplicate(ctx, handler) {
+			handler.logOutcome("duplicate event ignored")
 		} else {
+			handlers[i] = handler
+			handler.Lanes = lanes
 			handler.HandleEvent(ctx)
 		}
 	}
+	lanes.Run()
+
+	// Check for failures only after every lane finishes updating recipients.
+	for i, handler := range handlers {
+		if handler != nil && handler.Failed() {
+			h.forgetEvent(ctx, handler)
+			errs = append(errs, fmt.Errorf(
+				"SNS message %s: failed to update recipients for %s event "+
+					"from SES message %s",
+				e.Records[i].SNS.MessageID,
+				handler.Event.EventType,
+				handler.Event.Mail.MessageID,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isDuplicate returns true if EventLog already recorded the SES event.
+//
+// SNS may deliver the same notification more than once. Each event is
+// identified by its type and the SES message ID. As a result, repeated "Open"
+// and "Click" events for the same message are also ignored while EventLog
+// remembers the first. Events without a message ID are never considered
+// duplicates.
+//
+// If EventLog returns an error, isDuplicate logs it and returns false, since
+// handling an event twice is better than not handling it at all.
+func (h *snsHandler) isDuplicate(
+	ctx context.Context, handler *sesEventHandler,
+) bool {
+	id, ok := h.eventLogId(handler)
+	if !ok {
+		return false
+	}
+
+	firstTime, err := h.EventLog.RecordEvent(ctx, id)
+	if err != nil {
+		h.Log.Warnf("failed to check for duplicate SES event: %s", err)
+		return false
+	}
+	return !firstTime
+}
+
+// forgetEvent removes a failed SES event from EventLog, so that handling it
+// again after a retry isn't ignored as a duplicate.
+//
+// It ignores cancellation of ctx, since the event may have failed because ctx
+// was cancelled.
+func (h *snsHandler) forgetEvent(
+	ctx context.Context, handler *sesEventHandler,
+) {
+	ctx = context.WithoutCancel(ctx)
+
+	if id, ok := h.eventLogId(handler); !ok {
+		return
+	} else if err := h.EventLog.ForgetEvent(ctx, id); err != nil {
+		h.Log.Warnf("failed to forget failed SES event: %s", err)
+	}
+}
+
+func (h *snsHandler) eventLogId(handler *sesEventHandler) (string, bool) {
+	event := handler.Event
+	if h.EventLog == nil || event.Mail.MessageID == "" {
+		return "", false
+	}
+	return event.EventType + "/" + event.Mail.MessageID, true
 }
 
 func (h *snsHandler) parseSesEvent(message string) (
 	handler *sesEventHandler, err error,
 ) {
-	event := &events.SesEventRecord{}
-	if err = json.Unmarshal([]byte(message), event); err == nil {
-		handler = &sesEventHandler{
-			Event: event, Details: message, Agent: h.Agent, Log: h.Log,
+	var parseErr error
+	var driftErr *events.SchemaDriftError
+	event, err := events.ParseSesEventRecord(message)
+
+	if err != nil {
+		if !h.Options.TolerateSchemaDrift || !errors.As(err, &driftErr) {
+			return nil, err
 		}
+		parseErr, err = err, nil
+	}
+
+	handler = &sesEventHandler{
+		Event:           event,
+		Details:         message,
+		Agent:           h.Agent,
+		Log:             h.Log,
+		Options:         h.Options,
+		ParseError:      parseErr,
+		RedactAddresses: h.RedactAddresses,
+		Metrics:         h.Metrics,
 	}
 	return
 }
@@ -46,11 +259,56 @@ type sesEventHandler struct {
 	Event   *events.SesEventRecord
 	Details string
 	Agent   agent.SubscriptionAgent
-	Log     *log.Logger
+	Log     Logger
+	Options SnsOptions
+
+	// ParseError is the error from parsing the full event when
+	// SnsOptions.TolerateSchemaDrift is set. If not nil, Event contains only
+	// the EventType and possibly incomplete Mail fields.
+	ParseError error
+
+	// RedactAddresses causes logOutcome to mask the username of every email
+	// address it logs, including those in Details.
+	RedactAddresses bool
+
+	// Lanes, if not nil, schedules recipient updates. Otherwise updates
+	// happen immediately.
+	Lanes *recipientLanes
+
+	// Metrics, if not nil, receives a count of each event per countEvent, and
+	// the DeliveryProcessingTimeMetric for each "Delivery" event.
+	Metrics ops.Metrics
+
+	// ReceiveCount is the number of times an SQS queue has delivered the
+	// event, including this time, or zero if unknown.
+	ReceiveCount int
+
+	// failed is set if updating any recipient fails due to an external error,
+	// meaning that handling the event again may succeed.
+	failed atomic.Bool
+
+	// quiet suppresses logging successful outcomes, per
+	// SnsOptions.SampleSuccessLogs. Errors are still logged.
+	quiet bool
+}
+
+// Failed returns true if updating any recipient failed due to an external
+// error.
+func (evh *sesEventHandler) Failed() bool {
+	return evh.failed.Load()
 }
 
 func (evh *sesEventHandler) HandleEvent(ctx context.Context) {
 	event := evh.Event
+	if evh.ParseError != nil {
+		evh.logOutcome(
+			"not updating recipients: failed to parse event: " +
+				evh.ParseError.Error(),
+		)
+		return
+	}
+	evh.countEvent()
+
 	switch evh.Event.EventType {
 	case "Bounce":
 		evh.handleBounceEvent(ctx)
@@ -58,35 +316,167 @@ func (evh *sesEventHandler) HandleEvent(ctx context.Context) {
 		evh.handleComplaintEvent(ctx)
 	case "Reject":
 		evh.logOutcome(event.Reject.Reason)
-	case "Send", "Delivery":
-		evh.logOutcome("success")
+	case "Send":
+		evh.quiet = !evh.Options.logSuccess()
+		evh.logSuccess("success")
+	case "Delivery":
+		evh.quiet = !evh.Options.logSuccess()
+		evh.handleDeliveryEvent(ctx)
+	case "DeliveryDelay":
+		evh.handleDeliveryDelayEvent()
+	case "Open", "Click":
+		evh.recordEngagement(ctx)
 	default:
-		evh.Log.Printf("unimplemented event type: %s", event.EventType)
+		evh.Log.Warnf("unimplemented event type: %s", event.EventType)
 	}
 }
 
+// Names of the metrics emitted by sesEventHandler.countEvent.
+const (
+	BounceMetric    = "Bounce"
+	ComplaintMetric = "Complaint"
+	RejectMetric    = "Reject"
+	SendMetric      = "Send"
+	DeliveryMetric  = "Delivery"
+)
+
+// DeliveryProcessingTimeMetric is the name of the metric emitted for each
+// SES "Delivery" event.
+//
+// Its value is the Delivery event's processingTimeMillis, the time between
+// SES accepting a message and the recipient's mail server accepting it.
+const DeliveryProcessingTimeMetric = "DeliveryProcessingTime"
+
+// countEvent emits a count of one for Bounce, Complaint, Reject, Send, and
+// Delivery events.
+//
+// Bounce counts have the BounceType and BounceSubType dimensions, and
+// Complaint counts have the ComplaintType dimension, to distinguish the
+// reasons for each. Counts aren't subject to SnsOptions.SampleSuccessLogs.
+func (evh *sesEventHandler) countEvent() {
+	var name string
+	var dims map[string]string
+
+	switch evh.Event.EventType {
+	case "Bounce":
+		bounce := evh.Event.Bounce
+		name = BounceMetric
+		dims = map[string]string{
+			"BounceType":    bounce.BounceType,
+			"BounceSubType": bounce.BounceSubType,
+		}
+	case "Complaint":
+		name = ComplaintMetric
+		dims = map[string]string{"ComplaintType": evh.complaintReason()}
+	case "Reject":
+		name = RejectMetric
+	case "Send":
+		name = SendMetric
+	case "Delivery":
+		name = DeliveryMetric
+	default:
+		return
+	}
+	ops.CountMetric(evh.Metrics, name, 1, dims)
+}
+
 func (evh *sesEventHandler) handleBounceEvent(ctx context.Context) {
 	event := evh.Event.Bounce
-	reason := event.BounceType + "/" + event.BounceSubType
-	if event.BounceType == "Transient" {
+	action, rule := evh.Options.BouncePolicy.Action(
+		event.BounceType, event.BounceSubType,
+	)
+	reason := fmt.Sprintf(
+		"%s/%s (rule: %s=%s)",
+		event.BounceType, event.BounceSubType, rule, action,
+	)
+
+	switch action {
+	case BounceIgnore:
 		evh.logOutcome("not removing recipients: " + reason)
-	} else {
+	case BounceRetry:
+		evh.retryBounce(reason)
+	default:
 		evh.removeRecipients(ctx, reason)
 	}
 }
 
-func (evh *sesEventHandler) handleComplaintEvent(ctx context.Context) {
-	event := evh.Event.Complaint
-	reason := event.ComplaintSubType
-	if reason == "" {
-		reason = event.ComplaintFeedbackType
+// retryBounce reports the event as failed so that it will be delivered again,
+// unless an SQS queue already redelivered it SnsOptions.BounceRetries times.
+//
+// Once the event exhausts its retries, retryBounce leaves the recipients in
+// place without reporting a failure, so the event doesn't go to a dead-letter
+// queue. Events without a ReceiveCount, such as those received directly from
+// SNS, are always reported as failed, subject to Lambda's own retry limits.
+func (evh *sesEventHandler) retryBounce(reason string) {
+	if retries := evh.Options.bounceRetries(); evh.ReceiveCount > retries {
+		evh.logOutcome(fmt.Sprintf(
+			"not removing recipients, retried %d times: %s", retries, reason,
+		))
+		return
 	}
-	if reason == "" {
-		reason = "unknown"
+	evh.failed.Store(true)
+	evh.logOutcome("not removing recipients, will retry: " + reason)
+}
+
+func (evh *sesEventHandler) handleDeliveryEvent(ctx context.Context) {
+	evh.logSuccess("success")
+
+	ops.MillisecondsMetric(
+		evh.Metrics,
+		DeliveryProcessingTimeMetric,
+		float64(evh.Event.Delivery.ProcessingTimeMillis),
+		nil,
+	)
+	if evh.Options.RecordDeliveries {
+		evh.recordDelivery(ctx)
 	}
+}
+
+// handleDeliveryDelayEvent logs a delivery delay without removing recipients.
+//
+// SES keeps retrying delayed messages until the expiration time. If delivery
+// ultimately fails, SES emits a Bounce event, which removes the recipient.
+func (evh *sesEventHandler) handleDeliveryDelayEvent() {
+	event := evh.Event.DeliveryDelay
+	delayed := make([]string, len(event.DelayedRecipients))
+
+	for i, recipient := range event.DelayedRecipients {
+		delayed[i] = recipient.EmailAddress
+	}
+	evh.logOutcome(fmt.Sprintf(
+		"not removing recipients: %s until %s: %s",
+		event.DelayType,
+		event.ExpirationTime.Format(time.RFC3339),
+		strings.Join(delayed, ","),
+	))
+}
+
+// complaintSubTypeOnAccountSuppressionList indicates that SES didn't send a
+// message because the recipient was already on the account suppression list.
+//
+// - https://docs.aws.amazon.com/ses/latest/dg/notification-contents.html#complaint-object
+const complaintSubTypeOnAccountSuppressionList = "OnAccountSuppressionList"
+
+// complaintReason returns the complaint's subtype, or its feedback type if the
+// subtype is empty, or "unknown" if both are empty.
+func (evh *sesEventHandler) complaintReason() string {
+	event := evh.Event.Complaint
+	if event.ComplaintSubType != "" {
+		return event.ComplaintSubType
+	} else if event.ComplaintFeedbackType != "" {
+		return event.ComplaintFeedbackType
+	}
+	return "unknown"
+}
+
+func (evh *sesEventHandler) handleComplaintEvent(ctx context.Context) {
+	reason := evh.complaintReason()
 
 	if reason == "not-spam" {
 		evh.restoreRecipients(ctx, reason)
+	} else if reason == complaintSubTypeOnAccountSuppressionList &&
+		evh.Options.IgnoreSuppressionListComplaints {
+		evh.logOutcome("not removing recipients: " + reason)
 	} else {
 		evh.removeRecipients(ctx, reason)
 	}
@@ -96,7 +486,9 @@ func (evh *sesEventHandler) logOutcome(outcome string) {
 	event := evh.Event
 	headers := &event.Mail.CommonHeaders
 
-	evh.Log.Printf(
+	logRedacted(
+		evh.Log,
+		evh.RedactAddresses,
 		`%s [Id:"%s" From:"%s" To:"%s" Subject:"%s"]: %s: %s`,
 		event.EventType,
 		event.Mail.MessageID,
@@ -108,6 +500,13 @@ func (evh *sesEventHandler) logOutcome(outcome string) {
 	)
 }
 
+// logSuccess logs outcome unless the event's successes are quiet.
+func (evh *sesEventHandler) logSuccess(outcome string) {
+	if !evh.quiet {
+		evh.logOutcome(outcome)
+	}
+}
+
 func (evh *sesEventHandler) removeRecipients(
 	ctx context.Context, reason string,
 ) {
@@ -125,6 +524,26 @@ func (evh *sesEventHandler) restoreRecipients(
 	evh.updateRecipients(ctx, reason, restore, "restored", "error restoring")
 }
 
+func (evh *sesEventHandler) recordEngagement(ctx context.Context) {
+	evh.updateRecipients(
+		ctx,
+		evh.Event.EventType,
+		evh.Agent.RecordEngagement,
+		"recorded engagement for",
+		"error recording engagement for",
+	)
+}
+
+func (evh *sesEventHandler) recordDelivery(ctx context.Context) {
+	evh.updateRecipients(
+		ctx,
+		evh.Event.EventType,
+		evh.Agent.RecordDelivery,
+		"recorded delivery for",
+		"error recording delivery for",
+	)
+}
+
 func (evh *sesEventHandler) updateRecipients(
 	ctx context.Context,
 	reason string,
@@ -132,12 +551,25 @@ func (evh *sesEventHandler) updateRecipients(
 	successPrefix, errPrefix string,
 ) {
 	for _, email := range evh.Event.Mail.CommonHeaders.To {
-		emailAndReason := " " + email + " due to: " + reason
-		outcome := successPrefix + emailAndReason
+		evh.dispatch(email, func() {
+			emailAndReason := " " + email + " due to: " + reason
 
-		if err := action(ctx, email); err != nil {
-			outcome = errPrefix + emailAndReason + ": " + err.Error()
-		}
-		evh.logOutcome(outcome)
+			if err := action(ctx, email); err != nil {
+				evh.logOutcome(errPrefix + emailAndReason + ": " + err.Error())
+				if errors.Is(err, ops.ErrExternal) {
+					evh.failed.Store(true)
+				}
+			} else {
+				evh.logSuccess(successPrefix + emailAndReason)
+			}
+		})
+	}
+}
+
+func (evh *sesEventHandler) dispatch(recipient string, work func()) {
+	if evh.Lanes == nil {
+		work()
+	} else {
+		evh.Lanes.Dispatch(recipient, work)
 	}
 }
@@ -4,8 +4,13 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	awsevents "github.com/aws/aws-lambda-go/events"
 	"github.com/mbland/elistman/ops"
@@ -22,11 +27,12 @@ type snsHandlerFixture struct {
 }
 
 func newSnsHandlerFixture() *snsHandlerFixture {
-	logs, logger := testutils.NewLogs()
+	logs, logger := newTestLogs()
 	agent := &testAgent{}
 	ctx := context.Background()
 
-	return &snsHandlerFixture{agent, logs, &snsHandler{agent, logger}, ctx}
+	handler := &snsHandler{Agent: agent, Log: logger}
+	return &snsHandlerFixture{agent, logs, handler, ctx}
 }
 
 // This and other test messages adapted from:
@@ -123,7 +129,7 @@ func rejectEventJson(reason string) string {
 }`
 }
 
-const unimplementedEventJson = `
+const openEventJson = `
 {
   "eventType": "Open",
   "open": {
@@ -134,6 +140,60 @@ const unimplementedEventJson = `
 ` + testMailJson + `
 }`
 
+const clickEventJson = `
+{
+  "eventType": "Click",
+  "click": {
+    "ipAddress": "127.0.0.1",
+    "link": "https://mike-bland.com/",
+    "linkTags": { "samplekey0": [ "samplevalue0" ] },
+    "timestamp": "1970-09-18T12:45:00.000Z",
+    "userAgent": "doesn't matter"
+  },
+` + testMailJson + `
+}`
+
+const deliveryDelayEventJson = `
+{
+  "eventType": "DeliveryDelay",
+  "deliveryDelay": {
+    "delayType": "TransientCommunicationFailure",
+    "delayedRecipients": [{
+      "emailAddress": "recipient@example.com",
+      "status": "4.4.1",
+      "diagnosticCode": "smtp; 421 4.4.1 Unable to connect"
+    }],
+    "expirationTime": "1970-09-19T12:45:00.000Z",
+    "reportingMTA": "mta.example.com",
+    "timestamp": "1970-09-18T12:45:00.000Z"
+  },
+` + testMailJson + `
+}`
+
+const unimplementedEventJson = `
+{
+  "eventType": "Subscription",
+  "subscription": {
+    "contactList": "SystemMonitor-Canary",
+    "timestamp": "1970-09-18T12:45:00.000Z",
+    "source": "UnsubscribeHeader"
+  },
+` + testMailJson + `
+}`
+
+// driftedBounceEventJson simulates SES changing the type of bounceType.
+const driftedBounceEventJson = `{
+  "eventType": "Bounce",
+  "bounce": {
+    "bounceType": 5,
+    "bounceSubType": "General"
+  },
+` + testMailJson + `
+}`
+
+const driftedBounceTypeErr = "json: cannot unmarshal number into " +
+	"Go struct field SesEventRecord.bounce.bounceType of type string"
+
 func TestParseSesEvent(t *testing.T) {
 	f := newSnsHandlerFixture()
 
@@ -151,6 +211,7 @@ func TestParseSesEvent(t *testing.T) {
 		assert.Equal(t, sendEventJson, handler.Details)
 		assert.Equal(t, f.handler.Agent, handler.Agent)
 		assert.Equal(t, f.handler.Log, handler.Log)
+		assert.DeepEqual(t, f.handler.Options, handler.Options)
 	})
 
 	t.Run("FailsOnParseError", func(t *testing.T) {
@@ -159,6 +220,50 @@ func TestParseSesEvent(t *testing.T) {
 		assert.Assert(t, is.Nil(handler))
 		assert.ErrorContains(t, err, "unexpected end of JSON input")
 	})
+
+	t.Run("FailsOnSchemaDriftByDefault", func(t *testing.T) {
+		handler, err := f.handler.parseSesEvent(driftedBounceEventJson)
+
+		assert.Assert(t, is.Nil(handler))
+		assert.Error(t, err, driftedBounceTypeErr)
+	})
+
+	t.Run("TolerateSchemaDrift", func(t *testing.T) {
+		tf := newSnsHandlerFixture()
+		tf.handler.Options.TolerateSchemaDrift = true
+
+		t.Run("ExtractsEventTypeAndMail", func(t *testing.T) {
+			handler, err := tf.handler.parseSesEvent(driftedBounceEventJson)
+
+			assert.NilError(t, err)
+			assert.Error(t, handler.ParseError, driftedBounceTypeErr)
+			assert.Equal(t, "Bounce", handler.Event.EventType)
+			assert.Assert(t, is.Nil(handler.Event.Bounce))
+			to := handler.Event.Mail.CommonHeaders.To
+			assert.DeepEqual(t, []string{"recipient@example.com"}, to)
+		})
+
+		t.Run("DoesNotSetParseErrorOnSuccess", func(t *testing.T) {
+			handler, err := tf.handler.parseSesEvent(sendEventJson)
+
+			assert.NilError(t, err)
+			assert.NilError(t, handler.ParseError)
+		})
+
+		t.Run("StillFailsOnSyntaxError", func(t *testing.T) {
+			handler, err := tf.handler.parseSesEvent("")
+
+			assert.Assert(t, is.Nil(handler))
+			assert.ErrorContains(t, err, "unexpected end of JSON input")
+		})
+
+		t.Run("StillFailsIfEventTypeMissing", func(t *testing.T) {
+			handler, err := tf.handler.parseSesEvent(`{"eventType": 5}`)
+
+			assert.Assert(t, is.Nil(handler))
+			assert.ErrorContains(t, err, "cannot unmarshal number")
+		})
+	})
 }
 
 func TestUpdateRecipients(t *testing.T) {
@@ -252,6 +357,22 @@ func TestSesEventHandler(t *testing.T) {
 		f.logs.AssertContains(t, expected)
 	})
 
+	t.Run("logOutcomeRedactsAddresses", func(t *testing.T) {
+		f := newSesEventHandlerFixture(sendEventJson)
+		f.handler.RedactAddresses = true
+
+		f.handler.logOutcome("removed recipient@example.com")
+
+		expected := `Send ` +
+			`[Id:"EXAMPLE7c191be45" From:"n****@mike-bland.com" ` +
+			`To:"r****@example.com" Subject:"Test message"]: ` +
+			`removed r****@example.com: `
+		f.logs.AssertContains(t, expected)
+		logs := f.logs.Logs()
+		assert.Assert(t, !strings.Contains(logs, "recipient@example.com"))
+		assert.Assert(t, !strings.Contains(logs, "no-reply@mike-bland.com"))
+	})
+
 	t.Run("RemoveRecipients", func(t *testing.T) {
 		f := newSesEventHandlerFixture(complaintEventJson("", ""))
 
@@ -282,7 +403,8 @@ func TestSesEventHandlerHandleEvent(t *testing.T) {
 
 		f.handler.HandleEvent(f.ctx)
 
-		f.logs.AssertContains(t, "unimplemented event type: Open")
+		const expected = "WARNING: unimplemented event type: Subscription"
+		f.logs.AssertContains(t, expected)
 	})
 
 	t.Run("LogsSuccessForSend", func(t *testing.T) {
@@ -304,6 +426,123 @@ func TestSesEventHandlerHandleEvent(t *testing.T) {
 	})
 }
 
+func TestSesEventHandlerCountsEvents(t *testing.T) {
+	setup := func(eventMsg string) (*sesEventHandlerFixture, *strings.Builder) {
+		buf := &strings.Builder{}
+		f := newSnsHandlerFixture()
+		f.handler.Metrics = &ops.EmfMetrics{Namespace: "EListMan", Writer: buf}
+		handler, err := f.handler.parseSesEvent(eventMsg)
+		if err != nil {
+			panic("failed to parse test event: " + err.Error())
+		}
+		return &sesEventHandlerFixture{handler, f.agent, f.logs, f.ctx}, buf
+	}
+
+	// parseCount returns the single embedded metric format object emitted,
+	// and asserts that it contains a count of one for name.
+	parseCount := func(
+		t *testing.T, output, name string,
+	) (metrics map[string]any) {
+		t.Helper()
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		assert.Assert(t, is.Len(lines, 1))
+		assert.NilError(t, json.Unmarshal([]byte(lines[0]), &metrics))
+		assert.Equal(t, float64(1), metrics[name])
+
+		metadata := metrics["_aws"].(map[string]any)
+		directive := metadata["CloudWatchMetrics"].([]any)[0].(map[string]any)
+		assert.Equal(t, "EListMan", directive["Namespace"])
+		metric := directive["Metrics"].([]any)[0].(map[string]any)
+		assert.Equal(t, name, metric["Name"])
+		assert.Equal(t, "Count", metric["Unit"])
+		return
+	}
+
+	t.Run("Bounce", func(t *testing.T) {
+		f, buf := setup(bounceEventJson("Permanent", "Suppressed"))
+
+		f.handler.HandleEvent(f.ctx)
+
+		metrics := parseCount(t, buf.String(), BounceMetric)
+		assert.Equal(t, "Permanent", metrics["BounceType"])
+		assert.Equal(t, "Suppressed", metrics["BounceSubType"])
+	})
+
+	t.Run("Complaint", func(t *testing.T) {
+		f, buf := setup(complaintEventJson("", "abuse"))
+
+		f.handler.HandleEvent(f.ctx)
+
+		metrics := parseCount(t, buf.String(), ComplaintMetric)
+		assert.Equal(t, "abuse", metrics["ComplaintType"])
+	})
+
+	t.Run("RejectAndSend", func(t *testing.T) {
+		events := map[string]string{
+			RejectMetric: rejectEventJson("Bad content"),
+			SendMetric:   sendEventJson,
+		}
+
+		for name, eventMsg := range events {
+			f, buf := setup(eventMsg)
+
+			f.handler.HandleEvent(f.ctx)
+
+			metrics := parseCount(t, buf.String(), name)
+			metadata := metrics["_aws"].(map[string]any)
+			directive := metadata["CloudWatchMetrics"].([]any)[0]
+			dims := directive.(map[string]any)["Dimensions"]
+			assert.DeepEqual(t, []any{[]any{}}, dims)
+		}
+	})
+
+	t.Run("DeliveryAlsoEmitsProcessingTime", func(t *testing.T) {
+		f, buf := setup(deliveryEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Assert(t, is.Len(lines, 2))
+		parseCount(t, lines[0], DeliveryMetric)
+
+		var metrics map[string]any
+		assert.NilError(t, json.Unmarshal([]byte(lines[1]), &metrics))
+		assert.Equal(t, float64(27), metrics[DeliveryProcessingTimeMetric])
+		metadata := metrics["_aws"].(map[string]any)
+		directive := metadata["CloudWatchMetrics"].([]any)[0].(map[string]any)
+		assert.Equal(t, "EListMan", directive["Namespace"])
+		metric := directive["Metrics"].([]any)[0].(map[string]any)
+		assert.Equal(t, DeliveryProcessingTimeMetric, metric["Name"])
+		assert.Equal(t, "Milliseconds", metric["Unit"])
+	})
+
+	t.Run("CountsSuccessesEvenIfLogsAreSampled", func(t *testing.T) {
+		f, buf := setup(sendEventJson)
+		f.handler.Options.SampleSuccessLogs = true
+
+		f.handler.HandleEvent(f.ctx)
+
+		assert.Equal(t, "", f.logs.Logs())
+		parseCount(t, buf.String(), SendMetric)
+	})
+
+	t.Run("IgnoresOtherEvents", func(t *testing.T) {
+		f, buf := setup(deliveryDelayEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		assert.Equal(t, "", buf.String())
+	})
+
+	t.Run("NilMetricsIsNoOp", func(t *testing.T) {
+		f := newSesEventHandlerFixture(bounceEventJson("Permanent", "General"))
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, "removed recipient@example.com")
+	})
+}
+
 func TestHandleBounceEvent(t *testing.T) {
 	setup := func(bounceType, bounceSubType string) (
 		f *sesEventHandlerFixture,
@@ -330,12 +569,105 @@ func TestHandleBounceEvent(t *testing.T) {
 		f.handler.HandleEvent(f.ctx)
 
 		f.logs.AssertContains(
-			t, "removed recipient@example.com due to: Permanent/General",
+			t, "removed recipient@example.com due to: Permanent/General "+
+				"(rule: default=Remove)",
+		)
+		assertRecipientRemoved(
+			t, f.agent, "Remove", "recipient@example.com", reasonBounce,
+		)
+	})
+
+	t.Run("IgnoresTransientMailboxFullByDefault", func(t *testing.T) {
+		f := setup("Transient", "MailboxFull")
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "not removing recipients: Transient/MailboxFull "+
+				"(rule: Transient=Ignore)",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		assert.Assert(t, !f.handler.Failed())
+	})
+
+	t.Run("AppliesSubTypeRule", func(t *testing.T) {
+		f := setup("Permanent", "Suppressed")
+		f.handler.Options.BouncePolicy = BouncePolicy{
+			"Permanent/Suppressed": BounceIgnore,
+		}
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "not removing recipients: Permanent/Suppressed "+
+				"(rule: Permanent/Suppressed=Ignore)",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+	})
+
+	t.Run("RemovesRecipientsIfSubTypeUnmapped", func(t *testing.T) {
+		f := setup("Permanent", "NoEmail")
+		f.handler.Options.BouncePolicy = BouncePolicy{
+			"Permanent/Suppressed": BounceIgnore,
+		}
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "removed recipient@example.com due to: Permanent/NoEmail "+
+				"(rule: default=Remove)",
 		)
 		assertRecipientRemoved(
 			t, f.agent, "Remove", "recipient@example.com", reasonBounce,
 		)
 	})
+
+	t.Run("ReportsFailureToRetryLater", func(t *testing.T) {
+		f := setup("Transient", "MailboxFull")
+		f.handler.Options.BouncePolicy = BouncePolicy{
+			"Transient/MailboxFull": BounceRetry,
+		}
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "not removing recipients, will retry: Transient/MailboxFull "+
+				"(rule: Transient/MailboxFull=Retry)",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		assert.Assert(t, f.handler.Failed())
+	})
+
+	t.Run("ReportsFailureUntilRetriesExhausted", func(t *testing.T) {
+		f := setup("Transient", "MailboxFull")
+		f.handler.Options.BouncePolicy = BouncePolicy{
+			"Transient/MailboxFull": BounceRetry,
+		}
+		f.handler.Options.BounceRetries = 2
+		f.handler.ReceiveCount = 2
+
+		f.handler.HandleEvent(f.ctx)
+
+		assert.Assert(t, f.handler.Failed())
+	})
+
+	t.Run("StopsRetryingAfterRetriesExhausted", func(t *testing.T) {
+		f := setup("Transient", "MailboxFull")
+		f.handler.Options.BouncePolicy = BouncePolicy{
+			"Transient/MailboxFull": BounceRetry,
+		}
+		f.handler.Options.BounceRetries = 2
+		f.handler.ReceiveCount = 3
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "not removing recipients, retried 2 times: "+
+				"Transient/MailboxFull (rule: Transient/MailboxFull=Retry)",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		assert.Assert(t, !f.handler.Failed())
+	})
 }
 
 func TestHandleComplaintEvent(t *testing.T) {
@@ -387,6 +719,27 @@ func TestHandleComplaintEvent(t *testing.T) {
 		})
 	})
 
+	t.Run("IgnoresOnAccountSuppressionListIfConfigured", func(t *testing.T) {
+		f := setup("OnAccountSuppressionList", "")
+		f.handler.Options.IgnoreSuppressionListComplaints = true
+
+		f.handler.HandleEvent(f.ctx)
+
+		const expected = "not removing recipients: OnAccountSuppressionList"
+		f.logs.AssertContains(t, expected)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+	})
+
+	t.Run("StillRemovesOtherComplaintsIfConfigured", func(t *testing.T) {
+		f := setup("", "abuse")
+		f.handler.Options.IgnoreSuppressionListComplaints = true
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, "removed "+recipient+" due to: abuse")
+		assertRecipientRemoved(t, f.agent, "Remove", recipient, reasonComplaint)
+	})
+
 	t.Run("RestoresRecipientsIfFeedbackIsNotSpam", func(t *testing.T) {
 		f := setup("", "not-spam")
 
@@ -397,6 +750,198 @@ func TestHandleComplaintEvent(t *testing.T) {
 	})
 }
 
+func TestHandleEngagementEvents(t *testing.T) {
+	t.Run("OpenRecordsEngagement", func(t *testing.T) {
+		f := newSesEventHandlerFixture(openEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "recorded engagement for recipient@example.com due to: Open",
+		)
+		calls := []testAgentCalls{
+			{Method: "RecordEngagement", Email: "recipient@example.com"},
+		}
+		assert.DeepEqual(t, calls, f.agent.Calls)
+	})
+
+	t.Run("ClickRecordsEngagement", func(t *testing.T) {
+		f := newSesEventHandlerFixture(clickEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t, "recorded engagement for recipient@example.com due to: Click",
+		)
+		calls := []testAgentCalls{
+			{Method: "RecordEngagement", Email: "recipient@example.com"},
+		}
+		assert.DeepEqual(t, calls, f.agent.Calls)
+		assert.Equal(t, "https://mike-bland.com/", f.handler.Event.Click.Link)
+	})
+
+	t.Run("LogsErrorWithoutRemovingRecipients", func(t *testing.T) {
+		f := newSesEventHandlerFixture(openEventJson)
+		f.agent.Error = errors.New("ddb error")
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t,
+			"error recording engagement for recipient@example.com "+
+				"due to: Open: ddb error",
+		)
+		assert.Equal(t, 1, len(f.agent.Calls))
+		assert.Equal(t, "RecordEngagement", f.agent.Calls[0].Method)
+	})
+}
+
+func TestHandleDeliveryEvent(t *testing.T) {
+	t.Run("OnlyLogsSuccessByDefault", func(t *testing.T) {
+		f := newSesEventHandlerFixture(deliveryEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, ": success: ")
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		assert.Assert(t, !strings.Contains(f.logs.Logs(), `"_aws"`))
+	})
+
+	t.Run("RecordsDeliveryIfConfigured", func(t *testing.T) {
+		f := newSesEventHandlerFixture(deliveryEventJson)
+		f.handler.Options.RecordDeliveries = true
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, ": success: ")
+		f.logs.AssertContains(
+			t, "recorded delivery for recipient@example.com due to: Delivery",
+		)
+		calls := []testAgentCalls{
+			{Method: "RecordDelivery", Email: "recipient@example.com"},
+		}
+		assert.DeepEqual(t, calls, f.agent.Calls)
+	})
+
+	t.Run("LogsRecordDeliveryError", func(t *testing.T) {
+		f := newSesEventHandlerFixture(deliveryEventJson)
+		f.handler.Options.RecordDeliveries = true
+		f.agent.Error = errors.New("ddb error")
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t,
+			"error recording delivery for recipient@example.com "+
+				"due to: Delivery: ddb error",
+		)
+	})
+}
+
+func TestSampleSuccessLogs(t *testing.T) {
+	setup := func(
+		eventMsg string, rate, random float64,
+	) *sesEventHandlerFixture {
+		f := newSesEventHandlerFixture(eventMsg)
+		f.handler.Options.SampleSuccessLogs = true
+		f.handler.Options.SuccessLogSampleRate = rate
+		f.handler.Options.SuccessLogRand = func() float64 { return random }
+		return f
+	}
+
+	t.Run("LogsEverySuccessByDefault", func(t *testing.T) {
+		f := newSesEventHandlerFixture(sendEventJson)
+		f.handler.Options.SuccessLogRand = func() float64 { return 0.99 }
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, "Send [Id:")
+	})
+
+	t.Run("SuppressesSendAndDeliveryIfRateIsZero", func(t *testing.T) {
+		for _, eventMsg := range []string{sendEventJson, deliveryEventJson} {
+			f := setup(eventMsg, 0, 0)
+
+			f.handler.HandleEvent(f.ctx)
+
+			assert.Equal(t, "", f.logs.Logs())
+		}
+	})
+
+	t.Run("LogsSampledSuccess", func(t *testing.T) {
+		f := setup(sendEventJson, 0.1, 0.05)
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(t, "Send [Id:")
+		f.logs.AssertContains(t, ": success: ")
+	})
+
+	t.Run("SkipsUnsampledSuccess", func(t *testing.T) {
+		f := setup(deliveryEventJson, 0.1, 0.1)
+
+		f.handler.HandleEvent(f.ctx)
+
+		assert.Equal(t, "", f.logs.Logs())
+	})
+
+	t.Run("SuppressesRecordedDeliveryButNotErrors", func(t *testing.T) {
+		f := setup(deliveryEventJson, 0, 0)
+		f.handler.Options.RecordDeliveries = true
+
+		f.handler.HandleEvent(f.ctx)
+
+		assert.Equal(t, "", f.logs.Logs())
+		assert.Equal(t, 1, len(f.agent.Calls))
+
+		f = setup(deliveryEventJson, 0, 0)
+		f.handler.Options.RecordDeliveries = true
+		f.agent.Error = errors.New("ddb error")
+
+		f.handler.HandleEvent(f.ctx)
+
+		f.logs.AssertContains(
+			t,
+			"error recording delivery for recipient@example.com "+
+				"due to: Delivery: ddb error",
+		)
+	})
+
+	t.Run("AlwaysLogsFailures", func(t *testing.T) {
+		for _, eventMsg := range []string{
+			bounceEventJson("Permanent", "General"),
+			complaintEventJson("", "abuse"),
+			rejectEventJson("Bad content"),
+		} {
+			f := setup(eventMsg, 0, 0)
+
+			f.handler.HandleEvent(f.ctx)
+
+			assert.Assert(t, f.logs.Logs() != "", "event: %s", eventMsg)
+		}
+	})
+}
+
+func TestHandleDeliveryDelayEvent(t *testing.T) {
+	t.Run("LogsDelayWithoutUpdatingRecipients", func(t *testing.T) {
+		f := newSesEventHandlerFixture(deliveryDelayEventJson)
+
+		f.handler.HandleEvent(f.ctx)
+
+		event := f.handler.Event.DeliveryDelay
+		assert.Equal(t, "TransientCommunicationFailure", event.DelayType)
+		expires := time.Date(1970, time.September, 19, 12, 45, 0, 0, time.UTC)
+		assert.Equal(t, expires, event.ExpirationTime)
+		f.logs.AssertContains(t, "DeliveryDelay [Id:")
+		f.logs.AssertContains(
+			t,
+			": not removing recipients: TransientCommunicationFailure "+
+				"until 1970-09-19T12:45:00Z: recipient@example.com: ",
+		)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+	})
+}
+
 func TestHandleRejectEvent(t *testing.T) {
 	setup := func(reason string) (f *sesEventHandlerFixture) {
 		return newSesEventHandlerFixture(rejectEventJson(reason))
@@ -416,21 +961,28 @@ func TestHandleSnsEvent(t *testing.T) {
 	t.Run("DoesNothingIfNoSnsRecords", func(t *testing.T) {
 		f := newSnsHandlerFixture()
 
-		f.handler.HandleEvent(f.ctx, &awsevents.SNSEvent{})
+		err := f.handler.HandleEvent(f.ctx, &awsevents.SNSEvent{})
 
+		assert.NilError(t, err)
 		assert.Equal(t, "", f.logs.Logs())
 	})
 
-	t.Run("LogsEventRecordParseError", func(t *testing.T) {
+	t.Run("LogsAndReturnsEventRecordParseError", func(t *testing.T) {
 		f := newSnsHandlerFixture()
 		event := simpleNotificationServiceEvent()
 		event.Records[0].SNS.Message = ""
 
-		f.handler.HandleEvent(f.ctx, event)
+		err := f.handler.HandleEvent(f.ctx, event)
 
 		expected := "parsing SES event from SNS failed: " +
 			"unexpected end of JSON input: "
 		f.logs.AssertContains(t, expected)
+		assert.ErrorContains(
+			t,
+			err,
+			"SNS message deadbeef: parsing SES event failed: "+
+				"unexpected end of JSON input",
+		)
 	})
 
 	t.Run("LogsErrorForUnimplementedEventType", func(t *testing.T) {
@@ -440,19 +992,375 @@ func TestHandleSnsEvent(t *testing.T) {
 
 		f.handler.HandleEvent(f.ctx, event)
 
-		f.logs.AssertContains(t, "unimplemented event type: Open")
+		const expected = "WARNING: unimplemented event type: Subscription"
+		f.logs.AssertContains(t, expected)
 	})
 
-	t.Run("SendEventSucceeds", func(t *testing.T) {
+	t.Run("LogsDriftedEventWithoutUpdatingRecipients", func(t *testing.T) {
 		f := newSnsHandlerFixture()
+		f.handler.Options.TolerateSchemaDrift = true
 		event := simpleNotificationServiceEvent()
+		event.Records[0].SNS.Message = driftedBounceEventJson
 
 		f.handler.HandleEvent(f.ctx, event)
 
+		expected := `Bounce ` +
+			`[Id:"EXAMPLE7c191be45" From:"no-reply@mike-bland.com" ` +
+			`To:"recipient@example.com" Subject:"Test message"]: ` +
+			"not updating recipients: failed to parse event: " +
+			driftedBounceTypeErr
+		f.logs.AssertContains(t, expected)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+	})
+
+	t.Run("SendEventSucceeds", func(t *testing.T) {
+		f := newSnsHandlerFixture()
+		event := simpleNotificationServiceEvent()
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.NilError(t, err)
 		expected := `Send ` +
 			`[Id:"deadbeef" From:"mbland@acm.org" To:"foo@bar.com" ` +
 			`Subject:"This is an email sent to the list"]: success: ` +
 			event.Records[0].SNS.Message
 		f.logs.AssertContains(t, expected)
 	})
+
+	t.Run("ReturnsErrorIfUpdatingRecipientsFails", func(t *testing.T) {
+		f := newSnsHandlerFixture()
+		f.agent.Error = newOpsErrExternal("db unavailable")
+		event := snsEventForRecipients(
+			bounceEventJson("Permanent", "General"), "recipient@example.com",
+		)
+		event.Records[0].SNS.MessageID = "deadbeef"
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.ErrorContains(
+			t,
+			err,
+			"SNS message deadbeef: failed to update recipients for "+
+				"Bounce event from SES message EXAMPLE7c191be45",
+		)
+	})
+
+	t.Run("DoesNotReturnErrorForNonExternalAgentErrors", func(t *testing.T) {
+		f := newSnsHandlerFixture()
+		f.agent.Error = errors.New("not an external error")
+		event := snsEventForRecipients(
+			bounceEventJson("Permanent", "General"), "recipient@example.com",
+		)
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.NilError(t, err)
+		f.logs.AssertContains(t, "not an external error")
+	})
+
+	t.Run("JoinsErrorsFromEveryFailedRecord", func(t *testing.T) {
+		f := newSnsHandlerFixture()
+		event := simpleNotificationServiceEvent()
+		badRecord := event.Records[0]
+		badRecord.SNS.MessageID = "badc0ffee"
+		badRecord.SNS.Message = "not JSON"
+		event.Records = append(event.Records, badRecord, badRecord)
+		event.Records[2].SNS.MessageID = "deadc0de"
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.ErrorContains(t, err, "SNS message badc0ffee: ")
+		assert.ErrorContains(t, err, "SNS message deadc0de: ")
+		assert.Assert(t, !strings.Contains(err.Error(), "deadbeef"))
+	})
+}
+
+// testEventLog is a fake SesEventLog that records IDs in memory.
+//
+// Like DynamoDB requests, ForgetEvent fails if ctx is cancelled.
+type testEventLog struct {
+	ids map[string]bool
+	err error
+}
+
+func (l *testEventLog) RecordEvent(
+	_ context.Context, id string,
+) (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	} else if l.ids[id] {
+		return false, nil
+	}
+	l.ids[id] = true
+	return true, nil
+}
+
+func (l *testEventLog) ForgetEvent(ctx context.Context, id string) error {
+	if l.err != nil {
+		return l.err
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(l.ids, id)
+	return nil
+}
+
+func TestHandleSnsEventDuplicates(t *testing.T) {
+	setup := func() (*snsHandlerFixture, *testEventLog, *awsevents.SNSEvent) {
+		f := newSnsHandlerFixture()
+		eventLog := &testEventLog{ids: map[string]bool{}}
+		f.handler.EventLog = eventLog
+		event := snsEventForRecipients(
+			bounceEventJson("Permanent", "General"), "recipient@example.com",
+		)
+		return f, eventLog, event
+	}
+
+	t.Run("IgnoresSecondDeliveryOfSameEvent", func(t *testing.T) {
+		f, eventLog, event := setup()
+
+		f.handler.HandleEvent(f.ctx, event)
+		f.handler.HandleEvent(f.ctx, event)
+
+		assert.Assert(t, eventLog.ids["Bounce/EXAMPLE7c191be45"])
+		assertRecipientRemoved(
+			t,
+			f.agent,
+			"Remove",
+			"recipient@example.com",
+			ops.RemoveReasonBounce,
+		)
+		f.logs.AssertContains(t, "duplicate event ignored")
+	})
+
+	t.Run("HandlesDifferentEventTypesForSameMessage", func(t *testing.T) {
+		f, _, event := setup()
+		complaint := snsEventForRecipients(
+			complaintEventJson("", "not-spam"), "recipient@example.com",
+		)
+
+		f.handler.HandleEvent(f.ctx, event)
+		f.handler.HandleEvent(f.ctx, complaint)
+
+		assert.Equal(t, 2, len(f.agent.Calls))
+		assert.Assert(
+			t, !strings.Contains(f.logs.Logs(), "duplicate event ignored"),
+		)
+	})
+
+	t.Run("HandlesEventIfEventLogFails", func(t *testing.T) {
+		f, eventLog, event := setup()
+		eventLog.err = errors.New("event log failed")
+
+		f.handler.HandleEvent(f.ctx, event)
+		f.handler.HandleEvent(f.ctx, event)
+
+		assert.Equal(t, 2, len(f.agent.Calls))
+		f.logs.AssertContains(
+			t, "WARNING: failed to check for duplicate SES event: "+
+				"event log failed",
+		)
+	})
+
+	t.Run("HandlesFailedEventAgainIfRedelivered", func(t *testing.T) {
+		f, eventLog, event := setup()
+		f.agent.Error = newOpsErrExternal("db unavailable")
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.ErrorContains(t, err, "failed to update recipients")
+		assert.Assert(t, !eventLog.ids["Bounce/EXAMPLE7c191be45"])
+
+		f.agent.Error = nil
+		err = f.handler.HandleEvent(f.ctx, event)
+
+		assert.NilError(t, err)
+		assert.Equal(t, 2, len(f.agent.Calls))
+		assert.Assert(t, eventLog.ids["Bounce/EXAMPLE7c191be45"])
+	})
+
+	t.Run("IgnoresSuccessfulEventsWhenRetrying", func(t *testing.T) {
+		f, eventLog, _ := setup()
+		f.handler.Options.BouncePolicy = BouncePolicy{"Transient": BounceRetry}
+		event := snsEventForRecipients(
+			complaintEventJson("", "abuse"), "recipient@example.com",
+		)
+		retry := snsEventForRecipients(
+			bounceEventJson("Transient", "General"), "recipient@example.com",
+		)
+		event.Records = append(event.Records, retry.Records...)
+
+		err := f.handler.HandleEvent(f.ctx, event)
+		assert.ErrorContains(t, err, "Bounce event")
+
+		err = f.handler.HandleEvent(f.ctx, event)
+
+		assert.ErrorContains(t, err, "Bounce event")
+		assert.Assert(t, !strings.Contains(err.Error(), "Complaint event"))
+		assert.Equal(t, 1, len(f.agent.Calls))
+		assert.Assert(t, eventLog.ids["Complaint/EXAMPLE7c191be45"])
+		assert.Assert(t, !eventLog.ids["Bounce/EXAMPLE7c191be45"])
+		f.logs.AssertContains(t, "duplicate event ignored")
+	})
+
+	t.Run("ForgetsFailedEventIfContextCancelled", func(t *testing.T) {
+		f, eventLog, event := setup()
+		ctx, cancel := context.WithCancel(f.ctx)
+		cancel()
+		f.agent.Error = fmt.Errorf("%w: %w", ops.ErrExternal, ctx.Err())
+
+		err := f.handler.HandleEvent(ctx, event)
+
+		assert.ErrorContains(t, err, "failed to update recipients")
+		assert.Assert(t, !eventLog.ids["Bounce/EXAMPLE7c191be45"])
+		assert.Assert(
+			t, !strings.Contains(f.logs.Logs(), "failed to forget"),
+		)
+	})
+
+	t.Run("LogsErrorIfForgettingFailedEventFails", func(t *testing.T) {
+		f, eventLog, event := setup()
+		f.agent.Error = newOpsErrExternal("db unavailable")
+		eventLog.err = errors.New("event log failed")
+
+		err := f.handler.HandleEvent(f.ctx, event)
+
+		assert.ErrorContains(t, err, "failed to update recipients")
+		f.logs.AssertContains(
+			t, "WARNING: failed to forget failed SES event: event log failed",
+		)
+	})
+}
+
+// laneTestAgent records Remove and Restore calls from concurrent lanes.
+//
+// If started is not nil, each call sends its email argument to started, then
+// waits for release to close before recording the call.
+type laneTestAgent struct {
+	testAgent
+	mutex   sync.Mutex
+	calls   []string
+	started chan string
+	release chan struct{}
+}
+
+func (a *laneTestAgent) Remove(
+	_ context.Context, email string, _ ops.RemoveReason,
+) error {
+	return a.record("Remove", email)
+}
+
+func (a *laneTestAgent) Restore(_ context.Context, email string) error {
+	return a.record("Restore", email)
+}
+
+func (a *laneTestAgent) record(method, email string) error {
+	if a.started != nil {
+		a.started <- email
+		<-a.release
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.calls = append(a.calls, method+" "+email)
+	return nil
+}
+
+func snsEventForRecipients(
+	eventJson string, recipients ...string,
+) *awsevents.SNSEvent {
+	event := &awsevents.SNSEvent{}
+
+	for _, recipient := range recipients {
+		msg := strings.ReplaceAll(eventJson, "recipient@example.com", recipient)
+		event.Records = append(
+			event.Records,
+			awsevents.SNSEventRecord{SNS: awsevents.SNSEntity{Message: msg}},
+		)
+	}
+	return event
+}
+
+func TestHandleSnsEventConcurrently(t *testing.T) {
+	setup := func(concurrency int) (*snsHandler, *laneTestAgent) {
+		agent := &laneTestAgent{}
+		_, logger := newTestLogs()
+		handler := &snsHandler{
+			Agent:   agent,
+			Log:     logger,
+			Options: SnsOptions{Concurrency: concurrency},
+		}
+		return handler, agent
+	}
+
+	t.Run("AppliesEventsForSameRecipientInOrder", func(t *testing.T) {
+		handler, agent := setup(4)
+		recipients := []string{"a@foo.com", "b@foo.com", "c@foo.com"}
+		event := snsEventForRecipients(
+			bounceEventJson("Permanent", "General"), recipients...,
+		)
+		restore := snsEventForRecipients(
+			complaintEventJson("", "not-spam"), recipients...,
+		)
+		event.Records = append(event.Records, restore.Records...)
+
+		handler.HandleEvent(context.Background(), event)
+
+		assert.Assert(t, is.Len(agent.calls, 6))
+		for _, recipient := range recipients {
+			removed := -1
+			restored := -1
+			for i, call := range agent.calls {
+				if call == "Remove "+recipient {
+					removed = i
+				} else if call == "Restore "+recipient {
+					restored = i
+				}
+			}
+			assert.Assert(t, removed != -1, recipient)
+			assert.Assert(t, removed < restored, recipient)
+		}
+	})
+
+	t.Run("UpdatesDifferentRecipientsConcurrently", func(t *testing.T) {
+		const concurrency = 2
+		handler, agent := setup(concurrency)
+		agent.started = make(chan string, concurrency)
+		agent.release = make(chan struct{})
+
+		// Find two recipients assigned to different lanes.
+		first := "a@foo.com"
+		second := ""
+		for i := 0; second == ""; i++ {
+			candidate := fmt.Sprintf("b%d@foo.com", i)
+			if laneIndex(candidate, concurrency) !=
+				laneIndex(first, concurrency) {
+				second = candidate
+			}
+		}
+		event := snsEventForRecipients(
+			bounceEventJson("Permanent", "General"), first, second,
+		)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			handler.HandleEvent(context.Background(), event)
+		}()
+
+		started := []string{}
+		for len(started) != concurrency {
+			select {
+			case email := <-agent.started:
+				started = append(started, email)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("only started updating: %v", started)
+			}
+		}
+		close(agent.release)
+		<-done
+
+		assert.Assert(t, is.Contains(started, first))
+		assert.Assert(t, is.Contains(started, second))
+		assert.Assert(t, is.Len(agent.calls, 2))
+	})
 }
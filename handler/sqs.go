@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+// sqsHandler processes SES events delivered via an SQS queue.
+//
+// Each SQS message body may contain either an SNS notification wrapping the
+// SES event, for queues subscribed to the SNS topic, or the raw SES event
+// JSON. After unwrapping the SES event, sqsHandler processes it exactly like
+// snsHandler does.
+//
+// HandleEvent reports messages that fail to parse, events for which updating
+// any recipient failed due to an external error, and bounces to retry per
+// SnsOptions.BouncePolicy and SnsOptions.BounceRetries, as batch item
+// failures. The Lambda event source mapping must enable
+// ReportBatchItemFailures so that SQS will retry only those messages, and
+// eventually move them to a dead-letter queue if so configured.
+//
+// - https://docs.aws.amazon.com/lambda/latest/dg/with-sqs.html
+// - https://docs.aws.amazon.com/lambda/latest/dg/services-sqs-errorhandling.html
+type sqsHandler struct {
+	Sns *snsHandler
+}
+
+// snsEnvelope contains the fields of an SNS notification delivered to SQS.
+//
+// - https://docs.aws.amazon.com/sns/latest/dg/sns-message-and-json-formats.html#http-notification-json
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+func (h *sqsHandler) HandleEvent(
+	ctx context.Context, e *awsevents.SQSEvent,
+) *awsevents.SQSEventResponse {
+	res := &awsevents.SQSEventResponse{
+		BatchItemFailures: []awsevents.SQSBatchItemFailure{},
+	}
+	lanes := newRecipientLanes(h.Sns.Options.Concurrency)
+	handlers := make(map[string]*sesEventHandler, len(e.Records))
+
+	for _, sqsRecord := range e.Records {
+		msg := unwrapSnsEnvelope(sqsRecord.Body)
+		if handler, err := h.Sns.parseSesEvent(msg); err != nil {
+			const errFmt = "parsing SES event from SQS message %s failed: " +
+				"%s: %s"
+			logRedacted(
+				h.Sns.Log, h.Sns.RedactAddresses,
+				errFmt, sqsRecord.MessageId, err, msg,
+			)
+			res.BatchItemFailures = appendBatchItemFailure(
+				res.BatchItemFailures, sqsRecord.MessageId,
+			)
+		} else {
+			handlers[sqsRecord.MessageId] = handler
+			handler.Lanes = lanes
+			handler.ReceiveCount = receiveCount(&sqsRecord)
+			handler.HandleEvent(ctx)
+		}
+	}
+	lanes.Run()
+
+	// Report external failures in the original message order.
+	for _, sqsRecord := range e.Records {
+		handler, ok := handlers[sqsRecord.MessageId]
+		if ok && handler.Failed() {
+			res.BatchItemFailures = appendBatchItemFailure(
+				res.BatchItemFailures, sqsRecord.MessageId,
+			)
+		}
+	}
+	return res
+}
+
+// receiveCount returns the number of times SQS has delivered msg, per its
+// ApproximateReceiveCount attribute, or zero if unknown.
+func receiveCount(msg *awsevents.SQSMessage) int {
+	count, err := strconv.Atoi(msg.Attributes["ApproximateReceiveCount"])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// unwrapSnsEnvelope returns the SES event from an SNS notification, or body
+// unchanged if it isn't an SNS notification.
+func unwrapSnsEnvelope(body string) string {
+	envelope := &snsEnvelope{}
+
+	err := json.Unmarshal([]byte(body), envelope)
+	if err != nil || envelope.Type != "Notification" || envelope.Message == "" {
+		return body
+	}
+	return envelope.Message
+}
+
+func appendBatchItemFailure(
+	failures []awsevents.SQSBatchItemFailure, messageId string,
+) []awsevents.SQSBatchItemFailure {
+	return append(
+		failures, awsevents.SQSBatchItemFailure{ItemIdentifier: messageId},
+	)
+}
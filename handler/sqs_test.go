@@ -0,0 +1,231 @@
+//go:build small_tests || all_tests
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	awsevents "github.com/aws/aws-lambda-go/events"
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type sqsHandlerFixture struct {
+	agent   *testAgent
+	logs    *testutils.Logs
+	handler *sqsHandler
+	ctx     context.Context
+}
+
+func newSqsHandlerFixture() *sqsHandlerFixture {
+	logs, logger := newTestLogs()
+	agent := &testAgent{}
+	sns := &snsHandler{Agent: agent, Log: logger}
+	return &sqsHandlerFixture{
+		agent, logs, &sqsHandler{sns}, context.Background(),
+	}
+}
+
+func snsEnvelopeJson(msg string) string {
+	envelope, err := json.Marshal(&snsEnvelope{
+		Type: "Notification", Message: msg,
+	})
+
+	if err != nil {
+		panic("failed to json.Marshal test SNS envelope: " + err.Error())
+	}
+	return string(envelope)
+}
+
+func sqsEventForBodies(bodies map[string]string, ids ...string) (
+	event *awsevents.SQSEvent,
+) {
+	event = &awsevents.SQSEvent{}
+
+	for _, id := range ids {
+		event.Records = append(
+			event.Records,
+			awsevents.SQSMessage{
+				MessageId:   id,
+				EventSource: "aws:sqs",
+				Body:        bodies[id],
+			},
+		)
+	}
+	return
+}
+
+func batchItemFailureIds(res *awsevents.SQSEventResponse) []string {
+	ids := make([]string, 0, len(res.BatchItemFailures))
+
+	for _, failure := range res.BatchItemFailures {
+		ids = append(ids, failure.ItemIdentifier)
+	}
+	return ids
+}
+
+func TestUnwrapSnsEnvelope(t *testing.T) {
+	t.Run("ReturnsMessageFromSnsNotification", func(t *testing.T) {
+		body := snsEnvelopeJson(sendEventJson)
+
+		assert.Equal(t, sendEventJson, unwrapSnsEnvelope(body))
+	})
+
+	t.Run("ReturnsRawSesEvent", func(t *testing.T) {
+		assert.Equal(t, sendEventJson, unwrapSnsEnvelope(sendEventJson))
+	})
+
+	t.Run("ReturnsBodyIfNotJson", func(t *testing.T) {
+		assert.Equal(t, "not JSON", unwrapSnsEnvelope("not JSON"))
+	})
+
+	t.Run("ReturnsBodyIfNotNotification", func(t *testing.T) {
+		const body = `{"Type": "SubscriptionConfirmation", "Message": "foo"}`
+
+		assert.Equal(t, body, unwrapSnsEnvelope(body))
+	})
+}
+
+func TestHandleSqsEvent(t *testing.T) {
+	t.Run("ReturnsNoFailuresIfNoRecords", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+
+		res := f.handler.HandleEvent(f.ctx, &awsevents.SQSEvent{})
+
+		assert.Assert(t, is.Len(res.BatchItemFailures, 0))
+		assert.Equal(t, "", f.logs.Logs())
+	})
+
+	t.Run("HandlesRawAndSnsWrappedEvents", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		bounce := bounceEventJson("Permanent", "General")
+		event := sqsEventForBodies(
+			map[string]string{
+				"raw": bounce, "wrapped": snsEnvelopeJson(bounce),
+			},
+			"raw", "wrapped",
+		)
+
+		res := f.handler.HandleEvent(f.ctx, event)
+
+		assert.Assert(t, is.Len(res.BatchItemFailures, 0))
+		assert.Assert(t, is.Len(f.agent.Calls, 2))
+		assert.Equal(t, "Remove", f.agent.Calls[0].Method)
+		assert.Equal(t, "recipient@example.com", f.agent.Calls[0].Email)
+		assert.Equal(t, "Remove", f.agent.Calls[1].Method)
+	})
+
+	t.Run("ReportsMalformedMessages", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		event := sqsEventForBodies(
+			map[string]string{
+				"good-raw":     sendEventJson,
+				"not-json":     "not JSON",
+				"good-wrapped": snsEnvelopeJson(deliveryEventJson),
+				"bad-wrapped":  snsEnvelopeJson(`{"eventType": `),
+			},
+			"good-raw", "not-json", "good-wrapped", "bad-wrapped",
+		)
+
+		res := f.handler.HandleEvent(f.ctx, event)
+
+		expected := []string{"not-json", "bad-wrapped"}
+		assert.DeepEqual(t, expected, batchItemFailureIds(res))
+		f.logs.AssertContains(
+			t, "parsing SES event from SQS message not-json failed: ",
+		)
+		f.logs.AssertContains(
+			t, "parsing SES event from SQS message bad-wrapped failed: ",
+		)
+		f.logs.AssertContains(t, "Send [")
+		f.logs.AssertContains(t, "Delivery [")
+	})
+
+	t.Run("ReportsExternalUpdateFailures", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		f.agent.Error = newOpsErrExternal("db unavailable")
+		bounce := bounceEventJson("Permanent", "General")
+		event := sqsEventForBodies(
+			map[string]string{"send": sendEventJson, "bounce": bounce},
+			"send", "bounce",
+		)
+
+		res := f.handler.HandleEvent(f.ctx, event)
+
+		assert.DeepEqual(t, []string{"bounce"}, batchItemFailureIds(res))
+		f.logs.AssertContains(t, "db unavailable")
+	})
+
+	t.Run("RetriedBounceDoesNotGoToDeadLetterQueue", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		f.handler.Sns.Options.BouncePolicy = BouncePolicy{
+			"Transient/MailboxFull": BounceRetry,
+		}
+		f.handler.Sns.Options.BounceRetries = 2
+		const maxReceiveCount = 3
+		event := sqsEventForBodies(
+			map[string]string{
+				"bounce": bounceEventJson("Transient", "MailboxFull"),
+			},
+			"bounce",
+		)
+
+		// Emulate SQS redelivering the message until it's either handled
+		// successfully or moved to the dead-letter queue.
+		receives := 0
+		deadLettered := false
+		for handled := false; !handled && !deadLettered; {
+			receives++
+			event.Records[0].Attributes = map[string]string{
+				"ApproximateReceiveCount": strconv.Itoa(receives),
+			}
+			res := f.handler.HandleEvent(f.ctx, event)
+			handled = len(res.BatchItemFailures) == 0
+			deadLettered = !handled && receives == maxReceiveCount
+		}
+
+		assert.Assert(t, !deadLettered)
+		assert.Equal(t, 3, receives)
+		assert.Assert(t, is.Nil(f.agent.Calls))
+		f.logs.AssertContains(t, "not removing recipients, will retry: ")
+		f.logs.AssertContains(t, "not removing recipients, retried 2 times: ")
+	})
+
+	t.Run("RetriesBounceWithoutReceiveCount", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		f.handler.Sns.Options.BouncePolicy = BouncePolicy{
+			"Transient/MailboxFull": BounceRetry,
+		}
+		event := sqsEventForBodies(
+			map[string]string{
+				"bounce": bounceEventJson("Transient", "MailboxFull"),
+			},
+			"bounce",
+		)
+
+		res := f.handler.HandleEvent(f.ctx, event)
+
+		assert.DeepEqual(t, []string{"bounce"}, batchItemFailureIds(res))
+	})
+
+	t.Run("DoesNotRetryUpdatesFailingForOtherReasons", func(t *testing.T) {
+		f := newSqsHandlerFixture()
+		f.agent.Error = errors.New("subscriber not found")
+		event := sqsEventForBodies(
+			map[string]string{
+				"bounce": bounceEventJson("Permanent", "General"),
+			},
+			"bounce",
+		)
+
+		res := f.handler.HandleEvent(f.ctx, event)
+
+		assert.Assert(t, is.Len(res.BatchItemFailures, 0))
+		f.logs.AssertContains(t, "subscriber not found")
+	})
+}
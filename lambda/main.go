@@ -6,6 +6,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
@@ -23,11 +24,36 @@ import (
 func buildHandler() (h *handler.Handler, err error) {
 	var cfg aws.Config
 	var opts *handler.Options
+	var hopts []handler.HandlerOption
+	var sendLog agent.SendLog
+	var mxFailureStore email.MxFailureStore
+	var metrics ops.Metrics
 
 	if cfg, err = ops.LoadDefaultAwsConfig(); err != nil {
 		return
 	} else if opts, err = handler.GetOptions(os.Getenv); err != nil {
 		return
+	} else if hopts, err = handlerOptions(opts); err != nil {
+		return
+	}
+	if opts.SesEventsTableName != "" {
+		eventLog := db.NewDynamoDbEventLog(
+			cfg, opts.SesEventsTableName, opts.SesEventsTtl,
+		)
+		hopts = append(hopts, handler.WithSesEventLog(eventLog))
+		mxFailureStore = eventLog
+
+		sendLogTtl := opts.SendLogTtl
+		if sendLogTtl <= 0 {
+			sendLogTtl = db.DefaultSendLogTtl
+		}
+		sendLog = db.NewDynamoDbEventLog(
+			cfg, opts.SesEventsTableName, sendLogTtl,
+		)
+	}
+	if opts.MetricsNamespace != "" {
+		metrics = &ops.EmfMetrics{Namespace: opts.MetricsNamespace}
+		hopts = append(hopts, handler.WithMetrics(metrics))
 	}
 
 	sesv2Client := sesv2.NewFromConfig(cfg)
@@ -35,6 +61,8 @@ func buildHandler() (h *handler.Handler, err error) {
 		context.Background(),
 		sesv2Client,
 		opts.MaxBulkSendCapacity,
+		opts.MaxSendRateCapacity,
+		opts.SendRate,
 		time.Sleep,
 		time.Now,
 		time.Minute, // Could be configurable one day.
@@ -44,9 +72,32 @@ func buildHandler() (h *handler.Handler, err error) {
 		return
 	}
 
+	var fromIdentityArn string
+	if len(opts.SenderIdentityArns) != 0 {
+		fromIdentityArn, err = email.SelectMailFromIdentity(
+			context.Background(),
+			sesv2Client,
+			opts.SenderIdentityArns,
+			opts.EmailDomainName,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	signer, err := newDkimSigner(opts)
+	if err != nil {
+		return
+	}
+
 	suppressor := &email.SesSuppressor{Client: sesv2Client}
 	logger := log.Default()
 
+	var suppressionReasons email.SuppressionReasonLookup
+	if opts.LookupSuppressionReasons {
+		suppressionReasons = suppressor
+	}
+
 	h, err = handler.NewHandler(
 		opts.EmailDomainName,
 		opts.EmailSiteTitle,
@@ -67,32 +118,139 @@ func buildHandler() (h *handler.Handler, err error) {
 			ApiBaseUrl: fmt.Sprintf(
 				"https://%s/%s", opts.ApiDomainName, opts.ApiMappingKey,
 			),
-			NewUid:      uuid.NewUUID,
-			CurrentTime: time.Now,
-			Db:          db.NewDynamoDb(cfg, opts.SubscribersTableName),
+			ListHelpUrl:      opts.ListHelpUrl,
+			ListSubscribeUrl: opts.ListSubscribeUrl,
+			LinkSigningKey:   []byte(opts.LinkSigningKey),
+			NewUid:           uuid.NewUUID,
+			CurrentTime:      time.Now,
+			Db:               newDynamoDb(cfg, opts, logger),
 			Validator: &email.ProdAddressValidator{
-				Suppressor: suppressor,
-				Resolver:   net.DefaultResolver,
+				Suppressor:                suppressor,
+				Resolver:                  net.DefaultResolver,
+				AllowedSingleLabelDomains: opts.AllowedSingleLabelDomains,
+				AllowedIpLiteralRanges:    opts.AllowedIpLiteralRanges,
+				SuppressionReasons:        suppressionReasons,
+				InvalidUsers:              toLowerSet(opts.InvalidUserNames),
+				RoleUsers:                 toLowerSet(opts.RoleUserNames),
+				InvalidDomains:            toLowerSet(opts.InvalidDomains),
+				LookupTimeout:             opts.DnsLookupTimeout,
+				LookupLimit: &email.LookupLimit{
+					Max: opts.MaxConcurrentDnsLookups,
+				},
+				MxFailures: &email.MxFailurePolicy{
+					Threshold: opts.MxFailureThreshold,
+					Window:    opts.MxFailureWindow,
+					Store:     mxFailureStore,
+				},
 			},
 			Mailer: &email.SesMailer{
-				Client:    sesv2Client,
-				ConfigSet: opts.ConfigurationSet,
-				Throttle:  throttle,
+				Client:          sesv2Client,
+				ConfigSet:       opts.ConfigurationSet,
+				Throttle:        throttle,
+				MaxSendRetries:  opts.MaxSendRetries,
+				FromIdentityArn: fromIdentityArn,
+				Metrics:         metrics,
+				Signer:          signer,
+				DryRun:          opts.SendDryRun,
 			},
-			Suppressor: suppressor,
-			Log:        logger,
+			Suppressor:                 suppressor,
+			SendLog:                    sendLog,
+			SendDryRun:                 opts.SendDryRun,
+			Log:                        logger,
+			CheckSuppressionBeforeSend: opts.CheckSuppressionBeforeSend,
+			VerifyLinkExpiry:           opts.VerifyLinkExpiry,
+			Base64MaxQpRatio:           opts.Base64MaxQpRatio,
+			Base64MaxQpSize:            opts.Base64MaxQpSize,
 		},
 		opts.RedirectPaths,
 		handler.ResponseTemplate,
 		opts.UnsubscribeUserName,
 		&email.SesBouncer{
 			Client: ses.NewFromConfig(cfg),
+			DryRun: opts.BounceDryRun,
+			Log:    logger,
 		},
-		logger,
+		handler.NewStdLogger(logger),
+		hopts...,
 	)
 	return
 }
 
+// newDkimSigner returns nil if opts doesn't define a DKIM selector and key.
+//
+// It returns the email.DkimSigner interface, not *email.RsaDkimSigner, so that
+// SesMailer.Signer is a true nil when signing is disabled.
+func newDkimSigner(opts *handler.Options) (email.DkimSigner, error) {
+	if opts.DkimSelector == "" {
+		return nil, nil
+	}
+	return email.NewRsaDkimSigner(
+		opts.EmailDomainName, opts.DkimSelector, []byte(opts.DkimPrivateKey),
+	)
+}
+
+// toLowerSet returns a set of the lowercased values, or nil if values is empty.
+func toLowerSet(values []string) (set map[string]bool) {
+	if len(values) == 0 {
+		return
+	}
+	set = make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return
+}
+
+func newDynamoDb(
+	cfg aws.Config, opts *handler.Options, logger *log.Logger,
+) *db.DynamoDb {
+	var dbOpts []db.DynamoDbOption
+
+	if opts.LogConsumedCapacity {
+		report := func(operation string, units float64) {
+			logger.Printf(
+				"DynamoDB %s consumed %.1f capacity units", operation, units,
+			)
+		}
+		dbOpts = append(dbOpts, db.WithConsumedCapacity(report))
+	}
+	return db.NewDynamoDb(cfg, opts.SubscribersTableName, dbOpts...)
+}
+
+func handlerOptions(
+	opts *handler.Options,
+) (hopts []handler.HandlerOption, err error) {
+	hopts = []handler.HandlerOption{handler.WithSnsOptions(opts.SnsOptions)}
+
+	if opts.RedactEmailAddresses {
+		hopts = append(hopts, handler.WithRedactedAddresses())
+	}
+	if opts.MaintenanceMode {
+		hopts = append(hopts, handler.WithMaintenanceMode())
+	}
+	if opts.LinkSigningKey != "" {
+		hopts = append(hopts, handler.WithLinkSigningKey(opts.LinkSigningKey))
+	}
+	if opts.MailtoMaxAge > 0 {
+		hopts = append(hopts, handler.WithMailtoMaxAge(opts.MailtoMaxAge))
+	}
+	if opts.MailtoCatchAllUnsubscribe {
+		hopts = append(hopts, handler.WithMailtoCatchAllUnsubscribe())
+	}
+	if opts.VerifyRetries > 0 {
+		hopts = append(hopts, handler.WithVerifyRetries(opts.VerifyRetries))
+	}
+	if opts.ResponsePagesDir != "" {
+		var pages handler.ResponsePages
+		dir := opts.ResponsePagesDir
+		if pages, err = handler.LoadResponsePages(dir); err != nil {
+			return
+		}
+		hopts = append(hopts, handler.WithResponsePages(pages))
+	}
+	return
+}
+
 func main() {
 	// Disable standard logger flags. The CloudWatch logs show that the Lambda
 	// runtime already adds a timestamp at the beginning of every log line
@@ -11,6 +11,7 @@ const (
 	ApiPrefixSubscribe   = "/subscribe"
 	ApiPrefixVerify      = "/verify/"
 	ApiPrefixUnsubscribe = "/unsubscribe/"
+	ApiPrefixStatus      = "/status"
 )
 
 func VerifyUrl(apiBaseUrl, emailAddr string, uid uuid.UUID) string {
@@ -21,6 +22,20 @@ func UnsubscribeUrl(apiBaseUrl, emailAddr string, uid uuid.UUID) string {
 	return makeApiUrl(apiBaseUrl, ApiPrefixUnsubscribe, emailAddr, uid)
 }
 
+// UnsubscribeFormUrl returns a link to the unsubscribe form for emailAddr.
+//
+// Unlike UnsubscribeUrl, the email address and uid appear as query parameters,
+// not as path components.
+func UnsubscribeFormUrl(formUrl, emailAddr string, uid uuid.UUID) string {
+	sb := strings.Builder{}
+	sb.WriteString(formUrl)
+	sb.WriteString("?email=")
+	sb.WriteString(url.QueryEscape(emailAddr))
+	sb.WriteString("&uid=")
+	sb.WriteString(uid.String())
+	return sb.String()
+}
+
 func UnsubscribeMailto(unsubEmail, emailAddr string, uid uuid.UUID) string {
 	sb := strings.Builder{}
 	sb.WriteString("mailto:")
@@ -88,6 +88,14 @@ func TestApiEndpoints(t *testing.T) {
 			UnsubscribeUrl(baseUrl, email, uid))
 	})
 
+	t.Run("UnsubscribeFormUrl", func(t *testing.T) {
+		const formUrl = "https://foo.com/unsubscribe"
+		const expected = formUrl +
+			"?email=" + queryEncodedEmail + "&uid=" + uidStr
+
+		assert.Equal(t, expected, UnsubscribeFormUrl(formUrl, email, uid))
+	})
+
 	t.Run("UnsubscribeMailto", func(t *testing.T) {
 		const unsubEmail = "unsubscribe@foo.com"
 		const expected = "mailto:" + unsubEmail +
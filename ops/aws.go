@@ -28,6 +28,8 @@ func AwsError(prefix string, err error) error {
 func LoadDefaultAwsConfig() (cfg aws.Config, err error) {
 	if cfg, err = config.LoadDefaultConfig(context.Background()); err != nil {
 		err = fmt.Errorf("failed to load AWS config: %s", err)
+	} else {
+		UseBackoff(&cfg, DefaultBackoff)
 	}
 	return
 }
@@ -0,0 +1,110 @@
+package ops
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// Backoff determines how long to wait before retrying a failed request.
+//
+// attempt is the number of attempts that have failed so far, starting at 1.
+type Backoff interface {
+	NextDelay(attempt int) time.Duration
+}
+
+// FullJitterBackoff implements exponential backoff with "full jitter."
+//
+// NextDelay returns a random duration between zero and the smaller of Cap or
+// Base * 2^(attempt-1). Rand returns a random number in the range [0,n); if
+// nil, NextDelay uses math/rand/v2.Int64N.
+//
+// - https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type FullJitterBackoff struct {
+	Base time.Duration
+	Cap  time.Duration
+	Rand func(n int64) int64
+}
+
+func (b *FullJitterBackoff) NextDelay(attempt int) time.Duration {
+	limit := b.Cap
+
+	if attempt < 1 {
+		attempt = 1
+	}
+	if shift := attempt - 1; shift < 63 && b.Base < (b.Cap>>shift) {
+		limit = b.Base << shift
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	random := b.Rand
+	if random == nil {
+		random = rand.Int64N
+	}
+	return time.Duration(random(int64(limit) + 1))
+}
+
+// FixedBackoff always waits for the same Delay.
+//
+// A zero FixedBackoff retries immediately, which is useful in tests.
+type FixedBackoff struct {
+	Delay time.Duration
+}
+
+func (b *FixedBackoff) NextDelay(_ int) time.Duration {
+	return b.Delay
+}
+
+// Sleep waits for d to elapse before returning nil.
+//
+// It returns ctx.Err() immediately if ctx is cancelled before then.
+func Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// DefaultBackoff is the Backoff that LoadDefaultAwsConfig applies to all AWS
+// service clients.
+//
+// Its Cap matches the AWS SDK's default maximum backoff.
+var DefaultBackoff Backoff = &FullJitterBackoff{
+	Base: time.Second, Cap: 20 * time.Second,
+}
+
+// UseBackoff configures every AWS service client created from cfg to use b.
+//
+// This applies to DynamoDB, SES, Lambda, and any other client created via
+// NewFromConfig(cfg). Only the delay between attempts changes; which errors are
+// retryable and the maximum number of attempts remain the same.
+func UseBackoff(cfg *aws.Config, b Backoff) {
+	cfg.Retryer = func() aws.Retryer {
+		return NewRetryer(b)
+	}
+}
+
+// NewRetryer returns a standard AWS SDK retryer that delays retries using b.
+func NewRetryer(b Backoff) aws.Retryer {
+	return retry.NewStandard(func(opts *retry.StandardOptions) {
+		opts.Backoff = backoffDelayer{b}
+	})
+}
+
+// backoffDelayer adapts a Backoff to the retry.BackoffDelayer interface.
+type backoffDelayer struct {
+	backoff Backoff
+}
+
+func (d backoffDelayer) BackoffDelay(
+	attempt int, _ error,
+) (time.Duration, error) {
+	return d.backoff.NextDelay(attempt), nil
+}
@@ -0,0 +1,167 @@
+//go:build small_tests || all_tests
+
+package ops
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+type recordingBackoff struct {
+	FixedBackoff
+	attempts []int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return b.FixedBackoff.NextDelay(attempt)
+}
+
+// failingHttpClient returns an HTTP 500 response to every request.
+type failingHttpClient struct {
+	requests int
+}
+
+func (c *failingHttpClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestFullJitterBackoff(t *testing.T) {
+	// maxRand returns the largest possible value, so NextDelay returns the
+	// upper bound for each attempt.
+	maxRand := func(n int64) int64 { return n - 1 }
+	b := &FullJitterBackoff{
+		Base: 100 * time.Millisecond, Cap: time.Second, Rand: maxRand,
+	}
+
+	t.Run("DoublesUpperBoundWithEachAttempt", func(t *testing.T) {
+		assert.Equal(t, 100*time.Millisecond, b.NextDelay(1))
+		assert.Equal(t, 200*time.Millisecond, b.NextDelay(2))
+		assert.Equal(t, 400*time.Millisecond, b.NextDelay(3))
+		assert.Equal(t, 800*time.Millisecond, b.NextDelay(4))
+	})
+
+	t.Run("LimitsUpperBoundToCap", func(t *testing.T) {
+		assert.Equal(t, time.Second, b.NextDelay(5))
+		assert.Equal(t, time.Second, b.NextDelay(100))
+	})
+
+	t.Run("TreatsAttemptsBelowOneAsFirstAttempt", func(t *testing.T) {
+		assert.Equal(t, 100*time.Millisecond, b.NextDelay(0))
+	})
+
+	t.Run("ReturnsRandomDelayWithinUpperBound", func(t *testing.T) {
+		var limits []int64
+		b := &FullJitterBackoff{
+			Base: 100 * time.Millisecond,
+			Cap:  time.Second,
+			Rand: func(n int64) int64 {
+				limits = append(limits, n)
+				return n / 2
+			},
+		}
+
+		delay := b.NextDelay(2)
+
+		assert.DeepEqual(t, []int64{int64(200*time.Millisecond) + 1}, limits)
+		assert.Equal(t, 100*time.Millisecond, delay)
+	})
+
+	t.Run("UsesDefaultRandomNumberGenerator", func(t *testing.T) {
+		b := &FullJitterBackoff{Base: time.Millisecond, Cap: time.Second}
+
+		delay := b.NextDelay(3)
+
+		assert.Assert(t, delay >= 0 && delay <= 4*time.Millisecond)
+	})
+
+	t.Run("ReturnsZeroIfCapIsZero", func(t *testing.T) {
+		b := &FullJitterBackoff{Base: time.Second}
+
+		assert.Equal(t, time.Duration(0), b.NextDelay(1))
+	})
+}
+
+func TestFixedBackoff(t *testing.T) {
+	b := &FixedBackoff{Delay: 250 * time.Millisecond}
+
+	assert.Equal(t, 250*time.Millisecond, b.NextDelay(1))
+	assert.Equal(t, 250*time.Millisecond, b.NextDelay(10))
+}
+
+func TestSleep(t *testing.T) {
+	t.Run("ReturnsNilAfterDelay", func(t *testing.T) {
+		assert.NilError(t, Sleep(context.Background(), time.Millisecond))
+	})
+
+	t.Run("ReturnsEarlyIfContextCancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		err := Sleep(ctx, time.Minute)
+
+		assert.Assert(t, testutils.ErrorIs(err, context.Canceled))
+		assert.Assert(t, time.Since(start) < time.Minute)
+	})
+}
+
+func TestUseBackoff(t *testing.T) {
+	setup := func() (*dynamodb.Client, *failingHttpClient, *recordingBackoff) {
+		httpClient := &failingHttpClient{}
+		backoff := &recordingBackoff{}
+		cfg := aws.Config{
+			Region: "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider(
+				"access key", "secret key", "",
+			),
+			HTTPClient:       httpClient,
+			RetryMaxAttempts: 4,
+		}
+		UseBackoff(&cfg, backoff)
+		return dynamodb.NewFromConfig(cfg), httpClient, backoff
+	}
+
+	t.Run("RetriesConsultInjectedBackoff", func(t *testing.T) {
+		client, httpClient, backoff := setup()
+		input := &dynamodb.GetItemInput{
+			TableName: aws.String("table"),
+			Key: map[string]types.AttributeValue{
+				"email": &types.AttributeValueMemberS{Value: "foo@bar.com"},
+			},
+		}
+
+		_, err := client.GetItem(context.Background(), input)
+
+		assert.ErrorContains(t, err, "exceeded maximum number of attempts, 4")
+		assert.Equal(t, 4, httpClient.requests)
+		assert.DeepEqual(t, []int{1, 2, 3}, backoff.attempts)
+	})
+
+	t.Run("NewRetryerUsesBackoff", func(t *testing.T) {
+		backoff := &recordingBackoff{FixedBackoff: FixedBackoff{time.Minute}}
+
+		delay, err := NewRetryer(backoff).RetryDelay(2, nil)
+
+		assert.NilError(t, err)
+		assert.Equal(t, time.Minute, delay)
+		assert.DeepEqual(t, []int{2}, backoff.attempts)
+	})
+}
@@ -7,3 +7,16 @@ import "github.com/mbland/elistman/types"
 // handler.Handler checks for this error in order to return an HTTP 502 when
 // applicable.
 const ErrExternal = types.SentinelError("external error")
+
+// ErrBlocked indicates that an address isn't allowed to subscribe.
+//
+// This happens when an address is on the Simple Email Service account-level
+// suppression list, usually because of a previous bounce or complaint.
+// handler.Handler maps this error to the Blocked redirect.
+const ErrBlocked = types.SentinelError("address is blocked")
+
+// ErrInvalidSignature indicates a missing or incorrect link signature.
+//
+// handler.Handler checks verify and unsubscribe link signatures using
+// CheckLinkSignature before performing any operation.
+const ErrInvalidSignature = types.SentinelError("invalid link signature")
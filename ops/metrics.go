@@ -0,0 +1,147 @@
+package ops
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Metrics emits counts and durations of significant events, such as sends,
+// bounces, and deliveries.
+//
+// dims contains the names and values of the metric's dimensions, and may be
+// nil.
+type Metrics interface {
+	Count(name string, value float64, dims map[string]string)
+	Milliseconds(name string, value float64, dims map[string]string)
+}
+
+// CountMetric calls m.Count if m isn't nil.
+//
+// This enables metrics to be optional, without every caller checking for nil.
+func CountMetric(
+	m Metrics, name string, value float64, dims map[string]string,
+) {
+	if m != nil {
+		m.Count(name, value, dims)
+	}
+}
+
+// MillisecondsMetric calls m.Milliseconds if m isn't nil.
+func MillisecondsMetric(
+	m Metrics, name string, value float64, dims map[string]string,
+) {
+	if m != nil {
+		m.Milliseconds(name, value, dims)
+	}
+}
+
+// EmfMetric describes a metric in the CloudWatch embedded metric format.
+//
+// Printing an embedded metric format object as a single line to the Lambda
+// function's logs causes CloudWatch to extract the metrics it contains, without
+// requiring any additional permissions or API calls.
+//
+//   - https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type EmfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type EmfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []EmfMetric `json:"Metrics"`
+}
+
+type EmfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []EmfDirective `json:"CloudWatchMetrics"`
+}
+
+// EmfMetrics implements Metrics by writing each metric to Writer as a line of
+// CloudWatch embedded metric format JSON.
+type EmfMetrics struct {
+	Namespace string
+
+	// Writer defaults to os.Stdout if nil.
+	Writer io.Writer
+
+	// CurrentTime returns the current time. Defaults to time.Now if nil.
+	CurrentTime func() time.Time
+
+	mutex sync.Mutex
+}
+
+// Count writes a single metric with the Unit "Count".
+//
+// If dims isn't empty, the metric has two dimension sets: one with no
+// dimensions, and one with all of dims. The dimensionless set aggregates every
+// value of dims, so that alarms can apply to the metric as a whole, such as
+// the overall rate of bounces.
+func (m *EmfMetrics) Count(
+	name string, value float64, dims map[string]string,
+) {
+	m.emit(name, "Count", value, dims)
+}
+
+// Milliseconds writes a single metric with the Unit "Milliseconds", with the
+// same dimension sets as Count.
+func (m *EmfMetrics) Milliseconds(
+	name string, value float64, dims map[string]string,
+) {
+	m.emit(name, "Milliseconds", value, dims)
+}
+
+func (m *EmfMetrics) emit(
+	name, unit string, value float64, dims map[string]string,
+) {
+	now := time.Now
+	if m.CurrentTime != nil {
+		now = m.CurrentTime
+	}
+	dimSets := [][]string{{}}
+	if len(dims) != 0 {
+		dimSets = append(dimSets, slices.Sorted(maps.Keys(dims)))
+	}
+
+	metrics := map[string]any{
+		"_aws": &EmfMetadata{
+			Timestamp: now().UnixMilli(),
+			CloudWatchMetrics: []EmfDirective{
+				{
+					Namespace:  m.Namespace,
+					Dimensions: dimSets,
+					Metrics:    []EmfMetric{{Name: name, Unit: unit}},
+				},
+			},
+		},
+		name: value,
+	}
+	for dimName, dimValue := range dims {
+		metrics[dimName] = dimValue
+	}
+
+	// Marshaling can't fail, since metrics contains only strings, numbers,
+	// and structs thereof.
+	data, _ := json.Marshal(metrics)
+	m.write(append(data, '\n'))
+}
+
+// write writes data with a single call to Writer, so that lines written by
+// concurrent calls don't interleave.
+func (m *EmfMetrics) write(data []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	w := m.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	// There's nothing useful to do if writing a metric fails.
+	w.Write(data)
+}
@@ -0,0 +1,148 @@
+//go:build small_tests || all_tests
+
+package ops
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestEmfMetrics(t *testing.T) {
+	timestamp := time.Date(1970, time.September, 18, 12, 45, 0, 0, time.UTC)
+
+	setup := func() (*EmfMetrics, *strings.Builder) {
+		buf := &strings.Builder{}
+		metrics := &EmfMetrics{
+			Namespace:   "EListMan",
+			Writer:      buf,
+			CurrentTime: func() time.Time { return timestamp },
+		}
+		return metrics, buf
+	}
+
+	parseLine := func(t *testing.T, line string) (metrics map[string]any) {
+		t.Helper()
+		assert.NilError(t, json.Unmarshal([]byte(line), &metrics))
+		return
+	}
+
+	directive := func(metrics map[string]any) map[string]any {
+		metadata := metrics["_aws"].(map[string]any)
+		return metadata["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	}
+
+	t.Run("EmitsCountWithoutDimensions", func(t *testing.T) {
+		m, buf := setup()
+
+		m.Count("Send", 1, nil)
+
+		output := buf.String()
+		assert.Assert(t, strings.HasSuffix(output, "}\n"))
+		metrics := parseLine(t, output)
+		assert.Equal(t, float64(1), metrics["Send"])
+		metadata := metrics["_aws"].(map[string]any)
+		assert.Equal(t, float64(timestamp.UnixMilli()), metadata["Timestamp"])
+
+		d := directive(metrics)
+		assert.Equal(t, "EListMan", d["Namespace"])
+		assert.DeepEqual(t, []any{[]any{}}, d["Dimensions"])
+		assert.DeepEqual(
+			t, []any{map[string]any{"Name": "Send", "Unit": "Count"}},
+			d["Metrics"],
+		)
+	})
+
+	t.Run("EmitsDimensionlessAndSortedDimensionSets", func(t *testing.T) {
+		m, buf := setup()
+
+		m.Count("Bounce", 2, map[string]string{
+			"BounceType": "Permanent", "BounceSubType": "General",
+		})
+
+		metrics := parseLine(t, buf.String())
+		assert.Equal(t, float64(2), metrics["Bounce"])
+		assert.Equal(t, "Permanent", metrics["BounceType"])
+		assert.Equal(t, "General", metrics["BounceSubType"])
+		assert.DeepEqual(
+			t,
+			[]any{[]any{}, []any{"BounceSubType", "BounceType"}},
+			directive(metrics)["Dimensions"],
+		)
+	})
+
+	t.Run("EmitsMilliseconds", func(t *testing.T) {
+		m, buf := setup()
+
+		m.Milliseconds("DeliveryProcessingTime", 27, nil)
+
+		metrics := parseLine(t, buf.String())
+		assert.Equal(t, float64(27), metrics["DeliveryProcessingTime"])
+		d := directive(metrics)
+		assert.DeepEqual(t, []any{[]any{}}, d["Dimensions"])
+		assert.DeepEqual(
+			t,
+			[]any{
+				map[string]any{
+					"Name": "DeliveryProcessingTime", "Unit": "Milliseconds",
+				},
+			},
+			d["Metrics"],
+		)
+	})
+
+	t.Run("EmitsOneLinePerCount", func(t *testing.T) {
+		m, buf := setup()
+		var wg sync.WaitGroup
+
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.Count("Send", 1, nil)
+			}()
+		}
+		wg.Wait()
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Assert(t, is.Len(lines, 10))
+		for _, line := range lines {
+			assert.Equal(t, float64(1), parseLine(t, line)["Send"])
+		}
+	})
+}
+
+func TestCountMetric(t *testing.T) {
+	t.Run("IgnoresNilMetrics", func(t *testing.T) {
+		CountMetric(nil, "Send", 1, nil)
+	})
+
+	t.Run("CallsCount", func(t *testing.T) {
+		buf := &strings.Builder{}
+
+		CountMetric(&EmfMetrics{Writer: buf}, "Send", 1, nil)
+
+		assert.Assert(t, is.Contains(buf.String(), `"Send":1`))
+	})
+}
+
+func TestMillisecondsMetric(t *testing.T) {
+	t.Run("IgnoresNilMetrics", func(t *testing.T) {
+		MillisecondsMetric(nil, "DeliveryProcessingTime", 27, nil)
+	})
+
+	t.Run("CallsMilliseconds", func(t *testing.T) {
+		buf := &strings.Builder{}
+
+		MillisecondsMetric(
+			&EmfMetrics{Writer: buf}, "DeliveryProcessingTime", 27, nil,
+		)
+
+		assert.Assert(t, is.Contains(buf.String(), `"Unit":"Milliseconds"`))
+	})
+}
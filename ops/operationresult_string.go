@@ -14,11 +14,14 @@ func _() {
 	_ = x[Subscribed-3]
 	_ = x[NotSubscribed-4]
 	_ = x[Unsubscribed-5]
+	_ = x[Blocked-6]
+	_ = x[LinkExpired-7]
+	_ = x[UnknownSubscriber-8]
 }
 
-const _OperationResult_name = "InvalidAlreadySubscribedVerifyLinkSentSubscribedNotSubscribedUnsubscribed"
+const _OperationResult_name = "InvalidAlreadySubscribedVerifyLinkSentSubscribedNotSubscribedUnsubscribedBlockedLinkExpiredUnknownSubscriber"
 
-var _OperationResult_index = [...]uint8{0, 7, 24, 38, 48, 61, 73}
+var _OperationResult_index = [...]uint8{0, 7, 24, 38, 48, 61, 73, 80, 91, 108}
 
 func (i OperationResult) String() string {
 	if i < 0 || i >= OperationResult(len(_OperationResult_index)-1) {
@@ -10,4 +10,7 @@ const (
 	Subscribed
 	NotSubscribed
 	Unsubscribed
+	Blocked
+	LinkExpired
+	UnknownSubscriber
 )
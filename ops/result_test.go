@@ -15,4 +15,7 @@ func TestUnknownResult(t *testing.T) {
 
 func TestKnownResult(t *testing.T) {
 	assert.Equal(t, "Subscribed", Subscribed.String())
+	assert.Equal(t, "Blocked", Blocked.String())
+	assert.Equal(t, "LinkExpired", LinkExpired.String())
+	assert.Equal(t, "UnknownSubscriber", UnknownSubscriber.String())
 }
@@ -0,0 +1,67 @@
+package ops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ApiParamSignature is the name of the verify and unsubscribe link parameter
+// containing the LinkSignature.
+const ApiParamSignature = "sig"
+
+// LinkSignature returns an HMAC-SHA256 signature of emailAddr and uid.
+//
+// Adding the signature to verify and unsubscribe links makes them unforgeable
+// by anyone who doesn't know key, even if they know or can guess the uid.
+//
+// Returns the empty string if key is empty.
+func LinkSignature(key []byte, emailAddr string, uid uuid.UUID) string {
+	if len(key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(emailAddr + " " + uid.String()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckLinkSignature returns ErrInvalidSignature if sig doesn't match the
+// LinkSignature for emailAddr and uid.
+//
+// Always returns nil if key is empty.
+func CheckLinkSignature(
+	key []byte, emailAddr string, uid uuid.UUID, sig string,
+) error {
+	if len(key) == 0 {
+		return nil
+	} else if sig == "" {
+		const errFmt = "%w: missing %s"
+		return fmt.Errorf(errFmt, ErrInvalidSignature, ApiParamSignature)
+	}
+
+	expected := LinkSignature(key, emailAddr, uid)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignUrl adds sig to rawUrl as the ApiParamSignature query parameter.
+//
+// Returns rawUrl unchanged if sig is empty.
+func SignUrl(rawUrl, sig string) string {
+	if sig == "" {
+		return rawUrl
+	}
+
+	sep := "?"
+	if strings.Contains(rawUrl, "?") {
+		sep = "&"
+	}
+	return rawUrl + sep + ApiParamSignature + "=" + url.QueryEscape(sig)
+}
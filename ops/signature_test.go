@@ -0,0 +1,74 @@
+//go:build small_tests || all_tests
+
+package ops
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mbland/elistman/testutils"
+	"gotest.tools/assert"
+)
+
+func TestLinkSignature(t *testing.T) {
+	key := []byte("signing key")
+	const emailAddr = "mbland@acm.org"
+	uid := uuid.MustParse("00000000-1111-2222-3333-444444444444")
+	sig := LinkSignature(key, emailAddr, uid)
+
+	t.Run("ReturnsEmptyStringIfKeyIsEmpty", func(t *testing.T) {
+		assert.Equal(t, "", LinkSignature(nil, emailAddr, uid))
+	})
+
+	t.Run("SignatureDependsOnKeyAddressAndUid", func(t *testing.T) {
+		otherUid := uuid.MustParse("00000000-1111-2222-3333-555555555555")
+
+		assert.Assert(t, sig != "")
+		assert.Equal(t, sig, LinkSignature(key, emailAddr, uid))
+		assert.Assert(t, sig != LinkSignature([]byte("other"), emailAddr, uid))
+		assert.Assert(t, sig != LinkSignature(key, "foo@bar.com", uid))
+		assert.Assert(t, sig != LinkSignature(key, emailAddr, otherUid))
+	})
+
+	t.Run("CheckPassesForValidSignature", func(t *testing.T) {
+		assert.NilError(t, CheckLinkSignature(key, emailAddr, uid, sig))
+	})
+
+	t.Run("CheckFailsForTamperedSignature", func(t *testing.T) {
+		tampered := "X" + sig[1:]
+		if sig[0] == 'X' {
+			tampered = "Y" + sig[1:]
+		}
+
+		err := CheckLinkSignature(key, emailAddr, uid, tampered)
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrInvalidSignature))
+	})
+
+	t.Run("CheckFailsForMissingSignature", func(t *testing.T) {
+		err := CheckLinkSignature(key, emailAddr, uid, "")
+
+		assert.Assert(t, testutils.ErrorIs(err, ErrInvalidSignature))
+		assert.ErrorContains(t, err, "missing "+ApiParamSignature)
+	})
+
+	t.Run("CheckPassesIfKeyIsEmpty", func(t *testing.T) {
+		assert.NilError(t, CheckLinkSignature(nil, emailAddr, uid, ""))
+	})
+}
+
+func TestSignUrl(t *testing.T) {
+	t.Run("ReturnsUrlUnchangedIfSignatureEmpty", func(t *testing.T) {
+		assert.Equal(t, baseUrl, SignUrl(baseUrl, ""))
+	})
+
+	t.Run("AddsQueryString", func(t *testing.T) {
+		assert.Equal(t, baseUrl+"?sig=a-b_c", SignUrl(baseUrl, "a-b_c"))
+	})
+
+	t.Run("AppendsToExistingQueryString", func(t *testing.T) {
+		result := SignUrl(baseUrl+"?uid=0123", "a-b_c")
+
+		assert.Equal(t, baseUrl+"?uid=0123&sig=a-b_c", result)
+	})
+}
@@ -2,16 +2,24 @@ package testdoubles
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/mbland/elistman/email"
 	"gotest.tools/assert"
 )
 
+// AddressValidator returns preset validation results. ValidateAddress is safe
+// for concurrent use.
 type AddressValidator struct {
 	Email   string
 	Failure *email.ValidationFailure
 	Error   error
+
+	// Failures, if it contains an address, overrides Failure for that address.
+	Failures map[string]*email.ValidationFailure
+
+	mutex sync.Mutex
 }
 
 func NewAddressValidator() *AddressValidator {
@@ -21,7 +29,13 @@ func NewAddressValidator() *AddressValidator {
 func (av *AddressValidator) ValidateAddress(
 	ctx context.Context, email string,
 ) (*email.ValidationFailure, error) {
+	av.mutex.Lock()
+	defer av.mutex.Unlock()
+
 	av.Email = email
+	if failure, ok := av.Failures[email]; ok {
+		return failure, av.Error
+	}
 	return av.Failure, av.Error
 }
 
@@ -2,10 +2,19 @@ package testdoubles
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/mbland/elistman/db"
 )
 
+// Database is an in-memory db.Database.
+//
+// Get, Put, PutIfAbsent, and Delete are safe for concurrent use, so tests can
+// exercise overlapping operations on different subscribers.
 type Database struct {
 	Subscribers         []*db.Subscriber
 	SimulateGetErr      func(emailAddress string) error
@@ -14,6 +23,7 @@ type Database struct {
 	SimulateCountErr    func(emailAddress string) error
 	SimulateProcSubsErr func(emailAddress string) error
 	Index               map[string]*db.Subscriber
+	mutex               sync.Mutex
 }
 
 func NewDatabase() *Database {
@@ -37,6 +47,8 @@ func (dbase *Database) Get(
 	if err = dbase.SimulateGetErr(email); err != nil {
 		return
 	}
+	dbase.mutex.Lock()
+	defer dbase.mutex.Unlock()
 
 	var ok bool
 	if sub, ok = dbase.Index[email]; !ok {
@@ -49,15 +61,81 @@ func (dbase *Database) Put(_ context.Context, sub *db.Subscriber) error {
 	if err := dbase.SimulatePutErr(sub.Email); err != nil {
 		return err
 	}
+	dbase.mutex.Lock()
+	defer dbase.mutex.Unlock()
+	dbase.put(sub)
+	return nil
+}
+
+func (dbase *Database) put(sub *db.Subscriber) {
 	dbase.Subscribers = append(dbase.Subscribers, sub)
 	dbase.Index[sub.Email] = sub
+}
+
+func (dbase *Database) PutIfAbsent(
+	_ context.Context, sub *db.Subscriber,
+) error {
+	dbase.mutex.Lock()
+	defer dbase.mutex.Unlock()
+
+	if _, exists := dbase.Index[sub.Email]; exists {
+		const errFmt = "failed to put %s: %w"
+		return fmt.Errorf(errFmt, sub.Email, db.ErrSubscriberExists)
+	} else if err := dbase.SimulatePutErr(sub.Email); err != nil {
+		return err
+	}
+	dbase.put(sub)
 	return nil
 }
 
+// PutBatch puts each subscriber via Put, returning those for which
+// SimulatePutErr returns an error.
+func (dbase *Database) PutBatch(
+	ctx context.Context, subs []*db.Subscriber,
+) (failed []*db.Subscriber, err error) {
+	for _, sub := range subs {
+		if dbase.Put(ctx, sub) != nil {
+			failed = append(failed, sub)
+		} else {
+			sub.Version++
+		}
+	}
+	return
+}
+
+// PutBatchIfAbsent puts each new subscriber via Put, returning those for which
+// SimulatePutErr returns an error.
+//
+// Like db.DynamoDb.PutBatchIfAbsent, it never overwrites an existing
+// subscriber, and instead replaces the fields of sub with those of the stored
+// record.
+func (dbase *Database) PutBatchIfAbsent(
+	ctx context.Context, subs []*db.Subscriber,
+) (failed []*db.Subscriber, err error) {
+	for _, sub := range subs {
+		if existing := dbase.lookup(sub.Email); existing != nil {
+			*sub = *existing
+		} else if dbase.Put(ctx, sub) != nil {
+			failed = append(failed, sub)
+		} else {
+			sub.Version++
+		}
+	}
+	return
+}
+
+func (dbase *Database) lookup(email string) *db.Subscriber {
+	dbase.mutex.Lock()
+	defer dbase.mutex.Unlock()
+	return dbase.Index[email]
+}
+
 func (dbase *Database) Delete(_ context.Context, email string) error {
 	if err := dbase.SimulateDelErr(email); err != nil {
 		return err
 	}
+	dbase.mutex.Lock()
+	defer dbase.mutex.Unlock()
 
 	subIndex := -1
 
@@ -114,3 +192,98 @@ func (dbase *Database) ProcessSubscribers(
 	}
 	return nil
 }
+
+// ProcessSubscriberPages passes all subscribers with the status as one page.
+func (dbase *Database) ProcessSubscriberPages(
+	_ context.Context,
+	status db.SubscriberStatus,
+	processPage db.SubscriberPageFunc,
+) error {
+	page := make([]*db.Subscriber, 0, len(dbase.Subscribers))
+
+	for _, sub := range dbase.Subscribers {
+		if sub.Status != status {
+			continue
+		} else if err := dbase.SimulateProcSubsErr(sub.Email); err != nil {
+			return err
+		}
+		page = append(page, sub)
+	}
+	_, err := processPage(page)
+	return err
+}
+
+// GetSubscribersPage returns up to limit subscribers with the status in
+// order by email address, starting after the address encoded in startKey.
+//
+// Ordering by address ensures that paging continues correctly even if the
+// subscriber at startKey was deleted. Use db.EncodeStartKey and
+// db.DecodeStartKey to inspect or create start keys, which contain only the
+// "email" attribute.
+func (dbase *Database) GetSubscribersPage(
+	_ context.Context,
+	status db.SubscriberStatus,
+	startKey db.StartKey,
+	limit int,
+) (subs []*db.Subscriber, nextStartKey db.StartKey, err error) {
+	var startEmail string
+	if startEmail, err = startKeyEmail(startKey); err != nil {
+		return
+	}
+	subs = []*db.Subscriber{}
+	remaining := make([]*db.Subscriber, 0, len(dbase.Subscribers))
+
+	for _, sub := range dbase.Subscribers {
+		if sub.Status == status && sub.Email > startEmail {
+			remaining = append(remaining, sub)
+		}
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		return remaining[i].Email < remaining[j].Email
+	})
+
+	for _, sub := range remaining {
+		if limit > 0 && len(subs) == limit {
+			nextStartKey, err = newStartKey(subs[len(subs)-1].Email)
+			return
+		} else if err = dbase.SimulateProcSubsErr(sub.Email); err != nil {
+			return nil, nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return
+}
+
+// StartKeyAfter returns a StartKey containing only sub's "email" attribute,
+// like the start keys returned by GetSubscribersPage.
+func (dbase *Database) StartKeyAfter(sub *db.Subscriber) (db.StartKey, error) {
+	return newStartKey(sub.Email)
+}
+
+type startKeyEmailAttr struct {
+	Email struct{ S string } `json:"email"`
+}
+
+func newStartKey(email string) (db.StartKey, error) {
+	attr := &startKeyEmailAttr{}
+	attr.Email.S = email
+	encoded, err := json.Marshal(attr)
+	if err != nil {
+		return nil, err
+	}
+	return db.DecodeStartKey(string(encoded))
+}
+
+func startKeyEmail(startKey db.StartKey) (string, error) {
+	encoded, err := db.EncodeStartKey(startKey)
+	if err != nil || encoded == "" {
+		return "", err
+	}
+	var data []byte
+	if data, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+		return "", err
+	}
+	attr := &startKeyEmailAttr{}
+	err = json.Unmarshal(data, attr)
+	return attr.Email.S, err
+}
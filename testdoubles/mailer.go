@@ -2,14 +2,17 @@ package testdoubles
 
 import (
 	"context"
+	"sync"
 	"testing"
 )
 
+// Mailer records each message sent. Send is safe for concurrent use.
 type Mailer struct {
 	RecipientMessages map[string][]byte
 	MessageIds        map[string]string
 	RecipientErrors   map[string]error
 	BulkCapError      error
+	mutex             sync.Mutex
 }
 
 func NewMailer() *Mailer {
@@ -27,6 +30,9 @@ func (mailer *Mailer) BulkCapacityAvailable(_ context.Context) error {
 func (m *Mailer) Send(
 	ctx context.Context, recipient string, msg []byte,
 ) (messageId string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if err = m.RecipientErrors[recipient]; err == nil {
 		messageId = m.MessageIds[recipient]
 		m.RecipientMessages[recipient] = msg
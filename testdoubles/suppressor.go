@@ -2,13 +2,16 @@ package testdoubles
 
 import (
 	"context"
+	"sync"
 
 	"github.com/mbland/elistman/ops"
 )
 
+// Suppressor is an in-memory email.Suppressor that's safe for concurrent use.
 type Suppressor struct {
 	Addresses map[string]ops.RemoveReason
 	Errors    map[string]error
+	mutex     sync.Mutex
 }
 
 func NewSuppressor() *Suppressor {
@@ -21,15 +24,21 @@ func NewSuppressor() *Suppressor {
 func (s *Suppressor) IsSuppressed(
 	ctx context.Context, address string,
 ) (ok bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if err = s.Errors[address]; err != nil {
 		return
 	}
-	ok = s.Addresses[address] == ops.RemoveReasonNil
+	_, ok = s.Addresses[address]
 	return
 }
 
 func (s *Suppressor) Suppress(
 	ctx context.Context, address string, reason ops.RemoveReason) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if err := s.Errors[address]; err != nil {
 		return err
 	}
@@ -38,6 +47,9 @@ func (s *Suppressor) Suppress(
 }
 
 func (s *Suppressor) Unsuppress(ctx context.Context, address string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	if err := s.Errors[address]; err != nil {
 		return err
 	}